@@ -0,0 +1,243 @@
+package cleaner
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// KeyCleanAction 的可选项
+const (
+	CleanActionDelete  = "delete"
+	CleanActionArchive = "archive"
+)
+
+const defaultArchiveTimeout = 10 * time.Minute
+
+// Archiver 在清理日志文件之前把文件归档，归档成功后原文件可能已经被移走，
+// 归档失败时不会删除原文件
+type Archiver interface {
+	Archive(path string) error
+}
+
+// fileArchiver 把文件移动到 dir 中，可以先用 gzip 压缩，也可以上传到 S3 协议的对象存储(如 AWS S3、七牛 Kodo)
+type fileArchiver struct {
+	dir      string
+	gzip     bool
+	uploader *s3Uploader
+}
+
+func newArchiver(c conf.MapConf) (Archiver, error) {
+	action, _ := c.GetStringOr(KeyCleanAction, CleanActionDelete)
+	switch action {
+	case CleanActionDelete:
+		return nil, nil
+	case CleanActionArchive:
+	default:
+		return nil, fmt.Errorf("%v %v is not supported, should be %v or %v", KeyCleanAction, action, CleanActionDelete, CleanActionArchive)
+	}
+	a := &fileArchiver{}
+	a.dir, _ = c.GetStringOr(KeyArchiveDir, "")
+	a.gzip, _ = c.GetBoolOr(KeyArchiveGzip, false)
+	bucket, _ := c.GetStringOr(KeyArchiveS3Bucket, "")
+	if bucket != "" {
+		endpoint, err := c.GetString(KeyArchiveS3Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		ak, err := c.GetString(KeyArchiveS3AccessKey)
+		if err != nil {
+			return nil, err
+		}
+		sk, err := c.GetString(KeyArchiveS3SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		region, _ := c.GetStringOr(KeyArchiveS3Region, "us-east-1")
+		prefix, _ := c.GetStringOr(KeyArchiveS3Prefix, "")
+		a.uploader = newS3Uploader(endpoint, region, bucket, prefix, ak, sk)
+	}
+	if a.dir == "" && a.uploader == nil {
+		return nil, fmt.Errorf("%v or %v is required when %v is %v", KeyArchiveDir, KeyArchiveS3Bucket, KeyCleanAction, CleanActionArchive)
+	}
+	if a.dir != "" {
+		if err := os.MkdirAll(a.dir, DefaultDirPerm); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func (a *fileArchiver) Archive(filePath string) (err error) {
+	name := filepath.Base(filePath)
+	src := filePath
+	if a.gzip {
+		// 不放在日志目录中，避免临时文件被 reader 读取
+		dir := a.dir
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		name += ".gz"
+		if src, err = gzipFile(filePath, dir); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil || a.dir == "" {
+				os.Remove(src)
+			}
+		}()
+	}
+	if a.uploader != nil {
+		if err = a.uploader.upload(src, name); err != nil {
+			return err
+		}
+	}
+	if a.dir == "" {
+		return nil
+	}
+	dst := availablePath(filepath.Join(a.dir, name))
+	if a.gzip {
+		return os.Rename(src, dst)
+	}
+	return moveFile(src, dst)
+}
+
+// availablePath 在目标文件已经存在时加上时间后缀，避免覆盖之前归档的同名文件
+func availablePath(p string) string {
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return p
+	}
+	return fmt.Sprintf("%v.%v", p, time.Now().UnixNano())
+}
+
+// gzipFile 把文件压缩到 dir 中的临时文件，返回临时文件的路径
+func gzipFile(filePath, dir string) (string, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".gz.")
+	if err != nil {
+		return "", err
+	}
+	gw := gzip.NewWriter(tmp)
+	_, err = io.Copy(gw, src)
+	if err == nil {
+		err = gw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// moveFile 优先使用 rename，跨设备时复制后删除原文件
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// s3Uploader 使用 AWS Signature V4 通过 PUT Object 上传文件，兼容七牛 Kodo 等支持 S3 协议的对象存储
+type s3Uploader struct {
+	endpoint string
+	region   string
+	bucket   string
+	prefix   string
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func newS3Uploader(endpoint, region, bucket, prefix, ak, sk string) *s3Uploader {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	return &s3Uploader{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   region,
+		bucket:   bucket,
+		prefix:   prefix,
+		signer:   v4.NewSigner(credentials.NewStaticCredentials(ak, sk, "")),
+		client:   &http.Client{Timeout: defaultArchiveTimeout},
+	}
+}
+
+func (u *s3Uploader) objectURL(key string) string {
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	return u.endpoint + "/" + u.bucket + "/" + strings.TrimPrefix(escaped, "/")
+}
+
+func (u *s3Uploader) upload(filePath, name string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	key := path.Join(u.prefix, name)
+	req, err := http.NewRequest(http.MethodPut, u.objectURL(key), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	// signer 会读取 body 计算 sha256 并把位置恢复到开头
+	if _, err = u.signer.Sign(req, f, "s3", u.region, time.Now()); err != nil {
+		return err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload %v to bucket %v failed, status %v: %s", key, u.bucket, resp.StatusCode, body)
+	}
+	return nil
+}
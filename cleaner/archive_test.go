@@ -0,0 +1,132 @@
+package cleaner
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+func TestNewArchiver(t *testing.T) {
+	a, err := newArchiver(conf.MapConf{})
+	assert.NoError(t, err)
+	assert.Nil(t, a)
+
+	_, err = newArchiver(conf.MapConf{KeyCleanAction: "move"})
+	assert.Error(t, err)
+
+	_, err = newArchiver(conf.MapConf{KeyCleanAction: CleanActionArchive})
+	assert.Error(t, err)
+
+	_, err = newArchiver(conf.MapConf{KeyCleanAction: CleanActionArchive, KeyArchiveS3Bucket: "logs"})
+	assert.Error(t, err)
+
+	dir := "TestNewArchiver"
+	defer os.RemoveAll(dir)
+	a, err = newArchiver(conf.MapConf{KeyCleanAction: CleanActionArchive, KeyArchiveDir: dir})
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+	_, err = os.Stat(dir)
+	assert.NoError(t, err)
+}
+
+func TestArchiveToDir(t *testing.T) {
+	dir := "TestArchiveToDir"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "logs"), 0755))
+	archiveDir := filepath.Join(dir, "archive")
+	a, err := newArchiver(conf.MapConf{KeyCleanAction: CleanActionArchive, KeyArchiveDir: archiveDir})
+	assert.NoError(t, err)
+
+	logfile := filepath.Join(dir, "logs", "log1")
+	assert.NoError(t, ioutil.WriteFile(logfile, []byte("abc"), 0644))
+	assert.NoError(t, a.Archive(logfile))
+	_, err = os.Stat(logfile)
+	assert.True(t, os.IsNotExist(err))
+	got, err := ioutil.ReadFile(filepath.Join(archiveDir, "log1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(got))
+
+	// 同名文件不会覆盖之前的归档
+	assert.NoError(t, ioutil.WriteFile(logfile, []byte("def"), 0644))
+	assert.NoError(t, a.Archive(logfile))
+	files, err := ioutil.ReadDir(archiveDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+}
+
+func TestArchiveGzip(t *testing.T) {
+	dir := "TestArchiveGzip"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "logs"), 0755))
+	archiveDir := filepath.Join(dir, "archive")
+	a, err := newArchiver(conf.MapConf{KeyCleanAction: CleanActionArchive, KeyArchiveDir: archiveDir, KeyArchiveGzip: "true"})
+	assert.NoError(t, err)
+
+	logfile := filepath.Join(dir, "logs", "log1")
+	assert.NoError(t, ioutil.WriteFile(logfile, []byte("hello logkit"), 0644))
+	assert.NoError(t, a.Archive(logfile))
+	// 原文件由 cleaner 删除
+	_, err = os.Stat(logfile)
+	assert.NoError(t, err)
+
+	files, err := ioutil.ReadDir(archiveDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "log1.gz", files[0].Name())
+	f, err := os.Open(filepath.Join(archiveDir, "log1.gz"))
+	assert.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	got, err := ioutil.ReadAll(gr)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello logkit", string(got))
+}
+
+func TestArchiveS3(t *testing.T) {
+	var gotPath, gotAuth, gotBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer ts.Close()
+
+	dir := "TestArchiveS3"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	a, err := newArchiver(conf.MapConf{
+		KeyCleanAction:        CleanActionArchive,
+		KeyArchiveS3Endpoint:  ts.URL,
+		KeyArchiveS3Bucket:    "logs",
+		KeyArchiveS3Prefix:    "host1",
+		KeyArchiveS3AccessKey: "ak",
+		KeyArchiveS3SecretKey: "sk",
+	})
+	assert.NoError(t, err)
+
+	logfile := filepath.Join(dir, "log1")
+	assert.NoError(t, ioutil.WriteFile(logfile, []byte("abc"), 0644))
+	assert.NoError(t, a.Archive(logfile))
+	assert.Equal(t, "/logs/host1/log1", gotPath)
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=ak/"), gotAuth)
+	assert.Equal(t, "abc", gotBody)
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	assert.Error(t, a.Archive(logfile))
+}
@@ -1,25 +1,35 @@
 package cleaner
 
 import (
+	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/reader"
 	. "github.com/qiniu/logkit/utils/models"
+	utilsos "github.com/qiniu/logkit/utils/os"
 
 	"github.com/qiniu/log"
 )
 
 type Cleaner struct {
-	cleanTicker   <-chan time.Time
-	reserveNumber int64 //个
-	reserveSize   int64 //byte
-	meta          *reader.Meta
-	exitChan      chan struct{}
-	cleanChan     chan<- CleanSignal
-	name          string
-	logdir        string
+	cleanTicker    <-chan time.Time
+	reserveNumber  int64 //个
+	reserveSize    int64 //byte
+	reserveAge     time.Duration
+	reserveDirSize int64 //byte
+	dryRun         bool
+	archiver       Archiver
+	meta           *reader.Meta
+	exitChan       chan struct{}
+	cleanChan      chan<- CleanSignal
+	name           string
+	logdir         string
+
+	reportMutex sync.RWMutex
+	lastReport  *CleanReport
 }
 
 type CleanSignal struct {
@@ -27,6 +37,33 @@ type CleanSignal struct {
 	Filename string
 	Cleaner  string
 	ReadMode string
+	// Archiver 不为空时，文件在删除之前先归档
+	Archiver Archiver
+}
+
+// 文件被清理的原因
+const (
+	CleanReasonNumber  = "reserve_file_number"
+	CleanReasonSize    = "reserve_file_size"
+	CleanReasonAge     = "reserve_file_age"
+	CleanReasonDirSize = "reserve_dir_size"
+)
+
+// CleanFile 是一个被清理的文件
+type CleanFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Reason  string    `json:"reason"`
+}
+
+// CleanReport 是最近一次清理的结果，dry run 时只记录将要清理的文件，不做任何操作
+type CleanReport struct {
+	Time      time.Time   `json:"time"`
+	DryRun    bool        `json:"dry_run"`
+	Action    string      `json:"action"`
+	Files     []CleanFile `json:"files"`
+	TotalSize int64       `json:"total_size"`
 }
 
 const (
@@ -34,7 +71,21 @@ const (
 	KeyCleanInterval     = "delete_interval"
 	KeyReserveFileNumber = "reserve_file_number"
 	KeyReserveFileSize   = "reserve_file_size"
-	clean_name           = "cleaner_name"
+	KeyReserveFileAge    = "reserve_file_age" // 单位小时，已读取的文件修改时间超过该值后清理
+	KeyReserveDirSize    = "reserve_dir_size" // 单位MB，日志目录的总大小超过该值时从最老的已读文件开始清理
+	KeyCleanDryRun       = "clean_dry_run"
+	KeyCleanAction       = "clean_action"
+
+	KeyArchiveDir         = "archive_dir"
+	KeyArchiveGzip        = "archive_gzip"
+	KeyArchiveS3Endpoint  = "archive_s3_endpoint"
+	KeyArchiveS3Region    = "archive_s3_region"
+	KeyArchiveS3Bucket    = "archive_s3_bucket"
+	KeyArchiveS3AccessKey = "archive_s3_ak"
+	KeyArchiveS3SecretKey = "archive_s3_sk"
+	KeyArchiveS3Prefix    = "archive_s3_prefix"
+
+	KeyCleanerName = "cleaner_name" // 同一个日志目录被多个 runner 读取时用于区分各自的 cleaner，默认为 runner 名称
 
 	default_delete_interval     = 300  //5分钟
 	default_reserve_file_number = 10   //默认保存是个文件
@@ -43,6 +94,11 @@ const (
 	// 如果两项任意一项达到要求，就执行删除；如果两项容易一项有值设置，但是另一项为0，就认为另一项不做限制
 )
 
+// SupportMode 返回 cleaner 是否支持该 reader 模式
+func SupportMode(mode string) bool {
+	return mode == reader.ModeDir || mode == reader.ModeFile || mode == reader.ModeCloudTrail || mode == reader.ModeTailx
+}
+
 // 删除文件时遍历全部
 // 删除时生成filedeleted文件
 func NewCleaner(conf conf.MapConf, meta *reader.Meta, cleanChan chan<- CleanSignal, logdir string) (c *Cleaner, err error) {
@@ -51,7 +107,7 @@ func NewCleaner(conf conf.MapConf, meta *reader.Meta, cleanChan chan<- CleanSign
 		return
 	}
 	mode := meta.GetMode()
-	if mode != reader.ModeDir && mode != reader.ModeFile && mode != reader.ModeCloudTrail && mode != reader.ModeTailx {
+	if !SupportMode(mode) {
 		log.Errorf("cleaner only support reader mode dir|file|clocktrail|tailx, now mode is %v, cleaner disabled", meta.GetMode())
 		return
 	}
@@ -59,14 +115,21 @@ func NewCleaner(conf conf.MapConf, meta *reader.Meta, cleanChan chan<- CleanSign
 	if interval <= 0 {
 		interval = default_delete_interval
 	}
-	name, _ := conf.GetStringOr(clean_name, "unknow")
+	name, _ := conf.GetStringOr(KeyCleanerName, "unknow")
 	reserveNumber, _ := conf.GetInt64Or(KeyReserveFileNumber, 0)
 	reserveSize, _ := conf.GetInt64Or(KeyReserveFileSize, 0)
-	if reserveNumber <= 0 && reserveSize <= 0 {
+	reserveAge, _ := conf.GetInt64Or(KeyReserveFileAge, 0)
+	reserveDirSize, _ := conf.GetInt64Or(KeyReserveDirSize, 0)
+	if reserveNumber <= 0 && reserveSize <= 0 && reserveAge <= 0 && reserveDirSize <= 0 {
 		reserveNumber = default_reserve_file_number
 		reserveSize = default_reserve_file_size
 	}
 	reserveSize = reserveSize * MB
+	dryRun, _ := conf.GetBoolOr(KeyCleanDryRun, false)
+	archiver, err := newArchiver(conf)
+	if err != nil {
+		return nil, err
+	}
 	if mode != reader.ModeTailx {
 		logdir, _, err = GetRealPath(logdir)
 		if err != nil {
@@ -75,14 +138,18 @@ func NewCleaner(conf conf.MapConf, meta *reader.Meta, cleanChan chan<- CleanSign
 		}
 	}
 	c = &Cleaner{
-		cleanTicker:   time.NewTicker(time.Duration(interval) * time.Second).C,
-		reserveNumber: reserveNumber,
-		reserveSize:   reserveSize,
-		meta:          meta,
-		exitChan:      make(chan struct{}),
-		cleanChan:     cleanChan,
-		name:          name,
-		logdir:        logdir,
+		cleanTicker:    time.NewTicker(time.Duration(interval) * time.Second).C,
+		reserveNumber:  reserveNumber,
+		reserveSize:    reserveSize,
+		reserveAge:     time.Duration(reserveAge) * time.Hour,
+		reserveDirSize: reserveDirSize * MB,
+		dryRun:         dryRun,
+		archiver:       archiver,
+		meta:           meta,
+		exitChan:       make(chan struct{}),
+		cleanChan:      cleanChan,
+		name:           name,
+		logdir:         logdir,
 	}
 	return
 }
@@ -128,32 +195,64 @@ func (c *Cleaner) checkBelong(path string) bool {
 		return false
 	}
 	if c.meta.GetMode() == reader.ModeTailx {
-		matched, err := filepath.Match(filepath.Dir(c.logdir), filepath.Dir(path))
+		matched, err := utilsos.Match(filepath.Dir(c.logdir), filepath.Dir(path))
 		if err != nil {
 			log.Errorf("checkBelong %v %v err ", c.logdir, path, err)
 			return false
 		}
 		return matched
 	}
-	if dir != c.logdir {
-		return false
+	return utilsos.SamePath(dir, c.logdir)
+}
+
+// shouldCleanByAge 判断文件是否超过了保留时长
+func (c *Cleaner) shouldCleanByAge(info os.FileInfo, now time.Time) bool {
+	return c.reserveAge > 0 && now.Sub(info.ModTime()) > c.reserveAge
+}
+
+// dirSize 返回日志目录中所有文件的总大小，包括还没有读取完的文件
+func (c *Cleaner) dirSize() (size int64) {
+	pattern := filepath.Join(c.logdir, "*")
+	if c.meta.GetMode() == reader.ModeTailx {
+		pattern = filepath.Join(filepath.Dir(c.logdir), "*")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Errorf("%v glob %v error %v", c.name, pattern, err)
+		return
+	}
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		size += info.Size()
 	}
-	return true
+	return
+}
+
+func (c *Cleaner) action() string {
+	if c.archiver != nil {
+		return CleanActionArchive
+	}
+	return CleanActionDelete
 }
 
 func (c *Cleaner) Clean() (err error) {
 	var size int64 = 0
 	var count int64 = 0
-	beginClean := false
+	reason := ""
 	doneFiles, err := c.meta.GetDoneFiles()
 	if err != nil {
 		return err
 	}
+	now := time.Now()
 	checked := make(map[string]struct{})
-	for _, f := range doneFiles {
-		logFiles := GetLogFiles(f.Path)
-		allremoved := true
-		for _, logf := range logFiles {
+	// 已读取的文件按从新到旧排列，owners 记录文件所在的 done file
+	var files []CleanFile
+	var owners []int
+	for i, f := range doneFiles {
+		for _, logf := range GetLogFiles(f.Path) {
 			if !c.checkBelong(logf.Path) {
 				continue
 			}
@@ -163,33 +262,92 @@ func (c *Cleaner) Clean() (err error) {
 			checked[logf.Path] = struct{}{}
 			size += logf.Info.Size()
 			count++
+			file := CleanFile{Path: logf.Path, Size: logf.Info.Size(), ModTime: logf.Info.ModTime()}
 			// 一旦符合条件，更老的文件必然都要删除
-			if beginClean || c.shoudClean(size, count) {
-				beginClean = true
-				sig := CleanSignal{
-					Logdir:   filepath.Dir(logf.Path),
-					Filename: logf.Info.Name(),
-					Cleaner:  c.name,
-					ReadMode: c.meta.GetMode(),
-				}
-				log.Infof("send clean signal %v", sig)
-				c.cleanChan <- sig
-				if err = c.meta.AppendDeleteFile(logf.Path); err != nil {
-					log.Error(err)
+			if reason == "" && c.shoudClean(size, count) {
+				reason = CleanReasonSize
+				if c.reserveNumber > 0 && count > c.reserveNumber {
+					reason = CleanReasonNumber
 				}
-			} else {
-				allremoved = false
 			}
+			if reason != "" {
+				file.Reason = reason
+			} else if c.shouldCleanByAge(logf.Info, now) {
+				file.Reason = CleanReasonAge
+			}
+			files = append(files, file)
+			owners = append(owners, i)
+		}
+	}
+	if c.reserveDirSize > 0 {
+		// 从最老的文件开始清理，直到目录的总大小不超过限制
+		total := c.dirSize()
+		for i := len(files) - 1; i >= 0 && total > c.reserveDirSize; i-- {
+			if files[i].Reason == "" {
+				files[i].Reason = CleanReasonDirSize
+			}
+			total -= files[i].Size
+		}
+	}
+
+	report := &CleanReport{Time: now, DryRun: c.dryRun, Action: c.action()}
+	allremoved := make([]bool, len(doneFiles))
+	for i := range allremoved {
+		allremoved[i] = true
+	}
+	for i, file := range files {
+		if file.Reason == "" {
+			allremoved[owners[i]] = false
+			continue
+		}
+		report.Files = append(report.Files, file)
+		report.TotalSize += file.Size
+		if c.dryRun {
+			continue
+		}
+		sig := CleanSignal{
+			Logdir:   filepath.Dir(file.Path),
+			Filename: filepath.Base(file.Path),
+			Cleaner:  c.name,
+			ReadMode: c.meta.GetMode(),
+			Archiver: c.archiver,
 		}
-		if allremoved {
-			if err = c.meta.DeleteDoneFile(f.Path); err != nil {
-				log.Error(err)
+		log.Infof("send clean signal %v, reason %v", sig, file.Reason)
+		c.cleanChan <- sig
+		if err = c.meta.AppendDeleteFile(file.Path); err != nil {
+			log.Error(err)
+		}
+	}
+	c.reportMutex.Lock()
+	c.lastReport = report
+	c.reportMutex.Unlock()
+	if c.dryRun {
+		if len(report.Files) > 0 {
+			log.Infof("%v dry run: %v files (%v bytes) would be %v", c.name, len(report.Files), report.TotalSize, report.Action)
+			for _, file := range report.Files {
+				log.Infof("%v dry run: %v %v, size %v, reason %v", c.name, report.Action, file.Path, file.Size, file.Reason)
 			}
 		}
+		return nil
+	}
+	for i, f := range doneFiles {
+		if !allremoved[i] {
+			continue
+		}
+		if err = c.meta.DeleteDoneFile(f.Path); err != nil {
+			log.Error(err)
+		}
 	}
 	return nil
 }
 
+// LastReport 返回最近一次清理的结果，还没有执行过清理时返回 nil
+func (c *Cleaner) LastReport() *CleanReport {
+	c.reportMutex.RLock()
+	defer c.reportMutex.RUnlock()
+	return c.lastReport
+}
+
 func (c *Cleaner) LogDir() string {
 	return c.logdir
 }
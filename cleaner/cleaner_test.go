@@ -221,3 +221,162 @@ func Test_clean(t *testing.T) {
 		t.Fatalf("test clean error exps %v got %v", exps, gots)
 	}
 }
+
+func TestCleanDryRun(t *testing.T) {
+	donefiles := "TestCleanDryRun"
+	c := conf.MapConf{}
+	c[reader.KeyMetaPath] = donefiles
+	c[reader.KeyLogPath] = donefiles + "/" + "log"
+	c[reader.KeyMode] = "dir"
+	c[KeyCleanEnable] = "true"
+	c[KeyReserveFileNumber] = "1"
+	c[KeyCleanDryRun] = "true"
+	meta, err := reader.NewMetaWithConf(c)
+	if err != nil {
+		t.Error(err)
+	}
+	cs := make(chan CleanSignal, 10)
+	cl, err := NewCleaner(c, meta, cs, donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = GetTestFiles(donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(donefiles)
+	if cl.LastReport() != nil {
+		t.Fatal("report should be nil before clean")
+	}
+	err = cl.Clean()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(cs) != 0 {
+		t.Errorf("dry run should not send clean signal, got %v", len(cs))
+	}
+	files, err := ioutil.ReadDir(donefiles)
+	if err != nil {
+		t.Error(err)
+	}
+	var gots []string
+	for _, f := range files {
+		gots = append(gots, f.Name())
+	}
+	exps := []string{"file.done.2016-10-01", "file.done.2016-10-02", "log1", "log2", "log3"}
+	if !reflect.DeepEqual(gots, exps) {
+		t.Fatalf("test clean error exps %v got %v", exps, gots)
+	}
+	report := cl.LastReport()
+	if report == nil || !report.DryRun || report.Action != CleanActionDelete {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	gots = make([]string, 0)
+	for _, f := range report.Files {
+		if f.Reason != CleanReasonNumber {
+			t.Errorf("%v reason exps %v got %v", f.Path, CleanReasonNumber, f.Reason)
+		}
+		gots = append(gots, filepath.Base(f.Path))
+	}
+	exps = []string{"log2", "log1"}
+	if !reflect.DeepEqual(gots, exps) {
+		t.Fatalf("test clean report exps %v got %v", exps, gots)
+	}
+	if report.TotalSize != 11000000 {
+		t.Errorf("total size exps 11000000 got %v", report.TotalSize)
+	}
+}
+
+func TestCleanByAge(t *testing.T) {
+	donefiles := "TestCleanByAge"
+	c := conf.MapConf{}
+	c[reader.KeyMetaPath] = donefiles
+	c[reader.KeyLogPath] = donefiles + "/" + "log"
+	c[reader.KeyMode] = "dir"
+	c[KeyCleanEnable] = "true"
+	c[KeyReserveFileAge] = "24"
+	meta, err := reader.NewMetaWithConf(c)
+	if err != nil {
+		t.Error(err)
+	}
+	cs := make(chan CleanSignal)
+	runCleanChan(cs, t)
+	cl, err := NewCleaner(c, meta, cs, donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.reserveNumber != 0 || cl.reserveSize != 0 {
+		t.Fatalf("reserve number and size should be unlimited, got %v %v", cl.reserveNumber, cl.reserveSize)
+	}
+	err = GetTestFiles(donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(donefiles)
+	old := time.Now().Add(-48 * time.Hour)
+	if err = os.Chtimes(filepath.Join(donefiles, "log1"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Clean()
+	if err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Second)
+	files, err := ioutil.ReadDir(donefiles)
+	if err != nil {
+		t.Error(err)
+	}
+	var gots []string
+	dfile := filepath.Base(meta.DeleteFile())
+	for _, f := range files {
+		gots = append(gots, f.Name())
+	}
+	exps := []string{dfile, "file.done.2016-10-01", "file.done.2016-10-02", "log2", "log3"}
+	if !reflect.DeepEqual(gots, exps) {
+		t.Fatalf("test clean error exps %v got %v", exps, gots)
+	}
+	report := cl.LastReport()
+	if len(report.Files) != 1 || report.Files[0].Reason != CleanReasonAge {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestCleanByDirSize(t *testing.T) {
+	donefiles := "TestCleanByDirSize"
+	c := conf.MapConf{}
+	c[reader.KeyMetaPath] = donefiles
+	c[reader.KeyLogPath] = donefiles + "/" + "log"
+	c[reader.KeyMode] = "dir"
+	c[KeyCleanEnable] = "true"
+	c[KeyReserveDirSize] = "15"
+	c[KeyCleanDryRun] = "true"
+	meta, err := reader.NewMetaWithConf(c)
+	if err != nil {
+		t.Error(err)
+	}
+	cl, err := NewCleaner(c, meta, make(chan CleanSignal), donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = GetTestFiles(donefiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(donefiles)
+	err = cl.Clean()
+	if err != nil {
+		t.Error(err)
+	}
+	report := cl.LastReport()
+	var gots []string
+	for _, f := range report.Files {
+		if f.Reason != CleanReasonDirSize {
+			t.Errorf("%v reason exps %v got %v", f.Path, CleanReasonDirSize, f.Reason)
+		}
+		gots = append(gots, filepath.Base(f.Path))
+	}
+	exps := []string{"log2", "log1"}
+	if !reflect.DeepEqual(gots, exps) {
+		t.Fatalf("test clean report exps %v got %v", exps, gots)
+	}
+}
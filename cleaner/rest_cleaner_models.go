@@ -47,6 +47,127 @@ var (
 		Advance:      true,
 		ToolTip:      `当已读文件的总大小超过这个值时，会把最老的那部分删掉，默认保留2GB，单位为MB`,
 	}
+
+	OptionReserveFileAge = Option{
+		KeyName:      KeyReserveFileAge,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "已读文件最长保留时间,单位为小时(reserve_file_age)",
+		Advance:      true,
+		ToolTip:      `已读文件的修改时间超过这个值后会被清理，不填表示不按时间清理`,
+	}
+
+	OptionReserveDirSize = Option{
+		KeyName:      KeyReserveDirSize,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "日志目录最大总大小,单位为MB(reserve_dir_size)",
+		Advance:      true,
+		ToolTip:      `日志目录中所有文件(包括还没读完的文件)的总大小超过这个值时，从最老的已读文件开始清理，不填表示不限制`,
+	}
+
+	OptionCleanAction = Option{
+		KeyName:       KeyCleanAction,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{CleanActionDelete, CleanActionArchive},
+		Default:       CleanActionDelete,
+		DefaultNoUse:  false,
+		Description:   "清理方式(clean_action)",
+		Advance:       true,
+		ToolTip:       `delete 直接删除，archive 先移动到归档目录或者上传到对象存储，归档成功后才会删除`,
+	}
+
+	OptionCleanDryRun = Option{
+		KeyName:       KeyCleanDryRun,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{"false", "true"},
+		Default:       "false",
+		DefaultNoUse:  false,
+		Description:   "只记录不清理(clean_dry_run)",
+		Advance:       true,
+		ToolTip:       `开启后只在日志和 /logkit/cleaner/reports/<runner名称> 中记录将要清理的文件，不做任何操作`,
+	}
+
+	OptionArchiveDir = Option{
+		KeyName:      KeyArchiveDir,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档目录(archive_dir)",
+		Advance:      true,
+		ToolTip:      `clean_action 为 archive 时，文件会被移动到这个目录`,
+	}
+
+	OptionArchiveGzip = Option{
+		KeyName:       KeyArchiveGzip,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{"false", "true"},
+		Default:       "false",
+		DefaultNoUse:  false,
+		Description:   "归档时gzip压缩(archive_gzip)",
+		Advance:       true,
+	}
+
+	OptionArchiveS3Endpoint = Option{
+		KeyName:      KeyArchiveS3Endpoint,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档对象存储地址(archive_s3_endpoint)",
+		Advance:      true,
+		ToolTip:      `支持 S3 协议的对象存储地址，如 s3.us-east-1.amazonaws.com，七牛 Kodo 可以使用 s3-cn-east-1.qiniucs.com`,
+	}
+
+	OptionArchiveS3Region = Option{
+		KeyName:      KeyArchiveS3Region,
+		ChooseOnly:   false,
+		Default:      "us-east-1",
+		DefaultNoUse: false,
+		Description:  "归档对象存储区域(archive_s3_region)",
+		Advance:      true,
+	}
+
+	OptionArchiveS3Bucket = Option{
+		KeyName:      KeyArchiveS3Bucket,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档对象存储bucket(archive_s3_bucket)",
+		Advance:      true,
+		ToolTip:      `填写后归档时会上传到该 bucket`,
+	}
+
+	OptionArchiveS3AccessKey = Option{
+		KeyName:      KeyArchiveS3AccessKey,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档对象存储AK(archive_s3_ak)",
+		Advance:      true,
+	}
+
+	OptionArchiveS3SecretKey = Option{
+		KeyName:      KeyArchiveS3SecretKey,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档对象存储SK(archive_s3_sk)",
+		Advance:      true,
+	}
+
+	OptionArchiveS3Prefix = Option{
+		KeyName:      KeyArchiveS3Prefix,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "归档对象存储文件前缀(archive_s3_prefix)",
+		Advance:      true,
+	}
 )
 
 var ModeKeyOptions = []Option{
@@ -54,4 +175,16 @@ var ModeKeyOptions = []Option{
 	OptionCleanInterval,
 	OptionReserveFileNumber,
 	OptionReserveFileSize,
+	OptionReserveFileAge,
+	OptionReserveDirSize,
+	OptionCleanAction,
+	OptionCleanDryRun,
+	OptionArchiveDir,
+	OptionArchiveGzip,
+	OptionArchiveS3Endpoint,
+	OptionArchiveS3Region,
+	OptionArchiveS3Bucket,
+	OptionArchiveS3AccessKey,
+	OptionArchiveS3SecretKey,
+	OptionArchiveS3Prefix,
 }
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/qiniu/logkit/queue"
+)
+
+const queueUsage = `Usage: logkit queue <inspect|repair> <dir> [name]
+
+  inspect    检查 dir 下 diskqueue 中未读取的数据，不修改任何文件
+  repair     去掉损坏的消息并修正读写位置，需要先停止使用该队列的 logkit
+
+  dir        diskqueue 所在的文件夹，如 ft_save_log_path
+  name       diskqueue 的名称，不填时处理 dir 下所有的 diskqueue
+`
+
+// QueueCommand 执行 logkit queue 子命令，返回进程的退出码：
+// 0 表示所有队列都是健康的（repair 时表示修复成功），1 表示发现了损坏的数据，2 表示执行出错
+func QueueCommand(args []string, out io.Writer) int {
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Fprint(out, queueUsage)
+		return 2
+	}
+	var run func(dataPath, name string) (*queue.DiskQueueReport, error)
+	switch args[0] {
+	case "inspect":
+		run = queue.InspectDiskQueue
+	case "repair":
+		run = queue.RepairDiskQueue
+	default:
+		fmt.Fprint(out, queueUsage)
+		return 2
+	}
+	dataPath := args[1]
+	names := args[2:]
+	if len(names) == 0 {
+		var err error
+		names, err = queue.DiskQueueNames(dataPath)
+		if err != nil {
+			fmt.Fprintf(out, "list diskqueue in %v error %v\n", dataPath, err)
+			return 2
+		}
+		if len(names) == 0 {
+			fmt.Fprintf(out, "no diskqueue found in %v\n", dataPath)
+			return 2
+		}
+	}
+
+	rc := 0
+	for _, name := range names {
+		report, err := run(dataPath, name)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		printQueueReport(out, report)
+		if !report.Healthy() && args[0] == "inspect" {
+			rc = 1
+		}
+		if args[0] == "repair" {
+			fmt.Fprintf(out, "  repaired, %d messages kept\n", report.Messages)
+		}
+	}
+	return rc
+}
+
+func printQueueReport(out io.Writer, r *queue.DiskQueueReport) {
+	state := "healthy"
+	if !r.Healthy() {
+		state = "corrupted"
+	}
+	fmt.Fprintf(out, "%s: %s\n", r.Name, state)
+	fmt.Fprintf(out, "  depth %d, read %d:%d, write %d:%d, messages %d, corrupted %d\n",
+		r.Depth, r.ReadFileNum, r.ReadPos, r.WriteFileNum, r.WritePos, r.Messages, r.Corrupted)
+	for _, s := range r.Segments {
+		if s.Missing {
+			fmt.Fprintf(out, "  %s: missing\n", s.File)
+			continue
+		}
+		fmt.Fprintf(out, "  %s: messages %d (legacy %d), corrupted %d, truncated bytes %d\n",
+			s.File, s.Messages, s.Legacy, s.Corrupted, s.TruncatedBytes)
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/queue"
+)
+
+func TestQueueCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestQueueCommand")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := &bytes.Buffer{}
+	assert.Equal(t, 2, QueueCommand([]string{"inspect"}, out))
+	assert.Contains(t, out.String(), "Usage")
+	out.Reset()
+	assert.Equal(t, 2, QueueCommand([]string{"inspect", dir}, out))
+	assert.Contains(t, out.String(), "no diskqueue found")
+
+	dq := queue.NewDiskQueue("stream", dir, 1024, 0, 1024, 1, 1, time.Second, 1024*1024, false, 0)
+	assert.NoError(t, dq.Put([]byte("data")))
+	dq.Close()
+
+	out.Reset()
+	assert.Equal(t, 0, QueueCommand([]string{"inspect", dir}, out))
+	assert.Contains(t, out.String(), "stream: healthy")
+	out.Reset()
+	assert.Equal(t, 0, QueueCommand([]string{"repair", dir, "stream"}, out))
+	assert.Contains(t, out.String(), "1 messages kept")
+	out.Reset()
+	assert.Equal(t, 2, QueueCommand([]string{"check", dir}, out))
+}
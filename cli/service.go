@@ -0,0 +1,13 @@
+package cli
+
+import "errors"
+
+// DefaultServiceName 是安装 Windows 服务时默认使用的服务名称，同时也是事件日志的来源名称
+const DefaultServiceName = "logkit"
+
+const (
+	serviceDisplayName = "logkit"
+	serviceDescription = "Very easy-to-use server agent for collecting & sending logs & metrics."
+)
+
+var errServiceNotSupported = errors.New("running as a service is only supported on windows, please use systemd or supervisor instead")
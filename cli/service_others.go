@@ -0,0 +1,18 @@
+// +build !windows
+
+package cli
+
+// InstallService 只在 Windows 上支持
+func InstallService(name, confPath string) error {
+	return errServiceNotSupported
+}
+
+// UninstallService 只在 Windows 上支持
+func UninstallService(name string) error {
+	return errServiceNotSupported
+}
+
+// RunService 只在 Windows 上支持
+func RunService(name string, stop func()) error {
+	return errServiceNotSupported
+}
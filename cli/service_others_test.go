@@ -0,0 +1,15 @@
+// +build !windows
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceNotSupported(t *testing.T) {
+	assert.Equal(t, errServiceNotSupported, InstallService(DefaultServiceName, "logkit.conf"))
+	assert.Equal(t, errServiceNotSupported, UninstallService(DefaultServiceName))
+	assert.Equal(t, errServiceNotSupported, RunService(DefaultServiceName, func() {}))
+}
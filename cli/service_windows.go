@@ -0,0 +1,295 @@
+// +build windows
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/qiniu/log"
+	"golang.org/x/sys/windows"
+
+	"github.com/qiniu/logkit/utils/logger"
+)
+
+const (
+	// 使用系统自带的 EventCreate.exe 作为消息文件，事件 ID 1-1000 会直接显示日志内容
+	eventLogKey      = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+	eventMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+
+	errorCallNotImplemented = 120
+	serviceStopWaitHint     = 30 * time.Second
+)
+
+var (
+	modadvapi32 = windows.NewLazySystemDLL("advapi32.dll")
+
+	procRegisterServiceCtrlHandlerExW = modadvapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procRegCreateKeyExW               = modadvapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW                = modadvapi32.NewProc("RegSetValueExW")
+	procRegDeleteKeyW                 = modadvapi32.NewProc("RegDeleteKeyW")
+)
+
+// InstallService 把 logkit 安装为开机自动启动的 Windows 服务，服务启动时使用 confPath 作为配置文件，
+// 同时注册同名的事件日志来源
+func InstallService(name, confPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if confPath, err = filepath.Abs(confPath); err != nil {
+		return err
+	}
+	m, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_ALL_ACCESS)
+	if err != nil {
+		return fmt.Errorf("connect to service control manager error %v", err)
+	}
+	defer windows.CloseServiceHandle(m)
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	if s, err := windows.OpenService(m, namePtr, windows.SERVICE_QUERY_STATUS); err == nil {
+		windows.CloseServiceHandle(s)
+		return fmt.Errorf("service %v already exists", name)
+	}
+	cmd := fmt.Sprintf(`"%s" -service -service-name "%s" -f "%s"`, exe, name, confPath)
+	s, err := windows.CreateService(m, namePtr, windows.StringToUTF16Ptr(serviceDisplayName), windows.SERVICE_ALL_ACCESS,
+		windows.SERVICE_WIN32_OWN_PROCESS, windows.SERVICE_AUTO_START, windows.SERVICE_ERROR_NORMAL,
+		windows.StringToUTF16Ptr(cmd), nil, nil, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("create service %v error %v", name, err)
+	}
+	defer windows.CloseServiceHandle(s)
+	desc := windows.SERVICE_DESCRIPTION{Description: windows.StringToUTF16Ptr(serviceDescription)}
+	if err = windows.ChangeServiceConfig2(s, windows.SERVICE_CONFIG_DESCRIPTION, (*byte)(unsafe.Pointer(&desc))); err == nil {
+		err = installEventSource(name)
+	}
+	if err != nil {
+		windows.DeleteService(s)
+		return fmt.Errorf("install service %v error %v", name, err)
+	}
+	return nil
+}
+
+// UninstallService 停止并删除 Windows 服务以及事件日志来源
+func UninstallService(name string) error {
+	m, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_ALL_ACCESS)
+	if err != nil {
+		return fmt.Errorf("connect to service control manager error %v", err)
+	}
+	defer windows.CloseServiceHandle(m)
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	s, err := windows.OpenService(m, namePtr, windows.SERVICE_ALL_ACCESS)
+	if err != nil {
+		return fmt.Errorf("service %v is not installed: %v", name, err)
+	}
+	defer windows.CloseServiceHandle(s)
+	var status windows.SERVICE_STATUS
+	if err = windows.ControlService(s, windows.SERVICE_CONTROL_STOP, &status); err == nil {
+		for deadline := time.Now().Add(serviceStopWaitHint); status.CurrentState != windows.SERVICE_STOPPED && time.Now().Before(deadline); {
+			time.Sleep(300 * time.Millisecond)
+			if err = windows.QueryServiceStatus(s, &status); err != nil {
+				break
+			}
+		}
+	}
+	if err = windows.DeleteService(s); err != nil {
+		return fmt.Errorf("delete service %v error %v", name, err)
+	}
+	return removeEventSource(name)
+}
+
+// RunService 在服务控制管理器(SCM)启动 logkit 时调用，阻塞直到服务被停止，stop 在收到停止或关机请求时调用，
+// 运行期间 WARN 及以上级别的日志会同时写入 Windows 事件日志
+func RunService(name string, stop func()) error {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	s := &service{name: namePtr, stop: stop, stopping: make(chan struct{})}
+	if s.elog, err = openEventLog(name); err != nil {
+		log.Warnf("open event log %v error %v, logs will not be written to event log", name, err)
+	} else {
+		defer s.elog.Close()
+		logger.SetEventOutput(s.elog, log.Lwarn)
+		defer logger.SetEventOutput(nil, 0)
+	}
+	table := []windows.SERVICE_TABLE_ENTRY{
+		{ServiceName: namePtr, ServiceProc: syscall.NewCallback(s.main)},
+		{ServiceName: nil, ServiceProc: 0},
+	}
+	if err = windows.StartServiceCtrlDispatcher(&table[0]); err != nil {
+		return fmt.Errorf("start service control dispatcher error %v, -service should only be used by the service control manager", err)
+	}
+	return nil
+}
+
+type service struct {
+	name       *uint16
+	stop       func()
+	handle     windows.Handle
+	checkPoint uint32
+	stopOnce   sync.Once
+	stopping   chan struct{}
+	elog       *eventLog
+}
+
+// main 是 ServiceMain 回调，由 SCM 在新的线程中调用
+func (s *service) main(argc, argv uintptr) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(s.name)), syscall.NewCallback(s.control), 0)
+	if h == 0 {
+		log.Errorf("register service control handler error %v", err)
+		return 0
+	}
+	s.handle = windows.Handle(h)
+	s.setStatus(windows.SERVICE_RUNNING, windows.SERVICE_ACCEPT_STOP|windows.SERVICE_ACCEPT_SHUTDOWN, 0)
+	s.info("logkit service started")
+
+	<-s.stopping
+	s.setStatus(windows.SERVICE_STOP_PENDING, 0, serviceStopWaitHint)
+	s.stop()
+	s.info("logkit service stopped")
+	s.setStatus(windows.SERVICE_STOPPED, 0, 0)
+	return 0
+}
+
+// control 是 HandlerEx 回调，处理 SCM 发送的控制请求
+func (s *service) control(ctl, eventType, eventData, context uintptr) uintptr {
+	switch uint32(ctl) {
+	case windows.SERVICE_CONTROL_STOP, windows.SERVICE_CONTROL_SHUTDOWN:
+		s.stopOnce.Do(func() { close(s.stopping) })
+		return windows.NO_ERROR
+	case windows.SERVICE_CONTROL_INTERROGATE:
+		return windows.NO_ERROR
+	}
+	return errorCallNotImplemented
+}
+
+func (s *service) setStatus(state, accepts uint32, waitHint time.Duration) {
+	status := windows.SERVICE_STATUS{
+		ServiceType:      windows.SERVICE_WIN32_OWN_PROCESS,
+		CurrentState:     state,
+		ControlsAccepted: accepts,
+		WaitHint:         uint32(waitHint / time.Millisecond),
+	}
+	if state == windows.SERVICE_START_PENDING || state == windows.SERVICE_STOP_PENDING {
+		s.checkPoint++
+		status.CheckPoint = s.checkPoint
+	}
+	if err := windows.SetServiceStatus(s.handle, &status); err != nil {
+		log.Errorf("set service status %v error %v", state, err)
+	}
+}
+
+func (s *service) info(msg string) {
+	log.Info(msg)
+	if s.elog != nil {
+		s.elog.report(windows.EVENTLOG_INFORMATION_TYPE, msg)
+	}
+}
+
+// eventLog 把日志写入 Windows 事件日志的应用程序日志中
+type eventLog struct {
+	handle windows.Handle
+}
+
+func openEventLog(source string) (*eventLog, error) {
+	sourcePtr, err := windows.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.RegisterEventSource(nil, sourcePtr)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{handle: h}, nil
+}
+
+func (l *eventLog) Write(p []byte) (int, error) {
+	etype := uint16(windows.EVENTLOG_INFORMATION_TYPE)
+	switch {
+	case bytes.Contains(p, []byte("[ERROR]")), bytes.Contains(p, []byte("[PANIC]")), bytes.Contains(p, []byte("[FATAL]")):
+		etype = windows.EVENTLOG_ERROR_TYPE
+	case bytes.Contains(p, []byte("[WARN]")):
+		etype = windows.EVENTLOG_WARNING_TYPE
+	}
+	if err := l.report(etype, string(bytes.TrimSpace(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (l *eventLog) report(etype uint16, msg string) error {
+	eventID := uint32(eventIDInfo)
+	switch etype {
+	case windows.EVENTLOG_WARNING_TYPE:
+		eventID = eventIDWarning
+	case windows.EVENTLOG_ERROR_TYPE:
+		eventID = eventIDError
+	}
+	msgPtr, err := windows.UTF16PtrFromString(string(bytes.Replace([]byte(msg), []byte{0}, nil, -1)))
+	if err != nil {
+		return err
+	}
+	strs := []*uint16{msgPtr}
+	return windows.ReportEvent(l.handle, etype, 0, eventID, 0, 1, 0, &strs[0], nil)
+}
+
+func (l *eventLog) Close() error {
+	return windows.DeregisterEventSource(l.handle)
+}
+
+// installEventSource 在注册表中登记事件日志来源，否则事件查看器无法正常显示日志内容
+func installEventSource(source string) error {
+	keyPtr, err := windows.UTF16PtrFromString(eventLogKey + source)
+	if err != nil {
+		return err
+	}
+	var key syscall.Handle
+	var disposition uint32
+	r, _, _ := procRegCreateKeyExW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(keyPtr)), 0, 0, 0,
+		uintptr(syscall.KEY_WRITE), 0, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(&disposition)))
+	if r != 0 {
+		return fmt.Errorf("create registry key %v error %v", eventLogKey+source, syscall.Errno(r))
+	}
+	defer syscall.RegCloseKey(key)
+	msgFile := windows.StringToUTF16(eventMessageFile)
+	r, _, _ = procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(windows.StringToUTF16Ptr("EventMessageFile"))), 0,
+		uintptr(syscall.REG_EXPAND_SZ), uintptr(unsafe.Pointer(&msgFile[0])), uintptr(len(msgFile)*2))
+	if r != 0 {
+		return fmt.Errorf("set EventMessageFile error %v", syscall.Errno(r))
+	}
+	types := uint32(windows.EVENTLOG_ERROR_TYPE | windows.EVENTLOG_WARNING_TYPE | windows.EVENTLOG_INFORMATION_TYPE)
+	r, _, _ = procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(windows.StringToUTF16Ptr("TypesSupported"))), 0,
+		uintptr(syscall.REG_DWORD), uintptr(unsafe.Pointer(&types)), 4)
+	if r != 0 {
+		return fmt.Errorf("set TypesSupported error %v", syscall.Errno(r))
+	}
+	return nil
+}
+
+func removeEventSource(source string) error {
+	keyPtr, err := windows.UTF16PtrFromString(eventLogKey + source)
+	if err != nil {
+		return err
+	}
+	r, _, _ := procRegDeleteKeyW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(keyPtr)))
+	if r != 0 && syscall.Errno(r) != windows.ERROR_FILE_NOT_FOUND {
+		return fmt.Errorf("delete registry key %v error %v", eventLogKey+source, syscall.Errno(r))
+	}
+	return nil
+}
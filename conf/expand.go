@@ -0,0 +1,130 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/qiniu/log"
+)
+
+const maxIncludeDepth = 8
+
+var (
+	envPattern     = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+	includePattern = regexp.MustCompile(`^@include\(([^)]+)\)`)
+)
+
+// ExpandConf 展开配置中的 ${ENV} 环境变量和 @include(path) 文件引用，dir 是 @include 中相对路径的基准目录
+// ${ENV:-default} 在环境变量不存在或为空时使用默认值，没有默认值时与 models.GetEnv 一样保留原样的 ${ENV}，$${ 表示字面量 ${
+// 在 JSON 字符串中展开的值会被转义，在字符串外展开的值原样插入，因此 @include 也可以引用一段 JSON
+func ExpandConf(data []byte, dir string) ([]byte, error) {
+	return expand(data, dir, true, 0)
+}
+
+// ExpandValue 展开单个配置值中的环境变量和文件引用，相对路径基于当前工作目录
+func ExpandValue(value string) (string, error) {
+	data, err := expand([]byte(value), "", false, 0)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Expand 返回一个展开了所有配置值的新 MapConf
+func (conf MapConf) Expand() (MapConf, error) {
+	ret := make(MapConf, len(conf))
+	for k, v := range conf {
+		value, err := ExpandValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("expand config %v error %v", k, err)
+		}
+		ret[k] = value
+	}
+	return ret, nil
+}
+
+func expand(data []byte, dir string, isJSON bool, depth int) ([]byte, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("@include nested more than %v levels", maxIncludeDepth)
+	}
+	if !bytes.Contains(data, []byte("${")) && !bytes.Contains(data, []byte("@include(")) {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	inQuote := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case isJSON && inQuote && c == '\\' && i+1 < len(data):
+			buf.WriteByte(c)
+			buf.WriteByte(data[i+1])
+			i++
+			continue
+		case isJSON && c == '"':
+			inQuote = !inQuote
+		case c == '$' && bytes.HasPrefix(data[i:], []byte("$${")):
+			buf.WriteString("${")
+			i += 2
+			continue
+		case c == '$':
+			m := envPattern.FindSubmatch(data[i:])
+			if m == nil {
+				break
+			}
+			value := os.Getenv(string(m[1]))
+			if value == "" {
+				if len(m[2]) == 0 {
+					log.Warnf("cannot find %s in current system env, keep %s as it is", m[1], m[0])
+					value = string(m[0])
+				} else {
+					value = string(m[3])
+				}
+			}
+			writeExpanded(&buf, []byte(value), isJSON && inQuote)
+			i += len(m[0]) - 1
+			continue
+		case c == '@':
+			m := includePattern.FindSubmatch(data[i:])
+			if m == nil {
+				break
+			}
+			path := strings.TrimSpace(string(m[1]))
+			if !filepath.IsAbs(path) && dir != "" {
+				path = filepath.Join(dir, path)
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("@include %v error %v", path, err)
+			}
+			// 字符串外引用的是一段 JSON，同样需要去掉注释
+			fragment := isJSON && !inQuote
+			if fragment {
+				content = trimComments(content)
+			}
+			content, err = expand(bytes.TrimSpace(content), filepath.Dir(path), fragment, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			writeExpanded(&buf, content, isJSON && inQuote)
+			i += len(m[0]) - 1
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeExpanded(buf *bytes.Buffer, value []byte, escape bool) {
+	if !escape {
+		buf.Write(value)
+		return
+	}
+	quoted, _ := json.Marshal(string(value))
+	buf.Write(quoted[1 : len(quoted)-1])
+}
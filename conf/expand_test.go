@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expand_conf")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("LOGKIT_TEST_EXPAND_AK", `a"k`)
+	defer os.Unsetenv("LOGKIT_TEST_EXPAND_AK")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sk"), []byte("secret\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sender.json"), []byte(`{"sender_type":"mock", # comment
+"sk":"@include(sk)"}`), 0644))
+	confPath := filepath.Join(dir, "runner.conf")
+	assert.NoError(t, ioutil.WriteFile(confPath, []byte(`{
+	"name":"${LOGKIT_TEST_EXPAND_NAME:-runner1}",
+	"ak":"${LOGKIT_TEST_EXPAND_AK}",
+	"literal":"$${HOME}",
+	"sender":@include(sender.json)
+}`), 0644))
+
+	var conf map[string]interface{}
+	assert.NoError(t, LoadExpandEx(&conf, confPath))
+	assert.Equal(t, map[string]interface{}{
+		"name":    "runner1",
+		"ak":      `a"k`,
+		"literal": "${HOME}",
+		"sender": map[string]interface{}{
+			"sender_type": "mock",
+			"sk":          "secret",
+		},
+	}, conf)
+
+	// 没有默认值的环境变量不存在时保留原样
+	data, err := ExpandConf([]byte(`{"a":"${LOGKIT_TEST_EXPAND_NOT_EXIST}"}`), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"${LOGKIT_TEST_EXPAND_NOT_EXIST}"}`, string(data))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "loop"), []byte("@include(loop)"), 0644))
+	_, err = ExpandConf([]byte(`{"a":@include(loop)}`), dir)
+	assert.Error(t, err)
+
+	mc, err := MapConf{"ak": "${LOGKIT_TEST_EXPAND_AK}", "sk": "@include(" + filepath.Join(dir, "sk") + ")", "a": "$b"}.Expand()
+	assert.NoError(t, err)
+	assert.Equal(t, MapConf{"ak": `a"k`, "sk": "secret", "a": "$b"}, mc)
+}
@@ -7,6 +7,7 @@ import (
 	"flag"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/qiniu/log"
 )
@@ -122,6 +123,25 @@ func LoadEx(conf interface{}, confName string) (err error) {
 	return
 }
 
+// LoadExpandEx 与 LoadEx 相同，但会先展开配置中的 ${ENV} 和 @include(path)
+func LoadExpandEx(conf interface{}, confName string) (err error) {
+
+	data, err := ioutil.ReadFile(confName)
+	if err != nil {
+		return
+	}
+	data, err = ExpandConf(trimComments(data), filepath.Dir(confName))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, conf)
+	if err != nil {
+		log.Errorf("Parse conf %v failed: %v", confName, err)
+	}
+	return
+}
+
 func LoadFile(conf interface{}, confName string) (err error) {
 
 	data, err := ioutil.ReadFile(confName)
@@ -20,6 +20,7 @@ import (
 	"github.com/qiniu/logkit/mgr"
 	"github.com/qiniu/logkit/times"
 	_ "github.com/qiniu/logkit/transforms/builtin"
+	"github.com/qiniu/logkit/utils/logger"
 	. "github.com/qiniu/logkit/utils/models"
 	utilsos "github.com/qiniu/logkit/utils/os"
 )
@@ -37,6 +38,9 @@ type Config struct {
 	TimeLayouts      []string `json:"timeformat_layouts"`
 	CleanSelfLogCnt  int      `json:"clean_self_cnt"`
 	StaticRootPath   string   `json:"static_root_path"`
+
+	LogFormat  string            `json:"log_format"`  // 日志格式，text 或 json
+	LogModules map[string]string `json:"log_modules"` // 各个模块单独的日志级别，如 {"reader/tailx":"debug"}
 	mgr.ManagerConfig
 }
 
@@ -64,6 +68,13 @@ The commands & flags are:
 
   -f <file>          configuration file to load
 
+  -install           install logkit as a windows service using the configuration file of -f
+  -uninstall         stop and uninstall the logkit windows service
+  -service-name      name of the windows service, default is logkit
+
+  queue inspect <dir> [name]   check the disk queues in dir for corrupt data
+  queue repair <dir> [name]    drop corrupt data from the disk queues in dir, stop logkit first
+
 Examples:
 
   # start logkit
@@ -74,12 +85,23 @@ Examples:
 
   # checking and upgrade version
   logkit -upgrade
+
+  # install logkit as a windows service, then start it with "sc start logkit"
+  logkit -install -f C:\logkit\logkit.conf
+
+  # check the fault tolerant queues of a sender
+  logkit queue inspect ./meta/runner1/ft_log
 `
 
 var (
 	fversion = flag.Bool("v", false, "print the version to stdout")
 	upgrade  = flag.Bool("upgrade", false, "check and upgrade version")
 	confName = flag.String("f", "logkit.conf", "configuration file to load")
+
+	installService   = flag.Bool("install", false, "install logkit as a windows service")
+	uninstallService = flag.Bool("uninstall", false, "uninstall the logkit windows service")
+	runService       = flag.Bool("service", false, "run as a windows service, only used by the service control manager")
+	serviceName      = flag.String("service-name", cli.DefaultServiceName, "name of the windows service")
 )
 
 func getValidPath(confPaths []string) (paths []string) {
@@ -174,7 +196,7 @@ func rotateLog(path string) (file *os.File, err error) {
 		err = fmt.Errorf("rotateLog open newfile %v err %v", newfile, err)
 		return
 	}
-	log.SetOutput(file)
+	logger.SetOutput(file)
 	return
 }
 
@@ -216,6 +238,9 @@ func usageExit(rc int) {
 //！！！注意： 自动生成 grok pattern代码，下述注释请勿删除！！！
 //go:generate go run generators/grok_pattern_generater.go
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "queue" {
+		os.Exit(cli.QueueCommand(os.Args[2:], os.Stdout))
+	}
 	flag.Usage = func() { usageExit(0) }
 	flag.Parse()
 	switch {
@@ -230,6 +255,25 @@ func main() {
 	case *upgrade:
 		cli.CheckAndUpgrade(NextVersion)
 		return
+	case *installService:
+		if err := cli.InstallService(*serviceName, *confName); err != nil {
+			fmt.Println("install service failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("logkit service %v installed\n", *serviceName)
+		return
+	case *uninstallService:
+		if err := cli.UninstallService(*serviceName); err != nil {
+			fmt.Println("uninstall service failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("logkit service %v uninstalled\n", *serviceName)
+		return
+	case *runService:
+		// 由服务控制管理器启动时工作目录为 system32，切换到 logkit 所在的目录使配置中的相对路径生效
+		if exe, err := os.Executable(); err == nil {
+			os.Chdir(filepath.Dir(exe))
+		}
 	}
 
 	if err := config.LoadEx(&conf, *confName); err != nil {
@@ -242,7 +286,9 @@ func main() {
 		conf.MaxProcs = runtime.NumCPU()
 	}
 	runtime.GOMAXPROCS(conf.MaxProcs)
-	log.SetOutputLevel(conf.DebugLevel)
+	if err := logger.Init(conf.DebugLevel, conf.LogFormat, conf.LogModules); err != nil {
+		log.Fatal("init logger failed:", err)
+	}
 
 	stopRotate := make(chan struct{}, 0)
 	defer close(stopRotate)
@@ -254,6 +300,12 @@ func main() {
 		go loopRotateLogs(filepath.Join(logdir, logpattern), defaultRotateSize, 10*time.Second, stopRotate)
 		conf.CleanSelfPattern = logpattern + "-*"
 		conf.CleanSelfDir = logdir
+		if conf.SelfMonitor.LogPath == "" {
+			conf.SelfMonitor.LogPath = filepath.Join(logdir, logpattern) + "-*"
+		}
+	}
+	if conf.SelfMonitor.LogFormat == "" {
+		conf.SelfMonitor.LogFormat = conf.LogFormat
 	}
 
 	log.Infof("Welcome to use Logkit, Version: %v \n\nConfig: %#v", NextVersion, conf)
@@ -294,11 +346,18 @@ func main() {
 	if err = rs.Register(); err != nil {
 		log.Fatalf("register master error %v", err)
 	}
-	utilsos.WaitForInterrupt(func() {
+	exit := func() {
 		rs.Stop()
 		if conf.CleanSelfLog {
 			stopClean <- struct{}{}
 		}
 		m.Stop()
-	})
+	}
+	if *runService {
+		if err = cli.RunService(*serviceName, exit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	utilsos.WaitForInterrupt(exit)
 }
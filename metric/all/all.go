@@ -2,6 +2,15 @@ package all
 
 import (
 	_ "github.com/qiniu/logkit/metric/curl"
+	_ "github.com/qiniu/logkit/metric/jolokia"
+	_ "github.com/qiniu/logkit/metric/kubernetes"
+	_ "github.com/qiniu/logkit/metric/mysql"
+	_ "github.com/qiniu/logkit/metric/nginx"
+	_ "github.com/qiniu/logkit/metric/ntp"
+	_ "github.com/qiniu/logkit/metric/postgresql"
+	_ "github.com/qiniu/logkit/metric/probe"
+	_ "github.com/qiniu/logkit/metric/redis"
+	_ "github.com/qiniu/logkit/metric/smart"
 	_ "github.com/qiniu/logkit/metric/system"
 	_ "github.com/qiniu/logkit/metric/telegraf"
 	_ "github.com/qiniu/logkit/metric/telegraf/memcached"
@@ -0,0 +1,381 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricJolokia   = "jolokia"
+	MetricJolokiaUsages = "JVM(jolokia)"
+
+	// Config 中的字段
+	ConfigURLs     = "urls"
+	ConfigMBeans   = "mbeans"
+	ConfigTargets  = "targets"
+	ConfigUsername = "username"
+	ConfigPassword = "password"
+	ConfigTimeout  = "timeout"
+
+	DefaultURL     = "http://127.0.0.1:8778/jolokia"
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMBeans 默认收集堆内存、GC、线程、类加载和进程的指标
+	DefaultMBeans = "java.lang:type=Memory|HeapMemoryUsage,NonHeapMemoryUsage;" +
+		"java.lang:type=GarbageCollector,name=*|CollectionCount,CollectionTime;" +
+		"java.lang:type=Threading|ThreadCount,DaemonThreadCount,PeakThreadCount;" +
+		"java.lang:type=ClassLoading|LoadedClassCount;" +
+		"java.lang:type=OperatingSystem|ProcessCpuLoad,OpenFileDescriptorCount"
+
+	// TypeMetricJolokia 信息中的字段, 每个 MBean 一条数据
+	// 数值类型的属性以 jolokia_<属性名> 的形式收集, 属性名转为小写下划线格式, 复合类型的属性展开为 jolokia_<属性名>_<字段名>
+	KeyJolokiaTarget            = "jolokia_target"
+	KeyJolokiaMBean             = "jolokia_mbean"
+	KeyJolokiaHeapUsed          = "jolokia_heap_memory_usage_used"
+	KeyJolokiaHeapMax           = "jolokia_heap_memory_usage_max"
+	KeyJolokiaNonHeapUsed       = "jolokia_non_heap_memory_usage_used"
+	KeyJolokiaCollectionCount   = "jolokia_collection_count"
+	KeyJolokiaCollectionTime    = "jolokia_collection_time"
+	KeyJolokiaThreadCount       = "jolokia_thread_count"
+	KeyJolokiaDaemonThreadCount = "jolokia_daemon_thread_count"
+	KeyJolokiaLoadedClassCount  = "jolokia_loaded_class_count"
+	KeyJolokiaProcessCpuLoad    = "jolokia_process_cpu_load"
+	KeyJolokiaOpenFDCount       = "jolokia_open_file_descriptor_count"
+)
+
+// KeyJolokiaUsages TypeMetricJolokia 中的字段名称
+var KeyJolokiaUsages = []KeyValue{
+	{KeyJolokiaTarget, "Jolokia地址"},
+	{KeyJolokiaMBean, "MBean名称"},
+	{KeyJolokiaHeapUsed, "已使用的堆内存"},
+	{KeyJolokiaHeapMax, "最大堆内存"},
+	{KeyJolokiaNonHeapUsed, "已使用的非堆内存"},
+	{KeyJolokiaCollectionCount, "累计GC次数"},
+	{KeyJolokiaCollectionTime, "累计GC时间(毫秒)"},
+	{KeyJolokiaThreadCount, "线程数"},
+	{KeyJolokiaDaemonThreadCount, "守护线程数"},
+	{KeyJolokiaLoadedClassCount, "已加载的类数量"},
+	{KeyJolokiaProcessCpuLoad, "进程CPU使用率"},
+	{KeyJolokiaOpenFDCount, "打开的文件描述符数"},
+}
+
+// ConfigJolokiaUsages TypeMetricJolokia config 中的字段描述
+var ConfigJolokiaUsages = []KeyValue{
+	{ConfigURLs, "Jolokia agent地址, 逗号分隔多个(" + ConfigURLs + ")"},
+	{ConfigMBeans, "MBean查询, 格式为 <MBean名称或模式>|<属性1>,<属性2>, 不指定属性时收集所有属性, 分号分隔多个(" + ConfigMBeans + ")"},
+	{ConfigTargets, `为不同的地址指定不同的MBean查询, 如 [{"url":"http://127.0.0.1:8778/jolokia","mbeans":"..."}](` + ConfigTargets + ")"},
+	{ConfigUsername, "用户名(" + ConfigUsername + ")"},
+	{ConfigPassword, "密码(" + ConfigPassword + ")"},
+	{ConfigTimeout, "请求超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigURLs:     DefaultURL,
+	ConfigMBeans:   DefaultMBeans,
+	ConfigTargets:  "",
+	ConfigUsername: "",
+	ConfigPassword: "",
+	ConfigTimeout:  DefaultTimeout.String(),
+}
+
+// Target 是一个 Jolokia agent 以及在其上查询的 MBean
+type Target struct {
+	URL    string `json:"url"`
+	MBeans string `json:"mbeans"`
+
+	requests []readRequest
+}
+
+type readRequest struct {
+	Type      string   `json:"type"`
+	MBean     string   `json:"mbean"`
+	Attribute []string `json:"attribute,omitempty"`
+}
+
+type readResponse struct {
+	Request readRequest     `json:"request"`
+	Value   json.RawMessage `json:"value"`
+	Status  int             `json:"status"`
+	Error   string          `json:"error"`
+}
+
+// JolokiaStats 通过 Jolokia 的 HTTP 接口收集 JVM 的堆内存、GC、线程等 JMX 指标
+type JolokiaStats struct {
+	URLs     string `json:"urls"`
+	MBeans   string `json:"mbeans"`
+	Targets  string `json:"targets"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Timeout  string `json:"timeout"`
+
+	targets []Target
+	client  *http.Client
+}
+
+func (_ *JolokiaStats) Name() string {
+	return TypeMetricJolokia
+}
+
+func (_ *JolokiaStats) Usages() string {
+	return MetricJolokiaUsages
+}
+
+func (_ *JolokiaStats) Tags() []string {
+	return []string{KeyJolokiaTarget, KeyJolokiaMBean}
+}
+
+func (_ *JolokiaStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigJolokiaUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		if val.Key == ConfigPassword {
+			option.Secret = true
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyJolokiaUsages,
+	}
+	return config
+}
+
+// parseMBeans 解析 mbeans 配置, 如 java.lang:type=Memory|HeapMemoryUsage;java.lang:type=Threading
+func parseMBeans(mbeans string) ([]readRequest, error) {
+	requests := make([]readRequest, 0)
+	for _, item := range strings.Split(mbeans, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		req := readRequest{Type: "read"}
+		parts := strings.SplitN(item, "|", 2)
+		req.MBean = strings.TrimSpace(parts[0])
+		if !strings.Contains(req.MBean, ":") {
+			return nil, fmt.Errorf("invalid mbean %q, should be like domain:key=value", req.MBean)
+		}
+		if len(parts) == 2 {
+			for _, attr := range strings.Split(parts[1], ",") {
+				if attr = strings.TrimSpace(attr); attr != "" {
+					req.Attribute = append(req.Attribute, attr)
+				}
+			}
+		}
+		requests = append(requests, req)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no mbean is configured")
+	}
+	return requests, nil
+}
+
+func (s *JolokiaStats) init() error {
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricJolokia, s.Timeout, err)
+		}
+	}
+	targets := make([]Target, 0)
+	if strings.TrimSpace(s.Targets) != "" {
+		if err := json.Unmarshal([]byte(s.Targets), &targets); err != nil {
+			return fmt.Errorf("metric %v parse %v error %v", TypeMetricJolokia, ConfigTargets, err)
+		}
+	}
+	urls := s.URLs
+	if strings.TrimSpace(urls) == "" && len(targets) == 0 {
+		urls = DefaultURL
+	}
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			targets = append(targets, Target{URL: u})
+		}
+	}
+	for i := range targets {
+		mbeans := targets[i].MBeans
+		if mbeans == "" {
+			mbeans = s.MBeans
+		}
+		if mbeans == "" {
+			mbeans = DefaultMBeans
+		}
+		requests, err := parseMBeans(mbeans)
+		if err != nil {
+			return fmt.Errorf("metric %v target %v: %v", TypeMetricJolokia, targets[i].URL, err)
+		}
+		targets[i].requests = requests
+	}
+	s.targets = targets
+	s.client = &http.Client{Timeout: timeout}
+	return nil
+}
+
+// Collect 中某个地址请求失败只记录日志, 所有地址都失败时才返回错误
+func (s *JolokiaStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.client == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	var lastErr error
+	for _, target := range s.targets {
+		targetDatas, err := s.collect(target)
+		if err != nil {
+			log.Warnf("metric %v collect %v error %v", TypeMetricJolokia, target.URL, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, targetDatas...)
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricJolokia, lastErr)
+	}
+	return datas, nil
+}
+
+func targetName(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return addr
+	}
+	return u.Host
+}
+
+// collect 通过一次批量请求读取 target 上所有的 MBean
+func (s *JolokiaStats) collect(target Target) ([]map[string]interface{}, error) {
+	body, err := json.Marshal(target.requests)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("request %v returns %v: %s", target.URL, resp.Status, msg)
+	}
+	var responses []readResponse
+	if err = json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("decode response error %v", err)
+	}
+	return parseResponses(targetName(target.URL), responses), nil
+}
+
+// parseResponses 把批量请求的结果转为每个 MBean 一条数据, 单个 MBean 读取失败只记录日志
+func parseResponses(target string, responses []readResponse) []map[string]interface{} {
+	datas := make([]map[string]interface{}, 0, len(responses))
+	for _, resp := range responses {
+		if resp.Status != http.StatusOK {
+			log.Debugf("metric %v %v read %v error %v: %v", TypeMetricJolokia, target, resp.Request.MBean, resp.Status, resp.Error)
+			continue
+		}
+		values := make(map[string]map[string]interface{})
+		if strings.Contains(resp.Request.MBean, "*") {
+			// 模式查询的结果为 MBean 名称到属性的映射
+			var beans map[string]map[string]interface{}
+			if err := json.Unmarshal(resp.Value, &beans); err != nil {
+				log.Debugf("metric %v %v decode %v error %v", TypeMetricJolokia, target, resp.Request.MBean, err)
+				continue
+			}
+			values = beans
+		} else {
+			var attrs map[string]interface{}
+			if err := json.Unmarshal(resp.Value, &attrs); err != nil {
+				log.Debugf("metric %v %v decode %v error %v", TypeMetricJolokia, target, resp.Request.MBean, err)
+				continue
+			}
+			values[resp.Request.MBean] = attrs
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data := map[string]interface{}{
+				KeyJolokiaTarget: target,
+				KeyJolokiaMBean:  name,
+			}
+			for attr, value := range values[name] {
+				flatten(data, "jolokia_"+snakeCase(attr), value)
+			}
+			datas = append(datas, data)
+		}
+	}
+	return datas
+}
+
+// flatten 只保留数值和布尔类型的值, 复合类型的属性逐层展开
+func flatten(data map[string]interface{}, key string, value interface{}) {
+	switch v := value.(type) {
+	case float64:
+		data[key] = v
+	case bool:
+		if v {
+			data[key] = int64(1)
+		} else {
+			data[key] = int64(0)
+		}
+	case map[string]interface{}:
+		for k, sub := range v {
+			flatten(data, key+"_"+snakeCase(k), sub)
+		}
+	}
+}
+
+// snakeCase 把 HeapMemoryUsage 这样的属性名转为 heap_memory_usage
+func snakeCase(s string) string {
+	var buf bytes.Buffer
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			r = '_'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func init() {
+	metric.Add(TypeMetricJolokia, func() metric.Collector {
+		return &JolokiaStats{}
+	})
+}
@@ -0,0 +1,114 @@
+package jolokia
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jolokiaResponse = `[
+  {"request": {"type": "read", "mbean": "java.lang:type=Memory", "attribute": ["HeapMemoryUsage"]},
+   "value": {"HeapMemoryUsage": {"init": 100, "used": 50, "max": 200, "committed": 150}}, "status": 200},
+  {"request": {"type": "read", "mbean": "java.lang:type=GarbageCollector,name=*", "attribute": ["CollectionCount", "CollectionTime", "Valid"]},
+   "value": {
+     "java.lang:name=G1 Young Generation,type=GarbageCollector": {"CollectionCount": 10, "CollectionTime": 100, "Valid": true},
+     "java.lang:name=G1 Old Generation,type=GarbageCollector": {"CollectionCount": 1, "CollectionTime": 20, "Valid": false}
+   }, "status": 200},
+  {"request": {"type": "read", "mbean": "java.lang:type=Runtime"},
+   "value": {"VmName": "OpenJDK", "Uptime": 3600}, "status": 200},
+  {"request": {"type": "read", "mbean": "com.example:type=NotFound"},
+   "error": "javax.management.InstanceNotFoundException", "status": 404}
+]`
+
+func TestParseMBeans(t *testing.T) {
+	requests, err := parseMBeans(DefaultMBeans)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 5)
+	assert.Equal(t, readRequest{Type: "read", MBean: "java.lang:type=GarbageCollector,name=*", Attribute: []string{"CollectionCount", "CollectionTime"}}, requests[1])
+
+	requests, err = parseMBeans(" java.lang:type=Runtime ; ")
+	assert.NoError(t, err)
+	assert.Equal(t, []readRequest{{Type: "read", MBean: "java.lang:type=Runtime"}}, requests)
+
+	_, err = parseMBeans("Runtime|Uptime")
+	assert.Error(t, err)
+	_, err = parseMBeans(" ; ")
+	assert.Error(t, err)
+}
+
+func TestSnakeCase(t *testing.T) {
+	for s, exp := range map[string]string{
+		"HeapMemoryUsage":         "heap_memory_usage",
+		"ProcessCpuLoad":          "process_cpu_load",
+		"OpenFileDescriptorCount": "open_file_descriptor_count",
+		"used":                    "used",
+		"HTTPRequestCount":        "http_request_count",
+		"G1 Old":                  "g1_old",
+	} {
+		assert.Equal(t, exp, snakeCase(s))
+	}
+}
+
+func TestJolokiaCollect(t *testing.T) {
+	var requests []readRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&requests)
+		w.Write([]byte(jolokiaResponse))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	c := &JolokiaStats{
+		Targets:  `[{"url":"` + server.URL + `","mbeans":"java.lang:type=Memory|HeapMemoryUsage;java.lang:type=Runtime"}]`,
+		Username: "admin",
+		Password: "secret",
+	}
+	datas, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Len(t, datas, 4)
+	assert.Equal(t, map[string]interface{}{
+		KeyJolokiaTarget:                      host,
+		KeyJolokiaMBean:                       "java.lang:type=Memory",
+		"jolokia_heap_memory_usage_init":      float64(100),
+		KeyJolokiaHeapUsed:                    float64(50),
+		KeyJolokiaHeapMax:                     float64(200),
+		"jolokia_heap_memory_usage_committed": float64(150),
+	}, datas[0])
+	assert.Equal(t, map[string]interface{}{
+		KeyJolokiaTarget:          host,
+		KeyJolokiaMBean:           "java.lang:name=G1 Old Generation,type=GarbageCollector",
+		KeyJolokiaCollectionCount: float64(1),
+		KeyJolokiaCollectionTime:  float64(20),
+		"jolokia_valid":           int64(0),
+	}, datas[1])
+	assert.Equal(t, "java.lang:name=G1 Young Generation,type=GarbageCollector", datas[2][KeyJolokiaMBean])
+	assert.Equal(t, map[string]interface{}{
+		KeyJolokiaTarget: host,
+		KeyJolokiaMBean:  "java.lang:type=Runtime",
+		"jolokia_uptime": float64(3600),
+	}, datas[3])
+
+	// 未配置 target 的 mbeans 时使用默认的查询
+	c = &JolokiaStats{URLs: server.URL}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	assert.Len(t, c.targets, 1)
+	assert.Len(t, c.targets[0].requests, 5)
+
+	c = &JolokiaStats{Targets: "[{"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &JolokiaStats{MBeans: "Runtime"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,407 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricKubernetes   = "kubernetes"
+	MetricKubernetesUsages = "Kubernetes节点和容器(kubernetes)"
+
+	// Config 中的字段
+	ConfigKubeletURL         = "kubelet_url"
+	ConfigBearerTokenPath    = "bearer_token_path"
+	ConfigTLSCAPath          = "tls_ca_path"
+	ConfigInsecureSkipVerify = "insecure_skip_verify"
+	ConfigTimeout            = "timeout"
+
+	DefaultKubeletURL      = "https://127.0.0.1:10250"
+	DefaultBearerTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	DefaultTimeout         = 5 * time.Second
+
+	summaryPath = "/stats/summary"
+
+	TypeNode      = "node"
+	TypePod       = "pod"
+	TypeContainer = "container"
+
+	// TypeMetricKubernetes 信息中的字段, 节点、pod 和容器的数据分别为一条, 通过 kubernetes_type 区分
+	KeyKubernetesType          = "kubernetes_type"
+	KeyKubernetesNode          = "kubernetes_node"
+	KeyKubernetesNamespace     = "kubernetes_namespace"
+	KeyKubernetesPod           = "kubernetes_pod"
+	KeyKubernetesContainer     = "kubernetes_container"
+	KeyCPUUsageNanoCores       = "kubernetes_cpu_usage_nanocores"
+	KeyCPUUsageCoreNanoSeconds = "kubernetes_cpu_usage_core_nanoseconds"
+	KeyMemoryUsageBytes        = "kubernetes_memory_usage_bytes"
+	KeyMemoryWorkingSetBytes   = "kubernetes_memory_working_set_bytes"
+	KeyMemoryRSSBytes          = "kubernetes_memory_rss_bytes"
+	KeyMemoryAvailableBytes    = "kubernetes_memory_available_bytes"
+	KeyMemoryPageFaults        = "kubernetes_memory_page_faults"
+	KeyMemoryMajorPageFaults   = "kubernetes_memory_major_page_faults"
+	KeyNetworkRxBytes          = "kubernetes_network_rx_bytes"
+	KeyNetworkRxErrors         = "kubernetes_network_rx_errors"
+	KeyNetworkTxBytes          = "kubernetes_network_tx_bytes"
+	KeyNetworkTxErrors         = "kubernetes_network_tx_errors"
+	KeyFsUsedBytes             = "kubernetes_fs_used_bytes"
+	KeyFsCapacityBytes         = "kubernetes_fs_capacity_bytes"
+	KeyFsAvailableBytes        = "kubernetes_fs_available_bytes"
+	KeyLogsUsedBytes           = "kubernetes_logs_used_bytes"
+	KeyVolumeUsedBytes         = "kubernetes_volume_used_bytes"
+	KeyVolumeCapacityBytes     = "kubernetes_volume_capacity_bytes"
+)
+
+// KeyKubernetesUsages TypeMetricKubernetes 中的字段名称
+var KeyKubernetesUsages = []KeyValue{
+	{KeyKubernetesType, "数据类型(node/pod/container)"},
+	{KeyKubernetesNode, "节点名称"},
+	{KeyKubernetesNamespace, "命名空间"},
+	{KeyKubernetesPod, "pod名称"},
+	{KeyKubernetesContainer, "容器名称"},
+	{KeyCPUUsageNanoCores, "CPU使用量(纳核)"},
+	{KeyCPUUsageCoreNanoSeconds, "累计CPU使用时间(纳秒)"},
+	{KeyMemoryUsageBytes, "内存使用量"},
+	{KeyMemoryWorkingSetBytes, "工作集内存"},
+	{KeyMemoryRSSBytes, "RSS内存"},
+	{KeyMemoryAvailableBytes, "可用内存"},
+	{KeyMemoryPageFaults, "缺页次数"},
+	{KeyMemoryMajorPageFaults, "主缺页次数"},
+	{KeyNetworkRxBytes, "网络接收字节数"},
+	{KeyNetworkRxErrors, "网络接收错误数"},
+	{KeyNetworkTxBytes, "网络发送字节数"},
+	{KeyNetworkTxErrors, "网络发送错误数"},
+	{KeyFsUsedBytes, "文件系统使用量(节点为根文件系统, 容器为rootfs)"},
+	{KeyFsCapacityBytes, "文件系统容量"},
+	{KeyFsAvailableBytes, "文件系统可用量"},
+	{KeyLogsUsedBytes, "容器日志使用量"},
+	{KeyVolumeUsedBytes, "pod所有volume的使用量"},
+	{KeyVolumeCapacityBytes, "pod所有volume的容量"},
+}
+
+// ConfigKubernetesUsages TypeMetricKubernetes config 中的字段描述
+var ConfigKubernetesUsages = []KeyValue{
+	{ConfigKubeletURL, "kubelet地址(" + ConfigKubeletURL + ")"},
+	{ConfigBearerTokenPath, "访问kubelet的token文件(" + ConfigBearerTokenPath + ")"},
+	{ConfigTLSCAPath, "kubelet证书的CA文件(" + ConfigTLSCAPath + ")"},
+	{ConfigInsecureSkipVerify, "是否跳过证书校验(" + ConfigInsecureSkipVerify + ")"},
+	{ConfigTimeout, "请求超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigKubeletURL:         DefaultKubeletURL,
+	ConfigBearerTokenPath:    DefaultBearerTokenPath,
+	ConfigTLSCAPath:          "",
+	ConfigInsecureSkipVerify: "true",
+	ConfigTimeout:            DefaultTimeout.String(),
+}
+
+// KubernetesStats 从本机 kubelet 的 summary API 收集节点、pod 和容器的指标, 适合以 DaemonSet 的方式部署
+type KubernetesStats struct {
+	KubeletURL         string `json:"kubelet_url"`
+	BearerTokenPath    string `json:"bearer_token_path"`
+	TLSCAPath          string `json:"tls_ca_path"`
+	InsecureSkipVerify string `json:"insecure_skip_verify"`
+	Timeout            string `json:"timeout"`
+
+	client *http.Client
+}
+
+func (_ *KubernetesStats) Name() string {
+	return TypeMetricKubernetes
+}
+
+func (_ *KubernetesStats) Usages() string {
+	return MetricKubernetesUsages
+}
+
+func (_ *KubernetesStats) Tags() []string {
+	return []string{KeyKubernetesType, KeyKubernetesNode, KeyKubernetesNamespace, KeyKubernetesPod, KeyKubernetesContainer}
+}
+
+func (_ *KubernetesStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigKubernetesUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		if val.Key == ConfigInsecureSkipVerify {
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{"true", "false"}
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyKubernetesUsages,
+	}
+	return config
+}
+
+func (s *KubernetesStats) newClient() (*http.Client, error) {
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return nil, fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricKubernetes, s.Timeout, err)
+		}
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify != "false"}
+	if s.TLSCAPath != "" {
+		ca, err := ioutil.ReadFile(s.TLSCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("metric %v read tls ca error %v", TypeMetricKubernetes, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("metric %v no certificate is found in %v", TypeMetricKubernetes, s.TLSCAPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// bearerToken 每次请求时重新读取, serviceaccount 的 token 可能会轮换
+func (s *KubernetesStats) bearerToken() (string, error) {
+	path := s.BearerTokenPath
+	if path == "" {
+		path = DefaultBearerTokenPath
+	}
+	token, err := ioutil.ReadFile(path)
+	if err != nil {
+		// 没有配置时允许不带 token 访问, 如 kubelet 开启了匿名访问
+		if os.IsNotExist(err) && s.BearerTokenPath == "" {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func (s *KubernetesStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.client == nil {
+		if s.client, err = s.newClient(); err != nil {
+			return nil, err
+		}
+	}
+	url := s.KubeletURL
+	if url == "" {
+		url = DefaultKubeletURL
+	}
+	// DaemonSet 中可以通过 downward API 把节点 IP 放到环境变量里, 如 https://${NODE_IP}:10250
+	url = strings.TrimSuffix(os.ExpandEnv(url), "/") + summaryPath
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.bearerToken()
+	if err != nil {
+		return nil, fmt.Errorf("metric %v read bearer token error %v", TypeMetricKubernetes, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("metric %v request %v error %v", TypeMetricKubernetes, url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("metric %v request %v returns %v: %s", TypeMetricKubernetes, url, resp.Status, body)
+	}
+	var summary Summary
+	if err = json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("metric %v decode summary error %v", TypeMetricKubernetes, err)
+	}
+	return summary.datas(), nil
+}
+
+// Summary 是 kubelet /stats/summary 返回的内容, 只包含需要的字段
+type Summary struct {
+	Node NodeStats  `json:"node"`
+	Pods []PodStats `json:"pods"`
+}
+
+type NodeStats struct {
+	NodeName string        `json:"nodeName"`
+	CPU      *CPUStats     `json:"cpu"`
+	Memory   *MemoryStats  `json:"memory"`
+	Network  *NetworkStats `json:"network"`
+	Fs       *FsStats      `json:"fs"`
+}
+
+type PodStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Containers []ContainerStats `json:"containers"`
+	CPU        *CPUStats        `json:"cpu"`
+	Memory     *MemoryStats     `json:"memory"`
+	Network    *NetworkStats    `json:"network"`
+	Volume     []FsStats        `json:"volume"`
+}
+
+type ContainerStats struct {
+	Name   string       `json:"name"`
+	CPU    *CPUStats    `json:"cpu"`
+	Memory *MemoryStats `json:"memory"`
+	Rootfs *FsStats     `json:"rootfs"`
+	Logs   *FsStats     `json:"logs"`
+}
+
+type CPUStats struct {
+	UsageNanoCores       *uint64 `json:"usageNanoCores"`
+	UsageCoreNanoSeconds *uint64 `json:"usageCoreNanoSeconds"`
+}
+
+type MemoryStats struct {
+	AvailableBytes  *uint64 `json:"availableBytes"`
+	UsageBytes      *uint64 `json:"usageBytes"`
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+	RSSBytes        *uint64 `json:"rssBytes"`
+	PageFaults      *uint64 `json:"pageFaults"`
+	MajorPageFaults *uint64 `json:"majorPageFaults"`
+}
+
+type NetworkStats struct {
+	RxBytes  *uint64 `json:"rxBytes"`
+	RxErrors *uint64 `json:"rxErrors"`
+	TxBytes  *uint64 `json:"txBytes"`
+	TxErrors *uint64 `json:"txErrors"`
+}
+
+type FsStats struct {
+	AvailableBytes *uint64 `json:"availableBytes"`
+	CapacityBytes  *uint64 `json:"capacityBytes"`
+	UsedBytes      *uint64 `json:"usedBytes"`
+}
+
+// set 只设置 kubelet 返回了的字段, 缺少的字段不会以 0 出现
+func set(data map[string]interface{}, key string, value *uint64) {
+	if value != nil {
+		data[key] = *value
+	}
+}
+
+func (c *CPUStats) fill(data map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	set(data, KeyCPUUsageNanoCores, c.UsageNanoCores)
+	set(data, KeyCPUUsageCoreNanoSeconds, c.UsageCoreNanoSeconds)
+}
+
+func (m *MemoryStats) fill(data map[string]interface{}) {
+	if m == nil {
+		return
+	}
+	set(data, KeyMemoryUsageBytes, m.UsageBytes)
+	set(data, KeyMemoryWorkingSetBytes, m.WorkingSetBytes)
+	set(data, KeyMemoryRSSBytes, m.RSSBytes)
+	set(data, KeyMemoryAvailableBytes, m.AvailableBytes)
+	set(data, KeyMemoryPageFaults, m.PageFaults)
+	set(data, KeyMemoryMajorPageFaults, m.MajorPageFaults)
+}
+
+func (n *NetworkStats) fill(data map[string]interface{}) {
+	if n == nil {
+		return
+	}
+	set(data, KeyNetworkRxBytes, n.RxBytes)
+	set(data, KeyNetworkRxErrors, n.RxErrors)
+	set(data, KeyNetworkTxBytes, n.TxBytes)
+	set(data, KeyNetworkTxErrors, n.TxErrors)
+}
+
+func (f *FsStats) fill(data map[string]interface{}) {
+	if f == nil {
+		return
+	}
+	set(data, KeyFsUsedBytes, f.UsedBytes)
+	set(data, KeyFsCapacityBytes, f.CapacityBytes)
+	set(data, KeyFsAvailableBytes, f.AvailableBytes)
+}
+
+func (s *Summary) datas() []map[string]interface{} {
+	datas := make([]map[string]interface{}, 0, 1+len(s.Pods))
+	node := map[string]interface{}{
+		KeyKubernetesType: TypeNode,
+		KeyKubernetesNode: s.Node.NodeName,
+	}
+	s.Node.CPU.fill(node)
+	s.Node.Memory.fill(node)
+	s.Node.Network.fill(node)
+	s.Node.Fs.fill(node)
+	datas = append(datas, node)
+
+	for _, p := range s.Pods {
+		pod := map[string]interface{}{
+			KeyKubernetesType:      TypePod,
+			KeyKubernetesNode:      s.Node.NodeName,
+			KeyKubernetesNamespace: p.PodRef.Namespace,
+			KeyKubernetesPod:       p.PodRef.Name,
+		}
+		p.CPU.fill(pod)
+		p.Memory.fill(pod)
+		p.Network.fill(pod)
+		var volumeUsed, volumeCapacity uint64
+		for _, v := range p.Volume {
+			if v.UsedBytes != nil {
+				volumeUsed += *v.UsedBytes
+			}
+			if v.CapacityBytes != nil {
+				volumeCapacity += *v.CapacityBytes
+			}
+		}
+		if len(p.Volume) > 0 {
+			pod[KeyVolumeUsedBytes] = volumeUsed
+			pod[KeyVolumeCapacityBytes] = volumeCapacity
+		}
+		datas = append(datas, pod)
+
+		for _, c := range p.Containers {
+			container := map[string]interface{}{
+				KeyKubernetesType:      TypeContainer,
+				KeyKubernetesNode:      s.Node.NodeName,
+				KeyKubernetesNamespace: p.PodRef.Namespace,
+				KeyKubernetesPod:       p.PodRef.Name,
+				KeyKubernetesContainer: c.Name,
+			}
+			c.CPU.fill(container)
+			c.Memory.fill(container)
+			c.Rootfs.fill(container)
+			if c.Logs != nil {
+				set(container, KeyLogsUsedBytes, c.Logs.UsedBytes)
+			}
+			datas = append(datas, container)
+		}
+	}
+	return datas
+}
+
+func init() {
+	metric.Add(TypeMetricKubernetes, func() metric.Collector {
+		return &KubernetesStats{}
+	})
+}
@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const summaryJSON = `{
+  "node": {
+    "nodeName": "node1",
+    "cpu": {"usageNanoCores": 1000, "usageCoreNanoSeconds": 2000},
+    "memory": {"availableBytes": 100, "usageBytes": 200, "workingSetBytes": 150},
+    "network": {"rxBytes": 10, "rxErrors": 0, "txBytes": 20, "txErrors": 1},
+    "fs": {"availableBytes": 1, "capacityBytes": 3, "usedBytes": 2}
+  },
+  "pods": [{
+    "podRef": {"name": "nginx-1", "namespace": "default", "uid": "abc"},
+    "cpu": {"usageNanoCores": 100},
+    "memory": {"workingSetBytes": 50},
+    "network": {"rxBytes": 5},
+    "volume": [{"name": "v1", "usedBytes": 1, "capacityBytes": 10}, {"name": "v2", "usedBytes": 2, "capacityBytes": 20}],
+    "containers": [{
+      "name": "nginx",
+      "cpu": {"usageNanoCores": 90},
+      "memory": {"rssBytes": 40},
+      "rootfs": {"usedBytes": 7},
+      "logs": {"usedBytes": 3}
+    }]
+  }]
+}`
+
+func TestKubernetesCollect(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != summaryPath || r.Header.Get("Authorization") != "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(summaryJSON))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kubernetes_metric")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenPath, []byte("token1\n"), 0644))
+
+	os.Setenv("KUBELET_TEST_URL", server.URL)
+	defer os.Unsetenv("KUBELET_TEST_URL")
+	c := &KubernetesStats{KubeletURL: "${KUBELET_TEST_URL}/", BearerTokenPath: tokenPath}
+	datas, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 3)
+	assert.Equal(t, map[string]interface{}{
+		KeyKubernetesType:          TypeNode,
+		KeyKubernetesNode:          "node1",
+		KeyCPUUsageNanoCores:       uint64(1000),
+		KeyCPUUsageCoreNanoSeconds: uint64(2000),
+		KeyMemoryAvailableBytes:    uint64(100),
+		KeyMemoryUsageBytes:        uint64(200),
+		KeyMemoryWorkingSetBytes:   uint64(150),
+		KeyNetworkRxBytes:          uint64(10),
+		KeyNetworkRxErrors:         uint64(0),
+		KeyNetworkTxBytes:          uint64(20),
+		KeyNetworkTxErrors:         uint64(1),
+		KeyFsAvailableBytes:        uint64(1),
+		KeyFsCapacityBytes:         uint64(3),
+		KeyFsUsedBytes:             uint64(2),
+	}, datas[0])
+	assert.Equal(t, map[string]interface{}{
+		KeyKubernetesType:        TypePod,
+		KeyKubernetesNode:        "node1",
+		KeyKubernetesNamespace:   "default",
+		KeyKubernetesPod:         "nginx-1",
+		KeyCPUUsageNanoCores:     uint64(100),
+		KeyMemoryWorkingSetBytes: uint64(50),
+		KeyNetworkRxBytes:        uint64(5),
+		KeyVolumeUsedBytes:       uint64(3),
+		KeyVolumeCapacityBytes:   uint64(30),
+	}, datas[1])
+	assert.Equal(t, map[string]interface{}{
+		KeyKubernetesType:      TypeContainer,
+		KeyKubernetesNode:      "node1",
+		KeyKubernetesNamespace: "default",
+		KeyKubernetesPod:       "nginx-1",
+		KeyKubernetesContainer: "nginx",
+		KeyCPUUsageNanoCores:   uint64(90),
+		KeyMemoryRSSBytes:      uint64(40),
+		KeyFsUsedBytes:         uint64(7),
+		KeyLogsUsedBytes:       uint64(3),
+	}, datas[2])
+
+	// token 错误
+	assert.NoError(t, ioutil.WriteFile(tokenPath, []byte("token2"), 0644))
+	_, err = c.Collect()
+	assert.Error(t, err)
+
+	// 校验证书时自签名的证书不能通过
+	c = &KubernetesStats{KubeletURL: server.URL, BearerTokenPath: tokenPath, InsecureSkipVerify: "false"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+
+	c = &KubernetesStats{KubeletURL: server.URL, BearerTokenPath: filepath.Join(dir, "not_exist")}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &KubernetesStats{Timeout: "abc"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,408 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricMysql   = "mysql"
+	MetricMysqlUsages = "MySQL(mysql)"
+
+	// Config 中的字段
+	ConfigDataSources = "data_sources"
+	ConfigInnodb      = "innodb_status"
+	ConfigSlave       = "slave_status"
+	ConfigTimeout     = "timeout"
+
+	DefaultDataSource = "root:@tcp(127.0.0.1:3306)/"
+	DefaultTimeout    = 5 * time.Second
+
+	// TypeMetricMysql 信息中的字段, 每个实例一条数据
+	// 除以下字段外, SHOW GLOBAL STATUS 中所有数值类型的字段都会以 mysql_<小写字段名> 的形式收集
+	KeyMysqlServer              = "mysql_server"
+	KeyMysqlQueries             = "mysql_queries"
+	KeyMysqlThreadsConnected    = "mysql_threads_connected"
+	KeyMysqlThreadsRunning      = "mysql_threads_running"
+	KeyMysqlSlowQueries         = "mysql_slow_queries"
+	KeyMysqlInnodbHistoryList   = "mysql_innodb_history_list_length"
+	KeyMysqlInnodbLSN           = "mysql_innodb_log_sequence_number"
+	KeyMysqlInnodbCheckpoint    = "mysql_innodb_last_checkpoint"
+	KeyMysqlInnodbCheckpointAge = "mysql_innodb_checkpoint_age"
+	KeyMysqlSlaveIORunning      = "mysql_slave_io_running"
+	KeyMysqlSlaveSQLRunning     = "mysql_slave_sql_running"
+	KeyMysqlSecondsBehindMaster = "mysql_slave_seconds_behind_master"
+	KeyMysqlSlaveLastErrno      = "mysql_slave_last_errno"
+	KeyMysqlPerSecSuffix        = "_per_sec"
+)
+
+// 这些累计值额外计算每秒的增量, 字段名为 mysql_<小写字段名>_per_sec
+var rateFields = []string{
+	"Queries", "Questions", "Com_select", "Com_insert", "Com_update", "Com_delete", "Com_commit", "Com_rollback",
+	"Slow_queries", "Connections", "Aborted_connects", "Aborted_clients", "Bytes_received", "Bytes_sent",
+	"Innodb_rows_read", "Innodb_rows_inserted", "Innodb_rows_updated", "Innodb_rows_deleted",
+	"Innodb_data_reads", "Innodb_data_writes", "Created_tmp_disk_tables", "Select_full_join",
+}
+
+// KeyMysqlUsages TypeMetricMysql 中的字段名称
+var KeyMysqlUsages = []KeyValue{
+	{KeyMysqlServer, "实例地址"},
+	{KeyMysqlQueries, "累计执行的语句数"},
+	{KeyMysqlQueries + KeyMysqlPerSecSuffix, "每秒执行的语句数(QPS)"},
+	{"mysql_com_commit" + KeyMysqlPerSecSuffix, "每秒提交的事务数(TPS)"},
+	{KeyMysqlThreadsConnected, "当前连接数"},
+	{KeyMysqlThreadsRunning, "正在执行的线程数"},
+	{KeyMysqlSlowQueries, "累计慢查询数"},
+	{KeyMysqlSlowQueries + KeyMysqlPerSecSuffix, "每秒慢查询数"},
+	{KeyMysqlInnodbHistoryList, "InnoDB undo历史列表长度"},
+	{KeyMysqlInnodbLSN, "InnoDB日志序列号"},
+	{KeyMysqlInnodbCheckpoint, "InnoDB最近检查点"},
+	{KeyMysqlInnodbCheckpointAge, "InnoDB检查点年龄(字节)"},
+	{KeyMysqlSlaveIORunning, "从库IO线程是否运行(1/0)"},
+	{KeyMysqlSlaveSQLRunning, "从库SQL线程是否运行(1/0)"},
+	{KeyMysqlSecondsBehindMaster, "从库复制延迟(秒)"},
+	{KeyMysqlSlaveLastErrno, "从库最近的复制错误码"},
+}
+
+// ConfigMysqlUsages TypeMetricMysql config 中的字段描述
+var ConfigMysqlUsages = []KeyValue{
+	{ConfigDataSources, "数据库连接地址, 如 user:password@tcp(127.0.0.1:3306)/, 分号分隔多个(" + ConfigDataSources + ")"},
+	{ConfigInnodb, "是否收集SHOW ENGINE INNODB STATUS, 需要PROCESS权限(" + ConfigInnodb + ")"},
+	{ConfigSlave, "是否收集SHOW SLAVE STATUS, 需要REPLICATION CLIENT权限(" + ConfigSlave + ")"},
+	{ConfigTimeout, "连接和查询超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigDataSources: DefaultDataSource,
+	ConfigInnodb:      "true",
+	ConfigSlave:       "true",
+	ConfigTimeout:     DefaultTimeout.String(),
+}
+
+type sample struct {
+	values map[string]int64
+	time   time.Time
+}
+
+// MysqlStats 通过 SHOW GLOBAL STATUS、SHOW ENGINE INNODB STATUS 和 SHOW SLAVE STATUS 收集 MySQL 实例的指标
+type MysqlStats struct {
+	DataSources string `json:"data_sources"`
+	Innodb      string `json:"innodb_status"`
+	Slave       string `json:"slave_status"`
+	Timeout     string `json:"timeout"`
+
+	dbs  map[string]*sql.DB
+	last map[string]sample
+}
+
+func (_ *MysqlStats) Name() string {
+	return TypeMetricMysql
+}
+
+func (_ *MysqlStats) Usages() string {
+	return MetricMysqlUsages
+}
+
+func (_ *MysqlStats) Tags() []string {
+	return []string{KeyMysqlServer}
+}
+
+func (_ *MysqlStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigMysqlUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		switch val.Key {
+		case ConfigInnodb, ConfigSlave:
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{"true", "false"}
+		case ConfigDataSources:
+			option.Secret = true
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyMysqlUsages,
+	}
+	return config
+}
+
+// dataSource 解析连接地址, 补充超时时间, 并返回作为 mysql_server 标签的实例地址
+func dataSource(dsn string, timeout time.Duration) (string, string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", "", err
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = timeout
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = timeout
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = timeout
+	}
+	return cfg.FormatDSN(), cfg.Addr, nil
+}
+
+func (s *MysqlStats) init() error {
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricMysql, s.Timeout, err)
+		}
+	}
+	dsns := s.DataSources
+	if strings.TrimSpace(dsns) == "" {
+		dsns = DefaultDataSource
+	}
+	dbs := make(map[string]*sql.DB)
+	for _, dsn := range strings.Split(dsns, ";") {
+		if dsn = strings.TrimSpace(dsn); dsn == "" {
+			continue
+		}
+		dsn, server, err := dataSource(dsn, timeout)
+		if err != nil {
+			// 错误信息中可能带有密码, 不输出连接地址
+			return fmt.Errorf("metric %v parse data source error %v", TypeMetricMysql, err)
+		}
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			return fmt.Errorf("metric %v open %v error %v", TypeMetricMysql, server, err)
+		}
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		dbs[server] = db
+	}
+	s.dbs = dbs
+	s.last = make(map[string]sample)
+	return nil
+}
+
+// Collect 中某个实例收集失败只记录日志, 所有实例都失败时才返回错误
+func (s *MysqlStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.dbs == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	var lastErr error
+	for server, db := range s.dbs {
+		data, err := s.collect(server, db)
+		if err != nil {
+			log.Warnf("metric %v collect %v error %v", TypeMetricMysql, server, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, data)
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricMysql, lastErr)
+	}
+	return datas, nil
+}
+
+func (s *MysqlStats) collect(server string, db *sql.DB) (map[string]interface{}, error) {
+	status, err := queryStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	data, values := parseGlobalStatus(status)
+	if last, ok := s.last[server]; ok {
+		addRates(data, last, sample{values: values, time: now})
+	}
+	s.last[server] = sample{values: values, time: now}
+	data[KeyMysqlServer] = server
+
+	// 权限不足等错误不影响其他指标
+	if s.Innodb != "false" {
+		var typ, name, innodbStatus string
+		if err := db.QueryRow("SHOW ENGINE INNODB STATUS").Scan(&typ, &name, &innodbStatus); err != nil {
+			log.Debugf("metric %v %v show engine innodb status error %v", TypeMetricMysql, server, err)
+		} else {
+			for k, v := range parseInnodbStatus(innodbStatus) {
+				data[k] = v
+			}
+		}
+	}
+	if s.Slave != "false" {
+		slave, err := querySlaveStatus(db)
+		if err != nil {
+			log.Debugf("metric %v %v show slave status error %v", TypeMetricMysql, server, err)
+		} else {
+			for k, v := range parseSlaveStatus(slave) {
+				data[k] = v
+			}
+		}
+	}
+	return data, nil
+}
+
+func queryStatus(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SHOW GLOBAL STATUS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	status := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var value sql.RawBytes
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[name] = string(value)
+	}
+	return status, rows.Err()
+}
+
+// querySlaveStatus 返回 SHOW SLAVE STATUS 的列名和值, 不是从库时返回空
+func querySlaveStatus(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]string)
+	if !rows.Next() {
+		return status, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		if values[i].Valid {
+			status[column] = values[i].String
+		}
+	}
+	return status, nil
+}
+
+// parseGlobalStatus 把 SHOW GLOBAL STATUS 中数值类型的字段转为 mysql_<小写字段名>, ON/OFF 转为 1/0
+// 同时返回整数类型的原始值用于计算速率
+func parseGlobalStatus(status map[string]string) (map[string]interface{}, map[string]int64) {
+	data := make(map[string]interface{})
+	values := make(map[string]int64)
+	for name, value := range status {
+		key := "mysql_" + strings.ToLower(name)
+		switch value {
+		case "ON":
+			data[key] = int64(1)
+			continue
+		case "OFF":
+			data[key] = int64(0)
+			continue
+		}
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			data[key] = i
+			values[name] = i
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			data[key] = f
+		}
+	}
+	return data, values
+}
+
+// addRates 计算 rateFields 的每秒增量, 计数器变小(如实例重启)时跳过
+func addRates(data map[string]interface{}, last, cur sample) {
+	seconds := cur.time.Sub(last.time).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	for _, name := range rateFields {
+		prev, ok1 := last.values[name]
+		now, ok2 := cur.values[name]
+		if !ok1 || !ok2 || now < prev {
+			continue
+		}
+		data["mysql_"+strings.ToLower(name)+KeyMysqlPerSecSuffix] = float64(now-prev) / seconds
+	}
+}
+
+var (
+	historyListRegex = regexp.MustCompile(`History list length (\d+)`)
+	lsnRegex         = regexp.MustCompile(`Log sequence number\s+(\d+)`)
+	checkpointRegex  = regexp.MustCompile(`Last checkpoint at\s+(\d+)`)
+)
+
+// parseInnodbStatus 从 SHOW ENGINE INNODB STATUS 的文本中解析 undo 历史列表长度和检查点信息
+func parseInnodbStatus(status string) map[string]interface{} {
+	data := make(map[string]interface{})
+	parse := func(re *regexp.Regexp, key string) (int64, bool) {
+		match := re.FindStringSubmatch(status)
+		if len(match) < 2 {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		data[key] = v
+		return v, true
+	}
+	parse(historyListRegex, KeyMysqlInnodbHistoryList)
+	lsn, ok1 := parse(lsnRegex, KeyMysqlInnodbLSN)
+	checkpoint, ok2 := parse(checkpointRegex, KeyMysqlInnodbCheckpoint)
+	if ok1 && ok2 {
+		data[KeyMysqlInnodbCheckpointAge] = lsn - checkpoint
+	}
+	return data
+}
+
+// parseSlaveStatus 解析 SHOW SLAVE STATUS, 复制线程停止时 Seconds_Behind_Master 为 NULL, 不输出该字段
+func parseSlaveStatus(status map[string]string) map[string]interface{} {
+	data := make(map[string]interface{})
+	if len(status) == 0 {
+		return data
+	}
+	yes := func(v string) int64 {
+		if v == "Yes" {
+			return 1
+		}
+		return 0
+	}
+	data[KeyMysqlSlaveIORunning] = yes(status["Slave_IO_Running"])
+	data[KeyMysqlSlaveSQLRunning] = yes(status["Slave_SQL_Running"])
+	if v, err := strconv.ParseInt(status["Seconds_Behind_Master"], 10, 64); err == nil {
+		data[KeyMysqlSecondsBehindMaster] = v
+	}
+	if v, err := strconv.ParseInt(status["Last_Errno"], 10, 64); err == nil {
+		data[KeyMysqlSlaveLastErrno] = v
+	}
+	return data
+}
+
+func init() {
+	metric.Add(TypeMetricMysql, func() metric.Collector {
+		return &MysqlStats{}
+	})
+}
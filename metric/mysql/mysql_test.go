@@ -0,0 +1,101 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGlobalStatus(t *testing.T) {
+	data, values := parseGlobalStatus(map[string]string{
+		"Queries":              "1000",
+		"Threads_connected":    "5",
+		"Ssl_cipher":           "",
+		"Slave_running":        "OFF",
+		"Rpl_semi_sync_status": "ON",
+		"Uptime_since_flush":   "1.5",
+	})
+	assert.Equal(t, map[string]interface{}{
+		KeyMysqlQueries:              int64(1000),
+		KeyMysqlThreadsConnected:     int64(5),
+		"mysql_slave_running":        int64(0),
+		"mysql_rpl_semi_sync_status": int64(1),
+		"mysql_uptime_since_flush":   1.5,
+	}, data)
+	assert.Equal(t, map[string]int64{"Queries": 1000, "Threads_connected": 5}, values)
+
+	now := time.Now()
+	last := sample{values: map[string]int64{"Queries": 1000, "Com_select": 500, "Slow_queries": 10}, time: now.Add(-10 * time.Second)}
+	cur := sample{values: map[string]int64{"Queries": 1500, "Com_select": 100, "Slow_queries": 20}, time: now}
+	addRates(data, last, cur)
+	assert.Equal(t, float64(50), data[KeyMysqlQueries+KeyMysqlPerSecSuffix])
+	assert.Equal(t, float64(1), data[KeyMysqlSlowQueries+KeyMysqlPerSecSuffix])
+	// 计数器变小时不计算速率
+	_, ok := data["mysql_com_select"+KeyMysqlPerSecSuffix]
+	assert.False(t, ok)
+}
+
+func TestParseInnodbStatus(t *testing.T) {
+	status := `
+------------
+TRANSACTIONS
+------------
+Trx id counter 1234
+History list length 42
+---
+LOG
+---
+Log sequence number 2000000
+Log flushed up to   1999000
+Last checkpoint at  1500000
+`
+	assert.Equal(t, map[string]interface{}{
+		KeyMysqlInnodbHistoryList:   int64(42),
+		KeyMysqlInnodbLSN:           int64(2000000),
+		KeyMysqlInnodbCheckpoint:    int64(1500000),
+		KeyMysqlInnodbCheckpointAge: int64(500000),
+	}, parseInnodbStatus(status))
+	assert.Empty(t, parseInnodbStatus("nothing"))
+}
+
+func TestParseSlaveStatus(t *testing.T) {
+	assert.Empty(t, parseSlaveStatus(map[string]string{}))
+	assert.Equal(t, map[string]interface{}{
+		KeyMysqlSlaveIORunning:      int64(1),
+		KeyMysqlSlaveSQLRunning:     int64(1),
+		KeyMysqlSecondsBehindMaster: int64(3),
+		KeyMysqlSlaveLastErrno:      int64(0),
+	}, parseSlaveStatus(map[string]string{
+		"Slave_IO_Running":      "Yes",
+		"Slave_SQL_Running":     "Yes",
+		"Seconds_Behind_Master": "3",
+		"Last_Errno":            "0",
+	}))
+	// SQL 线程停止时 Seconds_Behind_Master 为 NULL
+	assert.Equal(t, map[string]interface{}{
+		KeyMysqlSlaveIORunning:  int64(1),
+		KeyMysqlSlaveSQLRunning: int64(0),
+		KeyMysqlSlaveLastErrno:  int64(1062),
+	}, parseSlaveStatus(map[string]string{
+		"Slave_IO_Running":  "Yes",
+		"Slave_SQL_Running": "No",
+		"Last_Errno":        "1062",
+	}))
+}
+
+func TestMysqlCollectError(t *testing.T) {
+	dsn, _, err := dataSource("root:pass@tcp(127.0.0.1:3306)/", time.Second)
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "timeout=1s")
+
+	c := &MysqlStats{DataSources: "root:@tcp(127.0.0.1:1)/", Timeout: "100ms"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &MysqlStats{DataSources: "root@tcp(127.0.0.1:3306"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &MysqlStats{Timeout: "abc"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,389 @@
+package nginx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricNginx   = "nginx"
+	MetricNginxUsages = "Nginx(nginx)"
+
+	// Config 中的字段
+	ConfigStubStatusURLs = "stub_status_urls"
+	ConfigVTSURLs        = "vts_urls"
+	ConfigTimeout        = "timeout"
+
+	DefaultStubStatusURL = "http://127.0.0.1/nginx_status"
+	DefaultTimeout       = 5 * time.Second
+
+	TypeConnections = "connections"
+	TypeServerZone  = "server_zone"
+	TypeUpstream    = "upstream"
+
+	// TypeMetricNginx 信息中的字段, 连接数、每个 server zone 和每个 upstream server 的数据分别为一条, 通过 nginx_type 区分
+	KeyNginxType           = "nginx_type"
+	KeyNginxServer         = "nginx_server"
+	KeyNginxZone           = "nginx_zone"
+	KeyNginxUpstream       = "nginx_upstream"
+	KeyNginxUpstreamServer = "nginx_upstream_server"
+	KeyNginxActive         = "nginx_active"
+	KeyNginxAccepts        = "nginx_accepts"
+	KeyNginxHandled        = "nginx_handled"
+	KeyNginxRequests       = "nginx_requests"
+	KeyNginxReading        = "nginx_reading"
+	KeyNginxWriting        = "nginx_writing"
+	KeyNginxWaiting        = "nginx_waiting"
+	KeyNginxInBytes        = "nginx_in_bytes"
+	KeyNginxOutBytes       = "nginx_out_bytes"
+	KeyNginxResponses1xx   = "nginx_responses_1xx"
+	KeyNginxResponses2xx   = "nginx_responses_2xx"
+	KeyNginxResponses3xx   = "nginx_responses_3xx"
+	KeyNginxResponses4xx   = "nginx_responses_4xx"
+	KeyNginxResponses5xx   = "nginx_responses_5xx"
+	KeyNginxResponseMsec   = "nginx_response_msec"
+	KeyNginxDown           = "nginx_down"
+)
+
+// KeyNginxUsages TypeMetricNginx 中的字段名称
+var KeyNginxUsages = []KeyValue{
+	{KeyNginxType, "数据类型(connections/server_zone/upstream)"},
+	{KeyNginxServer, "nginx地址"},
+	{KeyNginxZone, "server zone名称"},
+	{KeyNginxUpstream, "upstream名称"},
+	{KeyNginxUpstreamServer, "upstream server地址"},
+	{KeyNginxActive, "活跃连接数"},
+	{KeyNginxAccepts, "累计接受的连接数"},
+	{KeyNginxHandled, "累计处理的连接数"},
+	{KeyNginxRequests, "累计请求数"},
+	{KeyNginxReading, "正在读取请求头的连接数"},
+	{KeyNginxWriting, "正在写响应的连接数"},
+	{KeyNginxWaiting, "空闲的keepalive连接数"},
+	{KeyNginxInBytes, "累计接收字节数"},
+	{KeyNginxOutBytes, "累计发送字节数"},
+	{KeyNginxResponses1xx, "累计1xx响应数"},
+	{KeyNginxResponses2xx, "累计2xx响应数"},
+	{KeyNginxResponses3xx, "累计3xx响应数"},
+	{KeyNginxResponses4xx, "累计4xx响应数"},
+	{KeyNginxResponses5xx, "累计5xx响应数"},
+	{KeyNginxResponseMsec, "upstream平均响应时间(毫秒)"},
+	{KeyNginxDown, "upstream server是否下线"},
+}
+
+// ConfigNginxUsages TypeMetricNginx config 中的字段描述
+var ConfigNginxUsages = []KeyValue{
+	{ConfigStubStatusURLs, "stub_status地址, 逗号分隔多个(" + ConfigStubStatusURLs + ")"},
+	{ConfigVTSURLs, "VTS模块的JSON地址, 如 http://127.0.0.1/status/format/json, 逗号分隔多个(" + ConfigVTSURLs + ")"},
+	{ConfigTimeout, "请求超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigStubStatusURLs: DefaultStubStatusURL,
+	ConfigVTSURLs:        "",
+	ConfigTimeout:        DefaultTimeout.String(),
+}
+
+// NginxStats 从 nginx 的 stub_status 和 nginx-module-vts 收集连接数和请求数等指标
+type NginxStats struct {
+	StubStatusURLs string `json:"stub_status_urls"`
+	VTSURLs        string `json:"vts_urls"`
+	Timeout        string `json:"timeout"`
+
+	client *http.Client
+}
+
+func (_ *NginxStats) Name() string {
+	return TypeMetricNginx
+}
+
+func (_ *NginxStats) Usages() string {
+	return MetricNginxUsages
+}
+
+func (_ *NginxStats) Tags() []string {
+	return []string{KeyNginxType, KeyNginxServer, KeyNginxZone, KeyNginxUpstream, KeyNginxUpstreamServer}
+}
+
+func (_ *NginxStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigNginxUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyNginxUsages,
+	}
+	return config
+}
+
+func splitURLs(urls string) []string {
+	ret := make([]string, 0)
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+// serverName 返回 url 中的 host:port, 作为 nginx_server 标签
+func serverName(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return addr
+	}
+	return u.Host
+}
+
+// Collect 中某个地址请求失败只记录日志, 所有地址都失败时才返回错误
+func (s *NginxStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.client == nil {
+		timeout := DefaultTimeout
+		if s.Timeout != "" {
+			if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+				return nil, fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricNginx, s.Timeout, err)
+			}
+		}
+		s.client = &http.Client{Timeout: timeout}
+	}
+	stubStatusURLs := splitURLs(s.StubStatusURLs)
+	vtsURLs := splitURLs(s.VTSURLs)
+	if len(stubStatusURLs) == 0 && len(vtsURLs) == 0 {
+		stubStatusURLs = []string{DefaultStubStatusURL}
+	}
+
+	var lastErr error
+	for _, u := range stubStatusURLs {
+		data, err := s.collectStubStatus(u)
+		if err != nil {
+			log.Warnf("metric %v collect stub_status from %v error %v", TypeMetricNginx, u, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, data)
+	}
+	for _, u := range vtsURLs {
+		vtsDatas, err := s.collectVTS(u)
+		if err != nil {
+			log.Warnf("metric %v collect vts from %v error %v", TypeMetricNginx, u, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, vtsDatas...)
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricNginx, lastErr)
+	}
+	return datas, nil
+}
+
+func (s *NginxStats) get(addr string) (io.ReadCloser, error) {
+	resp, err := s.client.Get(addr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("request %v returns %v: %s", addr, resp.Status, body)
+	}
+	return resp.Body, nil
+}
+
+func (s *NginxStats) collectStubStatus(addr string) (map[string]interface{}, error) {
+	body, err := s.get(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := parseStubStatus(body)
+	if err != nil {
+		return nil, err
+	}
+	data[KeyNginxType] = TypeConnections
+	data[KeyNginxServer] = serverName(addr)
+	return data, nil
+}
+
+// parseStubStatus 解析 stub_status 的输出, 格式如下:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func parseStubStatus(r io.Reader) (map[string]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	lines := make([]string, 0, 4)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "Active connections:") {
+		return nil, fmt.Errorf("unexpected stub_status content %q", strings.Join(lines, "\n"))
+	}
+
+	data := make(map[string]interface{})
+	active, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(lines[0], "Active connections:")), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse active connections error %v", err)
+	}
+	data[KeyNginxActive] = active
+
+	counters := strings.Fields(lines[2])
+	if len(counters) != 3 {
+		return nil, fmt.Errorf("unexpected stub_status counters %q", lines[2])
+	}
+	for i, key := range []string{KeyNginxAccepts, KeyNginxHandled, KeyNginxRequests} {
+		v, err := strconv.ParseUint(counters[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %v error %v", key, err)
+		}
+		data[key] = v
+	}
+
+	states := strings.Fields(lines[3])
+	keys := map[string]string{"Reading:": KeyNginxReading, "Writing:": KeyNginxWriting, "Waiting:": KeyNginxWaiting}
+	for i := 0; i+1 < len(states); i += 2 {
+		key, ok := keys[states[i]]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(states[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %v error %v", key, err)
+		}
+		data[key] = v
+	}
+	return data, nil
+}
+
+// VTS 是 nginx-module-vts JSON 格式的输出, 只包含需要的字段
+type VTS struct {
+	Connections struct {
+		Active   uint64 `json:"active"`
+		Reading  uint64 `json:"reading"`
+		Writing  uint64 `json:"writing"`
+		Waiting  uint64 `json:"waiting"`
+		Accepted uint64 `json:"accepted"`
+		Handled  uint64 `json:"handled"`
+		Requests uint64 `json:"requests"`
+	} `json:"connections"`
+	ServerZones   map[string]VTSZone       `json:"serverZones"`
+	UpstreamZones map[string][]VTSUpstream `json:"upstreamZones"`
+}
+
+type VTSResponses struct {
+	OneXX   uint64 `json:"1xx"`
+	TwoXX   uint64 `json:"2xx"`
+	ThreeXX uint64 `json:"3xx"`
+	FourXX  uint64 `json:"4xx"`
+	FiveXX  uint64 `json:"5xx"`
+}
+
+type VTSZone struct {
+	RequestCounter uint64       `json:"requestCounter"`
+	InBytes        uint64       `json:"inBytes"`
+	OutBytes       uint64       `json:"outBytes"`
+	Responses      VTSResponses `json:"responses"`
+}
+
+type VTSUpstream struct {
+	Server string `json:"server"`
+	VTSZone
+	ResponseMsec uint64 `json:"responseMsec"`
+	Down         bool   `json:"down"`
+}
+
+func (z *VTSZone) fill(data map[string]interface{}) {
+	data[KeyNginxRequests] = z.RequestCounter
+	data[KeyNginxInBytes] = z.InBytes
+	data[KeyNginxOutBytes] = z.OutBytes
+	data[KeyNginxResponses1xx] = z.Responses.OneXX
+	data[KeyNginxResponses2xx] = z.Responses.TwoXX
+	data[KeyNginxResponses3xx] = z.Responses.ThreeXX
+	data[KeyNginxResponses4xx] = z.Responses.FourXX
+	data[KeyNginxResponses5xx] = z.Responses.FiveXX
+}
+
+func (s *NginxStats) collectVTS(addr string) ([]map[string]interface{}, error) {
+	body, err := s.get(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var vts VTS
+	if err = json.NewDecoder(body).Decode(&vts); err != nil {
+		return nil, fmt.Errorf("decode vts json error %v", err)
+	}
+	return vts.datas(serverName(addr)), nil
+}
+
+func (v *VTS) datas(server string) []map[string]interface{} {
+	datas := make([]map[string]interface{}, 0, 1+len(v.ServerZones)+len(v.UpstreamZones))
+	datas = append(datas, map[string]interface{}{
+		KeyNginxType:     TypeConnections,
+		KeyNginxServer:   server,
+		KeyNginxActive:   v.Connections.Active,
+		KeyNginxReading:  v.Connections.Reading,
+		KeyNginxWriting:  v.Connections.Writing,
+		KeyNginxWaiting:  v.Connections.Waiting,
+		KeyNginxAccepts:  v.Connections.Accepted,
+		KeyNginxHandled:  v.Connections.Handled,
+		KeyNginxRequests: v.Connections.Requests,
+	})
+	for name, zone := range v.ServerZones {
+		data := map[string]interface{}{
+			KeyNginxType:   TypeServerZone,
+			KeyNginxServer: server,
+			KeyNginxZone:   name,
+		}
+		zone.fill(data)
+		datas = append(datas, data)
+	}
+	for name, upstreams := range v.UpstreamZones {
+		for _, upstream := range upstreams {
+			data := map[string]interface{}{
+				KeyNginxType:           TypeUpstream,
+				KeyNginxServer:         server,
+				KeyNginxUpstream:       name,
+				KeyNginxUpstreamServer: upstream.Server,
+				KeyNginxResponseMsec:   upstream.ResponseMsec,
+				KeyNginxDown:           upstream.Down,
+			}
+			upstream.fill(data)
+			datas = append(datas, data)
+		}
+	}
+	return datas
+}
+
+func init() {
+	metric.Add(TypeMetricNginx, func() metric.Collector {
+		return &NginxStats{}
+	})
+}
@@ -0,0 +1,129 @@
+package nginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const stubStatus = `Active connections: 291 
+server accepts handled requests
+ 16630948 16630948 31070465 
+Reading: 6 Writing: 179 Waiting: 106 
+`
+
+const vtsJSON = `{
+  "connections": {"active": 2, "reading": 0, "writing": 1, "waiting": 1, "accepted": 10, "handled": 10, "requests": 20},
+  "serverZones": {
+    "example.com": {"requestCounter": 15, "inBytes": 100, "outBytes": 200,
+      "responses": {"1xx": 0, "2xx": 12, "3xx": 1, "4xx": 2, "5xx": 0}}
+  },
+  "upstreamZones": {
+    "backend": [
+      {"server": "10.0.0.1:80", "requestCounter": 5, "inBytes": 50, "outBytes": 60,
+        "responses": {"1xx": 0, "2xx": 4, "3xx": 0, "4xx": 0, "5xx": 1}, "responseMsec": 3, "down": false}
+    ]
+  }
+}`
+
+func TestParseStubStatus(t *testing.T) {
+	data, err := parseStubStatus(strings.NewReader(stubStatus))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		KeyNginxActive:   uint64(291),
+		KeyNginxAccepts:  uint64(16630948),
+		KeyNginxHandled:  uint64(16630948),
+		KeyNginxRequests: uint64(31070465),
+		KeyNginxReading:  uint64(6),
+		KeyNginxWriting:  uint64(179),
+		KeyNginxWaiting:  uint64(106),
+	}, data)
+
+	for _, content := range []string{
+		"",
+		"<html>not found</html>",
+		"Active connections: abc\nserver accepts handled requests\n 1 1 1\nReading: 0 Writing: 1 Waiting: 0",
+		"Active connections: 1\nserver accepts handled requests\n 1 1\nReading: 0 Writing: 1 Waiting: 0",
+	} {
+		_, err = parseStubStatus(strings.NewReader(content))
+		assert.Error(t, err, content)
+	}
+}
+
+func TestNginxCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nginx_status":
+			w.Write([]byte(stubStatus))
+		case "/status/format/json":
+			w.Write([]byte(vtsJSON))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	c := &NginxStats{
+		StubStatusURLs: server.URL + "/nginx_status, " + server.URL + "/not_found",
+		VTSURLs:        server.URL + "/status/format/json",
+	}
+	datas, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 4)
+	assert.Equal(t, TypeConnections, datas[0][KeyNginxType])
+	assert.Equal(t, host, datas[0][KeyNginxServer])
+	assert.Equal(t, uint64(291), datas[0][KeyNginxActive])
+	assert.Equal(t, map[string]interface{}{
+		KeyNginxType:     TypeConnections,
+		KeyNginxServer:   host,
+		KeyNginxActive:   uint64(2),
+		KeyNginxReading:  uint64(0),
+		KeyNginxWriting:  uint64(1),
+		KeyNginxWaiting:  uint64(1),
+		KeyNginxAccepts:  uint64(10),
+		KeyNginxHandled:  uint64(10),
+		KeyNginxRequests: uint64(20),
+	}, datas[1])
+	assert.Equal(t, map[string]interface{}{
+		KeyNginxType:         TypeServerZone,
+		KeyNginxServer:       host,
+		KeyNginxZone:         "example.com",
+		KeyNginxRequests:     uint64(15),
+		KeyNginxInBytes:      uint64(100),
+		KeyNginxOutBytes:     uint64(200),
+		KeyNginxResponses1xx: uint64(0),
+		KeyNginxResponses2xx: uint64(12),
+		KeyNginxResponses3xx: uint64(1),
+		KeyNginxResponses4xx: uint64(2),
+		KeyNginxResponses5xx: uint64(0),
+	}, datas[2])
+	assert.Equal(t, map[string]interface{}{
+		KeyNginxType:           TypeUpstream,
+		KeyNginxServer:         host,
+		KeyNginxUpstream:       "backend",
+		KeyNginxUpstreamServer: "10.0.0.1:80",
+		KeyNginxRequests:       uint64(5),
+		KeyNginxInBytes:        uint64(50),
+		KeyNginxOutBytes:       uint64(60),
+		KeyNginxResponses1xx:   uint64(0),
+		KeyNginxResponses2xx:   uint64(4),
+		KeyNginxResponses3xx:   uint64(0),
+		KeyNginxResponses4xx:   uint64(0),
+		KeyNginxResponses5xx:   uint64(1),
+		KeyNginxResponseMsec:   uint64(3),
+		KeyNginxDown:           false,
+	}, datas[3])
+
+	// 所有地址都失败时返回错误
+	c = &NginxStats{StubStatusURLs: server.URL + "/not_found", VTSURLs: server.URL + "/nginx_status"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+
+	c = &NginxStats{Timeout: "abc"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+}
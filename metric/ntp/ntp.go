@@ -0,0 +1,440 @@
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricNtp   = "ntp"
+	MetricNtpUsages = "时钟偏移(ntp)"
+
+	// Config 中的字段
+	ConfigNtpServers     = "servers"
+	ConfigNtpLocalDaemon = "local_daemon"
+	ConfigNtpTimeout     = "timeout"
+
+	DefaultNtpServers = "pool.ntp.org"
+	DefaultTimeout    = 5 * time.Second
+
+	// 本地时间同步守护进程
+	LocalDaemonNone   = "none"
+	LocalDaemonChrony = "chrony"
+	LocalDaemonNtpd   = "ntpd"
+
+	// 数据来源
+	SourceSntp   = "sntp"
+	SourceChrony = "chrony"
+	SourceNtpd   = "ntpd"
+
+	// TypeMetricNtp 信息中的字段, 每个 NTP 服务器或本地守护进程一条数据
+	KeyNtpServer         = "ntp_server"
+	KeyNtpSource         = "ntp_source"
+	KeyNtpOffset         = "ntp_offset"
+	KeyNtpRtt            = "ntp_rtt"
+	KeyNtpStratum        = "ntp_stratum"
+	KeyNtpLeap           = "ntp_leap"
+	KeyNtpRootDelay      = "ntp_root_delay"
+	KeyNtpRootDispersion = "ntp_root_dispersion"
+	KeyNtpDrift          = "ntp_drift_ppm"
+)
+
+// KeyNtpUsages TypeMetricNtp 中的字段名称
+var KeyNtpUsages = []KeyValue{
+	{KeyNtpServer, "NTP服务器地址, 本地守护进程为其同步的服务器"},
+	{KeyNtpSource, "数据来源(sntp/chrony/ntpd)"},
+	{KeyNtpOffset, "本地时钟减去参考时钟的偏移(ms), 正数表示本地时钟偏快"},
+	{KeyNtpRtt, "请求NTP服务器的往返时延(ms)"},
+	{KeyNtpStratum, "参考时钟的层级"},
+	{KeyNtpLeap, "闰秒标志, 3表示时钟未同步"},
+	{KeyNtpRootDelay, "到一级时钟源的往返时延(ms)"},
+	{KeyNtpRootDispersion, "到一级时钟源的离散度(ms)"},
+	{KeyNtpDrift, "时钟漂移(ppm), 正数表示本地时钟偏快, sntp为两次采集间偏移的变化率, chrony/ntpd为守护进程估计的本地时钟频率误差"},
+}
+
+// ConfigNtpUsages TypeMetricNtp config 中的字段描述
+var ConfigNtpUsages = []KeyValue{
+	{ConfigNtpServers, "NTP服务器, 格式为host或host:port, 逗号分隔多个, 为空时不直接查询(" + ConfigNtpServers + ")"},
+	{ConfigNtpLocalDaemon, "同时收集本地时间同步守护进程的状态(" + ConfigNtpLocalDaemon + ")"},
+	{ConfigNtpTimeout, "超时时间(" + ConfigNtpTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigNtpServers:     DefaultNtpServers,
+	ConfigNtpLocalDaemon: LocalDaemonNone,
+	ConfigNtpTimeout:     DefaultTimeout.String(),
+}
+
+// NtpStats 通过 SNTP 直接查询 NTP 服务器, 或者读取 chrony/ntpd 的状态, 收集本地时钟的偏移和漂移
+type NtpStats struct {
+	Servers     string `json:"servers"`
+	LocalDaemon string `json:"local_daemon"`
+	Timeout     string `json:"timeout"`
+
+	servers []string
+	timeout time.Duration
+	// run 执行 chronyc/ntpq 并返回标准输出, 测试时替换
+	run func(name string, args ...string) ([]byte, error)
+	// 上次采集的偏移, 用于计算 sntp 的漂移
+	lastOffsets map[string]offsetAt
+}
+
+type offsetAt struct {
+	offset time.Duration
+	at     time.Time
+}
+
+func (_ *NtpStats) Name() string {
+	return TypeMetricNtp
+}
+
+func (_ *NtpStats) Usages() string {
+	return MetricNtpUsages
+}
+
+func (_ *NtpStats) Tags() []string {
+	return []string{KeyNtpServer, KeyNtpSource}
+}
+
+func (_ *NtpStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigNtpUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		if val.Key == ConfigNtpLocalDaemon {
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{LocalDaemonNone, LocalDaemonChrony, LocalDaemonNtpd}
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyNtpUsages,
+	}
+	return config
+}
+
+func (s *NtpStats) init() error {
+	s.timeout = DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if s.timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricNtp, s.Timeout, err)
+		}
+	}
+	switch s.LocalDaemon {
+	case "", LocalDaemonNone, LocalDaemonChrony, LocalDaemonNtpd:
+	default:
+		return fmt.Errorf("metric %v unknown %v %q", TypeMetricNtp, ConfigNtpLocalDaemon, s.LocalDaemon)
+	}
+	s.servers = make([]string, 0)
+	for _, server := range strings.Split(s.Servers, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "123")
+		}
+		s.servers = append(s.servers, server)
+	}
+	if len(s.servers) == 0 && (s.LocalDaemon == "" || s.LocalDaemon == LocalDaemonNone) {
+		return fmt.Errorf("metric %v both %v and %v are empty", TypeMetricNtp, ConfigNtpServers, ConfigNtpLocalDaemon)
+	}
+	if s.run == nil {
+		timeout := s.timeout
+		s.run = func(name string, args ...string) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return exec.CommandContext(ctx, name, args...).Output()
+		}
+	}
+	s.lastOffsets = make(map[string]offsetAt)
+	return nil
+}
+
+// Collect 中某个来源收集失败只记录日志, 所有来源都失败时才返回错误
+func (s *NtpStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.servers == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	var lastErr error
+	for _, server := range s.servers {
+		data, err := s.collectServer(server)
+		if err != nil {
+			log.Warnf("metric %v query %v error %v", TypeMetricNtp, server, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, data)
+	}
+	var data map[string]interface{}
+	switch s.LocalDaemon {
+	case LocalDaemonChrony:
+		var out []byte
+		if out, err = s.run("chronyc", "-c", "tracking"); err == nil {
+			data, err = parseChronyTracking(out)
+		}
+	case LocalDaemonNtpd:
+		var out []byte
+		if out, err = s.run("ntpq", "-c", "rv 0 offset,frequency,stratum,leap,rootdelay,rootdisp,refid"); err == nil {
+			data, err = parseNtpqReadvar(out)
+		}
+	}
+	if err != nil {
+		log.Warnf("metric %v collect %v status error %v", TypeMetricNtp, s.LocalDaemon, err)
+		lastErr = err
+	} else if data != nil {
+		datas = append(datas, data)
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricNtp, lastErr)
+	}
+	return datas, nil
+}
+
+func (s *NtpStats) collectServer(server string) (map[string]interface{}, error) {
+	resp, err := query(server, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		KeyNtpServer:         server,
+		KeyNtpSource:         SourceSntp,
+		KeyNtpOffset:         milliseconds(resp.offset),
+		KeyNtpRtt:            milliseconds(resp.rtt),
+		KeyNtpStratum:        int64(resp.stratum),
+		KeyNtpLeap:           int64(resp.leap),
+		KeyNtpRootDelay:      milliseconds(resp.rootDelay),
+		KeyNtpRootDispersion: milliseconds(resp.rootDispersion),
+	}
+	now := time.Now()
+	if last, ok := s.lastOffsets[server]; ok {
+		if elapsed := now.Sub(last.at); elapsed > 0 {
+			data[KeyNtpDrift] = float64(resp.offset-last.offset) / float64(elapsed) * 1e6
+		}
+	}
+	s.lastOffsets[server] = offsetAt{offset: resp.offset, at: now}
+	return data, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+const (
+	ntpPacketSize = 48
+	// 1900-01-01 到 1970-01-01 的秒数
+	ntpEpochOffset = 2208988800
+	ntpModeServer  = 4
+)
+
+type ntpResponse struct {
+	offset         time.Duration
+	rtt            time.Duration
+	stratum        uint8
+	leap           uint8
+	rootDelay      time.Duration
+	rootDispersion time.Duration
+}
+
+func toNtpTime(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano()) + ntpEpochOffset*uint64(time.Second)
+	sec := nsec / uint64(time.Second)
+	frac := (nsec % uint64(time.Second)) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+func fromNtpTime(t uint64) time.Time {
+	sec := int64(t>>32) - ntpEpochOffset
+	nsec := int64((t & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// fromNtpShort 转换 16.16 定点数表示的时长
+func fromNtpShort(v uint32) time.Duration {
+	return time.Duration(uint64(v) * uint64(time.Second) >> 16)
+}
+
+// query 发送一个 SNTP 请求, 按 RFC 4330 计算本地时钟的偏移和往返时延
+func query(server string, timeout time.Duration) (*ntpResponse, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	// LI = 0, VN = 4, Mode = 3(client)
+	req[0] = 0x23
+	t1 := time.Now()
+	origin := toNtpTime(t1)
+	binary.BigEndian.PutUint64(req[40:], origin)
+	if _, err = conn.Write(req); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return nil, err
+	}
+	if n < ntpPacketSize {
+		return nil, fmt.Errorf("short ntp response of %d bytes", n)
+	}
+	if mode := resp[0] & 0x07; mode != ntpModeServer {
+		return nil, fmt.Errorf("invalid ntp response mode %d", mode)
+	}
+	stratum := resp[1]
+	if stratum == 0 {
+		return nil, fmt.Errorf("kiss of death received: %q", string(resp[12:16]))
+	}
+	if binary.BigEndian.Uint64(resp[24:]) != origin {
+		return nil, errors.New("ntp response origin timestamp mismatch")
+	}
+	t2 := fromNtpTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNtpTime(binary.BigEndian.Uint64(resp[40:]))
+	// t4 - t1 使用单调时钟计算, 避免采集期间本地时钟被调整的影响
+	elapsed := t4.Sub(t1)
+	rtt := elapsed - t3.Sub(t2)
+	if rtt < 0 {
+		rtt = 0
+	}
+	// 服务器时间减去本地时间为 ((t2 - t1) + (t3 - t4)) / 2, 取反即为本地时钟的偏移
+	t1 = t1.Round(0)
+	t4 = t1.Add(elapsed)
+	serverOffset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	return &ntpResponse{
+		offset:         -serverOffset,
+		rtt:            rtt,
+		stratum:        stratum,
+		leap:           resp[0] >> 6,
+		rootDelay:      fromNtpShort(binary.BigEndian.Uint32(resp[4:])),
+		rootDispersion: fromNtpShort(binary.BigEndian.Uint32(resp[8:])),
+	}, nil
+}
+
+// parseChronyTracking 解析 chronyc -c tracking 的输出, 如
+// A29FC87B,162.159.200.123,3,1697000000.123456789,-0.000012345,0.000023456,0.000034567,-12.345,0.001,0.050,0.012345,0.001234,64.2,Normal
+// 字段依次为 Ref ID, 参考服务器, Stratum, Ref time, System time(s, 正数表示本地时钟偏慢), Last offset, RMS offset,
+// Frequency(ppm, 正数表示本地时钟偏慢), Residual freq, Skew, Root delay, Root dispersion, Update interval, Leap status
+func parseChronyTracking(out []byte) (map[string]interface{}, error) {
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) < 14 {
+		return nil, fmt.Errorf("unexpected chronyc tracking output %q", string(out))
+	}
+	stratum, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse chronyc stratum %q error %v", fields[2], err)
+	}
+	values := make(map[int]float64)
+	for _, i := range []int{4, 7, 10, 11} {
+		if values[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, fmt.Errorf("parse chronyc tracking field %q error %v", fields[i], err)
+		}
+	}
+	var leap int64
+	switch fields[13] {
+	case "Normal":
+		leap = 0
+	case "Insert second":
+		leap = 1
+	case "Delete second":
+		leap = 2
+	default:
+		leap = 3
+	}
+	return map[string]interface{}{
+		KeyNtpServer:         fields[1],
+		KeyNtpSource:         SourceChrony,
+		KeyNtpOffset:         -values[4] * 1000,
+		KeyNtpStratum:        stratum,
+		KeyNtpLeap:           leap,
+		KeyNtpRootDelay:      values[10] * 1000,
+		KeyNtpRootDispersion: values[11] * 1000,
+		KeyNtpDrift:          -values[7],
+	}, nil
+}
+
+// parseNtpqReadvar 解析 ntpq -c "rv 0 ..." 的输出, 如
+// offset=-0.123, frequency=-12.345, stratum=2, leap=00, rootdelay=1.234, rootdisp=20.5, refid=10.0.0.1
+// ntpd 的 offset(ms) 为服务器时间减去本地时间, frequency(ppm) 为频率修正值, 正数表示本地时钟偏慢
+func parseNtpqReadvar(out []byte) (map[string]interface{}, error) {
+	vars := make(map[string]string)
+	for _, item := range strings.Split(string(out), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) == 2 {
+			vars[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if _, ok := vars["offset"]; !ok {
+		return nil, fmt.Errorf("unexpected ntpq output %q", string(out))
+	}
+	data := map[string]interface{}{
+		KeyNtpServer: vars["refid"],
+		KeyNtpSource: SourceNtpd,
+	}
+	for key, field := range map[string]string{
+		"offset":    KeyNtpOffset,
+		"frequency": KeyNtpDrift,
+		"rootdelay": KeyNtpRootDelay,
+		"rootdisp":  KeyNtpRootDispersion,
+	} {
+		value, ok := vars[key]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse ntpq %v %q error %v", key, value, err)
+		}
+		if key == "offset" || key == "frequency" {
+			f = -f
+		}
+		data[field] = f
+	}
+	if value, ok := vars["stratum"]; ok {
+		stratum, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse ntpq stratum %q error %v", value, err)
+		}
+		data[KeyNtpStratum] = stratum
+	}
+	if value, ok := vars["leap"]; ok {
+		leap, err := strconv.ParseInt(value, 2, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse ntpq leap %q error %v", value, err)
+		}
+		data[KeyNtpLeap] = leap
+	}
+	return data, nil
+}
+
+func init() {
+	metric.Add(TypeMetricNtp, func() metric.Collector {
+		return &NtpStats{}
+	})
+}
@@ -0,0 +1,149 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer 启动一个时钟比本地快 skew 的 NTP 服务器
+func startServer(t *testing.T, skew time.Duration, stratum byte) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, ntpPacketSize)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, ntpPacketSize)
+			// LI = 0, VN = 4, Mode = 4(server)
+			resp[0] = 0x24
+			resp[1] = stratum
+			copy(resp[12:16], "RATE")
+			binary.BigEndian.PutUint32(resp[4:], 1<<15)
+			binary.BigEndian.PutUint32(resp[8:], 1<<14)
+			copy(resp[24:32], buf[40:48])
+			now := time.Now().Add(skew)
+			binary.BigEndian.PutUint64(resp[32:], toNtpTime(now))
+			binary.BigEndian.PutUint64(resp[40:], toNtpTime(now))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn
+}
+
+func TestNtpTime(t *testing.T) {
+	now := time.Unix(1500000000, 123456789)
+	got := fromNtpTime(toNtpTime(now))
+	assert.True(t, got.Sub(now) < time.Microsecond && now.Sub(got) < time.Microsecond)
+	assert.Equal(t, 1500*time.Millisecond, fromNtpShort(3<<15))
+}
+
+func TestQuery(t *testing.T) {
+	server := startServer(t, 2*time.Second, 2)
+	defer server.Close()
+	resp, err := query(server.LocalAddr().String(), time.Second)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(-2*time.Second), float64(resp.offset), float64(100*time.Millisecond))
+	assert.Equal(t, uint8(2), resp.stratum)
+	assert.Equal(t, uint8(0), resp.leap)
+	assert.Equal(t, 500*time.Millisecond, resp.rootDelay)
+	assert.Equal(t, 250*time.Millisecond, resp.rootDispersion)
+
+	kod := startServer(t, 0, 0)
+	defer kod.Close()
+	_, err = query(kod.LocalAddr().String(), time.Second)
+	assert.EqualError(t, err, `kiss of death received: "RATE"`)
+}
+
+func TestParseChronyTracking(t *testing.T) {
+	out := "A29FC87B,162.159.200.123,3,1697000000.123456789,-0.000012000,0.000023456,0.000034567,-12.500,0.001,0.050,0.012000,0.001500,64.2,Normal\n"
+	data, err := parseChronyTracking([]byte(out))
+	assert.NoError(t, err)
+	assert.Equal(t, "162.159.200.123", data[KeyNtpServer])
+	assert.Equal(t, SourceChrony, data[KeyNtpSource])
+	assert.InDelta(t, 0.012, data[KeyNtpOffset], 1e-9)
+	assert.Equal(t, int64(3), data[KeyNtpStratum])
+	assert.Equal(t, int64(0), data[KeyNtpLeap])
+	assert.InDelta(t, 12.0, data[KeyNtpRootDelay], 1e-9)
+	assert.InDelta(t, 1.5, data[KeyNtpRootDispersion], 1e-9)
+	assert.InDelta(t, 12.5, data[KeyNtpDrift], 1e-9)
+
+	out = "7F7F0101,,10,0.000000000,0.000000000,0.000000000,0.000000000,0.000,0.000,0.000,0.000000000,0.000000000,0.0,Not synchronised\n"
+	data, err = parseChronyTracking([]byte(out))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), data[KeyNtpLeap])
+
+	_, err = parseChronyTracking([]byte("506 Cannot talk to daemon"))
+	assert.Error(t, err)
+}
+
+func TestParseNtpqReadvar(t *testing.T) {
+	out := "offset=-0.123, frequency=-12.345, stratum=2, leap=00, rootdelay=1.234,\nrootdisp=20.5, refid=10.0.0.1\n"
+	data, err := parseNtpqReadvar([]byte(out))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		KeyNtpServer:         "10.0.0.1",
+		KeyNtpSource:         SourceNtpd,
+		KeyNtpOffset:         0.123,
+		KeyNtpDrift:          12.345,
+		KeyNtpStratum:        int64(2),
+		KeyNtpLeap:           int64(0),
+		KeyNtpRootDelay:      1.234,
+		KeyNtpRootDispersion: 20.5,
+	}, data)
+
+	_, err = parseNtpqReadvar([]byte("ntpq: read: Connection refused"))
+	assert.Error(t, err)
+}
+
+func TestNtpCollect(t *testing.T) {
+	server := startServer(t, -time.Second, 1)
+	defer server.Close()
+	addr := server.LocalAddr().String()
+	s := &NtpStats{
+		Servers:     addr + ",127.0.0.1:1",
+		LocalDaemon: LocalDaemonChrony,
+		Timeout:     "500ms",
+		run: func(name string, args ...string) ([]byte, error) {
+			assert.Equal(t, "chronyc", name)
+			return []byte("A29FC87B,162.159.200.123,3,1697000000.123456789,-0.000012000,0.000023456,0.000034567,-12.500,0.001,0.050,0.012000,0.001500,64.2,Normal\n"), nil
+		},
+	}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	// 127.0.0.1:1 没有响应, 不影响其他来源
+	assert.Len(t, datas, 2)
+	assert.Equal(t, addr, datas[0][KeyNtpServer])
+	assert.InDelta(t, 1000.0, datas[0][KeyNtpOffset], 100)
+	_, ok := datas[0][KeyNtpDrift]
+	assert.False(t, ok)
+	assert.Equal(t, SourceChrony, datas[1][KeyNtpSource])
+
+	datas, err = s.Collect()
+	assert.NoError(t, err)
+	_, ok = datas[0][KeyNtpDrift]
+	assert.True(t, ok)
+
+	s = &NtpStats{
+		Servers:     "",
+		LocalDaemon: LocalDaemonNtpd,
+		run: func(name string, args ...string) ([]byte, error) {
+			return nil, errors.New("exec: \"ntpq\": executable file not found in $PATH")
+		},
+	}
+	_, err = s.Collect()
+	assert.Error(t, err)
+
+	s = &NtpStats{LocalDaemon: LocalDaemonNone}
+	_, err = s.Collect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,397 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricProbe   = "probe"
+	MetricProbeUsages = "HTTP/TCP探测(probe)"
+
+	// Config 中的字段
+	ConfigTargets            = "targets"
+	ConfigExpectCodes        = "expect_codes"
+	ConfigExpectRegex        = "expect_regex"
+	ConfigInsecureSkipVerify = "insecure_skip_verify"
+	ConfigTimeout            = "timeout"
+
+	DefaultTimeout = 10 * time.Second
+	maxBodySize    = 1 << 20
+
+	ProbeTypeHTTP = "http"
+	ProbeTypeTCP  = "tcp"
+	ProbeTypeTLS  = "tls"
+
+	// TypeMetricProbe 信息中的字段, 每个探测目标一条数据
+	KeyProbeTarget         = "probe_target"
+	KeyProbeType           = "probe_type"
+	KeyProbeSuccess        = "probe_success"
+	KeyProbeError          = "probe_error"
+	KeyProbeStatusCode     = "probe_status_code"
+	KeyProbeDuration       = "probe_duration_ms"
+	KeyProbeDNS            = "probe_dns_ms"
+	KeyProbeConnect        = "probe_connect_ms"
+	KeyProbeTLS            = "probe_tls_ms"
+	KeyProbeFirstByte      = "probe_first_byte_ms"
+	KeyProbeContentMatch   = "probe_content_match"
+	KeyProbeCertExpiryDays = "probe_cert_expiry_days"
+)
+
+// KeyProbeUsages TypeMetricProbe 中的字段名称
+var KeyProbeUsages = []KeyValue{
+	{KeyProbeTarget, "探测目标"},
+	{KeyProbeType, "探测类型(http/tcp/tls)"},
+	{KeyProbeSuccess, "是否成功(1/0)"},
+	{KeyProbeError, "失败原因"},
+	{KeyProbeStatusCode, "HTTP状态码"},
+	{KeyProbeDuration, "总耗时(毫秒)"},
+	{KeyProbeDNS, "DNS解析耗时(毫秒)"},
+	{KeyProbeConnect, "建立连接耗时(毫秒)"},
+	{KeyProbeTLS, "TLS握手耗时(毫秒)"},
+	{KeyProbeFirstByte, "收到首字节的耗时(毫秒)"},
+	{KeyProbeContentMatch, "响应内容是否匹配(1/0)"},
+	{KeyProbeCertExpiryDays, "证书距过期的天数"},
+}
+
+// ConfigProbeUsages TypeMetricProbe config 中的字段描述
+var ConfigProbeUsages = []KeyValue{
+	{ConfigTargets, "探测目标, 如 https://example.com/health, tcp://127.0.0.1:3306, tls://example.com:443, 逗号分隔多个(" + ConfigTargets + ")"},
+	{ConfigExpectCodes, "HTTP探测期望的状态码, 逗号分隔多个, 为空时2xx和3xx都视为成功(" + ConfigExpectCodes + ")"},
+	{ConfigExpectRegex, "HTTP响应内容需要匹配的正则表达式(" + ConfigExpectRegex + ")"},
+	{ConfigInsecureSkipVerify, "是否跳过证书校验(" + ConfigInsecureSkipVerify + ")"},
+	{ConfigTimeout, "探测超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigTargets:            "",
+	ConfigExpectCodes:        "",
+	ConfigExpectRegex:        "",
+	ConfigInsecureSkipVerify: "false",
+	ConfigTimeout:            DefaultTimeout.String(),
+}
+
+// ProbeStats 探测 HTTP 地址和 TCP 端口, 收集可用性、各阶段的耗时以及证书的过期时间
+type ProbeStats struct {
+	Targets            string `json:"targets"`
+	ExpectCodes        string `json:"expect_codes"`
+	ExpectRegex        string `json:"expect_regex"`
+	InsecureSkipVerify string `json:"insecure_skip_verify"`
+	Timeout            string `json:"timeout"`
+
+	targets     []string
+	expectCodes map[int]bool
+	expectRegex *regexp.Regexp
+	timeout     time.Duration
+	tlsConfig   *tls.Config
+}
+
+func (_ *ProbeStats) Name() string {
+	return TypeMetricProbe
+}
+
+func (_ *ProbeStats) Usages() string {
+	return MetricProbeUsages
+}
+
+func (_ *ProbeStats) Tags() []string {
+	return []string{KeyProbeTarget, KeyProbeType}
+}
+
+func (_ *ProbeStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigProbeUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		switch val.Key {
+		case ConfigTargets:
+			option.Required = true
+			option.DefaultNoUse = true
+		case ConfigInsecureSkipVerify:
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{"false", "true"}
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyProbeUsages,
+	}
+	return config
+}
+
+func (s *ProbeStats) init() error {
+	s.timeout = DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if s.timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricProbe, s.Timeout, err)
+		}
+	}
+	targets := make([]string, 0)
+	for _, target := range strings.Split(s.Targets, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("metric %v %v is empty", TypeMetricProbe, ConfigTargets)
+	}
+	expectCodes := make(map[int]bool)
+	for _, code := range strings.Split(s.ExpectCodes, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			return fmt.Errorf("metric %v invalid expect code %v", TypeMetricProbe, code)
+		}
+		expectCodes[c] = true
+	}
+	if s.ExpectRegex != "" {
+		re, err := regexp.Compile(s.ExpectRegex)
+		if err != nil {
+			return fmt.Errorf("metric %v compile expect regex error %v", TypeMetricProbe, err)
+		}
+		s.expectRegex = re
+	}
+	s.targets = targets
+	s.expectCodes = expectCodes
+	s.tlsConfig = &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify == "true"}
+	return nil
+}
+
+// Collect 探测失败不返回错误, 而是记录在 probe_success 和 probe_error 中
+func (s *ProbeStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.targets == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	datas = make([]map[string]interface{}, 0, len(s.targets))
+	for _, target := range s.targets {
+		var data map[string]interface{}
+		switch {
+		case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+			data = s.probeHTTP(target)
+		case strings.HasPrefix(target, "tls://"):
+			data = s.probeTCP(target, strings.TrimPrefix(target, "tls://"), true)
+		default:
+			data = s.probeTCP(target, strings.TrimPrefix(target, "tcp://"), false)
+		}
+		datas = append(datas, data)
+	}
+	return datas, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// result 设置探测结果, err 不为空时探测失败
+func result(data map[string]interface{}, start time.Time, err error) map[string]interface{} {
+	data[KeyProbeDuration] = milliseconds(time.Since(start))
+	if err != nil {
+		data[KeyProbeSuccess] = int64(0)
+		data[KeyProbeError] = err.Error()
+	} else {
+		data[KeyProbeSuccess] = int64(1)
+		data[KeyProbeError] = ""
+	}
+	return data
+}
+
+// certExpiryDays 返回证书链中最早过期的证书距过期的天数
+func certExpiryDays(certs []*x509.Certificate) (float64, bool) {
+	if len(certs) == 0 {
+		return 0, false
+	}
+	earliest := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return time.Until(earliest).Hours() / 24, true
+}
+
+func (s *ProbeStats) probeHTTP(target string) map[string]interface{} {
+	data := map[string]interface{}{
+		KeyProbeTarget: target,
+		KeyProbeType:   ProbeTypeHTTP,
+	}
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return result(data, start, err)
+	}
+	// 同时尝试多个地址时 trace 的回调可能并发调用, 耗时先记录在 timings 中
+	var mutex sync.Mutex
+	timings := make(map[string]float64)
+	since := func(key string, t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		mutex.Lock()
+		timings[key] = milliseconds(time.Since(t))
+		mutex.Unlock()
+	}
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { since(KeyProbeDNS, dnsStart) },
+		ConnectStart: func(string, string) {
+			mutex.Lock()
+			connectStart = time.Now()
+			mutex.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				mutex.Lock()
+				t := connectStart
+				mutex.Unlock()
+				since(KeyProbeConnect, t)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				since(KeyProbeTLS, tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() { since(KeyProbeFirstByte, start) },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	client := &http.Client{
+		// 每次探测都建立新的连接, 以便得到完整的耗时; 不跟随跳转, 3xx 的状态码直接作为结果
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   s.tlsConfig,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	mutex.Lock()
+	for k, v := range timings {
+		data[k] = v
+	}
+	mutex.Unlock()
+	if err != nil {
+		return result(data, start, err)
+	}
+	defer resp.Body.Close()
+	data[KeyProbeStatusCode] = int64(resp.StatusCode)
+	if resp.TLS != nil {
+		if days, ok := certExpiryDays(resp.TLS.PeerCertificates); ok {
+			data[KeyProbeCertExpiryDays] = days
+		}
+	}
+	if len(s.expectCodes) > 0 {
+		if !s.expectCodes[resp.StatusCode] {
+			err = fmt.Errorf("unexpected status code %v", resp.StatusCode)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		err = fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+	if s.expectRegex != nil {
+		body, rerr := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if rerr != nil {
+			return result(data, start, rerr)
+		}
+		if s.expectRegex.Match(body) {
+			data[KeyProbeContentMatch] = int64(1)
+		} else {
+			data[KeyProbeContentMatch] = int64(0)
+			if err == nil {
+				err = fmt.Errorf("content does not match %v", s.expectRegex)
+			}
+		}
+	}
+	return result(data, start, err)
+}
+
+func (s *ProbeStats) probeTCP(target, addr string, useTLS bool) map[string]interface{} {
+	data := map[string]interface{}{
+		KeyProbeTarget: target,
+		KeyProbeType:   ProbeTypeTCP,
+	}
+	if useTLS {
+		data[KeyProbeType] = ProbeTypeTLS
+	}
+	start := time.Now()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return result(data, start, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	ip := host
+	if net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return result(data, start, err)
+		}
+		data[KeyProbeDNS] = milliseconds(time.Since(start))
+		ip = ips[0]
+	}
+	connectStart := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		return result(data, start, err)
+	}
+	defer conn.Close()
+	data[KeyProbeConnect] = milliseconds(time.Since(connectStart))
+	if !useTLS {
+		return result(data, start, nil)
+	}
+
+	tlsConfig := s.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	tlsStart := time.Now()
+	if err = tlsConn.Handshake(); err != nil {
+		return result(data, start, err)
+	}
+	data[KeyProbeTLS] = milliseconds(time.Since(tlsStart))
+	if days, ok := certExpiryDays(tlsConn.ConnectionState().PeerCertificates); ok {
+		data[KeyProbeCertExpiryDays] = days
+	}
+	return result(data, start, nil)
+}
+
+func init() {
+	metric.Add(TypeMetricProbe, func() metric.Collector {
+		return &ProbeStats{}
+	})
+}
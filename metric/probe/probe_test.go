@@ -0,0 +1,110 @@
+package probe
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/redirect":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status":"error"}`))
+		}
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer tlsServer.Close()
+
+	s := &ProbeStats{
+		Targets:            strings.Join([]string{server.URL + "/health", server.URL + "/redirect", server.URL + "/error", tlsServer.URL}, ","),
+		InsecureSkipVerify: "true",
+	}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 4)
+	for i, code := range []int64{200, 302, 500, 200} {
+		assert.Equal(t, ProbeTypeHTTP, datas[i][KeyProbeType])
+		assert.Equal(t, code, datas[i][KeyProbeStatusCode])
+		assert.Contains(t, datas[i], KeyProbeConnect)
+		assert.Contains(t, datas[i], KeyProbeFirstByte)
+	}
+	assert.Equal(t, int64(1), datas[0][KeyProbeSuccess])
+	assert.Equal(t, int64(1), datas[1][KeyProbeSuccess])
+	assert.Equal(t, int64(0), datas[2][KeyProbeSuccess])
+	assert.Equal(t, "unexpected status code 500", datas[2][KeyProbeError])
+	assert.NotContains(t, datas[0], KeyProbeCertExpiryDays)
+	assert.Contains(t, datas[3], KeyProbeTLS)
+	assert.True(t, datas[3][KeyProbeCertExpiryDays].(float64) > 0)
+
+	s = &ProbeStats{
+		Targets:     server.URL + "/health," + server.URL + "/error",
+		ExpectCodes: "200, 500",
+		ExpectRegex: `"status":\s*"ok"`,
+	}
+	datas, err = s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), datas[0][KeyProbeSuccess])
+	assert.Equal(t, int64(1), datas[0][KeyProbeContentMatch])
+	assert.Equal(t, int64(0), datas[1][KeyProbeSuccess])
+	assert.Equal(t, int64(0), datas[1][KeyProbeContentMatch])
+	assert.Contains(t, datas[1][KeyProbeError], "content does not match")
+
+	// 默认校验证书
+	s = &ProbeStats{Targets: tlsServer.URL}
+	datas, err = s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), datas[0][KeyProbeSuccess])
+}
+
+func TestProbeTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	tlsAddr := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	s := &ProbeStats{
+		Targets:            "tcp://" + tlsAddr + "," + addr + ",tls://" + tlsAddr + ",localhost:abc",
+		InsecureSkipVerify: "true",
+		Timeout:            "2s",
+	}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 4)
+	assert.Equal(t, ProbeTypeTCP, datas[0][KeyProbeType])
+	assert.Equal(t, int64(1), datas[0][KeyProbeSuccess])
+	assert.Contains(t, datas[0], KeyProbeConnect)
+	assert.Equal(t, int64(0), datas[1][KeyProbeSuccess])
+	assert.NotEqual(t, "", datas[1][KeyProbeError])
+	assert.Equal(t, ProbeTypeTLS, datas[2][KeyProbeType])
+	assert.Equal(t, int64(1), datas[2][KeyProbeSuccess])
+	assert.True(t, datas[2][KeyProbeCertExpiryDays].(float64) > 0)
+	assert.Equal(t, int64(0), datas[3][KeyProbeSuccess])
+}
+
+func TestProbeConfigError(t *testing.T) {
+	for _, s := range []*ProbeStats{
+		{},
+		{Targets: "tcp://127.0.0.1:80", Timeout: "abc"},
+		{Targets: "tcp://127.0.0.1:80", ExpectCodes: "2xx"},
+		{Targets: "tcp://127.0.0.1:80", ExpectRegex: "("},
+	} {
+		_, err := s.Collect()
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,426 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricRedis   = "redis"
+	MetricRedisUsages = "Redis(redis)"
+
+	// Config 中的字段
+	ConfigServers            = "servers"
+	ConfigPassword           = "password"
+	ConfigCluster            = "cluster"
+	ConfigTLS                = "tls"
+	ConfigTLSCAPath          = "tls_ca_path"
+	ConfigInsecureSkipVerify = "insecure_skip_verify"
+	ConfigTimeout            = "timeout"
+
+	DefaultServer  = "127.0.0.1:6379"
+	DefaultTimeout = 5 * time.Second
+
+	// TypeMetricRedis 信息中的字段, 每个实例一条数据
+	// 除以下字段外, INFO 中所有数值类型的字段都会以 redis_<字段名> 的形式收集
+	KeyRedisServer            = "redis_server"
+	KeyRedisRole              = "redis_role"
+	KeyRedisUsedMemory        = "redis_used_memory"
+	KeyRedisOpsPerSec         = "redis_instantaneous_ops_per_sec"
+	KeyRedisConnected         = "redis_connected_clients"
+	KeyRedisKeyspaceHits      = "redis_keyspace_hits"
+	KeyRedisKeyspaceMisses    = "redis_keyspace_misses"
+	KeyRedisKeys              = "redis_keys"
+	KeyRedisExpires           = "redis_expires"
+	KeyRedisMasterLinkUp      = "redis_master_link_up"
+	KeyRedisMasterLastIO      = "redis_master_last_io_seconds_ago"
+	KeyRedisConnectedSlaves   = "redis_connected_slaves"
+	KeyRedisSlaveLagMax       = "redis_slave_lag_max"
+	KeyRedisSlaveOffsetLag    = "redis_slave_offset_lag_max"
+	KeyRedisClusterStateOK    = "redis_cluster_state_ok"
+	KeyRedisClusterSlotsOK    = "redis_cluster_slots_ok"
+	KeyRedisClusterSlotsFail  = "redis_cluster_slots_fail"
+	KeyRedisClusterKnownNodes = "redis_cluster_known_nodes"
+)
+
+// KeyRedisUsages TypeMetricRedis 中的字段名称
+var KeyRedisUsages = []KeyValue{
+	{KeyRedisServer, "实例地址"},
+	{KeyRedisRole, "角色(master/slave)"},
+	{KeyRedisUsedMemory, "使用的内存"},
+	{KeyRedisOpsPerSec, "每秒执行的命令数"},
+	{KeyRedisConnected, "客户端连接数"},
+	{KeyRedisKeyspaceHits, "累计命中次数"},
+	{KeyRedisKeyspaceMisses, "累计未命中次数"},
+	{KeyRedisKeys, "所有db的key数量"},
+	{KeyRedisExpires, "所有db设置了过期时间的key数量"},
+	{KeyRedisMasterLinkUp, "slave与master的连接是否正常(1/0)"},
+	{KeyRedisMasterLastIO, "slave距上次与master通信的秒数"},
+	{KeyRedisConnectedSlaves, "master连接的slave数"},
+	{KeyRedisSlaveLagMax, "master上所有slave的最大延迟(秒)"},
+	{KeyRedisSlaveOffsetLag, "master上所有slave的最大复制偏移量差距"},
+	{KeyRedisClusterStateOK, "集群状态是否正常(1/0)"},
+	{KeyRedisClusterSlotsOK, "集群正常的slot数"},
+	{KeyRedisClusterSlotsFail, "集群失败的slot数"},
+	{KeyRedisClusterKnownNodes, "集群节点数"},
+}
+
+// ConfigRedisUsages TypeMetricRedis config 中的字段描述
+var ConfigRedisUsages = []KeyValue{
+	{ConfigServers, "实例地址, 逗号分隔多个(" + ConfigServers + ")"},
+	{ConfigPassword, "密码(" + ConfigPassword + ")"},
+	{ConfigCluster, "是否为集群, 是则自动发现并收集所有节点(" + ConfigCluster + ")"},
+	{ConfigTLS, "是否使用TLS连接(" + ConfigTLS + ")"},
+	{ConfigTLSCAPath, "TLS证书的CA文件(" + ConfigTLSCAPath + ")"},
+	{ConfigInsecureSkipVerify, "是否跳过证书校验(" + ConfigInsecureSkipVerify + ")"},
+	{ConfigTimeout, "连接和读写超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigServers:            DefaultServer,
+	ConfigPassword:           "",
+	ConfigCluster:            "false",
+	ConfigTLS:                "false",
+	ConfigTLSCAPath:          "",
+	ConfigInsecureSkipVerify: "false",
+	ConfigTimeout:            DefaultTimeout.String(),
+}
+
+// 这些字段的值虽然是数字, 但不是指标
+var skipInfoFields = map[string]bool{
+	"redis_git_sha1":  true,
+	"redis_git_dirty": true,
+	"redis_build_id":  true,
+	"run_id":          true,
+	"master_replid":   true,
+	"master_replid2":  true,
+	"process_id":      true,
+	"tcp_port":        true,
+	"arch_bits":       true,
+	"master_port":     true,
+}
+
+// RedisStats 通过 INFO 和 CLUSTER INFO 收集一个或多个 Redis 实例的指标
+type RedisStats struct {
+	Servers            string `json:"servers"`
+	Password           string `json:"password"`
+	Cluster            string `json:"cluster"`
+	TLS                string `json:"tls"`
+	TLSCAPath          string `json:"tls_ca_path"`
+	InsecureSkipVerify string `json:"insecure_skip_verify"`
+	Timeout            string `json:"timeout"`
+
+	options *redis.Options
+	clients map[string]*redis.Client
+}
+
+func (_ *RedisStats) Name() string {
+	return TypeMetricRedis
+}
+
+func (_ *RedisStats) Usages() string {
+	return MetricRedisUsages
+}
+
+func (_ *RedisStats) Tags() []string {
+	return []string{KeyRedisServer, KeyRedisRole}
+}
+
+func (_ *RedisStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigRedisUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		switch val.Key {
+		case ConfigCluster, ConfigTLS, ConfigInsecureSkipVerify:
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{"false", "true"}
+		case ConfigPassword:
+			option.Secret = true
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeyRedisUsages,
+	}
+	return config
+}
+
+func (s *RedisStats) init() error {
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricRedis, s.Timeout, err)
+		}
+	}
+	opt := &redis.Options{
+		Password:     s.Password,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		PoolSize:     1,
+	}
+	if s.TLS == "true" {
+		opt.TLSConfig = &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify == "true"}
+		if s.TLSCAPath != "" {
+			ca, err := ioutil.ReadFile(s.TLSCAPath)
+			if err != nil {
+				return fmt.Errorf("metric %v read tls ca error %v", TypeMetricRedis, err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return fmt.Errorf("metric %v no certificate is found in %v", TypeMetricRedis, s.TLSCAPath)
+			}
+			opt.TLSConfig.RootCAs = pool
+		}
+	}
+	s.options = opt
+	s.clients = make(map[string]*redis.Client)
+	return nil
+}
+
+func (s *RedisStats) client(addr string) *redis.Client {
+	if c, ok := s.clients[addr]; ok {
+		return c
+	}
+	opt := *s.options
+	opt.Addr = addr
+	if opt.TLSConfig != nil {
+		opt.TLSConfig = opt.TLSConfig.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+			opt.TLSConfig.ServerName = host
+		}
+	}
+	c := redis.NewClient(&opt)
+	s.clients[addr] = c
+	return c
+}
+
+// addrs 返回需要收集的实例地址, 集群模式下通过 CLUSTER NODES 发现所有节点
+func (s *RedisStats) addrs() ([]string, error) {
+	servers := make([]string, 0)
+	for _, server := range strings.Split(s.Servers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		servers = []string{DefaultServer}
+	}
+	if s.Cluster != "true" {
+		return servers, nil
+	}
+	var lastErr error
+	for _, server := range servers {
+		nodes, err := s.client(server).ClusterNodes().Result()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return parseClusterNodes(nodes), nil
+	}
+	return nil, fmt.Errorf("discover cluster nodes from %v error %v", servers, lastErr)
+}
+
+// Collect 中某个实例收集失败只记录日志, 所有实例都失败时才返回错误
+func (s *RedisStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.options == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	addrs, err := s.addrs()
+	if err != nil {
+		return nil, fmt.Errorf("metric %v %v", TypeMetricRedis, err)
+	}
+	current := make(map[string]bool, len(addrs))
+	var lastErr error
+	for _, addr := range addrs {
+		current[addr] = true
+		data, err := s.collect(addr)
+		if err != nil {
+			log.Warnf("metric %v collect %v error %v", TypeMetricRedis, addr, err)
+			lastErr = err
+			continue
+		}
+		datas = append(datas, data)
+	}
+	// 集群中已经移除的节点不再收集
+	for addr, c := range s.clients {
+		if !current[addr] {
+			c.Close()
+			delete(s.clients, addr)
+		}
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricRedis, lastErr)
+	}
+	return datas, nil
+}
+
+func (s *RedisStats) collect(addr string) (map[string]interface{}, error) {
+	c := s.client(addr)
+	info, err := c.Info().Result()
+	if err != nil {
+		return nil, err
+	}
+	data := parseInfo(info)
+	data[KeyRedisServer] = addr
+	if s.Cluster == "true" {
+		clusterInfo, err := c.ClusterInfo().Result()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range parseInfo(clusterInfo) {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
+
+func parseNumber(value string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f, true
+	}
+	return nil, false
+}
+
+// parseKeyValues 解析 INFO 中 db0:keys=1,expires=0 和 slave0:ip=...,lag=0 格式的值
+func parseKeyValues(value string) map[string]string {
+	ret := make(map[string]string)
+	for _, kv := range strings.Split(value, ",") {
+		if idx := strings.Index(kv, "="); idx > 0 {
+			ret[kv[:idx]] = kv[idx+1:]
+		}
+	}
+	return ret
+}
+
+// parseInfo 解析 INFO 和 CLUSTER INFO 的输出, 数值类型的字段以 redis_ 为前缀,
+// keyspace 汇总所有 db, master 上取所有 slave 中最大的延迟
+func parseInfo(info string) map[string]interface{} {
+	data := make(map[string]interface{})
+	var keys, expires int64
+	var hasKeyspace bool
+	var masterOffset, minSlaveOffset int64 = 0, -1
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		key, value := line[:idx], line[idx+1:]
+		switch {
+		case key == "role":
+			data[KeyRedisRole] = value
+		case key == "master_link_status":
+			data[KeyRedisMasterLinkUp] = boolToInt(value == "up")
+		case key == "cluster_state":
+			data[KeyRedisClusterStateOK] = boolToInt(value == "ok")
+		case strings.HasPrefix(key, "db") && strings.Contains(value, "keys="):
+			kvs := parseKeyValues(value)
+			k, _ := strconv.ParseInt(kvs["keys"], 10, 64)
+			e, _ := strconv.ParseInt(kvs["expires"], 10, 64)
+			keys += k
+			expires += e
+			hasKeyspace = true
+		case strings.HasPrefix(key, "slave") && strings.Contains(value, "offset="):
+			kvs := parseKeyValues(value)
+			if lag, err := strconv.ParseInt(kvs["lag"], 10, 64); err == nil {
+				if max, ok := data[KeyRedisSlaveLagMax].(int64); !ok || lag > max {
+					data[KeyRedisSlaveLagMax] = lag
+				}
+			}
+			if offset, err := strconv.ParseInt(kvs["offset"], 10, 64); err == nil {
+				if minSlaveOffset < 0 || offset < minSlaveOffset {
+					minSlaveOffset = offset
+				}
+			}
+		default:
+			if skipInfoFields[key] {
+				continue
+			}
+			if v, ok := parseNumber(value); ok {
+				if key == "master_repl_offset" {
+					masterOffset, _ = v.(int64)
+				}
+				data["redis_"+key] = v
+			}
+		}
+	}
+	if hasKeyspace || data[KeyRedisRole] != nil {
+		data[KeyRedisKeys] = keys
+		data[KeyRedisExpires] = expires
+	}
+	if minSlaveOffset >= 0 {
+		data[KeyRedisSlaveOffsetLag] = masterOffset - minSlaveOffset
+	}
+	return data
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseClusterNodes 解析 CLUSTER NODES 的输出, 返回所有可以连接的节点地址, 每行的格式为
+// <id> <ip:port@cport[,hostname]> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func parseClusterNodes(nodes string) []string {
+	addrs := make([]string, 0)
+	for _, line := range strings.Split(nodes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		flags := fields[2]
+		if strings.Contains(flags, "noaddr") || strings.Contains(flags, "handshake") {
+			continue
+		}
+		addr := fields[1]
+		if idx := strings.IndexAny(addr, "@,"); idx >= 0 {
+			addr = addr[:idx]
+		}
+		if addr == "" || strings.HasPrefix(addr, ":") {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func init() {
+	metric.Add(TypeMetricRedis, func() metric.Collector {
+		return &RedisStats{}
+	})
+}
@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const masterInfo = `# Server
+redis_version:4.0.9
+redis_git_sha1:00000000
+run_id:1b4c9a5e3d2f
+tcp_port:6379
+uptime_in_seconds:3600
+
+# Clients
+connected_clients:10
+
+# Memory
+used_memory:1048576
+used_memory_human:1.00M
+mem_fragmentation_ratio:1.25
+
+# Stats
+instantaneous_ops_per_sec:120
+keyspace_hits:90
+keyspace_misses:10
+
+# Replication
+role:master
+connected_slaves:2
+slave0:ip=10.0.0.2,port=6379,state=online,offset=1000,lag=0
+slave1:ip=10.0.0.3,port=6379,state=online,offset=900,lag=2
+master_replid:8f2d7d1c6a0b
+master_repl_offset:1024
+
+# Keyspace
+db0:keys=100,expires=10,avg_ttl=0
+db1:keys=5,expires=0,avg_ttl=0
+`
+
+const slaveInfo = `# Replication
+role:slave
+master_host:10.0.0.1
+master_port:6379
+master_link_status:down
+master_last_io_seconds_ago:-1
+slave_repl_offset:1000
+`
+
+const clusterInfo = `cluster_state:fail
+cluster_slots_assigned:16384
+cluster_slots_ok:16000
+cluster_slots_pfail:0
+cluster_slots_fail:384
+cluster_known_nodes:6
+`
+
+func TestParseInfo(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		"redis_uptime_in_seconds":       int64(3600),
+		KeyRedisConnected:               int64(10),
+		KeyRedisUsedMemory:              int64(1048576),
+		"redis_mem_fragmentation_ratio": 1.25,
+		KeyRedisOpsPerSec:               int64(120),
+		KeyRedisKeyspaceHits:            int64(90),
+		KeyRedisKeyspaceMisses:          int64(10),
+		KeyRedisRole:                    "master",
+		KeyRedisConnectedSlaves:         int64(2),
+		KeyRedisSlaveLagMax:             int64(2),
+		"redis_master_repl_offset":      int64(1024),
+		KeyRedisSlaveOffsetLag:          int64(124),
+		KeyRedisKeys:                    int64(105),
+		KeyRedisExpires:                 int64(10),
+	}, parseInfo(masterInfo))
+
+	assert.Equal(t, map[string]interface{}{
+		KeyRedisRole:              "slave",
+		KeyRedisMasterLinkUp:      int64(0),
+		KeyRedisMasterLastIO:      int64(-1),
+		"redis_slave_repl_offset": int64(1000),
+		KeyRedisKeys:              int64(0),
+		KeyRedisExpires:           int64(0),
+	}, parseInfo(slaveInfo))
+
+	assert.Equal(t, map[string]interface{}{
+		KeyRedisClusterStateOK:         int64(0),
+		"redis_cluster_slots_assigned": int64(16384),
+		KeyRedisClusterSlotsOK:         int64(16000),
+		"redis_cluster_slots_pfail":    int64(0),
+		KeyRedisClusterSlotsFail:       int64(384),
+		KeyRedisClusterKnownNodes:      int64(6),
+	}, parseInfo(clusterInfo))
+}
+
+func TestParseClusterNodes(t *testing.T) {
+	nodes := `07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004,host4 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002 master - 0 1426238316232 2 connected 5461-10922
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460
+6ec23923021cf3ffec47632106199cb7f496ce01 :0@0 master,noaddr - 1426238316232 1426238316232 5 disconnected
+`
+	assert.Equal(t, []string{"127.0.0.1:30004", "127.0.0.1:30002", "127.0.0.1:30001"}, parseClusterNodes(nodes))
+}
+
+func TestRedisCollectError(t *testing.T) {
+	c := &RedisStats{Servers: "127.0.0.1:1", Timeout: "100ms"}
+	_, err := c.Collect()
+	assert.Error(t, err)
+	c = &RedisStats{Servers: "127.0.0.1:1", Cluster: "true", Timeout: "100ms"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &RedisStats{Timeout: "abc"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+	c = &RedisStats{TLS: "true", TLSCAPath: "not_exist"}
+	_, err = c.Collect()
+	assert.Error(t, err)
+}
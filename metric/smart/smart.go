@@ -0,0 +1,338 @@
+package smart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricSmart   = "smart"
+	MetricSmartUsages = "磁盘健康(smart)"
+
+	// Config 中的字段
+	ConfigSmartctlPath = "smartctl_path"
+	ConfigDevices      = "devices"
+	ConfigUseSudo      = "use_sudo"
+	ConfigTimeout      = "timeout"
+
+	DefaultSmartctlPath = "smartctl"
+	DefaultTimeout      = 10 * time.Second
+
+	// TypeMetricSmart 信息中的字段, 每块磁盘一条数据, 磁盘不支持的字段不会出现
+	KeySmartDevice             = "smart_device"
+	KeySmartModel              = "smart_model"
+	KeySmartSerial             = "smart_serial"
+	KeySmartHealthOK           = "smart_health_ok"
+	KeySmartExitStatus         = "smart_exit_status"
+	KeySmartTemperature        = "smart_temperature"
+	KeySmartPowerOnHours       = "smart_power_on_hours"
+	KeySmartReallocatedSectors = "smart_reallocated_sectors"
+	KeySmartPendingSectors     = "smart_pending_sectors"
+	KeySmartUncorrectable      = "smart_offline_uncorrectable"
+	KeySmartWearLeveling       = "smart_wear_leveling"
+	KeySmartPercentageUsed     = "smart_percentage_used"
+	KeySmartAvailableSpare     = "smart_available_spare"
+	KeySmartMediaErrors        = "smart_media_errors"
+)
+
+// ATA 属性的 id
+const (
+	ataReallocatedSectors = 5
+	ataWearLeveling       = 177
+	ataPendingSectors     = 197
+	ataUncorrectable      = 198
+)
+
+// KeySmartUsages TypeMetricSmart 中的字段名称
+var KeySmartUsages = []KeyValue{
+	{KeySmartDevice, "设备名称"},
+	{KeySmartModel, "磁盘型号"},
+	{KeySmartSerial, "磁盘序列号"},
+	{KeySmartHealthOK, "整体健康状态是否正常(1/0)"},
+	{KeySmartExitStatus, "smartctl的退出状态, 非0表示有异常"},
+	{KeySmartTemperature, "温度(摄氏度)"},
+	{KeySmartPowerOnHours, "通电时间(小时)"},
+	{KeySmartReallocatedSectors, "重映射扇区数"},
+	{KeySmartPendingSectors, "待映射扇区数"},
+	{KeySmartUncorrectable, "无法校正的扇区数"},
+	{KeySmartWearLeveling, "SSD磨损均衡剩余寿命(ATA, 归一化值)"},
+	{KeySmartPercentageUsed, "SSD已使用的寿命百分比(NVMe)"},
+	{KeySmartAvailableSpare, "剩余备用空间百分比(NVMe)"},
+	{KeySmartMediaErrors, "介质错误数(NVMe)"},
+}
+
+// ConfigSmartUsages TypeMetricSmart config 中的字段描述
+var ConfigSmartUsages = []KeyValue{
+	{ConfigSmartctlPath, "smartctl路径, 需要7.0及以上版本(" + ConfigSmartctlPath + ")"},
+	{ConfigDevices, "磁盘设备, 逗号分隔多个, 为空时通过smartctl --scan自动发现(" + ConfigDevices + ")"},
+	{ConfigUseSudo, "是否通过sudo执行smartctl(" + ConfigUseSudo + ")"},
+	{ConfigTimeout, "每次执行smartctl的超时时间(" + ConfigTimeout + ")"},
+}
+
+var configDefaults = map[string]string{
+	ConfigSmartctlPath: DefaultSmartctlPath,
+	ConfigDevices:      "",
+	ConfigUseSudo:      "false",
+	ConfigTimeout:      DefaultTimeout.String(),
+}
+
+// SmartStats 通过 smartctl 的 JSON 输出收集磁盘的 S.M.A.R.T. 健康信息
+type SmartStats struct {
+	SmartctlPath string `json:"smartctl_path"`
+	Devices      string `json:"devices"`
+	UseSudo      string `json:"use_sudo"`
+	Timeout      string `json:"timeout"`
+
+	// run 执行 smartctl 并返回标准输出, 测试时替换
+	run func(args ...string) ([]byte, error)
+}
+
+func (_ *SmartStats) Name() string {
+	return TypeMetricSmart
+}
+
+func (_ *SmartStats) Usages() string {
+	return MetricSmartUsages
+}
+
+func (_ *SmartStats) Tags() []string {
+	return []string{KeySmartDevice, KeySmartModel, KeySmartSerial}
+}
+
+func (_ *SmartStats) Config() map[string]interface{} {
+	configOptions := make([]Option, 0)
+	for _, val := range ConfigSmartUsages {
+		option := Option{
+			KeyName:      val.Key,
+			ChooseOnly:   false,
+			Default:      configDefaults[val.Key],
+			DefaultNoUse: false,
+			Description:  val.Value,
+			Type:         metric.ConsifTypeString,
+		}
+		if val.Key == ConfigUseSudo {
+			option.Element = Radio
+			option.ChooseOnly = true
+			option.ChooseOptions = []interface{}{"false", "true"}
+		}
+		configOptions = append(configOptions, option)
+	}
+	config := map[string]interface{}{
+		metric.OptionString:     configOptions,
+		metric.AttributesString: KeySmartUsages,
+	}
+	return config
+}
+
+func (s *SmartStats) init() error {
+	timeout := DefaultTimeout
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("metric %v parse timeout %v error %v", TypeMetricSmart, s.Timeout, err)
+		}
+	}
+	path := s.SmartctlPath
+	if path == "" {
+		path = DefaultSmartctlPath
+	}
+	useSudo := s.UseSudo == "true"
+	s.run = func(args ...string) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var cmd *exec.Cmd
+		if useSudo {
+			cmd = exec.CommandContext(ctx, "sudo", append([]string{"-n", path}, args...)...)
+		} else {
+			cmd = exec.CommandContext(ctx, path, args...)
+		}
+		return cmd.Output()
+	}
+	return nil
+}
+
+// smartctl 的退出状态是按位的, 有告警时也不为 0, 只要输出了 JSON 就可以解析
+func (s *SmartStats) smartctl(args ...string) ([]byte, int, error) {
+	out, err := s.run(args...)
+	exitStatus := 0
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || len(out) == 0 {
+			return nil, 0, err
+		}
+		exitStatus = exitErr.ExitCode()
+	}
+	return out, exitStatus, nil
+}
+
+type scanResult struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+}
+
+// devices 返回配置的设备, 没有配置时通过 smartctl --scan 发现
+func (s *SmartStats) devices() ([][]string, error) {
+	devices := make([][]string, 0)
+	for _, device := range strings.Split(s.Devices, ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, []string{device})
+		}
+	}
+	if len(devices) > 0 {
+		return devices, nil
+	}
+	out, _, err := s.smartctl("--scan", "--json")
+	if err != nil {
+		return nil, err
+	}
+	var scan scanResult
+	if err = json.Unmarshal(out, &scan); err != nil {
+		return nil, fmt.Errorf("decode smartctl --scan output error %v", err)
+	}
+	for _, d := range scan.Devices {
+		device := []string{d.Name}
+		if d.Type != "" {
+			device = append(device, "-d", d.Type)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// Collect 中某块磁盘收集失败只记录日志, 所有磁盘都失败时才返回错误
+func (s *SmartStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.run == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	devices, err := s.devices()
+	if err != nil {
+		return nil, fmt.Errorf("metric %v find devices error %v", TypeMetricSmart, err)
+	}
+	var lastErr error
+	for _, device := range devices {
+		args := append([]string{"--json", "--info", "--health", "--attributes"}, device[1:]...)
+		out, exitStatus, err := s.smartctl(append(args, device[0])...)
+		if err == nil {
+			var data map[string]interface{}
+			if data, err = parseSmartctl(out); err == nil {
+				data[KeySmartDevice] = device[0]
+				data[KeySmartExitStatus] = int64(exitStatus)
+				datas = append(datas, data)
+				continue
+			}
+		}
+		log.Warnf("metric %v collect %v error %v", TypeMetricSmart, device[0], err)
+		lastErr = err
+	}
+	if len(datas) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("metric %v collect error %v", TypeMetricSmart, lastErr)
+	}
+	return datas, nil
+}
+
+// smartctlOutput 是 smartctl --json 的输出, 只包含需要的字段
+type smartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	AtaSmartAttributes *struct {
+		Table []struct {
+			ID    int   `json:"id"`
+			Value int64 `json:"value"`
+			Raw   struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NvmeHealth *struct {
+		PercentageUsed int64 `json:"percentage_used"`
+		AvailableSpare int64 `json:"available_spare"`
+		MediaErrors    int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+func parseSmartctl(out []byte) (map[string]interface{}, error) {
+	var o smartctlOutput
+	if err := json.Unmarshal(out, &o); err != nil {
+		return nil, fmt.Errorf("decode smartctl output error %v", err)
+	}
+	if o.SmartStatus == nil && o.ModelName == "" && o.SerialNumber == "" {
+		// 设备不存在或者没有权限时 smartctl 只输出错误信息
+		for _, msg := range o.Smartctl.Messages {
+			if msg.Severity == "error" {
+				return nil, fmt.Errorf("smartctl: %v", msg.String)
+			}
+		}
+		return nil, fmt.Errorf("smartctl returns no smart data")
+	}
+	data := map[string]interface{}{
+		KeySmartModel:  o.ModelName,
+		KeySmartSerial: o.SerialNumber,
+	}
+	if o.SmartStatus != nil {
+		if o.SmartStatus.Passed {
+			data[KeySmartHealthOK] = int64(1)
+		} else {
+			data[KeySmartHealthOK] = int64(0)
+		}
+	}
+	if o.Temperature != nil {
+		data[KeySmartTemperature] = o.Temperature.Current
+	}
+	if o.PowerOnTime != nil {
+		data[KeySmartPowerOnHours] = o.PowerOnTime.Hours
+	}
+	if o.AtaSmartAttributes != nil {
+		for _, attr := range o.AtaSmartAttributes.Table {
+			switch attr.ID {
+			case ataReallocatedSectors:
+				data[KeySmartReallocatedSectors] = attr.Raw.Value
+			case ataPendingSectors:
+				data[KeySmartPendingSectors] = attr.Raw.Value
+			case ataUncorrectable:
+				data[KeySmartUncorrectable] = attr.Raw.Value
+			case ataWearLeveling:
+				data[KeySmartWearLeveling] = attr.Value
+			}
+		}
+	}
+	if o.NvmeHealth != nil {
+		data[KeySmartPercentageUsed] = o.NvmeHealth.PercentageUsed
+		data[KeySmartAvailableSpare] = o.NvmeHealth.AvailableSpare
+		data[KeySmartMediaErrors] = o.NvmeHealth.MediaErrors
+	}
+	return data, nil
+}
+
+func init() {
+	metric.Add(TypeMetricSmart, func() metric.Collector {
+		return &SmartStats{}
+	})
+}
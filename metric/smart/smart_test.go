@@ -0,0 +1,143 @@
+package smart
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const scanOutput = `{
+  "devices": [
+    {"name": "/dev/sda", "info_name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+    {"name": "/dev/nvme0", "info_name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"}
+  ]
+}`
+
+const ataOutput = `{
+  "smartctl": {"version": [7, 1], "exit_status": 0},
+  "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+  "model_name": "Samsung SSD 860 EVO 500GB",
+  "serial_number": "S3Z1NB0K123456",
+  "smart_status": {"passed": true},
+  "ata_smart_attributes": {
+    "revision": 1,
+    "table": [
+      {"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "worst": 100, "thresh": 10, "raw": {"value": 3, "string": "3"}},
+      {"id": 9, "name": "Power_On_Hours", "value": 95, "worst": 95, "thresh": 0, "raw": {"value": 20123, "string": "20123"}},
+      {"id": 177, "name": "Wear_Leveling_Count", "value": 97, "worst": 97, "thresh": 0, "raw": {"value": 31, "string": "31"}},
+      {"id": 197, "name": "Current_Pending_Sector", "value": 100, "worst": 100, "thresh": 0, "raw": {"value": 1, "string": "1"}},
+      {"id": 198, "name": "Offline_Uncorrectable", "value": 100, "worst": 100, "thresh": 0, "raw": {"value": 0, "string": "0"}}
+    ]
+  },
+  "power_on_time": {"hours": 20123},
+  "temperature": {"current": 34}
+}`
+
+const nvmeOutput = `{
+  "smartctl": {"version": [7, 1], "exit_status": 0},
+  "device": {"name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"},
+  "model_name": "INTEL SSDPE2KX010T8",
+  "serial_number": "PHLJ000000001P0DGN",
+  "smart_status": {"passed": false},
+  "nvme_smart_health_information_log": {
+    "critical_warning": 0,
+    "temperature": 41,
+    "available_spare": 98,
+    "percentage_used": 12,
+    "media_errors": 2
+  },
+  "power_on_time": {"hours": 8000},
+  "temperature": {"current": 41}
+}`
+
+const openFailedOutput = `{
+  "smartctl": {
+    "version": [7, 1],
+    "messages": [{"string": "Smartctl open device: /dev/sdz failed: No such device", "severity": "error"}],
+    "exit_status": 2
+  },
+  "device": {"name": "/dev/sdz", "type": "scsi"}
+}`
+
+func TestParseSmartctl(t *testing.T) {
+	data, err := parseSmartctl([]byte(ataOutput))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		KeySmartModel:              "Samsung SSD 860 EVO 500GB",
+		KeySmartSerial:             "S3Z1NB0K123456",
+		KeySmartHealthOK:           int64(1),
+		KeySmartTemperature:        int64(34),
+		KeySmartPowerOnHours:       int64(20123),
+		KeySmartReallocatedSectors: int64(3),
+		KeySmartPendingSectors:     int64(1),
+		KeySmartUncorrectable:      int64(0),
+		KeySmartWearLeveling:       int64(97),
+	}, data)
+
+	data, err = parseSmartctl([]byte(nvmeOutput))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		KeySmartModel:          "INTEL SSDPE2KX010T8",
+		KeySmartSerial:         "PHLJ000000001P0DGN",
+		KeySmartHealthOK:       int64(0),
+		KeySmartTemperature:    int64(41),
+		KeySmartPowerOnHours:   int64(8000),
+		KeySmartPercentageUsed: int64(12),
+		KeySmartAvailableSpare: int64(98),
+		KeySmartMediaErrors:    int64(2),
+	}, data)
+
+	_, err = parseSmartctl([]byte(openFailedOutput))
+	assert.EqualError(t, err, "smartctl: Smartctl open device: /dev/sdz failed: No such device")
+
+	_, err = parseSmartctl([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestSmartCollect(t *testing.T) {
+	var calls []string
+	s := &SmartStats{
+		run: func(args ...string) ([]byte, error) {
+			calls = append(calls, strings.Join(args, " "))
+			switch args[len(args)-1] {
+			case "--json":
+				return []byte(scanOutput), nil
+			case "/dev/sda":
+				return []byte(ataOutput), nil
+			case "/dev/nvme0":
+				return []byte(nvmeOutput), nil
+			}
+			return nil, errors.New("unexpected args")
+		},
+	}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--scan --json",
+		"--json --info --health --attributes -d sat /dev/sda",
+		"--json --info --health --attributes -d nvme /dev/nvme0",
+	}, calls)
+	assert.Len(t, datas, 2)
+	assert.Equal(t, "/dev/sda", datas[0][KeySmartDevice])
+	assert.Equal(t, int64(0), datas[0][KeySmartExitStatus])
+	assert.Equal(t, "/dev/nvme0", datas[1][KeySmartDevice])
+	assert.Equal(t, int64(0), datas[1][KeySmartHealthOK])
+
+	// 配置了设备时不做扫描, 部分设备失败不影响其他设备
+	calls = nil
+	s.Devices = "/dev/sda, /dev/sdz"
+	datas, err = s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--json --info --health --attributes /dev/sda",
+		"--json --info --health --attributes /dev/sdz",
+	}, calls)
+	assert.Len(t, datas, 1)
+	assert.Equal(t, "/dev/sda", datas[0][KeySmartDevice])
+
+	s.Devices = "/dev/sdz"
+	_, err = s.Collect()
+	assert.Error(t, err)
+}
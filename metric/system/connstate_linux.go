@@ -0,0 +1,308 @@
+// +build linux
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricConnState   = "connstate"
+	MetricConnStateUsages = "TCP连接状态及conntrack(connstate)"
+
+	// Config 中的字段
+	ConfigConnStateProcPath    = "proc_path"
+	ConfigConnStateListenPorts = "listen_ports"
+
+	DefaultConnStateProcPath = "/proc"
+
+	// 数据类型, total 为整机的汇总, port 为每个监听端口一条
+	ConnStateTypeTotal = "total"
+	ConnStateTypePort  = "port"
+
+	// TypeMetricConnState 信息中的字段
+	KeyConnStateType        = "connstate_type"
+	KeyConnStatePort        = "connstate_port"
+	KeyConnStateEstablished = "connstate_established"
+	KeyConnStateSynSent     = "connstate_syn_sent"
+	KeyConnStateSynRecv     = "connstate_syn_recv"
+	KeyConnStateFinWait1    = "connstate_fin_wait1"
+	KeyConnStateFinWait2    = "connstate_fin_wait2"
+	KeyConnStateTimeWait    = "connstate_time_wait"
+	KeyConnStateClose       = "connstate_close"
+	KeyConnStateCloseWait   = "connstate_close_wait"
+	KeyConnStateLastAck     = "connstate_last_ack"
+	KeyConnStateListen      = "connstate_listen"
+	KeyConnStateClosing     = "connstate_closing"
+	KeyConnStateAcceptQueue = "connstate_accept_queue"
+	KeyConntrackCount       = "connstate_conntrack_count"
+	KeyConntrackMax         = "connstate_conntrack_max"
+	KeyConntrackUsage       = "connstate_conntrack_usage"
+)
+
+// KeyConnStateUsages TypeMetricConnState 中的字段名称
+var KeyConnStateUsages = []KeyValue{
+	{KeyConnStateType, "数据类型(total/port)"},
+	{KeyConnStatePort, "监听端口, 仅port类型"},
+	{KeyConnStateEstablished, "ESTABLISHED状态的连接数"},
+	{KeyConnStateSynSent, "SYN_SENT状态的连接数, 仅total类型"},
+	{KeyConnStateSynRecv, "SYN_RECV状态的连接数"},
+	{KeyConnStateFinWait1, "FIN_WAIT1状态的连接数"},
+	{KeyConnStateFinWait2, "FIN_WAIT2状态的连接数"},
+	{KeyConnStateTimeWait, "TIME_WAIT状态的连接数"},
+	{KeyConnStateClose, "CLOSE状态的连接数"},
+	{KeyConnStateCloseWait, "CLOSE_WAIT状态的连接数"},
+	{KeyConnStateLastAck, "LAST_ACK状态的连接数"},
+	{KeyConnStateListen, "LISTEN状态的连接数"},
+	{KeyConnStateClosing, "CLOSING状态的连接数"},
+	{KeyConnStateAcceptQueue, "等待accept的连接数"},
+	{KeyConntrackCount, "conntrack表中的条目数, 仅total类型"},
+	{KeyConntrackMax, "conntrack表的最大条目数, 仅total类型"},
+	{KeyConntrackUsage, "conntrack表的使用率(%), 仅total类型"},
+}
+
+// /proc/net/tcp 中的状态, 见 include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": KeyConnStateEstablished,
+	"02": KeyConnStateSynSent,
+	"03": KeyConnStateSynRecv,
+	"04": KeyConnStateFinWait1,
+	"05": KeyConnStateFinWait2,
+	"06": KeyConnStateTimeWait,
+	"07": KeyConnStateClose,
+	"08": KeyConnStateCloseWait,
+	"09": KeyConnStateLastAck,
+	"0A": KeyConnStateListen,
+	"0B": KeyConnStateClosing,
+	"0C": KeyConnStateSynRecv,
+}
+
+const tcpStateListen = "0A"
+
+// ConnStateStats 直接读取 /proc/net/tcp{,6}, 按状态和监听端口统计 TCP 连接数, 并收集 conntrack 表的使用情况
+// 与 netstat 不同, 不需要遍历所有进程的文件描述符, 连接数很多时开销也比较小
+type ConnStateStats struct {
+	ProcPath    string `json:"proc_path"`
+	ListenPorts string `json:"listen_ports"`
+
+	ports map[uint16]bool
+}
+
+func (_ *ConnStateStats) Name() string {
+	return TypeMetricConnState
+}
+
+func (_ *ConnStateStats) Usages() string {
+	return MetricConnStateUsages
+}
+
+func (_ *ConnStateStats) Tags() []string {
+	return []string{KeyConnStateType, KeyConnStatePort}
+}
+
+func (_ *ConnStateStats) Config() map[string]interface{} {
+	config := map[string]interface{}{
+		metric.OptionString: []Option{
+			{
+				KeyName:      ConfigConnStateProcPath,
+				ChooseOnly:   false,
+				Default:      DefaultConnStateProcPath,
+				DefaultNoUse: false,
+				Description:  "proc文件系统的路径, 容器中运行时可以填写挂载的宿主机proc路径(" + ConfigConnStateProcPath + ")",
+				Type:         metric.ConsifTypeString,
+			},
+			{
+				KeyName:      ConfigConnStateListenPorts,
+				ChooseOnly:   false,
+				Default:      "",
+				DefaultNoUse: false,
+				Description:  "只统计这些监听端口, 逗号分隔多个, 为空时统计所有监听端口(" + ConfigConnStateListenPorts + ")",
+				Type:         metric.ConsifTypeString,
+			},
+		},
+		metric.AttributesString: KeyConnStateUsages,
+	}
+	return config
+}
+
+func (s *ConnStateStats) init() error {
+	if s.ProcPath == "" {
+		s.ProcPath = DefaultConnStateProcPath
+	}
+	s.ports = make(map[uint16]bool)
+	for _, port := range strings.Split(s.ListenPorts, ",") {
+		if port = strings.TrimSpace(port); port == "" {
+			continue
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("metric %v invalid %v %q", TypeMetricConnState, ConfigConnStateListenPorts, port)
+		}
+		s.ports[uint16(p)] = true
+	}
+	return nil
+}
+
+// tcpSocket 是 /proc/net/tcp 中的一行
+type tcpSocket struct {
+	localPort uint16
+	state     string
+	rxQueue   uint64
+}
+
+// parseProcNetTcp 解析 /proc/net/tcp 和 /proc/net/tcp6, 格式如
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   107        0 22090 1 ...
+func parseProcNetTcp(data []byte) ([]tcpSocket, error) {
+	sockets := make([]tcpSocket, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// 跳过表头
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		local := strings.SplitN(fields[1], ":", 2)
+		if len(local) != 2 {
+			return nil, fmt.Errorf("invalid local address %q", fields[1])
+		}
+		port, err := strconv.ParseUint(local[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local address %q", fields[1])
+		}
+		queues := strings.SplitN(fields[4], ":", 2)
+		if len(queues) != 2 {
+			return nil, fmt.Errorf("invalid queue %q", fields[4])
+		}
+		rxQueue, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue %q", fields[4])
+		}
+		sockets = append(sockets, tcpSocket{
+			localPort: uint16(port),
+			state:     strings.ToUpper(fields[3]),
+			rxQueue:   rxQueue,
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+func readUintFile(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func newConnStateFields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, key := range tcpStates {
+		fields[key] = int64(0)
+	}
+	fields[KeyConnStateAcceptQueue] = int64(0)
+	return fields
+}
+
+func (s *ConnStateStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.ports == nil {
+		if err = s.init(); err != nil {
+			return nil, err
+		}
+	}
+	sockets := make([]tcpSocket, 0)
+	var found bool
+	for _, file := range []string{"net/tcp", "net/tcp6"} {
+		data, err := ioutil.ReadFile(filepath.Join(s.ProcPath, file))
+		if err != nil {
+			// 关闭 IPv6 时没有 tcp6
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("metric %v read %v error %v", TypeMetricConnState, file, err)
+		}
+		found = true
+		socks, err := parseProcNetTcp(data)
+		if err != nil {
+			return nil, fmt.Errorf("metric %v parse %v error %v", TypeMetricConnState, file, err)
+		}
+		sockets = append(sockets, socks...)
+	}
+	if !found {
+		return nil, fmt.Errorf("metric %v no tcp socket table under %v", TypeMetricConnState, s.ProcPath)
+	}
+
+	total := newConnStateFields()
+	total[KeyConnStateType] = ConnStateTypeTotal
+	ports := make(map[uint16]map[string]interface{})
+	for _, sock := range sockets {
+		if sock.state != tcpStateListen {
+			continue
+		}
+		total[KeyConnStateAcceptQueue] = total[KeyConnStateAcceptQueue].(int64) + int64(sock.rxQueue)
+		if len(s.ports) > 0 && !s.ports[sock.localPort] {
+			continue
+		}
+		fields, ok := ports[sock.localPort]
+		if !ok {
+			fields = newConnStateFields()
+			fields[KeyConnStateType] = ConnStateTypePort
+			fields[KeyConnStatePort] = strconv.Itoa(int(sock.localPort))
+			delete(fields, KeyConnStateSynSent)
+			ports[sock.localPort] = fields
+		}
+		fields[KeyConnStateAcceptQueue] = fields[KeyConnStateAcceptQueue].(int64) + int64(sock.rxQueue)
+	}
+	for _, sock := range sockets {
+		key, ok := tcpStates[sock.state]
+		if !ok {
+			continue
+		}
+		total[key] = total[key].(int64) + 1
+		// 本地端口为监听端口的连接认为是这个端口接受的连接, 主动发起的连接不会落在监听端口上
+		if fields, ok := ports[sock.localPort]; ok && key != KeyConnStateSynSent {
+			fields[key] = fields[key].(int64) + 1
+		}
+	}
+
+	// 没有加载 nf_conntrack 模块时没有这两个文件
+	count, countErr := readUintFile(filepath.Join(s.ProcPath, "sys/net/netfilter/nf_conntrack_count"))
+	max, maxErr := readUintFile(filepath.Join(s.ProcPath, "sys/net/netfilter/nf_conntrack_max"))
+	if countErr == nil && maxErr == nil {
+		total[KeyConntrackCount] = count
+		total[KeyConntrackMax] = max
+		if max > 0 {
+			total[KeyConntrackUsage] = float64(count) / float64(max) * 100
+		}
+	}
+
+	datas = append(datas, total)
+	portList := make([]int, 0, len(ports))
+	for port := range ports {
+		portList = append(portList, int(port))
+	}
+	sort.Ints(portList)
+	for _, port := range portList {
+		datas = append(datas, ports[uint16(port)])
+	}
+	return datas, nil
+}
+
+func init() {
+	metric.Add(TypeMetricConnState, func() metric.Collector {
+		return &ConnStateStats{}
+	})
+}
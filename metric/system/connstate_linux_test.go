@@ -0,0 +1,117 @@
+// +build linux
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const procNetTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000003 00:00000000 00000000     0        0 11111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   107        0 22090 1 0000000000000000 100 0 0 10 0
+   2: 0A00000A:0050 0B00000A:C350 01 00000000:00000000 00:00000000 00000000     0        0 33333 1 0000000000000000 20 4 30 10 -1
+   3: 0A00000A:0050 0B00000A:C351 01 00000000:00000000 00:00000000 00000000     0        0 33334 1 0000000000000000 20 4 30 10 -1
+   4: 0A00000A:0050 0B00000A:C352 06 00000000:00000000 03:00001234 00000000     0        0 0 3 0000000000000000
+   5: 0A00000A:D431 0C00000A:0CEA 01 00000000:00000000 00:00000000 00000000     0        0 44444 1 0000000000000000 20 4 30 10 -1
+   6: 0A00000A:D432 0C00000A:0CEA 02 00000001:00000000 01:00000100 00000000     0        0 55555 1 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000001 00:00000000 00000000     0        0 66666 1 0000000000000000 100 0 0 10 0
+   1: 0000000000000000FFFF00000A00000A:0050 0000000000000000FFFF00000B00000A:C353 08 00000000:00000000 00:00000000 00000000     0        0 77777 1 0000000000000000 20 4 30 10 -1
+`
+
+func writeProcFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseProcNetTcp(t *testing.T) {
+	sockets, err := parseProcNetTcp([]byte(procNetTcp))
+	assert.NoError(t, err)
+	assert.Len(t, sockets, 7)
+	assert.Equal(t, tcpSocket{localPort: 80, state: "0A", rxQueue: 3}, sockets[0])
+	assert.Equal(t, tcpSocket{localPort: 3306, state: "0A"}, sockets[1])
+	assert.Equal(t, tcpSocket{localPort: 54321, state: "01"}, sockets[5])
+
+	_, err = parseProcNetTcp([]byte("header\n   0: 00000000 00000000:0000 0A 00000000:00000000\n"))
+	assert.Error(t, err)
+}
+
+func TestConnStateCollect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "connstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeProcFiles(t, dir, map[string]string{
+		"net/tcp":                              procNetTcp,
+		"net/tcp6":                             procNetTcp6,
+		"sys/net/netfilter/nf_conntrack_count": "1000\n",
+		"sys/net/netfilter/nf_conntrack_max":   "4000\n",
+	})
+
+	s := &ConnStateStats{ProcPath: dir}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 3)
+
+	total := datas[0]
+	assert.Equal(t, ConnStateTypeTotal, total[KeyConnStateType])
+	assert.Equal(t, int64(3), total[KeyConnStateListen])
+	assert.Equal(t, int64(3), total[KeyConnStateEstablished])
+	assert.Equal(t, int64(1), total[KeyConnStateSynSent])
+	assert.Equal(t, int64(1), total[KeyConnStateTimeWait])
+	assert.Equal(t, int64(1), total[KeyConnStateCloseWait])
+	assert.Equal(t, int64(4), total[KeyConnStateAcceptQueue])
+	assert.Equal(t, uint64(1000), total[KeyConntrackCount])
+	assert.Equal(t, uint64(4000), total[KeyConntrackMax])
+	assert.Equal(t, 25.0, total[KeyConntrackUsage])
+
+	http := datas[1]
+	assert.Equal(t, ConnStateTypePort, http[KeyConnStateType])
+	assert.Equal(t, "80", http[KeyConnStatePort])
+	assert.Equal(t, int64(2), http[KeyConnStateListen])
+	assert.Equal(t, int64(2), http[KeyConnStateEstablished])
+	assert.Equal(t, int64(1), http[KeyConnStateTimeWait])
+	assert.Equal(t, int64(1), http[KeyConnStateCloseWait])
+	assert.Equal(t, int64(4), http[KeyConnStateAcceptQueue])
+	_, ok := http[KeyConnStateSynSent]
+	assert.False(t, ok)
+
+	mysql := datas[2]
+	assert.Equal(t, "3306", mysql[KeyConnStatePort])
+	assert.Equal(t, int64(1), mysql[KeyConnStateListen])
+	assert.Equal(t, int64(0), mysql[KeyConnStateEstablished])
+
+	// 只统计指定的端口, 没有 conntrack 时不输出 conntrack 字段
+	os.RemoveAll(filepath.Join(dir, "sys"))
+	os.Remove(filepath.Join(dir, "net/tcp6"))
+	s = &ConnStateStats{ProcPath: dir, ListenPorts: "3306"}
+	datas, err = s.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 2)
+	assert.Equal(t, "3306", datas[1][KeyConnStatePort])
+	_, ok = datas[0][KeyConntrackCount]
+	assert.False(t, ok)
+
+	s = &ConnStateStats{ProcPath: dir, ListenPorts: "http"}
+	_, err = s.Collect()
+	assert.Error(t, err)
+
+	s = &ConnStateStats{ProcPath: filepath.Join(dir, "notexist")}
+	_, err = s.Collect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+// +build !windows
+
+package system
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/metric"
+	. "github.com/qiniu/logkit/metric/system/utils"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	TypeMetricProcGroup  = "procgroup"
+	MetricProcGroupUsage = "进程组(procgroup)"
+
+	// Config 中的字段
+	ConfigProcGroups = "groups"
+
+	// 进程的匹配方式
+	ProcGroupMatchExe     = "exe"
+	ProcGroupMatchPattern = "pattern"
+	ProcGroupMatchPidFile = "pid_file"
+
+	// TypeMetricProcGroup 信息中的字段, 每个进程组一条数据, 为组内所有进程的汇总
+	KeyProcGroupName       = "procgroup_name"
+	KeyProcGroupCount      = "procgroup_process_count"
+	KeyProcGroupCpuUsage   = "procgroup_cpu_usage"
+	KeyProcGroupMemRss     = "procgroup_mem_rss"
+	KeyProcGroupFdsNum     = "procgroup_fds_num"
+	KeyProcGroupThreadsNum = "procgroup_threads_num"
+	KeyProcGroupUptime     = "procgroup_uptime"
+)
+
+// KeyProcGroupUsages TypeMetricProcGroup 中的字段名称
+var KeyProcGroupUsages = []KeyValue{
+	{KeyProcGroupName, "进程组名称"},
+	{KeyProcGroupCount, "匹配的进程数"},
+	{KeyProcGroupCpuUsage, "CPU使用率之和(%)"},
+	{KeyProcGroupMemRss, "RSS内存之和"},
+	{KeyProcGroupFdsNum, "文件描述符数之和"},
+	{KeyProcGroupThreadsNum, "线程数之和"},
+	{KeyProcGroupUptime, "运行最久的进程的运行时间(秒)"},
+}
+
+// ProcGroup 是一组通过进程名、命令行或 pid 文件匹配的进程
+type ProcGroup struct {
+	Name  string
+	Match string
+	Value string
+
+	procs map[PID]Process
+}
+
+// parseProcGroups 解析 groups 配置, 格式为 <组名>:<匹配方式>=<值>, 分号分隔多个, 如
+// nginx:exe=^nginx$;app:pattern=java .*app\.jar;mysql:pid_file=/var/run/mysqld/mysqld.pid
+func parseProcGroups(groups string) ([]*ProcGroup, error) {
+	ret := make([]*ProcGroup, 0)
+	names := make(map[string]bool)
+	for _, item := range strings.Split(groups, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		nameMatch := strings.SplitN(item, ":", 2)
+		if len(nameMatch) != 2 || strings.TrimSpace(nameMatch[0]) == "" {
+			return nil, fmt.Errorf("invalid group %q, should be like <name>:<exe|pattern|pid_file>=<value>", item)
+		}
+		matchValue := strings.SplitN(nameMatch[1], "=", 2)
+		if len(matchValue) != 2 || matchValue[1] == "" {
+			return nil, fmt.Errorf("invalid group %q, should be like <name>:<exe|pattern|pid_file>=<value>", item)
+		}
+		group := &ProcGroup{
+			Name:  strings.TrimSpace(nameMatch[0]),
+			Match: strings.TrimSpace(matchValue[0]),
+			Value: matchValue[1],
+			procs: make(map[PID]Process),
+		}
+		switch group.Match {
+		case ProcGroupMatchExe, ProcGroupMatchPattern, ProcGroupMatchPidFile:
+		default:
+			return nil, fmt.Errorf("group %v: unknown match type %q, should be one of exe, pattern and pid_file", group.Name, group.Match)
+		}
+		if names[group.Name] {
+			return nil, fmt.Errorf("group %v is duplicated", group.Name)
+		}
+		names[group.Name] = true
+		ret = append(ret, group)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%v is empty", ConfigProcGroups)
+	}
+	return ret, nil
+}
+
+// ProcGroupStats 按进程名、命令行正则或 pid 文件把进程分组, 收集每组进程的 CPU、内存、文件描述符、线程数和运行时间
+type ProcGroupStats struct {
+	Groups string `json:"groups"`
+
+	groups          []*ProcGroup
+	pidFinder       PIDFinder
+	createPIDFinder func() (PIDFinder, error)
+	createProcess   func(PID) (Process, error)
+	now             func() time.Time
+}
+
+func (_ *ProcGroupStats) Name() string {
+	return TypeMetricProcGroup
+}
+
+func (_ *ProcGroupStats) Usages() string {
+	return MetricProcGroupUsage
+}
+
+func (_ *ProcGroupStats) Tags() []string {
+	return []string{KeyProcGroupName}
+}
+
+func (_ *ProcGroupStats) Config() map[string]interface{} {
+	config := map[string]interface{}{
+		metric.OptionString: []Option{
+			{
+				KeyName:      ConfigProcGroups,
+				ChooseOnly:   false,
+				Default:      "",
+				Required:     true,
+				DefaultNoUse: true,
+				Description:  "进程组, 格式为 <组名>:<exe|pattern|pid_file>=<值>, 分号分隔多个, 如 nginx:exe=^nginx$;app:pattern=java .*app\\.jar(" + ConfigProcGroups + ")",
+				Type:         metric.ConsifTypeString,
+			},
+		},
+		metric.AttributesString: KeyProcGroupUsages,
+	}
+	return config
+}
+
+// findPids 通过 pgrep 查找进程, 没有匹配的进程时 pgrep 返回非零状态码, 视为进程数为 0
+func (g *ProcGroup) findPids(f PIDFinder) []PID {
+	var pids []PID
+	var err error
+	switch g.Match {
+	case ProcGroupMatchExe:
+		pids, err = f.Pattern(g.Value)
+	case ProcGroupMatchPattern:
+		pids, err = f.FullPattern(g.Value)
+	case ProcGroupMatchPidFile:
+		pids, err = f.PidFile(g.Value)
+	}
+	if err != nil {
+		log.Debugf("metric %v group %v find pids by %v %v error %v", TypeMetricProcGroup, g.Name, g.Match, g.Value, err)
+		return nil
+	}
+	return pids
+}
+
+func (s *ProcGroupStats) Collect() (datas []map[string]interface{}, err error) {
+	if s.groups == nil {
+		if s.groups, err = parseProcGroups(s.Groups); err != nil {
+			return nil, fmt.Errorf("metric %v %v", TypeMetricProcGroup, err)
+		}
+	}
+	if s.createPIDFinder == nil {
+		s.createPIDFinder = defaultPIDFinder
+	}
+	if s.createProcess == nil {
+		s.createProcess = defaultProcess
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	if s.pidFinder == nil {
+		if s.pidFinder, err = s.createPIDFinder(); err != nil {
+			return nil, err
+		}
+	}
+	datas = make([]map[string]interface{}, 0, len(s.groups))
+	for _, g := range s.groups {
+		datas = append(datas, s.collectGroup(g))
+	}
+	return datas, nil
+}
+
+// collectGroup 汇总组内的进程, 保留上次的 Process 以便计算 CPU 使用率
+func (s *ProcGroupStats) collectGroup(g *ProcGroup) map[string]interface{} {
+	procs := make(map[PID]Process)
+	for _, pid := range g.findPids(s.pidFinder) {
+		if proc, ok := g.procs[pid]; ok {
+			procs[pid] = proc
+		} else if proc, err := s.createProcess(pid); err == nil {
+			procs[pid] = proc
+		}
+	}
+	g.procs = procs
+
+	var cpuUsage float64
+	var rss uint64
+	var fds, threads int64
+	var uptime float64
+	now := s.now()
+	for _, proc := range procs {
+		if cpuPerc, err := proc.Percent(0); err == nil {
+			cpuUsage += cpuPerc
+		}
+		if mem, err := proc.MemoryInfo(); err == nil {
+			rss += mem.RSS
+		}
+		if n, err := proc.NumFDs(); err == nil {
+			fds += int64(n)
+		}
+		if n, err := proc.NumThreads(); err == nil {
+			threads += int64(n)
+		}
+		if createTime, err := proc.CreateTime(); err == nil {
+			if seconds := now.Sub(time.Unix(0, createTime*int64(time.Millisecond))).Seconds(); seconds > uptime {
+				uptime = seconds
+			}
+		}
+	}
+	return map[string]interface{}{
+		KeyProcGroupName:       g.Name,
+		KeyProcGroupCount:      int64(len(procs)),
+		KeyProcGroupCpuUsage:   cpuUsage,
+		KeyProcGroupMemRss:     rss,
+		KeyProcGroupFdsNum:     fds,
+		KeyProcGroupThreadsNum: threads,
+		KeyProcGroupUptime:     uptime,
+	}
+}
+
+func init() {
+	metric.Add(TypeMetricProcGroup, func() metric.Collector {
+		return &ProcGroupStats{}
+	})
+}
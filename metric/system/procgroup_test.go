@@ -0,0 +1,124 @@
+// +build !windows
+
+package system
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/metric/system/utils"
+)
+
+type testPIDFinder struct {
+	pids map[string][]PID
+}
+
+func (f *testPIDFinder) find(key string) ([]PID, error) {
+	pids, ok := f.pids[key]
+	if !ok {
+		return nil, errors.New("exit status 1")
+	}
+	return pids, nil
+}
+
+func (f *testPIDFinder) PidFile(path string) ([]PID, error)    { return f.find("pid_file:" + path) }
+func (f *testPIDFinder) Pattern(pattern string) ([]PID, error) { return f.find("exe:" + pattern) }
+func (f *testPIDFinder) Uid(user string) ([]PID, error)        { return f.find("user:" + user) }
+func (f *testPIDFinder) FullPattern(pattern string) ([]PID, error) {
+	return f.find("pattern:" + pattern)
+}
+
+type testProcess struct {
+	Process
+	pid        PID
+	createTime int64
+}
+
+func (p *testProcess) PID() PID { return p.pid }
+func (p *testProcess) Percent(time.Duration) (float64, error) {
+	return float64(p.pid), nil
+}
+func (p *testProcess) MemoryInfo() (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: uint64(p.pid) * 1024}, nil
+}
+func (p *testProcess) NumFDs() (int32, error)     { return int32(p.pid) * 10, nil }
+func (p *testProcess) NumThreads() (int32, error) { return 2, nil }
+func (p *testProcess) CreateTime() (int64, error) { return p.createTime, nil }
+
+func TestParseProcGroups(t *testing.T) {
+	groups, err := parseProcGroups(` nginx:exe=^nginx$ ; app:pattern=java .*app\.jar;mysql:pid_file=/var/run/mysqld.pid;`)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, "nginx", groups[0].Name)
+	assert.Equal(t, ProcGroupMatchExe, groups[0].Match)
+	assert.Equal(t, "^nginx$", groups[0].Value)
+	assert.Equal(t, `java .*app\.jar`, groups[1].Value)
+	assert.Equal(t, ProcGroupMatchPidFile, groups[2].Match)
+
+	for _, bad := range []string{"", "nginx", "nginx:exe", "nginx:user=root", ":exe=nginx", "a:exe=a;a:exe=b"} {
+		_, err = parseProcGroups(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestProcGroupCollect(t *testing.T) {
+	now := time.Unix(1000, 0)
+	created := make(map[PID]int)
+	s := &ProcGroupStats{
+		Groups: "web:exe=nginx;app:pattern=app.jar;down:exe=not_running",
+		createPIDFinder: func() (PIDFinder, error) {
+			return &testPIDFinder{pids: map[string][]PID{
+				"exe:nginx":       {1, 2},
+				"pattern:app.jar": {3},
+			}}, nil
+		},
+		createProcess: func(pid PID) (Process, error) {
+			created[pid]++
+			return &testProcess{pid: pid, createTime: int64(pid) * 100 * 1000}, nil
+		},
+		now: func() time.Time { return now },
+	}
+	datas, err := s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			KeyProcGroupName:       "web",
+			KeyProcGroupCount:      int64(2),
+			KeyProcGroupCpuUsage:   float64(3),
+			KeyProcGroupMemRss:     uint64(3 * 1024),
+			KeyProcGroupFdsNum:     int64(30),
+			KeyProcGroupThreadsNum: int64(4),
+			KeyProcGroupUptime:     float64(900),
+		},
+		{
+			KeyProcGroupName:       "app",
+			KeyProcGroupCount:      int64(1),
+			KeyProcGroupCpuUsage:   float64(3),
+			KeyProcGroupMemRss:     uint64(3 * 1024),
+			KeyProcGroupFdsNum:     int64(30),
+			KeyProcGroupThreadsNum: int64(2),
+			KeyProcGroupUptime:     float64(700),
+		},
+		{
+			KeyProcGroupName:       "down",
+			KeyProcGroupCount:      int64(0),
+			KeyProcGroupCpuUsage:   float64(0),
+			KeyProcGroupMemRss:     uint64(0),
+			KeyProcGroupFdsNum:     int64(0),
+			KeyProcGroupThreadsNum: int64(0),
+			KeyProcGroupUptime:     float64(0),
+		},
+	}, datas)
+
+	// 再次收集时复用已有的进程, 以便计算 CPU 使用率
+	_, err = s.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, map[PID]int{1: 1, 2: 1, 3: 1}, created)
+
+	_, err = (&ProcGroupStats{}).Collect()
+	assert.Error(t, err)
+}
@@ -21,6 +21,7 @@ type Process interface {
 	Percent(interval time.Duration) (float64, error)
 	Times() (*cpu.TimesStat, error)
 	RlimitUsage(bool) ([]process.RlimitStat, error)
+	CreateTime() (int64, error)
 }
 
 type Proc struct {
@@ -0,0 +1,440 @@
+package mgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+)
+
+const (
+	DefaultAlertInterval = 60  // 单位秒
+	DefaultAlertCooldown = 600 // 单位秒
+
+	alertNotifyTimeout = 10 * time.Second
+)
+
+// 告警规则可以使用的指标
+const (
+	AlertMetricLag             = "lag"               // reader 的 lag, 单位由 reader 决定, 通常是字节
+	AlertMetricFtLags          = "ft_lags"           // fault tolerant 磁盘队列的积压
+	AlertMetricReadRate        = "read_rate"         // 每秒读取的条数, 配合 "<" 可以发现卡住的 runner
+	AlertMetricParseErrorRate  = "parse_error_rate"  // 评估间隔内解析失败的比例
+	AlertMetricSendErrors      = "send_errors"       // 评估间隔内发送失败的条数
+	AlertMetricSendFailureRate = "send_failure_rate" // 评估间隔内发送失败的比例
+)
+
+// 通知方式
+const (
+	NotifierWebhook  = "webhook"
+	NotifierDingTalk = "dingtalk"
+	NotifierEmail    = "email"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertConfig 是告警的配置, 每隔 interval 秒用所有 runner 的状态评估一次告警规则
+type AlertConfig struct {
+	Interval  int             `json:"interval"`
+	Rules     []AlertRule     `json:"rules"`
+	Notifiers []AlertNotifier `json:"notifiers"`
+}
+
+// AlertRule 在 runner 的指标满足条件并持续 for 秒之后触发告警, 同一个 runner 在 cooldown 秒内只通知一次
+type AlertRule struct {
+	Name      string   `json:"name"`
+	Runner    string   `json:"runner"` // runner 的名字, 为空时对所有 runner 生效
+	Metric    string   `json:"metric"`
+	Operator  string   `json:"operator"` // ">" 或 "<", 默认为 ">"
+	Threshold float64  `json:"threshold"`
+	For       int      `json:"for"`
+	Cooldown  int      `json:"cooldown"`
+	Notifiers []string `json:"notifiers"` // 通知方式的名字, 为空时使用所有通知方式
+}
+
+// AlertNotifier 是一种通知方式, webhook 和 dingtalk 使用 url, email 使用 smtp_* 以及 from、to
+type AlertNotifier struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+
+	SMTPHost     string   `json:"smtp_host"`
+	SMTPPort     int      `json:"smtp_port"`
+	SMTPUsername string   `json:"smtp_username"`
+	SMTPPassword string   `json:"smtp_password"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+}
+
+// AlertEvent 是发送给通知方式的告警内容
+type AlertEvent struct {
+	Rule      string    `json:"rule"`
+	Runner    string    `json:"runner"`
+	Metric    string    `json:"metric"`
+	Operator  string    `json:"operator"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Status    string    `json:"status"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+}
+
+func (e AlertEvent) text() string {
+	return fmt.Sprintf("[logkit %v] %v", e.Status, e.Message)
+}
+
+func formatAlertValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (r *AlertRule) operator() string {
+	if r.Operator == "" {
+		return ">"
+	}
+	return r.Operator
+}
+
+func (r *AlertRule) match(value float64) bool {
+	if r.operator() == "<" {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+func (c *AlertConfig) validate() error {
+	notifiers := make(map[string]bool, len(c.Notifiers))
+	for _, n := range c.Notifiers {
+		if n.Name == "" {
+			return fmt.Errorf("alert notifier name is empty")
+		}
+		switch n.Type {
+		case NotifierWebhook, NotifierDingTalk:
+			if n.URL == "" {
+				return fmt.Errorf("alert notifier %v: url is empty", n.Name)
+			}
+		case NotifierEmail:
+			if n.SMTPHost == "" || n.From == "" || len(n.To) == 0 {
+				return fmt.Errorf("alert notifier %v: smtp_host, from and to are required", n.Name)
+			}
+		default:
+			return fmt.Errorf("alert notifier %v: type %v is not supported", n.Name, n.Type)
+		}
+		notifiers[n.Name] = true
+	}
+	for _, r := range c.Rules {
+		switch r.Metric {
+		case AlertMetricLag, AlertMetricFtLags, AlertMetricReadRate, AlertMetricParseErrorRate,
+			AlertMetricSendErrors, AlertMetricSendFailureRate:
+		default:
+			return fmt.Errorf("alert rule %v: metric %v is not supported", r.Name, r.Metric)
+		}
+		if op := r.operator(); op != ">" && op != "<" {
+			return fmt.Errorf("alert rule %v: operator should be > or <, but got %v", r.Name, op)
+		}
+		for _, n := range r.Notifiers {
+			if !notifiers[n] {
+				return fmt.Errorf("alert rule %v: notifier %v is not found", r.Name, n)
+			}
+		}
+	}
+	return nil
+}
+
+// alertMetric 根据前后两次的状态计算指标的值
+func alertMetric(metric string, cur, last StatsPoint, hasLast bool) (float64, bool) {
+	ratio := func(errs, total int64) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return float64(errs) / float64(total)
+	}
+	switch metric {
+	case AlertMetricLag:
+		return float64(cur.Lag), true
+	case AlertMetricFtLags:
+		return float64(cur.FtLags), true
+	}
+	// 以下指标需要两次状态才能计算, runner 重启后计数变小时跳过这次评估
+	if !hasLast || cur.ReadDataCount < last.ReadDataCount || cur.SendErrors < last.SendErrors || cur.ParseErrors < last.ParseErrors {
+		return 0, false
+	}
+	switch metric {
+	case AlertMetricReadRate:
+		return cur.ReadRate, true
+	case AlertMetricParseErrorRate:
+		errs := cur.ParseErrors - last.ParseErrors
+		return ratio(errs, errs+cur.ParseSuccess-last.ParseSuccess), true
+	case AlertMetricSendErrors:
+		return float64(cur.SendErrors - last.SendErrors), true
+	case AlertMetricSendFailureRate:
+		errs := cur.SendErrors - last.SendErrors
+		return ratio(errs, errs+cur.SendSuccess-last.SendSuccess), true
+	}
+	return 0, false
+}
+
+// alertState 是一条规则在一个 runner 上的状态
+type alertState struct {
+	Rule         string    `json:"rule"`
+	Runner       string    `json:"runner"`
+	Value        float64   `json:"value"`
+	Firing       bool      `json:"firing"`
+	PendingSince time.Time `json:"pending_since"`
+	LastNotify   time.Time `json:"last_notify"`
+}
+
+type alertEngine struct {
+	AlertConfig
+	mutex  sync.Mutex
+	last   map[string]StatsPoint
+	states map[string]*alertState // key 为 规则名/runner名
+	client *http.Client
+	// notify 发送通知, 测试时替换
+	notify func(n AlertNotifier, e AlertEvent) error
+}
+
+func newAlertEngine(c AlertConfig) (*alertEngine, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	for i := range c.Rules {
+		if c.Rules[i].Name == "" {
+			c.Rules[i].Name = "rule" + strconv.Itoa(i)
+		}
+	}
+	e := &alertEngine{
+		AlertConfig: c,
+		last:        make(map[string]StatsPoint),
+		states:      make(map[string]*alertState),
+		client:      &http.Client{Timeout: alertNotifyTimeout},
+	}
+	e.notify = e.send
+	return e, nil
+}
+
+// evaluate 用所有 runner 当前的状态评估规则, 返回需要发送的告警
+func (e *alertEngine) evaluate(now time.Time, rss map[string]RunnerStatus) []AlertEvent {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	points := make(map[string]StatsPoint, len(rss))
+	for name, rs := range rss {
+		p := newStatsPoint(now, rs)
+		if last, ok := e.last[name]; ok {
+			p.calcRate(last)
+		}
+		points[name] = p
+	}
+
+	var events []AlertEvent
+	for _, rule := range e.Rules {
+		names := make([]string, 0, len(points))
+		for name := range points {
+			if rule.Runner == "" || rule.Runner == name {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			last, hasLast := e.last[name]
+			value, ok := alertMetric(rule.Metric, points[name], last, hasLast)
+			if !ok {
+				continue
+			}
+			if ev, fire := e.update(now, rule, name, value); fire {
+				events = append(events, ev)
+			}
+		}
+	}
+	// 已经删除的 runner 不再保留状态
+	for key, st := range e.states {
+		if _, ok := points[st.Runner]; !ok {
+			delete(e.states, key)
+		}
+	}
+	e.last = points
+	return events
+}
+
+func (e *alertEngine) update(now time.Time, rule AlertRule, runner string, value float64) (AlertEvent, bool) {
+	key := rule.Name + "/" + runner
+	st, ok := e.states[key]
+	if !ok {
+		st = &alertState{Rule: rule.Name, Runner: runner}
+		e.states[key] = st
+	}
+	st.Value = value
+	ev := AlertEvent{
+		Rule:      rule.Name,
+		Runner:    runner,
+		Metric:    rule.Metric,
+		Operator:  rule.operator(),
+		Value:     value,
+		Threshold: rule.Threshold,
+		Time:      now,
+	}
+	if !rule.match(value) {
+		st.PendingSince = time.Time{}
+		if !st.Firing {
+			return ev, false
+		}
+		st.Firing = false
+		ev.Status = AlertResolved
+		ev.Message = fmt.Sprintf("runner %v rule %v resolved, %v is %v now", runner, rule.Name, rule.Metric, formatAlertValue(value))
+		return ev, true
+	}
+	if st.PendingSince.IsZero() {
+		st.PendingSince = now
+	}
+	if now.Sub(st.PendingSince) < time.Duration(rule.For)*time.Second {
+		return ev, false
+	}
+	cooldown := rule.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultAlertCooldown
+	}
+	st.Firing = true
+	if !st.LastNotify.IsZero() && now.Sub(st.LastNotify) < time.Duration(cooldown)*time.Second {
+		return ev, false
+	}
+	st.LastNotify = now
+	ev.Status = AlertFiring
+	ev.Message = fmt.Sprintf("runner %v rule %v: %v is %v, %v %v", runner, rule.Name, rule.Metric,
+		formatAlertValue(value), rule.operator(), formatAlertValue(rule.Threshold))
+	return ev, true
+}
+
+func (e *alertEngine) ruleNotifiers(name string) []AlertNotifier {
+	for _, r := range e.Rules {
+		if r.Name != name {
+			continue
+		}
+		if len(r.Notifiers) == 0 {
+			return e.Notifiers
+		}
+		var ns []AlertNotifier
+		for _, n := range e.Notifiers {
+			for _, rn := range r.Notifiers {
+				if n.Name == rn {
+					ns = append(ns, n)
+				}
+			}
+		}
+		return ns
+	}
+	return nil
+}
+
+func (e *alertEngine) dispatch(events []AlertEvent) {
+	for _, ev := range events {
+		log.Warnf("alert %v", ev.Message)
+		for _, n := range e.ruleNotifiers(ev.Rule) {
+			if err := e.notify(n, ev); err != nil {
+				log.Errorf("send alert of rule %v to notifier %v error: %v", ev.Rule, n.Name, err)
+			}
+		}
+	}
+}
+
+func (e *alertEngine) postJSON(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%v returns status %v", url, resp.Status)
+	}
+	return nil
+}
+
+func (e *alertEngine) send(n AlertNotifier, ev AlertEvent) error {
+	switch n.Type {
+	case NotifierWebhook:
+		return e.postJSON(n.URL, ev)
+	case NotifierDingTalk:
+		return e.postJSON(n.URL, map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": ev.text()},
+		})
+	case NotifierEmail:
+		port := n.SMTPPort
+		if port <= 0 {
+			port = 25
+		}
+		var auth smtp.Auth
+		if n.SMTPUsername != "" {
+			auth = smtp.PlainAuth("", n.SMTPUsername, n.SMTPPassword, n.SMTPHost)
+		}
+		msg := "From: " + n.From + "\r\nTo: " + strings.Join(n.To, ",") + "\r\nSubject: " + ev.text() +
+			"\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n" + ev.Message + "\r\n"
+		return smtp.SendMail(net.JoinHostPort(n.SMTPHost, strconv.Itoa(port)), auth, n.From, n.To, []byte(msg))
+	}
+	return fmt.Errorf("notifier type %v is not supported", n.Type)
+}
+
+// firing 返回正在告警的状态
+func (e *alertEngine) firing() []alertState {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	states := make([]alertState, 0)
+	for _, st := range e.states {
+		if st.Firing {
+			states = append(states, *st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Rule != states[j].Rule {
+			return states[i].Rule < states[j].Rule
+		}
+		return states[i].Runner < states[j].Runner
+	})
+	return states
+}
+
+func (m *Manager) alertLoop() {
+	if m.alerts == nil {
+		return
+	}
+	interval := DefaultAlertInterval
+	if m.Alert.Interval > 0 {
+		interval = m.Alert.Interval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.exitChan:
+			return
+		case now := <-ticker.C:
+			m.alerts.dispatch(m.alerts.evaluate(now, m.Status()))
+		}
+	}
+}
+
+// GET /logkit/alerts
+// 返回正在告警的规则和 runner
+func (rs *RestService) GetAlerts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rs.mgr.alerts == nil {
+			return RespSuccess(c, []alertState{})
+		}
+		return RespSuccess(c, rs.mgr.alerts.firing())
+	}
+}
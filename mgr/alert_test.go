@@ -0,0 +1,133 @@
+package mgr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestAlertConfigValidate(t *testing.T) {
+	notifiers := []AlertNotifier{{Name: "hook", Type: NotifierWebhook, URL: "http://127.0.0.1"}}
+	for _, c := range []AlertConfig{
+		{Rules: []AlertRule{{Metric: "not_exist"}}},
+		{Rules: []AlertRule{{Metric: AlertMetricLag, Operator: ">="}}},
+		{Rules: []AlertRule{{Metric: AlertMetricLag, Notifiers: []string{"mail"}}}, Notifiers: notifiers},
+		{Notifiers: []AlertNotifier{{Name: "mail", Type: NotifierEmail}}},
+		{Notifiers: []AlertNotifier{{Name: "x", Type: "sms"}}},
+	} {
+		_, err := newAlertEngine(c)
+		assert.Error(t, err, "%+v", c)
+	}
+	_, err := newAlertEngine(AlertConfig{Rules: []AlertRule{{Metric: AlertMetricLag, Notifiers: []string{"hook"}}}, Notifiers: notifiers})
+	assert.NoError(t, err)
+}
+
+func TestAlertEngine(t *testing.T) {
+	e, err := newAlertEngine(AlertConfig{
+		Rules: []AlertRule{
+			{Name: "lag", Metric: AlertMetricLag, Threshold: 100, For: 20, Cooldown: 60, Notifiers: []string{"hook"}},
+			{Name: "stuck", Runner: "r1", Metric: AlertMetricReadRate, Operator: "<", Threshold: 1},
+			{Name: "send", Metric: AlertMetricSendFailureRate, Threshold: 0.5},
+		},
+		Notifiers: []AlertNotifier{
+			{Name: "hook", Type: NotifierWebhook, URL: "http://127.0.0.1"},
+			{Name: "ding", Type: NotifierDingTalk, URL: "http://127.0.0.1"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, e.ruleNotifiers("lag"), 1)
+	assert.Len(t, e.ruleNotifiers("send"), 2)
+
+	status := func(read, lag, sendOK, sendErr int64) map[string]RunnerStatus {
+		return map[string]RunnerStatus{
+			"r1": {
+				ReadDataCount: read,
+				Lag:           LagInfo{Size: lag},
+				SenderStats:   map[string]StatsInfo{"s": {Success: sendOK, Errors: sendErr}},
+			},
+		}
+	}
+	names := func(events []AlertEvent) []string {
+		ret := make([]string, 0, len(events))
+		for _, ev := range events {
+			ret = append(ret, ev.Rule+":"+ev.Status)
+		}
+		return ret
+	}
+
+	now := time.Unix(1000, 0)
+	// 第一次评估只有 lag 可以计算, 而且还没有持续足够长的时间
+	assert.Empty(t, e.evaluate(now, status(0, 200, 0, 0)))
+	assert.Equal(t, []string{"lag:firing", "stuck:firing"}, names(e.evaluate(now.Add(20*time.Second), status(10, 200, 10, 0))))
+	// cooldown 内不再通知
+	assert.Equal(t, []string{"send:firing"}, names(e.evaluate(now.Add(40*time.Second), status(20, 200, 10, 20))))
+	assert.Len(t, e.firing(), 3)
+	assert.Equal(t, []string{"lag:firing", "send:resolved"}, names(e.evaluate(now.Add(80*time.Second), status(30, 200, 30, 20))))
+	assert.Equal(t, []string{"lag:resolved", "stuck:resolved"}, names(e.evaluate(now.Add(100*time.Second), status(400, 0, 40, 20))))
+	assert.Empty(t, e.firing())
+
+	// runner 重启后计数变小, 跳过需要增量的指标
+	events := e.evaluate(now.Add(120*time.Second), status(0, 0, 0, 0))
+	assert.Empty(t, events)
+
+	// 删除的 runner 不再保留状态
+	e.evaluate(now.Add(140*time.Second), map[string]RunnerStatus{})
+	assert.Empty(t, e.states)
+}
+
+func TestAlertNotify(t *testing.T) {
+	received := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer server.Close()
+
+	e, err := newAlertEngine(AlertConfig{
+		Rules: []AlertRule{{Name: "lag", Metric: AlertMetricLag, Threshold: 100}},
+		Notifiers: []AlertNotifier{
+			{Name: "hook", Type: NotifierWebhook, URL: server.URL},
+			{Name: "ding", Type: NotifierDingTalk, URL: server.URL},
+		},
+	})
+	assert.NoError(t, err)
+	e.dispatch(e.evaluate(time.Now(), map[string]RunnerStatus{"r1": {Lag: LagInfo{Size: 200}}}))
+
+	body := <-received
+	assert.Equal(t, "r1", body["runner"])
+	assert.Equal(t, AlertFiring, body["status"])
+	body = <-received
+	assert.Equal(t, "text", body["msgtype"])
+	assert.Contains(t, body["text"].(map[string]interface{})["content"], "lag is 200, > 100")
+
+	server.Close()
+	assert.Error(t, e.send(e.Notifiers[0], AlertEvent{}))
+}
+
+func TestGetAlerts(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestGetAlerts", ServerBackup: true})
+	assert.NoError(t, err)
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/alerts", rs.GetAlerts())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+"/alerts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	m.alerts, err = newAlertEngine(AlertConfig{Rules: []AlertRule{{Metric: AlertMetricLag}}})
+	assert.NoError(t, err)
+	m.alerts.evaluate(time.Now(), map[string]RunnerStatus{"r1": {Lag: LagInfo{Size: 1}}})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+"/alerts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"runner":"r1"`)
+}
@@ -1,14 +1,50 @@
 package mgr
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/qiniu/logkit/cleaner"
+	. "github.com/qiniu/logkit/utils/models"
 
 	"github.com/labstack/echo"
 )
 
+// CleanReporter 的 runner 可以返回 cleaner 最近一次清理的结果
+type CleanReporter interface {
+	CleanReport() (*cleaner.CleanReport, error)
+}
+
+func (r *LogExportRunner) CleanReport() (*cleaner.CleanReport, error) {
+	if r.cleaner == nil {
+		return nil, errors.New("cleaner of runner " + r.Name() + " is not enabled")
+	}
+	return r.cleaner.LastReport(), nil
+}
+
 // get /logkit/cleaner/options 获取解析选项
 func (rs *RestService) GetCleanerKeyOptions() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		return RespSuccess(c, cleaner.ModeKeyOptions)
 	}
 }
+
+// get /logkit/cleaner/reports/<name> 获取 runner 的 cleaner 最近一次清理的结果，还没有执行过清理时 data 为 null
+func (rs *RestService) GetCleanerReport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		r, ok := rs.mgr.getRunnerByName(name)
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrCleanerReport, "runner "+name+" is not found or not running")
+		}
+		cr, ok := r.(CleanReporter)
+		if !ok {
+			return RespError(c, http.StatusBadRequest, ErrCleanerReport, "runner "+name+" does not support cleaner report")
+		}
+		report, err := cr.CleanReport()
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrCleanerReport, err.Error())
+		}
+		return RespSuccess(c, report)
+	}
+}
@@ -0,0 +1,63 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/cleaner"
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+)
+
+func TestGetCleanerReport(t *testing.T) {
+	dir := "TestGetCleanerReport"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir + "/rest"})
+	assert.NoError(t, err)
+	c := conf.MapConf{
+		reader.KeyMetaPath:        dir + "/meta",
+		reader.KeyLogPath:         dir + "/logs",
+		reader.KeyMode:            reader.ModeDir,
+		cleaner.KeyCleanEnable:    "true",
+		cleaner.KeyCleanDryRun:    "true",
+		cleaner.KeyReserveFileAge: "1",
+	}
+	assert.NoError(t, os.MkdirAll(dir+"/logs", 0755))
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	cl, err := cleaner.NewCleaner(c, meta, make(chan cleaner.CleanSignal), dir+"/logs")
+	assert.NoError(t, err)
+	m.runners["r1.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}, cleaner: cl}
+	m.runners["r2.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r2"}}
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/cleaner/reports/:name", rs.GetCleanerReport())
+
+	request := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, PREFIX+"/cleaner/reports/"+name, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("r1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"data":null`)
+
+	assert.NoError(t, cl.Clean())
+	rec = request("r1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"dry_run":true`)
+	assert.Contains(t, rec.Body.String(), `"action":"delete"`)
+
+	rec = request("r2")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request("r3")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
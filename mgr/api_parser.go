@@ -3,9 +3,11 @@ package mgr
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/parser/grok"
 	. "github.com/qiniu/logkit/utils/models"
 
 	"github.com/labstack/echo"
@@ -22,6 +24,123 @@ type PostParseRet struct {
 	SamplePoints []Data `json:"SamplePoints"`
 }
 
+// PostGrokTestRet grok 测试的返回值
+type PostGrokTestRet struct {
+	Pattern string `json:"pattern"`
+	Fields  Data   `json:"fields"`
+}
+
+// MaxParserTestRepeat 是解析测试中每一行最多重复解析的次数
+const MaxParserTestRepeat = 1000
+
+// PostParserTestReq 是解析测试的请求，Lines 为样例数据，Repeat 为重复解析的轮数，用于更准确地测量延迟
+type PostParserTestReq struct {
+	Parser      conf.MapConf         `json:"parser"`
+	ParserChain []parser.ChainConfig `json:"parser_chain,omitempty"`
+	Lines       []string             `json:"lines"`
+	Repeat      int                  `json:"repeat,omitempty"`
+}
+
+// ParserLineResult 是一行样例数据第一轮的解析结果，Latency 为每一轮解析这一行的平均耗时
+type ParserLineResult struct {
+	Line    int           `json:"line"`
+	Datas   []Data        `json:"datas,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// ParserTestResult 解析测试的结果
+type ParserTestResult struct {
+	Results      []ParserLineResult `json:"results"`
+	Flushed      []Data             `json:"flushed,omitempty"` // parser 是 Flushable 时最后 flush 出的数据
+	Success      int                `json:"success"`
+	Errors       int                `json:"errors"`
+	TotalLatency time.Duration      `json:"total_latency_ns"` // 一轮解析所有行的平均耗时
+	AvgLatency   time.Duration      `json:"avg_latency_ns"`   // 每一行的平均耗时
+}
+
+// RunParserTest 逐行解析样例数据，记录每一行的结果、错误和耗时。每一轮都重新创建 parser，
+// 所以 csv 表头、w3c #Fields 这样有状态的 parser 每一轮的结果都相同
+func RunParserTest(req PostParserTestReq) (*ParserTestResult, error) {
+	parserConf := parser.ConvertWebParserConfig(req.Parser)
+	if parserConf == nil {
+		return nil, fmt.Errorf("parser config is empty")
+	}
+	if len(req.Lines) == 0 {
+		return nil, fmt.Errorf("lines is empty")
+	}
+	repeat := req.Repeat
+	if repeat <= 0 {
+		repeat = 1
+	}
+	if repeat > MaxParserTestRepeat {
+		repeat = MaxParserTestRepeat
+	}
+	registry := parser.NewRegistry()
+	ret := &ParserTestResult{Results: make([]ParserLineResult, len(req.Lines))}
+	for round := 0; round < repeat; round++ {
+		cp := make(conf.MapConf, len(parserConf))
+		for k, v := range parserConf {
+			cp[k] = v
+		}
+		p, err := registry.NewLogParser(cp)
+		if err != nil {
+			return nil, err
+		}
+		if p, err = registry.NewParserChain(p, req.ParserChain); err != nil {
+			return nil, err
+		}
+		for i, line := range req.Lines {
+			start := time.Now()
+			datas, err := p.Parse([]string{line})
+			ret.Results[i].Latency += time.Since(start)
+			if round > 0 {
+				continue
+			}
+			ret.Results[i].Line = i
+			ret.Results[i].Datas = datas
+			if se, ok := err.(*StatsError); ok {
+				err = nil
+				if se.Errors > 0 {
+					err = se.ErrorDetail
+				}
+			}
+			if err != nil {
+				ret.Results[i].Error = err.Error()
+			}
+		}
+		if _, ok := p.(parser.Flushable); ok && round == 0 {
+			ret.Flushed, _ = p.Parse([]string{parser.PandoraParseFlushSignal})
+		}
+	}
+	for i := range ret.Results {
+		ret.Results[i].Latency /= time.Duration(repeat)
+		ret.TotalLatency += ret.Results[i].Latency
+		if ret.Results[i].Error != "" {
+			ret.Errors++
+		} else {
+			ret.Success++
+		}
+	}
+	ret.AvgLatency = ret.TotalLatency / time.Duration(len(ret.Results))
+	return ret, nil
+}
+
+// POST /logkit/parser/test 使用样例数据测试 parser 配置，返回每一行的解析结果、错误和耗时
+func (rs *RestService) PostParserTest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req PostParserTestReq
+		if err := c.Bind(&req); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, err.Error())
+		}
+		ret, err := RunParserTest(req)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, err.Error())
+		}
+		return RespSuccess(c, ret)
+	}
+}
+
 // post /logkit/parser/parse 接受解析请求
 func (rs *RestService) PostParse() echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -86,3 +205,28 @@ func (rs *RestService) PostParserCheck() echo.HandlerFunc {
 		return RespSuccess(c, nil)
 	}
 }
+
+// POST /logkit/parser/grok/test 使用 grok pattern 解析一行样例日志，返回匹配到的 pattern 和解析结果
+func (rs *RestService) PostGrokTest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		reqConf := conf.MapConf{}
+		if err := c.Bind(&reqConf); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, err.Error())
+		}
+		reqConf = parser.ConvertWebParserConfig(reqConf)
+		sampleLog, _ := reqConf.GetStringOr(KeySampleLog, "")
+		if sampleLog == "" {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, "sampleLog is empty")
+		}
+		reqConf[parser.KeyParserType] = parser.TypeGrok
+		p, err := grok.NewParser(reqConf)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, err.Error())
+		}
+		fields, pattern, err := p.(*grok.Parser).Test(sampleLog)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrParseParse, fmt.Sprintf("parser error %v", err))
+		}
+		return RespSuccess(c, PostGrokTestRet{Pattern: pattern, Fields: fields})
+	}
+}
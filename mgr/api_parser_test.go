@@ -2,6 +2,7 @@ package mgr
 
 import (
 	"net/http"
+	"testing"
 
 	conf2 "github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/parser"
@@ -133,3 +134,33 @@ func parserAPITest(p *testParam) {
 	}
 	assert.Equal(t, parser.ModeToolTips, got4.Data)
 }
+
+func TestRunParserTest(t *testing.T) {
+	ret, err := RunParserTest(PostParserTestReq{
+		Parser: conf2.MapConf{parser.KeyParserType: parser.TypeCSV, parser.KeyCSVSchemaFromHeader: "true", parser.KeyCSVSplitter: ","},
+		Lines:  []string{HeaderLineMarker + "a,b", "1,2", "3"},
+		Repeat: 3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, ret.Success)
+	assert.Equal(t, 1, ret.Errors)
+	assert.Len(t, ret.Results, 3)
+	// 每一轮都重新创建 parser，表头在每一轮中都能生效
+	assert.Equal(t, []Data{{"a": "1", "b": "2"}}, ret.Results[1].Datas)
+	assert.Equal(t, 2, ret.Results[2].Line)
+	assert.NotEmpty(t, ret.Results[2].Error)
+	assert.Equal(t, ret.Results[0].Latency+ret.Results[1].Latency+ret.Results[2].Latency, ret.TotalLatency)
+
+	ret, err = RunParserTest(PostParserTestReq{
+		Parser:      conf2.MapConf{parser.KeyParserType: parser.TypeJSON},
+		ParserChain: []parser.ChainConfig{{Field: "msg", Parser: conf2.MapConf{parser.KeyParserType: parser.TypeLogfmt}}},
+		Lines:       []string{`{"msg":"level=info"}`},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Data{{"level": "info"}}, ret.Results[0].Datas)
+
+	_, err = RunParserTest(PostParserTestReq{Parser: conf2.MapConf{parser.KeyParserType: parser.TypeRaw}})
+	assert.Error(t, err)
+	_, err = RunParserTest(PostParserTestReq{Parser: conf2.MapConf{parser.KeyParserType: "not_exist"}, Lines: []string{"a"}})
+	assert.Error(t, err)
+}
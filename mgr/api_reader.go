@@ -1,6 +1,7 @@
 package mgr
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/qiniu/logkit/conf"
@@ -10,6 +11,19 @@ import (
 	"github.com/labstack/echo"
 )
 
+// ReaderFilesReporter 的 runner 可以返回 reader 中每个文件的读取状态
+type ReaderFilesReporter interface {
+	ReaderFiles() ([]reader.FileStatus, error)
+}
+
+func (r *LogExportRunner) ReaderFiles() ([]reader.FileStatus, error) {
+	dr, ok := r.reader.(reader.DetailedStatusReader)
+	if !ok {
+		return nil, errors.New("reader of runner " + r.Name() + " does not support file status")
+	}
+	return dr.DetailedStatus(), nil
+}
+
 // get /logkit/reader/usages 获取Reader用途
 func (rs *RestService) GetReaderUsages() echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -62,3 +76,23 @@ func (rs *RestService) PostReaderCheck() echo.HandlerFunc {
 		return RespSuccess(c, nil)
 	}
 }
+
+// get /logkit/reader/files/<name> 获取 runner 的 reader 中每个文件的读取状态
+func (rs *RestService) GetReaderFiles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		r, ok := rs.mgr.getRunnerByName(name)
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrReaderFiles, "runner "+name+" is not found or not running")
+		}
+		fr, ok := r.(ReaderFilesReporter)
+		if !ok {
+			return RespError(c, http.StatusBadRequest, ErrReaderFiles, "runner "+name+" does not support reader file status")
+		}
+		files, err := fr.ReaderFiles()
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrReaderFiles, err.Error())
+		}
+		return RespSuccess(c, files)
+	}
+}
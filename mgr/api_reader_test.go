@@ -2,9 +2,12 @@ package mgr
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"testing"
 
 	"github.com/json-iterator/go"
+	"github.com/labstack/echo"
 	"github.com/qiniu/logkit/reader"
 	"github.com/stretchr/testify/assert"
 )
@@ -93,3 +96,43 @@ func readerAPITest(p *testParam) {
 	}
 	assert.Equal(t, reader.ModeToolTips, got5.Data)
 }
+
+type detailedStatusReader struct {
+	reader.Reader
+	status []reader.FileStatus
+}
+
+func (r *detailedStatusReader) DetailedStatus() []reader.FileStatus {
+	return r.status
+}
+
+func TestGetReaderFiles(t *testing.T) {
+	dir := "TestGetReaderFiles"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir + "/rest"})
+	assert.NoError(t, err)
+	dr := &detailedStatusReader{status: []reader.FileStatus{{Path: "/logs/a.log", Offset: 10, Lag: 5, Lines: 2}}}
+	m.runners["r1.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}, reader: dr}
+	m.runners["r2.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r2"}}
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/reader/files/:name", rs.GetReaderFiles())
+
+	request := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, PREFIX+"/reader/files/"+name, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("r1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"path":"/logs/a.log"`)
+	assert.Contains(t, rec.Body.String(), `"lag":5`)
+
+	rec = request("r2")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request("r3")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,512 @@
+package mgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// 导入时与已有 runner 同名的处理策略
+const (
+	ImportPolicySkip      = "skip"      // 跳过已存在的 runner
+	ImportPolicyOverwrite = "overwrite" // 用导入的配置更新已存在的 runner
+	ImportPolicyFail      = "fail"      // 存在任何冲突时不导入任何 runner
+
+	ConfigArchiveVersion = 1
+
+	archiveManifest  = "manifest.json"
+	archiveRunners   = "runners"
+	archiveSlaves    = "slaves"
+	archiveConfExt   = ".conf"
+	maxArchiveMemory = 64 << 20
+)
+
+// ConfigArchiveManifest 描述导出的配置包, 对应配置包中的 manifest.json
+type ConfigArchiveManifest struct {
+	Version       int                        `json:"version"`
+	LogkitVersion string                     `json:"logkit_version"`
+	ExportTime    time.Time                  `json:"export_time"`
+	Runners       []string                   `json:"runners"`
+	Cluster       map[string]SlaveAssignment `json:"cluster,omitempty"` // key 为 slave 的 url, 只有 master 导出时才有
+}
+
+// SlaveAssignment 记录 slave 的 tag、labels 以及其上运行的 runner
+type SlaveAssignment struct {
+	Tag     string            `json:"tag"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Runners []string          `json:"runners"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// ConfigArchive 是解析后的配置包, 配置包为 tar.gz 格式, 结构如下:
+//
+//	manifest.json
+//	runners/<runner>.conf
+//	slaves/<url 编码后的 slave url>/<runner>.conf
+type ConfigArchive struct {
+	Manifest ConfigArchiveManifest
+	Runners  map[string]RunnerConfig
+	Slaves   map[string]map[string]RunnerConfig
+}
+
+// ImportResult 是导入配置包的结果
+type ImportResult struct {
+	DryRun  bool                    `json:"dry_run"`
+	Created []string                `json:"created"`
+	Updated []string                `json:"updated"`
+	Skipped []string                `json:"skipped"`
+	Failed  map[string]string       `json:"failed"`
+	Slaves  map[string]ImportResult `json:"slaves,omitempty"`
+}
+
+func newImportResult(dryRun bool) ImportResult {
+	return ImportResult{
+		DryRun:  dryRun,
+		Created: make([]string, 0),
+		Updated: make([]string, 0),
+		Skipped: make([]string, 0),
+		Failed:  make(map[string]string),
+	}
+}
+
+func checkImportPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return ImportPolicySkip, nil
+	case ImportPolicySkip, ImportPolicyOverwrite, ImportPolicyFail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("import policy %v is not supported, should be one of %v, %v, %v",
+		policy, ImportPolicySkip, ImportPolicyOverwrite, ImportPolicyFail)
+}
+
+func checkRunnerNameForImport(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid runner name %q", name)
+	}
+	return nil
+}
+
+// validateImportConfig 在导入前对配置做基本的校验
+func validateImportConfig(name string, conf RunnerConfig) error {
+	if err := checkRunnerNameForImport(name); err != nil {
+		return err
+	}
+	if conf.ReaderConfig == nil && len(conf.MetricConfig) == 0 {
+		return fmt.Errorf("runner %v has neither reader nor metric config", name)
+	}
+	if len(conf.SendersConfig) == 0 {
+		return fmt.Errorf("runner %v has no sender config", name)
+	}
+	return nil
+}
+
+func runnerNameOfFile(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), archiveConfExt)
+}
+
+// exportRunnerConfigs 返回所有 runner 配置的副本, key 为 runner 配置文件的名字, 与 rest 接口中的 name 一致
+func (m *Manager) exportRunnerConfigs() (map[string]RunnerConfig, error) {
+	m.lock.RLock()
+	data, err := json.Marshal(m.runnerConfig)
+	m.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	confs := make(map[string]RunnerConfig)
+	if err = json.Unmarshal(data, &confs); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]RunnerConfig, len(confs))
+	for file, conf := range confs {
+		conf.IsInWebFolder = true
+		ret[runnerNameOfFile(file)] = TrimSecretInfo(conf)
+	}
+	return ret, nil
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, v interface{}, modTime time.Time) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// WriteConfigArchive 把配置包以 tar.gz 的格式写入 w
+func WriteConfigArchive(w io.Writer, archive *ConfigArchive) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	modTime := archive.Manifest.ExportTime
+	if err := writeArchiveFile(tw, archiveManifest, archive.Manifest, modTime); err != nil {
+		return err
+	}
+	for name, conf := range archive.Runners {
+		if err := writeArchiveFile(tw, path.Join(archiveRunners, name+archiveConfExt), conf, modTime); err != nil {
+			return err
+		}
+	}
+	for slave, confs := range archive.Slaves {
+		dir := path.Join(archiveSlaves, url.QueryEscape(slave))
+		for name, conf := range confs {
+			if err := writeArchiveFile(tw, path.Join(dir, name+archiveConfExt), conf, modTime); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ReadConfigArchive 解析 tar.gz 格式的配置包
+func ReadConfigArchive(r io.Reader) (*ConfigArchive, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read gzip error %v", err)
+	}
+	defer gr.Close()
+	archive := &ConfigArchive{
+		Runners: make(map[string]RunnerConfig),
+		Slaves:  make(map[string]map[string]RunnerConfig),
+	}
+	hasManifest := false
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar error %v", err)
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(tr, maxArchiveMemory))
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		if name == archiveManifest {
+			if err = json.Unmarshal(data, &archive.Manifest); err != nil {
+				return nil, fmt.Errorf("parse %v error %v", archiveManifest, err)
+			}
+			hasManifest = true
+			continue
+		}
+		if path.Ext(name) != archiveConfExt {
+			continue
+		}
+		var conf RunnerConfig
+		if err = json.Unmarshal(data, &conf); err != nil {
+			return nil, fmt.Errorf("parse %v error %v", name, err)
+		}
+		runnerName := strings.TrimSuffix(path.Base(name), archiveConfExt)
+		switch dir := path.Dir(name); {
+		case dir == archiveRunners:
+			archive.Runners[runnerName] = conf
+		case path.Dir(dir) == archiveSlaves:
+			slave, err := url.QueryUnescape(path.Base(dir))
+			if err != nil {
+				return nil, fmt.Errorf("invalid slave dir %v: %v", dir, err)
+			}
+			if archive.Slaves[slave] == nil {
+				archive.Slaves[slave] = make(map[string]RunnerConfig)
+			}
+			archive.Slaves[slave][runnerName] = conf
+		}
+	}
+	if !hasManifest {
+		return nil, errors.New("invalid config archive: " + archiveManifest + " is not found")
+	}
+	if archive.Manifest.Version > ConfigArchiveVersion {
+		return nil, fmt.Errorf("config archive version %v is newer than supported version %v", archive.Manifest.Version, ConfigArchiveVersion)
+	}
+	return archive, nil
+}
+
+// ExportConfigs 导出本机所有 runner 的配置
+func (m *Manager) ExportConfigs() (*ConfigArchive, error) {
+	confs, err := m.exportRunnerConfigs()
+	if err != nil {
+		return nil, err
+	}
+	archive := &ConfigArchive{
+		Manifest: ConfigArchiveManifest{
+			Version:       ConfigArchiveVersion,
+			LogkitVersion: m.Version,
+			ExportTime:    time.Now(),
+			Runners:       sortedRunnerNames(confs),
+		},
+		Runners: confs,
+		Slaves:  make(map[string]map[string]RunnerConfig),
+	}
+	return archive, nil
+}
+
+func sortedRunnerNames(confs map[string]RunnerConfig) []string {
+	names := make([]string, 0, len(confs))
+	for name := range confs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImportConfigs 按照 policy 导入配置包中本机的 runner, 所有配置都校验通过后才会开始导入,
+// afterApply 不为空时会在每个 runner 导入后被调用, 用于记录审计日志
+func (m *Manager) ImportConfigs(archive *ConfigArchive, policy string, dryRun bool,
+	afterApply func(action, name string, before map[string]interface{}, err error)) (ImportResult, error) {
+	result := newImportResult(dryRun)
+	policy, err := checkImportPolicy(policy)
+	if err != nil {
+		return result, err
+	}
+	names := sortedRunnerNames(archive.Runners)
+	var invalid, conflicts []string
+	for _, name := range names {
+		if err := validateImportConfig(name, archive.Runners[name]); err != nil {
+			invalid = append(invalid, err.Error())
+		}
+		if m.hasRunnerConfig(name) {
+			conflicts = append(conflicts, name)
+		}
+	}
+	if len(invalid) > 0 {
+		return result, errors.New("invalid config archive: " + strings.Join(invalid, "; "))
+	}
+	if policy == ImportPolicyFail && len(conflicts) > 0 {
+		return result, fmt.Errorf("runners %v already exist", strings.Join(conflicts, ","))
+	}
+
+	for _, name := range names {
+		conf := archive.Runners[name]
+		conf.IsInWebFolder = true
+		exist := m.hasRunnerConfig(name)
+		if exist && policy == ImportPolicySkip {
+			result.Skipped = append(result.Skipped, name)
+			continue
+		}
+		if dryRun {
+			if exist {
+				result.Updated = append(result.Updated, name)
+			} else {
+				result.Created = append(result.Created, name)
+			}
+			continue
+		}
+		before := m.auditSnapshot(name)
+		action := AuditActionCreate
+		if exist {
+			action = AuditActionUpdate
+			err = m.UpdateRunner(name, conf)
+		} else {
+			err = m.AddRunner(name, conf)
+		}
+		if afterApply != nil {
+			afterApply(action, name, before, err)
+		}
+		switch {
+		case err != nil:
+			log.Errorf("import runner %v error %v", name, err)
+			result.Failed[name] = err.Error()
+		case exist:
+			result.Updated = append(result.Updated, name)
+		default:
+			result.Created = append(result.Created, name)
+		}
+	}
+	return result, nil
+}
+
+func (m *Manager) hasRunnerConfig(name string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.runnerConfig[filepath.Join(m.RestDir, name+archiveConfExt)]
+	return ok
+}
+
+// exportClusterConfigs 获取所有 slave 上的 runner 配置, 写入配置包中
+func (rs *RestService) exportClusterConfigs(archive *ConfigArchive) {
+	rs.cluster.mutex.RLock()
+	slaves := make([]Slave, len(rs.cluster.slaves))
+	copy(slaves, rs.cluster.slaves)
+	rs.cluster.mutex.RUnlock()
+
+	archive.Manifest.Cluster = make(map[string]SlaveAssignment, len(slaves))
+	mutex := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, v := range slaves {
+		wg.Add(1)
+		go func(v Slave) {
+			defer wg.Done()
+			sa := SlaveAssignment{Tag: v.Tag, Labels: v.Labels, Runners: make([]string, 0)}
+			confs := make(map[string]RunnerConfig)
+			respCode, respBody, err := executeToOneCluster(v.Url+PREFIX+"/configs", http.MethodGet, []byte{})
+			var respRss respRunnerConfigs
+			if err != nil || respCode != http.StatusOK {
+				sa.Error = fmt.Sprintf("%v %v", string(respBody), err)
+			} else if err = json.Unmarshal(respBody, &respRss); err != nil {
+				sa.Error = fmt.Sprintf("unmarshal query result error %v, body is %v", err, string(respBody))
+			} else {
+				for file, conf := range respRss.Data {
+					confs[runnerNameOfFile(file)] = conf
+				}
+				sa.Runners = sortedRunnerNames(confs)
+			}
+			mutex.Lock()
+			archive.Manifest.Cluster[v.Url] = sa
+			archive.Slaves[v.Url] = confs
+			mutex.Unlock()
+		}(v)
+	}
+	wg.Wait()
+}
+
+// importClusterConfigs 把配置包中每个 slave 的 runner 通过 slave 的导入接口下发到对应的 slave 上
+func (rs *RestService) importClusterConfigs(archive *ConfigArchive, policy string, dryRun bool) map[string]ImportResult {
+	rs.cluster.mutex.RLock()
+	registered := make(map[string]bool, len(rs.cluster.slaves))
+	for _, v := range rs.cluster.slaves {
+		registered[v.Url] = v.Status == StatusOK
+	}
+	rs.cluster.mutex.RUnlock()
+
+	results := make(map[string]ImportResult, len(archive.Slaves))
+	mutex := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for slave, confs := range archive.Slaves {
+		wg.Add(1)
+		go func(slave string, confs map[string]RunnerConfig) {
+			defer wg.Done()
+			result := newImportResult(dryRun)
+			fail := func(err error) {
+				for name := range confs {
+					result.Failed[name] = err.Error()
+				}
+			}
+			var buf bytes.Buffer
+			if ok, exist := registered[slave]; !exist {
+				fail(fmt.Errorf("slave %v is not registered", slave))
+			} else if !ok {
+				fail(fmt.Errorf("slave %v is not healthy", slave))
+			} else if err := WriteConfigArchive(&buf, &ConfigArchive{
+				Manifest: ConfigArchiveManifest{
+					Version:       ConfigArchiveVersion,
+					LogkitVersion: archive.Manifest.LogkitVersion,
+					ExportTime:    archive.Manifest.ExportTime,
+					Runners:       sortedRunnerNames(confs),
+				},
+				Runners: confs,
+			}); err != nil {
+				fail(err)
+			} else {
+				u := fmt.Sprintf("%v%v/import?policy=%v&dry_run=%v", slave, PREFIX, policy, dryRun)
+				respCode, respBody, err := executeToOneCluster(u, http.MethodPost, buf.Bytes())
+				var resp struct {
+					Code    string       `json:"code"`
+					Message string       `json:"message"`
+					Data    ImportResult `json:"data"`
+				}
+				if err != nil {
+					fail(err)
+				} else if jerr := json.Unmarshal(respBody, &resp); jerr != nil {
+					fail(fmt.Errorf("unmarshal import result error %v, body is %v", jerr, string(respBody)))
+				} else if respCode != http.StatusOK {
+					fail(errors.New(resp.Message))
+				} else {
+					result = resp.Data
+				}
+			}
+			mutex.Lock()
+			results[slave] = result
+			mutex.Unlock()
+		}(slave, confs)
+	}
+	wg.Wait()
+	return results
+}
+
+// GET /logkit/export
+func (rs *RestService) GetExport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		archive, err := rs.mgr.ExportConfigs()
+		if err != nil {
+			return RespError(c, http.StatusInternalServerError, ErrConfigsExport, err.Error())
+		}
+		if rs.cluster.Enable && rs.cluster.IsMaster {
+			rs.exportClusterConfigs(archive)
+		}
+		var buf bytes.Buffer
+		if err = WriteConfigArchive(&buf, archive); err != nil {
+			return RespError(c, http.StatusInternalServerError, ErrConfigsExport, err.Error())
+		}
+		filename := "logkit-configs-" + archive.Manifest.ExportTime.Format("20060102150405") + ".tar.gz"
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+		return c.Blob(http.StatusOK, "application/gzip", buf.Bytes())
+	}
+}
+
+// POST /logkit/import?policy=<skip|overwrite|fail>&dry_run=<true|false>&cluster=<true|false>
+func (rs *RestService) PostImport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		policy, err := checkImportPolicy(c.QueryParam("policy"))
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrConfigsImport, err.Error())
+		}
+		var dryRun, cluster bool
+		if v := c.QueryParam("dry_run"); v != "" {
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				return RespError(c, http.StatusBadRequest, ErrConfigsImport, "invalid dry_run: "+err.Error())
+			}
+		}
+		if v := c.QueryParam("cluster"); v != "" {
+			if cluster, err = strconv.ParseBool(v); err != nil {
+				return RespError(c, http.StatusBadRequest, ErrConfigsImport, "invalid cluster: "+err.Error())
+			}
+		}
+		if cluster && !(rs.cluster.Enable && rs.cluster.IsMaster) {
+			return RespError(c, http.StatusBadRequest, ErrConfigsImport, "only cluster master can import slave configs")
+		}
+		archive, err := ReadConfigArchive(io.LimitReader(c.Request().Body, maxArchiveMemory))
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrConfigsImport, err.Error())
+		}
+		result, err := rs.mgr.ImportConfigs(archive, policy, dryRun, func(action, name string, before map[string]interface{}, err error) {
+			rs.audit(c, action, name, before, err)
+		})
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrConfigsImport, err.Error())
+		}
+		if cluster {
+			result.Slaves = rs.importClusterConfigs(archive, policy, dryRun)
+		}
+		return RespSuccess(c, result)
+	}
+}
@@ -0,0 +1,88 @@
+package mgr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+func TestConfigArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestConfigArchive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir, ServerBackup: true})
+	assert.NoError(t, err)
+	m.Version = "v1.0.0"
+	m.runnerConfig[filepath.Join(dir, "r1.conf")] = RunnerConfig{
+		RunnerInfo:    RunnerInfo{RunnerName: "r1"},
+		ReaderConfig:  conf.MapConf{"mode": "dir", "log_path": "/tmp/r1"},
+		SendersConfig: []conf.MapConf{{"sender_type": "discard"}},
+	}
+
+	archive, err := m.ExportConfigs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r1"}, archive.Manifest.Runners)
+	archive.Runners["r2"] = RunnerConfig{
+		RunnerInfo:    RunnerInfo{RunnerName: "r2"},
+		ReaderConfig:  conf.MapConf{"mode": "dir", "log_path": "/tmp/r2"},
+		SendersConfig: []conf.MapConf{{"sender_type": "discard"}},
+	}
+	archive.Slaves["http://10.0.0.1:3000"] = map[string]RunnerConfig{"s1": archive.Runners["r2"]}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteConfigArchive(&buf, archive))
+	got, err := ReadConfigArchive(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", got.Manifest.LogkitVersion)
+	assert.Len(t, got.Runners, 2)
+	assert.Equal(t, "/tmp/r1", got.Runners["r1"].ReaderConfig["log_path"])
+	assert.Equal(t, "/tmp/r2", got.Slaves["http://10.0.0.1:3000"]["s1"].ReaderConfig["log_path"])
+
+	result, err := m.ImportConfigs(got, ImportPolicySkip, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r2"}, result.Created)
+	assert.Equal(t, []string{"r1"}, result.Skipped)
+
+	result, err = m.ImportConfigs(got, ImportPolicyOverwrite, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r1"}, result.Updated)
+
+	_, err = m.ImportConfigs(got, ImportPolicyFail, true, nil)
+	assert.Error(t, err)
+	_, err = m.ImportConfigs(got, "merge", true, nil)
+	assert.Error(t, err)
+
+	got.Runners["../r3"] = got.Runners["r2"]
+	_, err = m.ImportConfigs(got, ImportPolicySkip, true, nil)
+	assert.Error(t, err)
+
+	_, err = ReadConfigArchive(bytes.NewReader([]byte("not a gzip")))
+	assert.Error(t, err)
+
+	rs := &RestService{mgr: m, cluster: NewCluster(&ClusterConfig{})}
+	router := echo.New()
+	router.GET(PREFIX+"/export", rs.GetExport())
+	router.POST(PREFIX+"/import", rs.PostImport())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+"/export", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), ".tar.gz")
+
+	rec2 := httptest.NewRecorder()
+	router.ServeHTTP(rec2, httptest.NewRequest(http.MethodPost, PREFIX+"/import?dry_run=true&policy=overwrite", rec.Body))
+	assert.Equal(t, http.StatusOK, rec2.Code)
+	assert.Contains(t, rec2.Body.String(), `"updated":["r1"]`)
+
+	rec3 := httptest.NewRecorder()
+	router.ServeHTTP(rec3, httptest.NewRequest(http.MethodPost, PREFIX+"/import?cluster=true", nil))
+	assert.Equal(t, http.StatusBadRequest, rec3.Code)
+}
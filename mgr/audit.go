@@ -0,0 +1,306 @@
+package mgr
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionStart  = "start"
+	AuditActionStop   = "stop"
+	AuditActionReset  = "reset"
+	// AuditActionCheckpoint 导入 reader 的读取进度
+	AuditActionCheckpoint = "checkpoint"
+
+	// AuditUserHeader 没有使用 basic auth 时, 可以通过这个 header 指定操作人
+	AuditUserHeader = "X-Logkit-User"
+
+	DefaultAuditQueryLimit = 100
+
+	auditMaskedValue = "******"
+	auditAnonymous   = "anonymous"
+)
+
+// 配置项的 key 中包含这些字符串时, 审计日志中不记录其明文
+var auditSensitiveKeys = []string{"password", "passwd", "secret", "token", "_sk", "access_key"}
+
+// AuditRecord 是审计日志中的一条记录, 每条记录以一行 JSON 的形式追加到审计日志文件中
+type AuditRecord struct {
+	Time       time.Time              `json:"time"`
+	User       string                 `json:"user"`
+	RemoteAddr string                 `json:"remote_addr"`
+	Action     string                 `json:"action"`
+	Runner     string                 `json:"runner"`
+	Success    bool                   `json:"success"`
+	Error      string                 `json:"error,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	Diff       []AuditChange          `json:"diff,omitempty"`
+}
+
+// AuditChange 描述一个配置项在操作前后的变化, key 为以 . 分隔的路径, 如 senders[0].pandora_repo_name
+type AuditChange struct {
+	Key    string      `json:"key"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditQuery 是查询审计日志的条件, 为空的条件不做过滤
+type AuditQuery struct {
+	Runner string
+	Action string
+	User   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (q AuditQuery) match(r AuditRecord) bool {
+	if q.Runner != "" && q.Runner != r.Runner {
+		return false
+	}
+	if q.Action != "" && q.Action != r.Action {
+		return false
+	}
+	if q.User != "" && q.User != r.User {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// auditLog 以只追加的方式把审计记录写入文件
+type auditLog struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+func newAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %v error %v", path, err)
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+func (a *auditLog) Record(r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query 返回满足条件的记录, 最新的在前面
+func (a *auditLog) Query(q AuditQuery) ([]AuditRecord, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultAuditQueryLimit
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]AuditRecord, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			log.Warnf("skip invalid audit record %q: %v", scanner.Text(), err)
+			continue
+		}
+		if q.match(r) {
+			records = append(records, r)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+func (a *auditLog) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.file.Close()
+}
+
+// auditSnapshot 返回 runner 当前配置的快照, 敏感信息已被隐去, 没有开启审计或者 runner 不存在时返回 nil
+func (m *Manager) auditSnapshot(name string) map[string]interface{} {
+	if m.audit == nil {
+		return nil
+	}
+	m.lock.RLock()
+	conf, ok := m.runnerConfig[filepath.Join(m.RestDir, name+".conf")]
+	var data []byte
+	var err error
+	if ok {
+		data, err = json.Marshal(conf)
+	}
+	m.lock.RUnlock()
+	if !ok || err != nil {
+		return nil
+	}
+	snapshot := make(map[string]interface{})
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return nil
+	}
+	return maskSensitive(snapshot).(map[string]interface{})
+}
+
+// recordAudit 记录一次对 runner 的操作, before 为操作前的快照, 操作后的快照在这里获取
+func (m *Manager) recordAudit(user, remoteAddr, action, name string, before map[string]interface{}, opErr error) {
+	if m.audit == nil {
+		return
+	}
+	after := m.auditSnapshot(name)
+	r := AuditRecord{
+		Time:       time.Now(),
+		User:       user,
+		RemoteAddr: remoteAddr,
+		Action:     action,
+		Runner:     name,
+		Success:    opErr == nil,
+		Before:     before,
+		After:      after,
+		Diff:       diffAuditSnapshot(before, after),
+	}
+	if opErr != nil {
+		r.Error = opErr.Error()
+	}
+	if err := m.audit.Record(r); err != nil {
+		log.Errorf("record audit log %v of runner %v error %v", action, name, err)
+	}
+}
+
+// AuditRecords 按条件查询审计日志
+func (m *Manager) AuditRecords(q AuditQuery) ([]AuditRecord, error) {
+	if m.audit == nil {
+		return nil, fmt.Errorf("audit log is disabled, please set audit_log_path in logkit.conf")
+	}
+	return m.audit.Query(q)
+}
+
+// auditUser 返回操作人, 优先使用 basic auth 的用户名
+func auditUser(c echo.Context) string {
+	if user, _, ok := c.Request().BasicAuth(); ok && user != "" {
+		return user
+	}
+	if user := c.Request().Header.Get(AuditUserHeader); user != "" {
+		return user
+	}
+	return auditAnonymous
+}
+
+func (rs *RestService) audit(c echo.Context, action, name string, before map[string]interface{}, opErr error) {
+	rs.mgr.recordAudit(auditUser(c), c.RealIP(), action, name, before, opErr)
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range auditSensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func maskSensitive(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range value {
+			if s, ok := sub.(string); ok && s != "" && isSensitiveKey(k) {
+				value[k] = auditMaskedValue
+				continue
+			}
+			value[k] = maskSensitive(sub)
+		}
+	case []interface{}:
+		for i, sub := range value {
+			value[i] = maskSensitive(sub)
+		}
+	}
+	return v
+}
+
+func flattenAuditSnapshot(prefix string, v interface{}, dst map[string]interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range value {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenAuditSnapshot(key, sub, dst)
+		}
+	case []interface{}:
+		for i, sub := range value {
+			flattenAuditSnapshot(fmt.Sprintf("%s[%d]", prefix, i), sub, dst)
+		}
+	default:
+		dst[prefix] = v
+	}
+}
+
+// diffAuditSnapshot 比较操作前后的快照, 返回按 key 排序的变化列表
+func diffAuditSnapshot(before, after map[string]interface{}) []AuditChange {
+	b, a := make(map[string]interface{}), make(map[string]interface{})
+	flattenAuditSnapshot("", before, b)
+	flattenAuditSnapshot("", after, a)
+	keys := make([]string, 0, len(b)+len(a))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	changes := make([]AuditChange, 0)
+	for _, k := range keys {
+		bv, bok := b[k]
+		av, aok := a[k]
+		if bok && aok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		changes = append(changes, AuditChange{Key: k, Before: bv, After: av})
+	}
+	return changes
+}
@@ -0,0 +1,89 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestAuditLog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir, ServerBackup: true, AuditLogPath: filepath.Join(dir, "audit.log")})
+	assert.NoError(t, err)
+	defer m.audit.Close()
+
+	file := filepath.Join(dir, "r1.conf")
+	before := m.auditSnapshot("r1")
+	assert.Nil(t, before)
+	m.runnerConfig[file] = RunnerConfig{
+		RunnerInfo:   RunnerInfo{RunnerName: "r1"},
+		ReaderConfig: conf.MapConf{"mode": "dir"},
+		SendersConfig: []conf.MapConf{
+			{"sender_type": "pandora", "pandora_sk": "sk1", "pandora_repo_name": "repo1"},
+		},
+	}
+	m.recordAudit("admin", "10.0.0.1", AuditActionCreate, "r1", before, nil)
+
+	before = m.auditSnapshot("r1")
+	assert.Equal(t, auditMaskedValue, before["senders"].([]interface{})[0].(map[string]interface{})["pandora_sk"])
+	rc := m.runnerConfig[file]
+	rc.SendersConfig[0]["pandora_repo_name"] = "repo2"
+	m.runnerConfig[file] = rc
+	m.recordAudit("admin", "10.0.0.1", AuditActionUpdate, "r1", before, nil)
+
+	delete(m.runnerConfig, file)
+	m.recordAudit("bob", "10.0.0.2", AuditActionDelete, "r2", nil, os.ErrNotExist)
+
+	records, err := m.AuditRecords(AuditQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, AuditActionDelete, records[0].Action)
+	assert.False(t, records[0].Success)
+	assert.Equal(t, os.ErrNotExist.Error(), records[0].Error)
+	assert.Equal(t, []AuditChange{{Key: "senders[0].pandora_repo_name", Before: "repo1", After: "repo2"}}, records[1].Diff)
+	assert.Nil(t, records[2].Before)
+	assert.NotNil(t, records[2].After)
+
+	records, err = m.AuditRecords(AuditQuery{Runner: "r1", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, AuditActionUpdate, records[0].Action)
+
+	records, err = m.AuditRecords(AuditQuery{User: "bob"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/audit", rs.GetAuditRecords())
+	req := httptest.NewRequest(http.MethodGet, PREFIX+"/audit?action=create", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"action":"create"`)
+
+	req = httptest.NewRequest(http.MethodGet, PREFIX+"/audit?since=yesterday", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuditUser(t *testing.T) {
+	router := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, auditAnonymous, auditUser(router.NewContext(req, httptest.NewRecorder())))
+	req.Header.Set(AuditUserHeader, "alice")
+	assert.Equal(t, "alice", auditUser(router.NewContext(req, httptest.NewRecorder())))
+	req.SetBasicAuth("bob", "pwd")
+	assert.Equal(t, "bob", auditUser(router.NewContext(req, httptest.NewRecorder())))
+}
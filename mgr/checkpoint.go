@@ -0,0 +1,105 @@
+package mgr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// runnerMeta 按照 NewLogExportRunner 的方式根据配置创建 runner 的 meta，runner 不需要处于运行状态
+func runnerMeta(rc RunnerConfig) (*reader.Meta, error) {
+	if rc.ReaderConfig == nil {
+		return nil, errors.New(rc.RunnerName + " readerConfig is nil")
+	}
+	rc.ReaderConfig[GlobalKeyName] = rc.RunnerName
+	rc.ReaderConfig[KeyRunnerName] = rc.RunnerName
+	if rc.ReaderConfig[reader.KeyMode] == reader.ModeCloudTrail {
+		rc.ReaderConfig[reader.KeyLogPath] = cloudTrailSyncDir(rc)
+	}
+	return reader.NewMetaWithConf(rc.ReaderConfig)
+}
+
+// checkpointMeta 返回 runner 的 meta 以及 runner 是否正在运行，runner 按名字查找，
+// 包括 RestDir 以及 ConfDirs 中加载的配置
+func (m *Manager) checkpointMeta(name string) (meta *reader.Meta, running bool, err error) {
+	var (
+		rc RunnerConfig
+		ok bool
+	)
+	m.lock.RLock()
+	for filename, c := range m.runnerConfig {
+		if c.RunnerName == name {
+			rc, ok = c, true
+			_, running = m.runners[filename]
+			break
+		}
+	}
+	m.lock.RUnlock()
+	if !ok {
+		return nil, false, fmt.Errorf("runner %v is not found", name)
+	}
+	// runnerMeta 会修改 ReaderConfig，复制一份，不影响保存的配置
+	readerConf := make(conf.MapConf, len(rc.ReaderConfig))
+	for k, v := range rc.ReaderConfig {
+		readerConf[k] = v
+	}
+	rc.ReaderConfig = readerConf
+	meta, err = runnerMeta(rc)
+	return meta, running, err
+}
+
+// ExportCheckpoint 导出 runner 的读取进度，runner 运行中时导出的是最近一次同步到 meta 中的进度
+func (m *Manager) ExportCheckpoint(name string) (*reader.MetaSnapshot, error) {
+	meta, _, err := m.checkpointMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Export()
+}
+
+// ImportCheckpoint 把其他机器上导出的读取进度导入到 runner 中，
+// runner 需要处于停止状态，避免运行中的 reader 用内存中的进度覆盖导入的内容
+func (m *Manager) ImportCheckpoint(name string, snapshot *reader.MetaSnapshot) error {
+	meta, running, err := m.checkpointMeta(name)
+	if err != nil {
+		return err
+	}
+	if running {
+		return fmt.Errorf("runner %v is running, stop it before importing checkpoint", name)
+	}
+	return meta.Import(snapshot)
+}
+
+// GET /logkit/configs/<name>/checkpoint 导出 runner 的读取进度
+func (rs *RestService) GetConfigCheckpoint() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		snapshot, err := rs.mgr.ExportCheckpoint(c.Param("name"))
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrCheckpoint, err.Error())
+		}
+		return RespSuccess(c, snapshot)
+	}
+}
+
+// PUT /logkit/configs/<name>/checkpoint 导入其他机器上导出的读取进度，runner 需要处于停止状态
+func (rs *RestService) PutConfigCheckpoint() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		name := c.Param("name")
+		var snapshot reader.MetaSnapshot
+		if err = c.Bind(&snapshot); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrCheckpoint, err.Error())
+		}
+		err = rs.mgr.ImportCheckpoint(name, &snapshot)
+		rs.audit(c, AuditActionCheckpoint, name, nil, err)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrCheckpoint, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
@@ -0,0 +1,98 @@
+package mgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+)
+
+func TestConfigCheckpoint(t *testing.T) {
+	dir, err := filepath.Abs("TestConfigCheckpoint")
+	assert.NoError(t, err)
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("hello\n"), 0644))
+
+	m, err := NewManager(ManagerConfig{RestDir: dir + "/rest"})
+	assert.NoError(t, err)
+	newConf := func(name string) RunnerConfig {
+		return RunnerConfig{
+			RunnerName: name,
+			ReaderConfig: conf.MapConf{
+				reader.KeyMode:     reader.ModeFile,
+				reader.KeyLogPath:  logPath,
+				reader.KeyMetaPath: filepath.Join(dir, "meta_"+name),
+			},
+		}
+	}
+	m.runnerConfig[filepath.Join(m.RestDir, "src.conf")] = newConf("src")
+	m.runnerConfig[filepath.Join(m.RestDir, "dst.conf")] = newConf("dst")
+	m.runnerConfig[filepath.Join(m.RestDir, "running.conf")] = newConf("running")
+	m.runners[filepath.Join(m.RestDir, "running.conf")] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "running"}}
+	// conf 文件夹中加载的 runner 也按名字查找
+	m.runnerConfig[filepath.Join(dir, "confs", "other.conf")] = newConf("confdir")
+
+	srcMeta, err := runnerMeta(newConf("src"))
+	assert.NoError(t, err)
+	assert.NoError(t, srcMeta.WriteOffset(logPath, 6))
+
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/configs/:name/checkpoint", rs.GetConfigCheckpoint())
+	router.PUT(PREFIX+"/configs/:name/checkpoint", rs.PutConfigCheckpoint())
+	request := func(method, name string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, PREFIX+"/configs/"+name+"/checkpoint", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "src", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var ret struct {
+		Data reader.MetaSnapshot `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ret))
+	assert.Equal(t, "src", ret.Data.RunnerName)
+	assert.Equal(t, reader.ModeFile, ret.Data.Mode)
+	body, err := json.Marshal(ret.Data)
+	assert.NoError(t, err)
+
+	rec = request(http.MethodPut, "dst", body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	dstMeta, err := runnerMeta(newConf("dst"))
+	assert.NoError(t, err)
+	file, offset, err := dstMeta.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, logPath, file)
+	assert.Equal(t, int64(6), offset)
+
+	rec = request(http.MethodPut, "confdir", body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	confDirMeta, err := runnerMeta(newConf("confdir"))
+	assert.NoError(t, err)
+	_, offset, err = confDirMeta.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), offset)
+	rec = request(http.MethodGet, "confdir", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request(http.MethodPut, "running", body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(http.MethodGet, "notexist", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,11 +19,15 @@ import (
 )
 
 type ClusterConfig struct {
-	MasterUrl []string `json:"master_url"`
-	IsMaster  bool     `json:"is_master"`
-	Enable    bool     `json:"enable"`
-	Address   string   `json:"address"`
-	Tag       string   `json:"tag"`
+	MasterUrl []string          `json:"master_url"`
+	IsMaster  bool              `json:"is_master"`
+	Enable    bool              `json:"enable"`
+	Address   string            `json:"address"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels"`
+
+	HeartbeatInterval int `json:"heartbeat_interval"` // slave 发送心跳的间隔，master 也用它判断 slave 是否存活，单位秒
+	RemoveLostAfter   int `json:"remove_lost_after"`  // master 将失联超过该时长的 slave 从列表中移除，单位秒，0 表示不移除
 }
 
 type Cluster struct {
@@ -30,13 +35,31 @@ type Cluster struct {
 	slaves       []Slave
 	mutex        *sync.RWMutex
 	statusUpdate time.Time
+	exitChan     chan struct{}
+
+	rolloutMutex *sync.Mutex
+	rollouts     []*Rollout // 最近的滚动下发记录, 最新的在最后
+	rolloutSeq   int
 }
 
 type Slave struct {
-	Url       string    `json:"url"`
-	Tag       string    `json:"tag"`
-	Status    string    `json:"status"`
-	LastTouch time.Time `json:"last_touch"`
+	Url       string            `json:"url"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Upgrade   *UpgradeStatus    `json:"upgrade,omitempty"` // 最近一次升级的状态, 升级成功重启后为空
+	Runners   RunnersSummary    `json:"runners"`
+	Status    string            `json:"status"`
+	LastTouch time.Time         `json:"last_touch"`
+}
+
+// RunnersSummary 是 slave 随心跳上报的 runner 概况
+type RunnersSummary struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+	Stopped int `json:"stopped"`
+	Error   int `json:"error"`
 }
 
 type ClusterStatus struct {
@@ -77,7 +100,52 @@ const (
 	StatusLost = "lost"
 )
 
-const DefaultMyTag = "default"
+const (
+	DefaultMyTag             = "default"
+	DefaultHeartbeatInterval = 15
+)
+
+// 滚动下发配置相关的请求参数
+const (
+	KeySelector      = "selector"       // label 选择器, 形如 k1=v1,k2=v2
+	KeyBatchSize     = "batch_size"     // 每批下发的 slave 数量, 小于等于0代表一次性全部下发
+	KeyBatchInterval = "batch_interval" // 每批下发后等待多少秒再做健康检查
+	KeyHealthTimeout = "health_timeout" // 每批健康检查的超时时间, 单位秒
+
+	DefaultBatchInterval = 5
+	DefaultHealthTimeout = 30
+
+	// MaxRolloutHistory 是 master 保留的滚动下发记录数量
+	MaxRolloutHistory = 50
+)
+
+// 滚动下发的状态
+const (
+	RolloutRunning   = "running"
+	RolloutSucceeded = "succeeded"
+	RolloutFailed    = "failed"
+)
+
+// RollingOption 描述一次滚动下发的批次策略
+type RollingOption struct {
+	BatchSize     int
+	BatchInterval time.Duration
+	HealthTimeout time.Duration
+}
+
+// Rollout 记录一次在后台执行的滚动下发的进度
+type Rollout struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Runner    string    `json:"runner"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"` // 需要下发的 slave 数量
+	Done      int       `json:"done"`  // 已经下发并通过健康检查的 slave 数量
+	Batch     int       `json:"batch"` // 正在下发的批次, 从 1 开始
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
 
 func NewCluster(cc *ClusterConfig) *Cluster {
 	cl := new(Cluster)
@@ -85,59 +153,194 @@ func NewCluster(cc *ClusterConfig) *Cluster {
 	if cl.Tag == "" {
 		cl.Tag = DefaultMyTag
 	}
+	if cl.HeartbeatInterval <= 0 {
+		cl.HeartbeatInterval = DefaultHeartbeatInterval
+	}
 	cl.slaves = make([]Slave, 0)
 	cl.mutex = new(sync.RWMutex)
+	cl.exitChan = make(chan struct{})
+	cl.rolloutMutex = new(sync.Mutex)
 	return cl
 }
 
-func (cc *Cluster) RunRegisterLoop() error {
-	if err := Register(cc.MasterUrl, cc.Address, cc.Tag); err != nil {
+func (cc *Cluster) heartbeatInterval() time.Duration {
+	return time.Duration(cc.HeartbeatInterval) * time.Second
+}
+
+// RunRegisterLoop 向 master 注册，并按心跳间隔定期上报自身信息，每次上报的内容由 getReq 生成
+func (cc *Cluster) RunRegisterLoop(getReq func() RegisterReq) error {
+	if err := RegisterWithReq(cc.MasterUrl, getReq()); err != nil {
 		return fmt.Errorf("master %v is unavaliable", cc.MasterUrl)
 	}
 	go func() {
+		ticker := time.NewTicker(cc.heartbeatInterval())
+		defer ticker.Stop()
 		for {
-			time.Sleep(15 * time.Second)
-			if err := Register(cc.MasterUrl, cc.Address, cc.Tag); err != nil {
-				log.Errorf("master %v is unavaliable", cc.MasterUrl)
+			select {
+			case <-cc.exitChan:
+				return
+			case <-ticker.C:
+				if err := RegisterWithReq(cc.MasterUrl, getReq()); err != nil {
+					log.Errorf("master %v is unavaliable", cc.MasterUrl)
+				}
 			}
 		}
 	}()
 	return nil
 }
 
-func (cc *Cluster) AddSlave(url, tag string) {
+// RunLivenessLoop 是 master 定期检查 slave 心跳的循环, 发现 slave 状态变化或失联时打印日志
+func (cc *Cluster) RunLivenessLoop() {
+	go func() {
+		ticker := time.NewTicker(cc.heartbeatInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cc.exitChan:
+				return
+			case <-ticker.C:
+				cc.updateSlaveStatus(time.Now(), true)
+			}
+		}
+	}()
+}
+
+func (cc *Cluster) Stop() {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	select {
+	case <-cc.exitChan:
+	default:
+		close(cc.exitChan)
+	}
+}
+
+// StartRollout 在后台按批次下发，立即返回这次下发的记录，进度可以通过 GetRollout 查询
+func (cc *Cluster) StartRollout(slaves []Slave, urlP, method, mgr, runnerName string, reqBd []byte, opt RollingOption) Rollout {
+	cc.rolloutMutex.Lock()
+	cc.rolloutSeq++
+	rollout := &Rollout{
+		ID:        fmt.Sprintf("%v-%v", time.Now().Unix(), cc.rolloutSeq),
+		Operation: mgr,
+		Runner:    runnerName,
+		Status:    RolloutRunning,
+		Total:     len(slaves),
+		StartTime: time.Now(),
+	}
+	cc.rollouts = append(cc.rollouts, rollout)
+	if len(cc.rollouts) > MaxRolloutHistory {
+		cc.rollouts = cc.rollouts[len(cc.rollouts)-MaxRolloutHistory:]
+	}
+	ret := *rollout
+	cc.rolloutMutex.Unlock()
+
+	go func() {
+		err := executeRollingToClusters(slaves, urlP, method, mgr, runnerName, reqBd, opt, func(batch, done int) {
+			cc.rolloutMutex.Lock()
+			rollout.Batch, rollout.Done = batch, done
+			cc.rolloutMutex.Unlock()
+		})
+		cc.rolloutMutex.Lock()
+		defer cc.rolloutMutex.Unlock()
+		rollout.EndTime = time.Now()
+		if err != nil {
+			log.Errorf("rollout %v failed: %v", rollout.ID, err)
+			rollout.Status = RolloutFailed
+			rollout.Error = err.Error()
+			return
+		}
+		rollout.Status = RolloutSucceeded
+	}()
+	return ret
+}
+
+// GetRollout 返回指定 id 的滚动下发记录
+func (cc *Cluster) GetRollout(id string) (Rollout, bool) {
+	cc.rolloutMutex.Lock()
+	defer cc.rolloutMutex.Unlock()
+	for _, r := range cc.rollouts {
+		if r.ID == id {
+			return *r, true
+		}
+	}
+	return Rollout{}, false
+}
+
+// Rollouts 返回最近的滚动下发记录, 最新的在前
+func (cc *Cluster) Rollouts() []Rollout {
+	cc.rolloutMutex.Lock()
+	defer cc.rolloutMutex.Unlock()
+	ret := make([]Rollout, 0, len(cc.rollouts))
+	for i := len(cc.rollouts) - 1; i >= 0; i-- {
+		ret = append(ret, *cc.rollouts[i])
+	}
+	return ret
+}
+
+func (cc *Cluster) AddSlave(req RegisterReq) {
 	cc.mutex.Lock()
 	defer cc.mutex.Unlock()
 	for idx, v := range cc.slaves {
-		if v.Url == url {
-			v.Tag = tag
-			v.LastTouch = time.Now()
-			v.Status = StatusOK
-			cc.slaves[idx] = v
+		if v.Url == req.Url {
+			if v.Status != StatusOK {
+				log.Infof("slave %v(%v) is back online after %v", v.Url, v.Hostname, time.Since(v.LastTouch))
+			}
+			cc.slaves[idx] = newSlave(req)
 			return
 		}
 	}
-	cc.slaves = append(cc.slaves, Slave{url, tag, StatusOK, time.Now()})
+	log.Infof("slave %v(hostname: %v, version: %v) registered", req.Url, req.Hostname, req.Version)
+	cc.slaves = append(cc.slaves, newSlave(req))
 	return
 }
 
-func (cc *Cluster) UpdateSlaveStatus() {
-	now := time.Now()
-	if now.Sub(cc.statusUpdate) < 15*time.Second {
-		return
+func newSlave(req RegisterReq) Slave {
+	return Slave{
+		Url:       req.Url,
+		Tag:       req.Tag,
+		Labels:    req.Labels,
+		Hostname:  req.Hostname,
+		Version:   req.Version,
+		Upgrade:   req.Upgrade,
+		Runners:   req.Runners,
+		Status:    StatusOK,
+		LastTouch: time.Now(),
 	}
+}
+
+func (cc *Cluster) UpdateSlaveStatus() {
+	cc.updateSlaveStatus(time.Now(), false)
+}
+
+// updateSlaveStatus 根据最后一次心跳时间更新 slave 状态:
+// 两个心跳间隔内有联系为 ok，四个心跳间隔内有联系为 bad，否则为 lost
+func (cc *Cluster) updateSlaveStatus(now time.Time, force bool) {
+	interval := cc.heartbeatInterval()
 	cc.mutex.Lock()
 	defer cc.mutex.Unlock()
-	for idx, v := range cc.slaves {
-		if now.Sub(v.LastTouch) < 31*time.Second {
-			v.Status = StatusOK
-		} else if now.Sub(v.LastTouch) <= time.Minute {
-			v.Status = StatusBad
-		} else {
-			v.Status = StatusLost
+	if !force && now.Sub(cc.statusUpdate) < interval {
+		return
+	}
+	slaves := make([]Slave, 0, len(cc.slaves))
+	for _, v := range cc.slaves {
+		status := StatusLost
+		elapsed := now.Sub(v.LastTouch)
+		if elapsed <= 2*interval+time.Second {
+			status = StatusOK
+		} else if elapsed <= 4*interval {
+			status = StatusBad
+		}
+		if status != v.Status {
+			log.Warnf("slave %v(%v) status changed from %v to %v, last heartbeat %v ago", v.Url, v.Hostname, v.Status, status, elapsed)
 		}
-		cc.slaves[idx] = v
+		v.Status = status
+		if status == StatusLost && cc.RemoveLostAfter > 0 && elapsed > time.Duration(cc.RemoveLostAfter)*time.Second {
+			log.Warnf("slave %v(%v) has been lost for %v, remove it", v.Url, v.Hostname, elapsed)
+			continue
+		}
+		slaves = append(slaves, v)
 	}
+	cc.slaves = slaves
 	cc.statusUpdate = now
 }
 
@@ -162,17 +365,31 @@ func (rs *RestService) IsMaster() echo.HandlerFunc {
 }
 
 // master API
-// GET /logkit/cluster/slaves?tag=tagValue&url=urlValue
+// GET /logkit/cluster/slaves?tag=tagValue&url=urlValue&selector=k1=v1,k2=v2&status=statusValue
 func (rs *RestService) Slaves() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		_, tag, url, _, err := rs.checkClusterRequest(c)
 		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrClusterSlaves, err.Error())
 		}
+		selector, err := ParseLabelSelector(c.Request().Form.Get(KeySelector))
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterSlaves, err.Error())
+		}
+		status := c.Request().Form.Get("status")
 		rs.cluster.UpdateSlaveStatus()
 		rs.cluster.mutex.RLock()
-		slaves, _ := getQualifySlaves(rs.cluster.slaves, tag, url)
+		slaves, _ := getSelectedSlaves(rs.cluster.slaves, tag, url, selector)
 		rs.cluster.mutex.RUnlock()
+		if status != "" {
+			filtered := make([]Slave, 0)
+			for _, v := range slaves {
+				if v.Status == status {
+					filtered = append(filtered, v)
+				}
+			}
+			slaves = filtered
+		}
 		return RespSuccess(c, slaves)
 	}
 }
@@ -358,8 +575,13 @@ func (rs *RestService) GetClusterConfigs() echo.HandlerFunc {
 }
 
 type RegisterReq struct {
-	Url string `json:"url"`
-	Tag string `json:"tag"`
+	Url      string            `json:"url"`
+	Tag      string            `json:"tag"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Hostname string            `json:"hostname,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Upgrade  *UpgradeStatus    `json:"upgrade,omitempty"`
+	Runners  RunnersSummary    `json:"runners"`
 }
 
 // master API
@@ -375,7 +597,7 @@ func (rs *RestService) PostRegister() echo.HandlerFunc {
 			errMsg := "this is not master"
 			return RespError(c, http.StatusBadRequest, ErrClusterRegister, errMsg)
 		}
-		rs.cluster.AddSlave(req.Url, req.Tag)
+		rs.cluster.AddSlave(req)
 		return RespSuccess(c, nil)
 	}
 }
@@ -396,7 +618,9 @@ func (rs *RestService) PostTag() echo.HandlerFunc {
 			errMsg := "cluster function not configed"
 			return RespError(c, http.StatusBadRequest, ErrClusterTag, errMsg)
 		}
-		if err := Register(rs.cluster.MasterUrl, rs.cluster.Address, req.Tag); err != nil {
+		regReq := rs.registerReq()
+		regReq.Tag = req.Tag
+		if err := RegisterWithReq(rs.cluster.MasterUrl, regReq); err != nil {
 			return RespError(c, http.StatusServiceUnavailable, ErrClusterTag, err.Error())
 		}
 		rs.cluster.mutex.Lock()
@@ -406,15 +630,19 @@ func (rs *RestService) PostTag() echo.HandlerFunc {
 	}
 }
 
-// POST /logkit/cluster/configs/<name>?tag=tagValue&url=urlValue
+// POST /logkit/cluster/configs/<name>?tag=tagValue&url=urlValue&selector=k1=v1,k2=v2&batch_size=N
 func (rs *RestService) PostClusterConfig() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		configName, tag, url, configBytes, err := rs.checkClusterRequest(c)
 		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrClusterRunnerAdd, err.Error())
 		}
+		selector, opt, err := getRollingRequest(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterRunnerAdd, err.Error())
+		}
 		rs.cluster.mutex.RLock()
-		slaves, err := getQualifySlaves(rs.cluster.slaves, tag, url)
+		slaves, err := getSelectedSlaves(rs.cluster.slaves, tag, url, selector)
 		rs.cluster.mutex.RUnlock()
 		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrClusterRunnerAdd, err.Error())
@@ -422,6 +650,9 @@ func (rs *RestService) PostClusterConfig() echo.HandlerFunc {
 		method := http.MethodPost
 		mgrType := "add runner " + configName
 		urlPattern := "%v" + PREFIX + "/configs/" + configName
+		if opt.isRolling(len(slaves)) {
+			return RespSuccess(c, rs.cluster.StartRollout(slaves, urlPattern, method, mgrType, configName, configBytes, opt))
+		}
 		if err := executeToClusters(slaves, urlPattern, method, mgrType, configBytes); err != nil {
 			return RespError(c, http.StatusServiceUnavailable, ErrClusterRunnerAdd, err.Error())
 		}
@@ -429,15 +660,19 @@ func (rs *RestService) PostClusterConfig() echo.HandlerFunc {
 	}
 }
 
-// PUT /logkit/cluster/configs/<name>?tag=tagValue&url=urlValue
+// PUT /logkit/cluster/configs/<name>?tag=tagValue&url=urlValue&selector=k1=v1,k2=v2&batch_size=N
 func (rs *RestService) PutClusterConfig() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		configName, tag, url, configBytes, err := rs.checkClusterRequest(c)
 		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrClusterRunnerUpdate, err.Error())
 		}
+		selector, opt, err := getRollingRequest(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterRunnerUpdate, err.Error())
+		}
 		rs.cluster.mutex.RLock()
-		slaves, err := getQualifySlaves(rs.cluster.slaves, tag, url)
+		slaves, err := getSelectedSlaves(rs.cluster.slaves, tag, url, selector)
 		rs.cluster.mutex.RUnlock()
 		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrClusterRunnerUpdate, err.Error())
@@ -445,6 +680,9 @@ func (rs *RestService) PutClusterConfig() echo.HandlerFunc {
 		method := http.MethodPut
 		mgrType := "update runner " + configName
 		urlPattern := "%v" + PREFIX + "/configs/" + configName
+		if opt.isRolling(len(slaves)) {
+			return RespSuccess(c, rs.cluster.StartRollout(slaves, urlPattern, method, mgrType, configName, configBytes, opt))
+		}
 		if err := executeToClusters(slaves, urlPattern, method, mgrType, configBytes); err != nil {
 			return RespError(c, http.StatusServiceUnavailable, ErrClusterRunnerUpdate, err.Error())
 		}
@@ -591,11 +829,16 @@ func (rs *RestService) PostSlaveTag() echo.HandlerFunc {
 }
 
 func getQualifySlaves(slaves []Slave, tag, url string) ([]Slave, error) {
+	return getSelectedSlaves(slaves, tag, url, nil)
+}
+
+// getSelectedSlaves 在 tag 和 url 的基础上，再用 label 选择器过滤 slave, selector 为空则不过滤
+func getSelectedSlaves(slaves []Slave, tag, url string, selector map[string]string) ([]Slave, error) {
 	errInfo := make([]string, 0)
 	slave := make([]Slave, 0)
 	//(u == "" && t == "") || (u == "" && s.t == t) || (u == s.u && t == "") || (u == s.u && t == s.t)
 	for _, s := range slaves {
-		if (url == "" || url == s.Url) && (tag == "" || tag == s.Tag) {
+		if (url == "" || url == s.Url) && (tag == "" || tag == s.Tag) && matchLabels(s.Labels, selector) {
 			if s.Status != StatusOK {
 				errMsg := "the slaves(tag = '" + tag + "', url = '" + url + "') status is " + s.Status + ", options are terminated"
 				errInfo = append(errInfo, errMsg)
@@ -614,6 +857,68 @@ func getQualifySlaves(slaves []Slave, tag, url string) ([]Slave, error) {
 	return slave, nil
 }
 
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector 解析形如 k1=v1,k2=v2 的 label 选择器
+func ParseLabelSelector(str string) (map[string]string, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+	selector := make(map[string]string)
+	for _, kv := range strings.Split(str, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		idx := strings.Index(kv, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid label selector %q, should be like key=value", kv)
+		}
+		selector[strings.TrimSpace(kv[:idx])] = strings.TrimSpace(kv[idx+1:])
+	}
+	return selector, nil
+}
+
+func getRollingRequest(c echo.Context) (selector map[string]string, opt RollingOption, err error) {
+	req := c.Request()
+	if selector, err = ParseLabelSelector(req.Form.Get(KeySelector)); err != nil {
+		return
+	}
+	opt = RollingOption{
+		BatchInterval: DefaultBatchInterval * time.Second,
+		HealthTimeout: DefaultHealthTimeout * time.Second,
+	}
+	params := []struct {
+		key string
+		set func(int)
+	}{
+		{KeyBatchSize, func(v int) { opt.BatchSize = v }},
+		{KeyBatchInterval, func(v int) { opt.BatchInterval = time.Duration(v) * time.Second }},
+		{KeyHealthTimeout, func(v int) { opt.HealthTimeout = time.Duration(v) * time.Second }},
+	}
+	for _, p := range params {
+		val := req.Form.Get(p.key)
+		if val == "" {
+			continue
+		}
+		v, perr := strconv.Atoi(val)
+		if perr != nil || v < 0 {
+			err = fmt.Errorf("invalid %v %q, should be a non-negative integer", p.key, val)
+			return
+		}
+		p.set(v)
+	}
+	return
+}
+
 func (rs *RestService) checkClusterRequest(c echo.Context) (name, tag, url string, configBytes []byte, err error) {
 	if rs.cluster == nil || !rs.cluster.Enable {
 		err = errors.New("cluster function not configed")
@@ -661,6 +966,109 @@ func executeToClusters(slaves []Slave, urlP, method, mgr string, reqBd []byte) (
 	return errors.New(strings.Join(errInfo, "\n"))
 }
 
+// isRolling 表示 n 个 slave 需要分多批下发
+func (opt RollingOption) isRolling(n int) bool {
+	return opt.BatchSize > 0 && opt.BatchSize < n
+}
+
+// executeRollingToClusters 按批次向 slaves 下发操作，每批下发后检查 runner 是否健康，
+// 一旦某一批出现错误或者检查失败，就停止后续批次的下发，避免一次性搞坏所有机器，
+// progress 不为空时在每批开始和通过检查后被调用，参数为当前批次和已完成的 slave 数量
+func executeRollingToClusters(slaves []Slave, urlP, method, mgr, runnerName string, reqBd []byte, opt RollingOption, progress func(batch, done int)) error {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	if !opt.isRolling(len(slaves)) {
+		progress(1, 0)
+		err := executeToClusters(slaves, urlP, method, mgr, reqBd)
+		if err == nil {
+			progress(1, len(slaves))
+		}
+		return err
+	}
+	for start := 0; start < len(slaves); start += opt.BatchSize {
+		end := start + opt.BatchSize
+		if end > len(slaves) {
+			end = len(slaves)
+		}
+		batch := slaves[start:end]
+		batchNum := start/opt.BatchSize + 1
+		log.Infof("rolling %v: batch %v start with %v slaves", mgr, batchNum, len(batch))
+		progress(batchNum, start)
+		err := executeToClusters(batch, urlP, method, mgr, reqBd)
+		if err == nil {
+			err = waitSlavesHealthy(batch, runnerName, opt)
+		}
+		if err != nil {
+			return fmt.Errorf("rolling %v aborted at batch %v, %v slaves were not touched: %v", mgr, batchNum, len(slaves)-end, err)
+		}
+		progress(batchNum, end)
+	}
+	return nil
+}
+
+// waitSlavesHealthy 等待一批 slave 上的 runner 运行正常，超时则返回错误
+func waitSlavesHealthy(slaves []Slave, runnerName string, opt RollingOption) error {
+	time.Sleep(opt.BatchInterval)
+	deadline := time.Now().Add(opt.HealthTimeout)
+	for {
+		var errInfo []string
+		for _, v := range slaves {
+			if err := checkSlaveRunner(v, runnerName); err != nil {
+				errInfo = append(errInfo, err.Error())
+			}
+		}
+		if len(errInfo) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return errors.New(strings.Join(errInfo, "\n"))
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func checkSlaveRunner(slave Slave, runnerName string) error {
+	url := fmt.Sprintf("%v%v/status", slave.Url, PREFIX)
+	respCode, respBody, err := executeToOneCluster(url, http.MethodGet, []byte{})
+	if err != nil || respCode != http.StatusOK {
+		return fmt.Errorf("get slave %v status failed, resp is %v, err is %v", slave.Url, string(respBody), err)
+	}
+	var respRss respRunnerStatus
+	if err = jsoniter.Unmarshal(respBody, &respRss); err != nil {
+		return fmt.Errorf("unmarshal slave %v status error %v", slave.Url, err)
+	}
+	status, ok := respRss.Data[runnerName]
+	if !ok {
+		return fmt.Errorf("runner %v is not found on slave %v", runnerName, slave.Url)
+	}
+	if status.RunningStatus != RunnerRunning {
+		return fmt.Errorf("runner %v on slave %v is %v", runnerName, slave.Url, status.RunningStatus)
+	}
+	if status.Error != "" {
+		return fmt.Errorf("runner %v on slave %v got error %v", runnerName, slave.Url, status.Error)
+	}
+	return nil
+}
+
+// GET /logkit/cluster/rollouts
+func (rs *RestService) GetClusterRollouts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, rs.cluster.Rollouts())
+	}
+}
+
+// GET /logkit/cluster/rollouts/<id>
+func (rs *RestService) GetClusterRollout() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rollout, ok := rs.cluster.GetRollout(c.Param("id"))
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrClusterRollout, "rollout "+c.Param("id")+" is not found")
+		}
+		return RespSuccess(c, rollout)
+	}
+}
+
 func executeToOneCluster(url, method string, configBytes []byte) (respCode int, respBody []byte, err error) {
 	config := bytes.NewReader(configBytes)
 	req, err := http.NewRequest(method, url, config)
@@ -682,10 +1090,14 @@ func executeToOneCluster(url, method string, configBytes []byte) (respCode int,
 }
 
 func Register(masters []string, myhost, tag string) error {
+	return RegisterWithReq(masters, RegisterReq{Url: myhost, Tag: tag})
+}
+
+func RegisterWithReq(masters []string, req RegisterReq) error {
 	var msg string
 	hasSuccess := false
 	for _, master := range masters {
-		err := registerOne(master, myhost, tag)
+		err := registerOne(master, req)
 		if err != nil {
 			msg += "register " + master + " error " + err.Error()
 		} else {
@@ -702,11 +1114,10 @@ func Register(masters []string, myhost, tag string) error {
 	return nil
 }
 
-func registerOne(master, myhost, tag string) error {
+func registerOne(master string, req RegisterReq) error {
 	if master == "" {
 		return errors.New("master host is not configed")
 	}
-	req := RegisterReq{Url: myhost, Tag: tag}
 	data, err := jsoniter.Marshal(req)
 	if err != nil {
 		return err
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -1098,3 +1100,151 @@ func TestJsoniter(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, respGotConfigs1, respGotConfigs2)
 }
+
+func TestParseLabelSelector(t *testing.T) {
+	selector, err := ParseLabelSelector("")
+	assert.NoError(t, err)
+	assert.Nil(t, selector)
+
+	selector, err = ParseLabelSelector(" region = bj, env=prod ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "bj", "env": "prod"}, selector)
+
+	_, err = ParseLabelSelector("region")
+	assert.Error(t, err)
+
+	slaves := []Slave{
+		{Url: "a", Tag: "t", Status: StatusOK, Labels: map[string]string{"region": "bj", "env": "prod"}},
+		{Url: "b", Tag: "t", Status: StatusOK, Labels: map[string]string{"region": "sh", "env": "prod"}},
+		{Url: "c", Tag: "t", Status: StatusOK},
+	}
+	got, err := getSelectedSlaves(slaves, "", "", map[string]string{"env": "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, slaves[:2], got)
+	got, err = getSelectedSlaves(slaves, "t", "", map[string]string{"region": "sh"})
+	assert.NoError(t, err)
+	assert.Equal(t, slaves[1:2], got)
+	_, err = getSelectedSlaves(slaves, "", "", map[string]string{"region": "gz"})
+	assert.Error(t, err)
+}
+
+func TestExecuteRollingToClusters(t *testing.T) {
+	var mutex sync.Mutex
+	received := make([]string, 0)
+	newSlave := func(name, status string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`{"code":"L200","data":{"rolling":{"name":"rolling","runningStatus":"` + status + `"}}}`))
+				return
+			}
+			mutex.Lock()
+			received = append(received, name)
+			mutex.Unlock()
+			w.Write([]byte(`{"code":"L200"}`))
+		}))
+	}
+	s1, s2, s3, s4 := newSlave("s1", RunnerRunning), newSlave("s2", "starting"), newSlave("s3", RunnerRunning), newSlave("s4", RunnerStopped)
+	defer s1.Close()
+	defer s2.Close()
+	defer s3.Close()
+	defer s4.Close()
+	slaves := []Slave{{Url: s1.URL}, {Url: s2.URL}, {Url: s3.URL}}
+	opt := RollingOption{BatchSize: 1}
+	urlPattern := "%v" + PREFIX + "/configs/rolling"
+
+	// s2 的 runner 检查不通过，s3 不应该被下发
+	err := executeRollingToClusters(slaves, urlPattern, http.MethodPost, "add runner rolling", "rolling", []byte("{}"), opt, nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"s1", "s2"}, received)
+
+	// 已停止的 runner 同样不算健康
+	received = received[:0]
+	err = executeRollingToClusters([]Slave{{Url: s4.URL}, slaves[2]}, urlPattern, http.MethodPost, "add runner rolling", "rolling", []byte("{}"), opt, nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"s4"}, received)
+
+	received = received[:0]
+	var progress [][2]int
+	err = executeRollingToClusters([]Slave{slaves[0], slaves[2]}, urlPattern, http.MethodPost, "add runner rolling", "rolling", []byte("{}"), opt, func(batch, done int) {
+		progress = append(progress, [2]int{batch, done})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1", "s3"}, received)
+	assert.Equal(t, [][2]int{{1, 0}, {1, 1}, {2, 1}, {2, 2}}, progress)
+}
+
+func TestClusterStartRollout(t *testing.T) {
+	var mutex sync.Mutex
+	received := make([]string, 0)
+	release := make(chan struct{})
+	slave := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"code":"L200","data":{"rolling":{"name":"rolling","runningStatus":"` + RunnerRunning + `"}}}`))
+			return
+		}
+		<-release
+		mutex.Lock()
+		received = append(received, r.URL.Path)
+		mutex.Unlock()
+		w.Write([]byte(`{"code":"L200"}`))
+	}))
+	defer slave.Close()
+
+	cl := NewCluster(&ClusterConfig{Enable: true, IsMaster: true})
+	defer cl.Stop()
+	slaves := []Slave{{Url: slave.URL}, {Url: slave.URL}}
+	urlPattern := "%v" + PREFIX + "/configs/rolling"
+
+	// 下发在后台进行，StartRollout 不等待 slave 返回
+	rollout := cl.StartRollout(slaves, urlPattern, http.MethodPost, "add runner rolling", "rolling", []byte("{}"), RollingOption{BatchSize: 1})
+	assert.Equal(t, RolloutRunning, rollout.Status)
+	assert.Equal(t, 2, rollout.Total)
+	got, ok := cl.GetRollout(rollout.ID)
+	assert.True(t, ok)
+	assert.Equal(t, RolloutRunning, got.Status)
+	_, ok = cl.GetRollout("not-exist")
+	assert.False(t, ok)
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for got.Status == RolloutRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got, _ = cl.GetRollout(rollout.ID)
+	}
+	assert.Equal(t, RolloutSucceeded, got.Status, got.Error)
+	assert.Equal(t, 2, got.Done)
+	assert.Equal(t, 2, got.Batch)
+	assert.False(t, got.EndTime.IsZero())
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, []Rollout{got}, cl.Rollouts())
+}
+
+func TestClusterSlaveLiveness(t *testing.T) {
+	cl := NewCluster(&ClusterConfig{Enable: true, IsMaster: true, HeartbeatInterval: 10, RemoveLostAfter: 120})
+	defer cl.Stop()
+	cl.AddSlave(RegisterReq{Url: "http://a", Tag: "t", Hostname: "host-a", Version: "v1", Runners: RunnersSummary{Total: 2, Running: 1, Stopped: 1}})
+	cl.AddSlave(RegisterReq{Url: "http://b", Tag: "t", Hostname: "host-b"})
+	cl.AddSlave(RegisterReq{Url: "http://c", Tag: "t", Hostname: "host-c"})
+	assert.Equal(t, 3, len(cl.slaves))
+	assert.Equal(t, "host-a", cl.slaves[0].Hostname)
+	assert.Equal(t, RunnersSummary{Total: 2, Running: 1, Stopped: 1}, cl.slaves[0].Runners)
+
+	now := time.Now()
+	cl.slaves[1].LastTouch = now.Add(-30 * time.Second)
+	cl.slaves[2].LastTouch = now.Add(-50 * time.Second)
+	cl.updateSlaveStatus(now, true)
+	assert.Equal(t, StatusOK, cl.slaves[0].Status)
+	assert.Equal(t, StatusBad, cl.slaves[1].Status)
+	assert.Equal(t, StatusLost, cl.slaves[2].Status)
+
+	// 心跳恢复后状态恢复为 ok
+	cl.AddSlave(RegisterReq{Url: "http://b", Tag: "t", Hostname: "host-b"})
+	assert.Equal(t, StatusOK, cl.slaves[1].Status)
+
+	// 失联超过 remove_lost_after 的 slave 被移除
+	cl.slaves[2].LastTouch = now.Add(-121 * time.Second)
+	cl.updateSlaveStatus(now, true)
+	assert.Equal(t, 2, len(cl.slaves))
+	assert.Equal(t, "http://a", cl.slaves[0].Url)
+	assert.Equal(t, "http://b", cl.slaves[1].Url)
+}
@@ -320,7 +320,7 @@ func getSampleData(parserConfig conf.MapConf) ([]string, error) {
 	var sampleData []string
 
 	switch parserType {
-	case parser.TypeCSV, parser.TypeJSON, parser.TypeRaw, parser.TypeNginx, parser.TypeEmpty, parser.TypeKafkaRest, parser.TypeLogv1:
+	case parser.TypeCSV, parser.TypeJSON, parser.TypeRaw, parser.TypeNginx, parser.TypeEmpty, parser.TypeKafkaRest, parser.TypeLogv1, parser.TypeLogfmt, parser.TypeProtobuf, parser.TypeAvro, parser.TypeLog4j, parser.TypeKV, parser.TypeXML:
 		sampleData = append(sampleData, rawData)
 	case parser.TypeSyslog:
 		sampleData = strings.Split(rawData, "\n")
@@ -328,6 +328,8 @@ func getSampleData(parserConfig conf.MapConf) ([]string, error) {
 	case parser.TypeMySQL:
 		sampleData = strings.Split(rawData, "\n")
 		sampleData = append(sampleData, parser.PandoraParseFlushSignal)
+	case parser.TypeErrorLog, parser.TypeW3C, parser.TypeCEF:
+		sampleData = strings.Split(rawData, "\n")
 	case parser.TypeGrok:
 		grokMode, _ := parserConfig.GetString(parser.KeyGrokMode)
 		if grokMode != grok.ModeMulti {
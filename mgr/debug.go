@@ -0,0 +1,93 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// DebugConfig 控制管理端口上的 pprof 等调试接口
+type DebugConfig struct {
+	EnablePprof          bool `json:"enable_pprof"`           // 是否开启 /logkit/debug/pprof/ 接口
+	BlockProfileRate     int  `json:"block_profile_rate"`     // 参见 runtime.SetBlockProfileRate, 0 表示关闭 block profile
+	MutexProfileFraction int  `json:"mutex_profile_fraction"` // 参见 runtime.SetMutexProfileFraction, 0 表示关闭 mutex profile
+}
+
+type debugService struct {
+	mutex  sync.RWMutex
+	config DebugConfig
+}
+
+func newDebugService(config DebugConfig) *debugService {
+	ds := &debugService{}
+	ds.apply(config)
+	return ds
+}
+
+func (ds *debugService) apply(config DebugConfig) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	runtime.SetBlockProfileRate(config.BlockProfileRate)
+	runtime.SetMutexProfileFraction(config.MutexProfileFraction)
+	ds.config = config
+}
+
+func (ds *debugService) get() DebugConfig {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.config
+}
+
+// pprofHandler 只有在开启 pprof 时才处理请求
+func (ds *debugService) pprofHandler(h http.Handler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !ds.get().EnablePprof {
+			return RespError(c, http.StatusForbidden, ErrDebug, "pprof is disabled, please enable it by PUT /logkit/debug")
+		}
+		h.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+func (rs *RestService) registerDebugRoutes(router *echo.Echo) {
+	router.GET(PREFIX+"/debug", rs.GetDebug())
+	router.PUT(PREFIX+"/debug", rs.PutDebug())
+
+	ds := rs.debug
+	router.GET(PREFIX+"/debug/pprof/", ds.pprofHandler(http.HandlerFunc(pprof.Index)))
+	router.GET(PREFIX+"/debug/pprof/cmdline", ds.pprofHandler(http.HandlerFunc(pprof.Cmdline)))
+	router.GET(PREFIX+"/debug/pprof/profile", ds.pprofHandler(http.HandlerFunc(pprof.Profile)))
+	router.GET(PREFIX+"/debug/pprof/symbol", ds.pprofHandler(http.HandlerFunc(pprof.Symbol)))
+	router.POST(PREFIX+"/debug/pprof/symbol", ds.pprofHandler(http.HandlerFunc(pprof.Symbol)))
+	router.GET(PREFIX+"/debug/pprof/trace", ds.pprofHandler(http.HandlerFunc(pprof.Trace)))
+	// goroutine, heap, block, mutex 等, goroutine?debug=2 可以获取所有 goroutine 的调用栈
+	router.GET(PREFIX+"/debug/pprof/:name", func(c echo.Context) error {
+		return ds.pprofHandler(pprof.Handler(c.Param("name")))(c)
+	})
+}
+
+// get /logkit/debug
+func (rs *RestService) GetDebug() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, rs.debug.get())
+	}
+}
+
+// put /logkit/debug
+func (rs *RestService) PutDebug() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var config DebugConfig
+		if err := c.Bind(&config); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrDebug, err.Error())
+		}
+		rs.debug.apply(config)
+		log.Warnf("debug config is changed to %+v", config)
+		return RespSuccess(c, nil)
+	}
+}
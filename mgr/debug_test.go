@@ -0,0 +1,46 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugService(t *testing.T) {
+	defer runtime.SetMutexProfileFraction(0)
+	rs := &RestService{debug: newDebugService(DebugConfig{})}
+	router := echo.New()
+	rs.registerDebugRoutes(router)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/logkit/debug/pprof/goroutine?debug=2", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = request(http.MethodPut, "/logkit/debug", `{"enable_pprof":true,"mutex_profile_fraction":5}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, DebugConfig{EnablePprof: true, MutexProfileFraction: 5}, rs.debug.get())
+	assert.Equal(t, 5, runtime.SetMutexProfileFraction(-1))
+
+	rec = request(http.MethodGet, "/logkit/debug/pprof/goroutine?debug=2", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine")
+
+	rec = request(http.MethodGet, "/logkit/debug/pprof/", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request(http.MethodGet, "/logkit/debug", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"enable_pprof":true`)
+}
@@ -0,0 +1,277 @@
+package mgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultDeliveryIDKey = "audit_id"
+
+	deliveryAuditFile = "delivery_audit.json"
+)
+
+const (
+	DeliveryStageParse     = "parse"
+	DeliveryStageTransform = "transform"
+	DeliveryStageSend      = "send"
+)
+
+// DeliveryAudit 是 runner 的投递审计配置，打开后读取的每条数据都会带上 <runner>|<source>|<序号> 形式的 ID，
+// 并统计数据在读取、解析、转换、发送各个阶段的条数，用于对账确认是否丢失了数据以及丢失在哪个阶段
+type DeliveryAudit struct {
+	Enable bool   `json:"enable"`
+	IDKey  string `json:"id_key,omitempty"` // 数据中保存 ID 的字段，默认为 audit_id
+}
+
+// DeliveryCounts 是各个阶段累计处理的数据条数
+type DeliveryCounts struct {
+	Read             int64 `json:"read"`              // reader 读取的条数
+	Parsed           int64 `json:"parsed"`            // 解析成功的条数
+	ParseFailed      int64 `json:"parse_failed"`      // 解析出错的条数，出错的数据保存在 pandora_stash 中继续发送时不算作丢弃
+	Transformed      int64 `json:"transformed"`       // 经过 transformer 后的条数
+	TransformDropped int64 `json:"transform_dropped"` // 被 transformer 丢弃的条数
+	Routed           int64 `json:"routed"`            // 分发给 sender 的条数，没有配置 router 时每个 sender 都会收到全部数据
+	Sent             int64 `json:"sent"`              // 发送成功的条数，写入 fault tolerant 磁盘队列也算作成功
+	SendFailed       int64 `json:"send_failed"`       // 重试后仍然发送失败被丢弃的条数
+}
+
+// DeliverySource 是一个数据来源已经分配的最大序号
+type DeliverySource struct {
+	Source  string `json:"source"`
+	LastSeq int64  `json:"last_seq"`
+}
+
+// DeliveryCheck 是一个阶段的对账结果，Dropped 是确认丢弃的条数，
+// Missing 是既没有输出也没有记录失败的条数，runner 运行时可能是还在处理中的数据
+type DeliveryCheck struct {
+	Stage   string `json:"stage"`
+	Input   int64  `json:"input"`
+	Output  int64  `json:"output"`
+	Dropped int64  `json:"dropped"`
+	Missing int64  `json:"missing"`
+}
+
+// DeliveryReport 是 runner 的投递审计报告，统计从 Since 开始累计，重启后从持久化的结果继续累计
+type DeliveryReport struct {
+	Runner     string           `json:"runner"`
+	IDKey      string           `json:"id_key"`
+	Since      time.Time        `json:"since"`
+	SaveTime   time.Time        `json:"save_time"` // 最近一次持久化的时间
+	Counts     DeliveryCounts   `json:"counts"`
+	Sources    []DeliverySource `json:"sources"`
+	Checks     []DeliveryCheck  `json:"checks"`
+	Lost       bool             `json:"lost"` // 是否有阶段确认丢弃了数据
+	LostStages []string         `json:"lost_stages,omitempty"`
+}
+
+// deliveryState 是持久化到 meta 目录的审计状态
+type deliveryState struct {
+	Since    time.Time        `json:"since"`
+	SaveTime time.Time        `json:"save_time"`
+	Counts   DeliveryCounts   `json:"counts"`
+	Seqs     map[string]int64 `json:"seqs"`
+}
+
+// deliveryAuditor 为数据分配 ID 并统计各个阶段的条数，为 nil 时表示没有打开审计，所有方法都不做任何事情。
+// 状态在 reader 同步 meta 时一起持久化，崩溃后重新读取的数据会得到和之前相同的 ID
+type deliveryAuditor struct {
+	runner string
+	idKey  string
+	path   string
+
+	mutex sync.Mutex
+	state deliveryState
+}
+
+func newDeliveryAuditor(conf *DeliveryAudit, runner, metaDir string) *deliveryAuditor {
+	if conf == nil || !conf.Enable {
+		return nil
+	}
+	a := &deliveryAuditor{
+		runner: runner,
+		idKey:  conf.IDKey,
+		path:   filepath.Join(metaDir, deliveryAuditFile),
+		state: deliveryState{
+			Since: time.Now(),
+			Seqs:  make(map[string]int64),
+		},
+	}
+	if a.idKey == "" {
+		a.idKey = DefaultDeliveryIDKey
+	}
+	if err := a.restore(); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Runner[%v] restore delivery audit state from %v error: %v, start from zero", runner, a.path, err)
+	}
+	return a
+}
+
+func (a *deliveryAuditor) restore() error {
+	bts, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	var state deliveryState
+	if err = json.Unmarshal(bts, &state); err != nil {
+		return err
+	}
+	if state.Seqs == nil {
+		state.Seqs = make(map[string]int64)
+	}
+	a.state = state
+	return nil
+}
+
+// key 返回数据中保存 ID 的字段，没有打开审计时返回空
+func (a *deliveryAuditor) key() string {
+	if a == nil {
+		return ""
+	}
+	return a.idKey
+}
+
+// nextID 为 source 的下一条数据分配 ID
+func (a *deliveryAuditor) nextID(source string) string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.state.Seqs[source]++
+	return fmt.Sprintf("%s|%s|%d", a.runner, source, a.state.Seqs[source])
+}
+
+func (a *deliveryAuditor) count(f func(c *DeliveryCounts)) {
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	f(&a.state.Counts)
+	a.mutex.Unlock()
+}
+
+// save 先写临时文件再 rename，在 reader 同步 meta 之后调用
+func (a *deliveryAuditor) save() {
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	a.state.SaveTime = time.Now()
+	bts, err := json.Marshal(a.state)
+	a.mutex.Unlock()
+	if err != nil {
+		log.Errorf("Runner[%v] marshal delivery audit state error: %v", a.runner, err)
+		return
+	}
+	tmp := a.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, bts, DefaultFilePerm); err == nil {
+		err = os.Rename(tmp, a.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Errorf("Runner[%v] save delivery audit state to %v error: %v", a.runner, a.path, err)
+	}
+}
+
+func (a *deliveryAuditor) report() *DeliveryReport {
+	a.mutex.Lock()
+	rp := &DeliveryReport{
+		Runner:   a.runner,
+		IDKey:    a.idKey,
+		Since:    a.state.Since,
+		SaveTime: a.state.SaveTime,
+		Counts:   a.state.Counts,
+		Sources:  make([]DeliverySource, 0, len(a.state.Seqs)),
+	}
+	for source, seq := range a.state.Seqs {
+		rp.Sources = append(rp.Sources, DeliverySource{Source: source, LastSeq: seq})
+	}
+	a.mutex.Unlock()
+	sort.Slice(rp.Sources, func(i, j int) bool {
+		return rp.Sources[i].Source < rp.Sources[j].Source
+	})
+
+	c := rp.Counts
+	rp.Checks = []DeliveryCheck{
+		newDeliveryCheck(DeliveryStageParse, c.Read, c.Parsed, c.ParseFailed),
+		newDeliveryCheck(DeliveryStageTransform, c.Parsed, c.Transformed, c.TransformDropped),
+		newDeliveryCheck(DeliveryStageSend, c.Routed, c.Sent, c.SendFailed),
+	}
+	for _, check := range rp.Checks {
+		if check.Dropped > 0 {
+			rp.Lost = true
+			rp.LostStages = append(rp.LostStages, check.Stage)
+		}
+	}
+	return rp
+}
+
+// newDeliveryCheck 计算一个阶段没有对上的条数。出错的数据可能仍然被输出（如 parser 把原始数据保存在 pandora_stash 中），
+// 所以确认丢弃的条数不超过输入少于输出的部分；多行合并等情况下输出可能多于输入，此时都为0
+func newDeliveryCheck(stage string, input, output, failed int64) DeliveryCheck {
+	check := DeliveryCheck{
+		Stage:  stage,
+		Input:  input,
+		Output: output,
+	}
+	lack := input - output
+	if lack <= 0 {
+		return check
+	}
+	check.Dropped = failed
+	if check.Dropped > lack {
+		check.Dropped = lack
+	}
+	check.Missing = lack - check.Dropped
+	return check
+}
+
+// addDeliveryIDs 把 ids 按照和 addSourceToData 相同的方式对应到解析后的数据上，数据多于 ids 时无法对应，不加
+func addDeliveryIDs(ids []string, se *StatsError, datas []Data, idKey, runnerName string) []Data {
+	if len(ids) <= 0 || len(datas) > len(ids) {
+		return datas
+	}
+	return addSourceToData(ids, se, datas, idKey, runnerName)
+}
+
+// DeliveryReporter 的 runner 可以返回投递审计报告
+type DeliveryReporter interface {
+	DeliveryReport() (*DeliveryReport, error)
+}
+
+func (r *LogExportRunner) DeliveryReport() (*DeliveryReport, error) {
+	if r.delivery == nil {
+		return nil, errors.New("delivery audit of runner " + r.Name() + " is not enabled")
+	}
+	return r.delivery.report(), nil
+}
+
+// GET /logkit/configs/<name>/delivery 获取 runner 的投递审计报告
+func (rs *RestService) GetConfigDelivery() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		r, ok := rs.mgr.getRunnerByName(name)
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrDeliveryReport, "runner "+name+" is not found or not running")
+		}
+		dr, ok := r.(DeliveryReporter)
+		if !ok {
+			return RespError(c, http.StatusBadRequest, ErrDeliveryReport, "runner "+name+" does not support delivery audit")
+		}
+		report, err := dr.DeliveryReport()
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrDeliveryReport, err.Error())
+		}
+		return RespSuccess(c, report)
+	}
+}
@@ -0,0 +1,119 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestDeliveryAuditor(t *testing.T) {
+	dir := "TestDeliveryAuditor"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+
+	var disabled *deliveryAuditor
+	assert.Nil(t, newDeliveryAuditor(nil, "r1", dir))
+	assert.Nil(t, newDeliveryAuditor(&DeliveryAudit{}, "r1", dir))
+	assert.Equal(t, "", disabled.key())
+	disabled.count(func(c *DeliveryCounts) { c.Read++ })
+	disabled.save()
+
+	a := newDeliveryAuditor(&DeliveryAudit{Enable: true}, "r1", dir)
+	assert.Equal(t, DefaultDeliveryIDKey, a.key())
+	assert.Equal(t, "r1|a.log|1", a.nextID("a.log"))
+	assert.Equal(t, "r1|a.log|2", a.nextID("a.log"))
+	assert.Equal(t, "r1|b.log|1", a.nextID("b.log"))
+	a.count(func(c *DeliveryCounts) {
+		c.Read = 10
+		c.Parsed = 9
+		c.ParseFailed = 1
+		c.Transformed = 9
+		c.Routed = 9
+		c.Sent = 7
+	})
+	a.save()
+	// 出错的数据仍然被输出时不算作丢弃
+	assert.Equal(t, DeliveryCheck{Stage: DeliveryStageParse, Input: 2, Output: 2}, newDeliveryCheck(DeliveryStageParse, 2, 2, 1))
+	assert.Equal(t, DeliveryCheck{Stage: DeliveryStageParse, Input: 2, Output: 3}, newDeliveryCheck(DeliveryStageParse, 2, 3, 0))
+
+	// 保存之后分配的序号在重启后会重新分配
+	a.nextID("a.log")
+
+	restored := newDeliveryAuditor(&DeliveryAudit{Enable: true, IDKey: "id"}, "r1", dir)
+	assert.Equal(t, "id", restored.key())
+	assert.Equal(t, "r1|a.log|3", restored.nextID("a.log"))
+
+	rp := restored.report()
+	assert.Equal(t, "r1", rp.Runner)
+	assert.Equal(t, int64(10), rp.Counts.Read)
+	assert.False(t, rp.SaveTime.IsZero())
+	assert.Equal(t, []DeliverySource{{Source: "a.log", LastSeq: 3}, {Source: "b.log", LastSeq: 1}}, rp.Sources)
+	assert.Equal(t, []DeliveryCheck{
+		{Stage: DeliveryStageParse, Input: 10, Output: 9, Dropped: 1},
+		{Stage: DeliveryStageTransform, Input: 9, Output: 9},
+		{Stage: DeliveryStageSend, Input: 9, Output: 7, Missing: 2},
+	}, rp.Checks)
+	assert.True(t, rp.Lost)
+	assert.Equal(t, []string{DeliveryStageParse}, rp.LostStages)
+}
+
+func TestRunnerDeliveryAudit(t *testing.T) {
+	dir := "TestRunnerDeliveryAudit"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("{\"f1\":\"1\"}\nbad\n{\"f1\":\"3\"}\n"), DefaultFilePerm))
+
+	readerConfig := conf.MapConf{
+		"log_path":  logPath,
+		"meta_path": filepath.Join(dir, "meta"),
+		"mode":      "file",
+		"read_from": "oldest",
+	}
+	meta, err := reader.NewMetaWithConf(readerConfig)
+	assert.NoError(t, err)
+	rd, err := reader.NewFileBufReader(readerConfig, false)
+	assert.NoError(t, err)
+	ps, err := parser.NewRegistry().NewLogParser(conf.MapConf{
+		"name":                         "json",
+		"type":                         parser.TypeJSON,
+		parser.KeyDisableRecordErrData: "true",
+	})
+	assert.NoError(t, err)
+	s := &countSender{}
+	rinfo := RunnerInfo{RunnerName: "TestRunnerDeliveryAudit", MaxBatchLen: 1000, MaxBatchInterval: 300}
+	r, err := NewLogExportRunnerWithService(rinfo, rd, nil, ps, nil, []sender.Sender{s}, nil, meta)
+	assert.NoError(t, err)
+	_, err = r.DeliveryReport()
+	assert.Error(t, err)
+	r.delivery = newDeliveryAuditor(&DeliveryAudit{Enable: true}, r.Name(), meta.Dir)
+	go r.Run()
+	defer r.Stop()
+
+	time.Sleep(2 * time.Second)
+	assert.NoError(t, r.Flush(10*time.Second, false))
+	assert.Equal(t, 2, s.count())
+	source := rd.Source()
+	s.mutex.Lock()
+	assert.Equal(t, "TestRunnerDeliveryAudit|"+source+"|1", s.datas[0][DefaultDeliveryIDKey])
+	assert.Equal(t, "TestRunnerDeliveryAudit|"+source+"|3", s.datas[1][DefaultDeliveryIDKey])
+	s.mutex.Unlock()
+
+	rp, err := r.DeliveryReport()
+	assert.NoError(t, err)
+	assert.Equal(t, DeliveryCounts{Read: 3, Parsed: 2, ParseFailed: 1, Transformed: 2, Routed: 2, Sent: 2}, rp.Counts)
+	assert.Equal(t, []DeliverySource{{Source: source, LastSeq: 3}}, rp.Sources)
+	assert.Equal(t, []string{DeliveryStageParse}, rp.LostStages)
+	_, err = os.Stat(filepath.Join(meta.Dir, deliveryAuditFile))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,111 @@
+package mgr
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ErrorTypeReader    = "reader"
+	ErrorTypeParser    = "parser"
+	ErrorTypeTransform = "transform"
+	ErrorTypeSender    = "sender"
+
+	DefaultErrorHistorySize = 100
+)
+
+// ErrorRecord 是 runner 的一条错误记录, 相同来源的相同错误会被合并并计数
+type ErrorRecord struct {
+	Type      string    `json:"type"`             // 错误的类别, reader/parser/transform/sender
+	Source    string    `json:"source,omitempty"` // 产生错误的组件, 如 transform 的类型或 sender 的名字
+	Message   string    `json:"message"`
+	Count     int64     `json:"count"`
+	FirstTime time.Time `json:"first_time"`
+	LastTime  time.Time `json:"last_time"`
+}
+
+// ErrorHistoryGetter 表示 runner 可以返回最近的错误记录
+type ErrorHistoryGetter interface {
+	ErrorHistory() []ErrorRecord
+}
+
+// errorHistory 保存最近的 size 条错误, 按最后发生时间从旧到新排列, 超出容量时丢弃最旧的记录
+type errorHistory struct {
+	mutex   sync.Mutex
+	size    int
+	records []ErrorRecord
+}
+
+func newErrorHistory(size int) *errorHistory {
+	if size <= 0 {
+		size = DefaultErrorHistorySize
+	}
+	return &errorHistory{
+		size:    size,
+		records: make([]ErrorRecord, 0, size),
+	}
+}
+
+func (h *errorHistory) Add(typ, source string, err error) {
+	if h == nil || err == nil {
+		return
+	}
+	h.add(typ, source, err.Error(), time.Now())
+}
+
+func (h *errorHistory) add(typ, source, msg string, now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	record := ErrorRecord{
+		Type:      typ,
+		Source:    source,
+		Message:   msg,
+		Count:     1,
+		FirstTime: now,
+	}
+	for i, r := range h.records {
+		if r.Type == typ && r.Source == source && r.Message == msg {
+			record.Count = r.Count + 1
+			record.FirstTime = r.FirstTime
+			h.records = append(h.records[:i], h.records[i+1:]...)
+			break
+		}
+	}
+	record.LastTime = now
+	if len(h.records) >= h.size {
+		h.records = append(h.records[:0], h.records[len(h.records)-h.size+1:]...)
+	}
+	h.records = append(h.records, record)
+}
+
+// List 返回所有错误记录的拷贝, 最近发生的在前
+func (h *errorHistory) List() []ErrorRecord {
+	if h == nil {
+		return []ErrorRecord{}
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ret := make([]ErrorRecord, len(h.records))
+	for i, r := range h.records {
+		ret[len(h.records)-1-i] = r
+	}
+	return ret
+}
+
+// RunnerErrors 返回指定 runner 最近的错误记录
+func (m *Manager) RunnerErrors(name string) ([]ErrorRecord, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, r := range m.runners {
+		if r.Name() != name {
+			continue
+		}
+		eh, ok := r.(ErrorHistoryGetter)
+		if !ok {
+			return nil, fmt.Errorf("runner %v does not support error history", name)
+		}
+		return eh.ErrorHistory(), nil
+	}
+	return nil, fmt.Errorf("runner %v is not found or not running", name)
+}
@@ -0,0 +1,48 @@
+package mgr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHistory(t *testing.T) {
+	h := newErrorHistory(3)
+	now := time.Now()
+	h.add(ErrorTypeReader, "file", "read error", now)
+	h.add(ErrorTypeSender, "pandora", "send error", now.Add(time.Second))
+	h.add(ErrorTypeReader, "file", "read error", now.Add(2*time.Second))
+
+	records := h.List()
+	assert.Len(t, records, 2)
+	assert.Equal(t, ErrorRecord{
+		Type:      ErrorTypeReader,
+		Source:    "file",
+		Message:   "read error",
+		Count:     2,
+		FirstTime: now,
+		LastTime:  now.Add(2 * time.Second),
+	}, records[0])
+	assert.Equal(t, "send error", records[1].Message)
+
+	h.add(ErrorTypeParser, "json", "parse error", now.Add(3*time.Second))
+	h.add(ErrorTypeTransform, "date", "transform error", now.Add(4*time.Second))
+	records = h.List()
+	assert.Len(t, records, 3)
+	assert.Equal(t, ErrorTypeTransform, records[0].Type)
+	assert.Equal(t, ErrorTypeParser, records[1].Type)
+	assert.Equal(t, ErrorTypeReader, records[2].Type)
+
+	h.Add(ErrorTypeSender, "pandora", nil)
+	assert.Len(t, h.List(), 3)
+	h.Add(ErrorTypeSender, "pandora", errors.New("send error"))
+	records = h.List()
+	assert.Equal(t, ErrorTypeSender, records[0].Type)
+	assert.Equal(t, int64(1), records[0].Count)
+
+	var nilHistory *errorHistory
+	nilHistory.Add(ErrorTypeReader, "file", errors.New("read error"))
+	assert.Len(t, nilHistory.List(), 0)
+}
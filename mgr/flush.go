@@ -0,0 +1,183 @@
+package mgr
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultFlushTimeout = 30 // 单位秒
+	MaxFlushTimeout     = 600
+)
+
+// Flushable 的 runner 可以立即发送已读取的数据并同步 reader 的 meta
+type Flushable interface {
+	// Flush 在 timeout 内把已经读取的数据(包括 parser 中缓存的)发送出去, 同步 reader 的 meta,
+	// 并等待 sender 内存队列清空, drainDisk 为 true 时还会等待磁盘队列, 超时返回错误
+	Flush(timeout time.Duration, drainDisk bool) error
+}
+
+// Flush 通知 Run 结束当前批次, 由 Run 在两个批次之间完成 flush, 避免和读取、发送并发
+func (r *LogExportRunner) Flush(timeout time.Duration, drainDisk bool) error {
+	if atomic.LoadInt32(&r.stopped) > 0 {
+		return fmt.Errorf("runner %v is stopped", r.Name())
+	}
+	deadline := time.Now().Add(timeout)
+	atomic.StoreInt32(&r.flushing, 1)
+	defer atomic.StoreInt32(&r.flushing, 0)
+
+	done := make(chan struct{})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r.flushChan <- done:
+	case <-timer.C:
+		return fmt.Errorf("runner %v flush timeout, current batch is not finished in %v", r.Name(), timeout)
+	}
+	select {
+	case <-done:
+	case <-timer.C:
+		return fmt.Errorf("runner %v flush timeout, sending datas is not finished in %v", r.Name(), timeout)
+	}
+
+	for _, s := range r.senders {
+		ds, ok := s.(sender.Drainable)
+		if !ok {
+			continue
+		}
+		remain := deadline.Sub(time.Now())
+		if remain < 0 {
+			remain = 0
+		}
+		if err := ds.Drain(remain, drainDisk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleFlush 在 Run 中调用, 此时之前读取的数据都已交给 sender
+func (r *LogExportRunner) handleFlush(done chan struct{}) {
+	defer close(done)
+	// 之后的批次恢复正常, 否则在等待 sender 的队列时 Run 会不断空转
+	atomic.StoreInt32(&r.flushing, 0)
+	r.flushParser()
+	r.reader.SyncMeta()
+	log.Infof("Runner[%v] flushed", r.Name())
+}
+
+// FlushRunner flush 一个正在运行的 runner
+func (m *Manager) FlushRunner(name string, timeout time.Duration, drainDisk bool) error {
+	r, ok := m.getRunnerByName(name)
+	if !ok {
+		return fmt.Errorf("runner %v is not found or not running", name)
+	}
+	fr, ok := r.(Flushable)
+	if !ok {
+		return fmt.Errorf("runner %v does not support flush", name)
+	}
+	return fr.Flush(timeout, drainDisk)
+}
+
+// FlushAll 并发 flush 所有正在运行的 runner, 返回每个 runner 的错误, 成功的为空字符串
+func (m *Manager) FlushAll(timeout time.Duration, drainDisk bool) map[string]string {
+	m.lock.RLock()
+	runners := make([]Runner, 0, len(m.runners))
+	for _, r := range m.runners {
+		runners = append(runners, r)
+	}
+	m.lock.RUnlock()
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]string, len(runners))
+	for _, r := range runners {
+		fr, ok := r.(Flushable)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, fr Flushable) {
+			defer wg.Done()
+			var errStr string
+			if err := fr.Flush(timeout, drainDisk); err != nil {
+				errStr = err.Error()
+			}
+			mutex.Lock()
+			results[name] = errStr
+			mutex.Unlock()
+		}(r.Name(), fr)
+	}
+	wg.Wait()
+	return results
+}
+
+func parseFlushParams(c echo.Context) (time.Duration, bool, error) {
+	timeout := DefaultFlushTimeout
+	if v := c.QueryParam("timeout"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 || i > MaxFlushTimeout {
+			return 0, false, fmt.Errorf("timeout should be an integer between 1 and %v", MaxFlushTimeout)
+		}
+		timeout = i
+	}
+	var drainDisk bool
+	if v := c.QueryParam("drain_disk"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("drain_disk should be true or false")
+		}
+		drainDisk = b
+	}
+	return time.Duration(timeout) * time.Second, drainDisk, nil
+}
+
+// POST /logkit/configs/<name>/flush?timeout=<seconds>&drain_disk=<bool>
+func (rs *RestService) PostConfigFlush() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		timeout, drainDisk, err := parseFlushParams(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRunnerFlush, err.Error())
+		}
+		if _, ok := rs.mgr.getRunnerByName(name); !ok {
+			return RespError(c, http.StatusNotFound, ErrRunnerFlush, "runner "+name+" is not found or not running")
+		}
+		if err = rs.mgr.FlushRunner(name, timeout, drainDisk); err != nil {
+			return RespError(c, http.StatusInternalServerError, ErrRunnerFlush, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
+
+// POST /logkit/flush?timeout=<seconds>&drain_disk=<bool>
+// 返回每个 runner 的 flush 结果, 有 runner 失败时返回 500
+func (rs *RestService) PostFlush() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		timeout, drainDisk, err := parseFlushParams(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRunnerFlush, err.Error())
+		}
+		results := rs.mgr.FlushAll(timeout, drainDisk)
+		for _, errStr := range results {
+			if errStr != "" {
+				return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+					"code":    ErrRunnerFlush,
+					"message": "some runners failed to flush",
+					"data":    results,
+				})
+			}
+		}
+		return RespSuccess(c, results)
+	}
+}
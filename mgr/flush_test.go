@@ -0,0 +1,112 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+type countSender struct {
+	mutex sync.Mutex
+	datas []Data
+}
+
+func (s *countSender) Name() string { return "count_sender" }
+
+func (s *countSender) Send(datas []Data) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.datas = append(s.datas, datas...)
+	return nil
+}
+
+func (s *countSender) Close() error { return nil }
+
+func (s *countSender) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.datas)
+}
+
+func TestRunnerFlush(t *testing.T) {
+	dir := "TestRunnerFlush"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("{\"f1\":\"1\"}\n{\"f1\":\"2\"}\n"), DefaultFilePerm))
+
+	readerConfig := conf.MapConf{
+		"log_path":  logPath,
+		"meta_path": filepath.Join(dir, "meta"),
+		"mode":      "file",
+		"read_from": "oldest",
+	}
+	meta, err := reader.NewMetaWithConf(readerConfig)
+	assert.NoError(t, err)
+	rd, err := reader.NewFileBufReader(readerConfig, false)
+	assert.NoError(t, err)
+	ps, err := parser.NewRegistry().NewLogParser(conf.MapConf{"name": "json", "type": parser.TypeJSON})
+	assert.NoError(t, err)
+	s := &countSender{}
+	// 批次很大且发送间隔很长, 不 flush 时数据不会被发送
+	rinfo := RunnerInfo{RunnerName: "TestRunnerFlush", MaxBatchLen: 1000, MaxBatchInterval: 300}
+	r, err := NewLogExportRunnerWithService(rinfo, rd, nil, ps, nil, []sender.Sender{s}, nil, meta)
+	assert.NoError(t, err)
+	go r.Run()
+	defer r.Stop()
+
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, s.count())
+
+	assert.NoError(t, r.Flush(10*time.Second, false))
+	assert.Equal(t, 2, s.count())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&r.flushing))
+
+	// flush 之后恢复正常的批次
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("{\"f1\":\"1\"}\n{\"f1\":\"2\"}\n{\"f1\":\"3\"}\n"), DefaultFilePerm))
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 2, s.count())
+}
+
+func TestPostFlush(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestPostFlush", ServerBackup: true})
+	assert.NoError(t, err)
+	defer os.RemoveAll("TestPostFlush")
+	// 没有在运行的 Run, flush 会超时
+	m.runners["r1.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}, flushChan: make(chan chan struct{})}
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.POST(PREFIX+"/configs/:name/flush", rs.PostConfigFlush())
+	router.POST(PREFIX+"/flush", rs.PostFlush())
+
+	for path, code := range map[string]int{
+		"/configs/r2/flush":              http.StatusNotFound,
+		"/configs/r1/flush?timeout=0":    http.StatusBadRequest,
+		"/configs/r1/flush?drain_disk=x": http.StatusBadRequest,
+		"/configs/r1/flush?timeout=1":    http.StatusInternalServerError,
+		"/flush?timeout=1":               http.StatusInternalServerError,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, PREFIX+path, nil))
+		assert.Equal(t, code, rec.Code, path)
+	}
+
+	results := m.FlushAll(time.Second, false)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results["r1"], "flush timeout")
+}
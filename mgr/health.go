@@ -0,0 +1,146 @@
+package mgr
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// DefaultReadyMaxFtLags 是 fault tolerant 磁盘队列积压的默认上限, 超过后 runner 被认为没有就绪
+const DefaultReadyMaxFtLags = 10000
+
+// RunnerHealth 是一个 runner 的就绪状态
+type RunnerHealth struct {
+	Name          string            `json:"name"`
+	Ready         bool              `json:"ready"`
+	RunningStatus string            `json:"running_status"`
+	FtLags        int64             `json:"ft_lags"`
+	SenderErrors  map[string]string `json:"sender_errors,omitempty"`
+	Reasons       []string          `json:"reasons,omitempty"`
+}
+
+// Readiness 是 /readyz 的返回内容
+type Readiness struct {
+	Ready   bool                    `json:"ready"`
+	Runners map[string]RunnerHealth `json:"runners"`
+}
+
+// senderErrorsGetter 返回每个 sender 最近一次发送的错误
+type senderErrorsGetter interface {
+	SenderErrors() map[string]string
+}
+
+func (r *LogExportRunner) SenderErrors() map[string]string {
+	r.rsMutex.RLock()
+	defer r.rsMutex.RUnlock()
+	errs := make(map[string]string, len(r.senderErrs))
+	for k, v := range r.senderErrs {
+		errs[k] = v
+	}
+	return errs
+}
+
+func (m *Manager) readyMaxFtLags() int64 {
+	if m.ReadyMaxFtLags > 0 {
+		return m.ReadyMaxFtLags
+	}
+	return DefaultReadyMaxFtLags
+}
+
+// Readiness 检查所有 runner 是否就绪: 应当运行的 runner 都已启动, sender 最近一次发送没有失败,
+// 并且磁盘队列的积压没有超过 ready_max_ft_lags; 被手动停止或者不在活动时间窗口内的 runner 不影响就绪状态
+func (m *Manager) Readiness() Readiness {
+	maxFtLags := m.readyMaxFtLags()
+	type runnerInfo struct {
+		conf    RunnerConfig
+		runner  Runner
+		running bool
+		waiting bool
+	}
+	m.lock.RLock()
+	infos := make(map[string]runnerInfo, len(m.runnerConfig))
+	for file, conf := range m.runnerConfig {
+		r, ok := m.runners[file]
+		infos[file] = runnerInfo{conf: conf, runner: r, running: ok, waiting: m.scheduleStopped[file]}
+	}
+	m.lock.RUnlock()
+
+	readiness := Readiness{Ready: true, Runners: make(map[string]RunnerHealth, len(infos))}
+	for file, info := range infos {
+		name := info.conf.RunnerName
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(file), ".conf")
+		}
+		h := RunnerHealth{Name: name, Ready: true}
+		switch {
+		case info.running:
+			rs := info.runner.Status()
+			h.RunningStatus = rs.RunningStatus
+			h.FtLags = rs.Lag.Ftlags
+			if h.FtLags > maxFtLags {
+				h.Reasons = append(h.Reasons, fmt.Sprintf("fault tolerant queue lags %v exceed %v", h.FtLags, maxFtLags))
+			}
+			if sg, ok := info.runner.(senderErrorsGetter); ok {
+				h.SenderErrors = sg.SenderErrors()
+				senders := make([]string, 0, len(h.SenderErrors))
+				for s := range h.SenderErrors {
+					senders = append(senders, s)
+				}
+				sort.Strings(senders)
+				for _, s := range senders {
+					h.Reasons = append(h.Reasons, fmt.Sprintf("sender %v failed to send: %v", s, h.SenderErrors[s]))
+				}
+			}
+		case info.conf.IsStopped:
+			h.RunningStatus = RunnerStopped
+		case info.waiting:
+			h.RunningStatus = RunnerWaiting
+		default:
+			h.RunningStatus = RunnerStopped
+			h.Reasons = append(h.Reasons, "runner is not started")
+		}
+		if len(h.Reasons) > 0 {
+			h.Ready = false
+			readiness.Ready = false
+		}
+		readiness.Runners[name] = h
+	}
+	return readiness
+}
+
+var processStartTime = time.Now()
+
+// GET /healthz
+// 只要进程能够处理请求就返回 200, 用于存活检查
+func (rs *RestService) GetHealthz() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, map[string]interface{}{
+			"status":     "ok",
+			"version":    rs.mgr.Version,
+			"start_time": processStartTime.Format(time.RFC3339),
+		})
+	}
+}
+
+// GET /readyz
+// 所有 runner 都就绪时返回 200, 否则返回 503, 返回内容中包含每个 runner 的详细情况
+func (rs *RestService) GetReadyz() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		readiness := rs.mgr.Readiness()
+		if readiness.Ready {
+			return RespSuccess(c, readiness)
+		}
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"code":    ErrNotReady,
+			"message": "some runners are not ready",
+			"data":    readiness,
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+type mockHealthRunner struct {
+	name       string
+	ftLags     int64
+	senderErrs map[string]string
+}
+
+func (r *mockHealthRunner) Name() string       { return r.name }
+func (r *mockHealthRunner) Run()               {}
+func (r *mockHealthRunner) Stop()              {}
+func (r *mockHealthRunner) Cleaner() CleanInfo { return CleanInfo{} }
+func (r *mockHealthRunner) Status() RunnerStatus {
+	return RunnerStatus{Name: r.name, RunningStatus: RunnerRunning, Lag: LagInfo{Ftlags: r.ftLags}}
+}
+func (r *mockHealthRunner) SenderErrors() map[string]string { return r.senderErrs }
+
+func TestReadiness(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestReadiness", ServerBackup: true, ReadyMaxFtLags: 100})
+	assert.NoError(t, err)
+	file := func(name string) string { return filepath.Join(m.RestDir, name+".conf") }
+	m.runnerConfig[file("r1")] = RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "r1"}}
+	m.runners[file("r1")] = &mockHealthRunner{name: "r1", ftLags: 10}
+	m.runnerConfig[file("stopped")] = RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "stopped"}, IsStopped: true}
+	m.runnerConfig[file("waiting")] = RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "waiting"}}
+	m.scheduleStopped[file("waiting")] = true
+
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET("/healthz", rs.GetHealthz())
+	router.GET("/readyz", rs.GetReadyz())
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	readiness := m.Readiness()
+	assert.True(t, readiness.Ready)
+	assert.Equal(t, RunnerWaiting, readiness.Runners["waiting"].RunningStatus)
+	assert.Equal(t, http.StatusOK, get("/readyz").Code)
+
+	m.runners[file("r1")] = &mockHealthRunner{name: "r1", ftLags: 1000, senderErrs: map[string]string{"pandora": "timeout"}}
+	m.runnerConfig[file("lost")] = RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "lost"}}
+	readiness = m.Readiness()
+	assert.False(t, readiness.Ready)
+	assert.Len(t, readiness.Runners["r1"].Reasons, 2)
+	assert.Equal(t, map[string]string{"pandora": "timeout"}, readiness.Runners["r1"].SenderErrors)
+	assert.Equal(t, []string{"runner is not started"}, readiness.Runners["lost"].Reasons)
+	assert.True(t, readiness.Runners["stopped"].Ready)
+
+	rec := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrNotReady)
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+}
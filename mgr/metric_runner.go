@@ -62,25 +62,6 @@ func NewMetric(tp string) (metric.Collector, error) {
 }
 
 func NewMetricRunner(rc RunnerConfig, sr *sender.Registry) (runner *MetricRunner, err error) {
-	if rc.CollectInterval <= 0 {
-		rc.CollectInterval = defaultCollectInterval
-	}
-	interval := time.Duration(rc.CollectInterval) * time.Second
-	cf := conf.MapConf{
-		GlobalKeyName:  rc.RunnerName,
-		KeyRunnerName:  rc.RunnerName,
-		reader.KeyMode: reader.ModeMetrics,
-	}
-	if rc.ExtraInfo {
-		cf[ExtraInfo] = Bool2String(rc.ExtraInfo)
-	}
-	meta, err := reader.NewMetaWithConf(cf)
-	if err != nil {
-		return nil, fmt.Errorf("Runner "+rc.RunnerName+" add failed, err is %v", err)
-	}
-	for i := range rc.SendersConfig {
-		rc.SendersConfig[i][KeyRunnerName] = rc.RunnerName
-	}
 	collectors := make([]metric.Collector, 0)
 	transformers := make(map[string][]transforms.Transformer)
 	if len(rc.MetricConfig) == 0 {
@@ -163,6 +144,31 @@ func NewMetricRunner(rc RunnerConfig, sr *sender.Registry) (runner *MetricRunner
 		err = errors.New("no collectors were added")
 		return
 	}
+	return newMetricRunnerWithCollectors(rc, sr, collectors, transformers)
+}
+
+// newMetricRunnerWithCollectors 使用给定的 collectors 创建 MetricRunner
+func newMetricRunnerWithCollectors(rc RunnerConfig, sr *sender.Registry, collectors []metric.Collector,
+	transformers map[string][]transforms.Transformer) (runner *MetricRunner, err error) {
+	if rc.CollectInterval <= 0 {
+		rc.CollectInterval = defaultCollectInterval
+	}
+	interval := time.Duration(rc.CollectInterval) * time.Second
+	cf := conf.MapConf{
+		GlobalKeyName:  rc.RunnerName,
+		KeyRunnerName:  rc.RunnerName,
+		reader.KeyMode: reader.ModeMetrics,
+	}
+	if rc.ExtraInfo {
+		cf[ExtraInfo] = Bool2String(rc.ExtraInfo)
+	}
+	meta, err := reader.NewMetaWithConf(cf)
+	if err != nil {
+		return nil, fmt.Errorf("Runner "+rc.RunnerName+" add failed, err is %v", err)
+	}
+	for i := range rc.SendersConfig {
+		rc.SendersConfig[i][KeyRunnerName] = rc.RunnerName
+	}
 
 	senders := make([]sender.Sender, 0)
 	for _, senderConfig := range rc.SendersConfig {
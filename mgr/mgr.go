@@ -15,6 +15,7 @@ import (
 	config "github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/parser"
 	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/secrets"
 	"github.com/qiniu/logkit/sender"
 	. "github.com/qiniu/logkit/utils/models"
 	utilsos "github.com/qiniu/logkit/utils/os"
@@ -37,12 +38,76 @@ type ManagerConfig struct {
 	Cluster      ClusterConfig `json:"cluster"`
 	DisableWeb   bool          `json:"disable_web"`
 	ServerBackup bool          `json:"-"`
+
+	DrainTimeout   int  `json:"drain_timeout"`    // 退出时等待数据发送完毕的最长时间，单位秒
+	DrainDiskQueue bool `json:"drain_disk_queue"` // 退出时是否等待 fault tolerant 磁盘队列中的数据也发送完毕
+
+	Secrets                map[string]config.MapConf `json:"secrets"`                  // 密钥管理服务的配置, key 为 provider 的名字
+	SecretsRefreshInterval int                       `json:"secrets_refresh_interval"` // 重新获取密钥的间隔, 单位秒
+
+	Debug DebugConfig `json:"debug"` // pprof 等调试接口的配置, 也可以在运行时通过 API 修改
+
+	SelfMonitor SelfMonitorConfig `json:"self_monitor"` // 收集 logkit 自身的运行状态和日志
+
+	AuditLogPath string `json:"audit_log_path"` // 审计日志的路径, 记录通过 API 对 runner 的所有操作, 为空时不记录
+
+	ReadyMaxFtLags int64 `json:"ready_max_ft_lags"` // fault tolerant 磁盘队列积压超过该值时 /readyz 认为 runner 没有就绪
+
+	StatsHistory StatsHistoryConfig `json:"stats_history"` // runner 统计信息的历史记录, 用于绘制吞吐量和 lag 的曲线
+
+	Alert AlertConfig `json:"alert"` // runner 健康状况的告警规则
+
+	Upgrade UpgradeConfig `json:"upgrade"` // 通过 API 或者 master 升级 logkit
+
+	MaxReadKBPerSecond int `json:"max_read_kb_per_second"` // 所有 runner 读取的总带宽上限, 单位 KB/s, 0 表示不限制, 也可以在运行时通过 API 修改
 }
 
+// cleanPendingInterval 是重新检查等待确认的文件的间隔
+var cleanPendingInterval = 30 * time.Second
+
+// cleanQueue 记录读取同一个日志目录的所有 runner，文件只有在每个 runner 都确认读完之后才会被清理
 type cleanQueue struct {
-	cleanerCount int
-	filecount    map[string]int
-	key          string //where this queue is stored
+	cleanerCount int                      // 开启了 cleaner 的 runner 数量
+	refs         map[string]*cleanRef     // 读取该目录的 runner，key 为 cleaner 名称，没有 cleaner 的 runner 为 runner 名称
+	pending      map[string]*pendingClean // 已经收到清理信号但还在等待其他 runner 确认的文件，key 为文件路径
+	key          string                   //where this queue is stored
+}
+
+type cleanRef struct {
+	count int
+	done  func(path string) bool
+}
+
+type pendingClean struct {
+	sig       cleaner.CleanSignal
+	confirmed map[string]bool
+}
+
+func (q *cleanQueue) confirm(path string, sig cleaner.CleanSignal) {
+	p, ok := q.pending[path]
+	if !ok {
+		p = &pendingClean{confirmed: make(map[string]bool)}
+		q.pending[path] = p
+	}
+	p.sig = sig
+	p.confirmed[sig.Cleaner] = true
+}
+
+// canClean 检查是否所有读取该目录的 runner 都已经读完了文件
+func (q *cleanQueue) canClean(path string) bool {
+	p := q.pending[path]
+	for name, ref := range q.refs {
+		if ref.done != nil {
+			if !ref.done(path) {
+				return false
+			}
+			continue
+		}
+		if p == nil || !p.confirmed[name] {
+			return false
+		}
+	}
+	return true
 }
 
 type Manager struct {
@@ -56,6 +121,17 @@ type Manager struct {
 	runners      map[string]Runner
 	runnerConfig map[string]RunnerConfig
 
+	scheduleStopped map[string]bool // 因不在活动时间窗口内而被停止的 runner
+	exitChan        chan struct{}
+	exitOnce        sync.Once // 保证重复调用 Stop 时 exitChan 和 cleanChan 只关闭一次
+	secrets         *secrets.Registry
+	secretDigests   map[string]string // runner 引用的密钥的摘要, 用于判断密钥是否发生了变化
+	selfRunners     []Runner          // 自监控的 runner, 不属于用户配置的 runner
+	audit           *auditLog
+	templates       *templateStore
+	statsHistory    *statsHistory // 为 nil 时不记录
+	alerts          *alertEngine  // 没有配置告警规则时为 nil
+
 	watchers  map[string]*fsnotify.Watcher // inode到watcher的映射表
 	rregistry *reader.Registry
 	pregistry *parser.Registry
@@ -90,6 +166,10 @@ func NewCustomManager(conf ManagerConfig, rr *reader.Registry, pr *parser.Regist
 			log.Warnf("make dir for rest default dir error %v", err)
 		}
 	}
+	secretRegistry, err := secrets.NewRegistry(conf.Secrets)
+	if err != nil {
+		return nil, err
+	}
 	m := &Manager{
 		ManagerConfig: conf,
 		lock:          new(sync.RWMutex),
@@ -104,19 +184,57 @@ func NewCustomManager(conf ManagerConfig, rr *reader.Registry, pr *parser.Regist
 		pregistry:     pr,
 		sregistry:     sr,
 		SystemInfo:    utilsos.GetOSInfo().String(),
+
+		scheduleStopped: make(map[string]bool),
+		exitChan:        make(chan struct{}),
+		secrets:         secretRegistry,
+		secretDigests:   make(map[string]string),
+	}
+	globalReadLimit.set(conf.MaxReadKBPerSecond)
+	if m.templates, err = newTemplateStore(filepath.Join(conf.RestDir, templateDirName)); err != nil {
+		return nil, err
+	}
+	if !conf.StatsHistory.Disable {
+		m.statsHistory = newStatsHistory(conf.StatsHistory)
+	}
+	if len(conf.Alert.Rules) > 0 {
+		if m.alerts, err = newAlertEngine(conf.Alert); err != nil {
+			return nil, err
+		}
+	}
+	if conf.AuditLogPath != "" {
+		if m.audit, err = newAuditLog(conf.AuditLogPath); err != nil {
+			return nil, err
+		}
 	}
 	return m, nil
 }
 
+// Stop 停止所有 runner，支持优雅退出的 runner 会并发地在 drain_timeout 内把数据尽量发送完毕
 func (m *Manager) Stop() error {
+	timeout := defaultStopTimeout
+	if m.DrainTimeout > 0 {
+		timeout = time.Duration(m.DrainTimeout) * time.Second
+	}
+	m.stopSelfMonitor()
 	m.lock.Lock()
+	var wg sync.WaitGroup
 	for _, runner := range m.runners {
-		runner.Stop()
-		runnerStatus, ok := runner.(StatusPersistable)
-		if ok {
-			runnerStatus.StatusBackup()
-		}
+		wg.Add(1)
+		go func(runner Runner) {
+			defer wg.Done()
+			if gs, ok := runner.(GracefulStoppable); ok {
+				gs.GracefulStop(timeout, m.DrainDiskQueue)
+			} else {
+				runner.Stop()
+			}
+			runnerStatus, ok := runner.(StatusPersistable)
+			if ok {
+				runnerStatus.StatusBackup()
+			}
+		}(runner)
 	}
+	wg.Wait()
 	m.lock.Unlock()
 
 	m.watcherMux.Lock()
@@ -126,7 +244,13 @@ func (m *Manager) Stop() error {
 		}
 	}
 	m.watcherMux.Unlock()
-	close(m.cleanChan)
+	m.exitOnce.Do(func() {
+		close(m.exitChan)
+		close(m.cleanChan)
+		if m.audit != nil {
+			m.audit.Close()
+		}
+	})
 	return nil
 }
 
@@ -157,8 +281,10 @@ func (m *Manager) RemoveWithConfig(confPath string, isDelete bool) (err error) {
 	m.removeCleanQueue(runner.Cleaner())
 	runner.Stop()
 	delete(m.runners, confPath)
+	delete(m.secretDigests, confPath)
 	if isDelete {
 		delete(m.runnerConfig, confPath)
+		delete(m.scheduleStopped, confPath)
 	}
 	log.Infof("runner %s be removed, total %d", runner.Name(), len(m.runners))
 	if runnerStatus, ok := runner.(StatusPersistable); ok {
@@ -178,16 +304,24 @@ func (m *Manager) addCleanQueue(info CleanInfo) {
 	m.cleanLock.Lock()
 	defer m.cleanLock.Unlock()
 	cq, ok := m.cleanQueues[info.logdir]
-	if ok {
-		cq.cleanerCount++
-	} else {
+	if !ok {
 		cq = &cleanQueue{
-			cleanerCount: 1,
-			filecount:    make(map[string]int),
-			key:          info.logdir,
+			refs:    make(map[string]*cleanRef),
+			pending: make(map[string]*pendingClean),
+			key:     info.logdir,
 		}
 	}
-	log.Info(">>>>>>>>>>>> add clean queue", cq.cleanerCount, info.logdir)
+	ref, ok := cq.refs[info.name]
+	if ok {
+		log.Warnf("cleaner name %v is used by more than one runner reading %v, files may be cleaned before all of them finish reading", info.name, info.logdir)
+		ref.count++
+	} else {
+		cq.refs[info.name] = &cleanRef{count: 1, done: info.done}
+	}
+	if info.done == nil {
+		cq.cleanerCount++
+	}
+	log.Info(">>>>>>>>>>>> add clean queue", cq.cleanerCount, len(cq.refs), info.logdir)
 	m.cleanQueues[info.logdir] = cq
 	return
 }
@@ -203,11 +337,22 @@ func (m *Manager) removeCleanQueue(info CleanInfo) {
 		log.Errorf("can't find clean queue %v to remove", info.logdir)
 		return
 	}
-	cq.cleanerCount--
-	if cq.cleanerCount <= 0 {
+	if info.done == nil {
+		cq.cleanerCount--
+	}
+	if ref, ok := cq.refs[info.name]; ok {
+		ref.count--
+		if ref.count <= 0 {
+			delete(cq.refs, info.name)
+			for _, p := range cq.pending {
+				delete(p.confirmed, info.name)
+			}
+		}
+	}
+	if len(cq.refs) <= 0 {
 		delete(m.cleanQueues, info.logdir)
 	}
-	log.Info(">>>>>>>>>>>> remove clean queue", cq.cleanerCount, info.logdir)
+	log.Info(">>>>>>>>>>>> remove clean queue", cq.cleanerCount, len(cq.refs), info.logdir)
 	return
 }
 
@@ -227,8 +372,7 @@ func (m *Manager) Add(confPath string) {
 		log.Errorf("Config %q has already been added", confPath)
 		return
 	}
-	var conf RunnerConfig
-	err = config.LoadEx(&conf, confPath)
+	conf, err := m.loadRunnerConfig(confPath)
 	if err != nil {
 		log.Warnf("Failed to load config %q: %v", confPath, err)
 		return
@@ -248,9 +392,16 @@ func (m *Manager) Add(confPath string) {
 	return
 }
 
+// loadRunnerConfig 读取 runner 配置文件并展开 ${ENV} 和 @include(path)，配置文件夹和 RestDir 中的配置使用相同的规则
+func (m *Manager) loadRunnerConfig(confPath string) (conf RunnerConfig, err error) {
+	err = config.LoadExpandEx(&conf, confPath)
+	return
+}
+
 func (m *Manager) ForkRunner(confPath string, nconf RunnerConfig, errReturn bool) error {
 	var runner Runner
 	var err error
+	var secretDigest string
 	i := 0
 	for {
 		if m.IsRunning(confPath) {
@@ -266,6 +417,22 @@ func (m *Manager) ForkRunner(confPath string, nconf RunnerConfig, errReturn bool
 			m.lock.Unlock()
 			return nil
 		}
+		schedule, err := NewSchedule(nconf.ActiveWindows)
+		if err != nil {
+			err = fmt.Errorf("runner %v active windows error %v", nconf.RunnerName, err)
+			if !errReturn {
+				log.Error(err)
+			}
+			return err
+		}
+		if !schedule.IsActive(time.Now()) {
+			log.Infof("runner %v is out of its active windows, wait for it", nconf.RunnerName)
+			m.lock.Lock()
+			m.runnerConfig[confPath] = nconf
+			m.scheduleStopped[confPath] = true
+			m.lock.Unlock()
+			return nil
+		}
 		for k := range nconf.SendersConfig {
 			var webornot string
 			if nconf.IsInWebFolder {
@@ -275,8 +442,17 @@ func (m *Manager) ForkRunner(confPath string, nconf RunnerConfig, errReturn bool
 			}
 			nconf.SendersConfig[k][sender.InnerUserAgent] = "logkit/" + m.Version + " " + m.SystemInfo + " " + webornot
 		}
+		runConf, digest, err := m.resolveSecrets(nconf)
+		if err != nil {
+			err = fmt.Errorf("runner %v resolve secrets error %v", nconf.RunnerName, err)
+			if !errReturn {
+				log.Error(err)
+			}
+			return err
+		}
+		secretDigest = digest
 
-		if runner, err = NewCustomRunner(nconf, m.cleanChan, m.rregistry, m.pregistry, m.sregistry); err != nil {
+		if runner, err = NewCustomRunner(runConf, m.cleanChan, m.rregistry, m.pregistry, m.sregistry); err != nil {
 			errVal, ok := err.(*os.PathError)
 			if !ok {
 				err = fmt.Errorf("NewRunner(%v) failed: %v", nconf.RunnerName, err)
@@ -311,6 +487,10 @@ func (m *Manager) ForkRunner(confPath string, nconf RunnerConfig, errReturn bool
 	go runner.Run()
 	m.runners[confPath] = runner
 	m.runnerConfig[confPath] = nconf
+	delete(m.scheduleStopped, confPath)
+	if secretDigest != "" {
+		m.secretDigests[confPath] = secretDigest
+	}
 	log.Infof("new Runner[%v] is added, total %d", nconf.RunnerName, len(m.runners))
 	return nil
 }
@@ -370,7 +550,7 @@ func (m *Manager) getCleanQueues(dir, file, mode string) ([]*cleanQueue, error)
 	if mode == reader.ModeTailx {
 		cleanQueues := make([]*cleanQueue, 0, len(m.cleanQueues))
 		for k, v := range m.cleanQueues {
-			matched, err := filepath.Match(k, filepath.Join(dir, file))
+			matched, err := utilsos.Match(k, filepath.Join(dir, file))
 			if err != nil {
 				log.Errorf("match pattern[%v] to path(%v) err %v", k, filepath.Join(dir, file), err)
 				continue
@@ -403,40 +583,86 @@ func (m *Manager) doClean(sig cleaner.CleanSignal) {
 		log.Error(sig.Cleaner, err)
 		return
 	}
-	//check if all queues can be cleaned
-	var canBeDeleted = true
+	path := filepath.Join(dir, file)
 	for _, q := range queues {
-		count := q.filecount[file] + 1
-		if count < q.cleanerCount {
-			canBeDeleted = false
-		}
-		q.filecount[file] = count
+		q.confirm(path, sig)
 	}
-	if canBeDeleted {
-		catdir := filepath.Join(dir, file)
-		err := os.Remove(catdir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				log.Warnf("clean %v failed as logfile is not exist: %v", catdir, err)
-			} else {
-				log.Errorf("clean %v failed: %v", catdir, err)
+	m.tryClean(path, sig, queues)
+	return
+}
+
+// cleanPending 重新检查等待其他 runner 确认的文件，没有开启 cleaner 的 runner 不会发送清理信号，
+// 只能在它们的 done 文件更新后由这里完成清理
+func (m *Manager) cleanPending() {
+	m.cleanLock.Lock()
+	defer m.cleanLock.Unlock()
+	for _, q := range m.cleanQueues {
+		for path, p := range q.pending {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				delete(q.pending, path)
+				continue
 			}
-		} else {
-			log.Infof("log <%v> was successfully cleaned by cleaner", catdir)
+			queues, err := m.getCleanQueues(filepath.Dir(path), filepath.Base(path), p.sig.ReadMode)
+			if err != nil {
+				log.Error(p.sig.Cleaner, err)
+				continue
+			}
+			m.tryClean(path, p.sig, queues)
 		}
-		for _, q := range queues {
-			delete(q.filecount, file)
+	}
+}
+
+// tryClean 在所有 runner 都确认之后清理文件，调用方需要持有 cleanLock
+func (m *Manager) tryClean(path string, sig cleaner.CleanSignal, queues []*cleanQueue) {
+	for _, q := range queues {
+		if !q.canClean(path) {
+			return
 		}
 	}
+	archived, err := archiveLogFile(sig, path)
+	if err != nil {
+		// 归档失败时保留原文件，避免丢失需要归档的日志
+		log.Errorf("archive %v failed, the logfile is kept: %v", path, err)
+	} else if err = os.Remove(path); err != nil && !(archived && os.IsNotExist(err)) {
+		if os.IsNotExist(err) {
+			log.Warnf("clean %v failed as logfile is not exist: %v", path, err)
+		} else {
+			log.Errorf("clean %v failed: %v", path, err)
+		}
+	} else if archived {
+		log.Infof("log <%v> was successfully archived by cleaner", path)
+	} else {
+		log.Infof("log <%v> was successfully cleaned by cleaner", path)
+	}
 	for _, q := range queues {
-		m.cleanQueues[q.key] = q
+		delete(q.pending, path)
 	}
-	return
+}
+
+// archiveLogFile 在 cleaner 配置了归档时先归档文件，归档成功后文件可能已经被移走
+func archiveLogFile(sig cleaner.CleanSignal, path string) (bool, error) {
+	if sig.Archiver == nil {
+		return false, nil
+	}
+	if err := sig.Archiver.Archive(path); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (m *Manager) clean() {
-	for sig := range m.cleanChan {
-		m.doClean(sig)
+	ticker := time.NewTicker(cleanPendingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case sig, ok := <-m.cleanChan:
+			if !ok {
+				return
+			}
+			m.doClean(sig)
+		case <-ticker.C:
+			m.cleanPending()
+		}
 	}
 }
 
@@ -456,7 +682,7 @@ func (m *Manager) detectMoreWatchers(confsPath []string) {
 
 func (m *Manager) addWatchers(confsPath []string) (err error) {
 	for _, dir := range confsPath {
-		paths, err := filepath.Glob(dir)
+		paths, err := utilsos.Glob(dir)
 		if err != nil {
 			log.Errorf("filepath.Glob(%s): %v, err:%v", dir, paths, err)
 			continue
@@ -512,6 +738,13 @@ func (m *Manager) Watch(confsPath []string) (err error) {
 	}
 	go m.detectMoreWatchers(confsPath)
 	go m.clean()
+	go m.scheduleLoop()
+	go m.secretsLoop()
+	go m.statsHistoryLoop()
+	go m.alertLoop()
+	if serr := m.startSelfMonitor(); serr != nil {
+		log.Errorf("start self monitor error: %v", serr)
+	}
 	return
 }
 
@@ -541,13 +774,17 @@ func (m *Manager) Status() (rss map[string]RunnerStatus) {
 		if r, ex := m.runners[key]; ex {
 			rss[r.Name()] = r.Status()
 		} else {
+			runningStatus := RunnerStopped
+			if m.scheduleStopped[key] {
+				runningStatus = RunnerWaiting
+			}
 			rss[conf.RunnerName] = RunnerStatus{
 				Name:           conf.RunnerName,
 				ReaderStats:    StatsInfo{},
 				ParserStats:    StatsInfo{},
 				TransformStats: make(map[string]StatsInfo),
 				SenderStats:    make(map[string]StatsInfo),
-				RunningStatus:  RunnerStopped,
+				RunningStatus:  runningStatus,
 			}
 		}
 	}
@@ -774,6 +1011,9 @@ func (m *Manager) StartRunner(name string) (err error) {
 func (m *Manager) setRunnerConfig(filename string, conf RunnerConfig) {
 	m.lock.Lock()
 	m.runnerConfig[filename] = conf
+	if conf.IsStopped {
+		delete(m.scheduleStopped, filename)
+	}
 	m.lock.Unlock()
 }
 
@@ -863,9 +1103,10 @@ func (m *Manager) DeleteRunner(name string) (err error) {
 	if err != nil {
 		return err
 	}
-	if conf.IsStopped {
+	if conf.IsStopped || m.isScheduleStopped(filename) {
 		m.lock.Lock()
 		delete(m.runnerConfig, filename)
+		delete(m.scheduleStopped, filename)
 		m.lock.Unlock()
 	}
 	r, runnerOk := m.readRunners(filename)
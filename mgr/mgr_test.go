@@ -11,6 +11,11 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/cleaner"
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
 )
 
 var test1 = `{
@@ -471,3 +476,122 @@ func Test_Watch_LogDir(t *testing.T) {
 	assert.Equal(t, true, ok, fmt.Sprintf("runner of %v exp but not exsit in runners %v", confPathAbs, m.runners))
 	m.Stop()
 }
+
+func TestCleanQueueRefs(t *testing.T) {
+	dir := "TestCleanQueueRefs"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	logdir := filepath.Join(dir, "logs")
+	assert.NoError(t, os.MkdirAll(logdir, 0755))
+	realdir, err := filepath.Abs(logdir)
+	assert.NoError(t, err)
+	m, err := NewManager(ManagerConfig{RestDir: filepath.Join(dir, "rest")})
+	assert.NoError(t, err)
+
+	var readerDone bool
+	c1 := CleanInfo{enable: true, logdir: realdir, name: "c1"}
+	c2 := CleanInfo{enable: true, logdir: realdir, name: "c2"}
+	r3 := CleanInfo{enable: true, logdir: realdir, name: "r3", done: func(string) bool { return readerDone }}
+	m.addCleanQueue(c1)
+	m.addCleanQueue(c2)
+	m.addCleanQueue(r3)
+	assert.Equal(t, 2, m.cleanQueues[realdir].cleanerCount)
+	assert.Equal(t, 3, len(m.cleanQueues[realdir].refs))
+
+	logfile := filepath.Join(logdir, "log1")
+	assert.NoError(t, ioutil.WriteFile(logfile, []byte("abc"), 0644))
+	signal := func(name, file string) {
+		m.doClean(cleaner.CleanSignal{Logdir: logdir, Filename: file, Cleaner: name, ReadMode: "dir"})
+	}
+	exists := func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	}
+
+	// 同一个 cleaner 重复发送信号不能代替其他 runner 的确认
+	signal("c1", "log1")
+	signal("c1", "log1")
+	assert.True(t, exists(logfile))
+	signal("c2", "log1")
+	assert.True(t, exists(logfile))
+	// 没有 cleaner 的 runner 读完之后才会清理
+	readerDone = true
+	m.cleanPending()
+	assert.False(t, exists(logfile))
+	assert.Equal(t, 0, len(m.cleanQueues[realdir].pending))
+
+	// 移除 runner 之后不再等待它的确认
+	logfile2 := filepath.Join(logdir, "log2")
+	assert.NoError(t, ioutil.WriteFile(logfile2, []byte("abc"), 0644))
+	signal("c1", "log2")
+	assert.True(t, exists(logfile2))
+	m.removeCleanQueue(c2)
+	assert.Equal(t, 1, m.cleanQueues[realdir].cleanerCount)
+	m.cleanPending()
+	assert.False(t, exists(logfile2))
+
+	m.removeCleanQueue(c1)
+	m.removeCleanQueue(r3)
+	_, ok := m.cleanQueues[realdir]
+	assert.False(t, ok)
+}
+
+func TestReaderDone(t *testing.T) {
+	dir := "TestReaderDone"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	logdir := filepath.Join(dir, "logs")
+	metapath := filepath.Join(dir, "meta")
+	assert.NoError(t, os.MkdirAll(logdir, 0755))
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: metapath,
+		reader.KeyLogPath:  logdir,
+		reader.KeyMode:     reader.ModeDir,
+	})
+	assert.NoError(t, err)
+	log1 := filepath.Join(logdir, "log1")
+	log2 := filepath.Join(logdir, "log2")
+	assert.NoError(t, ioutil.WriteFile(log1, []byte("abc"), 0644))
+	assert.NoError(t, ioutil.WriteFile(log2, []byte("abc"), 0644))
+	assert.NoError(t, createTestFile(metapath, logdir, log1))
+
+	done := readerDone(meta)
+	abs, err := filepath.Abs(log1)
+	assert.NoError(t, err)
+	assert.True(t, done(abs))
+	assert.False(t, done(log2))
+	assert.False(t, done(filepath.Join(logdir, "log3")))
+}
+
+func TestLoadRunnerConfigExpand(t *testing.T) {
+	dir := "TestLoadRunnerConfigExpand"
+	defer os.RemoveAll(dir)
+	restDir, confDir := filepath.Join(dir, "rest"), filepath.Join(dir, "confs")
+	assert.NoError(t, os.MkdirAll(confDir, DefaultDirPerm))
+	m, err := NewManager(ManagerConfig{RestDir: restDir})
+	assert.NoError(t, err)
+
+	skPath, err := filepath.Abs(filepath.Join(dir, "sk"))
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(skPath, []byte("secret"), 0644))
+	body := `{"name":"r1","reader":{"mode":"dir"},"parser":{"type":"raw"},"senders":[{"sender_type":"discard","sk":"@include(` + skPath + `)","tpl":"${LOGKIT_TEST_NOT_EXIST}"}]}`
+	for _, d := range []string{restDir, confDir} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "r1.conf"), []byte(body), 0644))
+	}
+
+	// 配置文件夹和 RestDir 中的配置都会展开，不存在的环境变量保留原样
+	for _, d := range []string{restDir, confDir} {
+		confPath, _, err := GetRealPath(filepath.Join(d, "r1.conf"))
+		assert.NoError(t, err)
+		rc, err := m.loadRunnerConfig(confPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", rc.SendersConfig[0]["sk"])
+		assert.Equal(t, "${LOGKIT_TEST_NOT_EXIST}", rc.SendersConfig[0]["tpl"])
+
+		os.Setenv("LOGKIT_TEST_NOT_EXIST", "tpl")
+		rc, err = m.loadRunnerConfig(confPath)
+		os.Unsetenv("LOGKIT_TEST_NOT_EXIST")
+		assert.NoError(t, err)
+		assert.Equal(t, "tpl", rc.SendersConfig[0]["tpl"])
+	}
+}
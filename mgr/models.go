@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
 	"github.com/qiniu/logkit/router"
 	. "github.com/qiniu/logkit/utils/models"
 )
@@ -74,11 +75,13 @@ type RunnerConfig struct {
 	ReaderConfig  conf.MapConf             `json:"reader"`
 	CleanerConfig conf.MapConf             `json:"cleaner,omitempty"`
 	ParserConf    conf.MapConf             `json:"parser"`
+	ParserChain   []parser.ChainConfig     `json:"parser_chain,omitempty"` // 在 parser 之后串联解析某个字段的解析器
 	Transforms    []map[string]interface{} `json:"transforms,omitempty"`
 	SendersConfig []conf.MapConf           `json:"senders"`
 	Router        router.RouterConfig      `json:"router,omitempty"`
 	IsInWebFolder bool                     `json:"web_folder,omitempty"`
 	IsStopped     bool                     `json:"is_stopped,omitempty"`
+	Template      *TemplateRef             `json:"template,omitempty"` // 由模板创建的 runner 记录模板名和参数
 }
 
 type RunnerInfo struct {
@@ -93,4 +96,8 @@ type RunnerInfo struct {
 	EnvTag           string `json:"env_tag,omitempty"`
 	ExtraInfo        bool   `json:"extra_info,omitempty"`
 	// 用这个字段的值来获取环境变量, 作为 tag 添加到数据中
+
+	ActiveWindows []ActiveWindow `json:"active_windows,omitempty"` // runner 的活动时间窗口, 窗口外 runner 会被自动停止
+	Quota         *RunnerQuota   `json:"quota,omitempty"`          // runner 的资源配额
+	DeliveryAudit *DeliveryAudit `json:"delivery_audit,omitempty"` // 投递审计, 统计数据在各个阶段的条数用于对账
 }
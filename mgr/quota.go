@@ -0,0 +1,197 @@
+package mgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/rateio"
+	"github.com/qiniu/logkit/sender"
+)
+
+const (
+	RunnerQuotaExceeded = "quota_exceeded"
+
+	quotaDiskCheckInterval = 10 * time.Second
+)
+
+// RunnerQuota 是单个 runner 可以使用的资源上限，为0表示不限制
+type RunnerQuota struct {
+	MaxMemoryMB        int `json:"max_memory_mb,omitempty"`          // runner 在内存中缓存的批次数据上限, 会覆盖更大的 batch_size
+	MaxDiskMB          int `json:"max_disk_mb,omitempty"`            // fault tolerant 磁盘队列占用的空间上限, 超过后暂停读取
+	MaxReadKBPerSecond int `json:"max_read_kb_per_second,omitempty"` // 读取带宽上限
+	MaxSendKBPerSecond int `json:"max_send_kb_per_second,omitempty"` // 发送带宽上限
+}
+
+// globalReadLimit 限制所有 runner 读取的总带宽，在 ManagerConfig 中配置，也可以通过 API 临时修改
+var globalReadLimit = &rateLimit{}
+
+// rateLimit 是可以在运行时修改的带宽限制，单位 KB/s，为0表示不限制
+type rateLimit struct {
+	mutex       sync.RWMutex
+	kbPerSecond int
+	controller  *rateio.Controller
+}
+
+func (l *rateLimit) set(kbPerSecond int) {
+	if kbPerSecond < 0 {
+		kbPerSecond = 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.kbPerSecond = kbPerSecond
+	if l.controller == nil {
+		if kbPerSecond > 0 {
+			l.controller = rateio.NewController(kbPerSecond * 1024)
+		}
+		return
+	}
+	// controller 创建后不再替换，保证正在等待的读取和发送能被及时唤醒
+	l.controller.SetRateLimit(kbPerSecond * 1024)
+}
+
+func (l *rateLimit) get() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.kbPerSecond
+}
+
+func (l *rateLimit) wait(n int64) {
+	l.mutex.RLock()
+	c := l.controller
+	l.mutex.RUnlock()
+	if c != nil {
+		c.Wait(int(n))
+	}
+}
+
+func (l *rateLimit) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.controller != nil {
+		l.controller.Close()
+	}
+}
+
+type quotaController struct {
+	quota    RunnerQuota
+	diskDirs []string
+
+	readLimit *rateLimit
+	sendLimit *rateLimit
+
+	mutex     sync.Mutex
+	diskUsed  int64
+	lastCheck time.Time
+}
+
+// newQuotaController 根据 quota 配置创建资源控制器, 没有配置任何限制时读取和发送的带宽也可以在运行时通过 API 修改
+func newQuotaController(quota *RunnerQuota, diskDirs []string) *quotaController {
+	qc := &quotaController{
+		diskDirs:  diskDirs,
+		readLimit: &rateLimit{},
+		sendLimit: &rateLimit{},
+	}
+	if quota != nil {
+		qc.quota = *quota
+	}
+	qc.readLimit.set(qc.quota.MaxReadKBPerSecond)
+	qc.sendLimit.set(qc.quota.MaxSendKBPerSecond)
+	return qc
+}
+
+// ftSaveDirs 返回 runner 所有 fault tolerant sender 使用的磁盘队列目录
+func ftSaveDirs(rc RunnerConfig, defaultDir string) []string {
+	dirs := make([]string, 0)
+	for _, sc := range rc.SendersConfig {
+		if ft, _ := sc.GetBoolOr(sender.KeyFaultTolerant, true); !ft {
+			continue
+		}
+		dir, _ := sc.GetStringOr(sender.KeyFtSaveLogPath, defaultDir)
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// batchSize 返回 quota 限制后的批次大小
+func (qc *quotaController) batchSize(size int) int {
+	if qc == nil || qc.quota.MaxMemoryMB <= 0 {
+		return size
+	}
+	maxSize := qc.quota.MaxMemoryMB * 1024 * 1024
+	if size <= 0 || size > maxSize {
+		return maxSize
+	}
+	return size
+}
+
+// waitRead 同时受 runner 自身和全局的读取带宽限制
+func (qc *quotaController) waitRead(n int64) {
+	globalReadLimit.wait(n)
+	if qc == nil {
+		return
+	}
+	qc.readLimit.wait(n)
+}
+
+func (qc *quotaController) waitSend(n int64) {
+	if qc == nil {
+		return
+	}
+	qc.sendLimit.wait(n)
+}
+
+// checkDisk 检查磁盘队列占用的空间是否超过限制, 为了避免频繁遍历目录, 结果会缓存一段时间
+func (qc *quotaController) checkDisk(now time.Time) error {
+	if qc == nil || qc.quota.MaxDiskMB <= 0 {
+		return nil
+	}
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	if now.Sub(qc.lastCheck) >= quotaDiskCheckInterval {
+		var used int64
+		for _, dir := range qc.diskDirs {
+			size, err := dirSize(dir)
+			if err != nil {
+				log.Warnf("get disk usage of %v error %v", dir, err)
+			}
+			used += size
+		}
+		qc.diskUsed = used
+		qc.lastCheck = now
+	}
+	if limit := int64(qc.quota.MaxDiskMB) * 1024 * 1024; qc.diskUsed > limit {
+		return fmt.Errorf("disk quota exceeded, fault tolerant queues use %v bytes, limit is %v MB", qc.diskUsed, qc.quota.MaxDiskMB)
+	}
+	return nil
+}
+
+func (qc *quotaController) Close() {
+	if qc == nil {
+		return
+	}
+	qc.readLimit.close()
+	qc.sendLimit.close()
+}
+
+func dirSize(dir string) (size int64, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
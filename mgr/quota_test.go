@@ -0,0 +1,82 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+func TestQuotaController(t *testing.T) {
+	// 没有配置 quota 时不做任何限制
+	for _, quota := range []*RunnerQuota{nil, {}} {
+		qc := newQuotaController(quota, nil)
+		assert.Equal(t, 100, qc.batchSize(100))
+		assert.NoError(t, qc.checkDisk(time.Now()))
+		assert.Equal(t, 0, qc.readLimit.get())
+		assert.Equal(t, 0, qc.sendLimit.get())
+		qc.waitRead(1024 * 1024)
+		qc.waitSend(1024 * 1024)
+		qc.Close()
+	}
+
+	dir := "TestQuotaController"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+
+	qc := newQuotaController(&RunnerQuota{MaxMemoryMB: 1, MaxDiskMB: 1}, []string{dir, "not_exist_dir"})
+	defer qc.Close()
+	assert.Equal(t, 1024*1024, qc.batchSize(0))
+	assert.Equal(t, 1024*1024, qc.batchSize(2*1024*1024))
+	assert.Equal(t, 1024, qc.batchSize(1024))
+
+	now := time.Now()
+	assert.NoError(t, qc.checkDisk(now))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "queue.dat"), make([]byte, 2*1024*1024), 0644))
+	// 结果有缓存，检查间隔内不会重新计算
+	assert.NoError(t, qc.checkDisk(now.Add(time.Second)))
+	assert.Error(t, qc.checkDisk(now.Add(quotaDiskCheckInterval)))
+}
+
+func TestFtSaveDirs(t *testing.T) {
+	rc := RunnerConfig{
+		SendersConfig: []conf.MapConf{
+			{"sender_type": "file"},
+			{"sender_type": "file", "fault_tolerant": "true", "ft_save_log_path": "/tmp/ft"},
+			{"sender_type": "file", "fault_tolerant": "false"},
+		},
+	}
+	assert.Equal(t, []string{"/meta/ft", "/tmp/ft"}, ftSaveDirs(rc, "/meta/ft"))
+}
+
+func TestRateLimit(t *testing.T) {
+	l := &rateLimit{}
+	defer l.close()
+	// 没有限制时不会创建 controller
+	l.set(0)
+	assert.Nil(t, l.controller)
+	l.wait(64 * 1024 * 1024)
+
+	l.set(64)
+	assert.Equal(t, 64, l.get())
+	done := make(chan struct{})
+	go func() {
+		l.wait(64 * 1024 * 1024)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// 放开限制后正在等待的读取会被唤醒
+	l.set(-1)
+	assert.Equal(t, 0, l.get())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait is not released after the limit is removed")
+	}
+}
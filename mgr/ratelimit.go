@@ -0,0 +1,167 @@
+package mgr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// RateLimit 是读取和发送的带宽限制, 单位 KB/s, 0 表示不限制。
+// 通过 API 修改时为空的字段保持不变, 修改只在运行时生效, 不会写入配置文件, runner 重启后恢复为 quota 中的配置
+type RateLimit struct {
+	MaxReadKBPerSecond *int `json:"max_read_kb_per_second,omitempty"`
+	MaxSendKBPerSecond *int `json:"max_send_kb_per_second,omitempty"`
+}
+
+// RateLimitable 的 runner 可以在运行时修改读取和发送的带宽限制
+type RateLimitable interface {
+	RateLimit() RateLimit
+	SetRateLimit(limit RateLimit) error
+}
+
+func (l RateLimit) validate() error {
+	if l.MaxReadKBPerSecond != nil && *l.MaxReadKBPerSecond < 0 {
+		return errors.New("max_read_kb_per_second should not be negative")
+	}
+	if l.MaxSendKBPerSecond != nil && *l.MaxSendKBPerSecond < 0 {
+		return errors.New("max_send_kb_per_second should not be negative")
+	}
+	return nil
+}
+
+func (r *LogExportRunner) RateLimit() RateLimit {
+	var read, send int
+	if r.quota != nil {
+		read, send = r.quota.readLimit.get(), r.quota.sendLimit.get()
+	}
+	return RateLimit{MaxReadKBPerSecond: &read, MaxSendKBPerSecond: &send}
+}
+
+func (r *LogExportRunner) SetRateLimit(limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	if r.quota == nil {
+		return fmt.Errorf("runner %v does not support rate limit", r.Name())
+	}
+	if limit.MaxReadKBPerSecond != nil {
+		r.quota.readLimit.set(*limit.MaxReadKBPerSecond)
+	}
+	if limit.MaxSendKBPerSecond != nil {
+		r.quota.sendLimit.set(*limit.MaxSendKBPerSecond)
+	}
+	return nil
+}
+
+// GlobalRateLimit 返回所有 runner 共享的带宽限制, 目前只支持读取带宽
+func GlobalRateLimit() RateLimit {
+	read := globalReadLimit.get()
+	return RateLimit{MaxReadKBPerSecond: &read}
+}
+
+func SetGlobalRateLimit(limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	if limit.MaxSendKBPerSecond != nil {
+		return errors.New("global max_send_kb_per_second is not supported, please set it for each runner")
+	}
+	if limit.MaxReadKBPerSecond != nil {
+		globalReadLimit.set(*limit.MaxReadKBPerSecond)
+	}
+	return nil
+}
+
+func (m *Manager) getRateLimitable(name string) (RateLimitable, error) {
+	r, ok := m.getRunnerByName(name)
+	if !ok {
+		return nil, fmt.Errorf("runner %v is not found or not running", name)
+	}
+	rl, ok := r.(RateLimitable)
+	if !ok {
+		return nil, fmt.Errorf("runner %v does not support rate limit", name)
+	}
+	return rl, nil
+}
+
+// RunnerRateLimit 返回 runner 当前的带宽限制
+func (m *Manager) RunnerRateLimit(name string) (RateLimit, error) {
+	rl, err := m.getRateLimitable(name)
+	if err != nil {
+		return RateLimit{}, err
+	}
+	return rl.RateLimit(), nil
+}
+
+// SetRunnerRateLimit 修改 runner 的带宽限制, 返回修改后的限制
+func (m *Manager) SetRunnerRateLimit(name string, limit RateLimit) (RateLimit, error) {
+	rl, err := m.getRateLimitable(name)
+	if err != nil {
+		return RateLimit{}, err
+	}
+	if err = rl.SetRateLimit(limit); err != nil {
+		return RateLimit{}, err
+	}
+	return rl.RateLimit(), nil
+}
+
+// GET /logkit/ratelimit
+func (rs *RestService) GetRateLimit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, GlobalRateLimit())
+	}
+}
+
+// PUT /logkit/ratelimit
+// 临时修改所有 runner 共享的读取带宽, 用于故障时整体限流或者放开限制
+func (rs *RestService) PutRateLimit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var limit RateLimit
+		if err := c.Bind(&limit); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRateLimit, err.Error())
+		}
+		if err := SetGlobalRateLimit(limit); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRateLimit, err.Error())
+		}
+		current := GlobalRateLimit()
+		log.Warnf("global read limit is changed to %v KB/s", *current.MaxReadKBPerSecond)
+		return RespSuccess(c, current)
+	}
+}
+
+// GET /logkit/configs/<name>/ratelimit
+func (rs *RestService) GetConfigRateLimit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		limit, err := rs.mgr.RunnerRateLimit(name)
+		if err != nil {
+			return RespError(c, http.StatusNotFound, ErrRateLimit, err.Error())
+		}
+		return RespSuccess(c, limit)
+	}
+}
+
+// PUT /logkit/configs/<name>/ratelimit
+func (rs *RestService) PutConfigRateLimit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		var limit RateLimit
+		if err := c.Bind(&limit); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRateLimit, err.Error())
+		}
+		if _, ok := rs.mgr.getRunnerByName(name); !ok {
+			return RespError(c, http.StatusNotFound, ErrRateLimit, "runner "+name+" is not found or not running")
+		}
+		current, err := rs.mgr.SetRunnerRateLimit(name, limit)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRateLimit, err.Error())
+		}
+		log.Warnf("Runner[%v] rate limit is changed to read %v KB/s, send %v KB/s", name, *current.MaxReadKBPerSecond, *current.MaxSendKBPerSecond)
+		return RespSuccess(c, current)
+	}
+}
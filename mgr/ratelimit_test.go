@@ -0,0 +1,93 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunnerRateLimitAPI(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestRunnerRateLimitAPI", ServerBackup: true})
+	assert.NoError(t, err)
+	defer os.RemoveAll("TestRunnerRateLimitAPI")
+	r := &LogExportRunner{
+		RunnerInfo: RunnerInfo{RunnerName: "r1"},
+		quota:      newQuotaController(&RunnerQuota{MaxReadKBPerSecond: 100}, nil),
+	}
+	defer r.quota.Close()
+	m.runners["r1.conf"] = r
+	m.runners["r2.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r2"}}
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/configs/:name/ratelimit", rs.GetConfigRateLimit())
+	router.PUT(PREFIX+"/configs/:name/ratelimit", rs.PutConfigRateLimit())
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, PREFIX+path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/configs/r1/ratelimit", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"max_read_kb_per_second":100`)
+	assert.Contains(t, rec.Body.String(), `"max_send_kb_per_second":0`)
+
+	// 只修改发送带宽，读取带宽保持不变
+	rec = request(http.MethodPut, "/configs/r1/ratelimit", `{"max_send_kb_per_second":200}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 100, r.quota.readLimit.get())
+	assert.Equal(t, 200, r.quota.sendLimit.get())
+
+	rec = request(http.MethodPut, "/configs/r1/ratelimit", `{"max_read_kb_per_second":0}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, r.quota.readLimit.get())
+
+	for path, code := range map[string]int{
+		"/configs/r1/ratelimit": http.StatusBadRequest,
+		"/configs/r2/ratelimit": http.StatusBadRequest,
+		"/configs/r3/ratelimit": http.StatusNotFound,
+	} {
+		rec = request(http.MethodPut, path, `{"max_read_kb_per_second":-1}`)
+		assert.Equal(t, code, rec.Code, path)
+	}
+	rec = request(http.MethodPut, "/configs/r2/ratelimit", `{"max_read_kb_per_second":1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGlobalRateLimitAPI(t *testing.T) {
+	defer globalReadLimit.set(0)
+	rs := &RestService{}
+	router := echo.New()
+	router.GET(PREFIX+"/ratelimit", rs.GetRateLimit())
+	router.PUT(PREFIX+"/ratelimit", rs.PutRateLimit())
+
+	request := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, PREFIX+"/ratelimit", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodPut, `{"max_read_kb_per_second":1024}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1024, globalReadLimit.get())
+
+	rec = request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"max_read_kb_per_second":1024`)
+
+	rec = request(http.MethodPut, `{"max_send_kb_per_second":1024}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(http.MethodPut, `{"max_read_kb_per_second":-1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 1024, globalReadLimit.get())
+}
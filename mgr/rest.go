@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/utils/logger"
 	. "github.com/qiniu/logkit/utils/models"
 	utilsos "github.com/qiniu/logkit/utils/os"
 
@@ -33,6 +34,8 @@ type RestService struct {
 	l       net.Listener
 	cluster *Cluster
 	address string
+	debug   *debugService
+	upgrade *upgrader
 }
 
 func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
@@ -50,10 +53,21 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	rs := &RestService{
 		mgr:     mgr,
 		cluster: NewCluster(&mgr.Cluster),
+		debug:   newDebugService(mgr.Debug),
 	}
 	rs.cluster.mutex = new(sync.RWMutex)
+	upgrade, uerr := newUpgrader(mgr.Upgrade)
+	if uerr != nil {
+		log.Fatalf("init upgrade error %v", uerr)
+	}
+	upgrade.restart = rs.restartForUpgrade
+	rs.upgrade = upgrade
 	router.GET(PREFIX+"/status", rs.Status())
 
+	// health check API
+	router.GET("/healthz", rs.GetHealthz())
+	router.GET("/readyz", rs.GetReadyz())
+
 	// error code humanize
 	router.GET(PREFIX+"/errorcode", rs.GetErrorCodeHumanize())
 
@@ -64,11 +78,42 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	router.POST(PREFIX+"/configs/:name/stop", rs.PostConfigStop())
 	router.POST(PREFIX+"/configs/:name/start", rs.PostConfigStart())
 	router.POST(PREFIX+"/configs/:name/reset", rs.PostConfigReset())
+	router.POST(PREFIX+"/configs/:name/flush", rs.PostConfigFlush())
+	router.POST(PREFIX+"/configs/:name/trace", rs.PostConfigTrace())
+	router.DELETE(PREFIX+"/configs/:name/trace", rs.DeleteConfigTrace())
+	router.GET(PREFIX+"/configs/:name/ratelimit", rs.GetConfigRateLimit())
+	router.PUT(PREFIX+"/configs/:name/ratelimit", rs.PutConfigRateLimit())
+	router.GET(PREFIX+"/configs/:name/delivery", rs.GetConfigDelivery())
+	router.GET(PREFIX+"/configs/:name/checkpoint", rs.GetConfigCheckpoint())
+	router.PUT(PREFIX+"/configs/:name/checkpoint", rs.PutConfigCheckpoint())
 	router.PUT(PREFIX+"/configs/:name", rs.PutConfig())
 	router.DELETE(PREFIX+"/configs/:name", rs.DeleteConfig())
 
 	// runners API
 	router.GET(PREFIX+"/runners", rs.GetRunners())
+	router.GET(PREFIX+"/errors/:name", rs.GetRunnerErrors())
+	router.GET(PREFIX+"/tail/:name", rs.GetTail())
+	router.POST(PREFIX+"/runner/check", rs.PostRunnerCheck())
+	router.GET(PREFIX+"/history", rs.GetStatsHistory())
+	router.GET(PREFIX+"/history/:name", rs.GetRunnerStatsHistory())
+	router.POST(PREFIX+"/flush", rs.PostFlush())
+	router.GET(PREFIX+"/alerts", rs.GetAlerts())
+
+	// audit API
+	router.GET(PREFIX+"/audit", rs.GetAuditRecords())
+
+	// export/import API
+	router.GET(PREFIX+"/export", rs.GetExport())
+	router.POST(PREFIX+"/import", rs.PostImport())
+
+	// templates API
+	router.GET(PREFIX+"/templates", rs.GetTemplates())
+	router.GET(PREFIX+"/templates/:name", rs.GetTemplate())
+	router.POST(PREFIX+"/templates/:name", rs.PostTemplate())
+	router.PUT(PREFIX+"/templates/:name", rs.PutTemplate())
+	router.DELETE(PREFIX+"/templates/:name", rs.DeleteTemplate())
+	router.GET(PREFIX+"/templates/:name/instances", rs.GetTemplateInstances())
+	router.POST(PREFIX+"/templates/:name/instances/:runner", rs.PostTemplateInstance())
 
 	//reader API
 	router.GET(PREFIX+"/reader/usages", rs.GetReaderUsages())
@@ -76,6 +121,7 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	router.GET(PREFIX+"/reader/options", rs.GetReaderKeyOptions())
 	router.POST(PREFIX+"/reader/read", rs.PostRead())
 	router.POST(PREFIX+"/reader/check", rs.PostReaderCheck())
+	router.GET(PREFIX+"/reader/files/:name", rs.GetReaderFiles())
 
 	//parser API
 	router.GET(PREFIX+"/parser/usages", rs.GetParserUsages())
@@ -84,6 +130,8 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	router.POST(PREFIX+"/parser/parse", rs.PostParse())
 	router.GET(PREFIX+"/parser/samplelogs", rs.GetParserSampleLogs())
 	router.POST(PREFIX+"/parser/check", rs.PostParserCheck())
+	router.POST(PREFIX+"/parser/grok/test", rs.PostGrokTest())
+	router.POST(PREFIX+"/parser/test", rs.PostParserTest())
 
 	//transformer API
 	router.GET(PREFIX+"/transformer/usages", rs.GetTransformerUsages())
@@ -100,6 +148,10 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	router.GET(PREFIX+"/sender/router/usage", rs.GetSenderRouterUsage())
 	router.GET(PREFIX+"/sender/router/option", rs.GetSenderRouterOption())
 
+	//cleaner API
+	router.GET(PREFIX+"/cleaner/options", rs.GetCleanerKeyOptions())
+	router.GET(PREFIX+"/cleaner/reports/:name", rs.GetCleanerReport())
+
 	//metric API
 	router.GET(PREFIX+"/metric/keys", rs.GetMetricKeys())
 	router.GET(PREFIX+"/metric/usages", rs.GetMetricUsages())
@@ -108,6 +160,21 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	//version
 	router.GET(PREFIX+"/version", rs.GetVersion())
 
+	// log levels API
+	router.GET(PREFIX+"/loglevels", rs.GetLogLevels())
+	router.PUT(PREFIX+"/loglevels", rs.PutLogLevels())
+
+	// 全局带宽限制
+	router.GET(PREFIX+"/ratelimit", rs.GetRateLimit())
+	router.PUT(PREFIX+"/ratelimit", rs.PutRateLimit())
+
+	// upgrade API
+	router.GET(PREFIX+"/upgrade", rs.GetUpgrade())
+	router.POST(PREFIX+"/upgrade", rs.PostUpgrade())
+
+	// debug API
+	rs.registerDebugRoutes(router)
+
 	//cluster API
 	router.GET(PREFIX+"/cluster/ping", rs.Ping())
 	router.GET(PREFIX+"/cluster/ismaster", rs.IsMaster())
@@ -126,6 +193,9 @@ func NewRestService(mgr *Manager, router *echo.Echo) *RestService {
 	router.POST(PREFIX+"/cluster/configs/:name/stop", rs.PostClusterConfigStop())
 	router.POST(PREFIX+"/cluster/configs/:name/start", rs.PostClusterConfigStart())
 	router.POST(PREFIX+"/cluster/configs/:name/reset", rs.PostClusterConfigReset())
+	router.POST(PREFIX+"/cluster/upgrade", rs.PostClusterUpgrade())
+	router.GET(PREFIX+"/cluster/rollouts", rs.GetClusterRollouts())
+	router.GET(PREFIX+"/cluster/rollouts/:id", rs.GetClusterRollout())
 
 	var (
 		port       = DEFAULT_PORT
@@ -261,6 +331,52 @@ func (rs *RestService) GetRunners() echo.HandlerFunc {
 	}
 }
 
+// get /logkit/errors/<name>
+func (rs *RestService) GetRunnerErrors() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if name == "" {
+			return RespError(c, http.StatusBadRequest, ErrRunnerErrors, "runner name is empty")
+		}
+		records, err := rs.mgr.RunnerErrors(name)
+		if err != nil {
+			return RespError(c, http.StatusNotFound, ErrRunnerErrors, err.Error())
+		}
+		return RespSuccess(c, records)
+	}
+}
+
+// get /logkit/audit?runner=<name>&action=<action>&user=<user>&since=<RFC3339>&until=<RFC3339>&limit=<n>
+func (rs *RestService) GetAuditRecords() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		q := AuditQuery{
+			Runner: c.QueryParam("runner"),
+			Action: c.QueryParam("action"),
+			User:   c.QueryParam("user"),
+		}
+		if since := c.QueryParam("since"); since != "" {
+			if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				return RespError(c, http.StatusBadRequest, ErrAudit, "invalid since: "+err.Error())
+			}
+		}
+		if until := c.QueryParam("until"); until != "" {
+			if q.Until, err = time.Parse(time.RFC3339, until); err != nil {
+				return RespError(c, http.StatusBadRequest, ErrAudit, "invalid until: "+err.Error())
+			}
+		}
+		if limit := c.QueryParam("limit"); limit != "" {
+			if q.Limit, err = strconv.Atoi(limit); err != nil {
+				return RespError(c, http.StatusBadRequest, ErrAudit, "invalid limit: "+err.Error())
+			}
+		}
+		records, err := rs.mgr.AuditRecords(q)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrAudit, err.Error())
+		}
+		return RespSuccess(c, records)
+	}
+}
+
 // get /logkit/configs
 func (rs *RestService) GetConfigs() echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -320,7 +436,10 @@ func (rs *RestService) PostConfig() echo.HandlerFunc {
 		}
 		nconf.IsInWebFolder = true
 		nconf.ParserConf = parser.ConvertWebParserConfig(nconf.ParserConf)
-		if err = rs.mgr.AddRunner(name, nconf); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.AddRunner(name, nconf)
+		rs.audit(c, AuditActionCreate, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerAdd, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -341,7 +460,10 @@ func (rs *RestService) PutConfig() echo.HandlerFunc {
 		}
 		nconf.IsInWebFolder = true
 		nconf.ParserConf = parser.ConvertWebParserConfig(nconf.ParserConf)
-		if err = rs.mgr.UpdateRunner(name, nconf); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.UpdateRunner(name, nconf)
+		rs.audit(c, AuditActionUpdate, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerUpdate, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -356,7 +478,10 @@ func (rs *RestService) PostConfigReset() echo.HandlerFunc {
 			errMsg := "config name is empty"
 			return RespError(c, http.StatusBadRequest, ErrRunnerReset, errMsg)
 		}
-		if err = rs.mgr.ResetRunner(name); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.ResetRunner(name)
+		rs.audit(c, AuditActionReset, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerReset, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -371,7 +496,10 @@ func (rs *RestService) PostConfigStart() echo.HandlerFunc {
 			errMsg := "config name is empty"
 			return RespError(c, http.StatusBadRequest, ErrRunnerStart, errMsg)
 		}
-		if err = rs.mgr.StartRunner(name); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.StartRunner(name)
+		rs.audit(c, AuditActionStart, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerStart, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -386,7 +514,10 @@ func (rs *RestService) PostConfigStop() echo.HandlerFunc {
 			errMsg := "config name is empty"
 			return RespError(c, http.StatusBadRequest, ErrRunnerStop, errMsg)
 		}
-		if err = rs.mgr.StopRunner(name); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.StopRunner(name)
+		rs.audit(c, AuditActionStop, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerStop, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -401,7 +532,10 @@ func (rs *RestService) DeleteConfig() echo.HandlerFunc {
 			errMsg := "config name is empty"
 			return RespError(c, http.StatusBadRequest, ErrRunnerDelete, errMsg)
 		}
-		if err = rs.mgr.DeleteRunner(name); err != nil {
+		before := rs.mgr.auditSnapshot(name)
+		err = rs.mgr.DeleteRunner(name)
+		rs.audit(c, AuditActionDelete, name, before, err)
+		if err != nil {
 			return RespError(c, http.StatusBadRequest, ErrRunnerDelete, err.Error())
 		}
 		return RespSuccess(c, nil)
@@ -425,15 +559,69 @@ func (rs *RestService) GetVersion() echo.HandlerFunc {
 	}
 }
 
+// get /logkit/loglevels
+func (rs *RestService) GetLogLevels() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, logger.GetLevels())
+	}
+}
+
+// put /logkit/loglevels
+func (rs *RestService) PutLogLevels() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var levels logger.Levels
+		if err := c.Bind(&levels); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrLogLevel, err.Error())
+		}
+		if err := logger.SetLevels(levels); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrLogLevel, err.Error())
+		}
+		log.Infof("log levels are changed to %+v", logger.GetLevels())
+		return RespSuccess(c, nil)
+	}
+}
+
 func (rs *RestService) Register() error {
 	if rs.cluster.Enable {
-		return rs.cluster.RunRegisterLoop()
+		if rs.cluster.IsMaster {
+			rs.cluster.RunLivenessLoop()
+		}
+		return rs.cluster.RunRegisterLoop(rs.registerReq)
 	}
 	return nil
 }
 
+// registerReq 生成 slave 向 master 发送的心跳内容
+func (rs *RestService) registerReq() RegisterReq {
+	rs.cluster.mutex.RLock()
+	req := RegisterReq{
+		Url:    rs.cluster.Address,
+		Tag:    rs.cluster.Tag,
+		Labels: rs.cluster.Labels,
+	}
+	rs.cluster.mutex.RUnlock()
+	req.Hostname, _ = os.Hostname()
+	req.Version = rs.mgr.Version
+	if status := rs.upgrade.getStatus(); status.State != UpgradeIdle {
+		req.Upgrade = &status
+	}
+	for _, status := range rs.mgr.Status() {
+		req.Runners.Total++
+		if status.RunningStatus == RunnerStopped {
+			req.Runners.Stopped++
+		} else {
+			req.Runners.Running++
+		}
+		if status.Error != "" {
+			req.Runners.Error++
+		}
+	}
+	return req
+}
+
 // Stop will stop RestService
 func (rs *RestService) Stop() {
+	rs.cluster.Stop()
 	if rs.l != nil {
 		if err := rs.l.Close(); err != nil {
 			log.Error("close reset service listener err: ", err)
@@ -33,6 +33,9 @@ import (
 type CleanInfo struct {
 	enable bool
 	logdir string
+	name   string
+	// done 不为空表示 runner 没有开启 cleaner，只是读取该目录，通过 reader 的 done 文件确认文件已经读完
+	done func(path string) bool
 }
 
 const (
@@ -65,10 +68,16 @@ type StatusPersistable interface {
 	StatusRestore()
 }
 
+// GracefulStoppable 表示 runner 退出时可以在超时时间内把已读取的数据尽量发送完毕
+type GracefulStoppable interface {
+	GracefulStop(timeout time.Duration, drainDisk bool)
+}
+
 type LogExportRunner struct {
 	RunnerInfo
 
 	stopped      int32
+	graceful     int32
 	exitChan     chan struct{}
 	reader       reader.Reader
 	cleaner      *cleaner.Cleaner
@@ -76,6 +85,10 @@ type LogExportRunner struct {
 	senders      []sender.Sender
 	router       *router.Router
 	transformers []transforms.Transformer
+	// dataParser 不为 nil 时 reader 是 StructuredReader，直接读取结构化数据交给 dataParser 处理
+	dataParser parser.DataParser
+	// bytesLine 为 true 时 reader 是 BytesReader，按行读入复用的 buffer 后通过 parser.ParseBytes 解析
+	bytesLine bool
 
 	rs      *RunnerStatus
 	lastRs  *RunnerStatus
@@ -86,9 +99,23 @@ type LogExportRunner struct {
 	batchLen  int64
 	batchSize int64
 	lastSend  time.Time
+
+	quota    *quotaController
+	quotaErr string
+	delivery *deliveryAuditor // 没有打开投递审计时为 nil
+
+	errHistory *errorHistory
+	tap        *dataTap
+	senderErrs map[string]string // 每个 sender 最近一次发送的错误, 发送成功后清除
+
+	flushing  int32              // 有 flush 请求时为 1, 当前批次立即结束
+	flushChan chan chan struct{} // Run 处理完 flush 请求后关闭传入的 chan
+
+	traceUntil atomic.Value // time.Time, 跟踪结束的时间, 为零值时没有打开跟踪
 }
 
 const defaultSendIntervalSeconds = 60
+const defaultStopTimeout = 10 * time.Second
 const qiniulogHeadPatthern = "[1-9]\\d{3}/[0-1]\\d/[0-3]\\d [0-2]\\d:[0-6]\\d:[0-6]\\d(\\.\\d{6})?"
 
 // NewRunner 创建Runner
@@ -144,7 +171,12 @@ func NewLogExportRunnerWithService(info RunnerInfo, reader reader.Reader, cleane
 			Name:           info.RunnerName,
 			RunningStatus:  RunnerRunning,
 		},
-		rsMutex: new(sync.RWMutex),
+		rsMutex:    new(sync.RWMutex),
+		errHistory: newErrorHistory(DefaultErrorHistorySize),
+		tap:        newDataTap(),
+		senderErrs: make(map[string]string),
+		flushChan:  make(chan chan struct{}),
+		quota:      newQuotaController(nil, nil),
 	}
 	if reader == nil {
 		err = errors.New("reader can not be nil")
@@ -167,6 +199,8 @@ func NewLogExportRunnerWithService(info RunnerInfo, reader reader.Reader, cleane
 	runner.parser = parser
 
 	runner.transformers = transformers
+	runner.dataParser = structuredDataParser(reader, parser, transformers)
+	runner.bytesLine = canReadLineBytes(reader, parser, transformers)
 
 	if len(senders) < 1 {
 		err = errors.New("senders can not be nil")
@@ -213,12 +247,7 @@ func NewLogExportRunner(rc RunnerConfig, cleanChan chan<- cleaner.CleanSignal, r
 	)
 	mode := rc.ReaderConfig["mode"]
 	if mode == reader.ModeCloudTrail {
-		syncDir := rc.ReaderConfig[reader.KeySyncDirectory]
-		if syncDir == "" {
-			bucket, prefix, region, ak, sk, _ := cloudtrail.GetS3UserInfo(rc.ReaderConfig)
-			syncDir = cloudtrail.GetDefaultSyncDir(bucket, prefix, region, ak, sk, rc.RunnerName)
-		}
-		rc.ReaderConfig[reader.KeyLogPath] = syncDir
+		rc.ReaderConfig[reader.KeyLogPath] = cloudTrailSyncDir(rc)
 		if len(rc.CleanerConfig) == 0 {
 			rc.CleanerConfig = conf.MapConf{
 				"delete_enable":       "true",
@@ -241,7 +270,15 @@ func NewLogExportRunner(rc RunnerConfig, cleanChan chan<- cleaner.CleanSignal, r
 				rd.Close()
 			}
 		}()
-		cl, err = cleaner.NewCleaner(rc.CleanerConfig, meta, cleanChan, meta.LogPath())
+		cleanerConfig := rc.CleanerConfig
+		if _, ok := cleanerConfig[cleaner.KeyCleanerName]; !ok {
+			cleanerConfig = make(conf.MapConf, len(rc.CleanerConfig)+1)
+			for k, v := range rc.CleanerConfig {
+				cleanerConfig[k] = v
+			}
+			cleanerConfig[cleaner.KeyCleanerName] = rc.RunnerName
+		}
+		cl, err = cleaner.NewCleaner(cleanerConfig, meta, cleanChan, meta.LogPath())
 		if err != nil {
 			return nil, err
 		}
@@ -255,6 +292,10 @@ func NewLogExportRunner(rc RunnerConfig, cleanChan chan<- cleaner.CleanSignal, r
 	if err != nil {
 		return nil, err
 	}
+	parser, err = pr.NewParserChain(parser, rc.ParserChain)
+	if err != nil {
+		return nil, err
+	}
 
 	transformers, err := createTransformers(rc)
 	if err != nil {
@@ -279,7 +320,16 @@ func NewLogExportRunner(rc RunnerConfig, cleanChan chan<- cleaner.CleanSignal, r
 	if err != nil {
 		return nil, fmt.Errorf("runner %v add sender router error, %v", rc.RunnerName, err)
 	}
-	return NewLogExportRunnerWithService(runnerInfo, rd, cl, parser, transformers, senders, router, meta)
+	quota := newQuotaController(rc.Quota, ftSaveDirs(rc, meta.FtSaveLogPath()))
+	runnerInfo.MaxBatchSize = quota.batchSize(runnerInfo.MaxBatchSize)
+	runner, err = NewLogExportRunnerWithService(runnerInfo, rd, cl, parser, transformers, senders, router, meta)
+	if err != nil {
+		quota.Close()
+		return nil, err
+	}
+	runner.quota = quota
+	runner.delivery = newDeliveryAuditor(rc.DeliveryAudit, rc.RunnerName, meta.Dir)
+	return runner, nil
 }
 
 func createTransformers(rc RunnerConfig) ([]transforms.Transformer, error) {
@@ -331,11 +381,15 @@ func (r *LogExportRunner) trySend(s sender.Sender, datas []Data, times int) bool
 	info := r.rs.SenderStats[s.Name()]
 	r.rsMutex.Unlock()
 	cnt := 1
+	total := int64(len(datas))
+	var lastErr error
+	var lastStats *StatsError
 	for {
 		// 至少尝试一次。如果任务已经停止，那么只尝试一次
 		if cnt > 1 && atomic.LoadInt32(&r.stopped) > 0 {
 			return false
 		}
+		sendStart := time.Now()
 		err := s.Send(datas)
 		se, ok := err.(*StatsError)
 		if ok {
@@ -359,8 +413,12 @@ func (r *LogExportRunner) trySend(s sender.Sender, datas []Data, times int) bool
 		} else {
 			info.Success += int64(len(datas))
 		}
+		r.traceSend(s.Name(), datas, cnt, err, time.Since(sendStart))
+		lastErr = err
+		lastStats = se
 		if err != nil {
 			info.LastError = err.Error()
+			r.errHistory.Add(ErrorTypeSender, s.Name(), err)
 			//FaultTolerant Sender 正常的错误会在backupqueue里面记录，自己重试，此处无需重试
 			if se.Ft && se.FtNotRetry {
 				break
@@ -385,12 +443,36 @@ func (r *LogExportRunner) trySend(s sender.Sender, datas []Data, times int) bool
 		}
 		break
 	}
+	r.countSent(total, datas, lastErr, lastStats)
 	r.rsMutex.Lock()
 	r.rs.SenderStats[s.Name()] = info
+	if lastErr != nil {
+		r.senderErrs[s.Name()] = lastErr.Error()
+	} else {
+		delete(r.senderErrs, s.Name())
+	}
 	r.rsMutex.Unlock()
 	return true
 }
 
+// countSent 统计一次 trySend 最终发送成功和失败的条数，写入 fault tolerant 磁盘队列的数据由 sender 自己重试，算作成功
+func (r *LogExportRunner) countSent(total int64, remain []Data, err error, se *StatsError) {
+	if r.delivery == nil {
+		return
+	}
+	var failed int64
+	if err != nil && (se == nil || !se.Ft) {
+		failed = int64(len(remain))
+		if se != nil && se.Errors < failed {
+			failed = se.Errors
+		}
+	}
+	r.delivery.count(func(c *DeliveryCounts) {
+		c.Sent += total - failed
+		c.SendFailed += failed
+	})
+}
+
 func getSampleContent(line string, maxBatchSize int) string {
 	if len(line) <= maxBatchSize {
 		return line
@@ -401,7 +483,42 @@ func getSampleContent(line string, maxBatchSize int) string {
 	return line[0:1024]
 }
 
-func (r *LogExportRunner) readDatas(dr reader.DataReader, dataSourceTag string) []Data {
+// structuredDataParser 在 reader 和 parser 都支持时返回可以直接处理结构化数据的 parser，
+// 有 parser 之前的 transformer 时它们需要原始字符串，仍然按行读取
+func structuredDataParser(rd reader.Reader, ps parser.Parser, transformers []transforms.Transformer) parser.DataParser {
+	if _, ok := rd.(reader.StructuredReader); !ok {
+		return nil
+	}
+	dp, ok := ps.(parser.DataParser)
+	if !ok {
+		return nil
+	}
+	for _, t := range transformers {
+		if t.Stage() == transforms.StageBeforeParser {
+			return nil
+		}
+	}
+	return dp
+}
+
+// canReadLineBytes 判断是否可以按 []byte 读取并解析，parser 之前的 transformer 以及 Flushable 的 parser
+// 需要字符串以及 flush 信号，仍然走 readLines
+func canReadLineBytes(rd reader.Reader, ps parser.Parser, transformers []transforms.Transformer) bool {
+	if _, ok := rd.(reader.BytesReader); !ok {
+		return false
+	}
+	if _, ok := ps.(parser.Flushable); ok {
+		return false
+	}
+	for _, t := range transformers {
+		if t.Stage() == transforms.StageBeforeParser {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *LogExportRunner) readDatas(readData func() (Data, int64, error), dataSourceTag string) []Data {
 	var (
 		datas []Data
 		err   error
@@ -409,12 +526,13 @@ func (r *LogExportRunner) readDatas(dr reader.DataReader, dataSourceTag string)
 		data  Data
 	)
 	for !r.batchFullOrTimeout() {
-		data, bytes, err = dr.ReadData()
+		data, bytes, err = readData()
 		if err != nil {
 			log.Errorf("Runner[%v] data reader %s - error: %v, sleep 1 second...", r.Name(), r.reader.Name(), err)
 			time.Sleep(time.Second)
 			break
 		}
+		r.quota.waitRead(bytes)
 		if len(data) <= 0 {
 			log.Debugf("Runner[%v] data reader %s got empty data", r.Name(), r.reader.Name())
 			continue
@@ -422,6 +540,9 @@ func (r *LogExportRunner) readDatas(dr reader.DataReader, dataSourceTag string)
 		if len(dataSourceTag) > 0 {
 			data[dataSourceTag] = r.reader.Source()
 		}
+		if idKey := r.delivery.key(); idKey != "" {
+			data[idKey] = r.delivery.nextID(r.reader.Source())
+		}
 		datas = append(datas, data)
 		r.batchLen++
 		r.batchSize += bytes
@@ -429,6 +550,7 @@ func (r *LogExportRunner) readDatas(dr reader.DataReader, dataSourceTag string)
 	r.rsMutex.Lock()
 	if err != nil {
 		r.rs.ReaderStats.LastError = err.Error()
+		r.errHistory.Add(ErrorTypeReader, r.reader.Name(), err)
 	} else {
 		r.rs.ReaderStats.LastError = ""
 	}
@@ -438,10 +560,12 @@ func (r *LogExportRunner) readDatas(dr reader.DataReader, dataSourceTag string)
 
 func (r *LogExportRunner) readLines(dataSourceTag string) []Data {
 	var (
-		err          error
-		lines, froms []string
-		line         string
+		err               error
+		lines, froms, ids []string
+		line              string
+		sourceMetas       []interface{}
 	)
+	sourceMeta := r.sourceMetaFunc()
 	for !r.batchFullOrTimeout() {
 		line, err = r.reader.ReadLine()
 		if os.IsNotExist(err) {
@@ -460,30 +584,28 @@ func (r *LogExportRunner) readLines(dataSourceTag string) []Data {
 			continue
 		}
 
+		r.quota.waitRead(int64(len(line)))
 		lines = append(lines, line)
 		if dataSourceTag != "" {
 			froms = append(froms, r.reader.Source())
 		}
+		if sourceMeta != nil {
+			sourceMetas = append(sourceMetas, sourceMeta())
+		}
+		if r.delivery != nil {
+			ids = append(ids, r.delivery.nextID(r.reader.Source()))
+		}
 
 		r.batchLen++
 		r.batchSize += int64(len(line))
 	}
-	r.rsMutex.Lock()
-	if err != nil && err != io.EOF {
-		if os.IsNotExist(err) {
-			r.rs.ReaderStats.LastError = "no more file exist to be read"
-		} else {
-			r.rs.ReaderStats.LastError = err.Error()
-		}
-	} else {
-		r.rs.ReaderStats.LastError = ""
-	}
-	r.rsMutex.Unlock()
+	r.recordReadError(err)
 
 	for i := range r.transformers {
 		if r.transformers[i].Stage() == transforms.StageBeforeParser {
 			lines, err = r.transformers[i].RawTransform(lines)
 			if err != nil {
+				r.errHistory.Add(ErrorTypeTransform, r.transformers[i].Type(), err)
 				log.Error(err)
 			}
 		}
@@ -500,8 +622,179 @@ func (r *LogExportRunner) readLines(dataSourceTag string) []Data {
 	}
 
 	// parse data
-	var numErrs int64
 	datas, err := r.parser.Parse(lines)
+	se := r.recordParseResult(err)
+	datas = addDeliveryIDs(ids, se, datas, r.delivery.key(), r.Name())
+	datas = r.addSourceMetas(datas, se, sourceMetas)
+	return r.addDataSource(datas, se, froms, dataSourceTag)
+}
+
+// readLineBytes 把一批数据读入同一个从 pool 中获取的 buffer，通过 parser.ParseBytes 解析后归还，
+// 避免 readLines 中每一行都分配一个字符串
+func (r *LogExportRunner) readLineBytes(br reader.BytesReader, dataSourceTag string) []Data {
+	var (
+		err         error
+		froms, ids  []string
+		ends        []int
+		sourceMetas []interface{}
+	)
+	sourceMeta := r.sourceMetaFunc()
+	bufp := reader.GetLineBuffer()
+	defer reader.PutLineBuffer(bufp)
+	buf := *bufp
+	for !r.batchFullOrTimeout() {
+		start := len(buf)
+		buf, err = br.ReadLineBytes(buf)
+		if os.IsNotExist(err) {
+			log.Errorf("Runner[%v] reader %s - error: %v, sleep 3 second...", r.Name(), r.reader.Name(), err)
+			time.Sleep(3 * time.Second)
+			buf = buf[:start]
+			break
+		}
+		if err != nil && err != io.EOF {
+			log.Errorf("Runner[%v] reader %s - error: %v, sleep 1 second...", r.Name(), r.reader.Name(), err)
+			time.Sleep(time.Second)
+			buf = buf[:start]
+			break
+		}
+		n := len(buf) - start
+		if n <= 0 {
+			log.Debugf("Runner[%v] reader %s no more content fetched sleep 1 second...", r.Name(), r.reader.Name())
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		r.quota.waitRead(int64(n))
+		ends = append(ends, len(buf))
+		if dataSourceTag != "" {
+			froms = append(froms, r.reader.Source())
+		}
+		if sourceMeta != nil {
+			sourceMetas = append(sourceMetas, sourceMeta())
+		}
+		if r.delivery != nil {
+			ids = append(ids, r.delivery.nextID(r.reader.Source()))
+		}
+
+		r.batchLen++
+		r.batchSize += int64(n)
+	}
+	// buffer 扩容后把新的 buffer 放回 pool
+	*bufp = buf
+	r.recordReadError(err)
+
+	if len(ends) <= 0 {
+		log.Debugf("Runner[%v] fetched 0 lines", r.Name())
+		return nil
+	}
+	lines := make([][]byte, len(ends))
+	start := 0
+	for i, end := range ends {
+		lines[i] = buf[start:end:end]
+		start = end
+	}
+
+	datas, err := parser.ParseBytes(r.parser, lines)
+	se := r.recordParseResult(err)
+	datas = addDeliveryIDs(ids, se, datas, r.delivery.key(), r.Name())
+	datas = r.addSourceMetas(datas, se, sourceMetas)
+	return r.addDataSource(datas, se, froms, dataSourceTag)
+}
+
+// recordReadError 记录一批数据读取结束时 reader 的错误
+func (r *LogExportRunner) recordReadError(err error) {
+	r.rsMutex.Lock()
+	defer r.rsMutex.Unlock()
+	if err != nil && err != io.EOF {
+		if os.IsNotExist(err) {
+			r.rs.ReaderStats.LastError = "no more file exist to be read"
+		} else {
+			r.rs.ReaderStats.LastError = err.Error()
+		}
+		r.errHistory.Add(ErrorTypeReader, r.reader.Name(), err)
+	} else {
+		r.rs.ReaderStats.LastError = ""
+	}
+}
+
+// addDataSource 把 source 加到 data 里，前提是认为 []line 变成 []data 以后是一一对应的，一旦错位就不加
+func (r *LogExportRunner) addDataSource(datas []Data, se *StatsError, froms []string, dataSourceTag string) []Data {
+	if dataSourceTag == "" {
+		return datas
+	}
+	// 只要实际解析后数据不大于 froms 就可以填上
+	if len(datas) <= len(froms) {
+		return addSourceToData(froms, se, datas, dataSourceTag, r.Name())
+	}
+	var selen int
+	if se != nil {
+		selen = len(se.DatasourceSkipIndex)
+	}
+	log.Errorf("Runner[%v] datasourcetag add error, datas(TOTAL %v), datasourceSkipIndex(TOTAL %v) not match with froms(TOTAL %v)", r.Name(), len(datas), selen, len(froms))
+	log.Debugf("Runner[%v] datasourcetag add error, datas %v datasourceSkipIndex %v froms %v", datas, se.DatasourceSkipIndex, froms)
+	return datas
+}
+
+// sourceMetaFunc 在配置了 sourcemeta_tag 时返回获取最近一次读到的数据的来源信息的函数，
+// reader 既不能返回数据在文件中的位置，也不能返回消息的元信息时返回 nil
+func (r *LogExportRunner) sourceMetaFunc() func() interface{} {
+	if r.meta == nil || r.meta.GetSourceMetaTag() == "" {
+		return nil
+	}
+	switch rd := r.reader.(type) {
+	case reader.SourceMetaReader:
+		return func() interface{} { return sourceMetaValue(rd) }
+	case reader.MessageMetaReader:
+		return func() interface{} {
+			if meta, ok := rd.MessageMeta(); ok {
+				return meta
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// sourceMetaValue 返回最近一次读到的数据的位置，位置未知时返回 nil
+func sourceMetaValue(smr reader.SourceMetaReader) interface{} {
+	sm, ok := smr.SourceMeta()
+	if !ok {
+		return nil
+	}
+	value := map[string]interface{}{
+		"path":   sm.Path,
+		"inode":  sm.Inode,
+		"offset": sm.Offset,
+	}
+	if sm.Truncated {
+		value["truncated"] = true
+	}
+	return value
+}
+
+// addSourceMetas 与 addDataSource 相同，把每一行在文件中的位置或者消息的元信息加到解析后对应的 data 中
+func (r *LogExportRunner) addSourceMetas(datas []Data, se *StatsError, sourceMetas []interface{}) []Data {
+	if len(sourceMetas) <= 0 || len(datas) > len(sourceMetas) {
+		return datas
+	}
+	return addValuesToData(sourceMetas, se, datas, r.meta.GetSourceMetaTag(), r.Name())
+}
+
+// readStructured 从 StructuredReader 直接读取结构化数据交给 dataParser 处理，
+// 省去 ReadLine 时的序列化以及 parser 中的反序列化
+func (r *LogExportRunner) readStructured(sr reader.StructuredReader, dataSourceTag string) []Data {
+	datas := r.readDatas(sr.ReadStructured, dataSourceTag)
+	if len(datas) <= 0 {
+		return nil
+	}
+	datas, err := r.dataParser.ParseData(datas)
+	r.recordParseResult(err)
+	return datas
+}
+
+// recordParseResult 记录 parser 的统计信息和错误，err 为 *StatsError 时返回它
+func (r *LogExportRunner) recordParseResult(err error) *StatsError {
+	var numErrs int64
 	se, ok := err.(*StatsError)
 	r.rsMutex.Lock()
 	if ok {
@@ -517,29 +810,16 @@ func (r *LogExportRunner) readLines(dataSourceTag string) []Data {
 	}
 	if err != nil {
 		r.rs.ParserStats.LastError = err.Error()
+		r.errHistory.Add(ErrorTypeParser, r.parser.Name(), err)
 	}
 	r.rsMutex.Unlock()
+	r.delivery.count(func(c *DeliveryCounts) { c.ParseFailed += numErrs })
 	if err != nil {
 		errMsg := fmt.Sprintf("Runner[%v] parser %s error : %v ", r.Name(), r.parser.Name(), err.Error())
 		log.Debugf(errMsg)
 		(&SchemaErr{}).Output(numErrs, errors.New(errMsg))
 	}
-
-	// 把 source 加到 data 里，前提是认为 []line 变成 []data 以后是一一对应的，一旦错位就不加
-	if dataSourceTag != "" {
-		// 只要实际解析后数据不大于 froms 就可以填上
-		if len(datas) <= len(froms) {
-			datas = addSourceToData(froms, se, datas, dataSourceTag, r.Name())
-		} else {
-			var selen int
-			if se != nil {
-				selen = len(se.DatasourceSkipIndex)
-			}
-			log.Errorf("Runner[%v] datasourcetag add error, datas(TOTAL %v), datasourceSkipIndex(TOTAL %v) not match with froms(TOTAL %v)", r.Name(), len(datas), selen, len(froms))
-			log.Debugf("Runner[%v] datasourcetag add error, datas %v datasourceSkipIndex %v froms %v", datas, se.DatasourceSkipIndex, froms)
-		}
-	}
-	return datas
+	return se
 }
 
 func (r *LogExportRunner) Run() {
@@ -561,16 +841,34 @@ func (r *LogExportRunner) Run() {
 		if atomic.LoadInt32(&r.stopped) > 0 {
 			log.Debugf("Runner[%v] exited from run", r.Name())
 			if atomic.LoadInt32(&r.stopped) < 2 {
+				if atomic.LoadInt32(&r.graceful) > 0 {
+					r.flushParser()
+				}
 				r.exitChan <- struct{}{}
 			}
 			return
 		}
 
+		select {
+		case done := <-r.flushChan:
+			r.handleFlush(done)
+		default:
+		}
+
+		if !r.checkQuota() {
+			time.Sleep(time.Second)
+			continue
+		}
+
 		// read data
-		var err error
 		var datas []Data
+		readStart := time.Now()
 		if dr, ok := r.reader.(reader.DataReader); ok {
-			datas = r.readDatas(dr, r.meta.GetDataSourceTag())
+			datas = r.readDatas(dr.ReadData, r.meta.GetDataSourceTag())
+		} else if sr, ok := r.reader.(reader.StructuredReader); ok && r.dataParser != nil {
+			datas = r.readStructured(sr, r.meta.GetDataSourceTag())
+		} else if br, ok := r.reader.(reader.BytesReader); ok && r.bytesLine {
+			datas = r.readLineBytes(br, r.meta.GetDataSourceTag())
 		} else {
 			datas = r.readLines(r.meta.GetDataSourceTag())
 		}
@@ -580,7 +878,14 @@ func (r *LogExportRunner) Run() {
 		r.rs.ReadDataCount += r.batchLen
 		r.rs.ReadDataSize += r.batchSize
 		r.rsMutex.Unlock()
-
+		batchLen := r.batchLen
+		r.delivery.count(func(c *DeliveryCounts) {
+			c.Read += batchLen
+			c.Parsed += int64(len(datas))
+		})
+
+		batchSize := r.batchSize
+		r.traceRead(datas, batchSize, time.Since(readStart))
 		r.batchLen = 0
 		r.batchSize = 0
 		r.lastSend = time.Now()
@@ -590,59 +895,98 @@ func (r *LogExportRunner) Run() {
 			log.Debugf("Runner[%v] received parsed data length = 0", r.Name())
 			continue
 		}
+		r.sendDatas(datas, batchSize)
+	}
+}
 
-		tags := r.meta.GetTags()
-		tags = MergeEnvTags(r.EnvTag, tags)
-		tags = MergeExtraInfoTags(r.meta, tags)
-		if len(tags) > 0 {
-			datas = addTagsToData(tags, datas, r.Name())
+// sendDatas 给数据加上标签并经过 transform 后发送，全部发送成功后同步 reader 的 meta
+func (r *LogExportRunner) sendDatas(datas []Data, batchSize int64) {
+	var err error
+	tags := r.meta.GetTags()
+	tags = MergeEnvTags(r.EnvTag, tags)
+	tags = MergeExtraInfoTags(r.meta, tags)
+	if len(tags) > 0 {
+		datas = addTagsToData(tags, datas, r.Name())
+	}
+	beforeTransform := int64(len(datas))
+	for i := range r.transformers {
+		if r.transformers[i].Stage() != transforms.StageAfterParser {
+			continue
 		}
-		for i := range r.transformers {
-			if r.transformers[i].Stage() != transforms.StageAfterParser {
-				continue
-			}
-			datas, err = r.transformers[i].Transform(datas)
-			tp := r.transformers[i].Type()
-			r.rsMutex.Lock()
-			tstats, ok := r.rs.TransformStats[tp]
-			if !ok {
-				tstats = StatsInfo{}
-			}
-			se, ok := err.(*StatsError)
-			if ok {
-				err = se.ErrorDetail
-				tstats.Errors += se.Errors
-				tstats.Success += se.Success
-			} else if err != nil {
-				tstats.Errors++
-			} else {
-				tstats.Success++
-			}
-			if err != nil {
-				tstats.LastError = err.Error()
-			}
-			r.rs.TransformStats[tp] = tstats
-			r.rsMutex.Unlock()
-			if err != nil {
-				log.Error(err)
-			}
+		datas, err = r.transformers[i].Transform(datas)
+		tp := r.transformers[i].Type()
+		r.rsMutex.Lock()
+		tstats, ok := r.rs.TransformStats[tp]
+		if !ok {
+			tstats = StatsInfo{}
 		}
-		success := true
-		senderCnt := len(r.senders)
-		log.Debugf("Runner[%v] reader %s start to send at: %v", r.Name(), r.reader.Name(), time.Now().Format(time.RFC3339))
-		senderDataList := classifySenderData(datas, r.router, senderCnt)
-		for index, s := range r.senders {
-			if !r.trySend(s, senderDataList[index], r.MaxBatchTryTimes) {
-				success = false
-				log.Errorf("Runner[%v] failed to send data finally", r.Name())
-				break
-			}
+		se, ok := err.(*StatsError)
+		if ok {
+			err = se.ErrorDetail
+			tstats.Errors += se.Errors
+			tstats.Success += se.Success
+		} else if err != nil {
+			tstats.Errors++
+		} else {
+			tstats.Success++
+		}
+		if err != nil {
+			tstats.LastError = err.Error()
+			r.errHistory.Add(ErrorTypeTransform, tp, err)
 		}
-		if success {
-			r.reader.SyncMeta()
+		r.rs.TransformStats[tp] = tstats
+		r.rsMutex.Unlock()
+		if err != nil {
+			log.Error(err)
 		}
-		log.Debugf("Runner[%v] send %s finish to send at: %v", r.Name(), r.reader.Name(), time.Now().Format(time.RFC3339))
 	}
+	r.tap.publish(datas)
+	r.quota.waitSend(batchSize)
+	success := true
+	senderCnt := len(r.senders)
+	log.Debugf("Runner[%v] reader %s start to send at: %v", r.Name(), r.reader.Name(), time.Now().Format(time.RFC3339))
+	senderDataList := classifySenderData(datas, r.router, senderCnt)
+	var routed int64
+	for _, senderData := range senderDataList {
+		routed += int64(len(senderData))
+	}
+	transformed := int64(len(datas))
+	r.delivery.count(func(c *DeliveryCounts) {
+		c.Transformed += transformed
+		if transformed < beforeTransform {
+			c.TransformDropped += beforeTransform - transformed
+		}
+		c.Routed += routed
+	})
+	for index, s := range r.senders {
+		if !r.trySend(s, senderDataList[index], r.MaxBatchTryTimes) {
+			success = false
+			log.Errorf("Runner[%v] failed to send data finally", r.Name())
+			break
+		}
+	}
+	if success {
+		r.reader.SyncMeta()
+		r.delivery.save()
+	}
+	log.Debugf("Runner[%v] send %s finish to send at: %v", r.Name(), r.reader.Name(), time.Now().Format(time.RFC3339))
+}
+
+// flushParser 在优雅退出时把 parser 中缓存的数据解析并发送出去
+func (r *LogExportRunner) flushParser() {
+	if _, ok := r.parser.(parser.Flushable); !ok {
+		return
+	}
+	datas, err := r.parser.Parse([]string{parser.PandoraParseFlushSignal})
+	if err != nil {
+		log.Errorf("Runner[%v] parser %s flush error: %v", r.Name(), r.parser.Name(), err)
+	}
+	if len(datas) <= 0 {
+		return
+	}
+	log.Infof("Runner[%v] flushed %v datas from parser before exit", r.Name(), len(datas))
+	r.delivery.count(func(c *DeliveryCounts) { c.Parsed += int64(len(datas)) })
+	r.sendDatas(datas, 0)
 }
 
 func classifySenderData(datas []Data, router *router.Router, senderCnt int) [][]Data {
@@ -667,9 +1011,18 @@ func classifySenderData(datas []Data, router *router.Router, senderCnt int) [][]
 }
 
 func addSourceToData(sourceFroms []string, se *StatsError, datas []Data, datasourceTagName, runnerName string) []Data {
-	j := 0
-	eql := len(sourceFroms) == len(datas)
+	values := make([]interface{}, len(sourceFroms))
 	for i, v := range sourceFroms {
+		values[i] = v
+	}
+	return addValuesToData(values, se, datas, datasourceTagName, runnerName)
+}
+
+// addValuesToData 把 values 中每一行对应的值加到解析后的 data 中，跳过解析失败的行，值为 nil 时不添加
+func addValuesToData(values []interface{}, se *StatsError, datas []Data, datasourceTagName, runnerName string) []Data {
+	j := 0
+	eql := len(values) == len(datas)
+	for i, v := range values {
 		if eql {
 			j = i
 		} else {
@@ -681,6 +1034,10 @@ func addSourceToData(sourceFroms []string, se *StatsError, datas []Data, datasou
 			continue
 		}
 
+		if v == nil {
+			j++
+			continue
+		}
 		if dt, ok := datas[j][datasourceTagName]; ok {
 			log.Debugf("Runner[%v] datasource tag already has data %v, ignore %v", runnerName, dt, v)
 		} else {
@@ -709,6 +1066,20 @@ func addTagsToData(tags map[string]interface{}, datas []Data, runnername string)
 // 先停Reader，不再读取，然后停Run函数，让读取的都转到发送，最后停Sender结束整个过程。
 // Parser 无状态，无需stop。
 func (r *LogExportRunner) Stop() {
+	r.stop(defaultStopTimeout, false, false)
+}
+
+// GracefulStop 优雅退出，在 timeout 内等待已读取的数据经过 parser 和 transform 后发送完毕，
+// 并等待 sender 内存队列中的数据发送完毕，drainDisk 为 true 时还会等待磁盘队列
+func (r *LogExportRunner) GracefulStop(timeout time.Duration, drainDisk bool) {
+	r.stop(timeout, true, drainDisk)
+}
+
+func (r *LogExportRunner) stop(timeout time.Duration, graceful, drainDisk bool) {
+	if graceful {
+		atomic.StoreInt32(&r.graceful, 1)
+	}
+	deadline := time.Now().Add(timeout)
 	atomic.AddInt32(&r.stopped, 1)
 
 	log.Infof("Runner[%v] wait for reader %v stopped", r.Name(), r.reader.Name())
@@ -720,7 +1091,7 @@ func (r *LogExportRunner) Stop() {
 	}
 
 	log.Infof("Runner[%v] waiting for Run() stopped signal", r.Name())
-	timer := time.NewTimer(time.Second * 10)
+	timer := time.NewTimer(timeout)
 	select {
 	case <-r.exitChan:
 		log.Warnf("runner %v has been stopped", r.Name())
@@ -728,6 +1099,23 @@ func (r *LogExportRunner) Stop() {
 		log.Errorf("runner %v exited timeout, start to force stop", r.Name())
 		atomic.AddInt32(&r.stopped, 1)
 	}
+	timer.Stop()
+
+	if graceful {
+		for _, s := range r.senders {
+			ds, ok := s.(sender.Drainable)
+			if !ok {
+				continue
+			}
+			remain := deadline.Sub(time.Now())
+			if remain < 0 {
+				remain = 0
+			}
+			if err := ds.Drain(remain, drainDisk); err != nil {
+				log.Errorf("Runner[%v] %v", r.Name(), err)
+			}
+		}
+	}
 
 	log.Infof("Runner[%v] wait for sender %v stopped", r.Name(), r.reader.Name())
 	for _, s := range r.senders {
@@ -742,6 +1130,31 @@ func (r *LogExportRunner) Stop() {
 	if r.cleaner != nil {
 		r.cleaner.Close()
 	}
+	r.quota.Close()
+}
+
+// ErrorHistory 返回 runner 最近的错误记录, 最近发生的在前
+func (r *LogExportRunner) ErrorHistory() []ErrorRecord {
+	return r.errHistory.List()
+}
+
+// checkQuota 检查 runner 是否超过了资源配额，超过配额时暂停读取，返回 false
+func (r *LogExportRunner) checkQuota() bool {
+	err := r.quota.checkDisk(time.Now())
+	r.rsMutex.Lock()
+	defer r.rsMutex.Unlock()
+	if err != nil {
+		if r.quotaErr == "" {
+			log.Warnf("Runner[%v] %v, pause reading until it is released", r.Name(), err)
+		}
+		r.quotaErr = err.Error()
+		return false
+	}
+	if r.quotaErr != "" {
+		log.Infof("Runner[%v] quota is released, continue reading", r.Name())
+		r.quotaErr = ""
+	}
+	return true
 }
 
 func (r *LogExportRunner) Name() string {
@@ -773,12 +1186,53 @@ func (r *LogExportRunner) Reset() (err error) {
 }
 
 func (r *LogExportRunner) Cleaner() CleanInfo {
-	if r.cleaner == nil {
+	if r.cleaner != nil {
+		return CleanInfo{
+			enable: true,
+			logdir: r.cleaner.LogDir(),
+			name:   r.cleaner.Name(),
+		}
+	}
+	// 没有开启 cleaner 的 runner 也要登记，避免其他 runner 的 cleaner 在它读完之前删除文件
+	if r.meta == nil || !cleaner.SupportMode(r.meta.GetMode()) {
 		return CleanInfo{enable: false}
 	}
+	logdir := r.meta.LogPath()
+	if r.meta.GetMode() != reader.ModeTailx {
+		realPath, _, err := GetRealPath(logdir)
+		if err != nil {
+			return CleanInfo{enable: false}
+		}
+		logdir = realPath
+	}
 	return CleanInfo{
 		enable: true,
-		logdir: r.cleaner.LogDir(),
+		logdir: logdir,
+		name:   r.Name(),
+		done:   readerDone(r.meta),
+	}
+}
+
+// readerDone 返回的函数检查文件是否已经记录在 reader 的 done 文件中
+func readerDone(meta *reader.Meta) func(path string) bool {
+	return func(path string) bool {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return false
+		}
+		doneFiles, err := meta.GetDoneFiles()
+		if err != nil {
+			log.Errorf("Runner[%v] get done files error %v", meta.RunnerName, err)
+			return false
+		}
+		for _, f := range doneFiles {
+			for _, logf := range GetLogFiles(f.Path) {
+				if os.SameFile(logf.Info, fi) {
+					return true
+				}
+			}
+		}
+		return false
 	}
 }
 
@@ -803,6 +1257,11 @@ func (r *LogExportRunner) batchFullOrTimeout() bool {
 		log.Warnf("Runner[%v] meet the stopped signal", r.RunnerName)
 		return true
 	}
+	// 收到 flush 请求
+	if atomic.LoadInt32(&r.flushing) > 0 {
+		log.Debugf("Runner[%v] meet the flush signal", r.RunnerName)
+		return true
+	}
 	return false
 }
 
@@ -908,6 +1367,10 @@ func (r *LogExportRunner) getRefreshStatus(elaspedtime float64) RunnerStatus {
 		r.rs.SenderStats[k] = v
 	}
 	r.rs.RunningStatus = RunnerRunning
+	if r.quotaErr != "" {
+		r.rs.RunningStatus = RunnerQuotaExceeded
+		r.rs.Error = r.quotaErr
+	}
 	*r.lastRs = r.rs.Clone()
 	return *r.lastRs
 }
@@ -938,6 +1401,16 @@ func deepCopyByJson(dst, src interface{}) {
 	return
 }
 
+// cloudTrailSyncDir 返回 cloudtrail reader 把 S3 中的文件同步到本地的目录，也就是实际读取的 logpath
+func cloudTrailSyncDir(rc RunnerConfig) string {
+	syncDir := rc.ReaderConfig[reader.KeySyncDirectory]
+	if syncDir == "" {
+		bucket, prefix, region, ak, sk, _ := cloudtrail.GetS3UserInfo(rc.ReaderConfig)
+		syncDir = cloudtrail.GetDefaultSyncDir(bucket, prefix, region, ak, sk, rc.RunnerName)
+	}
+	return syncDir
+}
+
 //Compatible 用于新老配置的兼容
 func Compatible(rc RunnerConfig) RunnerConfig {
 	//兼容qiniulog与reader多行的配置
@@ -952,7 +1425,8 @@ func Compatible(rc RunnerConfig) RunnerConfig {
 		return rc
 	}
 	pattern, _ := rc.ReaderConfig.GetStringOr(reader.KeyHeadPattern, "")
-	if parserType == parser.TypeLogv1 && pattern == "" {
+	continuePattern, _ := rc.ReaderConfig.GetStringOr(reader.KeyContinuePattern, "")
+	if parserType == parser.TypeLogv1 && pattern == "" && continuePattern == "" {
 		prefix, _ := rc.ParserConf.GetStringOr(parser.KeyQiniulogPrefix, "")
 		prefix = strings.TrimSpace(prefix)
 		var readpattern string
@@ -963,6 +1437,11 @@ func Compatible(rc RunnerConfig) RunnerConfig {
 		}
 		rc.ReaderConfig[reader.KeyHeadPattern] = readpattern
 	}
+	// 只有 csv 解析器能识别 reader 标记的表头，其他解析器读到的数据中不能带有 HeaderLineMarker
+	if markFirstLine, _ := rc.ReaderConfig.GetBoolOr(reader.KeyMarkFileFirstLine, false); markFirstLine && parserType != parser.TypeCSV {
+		log.Warnf("Runner[%v] parser %v does not support %v, disable it", rc.RunnerName, parserType, reader.KeyMarkFileFirstLine)
+		rc.ReaderConfig[reader.KeyMarkFileFirstLine] = "false"
+	}
 	return rc
 }
 
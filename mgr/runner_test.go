@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -23,7 +24,9 @@ import (
 	"github.com/qiniu/logkit/sender"
 	_ "github.com/qiniu/logkit/sender/builtin"
 	"github.com/qiniu/logkit/sender/mock"
+	"github.com/qiniu/logkit/transforms"
 	_ "github.com/qiniu/logkit/transforms/builtin"
+	"github.com/qiniu/logkit/transforms/mutate"
 	. "github.com/qiniu/logkit/utils/models"
 )
 
@@ -158,6 +161,7 @@ func Test_Run(t *testing.T) {
 	cleanInfo := CleanInfo{
 		enable: true,
 		logdir: absLogpath,
+		name:   "unknow",
 	}
 	assert.Equal(t, cleanInfo, runner.Cleaner())
 
@@ -309,6 +313,7 @@ func Test_RunForEnvTag(t *testing.T) {
 	cleanInfo := CleanInfo{
 		enable: true,
 		logdir: absLogpath,
+		name:   "unknow",
 	}
 	assert.Equal(t, cleanInfo, r.Cleaner())
 
@@ -460,6 +465,7 @@ func Test_RunForErrData(t *testing.T) {
 	cleanInfo := CleanInfo{
 		enable: true,
 		logdir: absLogpath,
+		name:   "unknow",
 	}
 	assert.Equal(t, cleanInfo, r.Cleaner())
 
@@ -552,6 +558,18 @@ func Test_Compatible(t *testing.T) {
 	}
 	rc2 = Compatible(rc2)
 	assert.Equal(t, exprc2, rc2)
+
+	// 只有 csv 解析器能识别标记的表头
+	rc3 := RunnerConfig{
+		ReaderConfig: conf.MapConf{"mode": "dir", "mark_first_line": "true"},
+		ParserConf:   conf.MapConf{"type": "json"},
+	}
+	rc3 = Compatible(rc3)
+	assert.Equal(t, "false", rc3.ReaderConfig["mark_first_line"])
+	rc3.ReaderConfig["mark_first_line"] = "true"
+	rc3.ParserConf["type"] = "csv"
+	rc3 = Compatible(rc3)
+	assert.Equal(t, "true", rc3.ReaderConfig["mark_first_line"])
 }
 
 func Test_QiniulogRun(t *testing.T) {
@@ -1234,6 +1252,29 @@ func TestAddDatasourceForErrData(t *testing.T) {
 	assert.Equal(t, exp, gots)
 }
 
+func TestAddValuesToData(t *testing.T) {
+	values := []interface{}{
+		map[string]interface{}{"path": "a.log", "inode": uint64(1), "offset": int64(0)},
+		nil,
+		map[string]interface{}{"path": "a.log", "inode": uint64(1), "offset": int64(20)},
+	}
+	datas := []Data{{"f1": "1"}, {"f2": "2"}, {"f3": "3"}}
+	exp := []Data{
+		{
+			"f1":         "1",
+			"sourcemeta": map[string]interface{}{"path": "a.log", "inode": uint64(1), "offset": int64(0)},
+		},
+		{
+			"f2": "2",
+		},
+		{
+			"f3":         "3",
+			"sourcemeta": map[string]interface{}{"path": "a.log", "inode": uint64(1), "offset": int64(20)},
+		},
+	}
+	assert.Equal(t, exp, addValuesToData(values, nil, datas, "sourcemeta", "runner1"))
+}
+
 func TestAddDatatags(t *testing.T) {
 	dir := "TestAddDatatags"
 	metaDir := filepath.Join(dir, "meta")
@@ -1849,3 +1890,121 @@ func TestTailxCleaner(t *testing.T) {
 	assert.Equal(t, 1, ret)
 
 }
+
+// structuredReader 只支持 ReadStructured, 调用 ReadLine 说明 runner 没有走结构化数据的路径
+type structuredReader struct {
+	datas     chan Data
+	readLines int32
+	synced    int32
+}
+
+func (r *structuredReader) Name() string                             { return "structured_reader" }
+func (r *structuredReader) Source() string                           { return "structured_source" }
+func (r *structuredReader) SetMode(mode string, v interface{}) error { return nil }
+func (r *structuredReader) Close() error                             { return nil }
+func (r *structuredReader) SyncMeta()                                { atomic.AddInt32(&r.synced, 1) }
+
+func (r *structuredReader) ReadLine() (string, error) {
+	atomic.AddInt32(&r.readLines, 1)
+	time.Sleep(100 * time.Millisecond)
+	return "", nil
+}
+
+func (r *structuredReader) ReadStructured() (Data, int64, error) {
+	select {
+	case data := <-r.datas:
+		return data, 10, nil
+	case <-time.After(100 * time.Millisecond):
+		return nil, 0, nil
+	}
+}
+
+func TestRunStructuredReader(t *testing.T) {
+	dir := "TestRunStructuredReader"
+	defer os.RemoveAll(dir)
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath:      dir,
+		reader.KeyMode:          reader.ModeKafka,
+		reader.KeyDataSourceTag: "datasource",
+	})
+	assert.NoError(t, err)
+	rd := &structuredReader{datas: make(chan Data, 3)}
+	rd.datas <- Data{"a": json.Number("1")}
+	rd.datas <- Data{KeyPandoraStash: `{"a":2}`}
+	rd.datas <- Data{KeyPandoraStash: "bad"}
+
+	rawParser, err := parser.NewRegistry().NewLogParser(conf.MapConf{"name": "raw", "type": parser.TypeRaw})
+	assert.NoError(t, err)
+	assert.Nil(t, structuredDataParser(rd, rawParser, nil))
+
+	ps, err := parser.NewRegistry().NewLogParser(conf.MapConf{"name": "json", "type": parser.TypeJSON, parser.KeyLabels: "l1 v1"})
+	assert.NoError(t, err)
+	s := &countSender{}
+	rinfo := RunnerInfo{RunnerName: "TestRunStructuredReader", MaxBatchLen: 3, MaxBatchInterval: 1}
+	r, err := NewLogExportRunnerWithService(rinfo, rd, nil, ps, nil, []sender.Sender{s}, nil, meta)
+	assert.NoError(t, err)
+	assert.NotNil(t, r.dataParser)
+	go r.Run()
+	defer r.Stop()
+
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&rd.readLines))
+	assert.True(t, atomic.LoadInt32(&rd.synced) > 0)
+	s.mutex.Lock()
+	assert.Equal(t, []Data{
+		{"a": json.Number("1"), "l1": "v1", "datasource": "structured_source"},
+		{"a": json.Number("2"), "l1": "v1", "datasource": "structured_source"},
+		{KeyPandoraStash: "bad", "datasource": "structured_source"},
+	}, s.datas)
+	s.mutex.Unlock()
+	r.rsMutex.RLock()
+	assert.Equal(t, int64(2), r.rs.ParserStats.Success)
+	assert.Equal(t, int64(1), r.rs.ParserStats.Errors)
+	r.rsMutex.RUnlock()
+}
+
+func TestRunLineBytes(t *testing.T) {
+	dir := "TestRunLineBytes"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("{\"a\":1}\n\n[{\"a\":2},{\"a\":3}]\nbad\n"), DefaultFilePerm))
+
+	readerConfig := conf.MapConf{
+		reader.KeyLogPath:       logPath,
+		reader.KeyMetaPath:      filepath.Join(dir, "meta"),
+		reader.KeyMode:          reader.ModeFile,
+		reader.KeyWhence:        reader.WhenceOldest,
+		reader.KeyDataSourceTag: "datasource",
+	}
+	meta, err := reader.NewMetaWithConf(readerConfig)
+	assert.NoError(t, err)
+	rd, err := reader.NewFileBufReader(readerConfig, false)
+	assert.NoError(t, err)
+	ps, err := parser.NewRegistry().NewLogParser(conf.MapConf{"name": "json", "type": parser.TypeJSON})
+	assert.NoError(t, err)
+	s := &countSender{}
+	rinfo := RunnerInfo{RunnerName: "TestRunLineBytes", MaxBatchLen: 3, MaxBatchInterval: 1}
+	r, err := NewLogExportRunnerWithService(rinfo, rd, nil, ps, nil, []sender.Sender{s}, nil, meta)
+	assert.NoError(t, err)
+	assert.True(t, r.bytesLine)
+	go r.Run()
+	defer r.Stop()
+
+	time.Sleep(3 * time.Second)
+	s.mutex.Lock()
+	assert.Equal(t, []Data{
+		{"a": json.Number("1"), "datasource": logPath},
+		{"a": json.Number("2"), "datasource": logPath},
+		{"a": json.Number("3"), "datasource": logPath},
+		{KeyPandoraStash: "bad", "datasource": logPath},
+	}, s.datas)
+	s.mutex.Unlock()
+	r.rsMutex.RLock()
+	assert.Equal(t, int64(2), r.rs.ParserStats.Success)
+	assert.Equal(t, int64(1), r.rs.ParserStats.Errors)
+	r.rsMutex.RUnlock()
+
+	// parser 之前有 transformer 时仍然按字符串读取
+	assert.False(t, canReadLineBytes(rd, ps, []transforms.Transformer{&mutate.Replacer{}}))
+}
@@ -0,0 +1,164 @@
+package mgr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qiniu/log"
+	"github.com/robfig/cron"
+)
+
+const (
+	RunnerWaiting = "waiting" // runner 配置了活动时间窗口, 当前不在窗口内
+
+	defaultScheduleCheckInterval = 30 * time.Second
+	dailyTimeLayout              = "15:04"
+)
+
+// ActiveWindow 描述 runner 的一个活动时间窗口, 可以是每日的时间段，也可以是 cron 表达式加持续时长
+// 如 {"start":"22:00","end":"06:00"} 表示每天22点到次日6点运行
+// 如 {"cron":"0 0 1 * * 6","duration":"4h"} 表示每周六1点开始运行4个小时
+type ActiveWindow struct {
+	Start    string `json:"start,omitempty"`    // 每日开始时间, 格式为 HH:MM
+	End      string `json:"end,omitempty"`      // 每日结束时间, 格式为 HH:MM, 小于开始时间表示跨天
+	Cron     string `json:"cron,omitempty"`     // 窗口开始时间的 cron 表达式, 与 duration 配合使用
+	Duration string `json:"duration,omitempty"` // 窗口持续时长, 如 30m, 8h
+}
+
+type activeWindow struct {
+	start, end time.Duration // 距离当天零点的时长
+	schedule   cron.Schedule
+	duration   time.Duration
+}
+
+// Schedule 由多个活动时间窗口组成, 只要当前时间在任意一个窗口内就认为是活动的
+type Schedule struct {
+	windows []activeWindow
+}
+
+func parseDailyTime(str string) (time.Duration, error) {
+	t, err := time.Parse(dailyTimeLayout, str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid daily time %q, should be like 15:04", str)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// NewSchedule 解析活动时间窗口, 没有配置任何窗口时返回 nil, 表示 runner 一直处于活动状态
+func NewSchedule(windows []ActiveWindow) (*Schedule, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	s := &Schedule{}
+	for _, w := range windows {
+		var aw activeWindow
+		var err error
+		switch {
+		case w.Cron != "":
+			if aw.schedule, err = cron.Parse(w.Cron); err != nil {
+				return nil, fmt.Errorf("invalid active window cron %q: %v", w.Cron, err)
+			}
+			if aw.duration, err = time.ParseDuration(w.Duration); err != nil || aw.duration <= 0 {
+				return nil, fmt.Errorf("invalid active window duration %q for cron %q", w.Duration, w.Cron)
+			}
+		case w.Start != "" && w.End != "":
+			if aw.start, err = parseDailyTime(w.Start); err != nil {
+				return nil, err
+			}
+			if aw.end, err = parseDailyTime(w.End); err != nil {
+				return nil, err
+			}
+			if aw.start == aw.end {
+				return nil, fmt.Errorf("active window start %v is equal to end %v", w.Start, w.End)
+			}
+		default:
+			return nil, errors.New("active window should have either cron and duration or start and end")
+		}
+		s.windows = append(s.windows, aw)
+	}
+	return s, nil
+}
+
+// IsActive 判断当前时间是否在任意一个活动窗口内, nil 的 Schedule 永远是活动的
+func (s *Schedule) IsActive(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	for _, w := range s.windows {
+		if w.schedule != nil {
+			// Next 返回严格晚于给定时间的下一次触发, 若 now-duration 之后的第一次触发不晚于 now, 则 now 在窗口内
+			if !w.schedule.Next(now.Add(-w.duration)).After(now) {
+				return true
+			}
+			continue
+		}
+		year, month, day := now.Date()
+		offset := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+		if w.start < w.end {
+			if offset >= w.start && offset < w.end {
+				return true
+			}
+		} else if offset >= w.start || offset < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) isScheduleStopped(confPath string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.scheduleStopped[confPath]
+}
+
+// scheduleLoop 定期检查配置了活动时间窗口的 runner, 在窗口外停止 runner, 回到窗口内再启动
+func (m *Manager) scheduleLoop() {
+	ticker := time.NewTicker(defaultScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.exitChan:
+			return
+		case now := <-ticker.C:
+			m.checkSchedules(now)
+		}
+	}
+}
+
+func (m *Manager) checkSchedules(now time.Time) {
+	m.lock.RLock()
+	confs := make(map[string]RunnerConfig)
+	for path, conf := range m.runnerConfig {
+		if len(conf.ActiveWindows) > 0 && !conf.IsStopped {
+			confs[path] = conf
+		}
+	}
+	m.lock.RUnlock()
+
+	for path, conf := range confs {
+		schedule, err := NewSchedule(conf.ActiveWindows)
+		if err != nil {
+			log.Errorf("runner %v active windows error %v", conf.RunnerName, err)
+			continue
+		}
+		active := schedule.IsActive(now)
+		if !active && m.IsRunning(path) {
+			log.Infof("runner %v is out of its active windows, stop it", conf.RunnerName)
+			if err = m.RemoveWithConfig(path, false); err != nil {
+				log.Errorf("stop runner %v out of active windows error %v", conf.RunnerName, err)
+				continue
+			}
+			m.lock.Lock()
+			m.scheduleStopped[path] = true
+			m.lock.Unlock()
+			continue
+		}
+		if active && m.isScheduleStopped(path) {
+			log.Infof("runner %v enters its active windows, start it", conf.RunnerName)
+			if err = m.ForkRunner(path, conf, true); err != nil {
+				log.Errorf("start runner %v in active windows error %v", conf.RunnerName, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package mgr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	schedule, err := NewSchedule(nil)
+	assert.NoError(t, err)
+	assert.True(t, schedule.IsActive(time.Now()))
+
+	invalids := [][]ActiveWindow{
+		{{Start: "22:00"}},
+		{{Start: "25:00", End: "06:00"}},
+		{{Start: "06:00", End: "06:00"}},
+		{{Cron: "0 0 1 * * *"}},
+		{{Cron: "bad cron", Duration: "1h"}},
+	}
+	for _, windows := range invalids {
+		_, err = NewSchedule(windows)
+		assert.Error(t, err, windows)
+	}
+
+	day := func(hour, min int) time.Time {
+		return time.Date(2018, 3, 10, hour, min, 0, 0, time.Local)
+	}
+	schedule, err = NewSchedule([]ActiveWindow{{Start: "22:00", End: "06:00"}})
+	assert.NoError(t, err)
+	assert.True(t, schedule.IsActive(day(23, 0)))
+	assert.True(t, schedule.IsActive(day(5, 59)))
+	assert.False(t, schedule.IsActive(day(6, 0)))
+	assert.False(t, schedule.IsActive(day(12, 0)))
+
+	schedule, err = NewSchedule([]ActiveWindow{{Start: "09:00", End: "10:30"}, {Cron: "0 0 14 * * *", Duration: "30m"}})
+	assert.NoError(t, err)
+	assert.True(t, schedule.IsActive(day(9, 0)))
+	assert.True(t, schedule.IsActive(day(10, 29)))
+	assert.False(t, schedule.IsActive(day(10, 30)))
+	assert.True(t, schedule.IsActive(day(14, 0)))
+	assert.True(t, schedule.IsActive(day(14, 29)))
+	assert.False(t, schedule.IsActive(day(14, 31)))
+	assert.False(t, schedule.IsActive(day(13, 59)))
+}
+
+func TestManagerScheduleWaiting(t *testing.T) {
+	dir := "TestManagerScheduleWaiting"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir})
+	assert.NoError(t, err)
+	defer m.Stop()
+
+	now := time.Now()
+	start := now.Add(2 * time.Hour).Format(dailyTimeLayout)
+	end := now.Add(3 * time.Hour).Format(dailyTimeLayout)
+	conf := RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "waiting", ActiveWindows: []ActiveWindow{{Start: start, End: end}}}}
+	confPath, err := filepath.Abs(filepath.Join(dir, "waiting.conf"))
+	assert.NoError(t, err)
+	assert.NoError(t, m.ForkRunner(confPath, conf, true))
+	assert.False(t, m.IsRunning(confPath))
+	assert.True(t, m.isScheduleStopped(confPath))
+	assert.Equal(t, RunnerWaiting, m.Status()["waiting"].RunningStatus)
+
+	conf.ActiveWindows = []ActiveWindow{{Start: "bad"}}
+	assert.Error(t, m.ForkRunner(confPath, conf, true))
+}
+
+func TestManagerStopTwice(t *testing.T) {
+	dir := "TestManagerStopTwice"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Stop())
+	assert.NotPanics(t, func() { m.Stop() })
+}
@@ -0,0 +1,101 @@
+package mgr
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+const defaultSecretsRefreshInterval = 5 * time.Minute
+
+// resolveSecrets 解析 reader 和 sender 配置中的密钥引用, 返回解析后的配置以及所有密钥的摘要
+// 原配置不会被修改, 避免密钥通过 API 或备份的配置文件泄露; 没有密钥引用时摘要为空
+func (m *Manager) resolveSecrets(rc RunnerConfig) (RunnerConfig, string, error) {
+	h := sha1.New()
+	var found bool
+	resolve := func(name string, c conf.MapConf) (conf.MapConf, error) {
+		resolved, keys, err := m.secrets.ResolveConf(c)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v", name, err)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found = true
+			fmt.Fprintf(h, "%s.%s=%s\n", name, k, resolved[k])
+		}
+		return resolved, nil
+	}
+
+	var err error
+	if rc.ReaderConfig, err = resolve("reader", rc.ReaderConfig); err != nil {
+		return rc, "", err
+	}
+	senders := make([]conf.MapConf, len(rc.SendersConfig))
+	for i, sc := range rc.SendersConfig {
+		if senders[i], err = resolve(fmt.Sprintf("sender[%d]", i), sc); err != nil {
+			return rc, "", err
+		}
+	}
+	rc.SendersConfig = senders
+	if !found {
+		return rc, "", nil
+	}
+	return rc, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// secretsLoop 定期重新获取 runner 引用的密钥, 密钥发生变化时重启 runner
+func (m *Manager) secretsLoop() {
+	interval := defaultSecretsRefreshInterval
+	if m.SecretsRefreshInterval > 0 {
+		interval = time.Duration(m.SecretsRefreshInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.exitChan:
+			return
+		case <-ticker.C:
+			m.refreshSecrets()
+		}
+	}
+}
+
+func (m *Manager) refreshSecrets() {
+	m.lock.RLock()
+	confs := make(map[string]RunnerConfig)
+	digests := make(map[string]string)
+	for path, digest := range m.secretDigests {
+		if _, ok := m.runners[path]; !ok {
+			continue
+		}
+		confs[path] = m.runnerConfig[path]
+		digests[path] = digest
+	}
+	m.lock.RUnlock()
+
+	for path, conf := range confs {
+		_, digest, err := m.resolveSecrets(conf)
+		if err != nil {
+			log.Errorf("runner %v refresh secrets error %v", conf.RunnerName, err)
+			continue
+		}
+		if digest == digests[path] {
+			continue
+		}
+		log.Infof("secrets of runner %v changed, restart it", conf.RunnerName)
+		if err = m.RemoveWithConfig(path, false); err != nil {
+			log.Errorf("stop runner %v to refresh secrets error %v", conf.RunnerName, err)
+			continue
+		}
+		if err = m.ForkRunner(path, conf, true); err != nil {
+			log.Errorf("restart runner %v to refresh secrets error %v", conf.RunnerName, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package mgr
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/secrets"
+)
+
+type mockSecretProvider struct {
+	mux    sync.Mutex
+	values map[string]string
+}
+
+func (p *mockSecretProvider) Get(path string) (string, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	v, ok := p.values[path]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestResolveSecrets(t *testing.T) {
+	provider := &mockSecretProvider{values: map[string]string{"sk": "sk1"}}
+	secrets.RegisterConstructor("mock_secret", func(conf.MapConf) (secrets.Provider, error) {
+		return provider, nil
+	})
+	defer os.RemoveAll("TestResolveSecrets")
+	m, err := NewManager(ManagerConfig{RestDir: "TestResolveSecrets", ServerBackup: true})
+	assert.NoError(t, err)
+
+	rc := RunnerConfig{
+		ReaderConfig: conf.MapConf{"mode": "dir"},
+		SendersConfig: []conf.MapConf{
+			{"sender_type": "pandora", "pandora_sk": "secret:mock_secret:sk"},
+		},
+	}
+	resolved, digest, err := m.resolveSecrets(rc)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, digest)
+	assert.Equal(t, "sk1", resolved.SendersConfig[0]["pandora_sk"])
+	assert.Equal(t, "secret:mock_secret:sk", rc.SendersConfig[0]["pandora_sk"])
+
+	_, digest2, err := m.resolveSecrets(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, digest, digest2)
+
+	provider.mux.Lock()
+	provider.values["sk"] = "sk2"
+	provider.mux.Unlock()
+	_, digest3, err := m.resolveSecrets(rc)
+	assert.NoError(t, err)
+	assert.NotEqual(t, digest, digest3)
+
+	_, digest, err = m.resolveSecrets(RunnerConfig{ReaderConfig: conf.MapConf{"mode": "dir"}})
+	assert.NoError(t, err)
+	assert.Empty(t, digest)
+
+	rc.SendersConfig[0]["pandora_ak"] = "secret:mock_secret:ak"
+	_, _, err = m.resolveSecrets(rc)
+	assert.Error(t, err)
+}
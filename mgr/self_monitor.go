@@ -0,0 +1,177 @@
+package mgr
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/metric"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/reader"
+)
+
+const (
+	SelfMetricRunnerName = "logkit_self_metric"
+	SelfLogRunnerName    = "logkit_self_log"
+
+	selfMetricName             = "logkit"
+	defaultSelfCollectInterval = 60
+)
+
+// SelfMonitorConfig 开启后 logkit 会把自身各个 runner 的运行状态以及自身的日志通过指定的 sender 发送出去
+type SelfMonitorConfig struct {
+	Enable          bool           `json:"enable"`
+	CollectInterval int            `json:"collect_interval,omitempty"` // 收集 runner 状态的间隔, 单位秒
+	LogPath         string         `json:"log_path,omitempty"`         // logkit 自身日志的路径, 支持通配符, 为空时不收集日志
+	LogFormat       string         `json:"log_format,omitempty"`       // logkit 自身日志的格式, text 或 json
+	SendersConfig   []conf.MapConf `json:"senders"`
+}
+
+// selfCollector 把 logkit 中每个 runner 的状态作为一条 metric 数据
+type selfCollector struct {
+	m *Manager
+}
+
+func (c *selfCollector) Name() string {
+	return selfMetricName
+}
+
+func (c *selfCollector) Tags() []string {
+	return []string{selfMetricName + "_runner"}
+}
+
+func (c *selfCollector) Usages() string {
+	return "logkit 自身各个 runner 的运行状态"
+}
+
+func (c *selfCollector) Config() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (c *selfCollector) Collect() ([]map[string]interface{}, error) {
+	rss := c.m.Status()
+	datas := make([]map[string]interface{}, 0, len(rss))
+	for name, rs := range rss {
+		var transformErrors, senderSuccess, senderErrors int64
+		for _, ts := range rs.TransformStats {
+			transformErrors += ts.Errors
+		}
+		for _, ss := range rs.SenderStats {
+			senderSuccess += ss.Success
+			senderErrors += ss.Errors
+		}
+		datas = append(datas, map[string]interface{}{
+			selfMetricName + "_runner":           name,
+			selfMetricName + "_running_status":   rs.RunningStatus,
+			selfMetricName + "_read_data_count":  rs.ReadDataCount,
+			selfMetricName + "_read_data_size":   rs.ReadDataSize,
+			selfMetricName + "_read_speed":       rs.ReadSpeed,
+			selfMetricName + "_read_speed_kb":    rs.ReadSpeedKB,
+			selfMetricName + "_parser_success":   rs.ParserStats.Success,
+			selfMetricName + "_parser_errors":    rs.ParserStats.Errors,
+			selfMetricName + "_transform_errors": transformErrors,
+			selfMetricName + "_sender_success":   senderSuccess,
+			selfMetricName + "_sender_errors":    senderErrors,
+			selfMetricName + "_lag_size":         rs.Lag.Size,
+			selfMetricName + "_lag_total":        rs.Lag.Total,
+			selfMetricName + "_ft_lags":          rs.Lag.Ftlags,
+			selfMetricName + "_error":            rs.Error,
+		})
+	}
+	return datas, nil
+}
+
+func copySendersConfig(scs []conf.MapConf) []conf.MapConf {
+	ret := make([]conf.MapConf, len(scs))
+	for i, sc := range scs {
+		ret[i] = make(conf.MapConf, len(sc))
+		for k, v := range sc {
+			ret[i][k] = v
+		}
+	}
+	return ret
+}
+
+// selfLogExcludePattern 匹配自监控 runner 自己打印的日志, 如 sender 发送失败时的错误日志,
+// 这些日志如果再被收集发送, 发送失败时又会产生新的错误日志, 形成循环, 所以在 reader 中直接丢弃
+var selfLogExcludePattern = `Runner\[(` + regexp.QuoteMeta(SelfMetricRunnerName) + `|` + regexp.QuoteMeta(SelfLogRunnerName) + `)\]`
+
+// selfLogRunnerConfig 返回收集 logkit 自身日志的 runner 配置
+func selfLogRunnerConfig(sc SelfMonitorConfig) RunnerConfig {
+	parserConf := conf.MapConf{
+		parser.KeyParserName: SelfLogRunnerName,
+		parser.KeyParserType: parser.TypeLogv1,
+	}
+	if sc.LogFormat == "json" {
+		parserConf[parser.KeyParserType] = parser.TypeJSON
+	}
+	return RunnerConfig{
+		RunnerInfo: RunnerInfo{
+			RunnerName: SelfLogRunnerName,
+		},
+		ReaderConfig: conf.MapConf{
+			reader.KeyMode:    reader.ModeTailx,
+			reader.KeyLogPath: sc.LogPath,
+			reader.KeyWhence:  reader.WhenceNewest,
+			reader.KeyExpire:  "24h",
+
+			reader.KeyLineExcludePattern: selfLogExcludePattern,
+		},
+		ParserConf:    parserConf,
+		SendersConfig: copySendersConfig(sc.SendersConfig),
+	}
+}
+
+// startSelfMonitor 根据配置启动自监控的 runner, 这些 runner 不会出现在 runner 列表中
+func (m *Manager) startSelfMonitor() error {
+	sc := m.SelfMonitor
+	if !sc.Enable {
+		return nil
+	}
+	if len(sc.SendersConfig) == 0 {
+		return errors.New("self monitor is enabled but no senders configured")
+	}
+	if sc.CollectInterval <= 0 {
+		sc.CollectInterval = defaultSelfCollectInterval
+	}
+	rc := RunnerConfig{
+		RunnerInfo: RunnerInfo{
+			RunnerName:      SelfMetricRunnerName,
+			CollectInterval: sc.CollectInterval,
+		},
+		SendersConfig: copySendersConfig(sc.SendersConfig),
+	}
+	metricRunner, err := newMetricRunnerWithCollectors(rc, m.sregistry, []metric.Collector{&selfCollector{m: m}}, nil)
+	if err != nil {
+		return err
+	}
+	runners := []Runner{metricRunner}
+	if sc.LogPath != "" {
+		logRunner, err := NewLogExportRunner(selfLogRunnerConfig(sc), nil, m.rregistry, m.pregistry, m.sregistry)
+		if err != nil {
+			metricRunner.Stop()
+			return err
+		}
+		runners = append(runners, logRunner)
+	}
+	m.lock.Lock()
+	m.selfRunners = runners
+	m.lock.Unlock()
+	for _, r := range runners {
+		log.Infof("self monitor runner %v is started", r.Name())
+		go r.Run()
+	}
+	return nil
+}
+
+func (m *Manager) stopSelfMonitor() {
+	m.lock.Lock()
+	runners := m.selfRunners
+	m.selfRunners = nil
+	m.lock.Unlock()
+	for _, r := range runners {
+		r.Stop()
+	}
+}
@@ -0,0 +1,134 @@
+package mgr
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestSelfCollector(t *testing.T) {
+	defer os.RemoveAll("TestSelfCollector")
+	m, err := NewManager(ManagerConfig{RestDir: "TestSelfCollector", ServerBackup: true})
+	assert.NoError(t, err)
+	m.runnerConfig["r1.conf"] = RunnerConfig{RunnerInfo: RunnerInfo{RunnerName: "r1"}}
+
+	c := &selfCollector{m: m}
+	datas, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, datas, 1)
+	assert.Equal(t, "r1", datas[0]["logkit_runner"])
+	assert.Equal(t, RunnerStopped, datas[0]["logkit_running_status"])
+	assert.Equal(t, int64(0), datas[0]["logkit_sender_errors"])
+
+	// 没有配置 sender 时不启动
+	m.SelfMonitor = SelfMonitorConfig{Enable: true}
+	assert.Error(t, m.startSelfMonitor())
+}
+
+func TestSelfLogRunnerConfig(t *testing.T) {
+	sc := SelfMonitorConfig{
+		LogPath:       "/var/log/logkit/logkit.log-*",
+		LogFormat:     "json",
+		SendersConfig: []conf.MapConf{{"sender_type": "discard"}},
+	}
+	rc := selfLogRunnerConfig(sc)
+	assert.Equal(t, SelfLogRunnerName, rc.RunnerName)
+	assert.Equal(t, reader.ModeTailx, rc.ReaderConfig[reader.KeyMode])
+	assert.Equal(t, sc.LogPath, rc.ReaderConfig[reader.KeyLogPath])
+	assert.Equal(t, parser.TypeJSON, rc.ParserConf[parser.KeyParserType])
+	assert.Equal(t, selfLogExcludePattern, rc.ReaderConfig[reader.KeyLineExcludePattern])
+
+	// sender 的配置是独立的一份, 不会被 runner 修改
+	rc.SendersConfig[0]["runner_name"] = SelfLogRunnerName
+	_, ok := sc.SendersConfig[0]["runner_name"]
+	assert.False(t, ok)
+}
+
+// failSender 记录收到的数据, 并且总是发送失败
+type failSender struct {
+	mux   sync.Mutex
+	datas []Data
+}
+
+func (s *failSender) Name() string {
+	return "fail_sender"
+}
+
+func (s *failSender) Send(datas []Data) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.datas = append(s.datas, datas...)
+	return errors.New("always fail")
+}
+
+func (s *failSender) Close() error {
+	return nil
+}
+
+func (s *failSender) received() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return fmt.Sprint(s.datas)
+}
+
+// 自监控的 sender 发送失败时打印的错误日志不会被自己再收集一遍
+func TestSelfLogRunnerFailingSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSelfLogRunnerFailingSender")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "logkit.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+	assert.NoError(t, err)
+	defer logFile.Close()
+	log.SetOutput(logFile)
+	defer log.SetOutput(os.Stderr)
+
+	fs := &failSender{}
+	sr := sender.NewRegistry()
+	assert.NoError(t, sr.RegisterSender("self_monitor_fail", func(conf.MapConf) (sender.Sender, error) {
+		return fs, nil
+	}))
+	rc := selfLogRunnerConfig(SelfMonitorConfig{
+		LogPath:       logPath,
+		SendersConfig: []conf.MapConf{{sender.KeySenderType: "self_monitor_fail"}},
+	})
+	rc.MaxBatchInterval = 1
+	rc.ReaderConfig[reader.KeyMetaPath] = filepath.Join(dir, "meta")
+	r, err := NewLogExportRunner(rc, nil, reader.NewRegistry(), parser.NewRegistry(), sr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	go r.Run()
+	defer r.Stop()
+
+	deadline := time.Now().Add(20 * time.Second)
+	for !strings.Contains(fs.received(), "Runner[other]") && time.Now().Before(deadline) {
+		log.Errorf("Runner[other] send error")
+		time.Sleep(500 * time.Millisecond)
+	}
+	assert.Contains(t, fs.received(), "Runner[other]")
+	// 等待 sender 的发送错误写入日志文件, 并且给 reader 足够的时间读取
+	log.Errorf("Runner[other] send error")
+	time.Sleep(3 * time.Second)
+	content, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Runner["+SelfLogRunnerName+"]")
+	assert.NotContains(t, fs.received(), "Runner["+SelfLogRunnerName+"]")
+}
@@ -0,0 +1,234 @@
+package mgr
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultStatsHistoryInterval = 10   // 单位秒
+	DefaultStatsHistoryWindow   = 3600 // 单位秒
+)
+
+// StatsHistoryConfig 配置 runner 统计信息的历史记录, 数据只保存在内存中
+type StatsHistoryConfig struct {
+	Disable  bool `json:"disable"`
+	Interval int  `json:"interval"` // 采样间隔, 单位秒
+	Window   int  `json:"window"`   // 保留多长时间内的数据, 单位秒
+}
+
+// StatsPoint 是 runner 在某一时刻的统计信息, 计数都是累计值, rate 为与上一个点相比每秒的增量
+type StatsPoint struct {
+	Time          int64   `json:"time"` // unix 时间戳, 单位秒
+	ReadDataCount int64   `json:"read_count"`
+	ReadDataSize  int64   `json:"read_bytes"`
+	ParseSuccess  int64   `json:"parse_success"`
+	ParseErrors   int64   `json:"parse_errors"`
+	SendSuccess   int64   `json:"send_success"` // 所有 sender 的总和
+	SendErrors    int64   `json:"send_errors"`
+	ReadRate      float64 `json:"read_rate"`
+	ReadBytesRate float64 `json:"read_bytes_rate"`
+	ParseRate     float64 `json:"parse_rate"`
+	SendRate      float64 `json:"send_rate"`
+	Lag           int64   `json:"lag"`
+	LagUnit       string  `json:"lag_unit,omitempty"`
+	FtLags        int64   `json:"ft_lags"`
+}
+
+func newStatsPoint(now time.Time, rs RunnerStatus) StatsPoint {
+	p := StatsPoint{
+		Time:          now.Unix(),
+		ReadDataCount: rs.ReadDataCount,
+		ReadDataSize:  rs.ReadDataSize,
+		ParseSuccess:  rs.ParserStats.Success,
+		ParseErrors:   rs.ParserStats.Errors,
+		Lag:           rs.Lag.Size,
+		LagUnit:       rs.Lag.SizeUnit,
+		FtLags:        rs.Lag.Ftlags,
+	}
+	for _, s := range rs.SenderStats {
+		p.SendSuccess += s.Success
+		p.SendErrors += s.Errors
+	}
+	return p
+}
+
+func rate(cur, last int64, seconds float64) float64 {
+	// runner 重启后计数可能变小
+	if cur < last || seconds <= 0 {
+		return 0
+	}
+	return float64(cur-last) / seconds
+}
+
+func (p *StatsPoint) calcRate(last StatsPoint) {
+	seconds := float64(p.Time - last.Time)
+	p.ReadRate = rate(p.ReadDataCount, last.ReadDataCount, seconds)
+	p.ReadBytesRate = rate(p.ReadDataSize, last.ReadDataSize, seconds)
+	p.ParseRate = rate(p.ParseSuccess+p.ParseErrors, last.ParseSuccess+last.ParseErrors, seconds)
+	p.SendRate = rate(p.SendSuccess+p.SendErrors, last.SendSuccess+last.SendErrors, seconds)
+}
+
+// statsRing 是固定容量的环形缓冲区, 满了之后覆盖最旧的点
+type statsRing struct {
+	points []StatsPoint
+	start  int
+	size   int
+}
+
+func newStatsRing(capacity int) *statsRing {
+	return &statsRing{points: make([]StatsPoint, capacity)}
+}
+
+func (r *statsRing) add(p StatsPoint) {
+	if r.size > 0 {
+		p.calcRate(r.points[(r.start+r.size-1)%len(r.points)])
+	}
+	if r.size < len(r.points) {
+		r.points[(r.start+r.size)%len(r.points)] = p
+		r.size++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+// list 按时间顺序返回 since 之后的点
+func (r *statsRing) list(since int64) []StatsPoint {
+	points := make([]StatsPoint, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		p := r.points[(r.start+i)%len(r.points)]
+		if p.Time > since {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+type statsHistory struct {
+	mutex    sync.RWMutex
+	capacity int
+	runners  map[string]*statsRing
+}
+
+func newStatsHistory(c StatsHistoryConfig) *statsHistory {
+	interval, window := c.Interval, c.Window
+	if interval <= 0 {
+		interval = DefaultStatsHistoryInterval
+	}
+	if window <= 0 {
+		window = DefaultStatsHistoryWindow
+	}
+	capacity := window / interval
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &statsHistory{capacity: capacity, runners: make(map[string]*statsRing)}
+}
+
+// record 记录所有 runner 的状态, 已经删除的 runner 的历史会被清除
+func (h *statsHistory) record(now time.Time, rss map[string]RunnerStatus) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for name := range h.runners {
+		if _, ok := rss[name]; !ok {
+			delete(h.runners, name)
+		}
+	}
+	for name, rs := range rss {
+		ring, ok := h.runners[name]
+		if !ok {
+			ring = newStatsRing(h.capacity)
+			h.runners[name] = ring
+		}
+		ring.add(newStatsPoint(now, rs))
+	}
+}
+
+func (h *statsHistory) query(name string, since int64) ([]StatsPoint, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	ring, ok := h.runners[name]
+	if !ok {
+		return nil, false
+	}
+	return ring.list(since), true
+}
+
+func (h *statsHistory) queryAll(since int64) map[string][]StatsPoint {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	ret := make(map[string][]StatsPoint, len(h.runners))
+	for name, ring := range h.runners {
+		ret[name] = ring.list(since)
+	}
+	return ret
+}
+
+func (m *Manager) statsHistoryLoop() {
+	if m.statsHistory == nil {
+		return
+	}
+	interval := DefaultStatsHistoryInterval
+	if m.StatsHistory.Interval > 0 {
+		interval = m.StatsHistory.Interval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.exitChan:
+			return
+		case now := <-ticker.C:
+			m.statsHistory.record(now, m.Status())
+		}
+	}
+}
+
+func parseStatsSince(c echo.Context) (int64, error) {
+	v := c.QueryParam("since")
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// GET /logkit/history?since=<unix seconds>
+// 返回所有 runner 在 since 之后的统计信息, 按时间顺序排列
+func (rs *RestService) GetStatsHistory() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rs.mgr.statsHistory == nil {
+			return RespError(c, http.StatusNotFound, ErrStatsHistory, "stats history is disabled")
+		}
+		since, err := parseStatsSince(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrStatsHistory, "since should be a unix timestamp: "+err.Error())
+		}
+		return RespSuccess(c, rs.mgr.statsHistory.queryAll(since))
+	}
+}
+
+// GET /logkit/history/<name>?since=<unix seconds>
+func (rs *RestService) GetRunnerStatsHistory() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rs.mgr.statsHistory == nil {
+			return RespError(c, http.StatusNotFound, ErrStatsHistory, "stats history is disabled")
+		}
+		since, err := parseStatsSince(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrStatsHistory, "since should be a unix timestamp: "+err.Error())
+		}
+		name := c.Param("name")
+		points, ok := rs.mgr.statsHistory.query(name, since)
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrStatsHistory, "no stats history of runner "+name)
+		}
+		return RespSuccess(c, points)
+	}
+}
@@ -0,0 +1,82 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestStatsHistory(t *testing.T) {
+	h := newStatsHistory(StatsHistoryConfig{Interval: 10, Window: 30})
+	assert.Equal(t, 3, h.capacity)
+
+	now := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		h.record(now.Add(time.Duration(i*10)*time.Second), map[string]RunnerStatus{
+			"r1": {
+				ReadDataCount: int64(i * 100),
+				ParserStats:   StatsInfo{Success: int64(i * 90), Errors: int64(i * 10)},
+				SenderStats:   map[string]StatsInfo{"s1": {Success: int64(i * 50)}, "s2": {Success: int64(i * 50)}},
+				Lag:           LagInfo{Size: int64(i), SizeUnit: "bytes", Ftlags: 1},
+			},
+		})
+	}
+	points, ok := h.query("r1", 0)
+	assert.True(t, ok)
+	// 只保留最近的 3 个点
+	assert.Len(t, points, 3)
+	assert.Equal(t, int64(1020), points[0].Time)
+	assert.Equal(t, int64(1040), points[2].Time)
+	assert.Equal(t, int64(400), points[2].ReadDataCount)
+	assert.Equal(t, int64(400), points[2].SendSuccess)
+	assert.Equal(t, float64(10), points[2].ReadRate)
+	assert.Equal(t, float64(10), points[2].ParseRate)
+	assert.Equal(t, float64(10), points[2].SendRate)
+	assert.Equal(t, int64(4), points[2].Lag)
+
+	points, _ = h.query("r1", 1030)
+	assert.Len(t, points, 1)
+
+	// runner 重启后计数变小
+	h.record(now.Add(50*time.Second), map[string]RunnerStatus{"r1": {ReadDataCount: 10}, "r2": {}})
+	points, _ = h.query("r1", 1040)
+	assert.Equal(t, float64(0), points[0].ReadRate)
+	assert.Len(t, h.queryAll(0), 2)
+
+	// 删除的 runner 不再保留历史
+	h.record(now.Add(60*time.Second), map[string]RunnerStatus{"r2": {}})
+	_, ok = h.query("r1", 0)
+	assert.False(t, ok)
+}
+
+func TestGetStatsHistory(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestGetStatsHistory", ServerBackup: true})
+	assert.NoError(t, err)
+	m.statsHistory.record(time.Now(), map[string]RunnerStatus{"r1": {ReadDataCount: 1}})
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/history", rs.GetStatsHistory())
+	router.GET(PREFIX+"/history/:name", rs.GetRunnerStatsHistory())
+
+	for path, code := range map[string]int{
+		"/history":           http.StatusOK,
+		"/history?since=abc": http.StatusBadRequest,
+		"/history/r1":        http.StatusOK,
+		"/history/r2":        http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+path, nil))
+		assert.Equal(t, code, rec.Code, path)
+	}
+
+	m.statsHistory = nil
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+"/history", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
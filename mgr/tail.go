@@ -0,0 +1,181 @@
+package mgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+	"github.com/qiniu/logkit/utils/websocket"
+)
+
+const (
+	DefaultTailRate    = 10 // 每秒最多推送的数据条数
+	MaxTailRate        = 1000
+	DefaultTailTimeout = 300 // 推送的最长时间, 单位秒, 到期后自动断开
+	MaxTailTimeout     = 3600
+
+	tailBufferSize = 100
+)
+
+// Tailable 的 runner 可以把经过 transform 之后、发送之前的数据复制一份给订阅者
+type Tailable interface {
+	// Tail 订阅数据, 返回的 cancel 用于取消订阅, 订阅者处理不过来的数据会被丢弃
+	Tail() (datas <-chan Data, cancel func())
+}
+
+// dataTap 把 runner 处理后的数据分发给订阅者, 没有订阅者时几乎没有开销
+type dataTap struct {
+	mutex sync.RWMutex
+	count int32
+	subs  map[chan Data]struct{}
+}
+
+func newDataTap() *dataTap {
+	return &dataTap{subs: make(map[chan Data]struct{})}
+}
+
+func (t *dataTap) subscribe() (<-chan Data, func()) {
+	ch := make(chan Data, tailBufferSize)
+	t.mutex.Lock()
+	t.subs[ch] = struct{}{}
+	atomic.StoreInt32(&t.count, int32(len(t.subs)))
+	t.mutex.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			t.mutex.Lock()
+			delete(t.subs, ch)
+			atomic.StoreInt32(&t.count, int32(len(t.subs)))
+			t.mutex.Unlock()
+		})
+	}
+}
+
+func (t *dataTap) publish(datas []Data) {
+	if t == nil || atomic.LoadInt32(&t.count) == 0 {
+		return
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for ch := range t.subs {
+		for _, d := range datas {
+			// sender 可能会修改数据, 所以给订阅者的是一份拷贝
+			cp := make(Data, len(d))
+			for k, v := range d {
+				cp[k] = v
+			}
+			select {
+			case ch <- cp:
+			default:
+			}
+		}
+	}
+}
+
+func (r *LogExportRunner) Tail() (<-chan Data, func()) {
+	return r.tap.subscribe()
+}
+
+func (m *Manager) getRunnerByName(name string) (Runner, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, r := range m.runners {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func parseTailParam(c echo.Context, key string, def, max int) (int, error) {
+	v := c.QueryParam(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 || i > max {
+		return 0, fmt.Errorf("%v should be an integer between 1 and %v", key, max)
+	}
+	return i, nil
+}
+
+// GET /logkit/tail/<name>?rate=<n>&timeout=<seconds>
+// 通过 websocket 推送 runner 经过 transform 之后的数据, 每条数据为一个 JSON 文本消息,
+// 每秒最多推送 rate 条, 多余的数据会被丢弃, timeout 秒后自动断开
+func (rs *RestService) GetTail() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		rate, err := parseTailParam(c, "rate", DefaultTailRate, MaxTailRate)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTail, err.Error())
+		}
+		timeout, err := parseTailParam(c, "timeout", DefaultTailTimeout, MaxTailTimeout)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTail, err.Error())
+		}
+		r, ok := rs.mgr.getRunnerByName(name)
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrTail, "runner "+name+" is not found or not running")
+		}
+		tr, ok := r.(Tailable)
+		if !ok {
+			return RespError(c, http.StatusBadRequest, ErrTail, "runner "+name+" does not support tail")
+		}
+		conn, err := websocket.Upgrade(c.Response().Writer, c.Request())
+		if err != nil {
+			log.Warnf("tail runner %v upgrade websocket error %v", name, err)
+			return nil
+		}
+		defer conn.Close()
+
+		datas, cancel := tr.Tail()
+		defer cancel()
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		log.Infof("start to tail runner %v, rate %v, timeout %vs", name, rate, timeout)
+		deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+		defer deadline.Stop()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		sent := 0
+		for {
+			select {
+			case <-closed:
+				return nil
+			case <-deadline.C:
+				conn.WriteClose(websocket.CloseNormal, "timeout")
+				return nil
+			case <-ticker.C:
+				sent = 0
+			case d := <-datas:
+				if sent >= rate {
+					continue
+				}
+				data, err := json.Marshal(d)
+				if err != nil {
+					continue
+				}
+				if err = conn.WriteText(data); err != nil {
+					return nil
+				}
+				sent++
+			}
+		}
+	}
+}
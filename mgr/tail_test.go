@@ -0,0 +1,58 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestDataTap(t *testing.T) {
+	tap := newDataTap()
+	tap.publish([]Data{{"a": 1}})
+
+	datas, cancel := tap.subscribe()
+	src := []Data{{"a": 1}, {"a": 2}}
+	tap.publish(src)
+	d := <-datas
+	assert.Equal(t, Data{"a": 1}, d)
+	d["a"] = 100
+	assert.Equal(t, 1, src[0]["a"])
+	assert.Equal(t, Data{"a": 2}, <-datas)
+
+	// 订阅者处理不过来时丢弃数据而不是阻塞 runner
+	for i := 0; i < tailBufferSize+10; i++ {
+		tap.publish(src[:1])
+	}
+	assert.Len(t, datas, tailBufferSize)
+
+	cancel()
+	cancel()
+	assert.Len(t, tap.subs, 0)
+	var nilTap *dataTap
+	nilTap.publish(src)
+}
+
+func TestGetTail(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestGetTail", ServerBackup: true})
+	assert.NoError(t, err)
+	m.runners["r1.conf"] = &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}, tap: newDataTap()}
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.GET(PREFIX+"/tail/:name", rs.GetTail())
+
+	for path, code := range map[string]int{
+		"/tail/r2":              http.StatusNotFound,
+		"/tail/r1?rate=0":       http.StatusBadRequest,
+		"/tail/r1?timeout=7200": http.StatusBadRequest,
+		"/tail/r1":              http.StatusBadRequest, // 不是 websocket 请求
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+path, nil))
+		assert.Equal(t, code, rec.Code, path)
+	}
+}
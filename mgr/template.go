@@ -0,0 +1,455 @@
+package mgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	templateDirName = "templates"
+	templateExt     = ".tpl"
+)
+
+var (
+	templateParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// 模板中以 {{name}} 的形式引用参数
+	templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// TemplateParam 是模板声明的一个参数
+type TemplateParam struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// RunnerTemplate 是带参数的 runner 配置, config 中的字符串可以用 {{name}} 引用参数,
+// 每次实例化时用不同的参数值替换后得到一个 runner
+type RunnerTemplate struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Params      []TemplateParam        `json:"params"`
+	Config      map[string]interface{} `json:"config"`
+	UpdateTime  string                 `json:"update_time,omitempty"`
+}
+
+// TemplateRef 记录 runner 是由哪个模板以及哪些参数创建的, 模板更新时据此重新生成 runner 的配置
+type TemplateRef struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// TemplateInstance 是模板的一个实例
+type TemplateInstance struct {
+	Runner string            `json:"runner"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// TemplateApplyResult 是模板更新后批量更新实例的结果
+type TemplateApplyResult struct {
+	Updated []string          `json:"updated"`
+	Failed  map[string]string `json:"failed"`
+}
+
+// Validate 检查模板的参数声明以及 config 中引用的参数是否都已声明
+func (t *RunnerTemplate) Validate() error {
+	if err := checkRunnerNameForImport(t.Name); err != nil {
+		return fmt.Errorf("invalid template name %q", t.Name)
+	}
+	if len(t.Config) == 0 {
+		return errors.New("template config is empty")
+	}
+	declared := make(map[string]bool, len(t.Params))
+	for _, p := range t.Params {
+		if !templateParamName.MatchString(p.Name) {
+			return fmt.Errorf("invalid template param name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("template param %v is declared more than once", p.Name)
+		}
+		declared[p.Name] = true
+	}
+	var undeclared []string
+	walkTemplateStrings(t.Config, func(s string) string {
+		for _, m := range templatePlaceholder.FindAllStringSubmatch(s, -1) {
+			if !declared[m[1]] {
+				undeclared = append(undeclared, m[1])
+			}
+		}
+		return s
+	})
+	if len(undeclared) > 0 {
+		return fmt.Errorf("template params %v are used but not declared", strings.Join(undeclared, ","))
+	}
+	return nil
+}
+
+// resolveParams 根据声明合并默认值, 并检查必填参数和未声明的参数
+func (t *RunnerTemplate) resolveParams(params map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(t.Params))
+	values := make(map[string]string, len(t.Params))
+	for _, p := range t.Params {
+		declared[p.Name] = true
+		v, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("template param %v is required", p.Name)
+			}
+			v = p.Default
+		}
+		values[p.Name] = v
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("template param %v is not declared in template %v", name, t.Name)
+		}
+	}
+	return values, nil
+}
+
+// Render 用参数值替换模板中的引用, 生成 runner 的配置
+func (t *RunnerTemplate) Render(runnerName string, params map[string]string) (conf RunnerConfig, err error) {
+	values, err := t.resolveParams(params)
+	if err != nil {
+		return conf, err
+	}
+	data, err := json.Marshal(t.Config)
+	if err != nil {
+		return conf, err
+	}
+	var config map[string]interface{}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return conf, err
+	}
+	rendered := walkTemplateStrings(config, func(s string) string {
+		return templatePlaceholder.ReplaceAllStringFunc(s, func(ref string) string {
+			return values[templatePlaceholder.FindStringSubmatch(ref)[1]]
+		})
+	})
+	if data, err = json.Marshal(rendered); err != nil {
+		return conf, err
+	}
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return conf, fmt.Errorf("rendered template %v is not a valid runner config: %v", t.Name, err)
+	}
+	conf.RunnerName = runnerName
+	conf.Template = &TemplateRef{Name: t.Name, Params: params}
+	return conf, nil
+}
+
+// walkTemplateStrings 对 v 中所有的字符串调用 fn, 并用返回值替换原来的字符串
+func walkTemplateStrings(v interface{}, fn func(string) string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return fn(value)
+	case map[string]interface{}:
+		for k, sub := range value {
+			value[k] = walkTemplateStrings(sub, fn)
+		}
+	case []interface{}:
+		for i, sub := range value {
+			value[i] = walkTemplateStrings(sub, fn)
+		}
+	}
+	return v
+}
+
+// templateStore 保存所有的模板, 每个模板以 <name>.tpl 的文件名持久化在 rest_dir 下的 templates 目录中
+type templateStore struct {
+	mutex     sync.RWMutex
+	dir       string
+	templates map[string]RunnerTemplate
+}
+
+func newTemplateStore(dir string) (*templateStore, error) {
+	ts := &templateStore{dir: dir, templates: make(map[string]RunnerTemplate)}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ts, nil
+		}
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != templateExt {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var t RunnerTemplate
+		if err = json.Unmarshal(data, &t); err != nil {
+			log.Errorf("load template %v error %v, skipped", f.Name(), err)
+			continue
+		}
+		ts.templates[t.Name] = t
+	}
+	return ts, nil
+}
+
+func (ts *templateStore) get(name string) (RunnerTemplate, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	t, ok := ts.templates[name]
+	return t, ok
+}
+
+func (ts *templateStore) list() []RunnerTemplate {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	list := make([]RunnerTemplate, 0, len(ts.templates))
+	for _, t := range ts.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (ts *templateStore) save(t RunnerTemplate) error {
+	data, err := json.MarshalIndent(t, "", "    ")
+	if err != nil {
+		return err
+	}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if err = os.MkdirAll(ts.dir, DefaultDirPerm); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(ts.dir, t.Name+templateExt), data, DefaultFilePerm); err != nil {
+		return err
+	}
+	ts.templates[t.Name] = t
+	return nil
+}
+
+func (ts *templateStore) remove(name string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if err := os.Remove(filepath.Join(ts.dir, name+templateExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(ts.templates, name)
+	return nil
+}
+
+// AddTemplate 添加一个模板
+func (m *Manager) AddTemplate(t RunnerTemplate) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if _, ok := m.templates.get(t.Name); ok {
+		return fmt.Errorf("template %v already exists", t.Name)
+	}
+	t.UpdateTime = time.Now().Format(time.RFC3339Nano)
+	return m.templates.save(t)
+}
+
+// UpdateTemplate 更新模板, 并用新的模板和每个实例原来的参数重新生成所有实例的配置
+func (m *Manager) UpdateTemplate(t RunnerTemplate, afterApply func(name string, before map[string]interface{}, err error)) (TemplateApplyResult, error) {
+	result := TemplateApplyResult{Updated: make([]string, 0), Failed: make(map[string]string)}
+	if err := t.Validate(); err != nil {
+		return result, err
+	}
+	if _, ok := m.templates.get(t.Name); !ok {
+		return result, fmt.Errorf("template %v is not found", t.Name)
+	}
+	instances := m.TemplateInstances(t.Name)
+	confs := make(map[string]RunnerConfig, len(instances))
+	for _, ins := range instances {
+		conf, err := t.Render(ins.Runner, ins.Params)
+		if err != nil {
+			return result, fmt.Errorf("render runner %v error %v", ins.Runner, err)
+		}
+		confs[ins.Runner] = conf
+	}
+	t.UpdateTime = time.Now().Format(time.RFC3339Nano)
+	if err := m.templates.save(t); err != nil {
+		return result, err
+	}
+	for _, ins := range instances {
+		before := m.auditSnapshot(ins.Runner)
+		conf := confs[ins.Runner]
+		conf.IsInWebFolder = true
+		conf.IsStopped = m.isRunnerStopped(ins.Runner)
+		err := m.UpdateRunner(ins.Runner, conf)
+		if afterApply != nil {
+			afterApply(ins.Runner, before, err)
+		}
+		if err != nil {
+			log.Errorf("update runner %v with template %v error %v", ins.Runner, t.Name, err)
+			result.Failed[ins.Runner] = err.Error()
+			continue
+		}
+		result.Updated = append(result.Updated, ins.Runner)
+	}
+	return result, nil
+}
+
+// DeleteTemplate 删除模板, 模板还有实例时不允许删除
+func (m *Manager) DeleteTemplate(name string) error {
+	if _, ok := m.templates.get(name); !ok {
+		return fmt.Errorf("template %v is not found", name)
+	}
+	if instances := m.TemplateInstances(name); len(instances) > 0 {
+		runners := make([]string, 0, len(instances))
+		for _, ins := range instances {
+			runners = append(runners, ins.Runner)
+		}
+		return fmt.Errorf("template %v is still used by runners %v", name, strings.Join(runners, ","))
+	}
+	return m.templates.remove(name)
+}
+
+// InstantiateTemplate 用参数实例化模板, 创建一个新的 runner
+func (m *Manager) InstantiateTemplate(name, runnerName string, params map[string]string) error {
+	t, ok := m.templates.get(name)
+	if !ok {
+		return fmt.Errorf("template %v is not found", name)
+	}
+	if err := checkRunnerNameForImport(runnerName); err != nil {
+		return err
+	}
+	if m.hasRunnerConfig(runnerName) {
+		return fmt.Errorf("runner %v already exists", runnerName)
+	}
+	conf, err := t.Render(runnerName, params)
+	if err != nil {
+		return err
+	}
+	conf.IsInWebFolder = true
+	return m.AddRunner(runnerName, conf)
+}
+
+// TemplateInstances 返回由模板创建的所有 runner, 按 runner 名字排序
+func (m *Manager) TemplateInstances(name string) []TemplateInstance {
+	m.lock.RLock()
+	instances := make([]TemplateInstance, 0)
+	for file, conf := range m.runnerConfig {
+		if conf.Template == nil || conf.Template.Name != name || filepath.Dir(file) != m.RestDir {
+			continue
+		}
+		params := make(map[string]string, len(conf.Template.Params))
+		for k, v := range conf.Template.Params {
+			params[k] = v
+		}
+		instances = append(instances, TemplateInstance{Runner: runnerNameOfFile(file), Params: params})
+	}
+	m.lock.RUnlock()
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Runner < instances[j].Runner })
+	return instances
+}
+
+func (m *Manager) isRunnerStopped(name string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.runnerConfig[filepath.Join(m.RestDir, name+".conf")].IsStopped
+}
+
+// GET /logkit/templates
+func (rs *RestService) GetTemplates() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, rs.mgr.templates.list())
+	}
+}
+
+// GET /logkit/templates/<name>
+func (rs *RestService) GetTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		t, ok := rs.mgr.templates.get(c.Param("name"))
+		if !ok {
+			return RespError(c, http.StatusNotFound, ErrTemplate, "template "+c.Param("name")+" is not found")
+		}
+		return RespSuccess(c, t)
+	}
+}
+
+// POST /logkit/templates/<name>
+func (rs *RestService) PostTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var t RunnerTemplate
+		if err := c.Bind(&t); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		t.Name = c.Param("name")
+		if err := rs.mgr.AddTemplate(t); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
+
+// PUT /logkit/templates/<name>
+func (rs *RestService) PutTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var t RunnerTemplate
+		if err := c.Bind(&t); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		t.Name = c.Param("name")
+		result, err := rs.mgr.UpdateTemplate(t, func(name string, before map[string]interface{}, err error) {
+			rs.audit(c, AuditActionUpdate, name, before, err)
+		})
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		return RespSuccess(c, result)
+	}
+}
+
+// DELETE /logkit/templates/<name>
+func (rs *RestService) DeleteTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := rs.mgr.DeleteTemplate(c.Param("name")); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
+
+// GET /logkit/templates/<name>/instances
+func (rs *RestService) GetTemplateInstances() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if _, ok := rs.mgr.templates.get(name); !ok {
+			return RespError(c, http.StatusNotFound, ErrTemplate, "template "+name+" is not found")
+		}
+		return RespSuccess(c, rs.mgr.TemplateInstances(name))
+	}
+}
+
+// POST /logkit/templates/<name>/instances/<runner>
+func (rs *RestService) PostTemplateInstance() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			Params map[string]string `json:"params"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		runnerName := c.Param("runner")
+		before := rs.mgr.auditSnapshot(runnerName)
+		err := rs.mgr.InstantiateTemplate(c.Param("name"), runnerName, req.Params)
+		rs.audit(c, AuditActionCreate, runnerName, before, err)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrTemplate, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
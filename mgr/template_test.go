@@ -0,0 +1,90 @@
+package mgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTemplate() RunnerTemplate {
+	return RunnerTemplate{
+		Name: "nginx",
+		Params: []TemplateParam{
+			{Name: "log_path", Required: true},
+			{Name: "repo", Default: "nginx_repo"},
+		},
+		Config: map[string]interface{}{
+			"batch_interval": 10,
+			"reader":         map[string]interface{}{"mode": "dir", "log_path": "{{log_path}}"},
+			"parser":         map[string]interface{}{"type": "nginx"},
+			"senders": []interface{}{
+				map[string]interface{}{"sender_type": "pandora", "pandora_repo_name": "{{ repo }}_{{log_path}}"},
+			},
+		},
+	}
+}
+
+func TestRunnerTemplate(t *testing.T) {
+	tpl := newTestTemplate()
+	assert.NoError(t, tpl.Validate())
+
+	conf, err := tpl.Render("r1", map[string]string{"log_path": "/var/log/nginx"})
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", conf.RunnerName)
+	assert.Equal(t, 10, conf.MaxBatchInterval)
+	assert.Equal(t, "/var/log/nginx", conf.ReaderConfig["log_path"])
+	assert.Equal(t, "nginx_repo_/var/log/nginx", conf.SendersConfig[0]["pandora_repo_name"])
+	assert.Equal(t, &TemplateRef{Name: "nginx", Params: map[string]string{"log_path": "/var/log/nginx"}}, conf.Template)
+	// 渲染不会修改模板本身
+	assert.Equal(t, "{{log_path}}", tpl.Config["reader"].(map[string]interface{})["log_path"])
+
+	_, err = tpl.Render("r1", nil)
+	assert.Error(t, err)
+	_, err = tpl.Render("r1", map[string]string{"log_path": "/a", "topic": "b"})
+	assert.Error(t, err)
+
+	bad := newTestTemplate()
+	bad.Config["note"] = "{{undeclared}}"
+	assert.Error(t, bad.Validate())
+	bad = newTestTemplate()
+	bad.Params = append(bad.Params, TemplateParam{Name: "repo"})
+	assert.Error(t, bad.Validate())
+	bad = newTestTemplate()
+	bad.Name = "a/b"
+	assert.Error(t, bad.Validate())
+}
+
+func TestTemplateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestTemplateStore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	m, err := NewManager(ManagerConfig{RestDir: dir, ServerBackup: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.AddTemplate(newTestTemplate()))
+	assert.Error(t, m.AddTemplate(newTestTemplate()))
+	_, err = m.UpdateTemplate(RunnerTemplate{Name: "apache", Config: map[string]interface{}{"reader": nil}}, nil)
+	assert.Error(t, err)
+
+	tpl := newTestTemplate()
+	conf, err := tpl.Render("r1", map[string]string{"log_path": "/a"})
+	assert.NoError(t, err)
+	m.runnerConfig[filepath.Join(m.RestDir, "r1.conf")] = conf
+	assert.Equal(t, []TemplateInstance{{Runner: "r1", Params: map[string]string{"log_path": "/a"}}}, m.TemplateInstances("nginx"))
+	assert.Error(t, m.DeleteTemplate("nginx"))
+	assert.Error(t, m.InstantiateTemplate("nginx", "r1", map[string]string{"log_path": "/b"}))
+
+	// 重新加载后模板仍然存在
+	store, err := newTemplateStore(filepath.Join(m.RestDir, templateDirName))
+	assert.NoError(t, err)
+	got, ok := store.get("nginx")
+	assert.True(t, ok)
+	assert.Equal(t, "{{log_path}}", got.Config["reader"].(map[string]interface{})["log_path"])
+
+	delete(m.runnerConfig, filepath.Join(m.RestDir, "r1.conf"))
+	assert.NoError(t, m.DeleteTemplate("nginx"))
+	assert.Len(t, m.templates.list(), 0)
+}
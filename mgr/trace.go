@@ -0,0 +1,145 @@
+package mgr
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultTraceDuration = 600 // 单位秒
+	MaxTraceDuration     = 3600
+
+	traceSampleSize = 1024
+)
+
+// Traceable 的 runner 可以临时打开读取和发送的详细日志, 到期后自动关闭, 避免忘记关闭导致日志过多
+type Traceable interface {
+	// SetTrace 打开 duration 时长的跟踪, duration 不大于 0 时关闭
+	SetTrace(duration time.Duration)
+	// TraceUntil 返回跟踪结束的时间, 没有打开时返回零值
+	TraceUntil() time.Time
+}
+
+// TraceInfo 是 runner 的跟踪状态
+type TraceInfo struct {
+	Enable bool       `json:"enable"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+func (r *LogExportRunner) SetTrace(duration time.Duration) {
+	if duration <= 0 {
+		r.traceUntil.Store(time.Time{})
+		log.Infof("Runner[%v] trace is disabled", r.Name())
+		return
+	}
+	until := time.Now().Add(duration)
+	r.traceUntil.Store(until)
+	log.Infof("Runner[%v] trace is enabled until %v", r.Name(), until.Format(time.RFC3339))
+}
+
+func (r *LogExportRunner) TraceUntil() time.Time {
+	until, _ := r.traceUntil.Load().(time.Time)
+	if time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+func (r *LogExportRunner) tracing() bool {
+	return !r.TraceUntil().IsZero()
+}
+
+func traceSample(datas []Data) string {
+	if len(datas) <= 0 {
+		return ""
+	}
+	sample := fmt.Sprintf("%v", datas[0])
+	if len(sample) > traceSampleSize {
+		sample = sample[:traceSampleSize] + "..."
+	}
+	return sample
+}
+
+// traceRead 跟踪每个批次读取的数据, 使用 info 级别, 无需另外修改日志级别
+func (r *LogExportRunner) traceRead(datas []Data, batchSize int64, cost time.Duration) {
+	if !r.tracing() {
+		return
+	}
+	log.Infof("Runner[%v] trace: read %v datas (%v bytes) from %v in %v, first data: %v",
+		r.Name(), len(datas), batchSize, r.reader.Name(), cost, traceSample(datas))
+}
+
+func (r *LogExportRunner) traceSend(senderName string, datas []Data, cnt int, err error, cost time.Duration) {
+	if !r.tracing() {
+		return
+	}
+	if err != nil {
+		log.Infof("Runner[%v] trace: sender %v send %v datas failed for %v times in %v, error: %v", r.Name(), senderName, len(datas), cnt, cost, err)
+		return
+	}
+	log.Infof("Runner[%v] trace: sender %v sent %v datas in %v", r.Name(), senderName, len(datas), cost)
+}
+
+// TraceRunner 打开或关闭 runner 的跟踪
+func (m *Manager) TraceRunner(name string, duration time.Duration) (TraceInfo, error) {
+	r, ok := m.getRunnerByName(name)
+	if !ok {
+		return TraceInfo{}, fmt.Errorf("runner %v is not found or not running", name)
+	}
+	tr, ok := r.(Traceable)
+	if !ok {
+		return TraceInfo{}, fmt.Errorf("runner %v does not support trace", name)
+	}
+	tr.SetTrace(duration)
+	until := tr.TraceUntil()
+	if until.IsZero() {
+		return TraceInfo{}, nil
+	}
+	return TraceInfo{Enable: true, Until: &until}, nil
+}
+
+// POST /logkit/configs/<name>/trace?duration=<seconds>
+// 打开 runner 的跟踪, 每个批次读取和发送的情况都会以 info 级别记录到日志中
+func (rs *RestService) PostConfigTrace() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		duration := DefaultTraceDuration
+		if v := c.QueryParam("duration"); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil || i <= 0 || i > MaxTraceDuration {
+				return RespError(c, http.StatusBadRequest, ErrRunnerTrace, fmt.Sprintf("duration should be an integer between 1 and %v", MaxTraceDuration))
+			}
+			duration = i
+		}
+		if _, ok := rs.mgr.getRunnerByName(name); !ok {
+			return RespError(c, http.StatusNotFound, ErrRunnerTrace, "runner "+name+" is not found or not running")
+		}
+		info, err := rs.mgr.TraceRunner(name, time.Duration(duration)*time.Second)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRunnerTrace, err.Error())
+		}
+		return RespSuccess(c, info)
+	}
+}
+
+// DELETE /logkit/configs/<name>/trace
+func (rs *RestService) DeleteConfigTrace() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if _, ok := rs.mgr.getRunnerByName(name); !ok {
+			return RespError(c, http.StatusNotFound, ErrRunnerTrace, "runner "+name+" is not found or not running")
+		}
+		info, err := rs.mgr.TraceRunner(name, 0)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrRunnerTrace, err.Error())
+		}
+		return RespSuccess(c, info)
+	}
+}
@@ -0,0 +1,72 @@
+package mgr
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestRunnerTrace(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	r := &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}}
+	assert.True(t, r.TraceUntil().IsZero())
+	r.traceSend("s1", []Data{{"a": 1}}, 1, nil, time.Second)
+	assert.NotContains(t, buf.String(), "trace:")
+
+	r.SetTrace(time.Minute)
+	assert.True(t, r.tracing())
+	r.traceSend("s1", []Data{{"a": 1}}, 1, nil, time.Second)
+	assert.Contains(t, buf.String(), "Runner[r1] trace: sender s1 sent 1 datas")
+
+	// 到期后自动关闭
+	r.SetTrace(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, r.tracing())
+	r.SetTrace(time.Minute)
+	r.SetTrace(0)
+	assert.False(t, r.tracing())
+
+	assert.Equal(t, "", traceSample(nil))
+	assert.Len(t, traceSample([]Data{{"a": string(make([]byte, 2*traceSampleSize))}}), traceSampleSize+3)
+}
+
+func TestPostConfigTrace(t *testing.T) {
+	m, err := NewManager(ManagerConfig{RestDir: "TestPostConfigTrace", ServerBackup: true})
+	assert.NoError(t, err)
+	defer os.RemoveAll("TestPostConfigTrace")
+	r := &LogExportRunner{RunnerInfo: RunnerInfo{RunnerName: "r1"}}
+	m.runners["r1.conf"] = r
+	rs := &RestService{mgr: m}
+	router := echo.New()
+	router.POST(PREFIX+"/configs/:name/trace", rs.PostConfigTrace())
+	router.DELETE(PREFIX+"/configs/:name/trace", rs.DeleteConfigTrace())
+
+	for path, code := range map[string]int{
+		"/configs/r2/trace":             http.StatusNotFound,
+		"/configs/r1/trace?duration=0":  http.StatusBadRequest,
+		"/configs/r1/trace?duration=60": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, PREFIX+path, nil))
+		assert.Equal(t, code, rec.Code, path)
+	}
+	assert.True(t, r.tracing())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, PREFIX+"/configs/r1/trace", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"enable":false`)
+	assert.False(t, r.tracing())
+}
@@ -0,0 +1,331 @@
+package mgr
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/qiniu/log"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	defaultUpgradeDownloadTimeout = 10 * time.Minute
+	upgradeBackupSuffix           = ".bak"
+)
+
+// 升级的状态
+const (
+	UpgradeIdle        = "idle"
+	UpgradeDownloading = "downloading"
+	UpgradeRestarting  = "restarting"
+	UpgradeFailed      = "failed"
+)
+
+// UpgradeConfig 配置 logkit 的自升级
+type UpgradeConfig struct {
+	Disable bool `json:"disable"`
+	// PublicKey 为 base64 编码的 PKIX(DER) 格式的 ECDSA 公钥, 配置后升级请求必须带有该公钥可以验证的签名
+	PublicKey string `json:"public_key"`
+}
+
+// UpgradeReq 描述要升级到的 logkit 二进制文件
+type UpgradeReq struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`    // 二进制文件的 SHA256, hex 编码
+	Sign    string `json:"signature"` // 对二进制文件 SHA256 摘要(32字节)的 ASN.1 格式的 ECDSA 签名, base64 编码
+}
+
+// UpgradeStatus 是最近一次升级的状态, 升级成功后新进程从 idle 开始
+type UpgradeStatus struct {
+	State   string    `json:"state"`
+	Version string    `json:"version,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type upgrader struct {
+	UpgradeConfig
+	publicKey *ecdsa.PublicKey
+
+	mutex  sync.Mutex
+	status UpgradeStatus
+	client *http.Client
+	// executable 返回当前运行的二进制文件路径, 测试时替换
+	executable func() (string, error)
+	// restart 停止 logkit 并用新的二进制文件启动, 测试时替换
+	restart func(exe string)
+}
+
+func newUpgrader(c UpgradeConfig) (*upgrader, error) {
+	u := &upgrader{
+		UpgradeConfig: c,
+		status:        UpgradeStatus{State: UpgradeIdle},
+		client:        &http.Client{Timeout: defaultUpgradeDownloadTimeout},
+		executable:    os.Executable,
+	}
+	if c.PublicKey != "" {
+		der, err := base64.StdEncoding.DecodeString(c.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("upgrade public_key should be base64 encoded: %v", err)
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse upgrade public_key error: %v", err)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("upgrade public_key should be an ECDSA public key, got %T", key)
+		}
+		u.publicKey = ecKey
+	}
+	return u, nil
+}
+
+func (u *upgrader) getStatus() UpgradeStatus {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.status
+}
+
+func (u *upgrader) setStatus(state, version string, err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.status = UpgradeStatus{State: state, Version: version, Time: time.Now()}
+	if err != nil {
+		u.status.Error = err.Error()
+	}
+}
+
+func (u *upgrader) check(req UpgradeReq, curVersion string) error {
+	if u.Disable {
+		return errors.New("upgrade is disabled")
+	}
+	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		return fmt.Errorf("url %q should be http or https", req.URL)
+	}
+	if req.Version != "" && req.Version == curVersion {
+		return fmt.Errorf("logkit is already running version %v", curVersion)
+	}
+	if sum, err := hex.DecodeString(req.SHA256); err != nil || len(sum) != sha256.Size {
+		return errors.New("sha256 should be a hex encoded SHA256 checksum")
+	}
+	if u.publicKey != nil && req.Sign == "" {
+		return errors.New("signature is required")
+	}
+	return nil
+}
+
+// verify 校验下载文件的 SHA256 和签名
+func (u *upgrader) verify(req UpgradeReq, h hash.Hash) error {
+	sum := h.Sum(nil)
+	if hex.EncodeToString(sum) != strings.ToLower(req.SHA256) {
+		return fmt.Errorf("sha256 mismatch, expect %v but got %x", req.SHA256, sum)
+	}
+	if u.publicKey == nil {
+		return nil
+	}
+	sign, err := base64.StdEncoding.DecodeString(req.Sign)
+	if err != nil {
+		return fmt.Errorf("decode signature error: %v", err)
+	}
+	// 与 openssl dgst -sha256 -sign 生成的签名格式相同
+	var esig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sign, &esig); err != nil || len(rest) != 0 || esig.R == nil || esig.S == nil {
+		return errors.New("signature should be an ASN.1 encoded ECDSA signature")
+	}
+	if !ecdsa.Verify(u.publicKey, sum, esig.R, esig.S) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// download 下载新的二进制文件到当前二进制文件所在的目录并校验, 返回临时文件的路径
+func (u *upgrader) download(req UpgradeReq, dir string) (string, error) {
+	resp, err := u.client.Get(req.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %v returns status %v", req.URL, resp.Status)
+	}
+	file, err := ioutil.TempFile(dir, "logkit_upgrade_")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, h), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = u.verify(req, h)
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0755)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// replace 用新的二进制文件替换当前的二进制文件, 旧文件备份为 .bak
+func replaceExecutable(exe, newPath string) error {
+	backup := exe + upgradeBackupSuffix
+	os.Remove(backup)
+	if err := os.Rename(exe, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		if rerr := os.Rename(backup, exe); rerr != nil {
+			log.Errorf("restore %v from %v error %v", exe, backup, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Upgrade 下载、校验并替换二进制文件, 成功后异步地停止所有 runner 并启动新版本
+func (u *upgrader) Upgrade(req UpgradeReq) error {
+	u.mutex.Lock()
+	if u.status.State == UpgradeDownloading || u.status.State == UpgradeRestarting {
+		u.mutex.Unlock()
+		return errors.New("another upgrade is in progress")
+	}
+	u.status = UpgradeStatus{State: UpgradeDownloading, Version: req.Version, Time: time.Now()}
+	u.mutex.Unlock()
+
+	err := u.upgrade(req)
+	if err != nil {
+		log.Errorf("upgrade to %v error %v", req.Version, err)
+		u.setStatus(UpgradeFailed, req.Version, err)
+		return err
+	}
+	return nil
+}
+
+func (u *upgrader) upgrade(req UpgradeReq) error {
+	exe, err := u.executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	log.Infof("upgrade: downloading %v from %v", req.Version, req.URL)
+	newPath, err := u.download(req, filepath.Dir(exe))
+	if err != nil {
+		return err
+	}
+	if err = replaceExecutable(exe, newPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	log.Infof("upgrade: %v is replaced by %v, restarting", exe, req.Version)
+	u.setStatus(UpgradeRestarting, req.Version, nil)
+	// 先返回响应, 再停止服务
+	go u.restart(exe)
+	return nil
+}
+
+// restartSelf 用 exe 替换当前进程, windows 上不支持 exec, 启动新进程后退出
+func restartSelf(exe string) error {
+	if runtime.GOOS == "windows" {
+		cmd := exec.Command(exe, os.Args[1:]...)
+		cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// restartForUpgrade 与收到退出信号时一样优雅地停止 logkit, 然后启动新版本
+func (rs *RestService) restartForUpgrade(exe string) {
+	time.Sleep(time.Second)
+	rs.Stop()
+	rs.mgr.Stop()
+	if err := restartSelf(exe); err != nil {
+		// 所有 runner 已经停止, 退出后由进程管理工具用新的二进制文件拉起
+		log.Fatalf("upgrade: exec %v error %v", exe, err)
+	}
+}
+
+// GET /logkit/upgrade
+func (rs *RestService) GetUpgrade() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return RespSuccess(c, rs.upgrade.getStatus())
+	}
+}
+
+// POST /logkit/upgrade
+// 下载并校验成功后返回, 之后 logkit 会优雅地停止并以新版本重新启动
+func (rs *RestService) PostUpgrade() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req UpgradeReq
+		if err := c.Bind(&req); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrUpgrade, err.Error())
+		}
+		if err := rs.upgrade.check(req, rs.mgr.Version); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrUpgrade, err.Error())
+		}
+		if err := rs.upgrade.Upgrade(req); err != nil {
+			return RespError(c, http.StatusInternalServerError, ErrUpgrade, err.Error())
+		}
+		return RespSuccess(c, rs.upgrade.getStatus())
+	}
+}
+
+// master API
+// POST /logkit/cluster/upgrade?tag=tagValue&url=urlValue&selector=k1=v1,k2=v2
+// 把升级请求转发给选中的 slave, slave 重启后随心跳上报新的版本号
+func (rs *RestService) PostClusterUpgrade() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		_, tag, url, reqBytes, err := rs.checkClusterRequest(c)
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterUpgrade, err.Error())
+		}
+		selector, err := ParseLabelSelector(c.Request().Form.Get(KeySelector))
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterUpgrade, err.Error())
+		}
+		rs.cluster.mutex.RLock()
+		slaves, err := getSelectedSlaves(rs.cluster.slaves, tag, url, selector)
+		rs.cluster.mutex.RUnlock()
+		if err != nil {
+			return RespError(c, http.StatusBadRequest, ErrClusterUpgrade, err.Error())
+		}
+		urlPattern := "%v" + PREFIX + "/upgrade"
+		if err := executeToClusters(slaves, urlPattern, http.MethodPost, "upgrade", reqBytes); err != nil {
+			return RespError(c, http.StatusServiceUnavailable, ErrClusterUpgrade, err.Error())
+		}
+		return RespSuccess(c, nil)
+	}
+}
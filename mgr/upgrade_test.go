@@ -0,0 +1,137 @@
+package mgr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func signUpgrade(t *testing.T, priv *ecdsa.PrivateKey, digest []byte) string {
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+	assert.NoError(t, err)
+	sign, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(sign)
+}
+
+func TestUpgrade(t *testing.T) {
+	dir := "TestUpgrade"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "logkit")
+	assert.NoError(t, ioutil.WriteFile(exe, []byte("old"), 0755))
+
+	binary := []byte("new")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	assert.NoError(t, err)
+	_, err = newUpgrader(UpgradeConfig{PublicKey: "abc"})
+	assert.Error(t, err)
+	u, err := newUpgrader(UpgradeConfig{PublicKey: base64.StdEncoding.EncodeToString(pub)})
+	assert.NoError(t, err)
+	u.executable = func() (string, error) { return exe, nil }
+	restarted := make(chan string, 1)
+	u.restart = func(exe string) { restarted <- exe }
+
+	sum := sha256.Sum256(binary)
+	req := UpgradeReq{
+		Version: "v1.5.2",
+		URL:     server.URL,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Sign:    signUpgrade(t, priv, sum[:]),
+	}
+
+	for _, bad := range []UpgradeReq{
+		{Version: "v1.5.2", URL: "ftp://127.0.0.1", SHA256: req.SHA256, Sign: req.Sign},
+		{Version: "v1.5.1", URL: server.URL, SHA256: req.SHA256, Sign: req.Sign},
+		{Version: "v1.5.2", URL: server.URL, SHA256: "abc", Sign: req.Sign},
+		{Version: "v1.5.2", URL: server.URL, SHA256: req.SHA256},
+	} {
+		assert.Error(t, u.check(bad, "v1.5.1"), "%+v", bad)
+	}
+	assert.NoError(t, u.check(req, "v1.5.1"))
+
+	// 签名不对时不会替换二进制文件
+	badSign := req
+	badSign.Sign = signUpgrade(t, priv, []byte("other"))
+	assert.Error(t, u.Upgrade(badSign))
+	assert.Equal(t, UpgradeFailed, u.getStatus().State)
+	assert.Contains(t, u.getStatus().Error, "signature")
+	badSum := req
+	badSum.SHA256 = strings.Repeat("0", 64)
+	assert.Error(t, u.Upgrade(badSum))
+	content, err := ioutil.ReadFile(exe)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	assert.NoError(t, u.Upgrade(req))
+	assert.Equal(t, exe, <-restarted)
+	assert.Equal(t, UpgradeRestarting, u.getStatus().State)
+	content, err = ioutil.ReadFile(exe)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	content, err = ioutil.ReadFile(exe + upgradeBackupSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+
+	// 重启之前不能再次升级
+	assert.Error(t, u.Upgrade(req))
+
+	u, err = newUpgrader(UpgradeConfig{Disable: true})
+	assert.NoError(t, err)
+	assert.Error(t, u.check(req, "v1.5.1"))
+}
+
+func TestPostUpgrade(t *testing.T) {
+	u, err := newUpgrader(UpgradeConfig{})
+	assert.NoError(t, err)
+	rs := &RestService{mgr: &Manager{Version: "v1.5.1"}, upgrade: u}
+	router := echo.New()
+	router.GET(PREFIX+"/upgrade", rs.GetUpgrade())
+	router.POST(PREFIX+"/upgrade", rs.PostUpgrade())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PREFIX+"/upgrade", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"state":"idle"`)
+
+	for body, code := range map[string]int{
+		`{"version":`: http.StatusBadRequest,
+		`{"version":"v1.5.2","url":"http://127.0.0.1:1/logkit","sha256":"abc"}`:                                                              http.StatusBadRequest,
+		`{"version":"v1.5.2","url":"http://127.0.0.1:1/logkit","sha256":"0000000000000000000000000000000000000000000000000000000000000000"}`: http.StatusInternalServerError,
+	} {
+		req := httptest.NewRequest(http.MethodPost, PREFIX+"/upgrade", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code, body)
+	}
+	assert.Equal(t, UpgradeFailed, u.getStatus().State)
+}
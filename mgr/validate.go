@@ -0,0 +1,392 @@
+package mgr
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/router"
+	"github.com/qiniu/logkit/sender"
+	"github.com/qiniu/logkit/transforms"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// ValidationIssue 的级别
+const (
+	ValidationError   = "error"
+	ValidationWarning = "warning"
+)
+
+// ValidationIssue 的类型
+const (
+	IssueRequired     = "required"      // 缺少必填项
+	IssueUnknownType  = "unknown_type"  // reader、parser、sender 或 transformer 的类型不存在
+	IssueUnknownKey   = "unknown_key"   // 不认识的配置项, 通常是拼写错误
+	IssueInvalidValue = "invalid_value" // 配置项的值不合法
+	IssueIncompatible = "incompatible"  // 多个配置项之间不兼容
+	IssueParseFailed  = "parse_failed"  // 样例数据解析失败
+)
+
+// ValidationIssue 是配置中的一个问题, Path 为出问题的配置项在 runner 配置中的 JSON 路径,
+// 如 reader.log_path, senders[0].sender_type, transforms[1].key
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Level   string `json:"level"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ValidationResult 是 runner 配置的校验结果, 有 error 时配置无法运行, warning 只是提示
+type ValidationResult struct {
+	Valid    bool              `json:"valid"`
+	Errors   []ValidationIssue `json:"errors"`
+	Warnings []ValidationIssue `json:"warnings"`
+}
+
+func (v *ValidationResult) addError(path, typ, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, ValidationIssue{Path: path, Level: ValidationError, Type: typ, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *ValidationResult) addWarning(path, typ, format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, ValidationIssue{Path: path, Level: ValidationWarning, Type: typ, Message: fmt.Sprintf(format, args...)})
+}
+
+// 所有类型都可以使用的配置项, 不会出现在 ModeKeyOptions 中
+var (
+	commonReaderKeys = []string{
+		reader.KeyMode, reader.KeyMetaPath, reader.KeyFileDone, reader.KeyDataSourceTag, reader.KeyEncoding,
+		reader.KeyHeadPattern, reader.KeyContinuePattern, reader.KeyContinueMatch, reader.KeyTagFile, reader.KeyReadIOLimit, reader.KeyBufSize, reader.KeyErrDirectReturn, KeyRunnerName,
+	}
+	commonParserKeys = []string{
+		parser.KeyParserName, parser.KeyParserType, parser.KeyLabels, parser.KeyDisableRecordErrData, KeyRunnerName,
+		parser.KeySchema, parser.KeySchemaOnError, parser.KeySchemaErrorLabel,
+	}
+	commonSenderKeys = []string{
+		sender.KeySenderType, sender.KeyName, sender.KeyFaultTolerant, sender.KeyLogkitSendTime, sender.KeyIsMetrics,
+		sender.KeyFtSyncEvery, sender.KeyFtSaveLogPath, sender.KeyFtWriteLimit, sender.KeyFtStrategy, sender.KeyFtProcs,
+		sender.KeyFtMemoryChannel, sender.KeyFtMemoryChannelSize, sender.KeyFtLongDataDiscard, sender.InnerUserAgent, KeyRunnerName,
+	}
+	commonTransformKeys = []string{transforms.KeyType, "stage"}
+)
+
+// reader 直接读出 Data, 不经过 parser
+var dataReaderModes = map[string]bool{
+	reader.ModeMySQL:       true,
+	reader.ModeMSSQL:       true,
+	reader.ModePostgreSQL:  true,
+	reader.ModeLoopback:    true,
+	reader.ModeK8s:         true,
+	reader.ModeJournald:    true,
+	reader.ModeWinEventLog: true,
+	reader.ModeDocker:      true,
+	reader.ModeSyslog:      true,
+}
+
+// reader 读出的是 json 字符串
+var jsonReaderModes = map[string]bool{
+	reader.ModeElastic: true,
+	reader.ModeMongo:   true,
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkOptions 根据 ModeKeyOptions 检查必填项、可选值以及不认识的配置项
+func (v *ValidationResult) checkOptions(prefix string, c map[string]interface{}, options []Option, common []string) {
+	known := make(map[string]bool, len(options)+len(common))
+	for _, k := range common {
+		known[k] = true
+	}
+	for _, opt := range options {
+		known[opt.KeyName] = true
+		val, ok := c[opt.KeyName]
+		str := fmt.Sprint(val)
+		if !ok || val == nil || str == "" {
+			if opt.Required && opt.Default == "" {
+				v.addError(prefix+"."+opt.KeyName, IssueRequired, "%v is required", opt.KeyName)
+			}
+			continue
+		}
+		if opt.ChooseOnly && len(opt.ChooseOptions) > 0 {
+			found := false
+			for _, choose := range opt.ChooseOptions {
+				if fmt.Sprint(choose) == str {
+					found = true
+					break
+				}
+			}
+			if !found {
+				v.addError(prefix+"."+opt.KeyName, IssueInvalidValue, "%v should be one of %v, but got %v", opt.KeyName, opt.ChooseOptions, str)
+			}
+		}
+	}
+	for _, k := range sortedKeys(c) {
+		if !known[k] {
+			v.addWarning(prefix+"."+k, IssueUnknownKey, "unknown option %v", k)
+		}
+	}
+}
+
+func mapConfToMap(c conf.MapConf) map[string]interface{} {
+	m := make(map[string]interface{}, len(c))
+	for k, v := range c {
+		m[k] = v
+	}
+	return m
+}
+
+// ValidateRunnerConfig 检查 runner 配置, 返回每个出错配置项的路径; 不会创建 reader 和 sender,
+// 因此不会产生连接外部服务、创建目录等副作用, 这类错误只有在添加 runner 时才能发现
+func ValidateRunnerConfig(rc RunnerConfig) ValidationResult {
+	v := ValidationResult{Errors: []ValidationIssue{}, Warnings: []ValidationIssue{}}
+	if rc.RunnerName == "" {
+		v.addError("name", IssueRequired, "runner name is required")
+	}
+	for key, val := range map[string]int{
+		"batch_len":        rc.MaxBatchLen,
+		"batch_size":       rc.MaxBatchSize,
+		"batch_interval":   rc.MaxBatchInterval,
+		"collect_interval": rc.CollectInterval,
+	} {
+		if val < 0 {
+			v.addError(key, IssueInvalidValue, "%v should not be negative", key)
+		}
+	}
+	isMetric := len(rc.MetricConfig) > 0
+
+	var mode string
+	if !isMetric {
+		mode = v.validateReader(rc.ReaderConfig)
+		v.validateParser(rc.ParserConf, mode)
+		v.validateParserChain(rc.ParserChain)
+	}
+	for i, t := range rc.Transforms {
+		v.validateTransform(i, t)
+	}
+	loopbackName, _ := rc.ReaderConfig.GetStringOr(reader.KeyLoopbackName, "")
+	if mode != reader.ModeLoopback {
+		loopbackName = ""
+	}
+	v.validateSenders(rc.SendersConfig, loopbackName)
+	v.validateRouter(rc.Router, len(rc.SendersConfig))
+
+	sort.SliceStable(v.Errors, func(i, j int) bool { return v.Errors[i].Path < v.Errors[j].Path })
+	v.Valid = len(v.Errors) == 0
+	return v
+}
+
+func (v *ValidationResult) validateReader(rc conf.MapConf) string {
+	if rc == nil {
+		v.addError("reader", IssueRequired, "reader config is required")
+		return ""
+	}
+	mode, _ := rc.GetStringOr(reader.KeyMode, reader.ModeDir)
+	options, ok := reader.ModeKeyOptions[mode]
+	if !ok {
+		v.addError("reader."+reader.KeyMode, IssueUnknownType, "reader mode %v is not supported", mode)
+		return mode
+	}
+	v.checkOptions("reader", mapConfToMap(rc), options, commonReaderKeys)
+	for _, key := range []string{reader.KeyHeadPattern, reader.KeyContinuePattern} {
+		if pattern, _ := rc.GetStringOr(key, ""); pattern != "" && dataReaderModes[mode] {
+			v.addWarning("reader."+key, IssueIncompatible, "%v is not used by reader mode %v", key, mode)
+		}
+	}
+	return mode
+}
+
+func (v *ValidationResult) validateParser(pc conf.MapConf, mode string) {
+	if pc == nil {
+		v.addError("parser", IssueRequired, "parser config is required")
+		return
+	}
+	typ, err := pc.GetString(parser.KeyParserType)
+	if err != nil {
+		v.addError("parser."+parser.KeyParserType, IssueRequired, "parser type is required")
+		return
+	}
+	before := len(v.Errors)
+	options, known := parser.ModeKeyOptions[typ]
+	if known {
+		v.checkOptions("parser", mapConfToMap(pc), options, commonParserKeys)
+	}
+	switch {
+	case dataReaderModes[mode]:
+		v.addWarning("parser", IssueIncompatible, "parser is not used by reader mode %v, datas are read directly", mode)
+	case jsonReaderModes[mode] && typ != parser.TypeJSON:
+		v.addWarning("parser."+parser.KeyParserType, IssueIncompatible, "reader mode %v reads json strings, parser type %v is recommended", mode, parser.TypeJSON)
+	case typ == parser.TypeInnerSQL || typ == parser.TypeInnerMySQL:
+		v.addError("parser."+parser.KeyParserType, IssueIncompatible, "parser type %v is only used internally by sql readers", typ)
+	}
+	// 已经有错误时不再尝试创建, 避免同一个问题重复报错
+	if len(v.Errors) > before {
+		return
+	}
+	cp := make(conf.MapConf, len(pc))
+	for k, val := range pc {
+		cp[k] = val
+	}
+	if _, err = parser.NewRegistry().NewLogParser(cp); err != nil {
+		if !known {
+			v.addError("parser."+parser.KeyParserType, IssueUnknownType, "%v", err)
+			return
+		}
+		v.addError("parser", IssueInvalidValue, "%v", err)
+	}
+}
+
+func (v *ValidationResult) validateParserChain(chain []parser.ChainConfig) {
+	for i, c := range chain {
+		prefix := "parser_chain[" + strconv.Itoa(i) + "]"
+		if c.Field == "" {
+			v.addError(prefix+".field", IssueRequired, "field is required")
+		}
+		if c.Parser == nil {
+			v.addError(prefix+".parser", IssueRequired, "parser config is required")
+			continue
+		}
+		cp := make(conf.MapConf, len(c.Parser))
+		for k, val := range c.Parser {
+			cp[k] = val
+		}
+		if _, err := parser.NewRegistry().NewLogParser(cp); err != nil {
+			v.addError(prefix+".parser", IssueInvalidValue, "%v", err)
+		}
+	}
+}
+
+func (v *ValidationResult) validateTransform(i int, tc map[string]interface{}) {
+	prefix := "transforms[" + strconv.Itoa(i) + "]"
+	typ, _ := tc[transforms.KeyType].(string)
+	if typ == "" {
+		v.addError(prefix+"."+transforms.KeyType, IssueRequired, "transformer type is required")
+		return
+	}
+	create, ok := transforms.Transformers[typ]
+	if !ok {
+		v.addError(prefix+"."+transforms.KeyType, IssueUnknownType, "transformer type %v is not supported", typ)
+		return
+	}
+	before := len(v.Errors)
+	v.checkOptions(prefix, tc, create().ConfigOptions(), commonTransformKeys)
+	if len(v.Errors) > before {
+		return
+	}
+	cp := make(map[string]interface{}, len(tc))
+	for k, val := range tc {
+		cp[k] = val
+	}
+	if _, err := getTransformer(cp, create); err != nil {
+		v.addError(prefix, IssueInvalidValue, "%v", err)
+	}
+}
+
+func (v *ValidationResult) validateSenders(scs []conf.MapConf, readerLoopbackName string) {
+	if len(scs) == 0 {
+		v.addError("senders", IssueRequired, "at least one sender is required")
+		return
+	}
+	for i, sc := range scs {
+		prefix := "senders[" + strconv.Itoa(i) + "]"
+		typ, err := sc.GetString(sender.KeySenderType)
+		if err != nil {
+			v.addError(prefix+"."+sender.KeySenderType, IssueRequired, "sender type is required")
+			continue
+		}
+		options, ok := sender.ModeKeyOptions[typ]
+		if !ok {
+			v.addError(prefix+"."+sender.KeySenderType, IssueUnknownType, "sender type %v is not supported", typ)
+			continue
+		}
+		v.checkOptions(prefix, mapConfToMap(sc), options, commonSenderKeys)
+		if size, _ := sc.GetStringOr(sender.KeyFtMemoryChannelSize, ""); size != "" {
+			if memory, _ := sc.GetBoolOr(sender.KeyFtMemoryChannel, false); !memory {
+				v.addWarning(prefix+"."+sender.KeyFtMemoryChannelSize, IssueIncompatible, "%v is not used unless %v is true",
+					sender.KeyFtMemoryChannelSize, sender.KeyFtMemoryChannel)
+			}
+		}
+		if typ == sender.TypeLoopback && readerLoopbackName != "" {
+			if name, _ := sc.GetStringOr(sender.KeyLoopbackName, ""); name == readerLoopbackName {
+				v.addError(prefix+"."+sender.KeyLoopbackName, IssueIncompatible, "runner should not send datas to its own loopback reader %v", name)
+			}
+		}
+	}
+}
+
+func (v *ValidationResult) validateRouter(rc router.RouterConfig, senderCnt int) {
+	if rc.KeyName == "" {
+		return
+	}
+	if rc.DefaultIndex < 0 || rc.DefaultIndex >= senderCnt {
+		v.addError("router.router_default_sender", IssueInvalidValue, "default sender index %v is out of range, there are %v senders", rc.DefaultIndex, senderCnt)
+	}
+	keys := make([]string, 0, len(rc.Routes))
+	for k := range rc.Routes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if idx := rc.Routes[k]; idx < 0 || idx >= senderCnt {
+			v.addError("router.router_routes."+k, IssueInvalidValue, "sender index %v is out of range, there are %v senders", idx, senderCnt)
+		}
+	}
+}
+
+// POST /logkit/runner/check
+// 请求体为 runner 配置, 返回每个问题配置项的路径, 有错误时返回 400
+// validateSampleLines 在配置没有错误时用 parser 解析样例数据，解析失败的行作为错误返回
+func (v *ValidationResult) validateSampleLines(rc RunnerConfig, lines []string) {
+	if len(lines) == 0 || len(rc.MetricConfig) > 0 || len(v.Errors) > 0 {
+		return
+	}
+	ret, err := RunParserTest(PostParserTestReq{Parser: rc.ParserConf, ParserChain: rc.ParserChain, Lines: lines})
+	if err != nil {
+		v.addError("parser", IssueInvalidValue, "%v", err)
+		return
+	}
+	for _, r := range ret.Results {
+		if r.Error != "" {
+			v.addError("sample_lines["+strconv.Itoa(r.Line)+"]", IssueParseFailed, "%v", r.Error)
+		}
+	}
+	v.Valid = len(v.Errors) == 0
+}
+
+// runnerCheckReq 是校验 runner 配置的请求，SampleLines 不为空时还会用 parser 解析这些样例数据
+type runnerCheckReq struct {
+	RunnerConfig
+	SampleLines []string `json:"sample_lines,omitempty"`
+}
+
+func (rs *RestService) PostRunnerCheck() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req runnerCheckReq
+		if err := c.Bind(&req); err != nil {
+			return RespError(c, http.StatusBadRequest, ErrConfigCheck, err.Error())
+		}
+		rc := req.RunnerConfig
+		rc.ParserConf = parser.ConvertWebParserConfig(rc.ParserConf)
+		result := ValidateRunnerConfig(rc)
+		result.validateSampleLines(rc, req.SampleLines)
+		if !result.Valid {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"code":    ErrConfigCheck,
+				"message": "runner config is invalid",
+				"data":    result,
+			})
+		}
+		return RespSuccess(c, result)
+	}
+}
@@ -0,0 +1,139 @@
+package mgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/router"
+)
+
+func issuePaths(issues []ValidationIssue) map[string]string {
+	paths := make(map[string]string, len(issues))
+	for _, issue := range issues {
+		paths[issue.Path] = issue.Type
+	}
+	return paths
+}
+
+func TestValidateRunnerConfig(t *testing.T) {
+	rc := RunnerConfig{
+		RunnerInfo: RunnerInfo{RunnerName: "r1"},
+		ReaderConfig: conf.MapConf{
+			"mode":    "elastic",
+			"es_host": "127.0.0.1:9200",
+			"es_type": "app",
+		},
+		ParserConf: conf.MapConf{"type": "raw"},
+		SendersConfig: []conf.MapConf{{
+			"sender_type":   "file",
+			"file_send_pth": "/tmp/data",
+		}},
+	}
+	res := ValidateRunnerConfig(rc)
+	assert.False(t, res.Valid)
+	assert.Equal(t, map[string]string{
+		"reader.es_index":           IssueRequired,
+		"senders[0].file_send_path": IssueRequired,
+	}, issuePaths(res.Errors))
+	assert.Equal(t, map[string]string{
+		"parser.type":              IssueIncompatible,
+		"senders[0].file_send_pth": IssueUnknownKey,
+	}, issuePaths(res.Warnings))
+
+	rc = RunnerConfig{
+		RunnerInfo: RunnerInfo{RunnerName: "r2", MaxBatchLen: -1},
+		ReaderConfig: conf.MapConf{
+			"mode":            "loopback",
+			"loopback_name":   "stage1",
+			"loopback_buffer": "file",
+		},
+		ParserConf: conf.MapConf{"type": "json"},
+		Transforms: []map[string]interface{}{{"type": "not_exist"}, {}},
+		SendersConfig: []conf.MapConf{
+			{"sender_type": "loopback", "loopback_name": "stage1"},
+			{"sender_type": "not_exist"},
+		},
+		Router: router.RouterConfig{
+			KeyName:      "a",
+			DefaultIndex: 0,
+			Routes:       map[string]int{"x": 1, "y": 2},
+		},
+	}
+	res = ValidateRunnerConfig(rc)
+	assert.False(t, res.Valid)
+	assert.Equal(t, map[string]string{
+		"batch_len":                IssueInvalidValue,
+		"reader.loopback_buffer":   IssueInvalidValue,
+		"transforms[0].type":       IssueUnknownType,
+		"transforms[1].type":       IssueRequired,
+		"senders[0].loopback_name": IssueIncompatible,
+		"senders[1].sender_type":   IssueUnknownType,
+		"router.router_routes.y":   IssueInvalidValue,
+	}, issuePaths(res.Errors))
+	assert.Equal(t, map[string]string{"parser": IssueIncompatible}, issuePaths(res.Warnings))
+
+	// parser 创建失败
+	rc = RunnerConfig{
+		RunnerInfo:    RunnerInfo{RunnerName: "r3"},
+		ReaderConfig:  conf.MapConf{"mode": "file", "log_path": "/tmp/a.log"},
+		ParserConf:    conf.MapConf{"type": "grok", "grok_patterns": "%{NOT_EXIST}"},
+		SendersConfig: []conf.MapConf{{"sender_type": "discard"}},
+	}
+	res = ValidateRunnerConfig(rc)
+	assert.False(t, res.Valid)
+	assert.Equal(t, map[string]string{"parser": IssueInvalidValue}, issuePaths(res.Errors))
+
+	rc.ParserConf = conf.MapConf{"type": "raw"}
+	res = ValidateRunnerConfig(rc)
+	assert.True(t, res.Valid, "%v", res.Errors)
+	assert.Len(t, res.Warnings, 0)
+
+	rc.ParserConf = conf.MapConf{"type": "json", "schema": "a long, b date", "schema_on_error": "label"}
+	res = ValidateRunnerConfig(rc)
+	assert.True(t, res.Valid, "%v", res.Errors)
+	assert.Len(t, res.Warnings, 0)
+	rc.ParserConf["schema"] = "a int"
+	res = ValidateRunnerConfig(rc)
+	assert.Equal(t, map[string]string{"parser": IssueInvalidValue}, issuePaths(res.Errors))
+	rc.ParserConf = conf.MapConf{"type": "raw"}
+
+	rc.ParserChain = []parser.ChainConfig{
+		{Field: "raw", Parser: conf.MapConf{"type": "json"}},
+		{Parser: conf.MapConf{"type": "not_exist"}},
+		{Field: "msg"},
+	}
+	res = ValidateRunnerConfig(rc)
+	assert.False(t, res.Valid)
+	assert.Equal(t, map[string]string{
+		"parser_chain[1].field":  IssueRequired,
+		"parser_chain[1].parser": IssueInvalidValue,
+		"parser_chain[2].parser": IssueRequired,
+	}, issuePaths(res.Errors))
+}
+
+func TestPostRunnerCheck(t *testing.T) {
+	rs := &RestService{}
+	router := echo.New()
+	router.POST(PREFIX+"/runner/check", rs.PostRunnerCheck())
+
+	for body, code := range map[string]int{
+		`{"name":"r1","reader":{"mode":"file","log_path":"/tmp/a.log"},"parser":{"type":"raw"},"senders":[{"sender_type":"discard"}]}`: http.StatusOK,
+		`{"name":"r1","reader":{"mode":"file"},"parser":{"type":"raw"},"senders":[{"sender_type":"discard"}]}`:                         http.StatusBadRequest,
+		`{"name":`: http.StatusBadRequest,
+		`{"name":"r1","reader":{"mode":"file","log_path":"/tmp/a.log"},"parser":{"type":"json"},"senders":[{"sender_type":"discard"}],"sample_lines":["{\"a\":1}"]}`: http.StatusOK,
+		`{"name":"r1","reader":{"mode":"file","log_path":"/tmp/a.log"},"parser":{"type":"json"},"senders":[{"sender_type":"discard"}],"sample_lines":["{\"a\":1}","x"]}`: http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, PREFIX+"/runner/check", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code, body)
+	}
+}
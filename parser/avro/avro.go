@@ -0,0 +1,183 @@
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// confluentMagicByte 是 Confluent 序列化格式的第一个字节，之后是 4 字节大端序的 schema id
+	confluentMagicByte  = 0
+	confluentHeaderSize = 5
+
+	registryTimeout = 10 * time.Second
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeAvro, NewParser)
+}
+
+// Parser 解析 avro 二进制编码的数据，数据是 Confluent 格式时从 Schema Registry 获取写入时使用的 schema，
+// 否则使用 avro_schema 中配置的 schema，解析结果必须是 record
+type Parser struct {
+	name                 string
+	registryURL          string
+	schema               *schema // avro_schema 配置的 schema，没有配置时为 nil
+	labels               []parser.Label
+	disableRecordErrData bool
+
+	client      *http.Client
+	schemasLock sync.Mutex
+	schemas     map[uint32]*schema // 从 Schema Registry 获取的 schema，按 id 缓存，同一个 id 的 schema 不会变化
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	registryURL, _ := c.GetStringOr(parser.KeyAvroSchemaRegistryURL, "")
+	schemaStr, _ := c.GetStringOr(parser.KeyAvroSchema, "")
+	if registryURL == "" && schemaStr == "" {
+		return nil, fmt.Errorf("one of %v and %v is required", parser.KeyAvroSchemaRegistryURL, parser.KeyAvroSchema)
+	}
+	var s *schema
+	if schemaStr != "" {
+		var err error
+		if s, err = parseSchema(schemaStr); err != nil {
+			return nil, fmt.Errorf("parse %v error %v", parser.KeyAvroSchema, err)
+		}
+	}
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		registryURL:          strings.TrimSuffix(registryURL, "/"),
+		schema:               s,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+		client:               &http.Client{Timeout: registryTimeout},
+		schemas:              make(map[uint32]*schema),
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeAvro
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse([]byte(line))
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = err
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			// schema 可能随数据变化，和 json 一样 label 不覆盖数据
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+func (p *Parser) parse(buf []byte) (Data, error) {
+	s := p.schema
+	if p.registryURL != "" && len(buf) >= confluentHeaderSize && buf[0] == confluentMagicByte {
+		var err error
+		if s, err = p.getSchema(binary.BigEndian.Uint32(buf[1:confluentHeaderSize])); err != nil {
+			return nil, err
+		}
+		buf = buf[confluentHeaderSize:]
+	}
+	if s == nil {
+		return nil, fmt.Errorf("avro data is not in confluent format and %v is not set", parser.KeyAvroSchema)
+	}
+	d := &decoder{buf: buf}
+	v, err := d.decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(buf) {
+		return nil, fmt.Errorf("%v bytes left after decoding avro data, schema mismatch", len(buf)-d.pos)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("avro data is %T, not a record", v)
+	}
+	return Data(m), nil
+}
+
+// getSchema 返回 id 对应的 schema，第一次使用时从 Schema Registry 获取，获取失败的不缓存，下次重试
+func (p *Parser) getSchema(id uint32) (*schema, error) {
+	p.schemasLock.Lock()
+	defer p.schemasLock.Unlock()
+	if s, ok := p.schemas[id]; ok {
+		return s, nil
+	}
+	s, err := p.fetchSchema(id)
+	if err != nil {
+		return nil, err
+	}
+	p.schemas[id] = s
+	return s, nil
+}
+
+func (p *Parser) fetchSchema(id uint32) (*schema, error) {
+	url := fmt.Sprintf("%s/schemas/ids/%d", p.registryURL, id)
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("get avro schema %v from schema registry error %v", id, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read avro schema %v from schema registry error %v", id, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get avro schema %v from schema registry error, status code %v, body %s", id, resp.StatusCode, body)
+	}
+	var ret struct {
+		Schema string `json:"schema"`
+	}
+	if err = json.Unmarshal(body, &ret); err != nil {
+		return nil, fmt.Errorf("unmarshal avro schema %v from schema registry error %v", id, err)
+	}
+	s, err := parseSchema(ret.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("parse avro schema %v error %v", id, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,149 @@
+package avro
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const testSchema = `{
+  "type": "record",
+  "name": "AccessLog",
+  "namespace": "logs",
+  "fields": [
+    {"name": "path", "type": "string"},
+    {"name": "status", "type": "int"},
+    {"name": "latency", "type": "double"},
+    {"name": "ratio", "type": "float"},
+    {"name": "cached", "type": "boolean"},
+    {"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["INFO", "ERROR"]}},
+    {"name": "client", "type": ["null", {"type": "record", "name": "Client", "fields": [{"name": "ip", "type": "string"}]}]},
+    {"name": "referer", "type": ["null", "string"]},
+    {"name": "sizes", "type": {"type": "array", "items": "long"}},
+    {"name": "headers", "type": {"type": "map", "values": "string"}},
+    {"name": "id", "type": {"type": "fixed", "name": "ID", "size": 2}},
+    {"name": "backup", "type": ["null", "Client"]}
+  ]
+}`
+
+func appendLong(buf []byte, v int64) []byte {
+	x := uint64(v<<1) ^ uint64(v>>63)
+	for x >= 0x80 {
+		buf = append(buf, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(buf, byte(x))
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendLong(buf, int64(len(s))), s...)
+}
+
+func testRecord(path string) []byte {
+	var b []byte
+	b = appendString(b, path)
+	b = appendLong(b, 200)
+	b = append(b, make([]byte, 8)...)
+	binary.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(0.25))
+	b = append(b, make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(b[len(b)-4:], math.Float32bits(0.5))
+	b = append(b, 1)
+	b = appendLong(b, 1)
+	b = appendString(appendLong(b, 1), "1.2.3.4")
+	b = appendLong(b, 0)
+	// 两个块，第二个块的个数为负数，带有块的字节数
+	b = appendLong(appendLong(b, 1), 10)
+	b = appendLong(appendLong(appendLong(b, -1), 1), 20)
+	b = appendLong(b, 0)
+	b = appendString(appendString(appendLong(b, 1), "host"), "a.com")
+	b = appendLong(b, 0)
+	b = append(b, 0xff, 0x00)
+	b = appendLong(b, 0)
+	return b
+}
+
+func expectedData(path string) Data {
+	return Data{
+		"path":    path,
+		"status":  int64(200),
+		"latency": 0.25,
+		"ratio":   0.5,
+		"cached":  true,
+		"level":   "ERROR",
+		"client":  map[string]interface{}{"ip": "1.2.3.4"},
+		"sizes":   []interface{}{int64(10), int64(20)},
+		"headers": map[string]interface{}{"host": "a.com"},
+		"id":      "/wA=",
+		"machine": "nb110",
+	}
+}
+
+func TestAvroParserWithRegistry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/schemas/ids/7":
+			w.Write([]byte(`{"schema":` + strconv.Quote(testSchema) + `}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName:            "avro",
+		parser.KeyAvroSchemaRegistryURL: server.URL + "/",
+		parser.KeyLabels:                "machine nb110",
+	})
+	assert.NoError(t, err)
+	framed := func(id uint32, payload []byte) string {
+		header := []byte{0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[1:], id)
+		return string(append(header, payload...))
+	}
+	datas, err := p.Parse([]string{framed(7, testRecord("/a")), framed(7, testRecord("/b")), framed(8, testRecord("/c")), "", "plain"})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{3}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		expectedData("/a"),
+		expectedData("/b"),
+		{KeyPandoraStash: framed(8, testRecord("/c"))},
+		{KeyPandoraStash: "plain"},
+	}, datas)
+	// id 7 的 schema 只获取一次
+	assert.Equal(t, 2, requests)
+}
+
+func TestAvroParserWithSchema(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyAvroSchema:           testSchema,
+		parser.KeyLabels:               "machine nb110",
+		parser.KeyDisableRecordErrData: "true",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{string(testRecord("/a")), string(append(testRecord("/b"), 0))})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, []int{1}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{expectedData("/a")}, datas)
+
+	_, err = NewParser(conf.MapConf{})
+	assert.Error(t, err)
+	_, err = NewParser(conf.MapConf{parser.KeyAvroSchema: `{"type":"record","name":"A","fields":[{"name":"b","type":"Unknown"}]}`})
+	assert.Error(t, err)
+}
@@ -0,0 +1,345 @@
+package avro
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// schema 是解析后的 avro schema，只保留解码需要的信息，logicalType 被忽略，按照底层类型输出
+type schema struct {
+	typ      string
+	name     string    // record、enum、fixed 的全名
+	fields   []field   // record
+	symbols  []string  // enum
+	items    *schema   // array
+	values   *schema   // map
+	branches []*schema // union
+	size     int       // fixed
+}
+
+type field struct {
+	name   string
+	schema *schema
+}
+
+var primitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+var errTruncated = errors.New("avro data truncated")
+
+// parseSchema 解析 json 格式的 avro schema
+func parseSchema(s string) (*schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("avro schema is not valid json: %v", err)
+	}
+	return (&schemaParser{named: make(map[string]*schema)}).parse(v, "")
+}
+
+// schemaParser 记录已经定义的具名类型，用于解析之后以名称引用的类型，record 在解析字段之前注册，所以可以递归引用自己
+type schemaParser struct {
+	named map[string]*schema
+}
+
+func (p *schemaParser) parse(v interface{}, namespace string) (*schema, error) {
+	switch t := v.(type) {
+	case string:
+		if primitiveTypes[t] {
+			return &schema{typ: t}, nil
+		}
+		return p.lookup(t, namespace)
+	case []interface{}:
+		s := &schema{typ: "union"}
+		for _, b := range t {
+			bs, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, bs)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return p.parseComplex(t, namespace)
+	}
+	return nil, fmt.Errorf("invalid avro schema %v", v)
+}
+
+func (p *schemaParser) lookup(name, namespace string) (*schema, error) {
+	if namespace != "" && !strings.Contains(name, ".") {
+		if s, ok := p.named[namespace+"."+name]; ok {
+			return s, nil
+		}
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown avro type %v", name)
+}
+
+// define 计算具名类型的全名并注册，返回类型所在的 namespace
+func (p *schemaParser) define(s *schema, m map[string]interface{}, namespace string) (string, error) {
+	name, _ := m["name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("avro %v type must have a name", s.typ)
+	}
+	if ns, ok := m["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		namespace = name[:i]
+	} else if namespace != "" {
+		name = namespace + "." + name
+	}
+	s.name = name
+	p.named[name] = s
+	return namespace, nil
+}
+
+func (p *schemaParser) parseComplex(m map[string]interface{}, namespace string) (*schema, error) {
+	typ, ok := m["type"].(string)
+	if !ok {
+		// {"type": {...}} 或者 {"type": [...]} 的形式
+		return p.parse(m["type"], namespace)
+	}
+	s := &schema{typ: typ}
+	switch typ {
+	case "record", "error":
+		s.typ = "record"
+		ns, err := p.define(s, m, namespace)
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := m["fields"].([]interface{})
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field %v of avro record %v", f, s.name)
+			}
+			name, _ := fm["name"].(string)
+			fs, err := p.parse(fm["type"], ns)
+			if err != nil {
+				return nil, fmt.Errorf("parse field %v of avro record %v error %v", name, s.name, err)
+			}
+			s.fields = append(s.fields, field{name: name, schema: fs})
+		}
+	case "enum":
+		if _, err := p.define(s, m, namespace); err != nil {
+			return nil, err
+		}
+		symbols, _ := m["symbols"].([]interface{})
+		for _, sym := range symbols {
+			str, _ := sym.(string)
+			s.symbols = append(s.symbols, str)
+		}
+	case "fixed":
+		if _, err := p.define(s, m, namespace); err != nil {
+			return nil, err
+		}
+		size, _ := m["size"].(float64)
+		s.size = int(size)
+	case "array":
+		items, err := p.parse(m["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.items = items
+	case "map":
+		values, err := p.parse(m["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.values = values
+	default:
+		if !primitiveTypes[typ] {
+			return p.lookup(typ, namespace)
+		}
+	}
+	return s, nil
+}
+
+// decoder 按照 avro 的二进制编码读取数据
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) readLong() (int64, error) {
+	var x uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if d.pos >= len(d.buf) {
+			return 0, errTruncated
+		}
+		b := d.buf[d.pos]
+		d.pos++
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return int64(x>>1) ^ -int64(x&1), nil
+		}
+	}
+	return 0, errors.New("avro varint overflow")
+}
+
+func (d *decoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf)-d.pos {
+		return nil, errTruncated
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readBytes() ([]byte, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(len(d.buf)-d.pos) {
+		return nil, errTruncated
+	}
+	return d.readN(int(n))
+}
+
+// readBlockCount 读取 array 和 map 一个块中的元素个数，个数为负数时后面还有块的字节数
+func (d *decoder) readBlockCount() (int64, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n = -n
+		if _, err = d.readLong(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// decode 解码一个值，int 和 long 输出为 int64，float 和 double 输出为 float64，bytes 和 fixed 输出为 base64 字符串，
+// enum 输出为名称，union 直接输出选中分支的值
+func (d *decoder) decode(s *schema) (interface{}, error) {
+	switch s.typ {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := d.readN(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		return d.readLong()
+	case "float":
+		b, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		b, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "string":
+		b, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case "fixed":
+		b, err := d.readN(s.size)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "enum":
+		i, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.symbols)) {
+			return nil, fmt.Errorf("avro enum %v index %v out of range", s.name, i)
+		}
+		return s.symbols[i], nil
+	case "union":
+		i, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.branches)) {
+			return nil, fmt.Errorf("avro union index %v out of range", i)
+		}
+		return d.decode(s.branches[i])
+	case "array":
+		arr := make([]interface{}, 0)
+		for {
+			n, err := d.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return arr, nil
+			}
+			for ; n > 0; n-- {
+				v, err := d.decode(s.items)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+		}
+	case "map":
+		m := make(map[string]interface{})
+		for {
+			n, err := d.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return m, nil
+			}
+			for ; n > 0; n-- {
+				k, err := d.readBytes()
+				if err != nil {
+					return nil, err
+				}
+				v, err := d.decode(s.values)
+				if err != nil {
+					return nil, err
+				}
+				m[string(k)] = v
+			}
+		}
+	case "record":
+		return d.decodeRecord(s)
+	}
+	return nil, fmt.Errorf("unsupported avro type %v", s.typ)
+}
+
+// decodeRecord 解码 record，值为 null 的字段不输出
+func (d *decoder) decodeRecord(s *schema) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(s.fields))
+	for _, f := range s.fields {
+		v, err := d.decode(f.schema)
+		if err != nil {
+			return nil, fmt.Errorf("decode field %v of %v error %v", f.name, s.name, err)
+		}
+		if v != nil {
+			m[f.name] = v
+		}
+	}
+	return m, nil
+}
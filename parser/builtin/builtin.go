@@ -2,14 +2,23 @@
 package builtin
 
 import (
+	_ "github.com/qiniu/logkit/parser/avro"
+	_ "github.com/qiniu/logkit/parser/cef"
 	_ "github.com/qiniu/logkit/parser/csv"
 	_ "github.com/qiniu/logkit/parser/empty"
+	_ "github.com/qiniu/logkit/parser/errorlog"
 	_ "github.com/qiniu/logkit/parser/grok"
 	_ "github.com/qiniu/logkit/parser/json"
 	_ "github.com/qiniu/logkit/parser/kafkarest"
+	_ "github.com/qiniu/logkit/parser/kv"
+	_ "github.com/qiniu/logkit/parser/log4j"
+	_ "github.com/qiniu/logkit/parser/logfmt"
 	_ "github.com/qiniu/logkit/parser/mysql"
 	_ "github.com/qiniu/logkit/parser/nginx"
+	_ "github.com/qiniu/logkit/parser/protobuf"
 	_ "github.com/qiniu/logkit/parser/qiniu"
 	_ "github.com/qiniu/logkit/parser/raw"
 	_ "github.com/qiniu/logkit/parser/syslog"
+	_ "github.com/qiniu/logkit/parser/w3c"
+	_ "github.com/qiniu/logkit/parser/xml"
 )
@@ -0,0 +1,325 @@
+package cef
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	cefPrefix  = "CEF:"
+	leefPrefix = "LEEF:"
+)
+
+// 解析后的头部字段名称
+const (
+	KeySyslogHeader  = "syslog_header"
+	KeyCEFVersion    = "cef_version"
+	KeyLEEFVersion   = "leef_version"
+	KeyDeviceVendor  = "device_vendor"
+	KeyDeviceProduct = "device_product"
+	KeyDeviceVersion = "device_version"
+	KeySignatureID   = "signature_id"
+	KeyEventName     = "name"
+	KeySeverity      = "severity"
+	KeyEventID       = "event_id"
+)
+
+var (
+	cefHeaderKeys  = []string{KeyCEFVersion, KeyDeviceVendor, KeyDeviceProduct, KeyDeviceVersion, KeySignatureID, KeyEventName, KeySeverity}
+	leefHeaderKeys = []string{KeyLEEFVersion, KeyDeviceVendor, KeyDeviceProduct, KeyDeviceVersion, KeyEventID}
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeCEF, NewParser)
+}
+
+// Parser 解析 ArcSight CEF 和 IBM LEEF 格式的安全事件，根据 CEF: 和 LEEF: 自动识别格式，
+// 之前的 syslog 头部放在 syslog_header 字段中，扩展部分的键值对直接作为字段，不覆盖头部字段
+type Parser struct {
+	name                 string
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeCEF
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = fmt.Errorf("parse cef line error %v, raw data is: %s", err, line)
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			// 扩展字段不固定，label 不覆盖数据
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+func parse(line string) (Data, error) {
+	cefIdx, leefIdx := strings.Index(line, cefPrefix), strings.Index(line, leefPrefix)
+	var (
+		d   Data
+		err error
+		idx int
+	)
+	switch {
+	case cefIdx >= 0 && (leefIdx < 0 || cefIdx < leefIdx):
+		idx = cefIdx
+		d, err = parseCEF(line[cefIdx+len(cefPrefix):])
+	case leefIdx >= 0:
+		idx = leefIdx
+		d, err = parseLEEF(line[leefIdx+len(leefPrefix):])
+	default:
+		return nil, errors.New("neither CEF: nor LEEF: found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header := strings.TrimSpace(line[:idx]); header != "" {
+		d[KeySyslogHeader] = header
+	}
+	return d, nil
+}
+
+// parseCEF 解析 Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func parseCEF(s string) (Data, error) {
+	fields, ext, err := splitHeader(s, len(cefHeaderKeys))
+	if err != nil {
+		return nil, err
+	}
+	d := make(Data)
+	for i, key := range cefHeaderKeys {
+		d[key] = fields[i]
+	}
+	// Severity 通常是 0-10 的整数，也可能是 Low、High 这样的字符串
+	if n, err := strconv.ParseInt(fields[len(fields)-1], 10, 64); err == nil {
+		d[KeySeverity] = n
+	}
+	exts, err := parseCEFExtension(ext)
+	if err != nil {
+		return nil, err
+	}
+	merge(d, exts)
+	return d, nil
+}
+
+// parseLEEF 解析 LEEF 1.0 的 Version|Vendor|Product|Version|EventID|Extension 以及
+// LEEF 2.0 在 EventID 之后多了一个分隔符字段的格式
+func parseLEEF(s string) (Data, error) {
+	n := len(leefHeaderKeys)
+	if strings.HasPrefix(s, "2.") {
+		n++
+	}
+	fields, ext, err := splitHeader(s, n)
+	if err != nil {
+		return nil, err
+	}
+	d := make(Data)
+	for i, key := range leefHeaderKeys {
+		d[key] = fields[i]
+	}
+	delim := "\t"
+	if n > len(leefHeaderKeys) {
+		if delim, err = leefDelimiter(fields[n-1]); err != nil {
+			return nil, err
+		}
+	}
+	var exts map[string]string
+	if strings.Contains(ext, delim) {
+		exts, err = parseLEEFExtension(ext, delim)
+	} else {
+		// 有些设备发出的 LEEF 1.0 日志用空格分隔，这时按照 CEF 的规则解析
+		exts, err = parseCEFExtension(ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	merge(d, exts)
+	return d, nil
+}
+
+func merge(d Data, exts map[string]string) {
+	for k, v := range exts {
+		if _, ok := d[k]; ok {
+			continue
+		}
+		d[k] = v
+	}
+}
+
+// splitHeader 按照没有转义的 | 分出 n 个头部字段，剩下的部分是扩展部分，头部字段中 \| 和 \\ 是转义字符
+func splitHeader(s string, n int) ([]string, string, error) {
+	fields := make([]string, 0, n)
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && (s[i+1] == '|' || s[i+1] == '\\') {
+			buf.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		if c != '|' {
+			buf.WriteByte(c)
+			continue
+		}
+		fields = append(fields, buf.String())
+		buf.Reset()
+		if len(fields) == n {
+			return fields, s[i+1:], nil
+		}
+	}
+	return nil, "", fmt.Errorf("header should have %v fields separated by |, got %v", n, len(fields))
+}
+
+// parseCEFExtension 解析空格分隔的 key=value，值中可以包含空格，下一个 key= 之前的内容都属于上一个值，
+// 值中的 \=、\\、\n、\r 是转义字符
+func parseCEFExtension(ext string) (map[string]string, error) {
+	exts := make(map[string]string)
+	ext = strings.TrimSpace(ext)
+	if ext == "" {
+		return exts, nil
+	}
+	// keyStarts 和 eqs 分别为每个 key 开始的位置以及 key 后面 = 的位置
+	var keyStarts, eqs []int
+	for i := 0; i < len(ext); i++ {
+		if ext[i] == '\\' {
+			i++
+			continue
+		}
+		if ext[i] != '=' {
+			continue
+		}
+		start := strings.LastIndexAny(ext[:i], " \t") + 1
+		if start == i || (len(eqs) > 0 && start <= eqs[len(eqs)-1]) {
+			// 前面没有空格分隔的 key，说明是值中没有转义的 =，作为值的一部分
+			continue
+		}
+		keyStarts = append(keyStarts, start)
+		eqs = append(eqs, i)
+	}
+	if len(eqs) == 0 || keyStarts[0] != 0 {
+		return nil, fmt.Errorf("extension [%v] should be key=value pairs", ext)
+	}
+	for i, eq := range eqs {
+		end := len(ext)
+		if i+1 < len(eqs) {
+			end = keyStarts[i+1]
+		}
+		exts[ext[keyStarts[i]:eq]] = unescapeValue(strings.TrimRight(ext[eq+1:end], " \t"))
+	}
+	return exts, nil
+}
+
+func unescapeValue(v string) string {
+	if strings.IndexByte(v, '\\') < 0 {
+		return v
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i+1 >= len(v) {
+			buf.WriteByte(v[i])
+			continue
+		}
+		i++
+		switch v[i] {
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		default:
+			buf.WriteByte(v[i])
+		}
+	}
+	return buf.String()
+}
+
+// parseLEEFExtension 解析 delim 分隔的 key=value，按照第一个 = 拆分
+func parseLEEFExtension(ext, delim string) (map[string]string, error) {
+	exts := make(map[string]string)
+	for _, pair := range strings.Split(ext, delim) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		idx := strings.IndexByte(pair, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("extension pair [%v] should be key=value", pair)
+		}
+		exts[strings.TrimSpace(pair[:idx])] = pair[idx+1:]
+	}
+	return exts, nil
+}
+
+// leefDelimiter 解析 LEEF 2.0 的分隔符字段，可以是单个字符或者 x09、0x09 这样的十六进制，为空时是 tab
+func leefDelimiter(s string) (string, error) {
+	if s == "" {
+		return "\t", nil
+	}
+	if len(s) == 1 {
+		return s, nil
+	}
+	lower := strings.ToLower(s)
+	var hex string
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		hex = lower[2:]
+	case strings.HasPrefix(lower, "x"):
+		hex = lower[1:]
+	default:
+		return "", fmt.Errorf("invalid LEEF delimiter %v", s)
+	}
+	n, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid LEEF delimiter %v", s)
+	}
+	return string(rune(n)), nil
+}
@@ -0,0 +1,97 @@
+package cef
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestCEFParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "cef",
+		parser.KeyLabels:     "machine nb110,src ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, parser.TypeCEF, p.(parser.ParserType).Type())
+	datas, err := p.Parse([]string{
+		`Sep 19 08:26:10 host CEF:0|security|threat\|manager|1.0|100|detected a \\ in packet|High|src=10.0.0.1 act=blocked a = msg=line1\nline2 with spaces filePath=C:\\Windows name=ignored`,
+		"",
+		`CEF:0|Vendor|Product|1.0|100|name|5|`,
+		`CEF:0|Vendor|Product|1.0|100`,
+		"not a security event",
+	})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{1}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{
+			KeySyslogHeader:  "Sep 19 08:26:10 host",
+			KeyCEFVersion:    "0",
+			KeyDeviceVendor:  "security",
+			KeyDeviceProduct: "threat|manager",
+			KeyDeviceVersion: "1.0",
+			KeySignatureID:   "100",
+			KeyEventName:     `detected a \ in packet`,
+			KeySeverity:      "High",
+			"src":            "10.0.0.1",
+			"act":            "blocked a =",
+			"msg":            "line1\nline2 with spaces",
+			"filePath":       `C:\Windows`,
+			"machine":        "nb110",
+		},
+		{
+			KeyCEFVersion:    "0",
+			KeyDeviceVendor:  "Vendor",
+			KeyDeviceProduct: "Product",
+			KeyDeviceVersion: "1.0",
+			KeySignatureID:   "100",
+			KeyEventName:     "name",
+			KeySeverity:      int64(5),
+			"machine":        "nb110",
+			"src":            "ignored",
+		},
+		{KeyPandoraStash: "CEF:0|Vendor|Product|1.0|100"},
+		{KeyPandoraStash: "not a security event"},
+	}, datas)
+}
+
+func TestLEEFParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{
+		"LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tmsg=the system = attacked",
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5",
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|x7C|src=10.0.1.8",
+		"LEEF:1.0|Vendor|Product|1.0|1|src=10.0.0.1 msg=space separated",
+		"LEEF:2.0|Vendor|Product|1.0|1|zz|src=10.0.0.1",
+	})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), st.Success)
+	assert.Equal(t, int64(1), st.Errors)
+	header := func(version, vendor, product, eventID string) Data {
+		return Data{KeyLEEFVersion: version, KeyDeviceVendor: vendor, KeyDeviceProduct: product, KeyDeviceVersion: "1.0", KeyEventID: eventID}
+	}
+	exp := []Data{
+		{KeyLEEFVersion: "1.0", KeyDeviceVendor: "Microsoft", KeyDeviceProduct: "MSExchange", KeyDeviceVersion: "4.0 SP1", KeyEventID: "15345"},
+		header("2.0", "Lancope", "StealthWatch", "41"),
+		header("2.0", "Lancope", "StealthWatch", "41"),
+		header("1.0", "Vendor", "Product", "1"),
+	}
+	for k, v := range map[string]string{"src": "192.0.2.0", "dst": "172.50.123.1", "msg": "the system = attacked"} {
+		exp[0][k] = v
+	}
+	for k, v := range map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5", "sev": "5"} {
+		exp[1][k] = v
+	}
+	exp[2]["src"] = "10.0.1.8"
+	exp[3]["src"], exp[3]["msg"] = "10.0.0.1", "space separated"
+	exp = append(exp, Data{KeyPandoraStash: "LEEF:2.0|Vendor|Product|1.0|1|zz|src=10.0.0.1"})
+	assert.Equal(t, exp, datas)
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// ChainConfig 是 runner 中 parser_chain 的一项配置，把前面的解析器解析出的 Field 字段
+// 再用 Parser 配置的解析器解析一次，解析出的字段合并到原来的数据中
+type ChainConfig struct {
+	Field     string       `json:"field"`
+	Parser    conf.MapConf `json:"parser"`
+	Prefix    string       `json:"prefix,omitempty"`     // 合并时在字段名称前加上的前缀
+	KeepField bool         `json:"keep_field,omitempty"` // 解析成功后是否保留原来的字段
+}
+
+type chainStage struct {
+	ChainConfig
+	parser Parser
+}
+
+// chainParser 在 Parser 解析之后依次执行 parser_chain 中的解析器，每一行仍然对应一条数据，
+// 所以 StatsError 中的统计信息和跳过的行与第一个解析器的结果一致
+type chainParser struct {
+	Parser
+	stages []chainStage
+}
+
+// flushableChainParser 在第一个解析器是 Flushable 时使用，保证 runner 仍然会发送 flush 信号
+type flushableChainParser struct {
+	*chainParser
+}
+
+// dataChainParser 在第一个解析器是 DataParser 时使用，保证 runner 仍然可以直接处理结构化数据
+type dataChainParser struct {
+	*chainParser
+}
+
+// NewParserChain 根据 chain 的配置在 first 之后串联其他解析器，chain 为空时直接返回 first
+func (ps *Registry) NewParserChain(first Parser, chain []ChainConfig) (Parser, error) {
+	if len(chain) == 0 {
+		return first, nil
+	}
+	stages := make([]chainStage, 0, len(chain))
+	for i, c := range chain {
+		if c.Field == "" {
+			return nil, errors.New("parser_chain[" + strconv.Itoa(i) + "] field is empty")
+		}
+		p, err := ps.NewLogParser(c.Parser)
+		if err != nil {
+			return nil, fmt.Errorf("parser_chain[%v] create parser error %v", i, err)
+		}
+		stages = append(stages, chainStage{ChainConfig: c, parser: p})
+	}
+	cp := &chainParser{Parser: first, stages: stages}
+	if _, ok := first.(Flushable); ok {
+		return flushableChainParser{cp}, nil
+	}
+	if _, ok := first.(DataParser); ok {
+		return dataChainParser{cp}, nil
+	}
+	return cp, nil
+}
+
+func (p *chainParser) Type() string {
+	if pt, ok := p.Parser.(ParserType); ok {
+		return pt.Type()
+	}
+	return ""
+}
+
+func (p *chainParser) Parse(lines []string) ([]Data, error) {
+	datas, err := p.Parser.Parse(lines)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+// ParseBytes 在第一个解析器实现了 BytesParser 时仍然直接解析 []byte
+func (p *chainParser) ParseBytes(lines [][]byte) ([]Data, error) {
+	datas, err := ParseBytes(p.Parser, lines)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+// apply 在 d 上依次执行每个解析器，字段不存在、不是字符串或者解析失败时保留原来的字段
+func (p *chainParser) apply(d Data) {
+	if d == nil {
+		return
+	}
+	for _, s := range p.stages {
+		raw, ok := d[s.Field].(string)
+		if !ok || raw == "" {
+			continue
+		}
+		subs, err := s.parser.Parse([]string{raw})
+		if se, ok := err.(*StatsError); ok {
+			err = nil
+			if se.Errors > 0 {
+				err = se.ErrorDetail
+			}
+		}
+		if err != nil {
+			log.Debugf("parser %v chain parse field %v error %v", p.Name(), s.Field, err)
+			continue
+		}
+		if len(subs) == 0 {
+			continue
+		}
+		if !s.KeepField {
+			delete(d, s.Field)
+		}
+		for k, v := range subs[0] {
+			d[s.Prefix+k] = v
+		}
+	}
+}
+
+func (p dataChainParser) ParseData(datas []Data) ([]Data, error) {
+	datas, err := p.Parser.(DataParser).ParseData(datas)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+func (p flushableChainParser) Flush() (Data, error) {
+	d, err := p.Parser.(Flushable).Flush()
+	p.apply(d)
+	return d, err
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// kvParser 把 "k=v k=v" 解析为字段，用于测试串联解析
+type kvParser struct{}
+
+func (p *kvParser) Name() string { return "kv" }
+
+func (p *kvParser) Type() string { return "kv" }
+
+func (p *kvParser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		if line == "" {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d := make(Data)
+		for _, kv := range strings.Fields(line) {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				se.AddErrors()
+				se.ErrorDetail = errors.New("invalid kv " + kv)
+				d = Data{KeyPandoraStash: line}
+				break
+			}
+			d[parts[0]] = parts[1]
+		}
+		if _, ok := d[KeyPandoraStash]; !ok {
+			se.AddSuccess()
+		}
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+type flushKvParser struct {
+	kvParser
+}
+
+func (p *flushKvParser) Flush() (Data, error) {
+	return Data{"msg": "level=warn"}, nil
+}
+
+// dataKvParser 直接处理结构化数据，只把 level 字段转为大写
+type dataKvParser struct {
+	kvParser
+}
+
+func (p *dataKvParser) ParseData(datas []Data) ([]Data, error) {
+	for _, d := range datas {
+		if level, ok := d["level"].(string); ok {
+			d["level"] = strings.ToUpper(level)
+		}
+	}
+	return datas, nil
+}
+
+func (p *dataKvParser) ParseBytes(lines [][]byte) ([]Data, error) {
+	strs := make([]string, len(lines))
+	for i, line := range lines {
+		strs[i] = "bytes=1 " + string(line)
+	}
+	return p.Parse(strs)
+}
+
+func TestParserChainOptionalInterfaces(t *testing.T) {
+	ps := NewRegistry()
+	assert.NoError(t, ps.RegisterParser("kv", func(conf.MapConf) (Parser, error) { return &kvParser{}, nil }))
+	chain := []ChainConfig{{Field: "msg", Parser: conf.MapConf{KeyParserType: "kv"}}}
+
+	p, err := ps.NewParserChain(&dataKvParser{}, chain)
+	assert.NoError(t, err)
+	dp, ok := p.(DataParser)
+	assert.True(t, ok)
+	datas, err := dp.ParseData([]Data{{"level": "info", "msg": "user=a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []Data{{"level": "INFO", "user": "a"}}, datas)
+	_, ok = p.(BytesParser)
+	assert.True(t, ok)
+	datas, _ = ParseBytes(p, [][]byte{[]byte("msg=user=b")})
+	assert.Equal(t, []Data{{"bytes": "1", "user": "b"}}, datas)
+
+	// 第一个解析器不支持时不能通过类型断言
+	p, err = ps.NewParserChain(&kvParser{}, chain)
+	assert.NoError(t, err)
+	_, ok = p.(DataParser)
+	assert.False(t, ok)
+	datas, _ = ParseBytes(p, [][]byte{[]byte("msg=user=b")})
+	assert.Equal(t, []Data{{"user": "b"}}, datas)
+}
+
+func TestParserChain(t *testing.T) {
+	ps := NewRegistry()
+	assert.NoError(t, ps.RegisterParser("kv", func(conf.MapConf) (Parser, error) { return &kvParser{}, nil }))
+
+	first := &kvParser{}
+	p, err := ps.NewParserChain(first, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first, p)
+
+	p, err = ps.NewParserChain(first, []ChainConfig{
+		{Field: "msg", Parser: conf.MapConf{KeyParserType: "kv"}},
+		{Field: "extra", Parser: conf.MapConf{KeyParserType: "kv"}, Prefix: "extra_", KeepField: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "kv", p.(ParserType).Type())
+	_, ok := p.(Flushable)
+	assert.False(t, ok)
+
+	datas, err := p.Parse([]string{
+		"host=a msg=level=info",
+		"",
+		"host=b msg=bad extra=user=c",
+		"bad",
+	})
+	se, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), se.Success)
+	assert.Equal(t, int64(1), se.Errors)
+	assert.Equal(t, []int{1}, se.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{"host": "a", "level": "info"},
+		// 解析失败时保留原来的字段
+		{"host": "b", "msg": "bad", "extra": "user=c", "extra_user": "c"},
+		{KeyPandoraStash: "bad"},
+	}, datas)
+
+	p, err = ps.NewParserChain(&flushKvParser{}, []ChainConfig{{Field: "msg", Parser: conf.MapConf{KeyParserType: "kv"}}})
+	assert.NoError(t, err)
+	fp, ok := p.(Flushable)
+	assert.True(t, ok)
+	d, err := fp.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, Data{"level": "warn"}, d)
+
+	_, err = ps.NewParserChain(first, []ChainConfig{{Parser: conf.MapConf{KeyParserType: "kv"}}})
+	assert.Error(t, err)
+	_, err = ps.NewParserChain(first, []ChainConfig{{Field: "msg", Parser: conf.MapConf{KeyParserType: "unknown"}}})
+	assert.Error(t, err)
+}
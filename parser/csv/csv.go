@@ -34,11 +34,14 @@ type Parser struct {
 	delim                string
 	isAutoRename         bool
 	timeZoneOffset       int
+	location             *time.Location
 	disableRecordErrData bool
 	allowMoreName        string
 	allmoreStartNUmber   int
 	allowNotMatch        bool
 	ignoreInvalid        bool
+	schemaFromHeader     bool
+	typeHints            map[string]field // 从表头获取字段时 csv_schema 中配置了类型的字段
 }
 
 type field struct {
@@ -56,12 +59,18 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 	name, _ := c.GetStringOr(parser.KeyParserName, "")
 	splitter, _ := c.GetStringOr(parser.KeyCSVSplitter, "\t")
 
+	schemaFromHeader, _ := c.GetBoolOr(parser.KeyCSVSchemaFromHeader, false)
 	schema, err := c.GetString(parser.KeyCSVSchema)
-	if err != nil {
+	if err != nil && !schemaFromHeader {
 		return nil, err
 	}
 	timeZoneOffsetRaw, _ := c.GetStringOr(parser.KeyTimeZoneOffset, "")
 	timeZoneOffset := parser.ParseTimeZoneOffset(timeZoneOffsetRaw)
+	timeZone, _ := c.GetStringOr(parser.KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", parser.KeyTimeZone, err)
+	}
 	isAutoRename, _ := c.GetBoolOr(parser.KeyCSVAutoRename, false)
 
 	fieldList, err := parseSchemaFieldList(schema)
@@ -73,12 +82,14 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 		return nil, err
 	}
 	nameMap := map[string]struct{}{}
+	typeHints := make(map[string]field)
 	for _, newField := range fields {
 		_, exist := nameMap[newField.name]
 		if exist {
 			return nil, errors.New("column conf error: duplicated column " + newField.name)
 		}
 		nameMap[newField.name] = struct{}{}
+		typeHints[newField.name] = newField
 	}
 	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
 	if len(labelList) < 1 {
@@ -102,11 +113,14 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 		delim:                splitter,
 		isAutoRename:         isAutoRename,
 		timeZoneOffset:       timeZoneOffset,
+		location:             location,
 		disableRecordErrData: disableRecordErrData,
 		allowNotMatch:        allowNotMatch,
 		allowMoreName:        allowMoreName,
 		ignoreInvalid:        ignoreInvalid,
 		allmoreStartNUmber:   allmoreStartNumber,
+		schemaFromHeader:     schemaFromHeader,
+		typeHints:            typeHints,
 	}, nil
 }
 
@@ -256,11 +270,11 @@ func newCsvField(name string, dataType parser.DataType) (f field, err error) {
 	return
 }
 
-func (f field) MakeValue(raw string, timeZoneOffset int) (interface{}, error) {
-	return makeValue(raw, f.dataType, timeZoneOffset)
+func (f field) MakeValue(raw string, timeZoneOffset int, loc *time.Location) (interface{}, error) {
+	return makeValue(raw, f.dataType, timeZoneOffset, loc)
 }
 
-func makeValue(raw string, valueType parser.DataType, timeZoneOffset int) (interface{}, error) {
+func makeValue(raw string, valueType parser.DataType, timeZoneOffset int, loc *time.Location) (interface{}, error) {
 	switch valueType {
 	case parser.TypeFloat:
 		if raw == "" {
@@ -276,7 +290,7 @@ func makeValue(raw string, valueType parser.DataType, timeZoneOffset int) (inter
 		if raw == "" {
 			return time.Now(), nil
 		}
-		ts, err := times.StrToTime(raw)
+		ts, err := times.StrToTimeInLocation(raw, loc)
 		if err == nil {
 			return ts.Add(time.Duration(timeZoneOffset) * time.Hour).Format(time.RFC3339Nano), nil
 		}
@@ -322,7 +336,7 @@ func convertValue(v interface{}, valueType parser.DataType) (ret interface{}, er
 	return
 }
 
-func (f field) ValueParse(value string, timeZoneOffset int) (datas Data, err error) {
+func (f field) ValueParse(value string, timeZoneOffset int, loc *time.Location) (datas Data, err error) {
 	if f.dataType != parser.TypeString {
 		value = strings.TrimSpace(value)
 	}
@@ -360,7 +374,7 @@ func (f field) ValueParse(value string, timeZoneOffset int) (datas Data, err err
 			}
 		}
 	default:
-		v, err := f.MakeValue(value, timeZoneOffset)
+		v, err := f.MakeValue(value, timeZoneOffset, loc)
 		if err != nil {
 			return nil, err
 		}
@@ -401,7 +415,38 @@ func getUnmachedMessage(parts []string, schemas []field) (ret string) {
 	return
 }
 
+// learnSchema 根据表头重新生成 schema，csv_schema 中配置了类型的字段按照配置的类型解析，其他字段为 string
+func (p *Parser) learnSchema(header string) error {
+	header = strings.TrimPrefix(header, "\ufeff")
+	if !HasSpace(p.delim) {
+		header = strings.TrimSpace(header)
+	}
+	names := strings.Split(header, p.delim)
+	fields := make([]field, 0, len(names))
+	nameMap := make(map[string]struct{}, len(names))
+	for i, name := range names {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if name == "" {
+			return fmt.Errorf("csv header [%v] column %v has empty name", header, i)
+		}
+		if _, exist := nameMap[name]; exist {
+			return errors.New("csv header error: duplicated column " + name)
+		}
+		nameMap[name] = struct{}{}
+		f, ok := p.typeHints[name]
+		if !ok {
+			f = field{name: name, dataType: parser.TypeString}
+		}
+		fields = append(fields, f)
+	}
+	p.schema = fields
+	return nil
+}
+
 func (p *Parser) parse(line string) (d Data, err error) {
+	if len(p.schema) == 0 {
+		return nil, errors.New("csv schema is empty, no header line has been read")
+	}
 	d = make(Data)
 	parts := strings.Split(line, p.delim)
 	if len(parts) != len(p.schema) && !p.allowNotMatch {
@@ -416,7 +461,7 @@ func (p *Parser) parse(line string) (d Data, err error) {
 			d[p.allowMoreName+strconv.Itoa(moreNum)] = part
 			moreNum++
 		} else {
-			dts, err := p.schema[i].ValueParse(part, p.timeZoneOffset)
+			dts, err := p.schema[i].ValueParse(part, p.timeZoneOffset, p.location)
 			if err != nil {
 				err = fmt.Errorf("schema [%v] type [%v] value [%v] detail: %v", p.schema[i].name, p.schema[i].dataType, part, err)
 				if p.ignoreInvalid {
@@ -464,6 +509,27 @@ func (p *Parser) Parse(lines []string) ([]Data, error) {
 	datas := []Data{}
 	se := &StatsError{}
 	for idx, line := range lines {
+		if strings.HasPrefix(line, HeaderLineMarker) {
+			line = line[len(HeaderLineMarker):]
+			if p.schemaFromHeader {
+				err := p.learnSchema(line)
+				if err == nil {
+					se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+					continue
+				}
+				log.Debug(err)
+				se.AddErrors()
+				se.ErrorDetail = err
+				if !p.disableRecordErrData {
+					errData := make(Data)
+					errData[KeyPandoraStash] = line
+					datas = append(datas, errData)
+				} else {
+					se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+				}
+				continue
+			}
+		}
 		if !HasSpace(p.delim) {
 			line = strings.TrimSpace(line)
 		}
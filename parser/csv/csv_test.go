@@ -260,7 +260,7 @@ func Test_convertValue(t *testing.T) {
 }
 
 func TestField_MakeValue(t *testing.T) {
-	tm, err := makeValue("2017/01/02 15:00:00", parser.TypeDate, 1)
+	tm, err := makeValue("2017/01/02 15:00:00", parser.TypeDate, 1, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -271,6 +271,29 @@ func TestField_MakeValue(t *testing.T) {
 	assert.Equal(t, exp.Format(time.RFC3339Nano), tm)
 }
 
+func TestParserTimezone(t *testing.T) {
+	c := conf.MapConf{}
+	c[parser.KeyParserName] = "testTimezone"
+	c[parser.KeyParserType] = "csv"
+	c[parser.KeyCSVSchema] = "t1 date, t2 date"
+	c[parser.KeyCSVSplitter] = "|"
+	c[parser.KeyTimeZone] = "America/New_York"
+	p, err := NewParser(c)
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{"2018-07-01 12:00:00.123456|2018-01-01 12:00:00"})
+	if c, ok := err.(*StatsError); ok {
+		err = c.ErrorDetail
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(datas))
+	assert.Equal(t, "2018-07-01T12:00:00.123456-04:00", datas[0]["t1"])
+	assert.Equal(t, "2018-01-01T12:00:00-05:00", datas[0]["t2"])
+
+	c[parser.KeyTimeZone] = "Mars/Olympus"
+	_, err = NewParser(c)
+	assert.Error(t, err)
+}
+
 func TestRename(t *testing.T) {
 	c := conf.MapConf{}
 	c[parser.KeyParserName] = "testRename"
@@ -372,7 +395,7 @@ func TestJSONMap(t *testing.T) {
 		dataType: parser.TypeJSONMap,
 	}
 	testx := "999"
-	data, err := fd.ValueParse(testx, 0)
+	data, err := fd.ValueParse(testx, 0, nil)
 	assert.Error(t, err)
 	assert.Equal(t, data, Data{})
 }
@@ -508,3 +531,46 @@ func TestCsvlastempty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []Data{{"logType": "a", "a": int64(1), "b": 1.2, "c": " "}}, datas)
 }
+
+func TestSchemaFromHeader(t *testing.T) {
+	c := conf.MapConf{}
+	c[parser.KeyParserName] = "TestSchemaFromHeader"
+	c[parser.KeyParserType] = "csv"
+	c[parser.KeyCSVSchemaFromHeader] = "true"
+	c[parser.KeyCSVSchema] = "a long"
+	c[parser.KeyCSVSplitter] = ","
+	pp, err := NewParser(c)
+	assert.NoError(t, err)
+	datas, err := pp.Parse([]string{
+		"x,1",
+		HeaderLineMarker + "name,a\n",
+		"alice,1",
+		// 新文件的表头不同
+		HeaderLineMarker + `"a","b","name"`,
+		"2,bob,carol",
+		HeaderLineMarker + "a,a",
+	})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{1, 3}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{KeyPandoraStash: "x,1"},
+		{"name": "alice", "a": int64(1)},
+		{"a": int64(2), "b": "bob", "name": "carol"},
+		{KeyPandoraStash: "a,a"},
+	}, datas)
+
+	// 未开启时去掉标记后按照 csv_schema 解析
+	delete(c, parser.KeyCSVSchemaFromHeader)
+	pp, err = NewParser(c)
+	assert.NoError(t, err)
+	datas, _ = pp.Parse([]string{HeaderLineMarker + "3"})
+	assert.Equal(t, []Data{{"a": int64(3)}}, datas)
+
+	_, err = NewParser(conf.MapConf{parser.KeyCSVSchemaFromHeader: "true"})
+	assert.NoError(t, err)
+	_, err = NewParser(conf.MapConf{})
+	assert.Error(t, err)
+}
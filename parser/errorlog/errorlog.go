@@ -0,0 +1,244 @@
+package errorlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/times"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// 解析后的字段名称，没有出现的字段不会输出
+const (
+	KeyTime         = "time"
+	KeyLevel        = "level"
+	KeyPid          = "pid"
+	KeyTid          = "tid"
+	KeyConnectionID = "connection_id" // nginx 的连接序号，即 *123
+	KeyModule       = "module"        // apache 2.4 的模块名称，如 core、proxy
+	KeyErrorCode    = "error_code"    // apache 2.4 的错误码，如 AH00037
+	KeyMessage      = "message"
+	KeyClient       = "client"
+	KeyRemote       = "remote"
+	KeyServer       = "server"
+	KeyRequest      = "request"
+	KeySubrequest   = "subrequest"
+	KeyUpstream     = "upstream"
+	KeyHost         = "host"
+	KeyReferrer     = "referrer"
+)
+
+const (
+	nginxTimeLayout  = "2006/01/02 15:04:05"
+	apacheTimeLayout = "Mon Jan _2 15:04:05 2006"
+)
+
+var (
+	// 2016/10/25 14:23:45 [error] 1234#5678: *9 message
+	nginxRegexp = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#(\d+): (?:\*(\d+) )?(.*)$`)
+	// nginx 在 message 后面按顺序追加 , client: xxx, server: xxx 这样的字段
+	nginxFieldRegexp = regexp.MustCompile(`^, (client|server|request|subrequest|upstream|host|referrer): ("(?:[^"\\]|\\.)*"|[^,]*)`)
+
+	// [Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 35708:tid 4328636416] [client 72.15.99.187:54212] AH00037: message
+	apacheTimeRegexp      = regexp.MustCompile(`^\[(\w{3} \w{3} [ \d]\d \d{2}:\d{2}:\d{2}(?:\.\d+)? \d{4})\]`)
+	apachePidRegexp       = regexp.MustCompile(`^pid (\d+)(?::tid (\d+))?$`)
+	apacheErrorCodeRegexp = regexp.MustCompile(`^(AH\d+): `)
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeErrorLog, NewParser)
+}
+
+// Parser 解析 nginx 和 apache 的 error log，根据每一行的格式自动识别
+type Parser struct {
+	name                 string
+	location             *time.Location
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	timeZone, _ := c.GetStringOr(parser.KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", parser.KeyTimeZone, err)
+	}
+	if location == nil {
+		location = time.Local
+	}
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		location:             location,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeErrorLog
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = err
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+func (p *Parser) parse(line string) (Data, error) {
+	if strings.HasPrefix(line, "[") {
+		return p.parseApache(line)
+	}
+	return p.parseNginx(line)
+}
+
+func (p *Parser) parseNginx(line string) (Data, error) {
+	fields := nginxRegexp.FindStringSubmatch(line)
+	if fields == nil {
+		return nil, fmt.Errorf("ErrorLogParser fail to parse log line [%v], neither nginx nor apache error log", line)
+	}
+	t, err := time.ParseInLocation(nginxTimeLayout, fields[1], p.location)
+	if err != nil {
+		return nil, err
+	}
+	d := Data{
+		KeyTime:  t.Format(time.RFC3339Nano),
+		KeyLevel: fields[2],
+		KeyPid:   fields[3],
+		KeyTid:   fields[4],
+	}
+	if fields[5] != "" {
+		d[KeyConnectionID] = fields[5]
+	}
+	d[KeyMessage] = parseNginxFields(fields[6], d)
+	return d, nil
+}
+
+// parseNginxFields 从 message 末尾的 , client: xxx 开始解析 nginx 追加的字段，返回去掉这些字段的 message，
+// message 中也可能出现 , client: ，所以从最后一个开始尝试，直到末尾的内容全部能够解析为止
+func parseNginxFields(msg string, d Data) string {
+	for end := len(msg); ; {
+		i := strings.LastIndex(msg[:end], ", client: ")
+		if i < 0 {
+			return msg
+		}
+		fields := make(map[string]string)
+		rest := msg[i:]
+		for rest != "" {
+			m := nginxFieldRegexp.FindStringSubmatch(rest)
+			if m == nil {
+				break
+			}
+			fields[m[1]] = strings.Trim(m[2], `"`)
+			rest = rest[len(m[0]):]
+		}
+		if rest == "" {
+			for k, v := range fields {
+				d[k] = v
+			}
+			return msg[:i]
+		}
+		end = i
+	}
+}
+
+func (p *Parser) parseApache(line string) (Data, error) {
+	m := apacheTimeRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("ErrorLogParser fail to parse log line [%v], neither nginx nor apache error log", line)
+	}
+	t, err := time.ParseInLocation(apacheTimeLayout, m[1], p.location)
+	if err != nil {
+		return nil, err
+	}
+	d := Data{KeyTime: t.Format(time.RFC3339Nano)}
+	rest := strings.TrimLeft(line[len(m[0]):], " ")
+	for strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			break
+		}
+		parseApacheField(rest[1:end], d)
+		rest = strings.TrimLeft(rest[end+1:], " ")
+	}
+	if _, ok := d[KeyLevel]; !ok {
+		return nil, fmt.Errorf("ErrorLogParser fail to parse log line [%v], no level found", line)
+	}
+	if code := apacheErrorCodeRegexp.FindStringSubmatch(rest); code != nil {
+		d[KeyErrorCode] = code[1]
+		rest = rest[len(code[0]):]
+	}
+	if i := strings.LastIndex(rest, ", referer: "); i >= 0 {
+		d[KeyReferrer] = rest[i+len(", referer: "):]
+		rest = rest[:i]
+	}
+	d[KeyMessage] = rest
+	return d, nil
+}
+
+// parseApacheField 解析 apache error log 中方括号内的字段，无法识别的字段被忽略
+func parseApacheField(field string, d Data) {
+	if m := apachePidRegexp.FindStringSubmatch(field); m != nil {
+		d[KeyPid] = m[1]
+		if m[2] != "" {
+			d[KeyTid] = m[2]
+		}
+		return
+	}
+	if strings.HasPrefix(field, "client ") {
+		d[KeyClient] = strings.TrimPrefix(field, "client ")
+		return
+	}
+	if strings.HasPrefix(field, "remote ") {
+		d[KeyRemote] = strings.TrimPrefix(field, "remote ")
+		return
+	}
+	if strings.ContainsAny(field, " ") {
+		return
+	}
+	// apache 2.4 为 [module:level]，2.2 只有 [level]
+	if i := strings.IndexByte(field, ':'); i >= 0 {
+		d[KeyModule] = field[:i]
+		d[KeyLevel] = field[i+1:]
+		return
+	}
+	d[KeyLevel] = field
+}
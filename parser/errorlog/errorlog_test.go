@@ -0,0 +1,112 @@
+package errorlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestErrorLogParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "errorlog",
+		parser.KeyTimeZone:   "UTC",
+		parser.KeyLabels:     "machine nb110",
+	})
+	assert.NoError(t, err)
+	lines := []string{
+		`2016/10/25 14:23:45 [error] 1234#5678: *9 open() "/usr/share/nginx/html/favicon.ico" failed (2: No such file or directory), client: 10.0.0.1, server: localhost, request: "GET /favicon.ico HTTP/1.1", host: "example.com", referrer: "http://example.com/"`,
+		`2016/10/25 14:23:46 [notice] 1#1: signal process started`,
+		`2016/10/25 14:23:47 [warn] 12#12: *3 upstream server temporarily disabled, client: 1.2.3.4 while connecting to upstream, client: 10.0.0.2, server: _, request: "POST /api HTTP/1.1", upstream: "http://127.0.0.1:8080/api", host: "a.com"`,
+		"",
+		`[Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 35708:tid 4328636416] [client 72.15.99.187:54212] AH00037: Symbolic link not allowed: /var/www/favicon.ico, referer: http://example.com/`,
+		`[Thu Mar  1 09:00:00 2012] [error] [client 127.0.0.1] File does not exist: /var/www/favicon.ico`,
+		`not an error log`,
+	}
+	datas, err := p.Parse(lines)
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), st.Success)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, []int{3}, st.DatasourceSkipIndex)
+
+	expected := []Data{
+		{
+			KeyTime:         "2016-10-25T14:23:45Z",
+			KeyLevel:        "error",
+			KeyPid:          "1234",
+			KeyTid:          "5678",
+			KeyConnectionID: "9",
+			KeyMessage:      `open() "/usr/share/nginx/html/favicon.ico" failed (2: No such file or directory)`,
+			KeyClient:       "10.0.0.1",
+			KeyServer:       "localhost",
+			KeyRequest:      "GET /favicon.ico HTTP/1.1",
+			KeyHost:         "example.com",
+			KeyReferrer:     "http://example.com/",
+			"machine":       "nb110",
+		},
+		{
+			KeyTime:    "2016-10-25T14:23:46Z",
+			KeyLevel:   "notice",
+			KeyPid:     "1",
+			KeyTid:     "1",
+			KeyMessage: "signal process started",
+			"machine":  "nb110",
+		},
+		{
+			KeyTime:         "2016-10-25T14:23:47Z",
+			KeyLevel:        "warn",
+			KeyPid:          "12",
+			KeyTid:          "12",
+			KeyConnectionID: "3",
+			KeyMessage:      "upstream server temporarily disabled, client: 1.2.3.4 while connecting to upstream",
+			KeyClient:       "10.0.0.2",
+			KeyServer:       "_",
+			KeyRequest:      "POST /api HTTP/1.1",
+			KeyUpstream:     "http://127.0.0.1:8080/api",
+			KeyHost:         "a.com",
+			"machine":       "nb110",
+		},
+		{
+			KeyTime:      "2000-10-11T14:32:52.123456Z",
+			KeyModule:    "core",
+			KeyLevel:     "error",
+			KeyPid:       "35708",
+			KeyTid:       "4328636416",
+			KeyClient:    "72.15.99.187:54212",
+			KeyErrorCode: "AH00037",
+			KeyMessage:   "Symbolic link not allowed: /var/www/favicon.ico",
+			KeyReferrer:  "http://example.com/",
+			"machine":    "nb110",
+		},
+		{
+			KeyTime:    "2012-03-01T09:00:00Z",
+			KeyLevel:   "error",
+			KeyClient:  "127.0.0.1",
+			KeyMessage: "File does not exist: /var/www/favicon.ico",
+			"machine":  "nb110",
+		},
+		{
+			KeyPandoraStash: "not an error log",
+		},
+	}
+	assert.Equal(t, expected, datas)
+	assert.Equal(t, "errorlog", p.Name())
+	assert.Equal(t, parser.TypeErrorLog, p.(parser.ParserType).Type())
+}
+
+func TestErrorLogParserDisableRecordErrData(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyDisableRecordErrData: "true",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{"2016/10/25 [error] bad", "[Wed Oct 11 14:32:52 2000] no level"})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{0, 1}, st.DatasourceSkipIndex)
+	assert.Empty(t, datas)
+}
@@ -3,7 +3,9 @@ package grok
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -33,6 +35,9 @@ const (
 
 const MaxGrokMultiLineBuffer = 64 * 1024 * 1024 // 64MB
 
+// DefaultPatternReloadInterval 是配置了 grok_custom_pattern_dir 时默认检查 pattern 文件变化的间隔
+const DefaultPatternReloadInterval = 30 * time.Second
+
 var (
 	// matches named captures that contain a modifier.
 	//   ie,
@@ -55,6 +60,7 @@ type Parser struct {
 	disableRecordErrData bool
 
 	timeZoneOffset int
+	location       *time.Location
 
 	Patterns []string // 正式的pattern名称
 	// namedPatterns is a list of internally-assigned names to the patterns
@@ -64,6 +70,13 @@ type Parser struct {
 	namedPatterns      []string
 	CustomPatterns     string
 	CustomPatternFiles []string
+	CustomPatternDir   string // 目录下所有的文件都作为 pattern 文件加载
+
+	// reloadInterval 大于 0 时，每隔 reloadInterval 在 Parse 中检查 pattern 文件是否变化，变化时重新编译，
+	// patternFiles 为最近一次编译时所有 pattern 文件的状态
+	reloadInterval  time.Duration
+	lastReloadCheck time.Time
+	patternFiles    map[string]patternFileState
 
 	// typeMap is a map of patterns -> 字段名 -> 类型,
 	//   ie, {
@@ -85,6 +98,11 @@ type Parser struct {
 	g        *grok.Grok
 }
 
+type patternFileState struct {
+	modTime int64
+	size    int64
+}
+
 func NewParser(c conf.MapConf) (parser.Parser, error) {
 	name, _ := c.GetStringOr(parser.KeyParserName, "")
 	patterns, err := c.GetStringList(parser.KeyGrokPatterns)
@@ -95,11 +113,26 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
 	timeZoneOffsetRaw, _ := c.GetStringOr(parser.KeyTimeZoneOffset, "")
 	timeZoneOffset := parser.ParseTimeZoneOffset(timeZoneOffsetRaw)
+	timeZone, _ := c.GetStringOr(parser.KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", parser.KeyTimeZone, err)
+	}
 	nameMap := make(map[string]struct{})
 	labels := parser.GetLabels(labelList, nameMap)
 
 	customPatterns, _ := c.GetStringOr(parser.KeyGrokCustomPatterns, "")
 	customPatternFiles, _ := c.GetStringListOr(parser.KeyGrokCustomPatternFiles, []string{})
+	customPatternDir, _ := c.GetStringOr(parser.KeyGrokCustomPatternDir, "")
+	var reloadInterval time.Duration
+	if customPatternDir != "" {
+		reloadInterval = DefaultPatternReloadInterval
+	}
+	if s, _ := c.GetStringOr(parser.KeyGrokPatternReloadInterval, ""); s != "" {
+		if reloadInterval, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("parse key %v error %v", parser.KeyGrokPatternReloadInterval, err)
+		}
+	}
 
 	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
 
@@ -110,7 +143,11 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 		Patterns:             patterns,
 		CustomPatterns:       customPatterns,
 		CustomPatternFiles:   customPatternFiles,
+		CustomPatternDir:     customPatternDir,
+		reloadInterval:       reloadInterval,
+		lastReloadCheck:      time.Now(),
 		timeZoneOffset:       timeZoneOffset,
+		location:             location,
 		disableRecordErrData: disableRecordErrData,
 	}
 	err = p.compile()
@@ -130,40 +167,115 @@ func (p *Parser) compile() error {
 	p.g = gk
 
 	// Give Patterns fake names so that they can be treated as named
-	// "custom patterns"
+	// "custom patterns"，重新编译时 CustomPatterns 不能变化，所以拼接到新的变量中
+	customPatterns := p.CustomPatterns
 	p.namedPatterns = make([]string, len(p.Patterns))
 	for i, pattern := range p.Patterns {
 		name := fmt.Sprintf("GROK_INTERNAL_PATTERN_%d", i)
-		p.CustomPatterns += "\n" + name + " " + pattern + "\n"
+		customPatterns += "\n" + name + " " + pattern + "\n"
 		p.namedPatterns[i] = "%{" + name + "}"
 	}
 
 	// Combine user-supplied CustomPatterns with DEFAULT_PATTERNS and parse
 	// them together as the same type of pattern.
-	p.CustomPatterns = DEFAULT_PATTERNS + p.CustomPatterns
-	if len(p.CustomPatterns) != 0 {
-		scanner := bufio.NewScanner(strings.NewReader(p.CustomPatterns))
-		err := p.addCustomPatterns(scanner)
-		if err != nil {
-			return err
-		}
+	customPatterns = DEFAULT_PATTERNS + customPatterns
+	scanner := bufio.NewScanner(strings.NewReader(customPatterns))
+	if err = p.addCustomPatterns(scanner); err != nil {
+		return err
 	}
 
 	// Parse any custom pattern files supplied.
-	for _, filename := range p.CustomPatternFiles {
-		file, err := os.Open(filename)
-		if err != nil {
+	files, states, err := p.listPatternFiles()
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		if err = p.addCustomPatternFile(filename); err != nil {
 			return err
 		}
+	}
+	p.patternFiles = states
 
-		scanner := bufio.NewScanner(bufio.NewReader(file))
-		err = p.addCustomPatterns(scanner)
+	return p.compileCustomPatterns()
+}
+
+func (p *Parser) addCustomPatternFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = p.addCustomPatterns(bufio.NewScanner(bufio.NewReader(file))); err != nil {
+		return fmt.Errorf("load grok pattern file %v error %v", filename, err)
+	}
+	return nil
+}
+
+// listPatternFiles 返回 grok_custom_pattern_files 以及 grok_custom_pattern_dir 目录下所有的 pattern 文件和文件的状态，
+// 目录下的文件按照文件名排序，忽略子目录和以 . 开头的文件，同名的 pattern 以后加载的为准
+func (p *Parser) listPatternFiles() ([]string, map[string]patternFileState, error) {
+	files := make([]string, 0, len(p.CustomPatternFiles))
+	states := make(map[string]patternFileState)
+	for _, filename := range p.CustomPatternFiles {
+		fi, err := os.Stat(filename)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+		files = append(files, filename)
+		states[filename] = patternFileState{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+	}
+	if p.CustomPatternDir == "" {
+		return files, states, nil
+	}
+	fis, err := ioutil.ReadDir(p.CustomPatternDir)
+	if err != nil {
+		return nil, nil, err
 	}
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		filename := filepath.Join(p.CustomPatternDir, fi.Name())
+		files = append(files, filename)
+		states[filename] = patternFileState{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+	}
+	return files, states, nil
+}
 
-	return p.compileCustomPatterns()
+// checkReload 在 pattern 文件增加、删除或者修改之后重新编译，编译失败时继续使用之前的 pattern，直到文件再次变化
+func (p *Parser) checkReload() {
+	if p.reloadInterval <= 0 || time.Since(p.lastReloadCheck) < p.reloadInterval {
+		return
+	}
+	p.lastReloadCheck = time.Now()
+	_, states, err := p.listPatternFiles()
+	if err != nil {
+		log.Warnf("Parser[%v] list grok pattern files error %v", p.name, err)
+		return
+	}
+	if samePatternFiles(states, p.patternFiles) {
+		return
+	}
+	np := *p
+	if err = np.compile(); err != nil {
+		log.Errorf("Parser[%v] reload grok pattern files error %v, keep using the old patterns", p.name, err)
+		p.patternFiles = states
+		return
+	}
+	p.namedPatterns, p.typeMap, p.patterns, p.g, p.patternFiles = np.namedPatterns, np.typeMap, np.patterns, np.g, np.patternFiles
+	log.Infof("Parser[%v] grok pattern files changed, reloaded %v files", p.name, len(states))
+}
+
+func samePatternFiles(a, b map[string]patternFileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
 }
 
 func (gp *Parser) Name() string {
@@ -175,6 +287,7 @@ func (gp *Parser) Type() string {
 }
 
 func (gp *Parser) Parse(lines []string) ([]Data, error) {
+	gp.checkReload()
 	datas := []Data{}
 	se := &StatsError{}
 	for idx, line := range lines {
@@ -207,26 +320,37 @@ func (gp *Parser) Parse(lines []string) ([]Data, error) {
 }
 
 func (p *Parser) parseLine(line string) (Data, error) {
+	data, _, err := p.parse(line)
+	return data, err
+}
+
+// Test 使用配置的 pattern 解析 line，返回解析结果以及匹配到的 pattern，用于调试 grok 表达式
+func (p *Parser) Test(line string) (Data, string, error) {
+	return p.parse(line)
+}
+
+func (p *Parser) parse(line string) (Data, string, error) {
 	if p.mode == ModeMulti {
 		line = strings.Replace(line, "\n", " ", -1)
 	}
 	var err error
 	var values map[string]string
-	var patternName string
-	for _, pattern := range p.namedPatterns {
+	var patternName, matched string
+	for i, pattern := range p.namedPatterns {
 		if values, err = p.g.Parse(pattern, line); err != nil {
 			log.Debugf("E! %v", err)
-			return nil, err
+			return nil, "", err
 		}
 		//此处匹配到就break的好处时匹配结果唯一，若要改为不break，那要考虑如果有多个串同时满足时，结果如何选取的问题，应该考虑优先选择匹配的结果多的数据。
 		if len(values) != 0 {
 			patternName = pattern
+			matched = p.Patterns[i]
 			break
 		}
 	}
 	if len(values) < 1 {
 		log.Errorf("%v no value was parsed after grok pattern %v", line, p.Patterns)
-		return nil, fmt.Errorf("%v no value was parsed after grok pattern %v", line, p.Patterns)
+		return nil, "", fmt.Errorf("%v no value was parsed after grok pattern %v", line, p.Patterns)
 	}
 	data := Data{}
 	for k, v := range values {
@@ -262,7 +386,7 @@ func (p *Parser) parseLine(line string) (Data, error) {
 				data[k] = fv
 			}
 		case DATE:
-			ts, err := times.StrToTime(v)
+			ts, err := times.StrToTimeInLocation(v, p.location)
 			if err == nil {
 				ts = ts.Add(time.Duration(p.timeZoneOffset) * time.Hour)
 				rfctime := ts.Format(time.RFC3339Nano)
@@ -279,13 +403,13 @@ func (p *Parser) parseLine(line string) (Data, error) {
 	}
 
 	if len(data) <= 0 {
-		return data, fmt.Errorf("all data was ignored in this line? Check WARN log and fix your grok pattern")
+		return data, matched, fmt.Errorf("all data was ignored in this line? Check WARN log and fix your grok pattern")
 	}
 
 	for _, l := range p.labels {
 		data[l.Name] = l.Value
 	}
-	return data, nil
+	return data, matched, nil
 }
 
 func (p *Parser) addCustomPatterns(scanner *bufio.Scanner) error {
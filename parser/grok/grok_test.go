@@ -1,6 +1,9 @@
 package grok
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -8,6 +11,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
 	. "github.com/qiniu/logkit/utils/models"
 )
 
@@ -819,3 +824,38 @@ func TestNagiosLog(t *testing.T) {
 		"nagios_log":   "Auto-save of retention data completed successfully.",
 	}, got)
 }
+
+func TestCustomPatternDirReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grok_pattern_dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	patternFile := filepath.Join(dir, "mypatterns")
+	require.NoError(t, ioutil.WriteFile(patternFile, []byte("MY_LOG %{WORD:user} %{NUMBER:cost:long}\n"), 0644))
+
+	p, err := NewParser(conf.MapConf{
+		parser.KeyGrokPatterns:              "%{MY_LOG}",
+		parser.KeyGrokCustomPatternDir:      dir,
+		parser.KeyGrokPatternReloadInterval: "1ns",
+	})
+	require.NoError(t, err)
+	got, pattern, err := p.(*Parser).Test("alice 12")
+	assert.NoError(t, err)
+	assert.Equal(t, "%{MY_LOG}", pattern)
+	assert.Equal(t, Data{"user": "alice", "cost": int64(12)}, got)
+
+	// 修改 pattern 文件之后自动重新加载
+	require.NoError(t, ioutil.WriteFile(patternFile, []byte("MY_LOG %{WORD:user} %{WORD:action} %{NUMBER:cost:long}\n"), 0644))
+	datas, err := p.Parse([]string{"alice login 12"})
+	st, ok := err.(*StatsError)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), st.Errors)
+	assert.Equal(t, []Data{{"user": "alice", "action": "login", "cost": int64(12)}}, datas)
+
+	// 修改后的 pattern 无法编译时继续使用原来的 pattern
+	require.NoError(t, ioutil.WriteFile(patternFile, []byte("MY_LOG %{NOT_EXIST:user}\n"), 0644))
+	datas, _ = p.Parse([]string{"bob logout 3"})
+	assert.Equal(t, []Data{{"user": "bob", "action": "logout", "cost": int64(3)}}, datas)
+
+	_, _, err = p.(*Parser).Test("no match")
+	assert.Error(t, err)
+}
@@ -1,8 +1,8 @@
 package json
 
 import (
+	"bytes"
 	"fmt"
-
 	"strings"
 
 	"github.com/json-iterator/go"
@@ -25,6 +25,7 @@ type Parser struct {
 	labels               []parser.Label
 	disableRecordErrData bool
 	jsontool             jsoniter.API
+	transform            *transform // 没有配置展开、数组处理和字段过滤时为 nil
 }
 
 func NewParser(c conf.MapConf) (parser.Parser, error) {
@@ -38,12 +39,17 @@ func NewParser(c conf.MapConf) (parser.Parser, error) {
 	}.Froze()
 
 	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+	transform, err := newTransform(c)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Parser{
 		name:                 name,
 		labels:               labels,
 		jsontool:             jsontool,
 		disableRecordErrData: disableRecordErrData,
+		transform:            transform,
 	}, nil
 }
 
@@ -59,43 +65,85 @@ func (im *Parser) Parse(lines []string) ([]Data, error) {
 	datas := []Data{}
 	se := &StatsError{}
 	for idx, line := range lines {
-		line = strings.TrimSpace(line)
-		if len(line) <= 0 {
-			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
-			continue
-		}
-		data, err1 := im.parseLine(line)
-		if err1 == nil {
-			datas = append(datas, data)
-			se.AddSuccess()
-			continue
-		}
-		mutiData, err2 := im.parseLineMutiData(line)
-		if err2 == nil {
-			datas = append(datas, mutiData...)
-			se.AddSuccess()
-			continue
-		}
-		se.AddErrors()
-		se.ErrorDetail = err1
-		if !im.disableRecordErrData {
-			errData := make(Data)
-			errData[KeyPandoraStash] = line
-			datas = append(datas, errData)
-		} else {
-			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
-		}
+		datas = im.parseOne(datas, se, idx, []byte(strings.TrimSpace(line)))
 	}
 	return datas, se
 }
 
-func (im *Parser) parseLine(line string) (data Data, err error) {
+// ParseBytes 直接解析 []byte 格式的行，解析结果不引用 lines 的内存，调用方可以复用 lines
+func (im *Parser) ParseBytes(lines [][]byte) ([]Data, error) {
+	datas := []Data{}
+	se := &StatsError{}
+	for idx, line := range lines {
+		datas = im.parseOne(datas, se, idx, bytes.TrimSpace(line))
+	}
+	return datas, se
+}
+
+func (im *Parser) parseOne(datas []Data, se *StatsError, idx int, line []byte) []Data {
+	if len(line) <= 0 {
+		se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+		return datas
+	}
+	data, err1 := im.parseLine(line)
+	if err1 == nil {
+		se.AddSuccess()
+		return im.appendData(datas, data)
+	}
+	mutiData, err2 := im.parseLineMutiData(line)
+	if err2 == nil {
+		se.AddSuccess()
+		for _, d := range mutiData {
+			datas = im.appendData(datas, d)
+		}
+		return datas
+	}
+	se.AddErrors()
+	se.ErrorDetail = err1
+	if im.disableRecordErrData {
+		se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+		return datas
+	}
+	errData := make(Data)
+	errData[KeyPandoraStash] = string(line)
+	return append(datas, errData)
+}
+
+func (im *Parser) parseLine(line []byte) (data Data, err error) {
 	data = make(Data)
-	if err = im.jsontool.Unmarshal([]byte(line), &data); err != nil {
-		err = fmt.Errorf("parse json line error %v, raw data is: %v", err, line)
+	if err = im.jsontool.Unmarshal(line, &data); err != nil {
+		err = fmt.Errorf("parse json line error %v, raw data is: %s", err, line)
 		log.Debug(err)
 		return
 	}
+	return
+}
+
+func (im *Parser) parseLineMutiData(line []byte) (data []Data, err error) {
+	data = make([]Data, 0)
+	if err = im.jsontool.Unmarshal(line, &data); err != nil {
+		err = fmt.Errorf("parse json line error %v, raw data is: %s", err, line)
+		log.Debug(err)
+		return
+	}
+	return
+}
+
+// appendData 对解析出的数据做 json_flatten 等处理并加上 labels，追加到 datas
+func (im *Parser) appendData(datas []Data, data Data) []Data {
+	if im.transform == nil {
+		im.addLabels(data)
+		return append(datas, data)
+	}
+	n := len(datas)
+	datas = im.apply(datas, data)
+	for _, d := range datas[n:] {
+		im.addLabels(d)
+	}
+	return datas
+}
+
+func (im *Parser) addLabels(data Data) {
 	for _, l := range im.labels {
 		// label 不覆盖数据，其他parser不需要这么一步检验，因为Schema固定，json的Schema不固定
 		if _, ok := data[l.Name]; ok {
@@ -103,24 +151,39 @@ func (im *Parser) parseLine(line string) (data Data, err error) {
 		}
 		data[l.Name] = l.Value
 	}
-	return
 }
 
-func (im *Parser) parseLineMutiData(line string) (data []Data, err error) {
-	data = make([]Data, 0)
-	if err = im.jsontool.Unmarshal([]byte(line), &data); err != nil {
-		err = fmt.Errorf("parse json line error %v, raw data is: %v", err, line)
-		log.Debug(err)
-		return
-	}
-	for i := range data {
-		for _, l := range im.labels {
-			// label 不覆盖数据，其他parser不需要这么一步检验，因为Schema固定，json的Schema不固定
-			if _, ok := data[i][l.Name]; ok {
-				continue
+// ParseData 处理 reader 直接读出的结构化数据，只需要加上 labels；
+// 带有 KeyPandoraStash 的数据是 reader 无法解析的原始字符串，按 Parse 的逻辑处理，
+// runner 加上的其他字段(如 datasource_tag)复制到解析出的每一条数据中
+func (im *Parser) ParseData(datas []Data) ([]Data, error) {
+	ret := make([]Data, 0, len(datas))
+	se := &StatsError{}
+	for idx, data := range datas {
+		if raw, ok := data[KeyPandoraStash].(string); ok {
+			parsed, err := im.Parse([]string{raw})
+			for _, d := range parsed {
+				for k, v := range data {
+					if k != KeyPandoraStash {
+						d[k] = v
+					}
+				}
+			}
+			ret = append(ret, parsed...)
+			if pse, ok := err.(*StatsError); ok {
+				se.Errors += pse.Errors
+				se.Success += pse.Success
+				if pse.ErrorDetail != nil {
+					se.ErrorDetail = pse.ErrorDetail
+				}
+				if len(pse.DatasourceSkipIndex) > 0 {
+					se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+				}
 			}
-			data[i][l.Name] = l.Value
+			continue
 		}
+		ret = im.appendData(ret, data)
+		se.AddSuccess()
 	}
-	return
+	return ret, se
 }
@@ -303,3 +303,131 @@ func TestParseSpaceJson(t *testing.T) {
 	exp := []Data{}
 	assert.Equal(t, exp, res)
 }
+
+func TestParseData(t *testing.T) {
+	c := conf.MapConf{}
+	c[parser.KeyParserName] = "TestParseData"
+	c[parser.KeyParserType] = "json"
+	c[parser.KeyLabels] = "mm abc"
+	p, _ := NewParser(c)
+	dp, ok := p.(parser.DataParser)
+	assert.True(t, ok)
+
+	res, err := dp.ParseData([]Data{
+		{"a": json.Number("1"), "mm": "keep"},
+		{"b": "x"},
+		{KeyPandoraStash: `[{"c":1},{"c":2}]`},
+		{KeyPandoraStash: "not json"},
+		{KeyPandoraStash: `{"d":1}`, "source": "topic"},
+	})
+	se, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), se.Success)
+	assert.Equal(t, int64(1), se.Errors)
+	assert.Error(t, se.ErrorDetail)
+	assert.Equal(t, []Data{
+		{"a": json.Number("1"), "mm": "keep"},
+		{"b": "x", "mm": "abc"},
+		{"c": json.Number("1"), "mm": "abc"},
+		{"c": json.Number("2"), "mm": "abc"},
+		{KeyPandoraStash: "not json"},
+		// runner 加上的字段保留在解析出的数据中
+		{"d": json.Number("1"), "mm": "abc", "source": "topic"},
+	}, res)
+
+	c[parser.KeyDisableRecordErrData] = "true"
+	p, _ = NewParser(c)
+	res, err = p.(parser.DataParser).ParseData([]Data{{KeyPandoraStash: "not json"}, {"b": "x"}})
+	se, _ = err.(*StatsError)
+	assert.Equal(t, int64(1), se.Errors)
+	assert.Equal(t, []Data{{"b": "x", "mm": "abc"}}, res)
+}
+
+func TestParseBytes(t *testing.T) {
+	p, err := NewParser(conf.MapConf{parser.KeyParserName: "TestParseBytes", parser.KeyLabels: "l1 v1"})
+	assert.NoError(t, err)
+	buf := []byte("{\"a\":\"x\"} \n[{\"a\":1},{\"a\":2}]\n  \nbad\n")
+	lines := bytes.SplitAfter(buf, []byte("\n"))[:4]
+	datas, err := parser.ParseBytes(p, lines)
+	se, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), se.Success)
+	assert.Equal(t, int64(1), se.Errors)
+	assert.Equal(t, []int{2}, se.DatasourceSkipIndex)
+	// 解析结果不能引用 buffer 的内存
+	for i := range buf {
+		buf[i] = 'z'
+	}
+	assert.Equal(t, []Data{
+		{"a": "x", "l1": "v1"},
+		{"a": json.Number("1"), "l1": "v1"},
+		{"a": json.Number("2"), "l1": "v1"},
+		{KeyPandoraStash: "bad"},
+	}, datas)
+}
+
+func TestJsonTransform(t *testing.T) {
+	line := `{"svc":{"name":"api","meta":{"zone":"z1"}},"tags":["a","b"],"items":[{"id":1},{"id":2}],"empty":{},"drop":1}`
+	tests := []struct {
+		conf conf.MapConf
+		exp  []Data
+	}{
+		{
+			conf: conf.MapConf{parser.KeyJSONFlatten: "true"},
+			exp: []Data{{
+				"svc.name":      "api",
+				"svc.meta.zone": "z1",
+				"tags":          []interface{}{"a", "b"},
+				"items":         []interface{}{map[string]interface{}{"id": json.Number("1")}, map[string]interface{}{"id": json.Number("2")}},
+				"empty":         map[string]interface{}{},
+				"drop":          json.Number("1"),
+				"mm":            "abc",
+			}},
+		},
+		{
+			conf: conf.MapConf{
+				parser.KeyJSONFlatten:      "true",
+				parser.KeyJSONFlattenDepth: "1",
+				parser.KeyJSONArrayMode:    parser.JSONArrayModeString,
+				parser.KeyJSONExcludeKeys:  "drop,empty",
+			},
+			exp: []Data{{
+				"svc.name": "api",
+				"svc.meta": map[string]interface{}{"zone": "z1"},
+				"tags":     `["a","b"]`,
+				"items":    `[{"id":1},{"id":2}]`,
+				"mm":       "abc",
+			}},
+		},
+		{
+			conf: conf.MapConf{
+				parser.KeyJSONFlatten:     "true",
+				parser.KeyJSONArrayMode:   parser.JSONArrayModeExplode,
+				parser.KeyJSONArrayField:  "items",
+				parser.KeyJSONIncludeKeys: "svc.name,items.id",
+			},
+			exp: []Data{
+				{"svc.name": "api", "items.id": json.Number("1"), "mm": "abc"},
+				{"svc.name": "api", "items.id": json.Number("2"), "mm": "abc"},
+			},
+		},
+	}
+	for _, ti := range tests {
+		ti.conf[parser.KeyLabels] = "mm abc"
+		p, err := NewParser(ti.conf)
+		assert.NoError(t, err)
+		datas, err := p.Parse([]string{line})
+		se, ok := err.(*StatsError)
+		assert.True(t, ok)
+		assert.Equal(t, int64(1), se.Success)
+		assert.Equal(t, ti.exp, datas)
+
+		datas, err = p.(parser.DataParser).ParseData([]Data{{KeyPandoraStash: line}})
+		assert.Equal(t, ti.exp, datas)
+	}
+
+	_, err := NewParser(conf.MapConf{parser.KeyJSONArrayMode: parser.JSONArrayModeExplode})
+	assert.Error(t, err)
+	_, err = NewParser(conf.MapConf{parser.KeyJSONArrayMode: "unknown"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// flattenSeparator 是展开嵌套字段时连接各层 key 的分隔符
+const flattenSeparator = "."
+
+// transform 是 json_flatten、json_array_mode 以及 json_include_keys/json_exclude_keys 对解析结果的处理，
+// 依次为拆分数组、展开嵌套字段、数组转为字符串，最后按照展开之后的字段名称过滤
+type transform struct {
+	flatten      bool
+	flattenDepth int // 0 表示不限制层数
+	arrayMode    string
+	arrayField   string
+	includeKeys  map[string]bool
+	excludeKeys  map[string]bool
+}
+
+func newTransform(c conf.MapConf) (*transform, error) {
+	flatten, _ := c.GetBoolOr(parser.KeyJSONFlatten, false)
+	flattenDepth, _ := c.GetIntOr(parser.KeyJSONFlattenDepth, 0)
+	if flattenDepth < 0 {
+		return nil, fmt.Errorf("%v must not be negative, got %v", parser.KeyJSONFlattenDepth, flattenDepth)
+	}
+	arrayMode, _ := c.GetStringOr(parser.KeyJSONArrayMode, parser.JSONArrayModeKeep)
+	arrayField, _ := c.GetStringOr(parser.KeyJSONArrayField, "")
+	switch arrayMode {
+	case parser.JSONArrayModeKeep, parser.JSONArrayModeString:
+	case parser.JSONArrayModeExplode:
+		if arrayField == "" {
+			return nil, fmt.Errorf("%v is required when %v is %v", parser.KeyJSONArrayField, parser.KeyJSONArrayMode, arrayMode)
+		}
+	default:
+		return nil, fmt.Errorf("%v %v not supported, must be one of %v, %v, %v", parser.KeyJSONArrayMode, arrayMode,
+			parser.JSONArrayModeKeep, parser.JSONArrayModeExplode, parser.JSONArrayModeString)
+	}
+	includeKeys, _ := c.GetStringListOr(parser.KeyJSONIncludeKeys, []string{})
+	excludeKeys, _ := c.GetStringListOr(parser.KeyJSONExcludeKeys, []string{})
+	if !flatten && arrayMode == parser.JSONArrayModeKeep && len(includeKeys) == 0 && len(excludeKeys) == 0 {
+		return nil, nil
+	}
+	return &transform{
+		flatten:      flatten,
+		flattenDepth: flattenDepth,
+		arrayMode:    arrayMode,
+		arrayField:   arrayField,
+		includeKeys:  keySet(includeKeys),
+		excludeKeys:  keySet(excludeKeys),
+	}, nil
+}
+
+func keySet(keys []string) map[string]bool {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// apply 处理一条解析结果并把得到的数据追加到 datas，拆分数组时一条数据会变成多条
+func (im *Parser) apply(datas []Data, data Data) []Data {
+	t := im.transform
+	if t.arrayMode != parser.JSONArrayModeExplode {
+		return append(datas, im.applyOne(data))
+	}
+	arr, ok := data[t.arrayField].([]interface{})
+	if !ok {
+		return append(datas, im.applyOne(data))
+	}
+	if len(arr) == 0 {
+		delete(data, t.arrayField)
+		return append(datas, im.applyOne(data))
+	}
+	for i, elem := range arr {
+		d := data
+		if i < len(arr)-1 {
+			d = make(Data, len(data))
+			for k, v := range data {
+				d[k] = v
+			}
+		}
+		d[t.arrayField] = elem
+		datas = append(datas, im.applyOne(d))
+	}
+	return datas
+}
+
+func (im *Parser) applyOne(data Data) Data {
+	t := im.transform
+	if t.flatten {
+		flat := make(Data, len(data))
+		for k, v := range data {
+			flattenValue(flat, k, v, 1, t.flattenDepth)
+		}
+		data = flat
+	}
+	if t.arrayMode == parser.JSONArrayModeString {
+		for k, v := range data {
+			if _, ok := v.([]interface{}); !ok {
+				continue
+			}
+			if s, err := json.Marshal(v); err == nil {
+				data[k] = string(s)
+			}
+		}
+	}
+	if t.includeKeys != nil {
+		for k := range data {
+			if !t.includeKeys[k] {
+				delete(data, k)
+			}
+		}
+	}
+	for k := range t.excludeKeys {
+		delete(data, k)
+	}
+	return data
+}
+
+// flattenValue 把嵌套的对象展开为 a.b.c 形式的字段，depth 为当前所在的层数，超过 maxDepth 的对象不再展开，
+// 空对象保留原值
+func flattenValue(dst Data, key string, value interface{}, depth, maxDepth int) {
+	var m map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m = v
+	case Data:
+		m = v
+	}
+	if len(m) == 0 || (maxDepth > 0 && depth > maxDepth) {
+		dst[key] = value
+		return
+	}
+	for k, v := range m {
+		flattenValue(dst, key+flattenSeparator+k, v, depth+1, maxDepth)
+	}
+}
@@ -0,0 +1,205 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// 默认的分隔符和引号
+const (
+	DefaultPairSplitter = " "
+	DefaultKVSplitter   = "="
+	DefaultQuotes       = `"`
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeKV, NewParser)
+}
+
+// Parser 按照配置的分隔符解析键值对，如 a:1|b:2 或者 k1=>"v1"; k2=>"v2"，
+// 引号中的分隔符不会被当做分隔符，所有的值都解析为字符串
+type Parser struct {
+	name                 string
+	pairSplitter         string
+	kvSplitter           string
+	quotes               string
+	trim                 string // 除空白字符以外，key 和 value 两端需要去掉的字符
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	pairSplitter, _ := c.GetStringOr(parser.KeyKVPairSplitter, DefaultPairSplitter)
+	kvSplitter, _ := c.GetStringOr(parser.KeyKVSplitter, DefaultKVSplitter)
+	if pairSplitter == kvSplitter {
+		return nil, fmt.Errorf("%v and %v can not be the same", parser.KeyKVPairSplitter, parser.KeyKVSplitter)
+	}
+	quotes, _ := c.GetStringOr(parser.KeyKVQuotes, DefaultQuotes)
+	trim, _ := c.GetStringOr(parser.KeyKVTrim, "")
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		pairSplitter:         pairSplitter,
+		kvSplitter:           kvSplitter,
+		quotes:               quotes,
+		trim:                 trim,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeKV
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = fmt.Errorf("parse kv line error %v, raw data is: %s", err, line)
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			// schema 不固定，label 不覆盖数据
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+// parse 先按照 pairSplitter 把一行分成多个键值对，再按照每个键值对中第一个 kvSplitter 分成 key 和 value，
+// 空的键值对会被忽略，重复的 key 以最后一个为准
+func (p *Parser) parse(line string) (Data, error) {
+	pairs, err := p.split(line, p.pairSplitter, -1)
+	if err != nil {
+		return nil, err
+	}
+	d := make(Data, len(pairs))
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv, err := p.split(pair, p.kvSplitter, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("pair [%v] has no key value splitter %q", pair, p.kvSplitter)
+		}
+		key := p.unquote(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("pair [%v] has empty key", pair)
+		}
+		d[key] = p.unquote(kv[1])
+	}
+	if len(d) == 0 {
+		return nil, errors.New("no key value pair found")
+	}
+	return d, nil
+}
+
+// split 按照 sep 分隔 s，引号中的 sep 以及反斜杠转义的字符不作为分隔符，n 大于 0 时最多分成 n 段，
+// sep 为空白字符时连续的空白字符作为一个分隔符
+func (p *Parser) split(s, sep string, n int) ([]string, error) {
+	blank := strings.TrimSpace(sep) == ""
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i += 2
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			i++
+			continue
+		}
+		if strings.IndexByte(p.quotes, c) >= 0 {
+			quote = c
+			i++
+			continue
+		}
+		if n > 0 && len(parts) == n-1 {
+			break
+		}
+		if blank && (c == ' ' || c == '\t') {
+			parts = append(parts, s[start:i])
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+				i++
+			}
+			start = i
+			continue
+		}
+		if !blank && strings.HasPrefix(s[i:], sep) {
+			parts = append(parts, s[start:i])
+			i += len(sep)
+			start = i
+			continue
+		}
+		i++
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %q in [%v]", quote, s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unquote 去掉两端的空白字符和 trim 中的字符，被引号括起来时去掉引号并处理引号中的反斜杠转义
+func (p *Parser) unquote(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), p.trim)
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != s[len(s)-1] || strings.IndexByte(p.quotes, s[0]) < 0 {
+		return s
+	}
+	inner := s[1 : len(s)-1]
+	if strings.IndexByte(inner, '\\') < 0 {
+		return inner
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+		}
+		buf.WriteByte(inner[i])
+	}
+	return buf.String()
+}
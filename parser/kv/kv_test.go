@@ -0,0 +1,59 @@
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestKVParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "kv",
+		parser.KeyLabels:     "machine nb110,a ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, parser.TypeKV, p.(parser.ParserType).Type())
+	datas, err := p.Parse([]string{
+		`a=1   msg="hello \"world\"" empty= url=http://x?y=z`,
+		"",
+		"novalue",
+		`a="unterminated`,
+	})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{1}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{"a": "1", "msg": `hello "world"`, "empty": "", "url": "http://x?y=z", "machine": "nb110"},
+		{KeyPandoraStash: "novalue"},
+		{KeyPandoraStash: `a="unterminated`},
+	}, datas)
+}
+
+func TestKVParserSplitters(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyKVPairSplitter: "|",
+		parser.KeyKVSplitter:     ":",
+	})
+	assert.NoError(t, err)
+	datas, _ := p.Parse([]string{"a:1|b:2||time:15:04:05"})
+	assert.Equal(t, []Data{{"a": "1", "b": "2", "time": "15:04:05"}}, datas)
+
+	p, err = NewParser(conf.MapConf{
+		parser.KeyKVPairSplitter: ";",
+		parser.KeyKVSplitter:     "=>",
+		parser.KeyKVQuotes:       `"'`,
+		parser.KeyKVTrim:         "[]",
+	})
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{`k1=>"v1"; k2 => 'a;b' ; [k3]=>[v3]`})
+	assert.Equal(t, []Data{{"k1": "v1", "k2": "a;b", "k3": "v3"}}, datas)
+
+	_, err = NewParser(conf.MapConf{parser.KeyKVPairSplitter: ":", parser.KeyKVSplitter: ":"})
+	assert.Error(t, err)
+}
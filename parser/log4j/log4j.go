@@ -0,0 +1,155 @@
+package log4j
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/times"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// DefaultPattern 是 log4j 文档中常用的 conversion pattern
+const DefaultPattern = "%d [%t] %-5p %c - %m%n"
+
+func init() {
+	parser.RegisterConstructor(parser.TypeLog4j, NewParser)
+}
+
+// Parser 按照 log4j/logback 的 conversion pattern 解析日志，配合 reader 的多行模式使用时，
+// 第一行按照 pattern 解析，之后的行(通常是异常堆栈)放在 exception 字段中
+type Parser struct {
+	name                 string
+	pattern              *conversionPattern
+	location             *time.Location
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	patternStr, _ := c.GetStringOr(parser.KeyLog4jPattern, DefaultPattern)
+	pattern, err := parseConversionPattern(patternStr)
+	if err != nil {
+		return nil, err
+	}
+	timeZone, _ := c.GetStringOr(parser.KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", parser.KeyTimeZone, err)
+	}
+	if location == nil {
+		location = time.Local
+	}
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	for _, k := range pattern.keys {
+		nameMap[k] = struct{}{}
+	}
+	nameMap[KeyException] = struct{}{}
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		pattern:              pattern,
+		location:             location,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeLog4j
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimRight(line, " \t\r\n")
+		if len(strings.TrimSpace(line)) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = err
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+func (p *Parser) parse(line string) (Data, error) {
+	first, rest := line, ""
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		first, rest = line[:i], line[i+1:]
+	}
+	first = strings.TrimRight(first, "\r")
+	m := p.pattern.regex.FindStringSubmatch(first)
+	if m == nil {
+		return nil, fmt.Errorf("log4j parser: line [%v] does not match pattern", first)
+	}
+	d := make(Data, len(m))
+	for i, key := range p.pattern.keys {
+		v := m[i+1]
+		switch key {
+		case KeyTimestamp:
+			t, err := p.parseTime(v)
+			if err != nil {
+				return nil, err
+			}
+			d[key] = t
+		case KeyLine, KeyRelative:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("log4j parser: %v %v is not a number", key, v)
+			}
+			d[key] = n
+		default:
+			d[key] = v
+		}
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		d[KeyException] = rest
+	}
+	return d, nil
+}
+
+func (p *Parser) parseTime(v string) (string, error) {
+	df := p.pattern.date
+	if df.commaFrac {
+		v = strings.Replace(v, ",", ".", -1)
+	}
+	t, err := time.ParseInLocation(df.layout, v, p.location)
+	if err != nil {
+		return "", fmt.Errorf("log4j parser: parse time %v error %v", v, err)
+	}
+	// 只有时间没有日期时使用当天的日期
+	if t.Year() == 0 {
+		now := time.Now().In(p.location)
+		t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), p.location)
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,87 @@
+package log4j
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestLog4jParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "log4j",
+		parser.KeyTimeZone:   "UTC",
+		parser.KeyLabels:     "machine nb110,level ignored",
+	})
+	assert.NoError(t, err)
+	lines := []string{
+		"2018-01-02 15:04:05,123 [main] INFO  com.qiniu.App - started in 3 s",
+		"2018-01-02 15:04:06,000 [pool-1-thread-2] ERROR com.qiniu.App - request failed\njava.lang.IllegalStateException: boom\n\tat com.qiniu.App.run(App.java:42)\n\tat com.qiniu.App.main(App.java:10)\n",
+		"",
+		"\tat com.qiniu.App.run(App.java:42)",
+	}
+	datas, err := p.Parse(lines)
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Success)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, []int{2}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{
+			KeyTimestamp: "2018-01-02T15:04:05.123Z",
+			KeyThread:    "main",
+			KeyLevel:     "INFO",
+			KeyLogger:    "com.qiniu.App",
+			KeyMessage:   "started in 3 s",
+			"machine":    "nb110",
+		},
+		{
+			KeyTimestamp: "2018-01-02T15:04:06Z",
+			KeyThread:    "pool-1-thread-2",
+			KeyLevel:     "ERROR",
+			KeyLogger:    "com.qiniu.App",
+			KeyMessage:   "request failed",
+			KeyException: "java.lang.IllegalStateException: boom\n\tat com.qiniu.App.run(App.java:42)\n\tat com.qiniu.App.main(App.java:10)",
+			"machine":    "nb110",
+		},
+		{KeyPandoraStash: "\tat com.qiniu.App.run(App.java:42)"},
+	}, datas)
+}
+
+func TestLog4jParserLogbackPattern(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyLog4jPattern: "%d{yyyy-MM-dd'T'HH:mm:ss.SSSXXX} %5level [%thread] %logger{36}.%M:%L user=%X{user} - %msg%n",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{"2018-01-02T15:04:05.001+08:00  WARN [http-nio-8080] c.q.Api.handle:57 user=alice - slow request"})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), st.Errors)
+	assert.Equal(t, []Data{{
+		KeyTimestamp: "2018-01-02T15:04:05.001+08:00",
+		KeyLevel:     "WARN",
+		KeyThread:    "http-nio-8080",
+		KeyLogger:    "c.q.Api",
+		KeyMethod:    "handle",
+		KeyLine:      int64(57),
+		"user":       "alice",
+		KeyMessage:   "slow request",
+	}}, datas)
+
+	// 只有时间没有日期时使用当天的日期
+	p, err = NewParser(conf.MapConf{parser.KeyLog4jPattern: "%d{ABSOLUTE} %p %m", parser.KeyTimeZone: "UTC"})
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{"15:04:05,123 DEBUG hello"})
+	now := time.Now().UTC()
+	exp := time.Date(now.Year(), now.Month(), now.Day(), 15, 4, 5, 123000000, time.UTC).Format(time.RFC3339Nano)
+	assert.Equal(t, []Data{{KeyTimestamp: exp, KeyLevel: "DEBUG", KeyMessage: "hello"}}, datas)
+
+	_, err = NewParser(conf.MapConf{parser.KeyLog4jPattern: "%d %unknown %m"})
+	assert.Error(t, err)
+	_, err = NewParser(conf.MapConf{parser.KeyLog4jPattern: "%d{yyyy-MM-dd Q} %m"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+package log4j
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 解析后的字段名称
+const (
+	KeyTimestamp = "timestamp"
+	KeyLevel     = "level"
+	KeyThread    = "thread"
+	KeyLogger    = "logger"
+	KeyClass     = "class"
+	KeyMethod    = "method"
+	KeyFile      = "file"
+	KeyLine      = "line"
+	KeyRelative  = "relative"
+	KeyMessage   = "message"
+	KeyException = "exception"
+)
+
+// conversions 是支持的转换字符到字段和正则表达式的映射，log4j 和 logback 的写法都支持
+var conversions = map[string]struct {
+	key   string
+	regex string
+}{
+	"t": {KeyThread, `(.*?)`}, "thread": {KeyThread, `(.*?)`},
+	"p": {KeyLevel, `([A-Za-z]+)`}, "le": {KeyLevel, `([A-Za-z]+)`}, "level": {KeyLevel, `([A-Za-z]+)`},
+	"c": {KeyLogger, `(\S+)`}, "lo": {KeyLogger, `(\S+)`}, "logger": {KeyLogger, `(\S+)`},
+	"C": {KeyClass, `(\S+)`}, "class": {KeyClass, `(\S+)`},
+	"M": {KeyMethod, `(\S+)`}, "method": {KeyMethod, `(\S+)`},
+	"F": {KeyFile, `(\S+)`}, "file": {KeyFile, `(\S+)`},
+	"L": {KeyLine, `(\d+)`}, "line": {KeyLine, `(\d+)`},
+	"r": {KeyRelative, `(\d+)`}, "relative": {KeyRelative, `(\d+)`},
+	"m": {KeyMessage, `(.*?)`}, "msg": {KeyMessage, `(.*?)`}, "message": {KeyMessage, `(.*?)`},
+}
+
+// 预定义的日期格式
+var namedDateFormats = map[string]string{
+	"":         "yyyy-MM-dd HH:mm:ss,SSS",
+	"ISO8601":  "yyyy-MM-dd HH:mm:ss,SSS",
+	"ABSOLUTE": "HH:mm:ss,SSS",
+	"DATE":     "dd MMM yyyy HH:mm:ss,SSS",
+}
+
+// dateTokens 是 Java SimpleDateFormat 中支持的格式到 Go 时间格式和正则表达式的映射，按长度从长到短匹配
+var dateTokens = []struct {
+	java   string
+	layout string
+	regex  string
+}{
+	{"yyyy", "2006", `\d{4}`},
+	{"EEEE", "Monday", `[A-Za-z]+`},
+	{"MMMM", "January", `[A-Za-z]+`},
+	{"SSS", "000", `\d{3}`},
+	{"MMM", "Jan", `[A-Za-z]{3}`},
+	{"EEE", "Mon", `[A-Za-z]{3}`},
+	{"XXX", "Z07:00", `(?:Z|[+-]\d{2}:\d{2})`},
+	{"yy", "06", `\d{2}`},
+	{"MM", "01", `\d{2}`},
+	{"dd", "02", `\d{2}`},
+	{"HH", "15", `\d{2}`},
+	{"hh", "03", `\d{2}`},
+	{"mm", "04", `\d{2}`},
+	{"ss", "05", `\d{2}`},
+	{"M", "1", `\d{1,2}`},
+	{"d", "2", `\d{1,2}`},
+	{"h", "3", `\d{1,2}`},
+	{"Z", "-0700", `[+-]\d{4}`},
+	{"z", "MST", `[A-Za-z]+`},
+	{"a", "PM", `[AP]M`},
+}
+
+// dateFormat 是转换之后的日期格式，Go 1.9 解析时间时不支持用逗号分隔毫秒，所以解析前把逗号替换为点
+type dateFormat struct {
+	layout    string
+	commaFrac bool
+	regex     string
+}
+
+func parseDateFormat(format string) (*dateFormat, error) {
+	if named, ok := namedDateFormats[format]; ok {
+		format = named
+	}
+	df := &dateFormat{}
+	var layout, regex bytes.Buffer
+	for i := 0; i < len(format); {
+		c := format[i]
+		if c == '\'' {
+			// 单引号中的内容原样输出
+			end := strings.IndexByte(format[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in date format %v", format)
+			}
+			lit := format[i+1 : i+1+end]
+			layout.WriteString(lit)
+			regex.WriteString(regexp.QuoteMeta(lit))
+			i += end + 2
+			continue
+		}
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			if c == ',' && strings.HasPrefix(format[i+1:], "SSS") {
+				df.commaFrac = true
+				c = '.'
+				regex.WriteString(",")
+			} else {
+				regex.WriteString(regexp.QuoteMeta(string(c)))
+			}
+			layout.WriteByte(c)
+			i++
+			continue
+		}
+		matched := false
+		for _, t := range dateTokens {
+			if strings.HasPrefix(format[i:], t.java) {
+				layout.WriteString(t.layout)
+				regex.WriteString(t.regex)
+				i += len(t.java)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("date format %v: unsupported pattern letter %q", format, c)
+		}
+	}
+	df.layout = layout.String()
+	df.regex = regex.String()
+	return df, nil
+}
+
+// conversionPattern 是由 log4j 的 conversion pattern 生成的正则表达式，keys 中依次为每个分组对应的字段
+type conversionPattern struct {
+	regex *regexp.Regexp
+	keys  []string
+	date  *dateFormat
+}
+
+// conversionRegexp 匹配 %-5p、%.30c、%d{yyyy-MM-dd}、%X{user} 这样的转换说明
+var conversionRegexp = regexp.MustCompile(`^%(-?)(\d*)(?:\.\d+)?([a-zA-Z]+)(?:\{([^}]*)\})?`)
+
+func parseConversionPattern(pattern string) (*conversionPattern, error) {
+	cp := &conversionPattern{}
+	var regex bytes.Buffer
+	regex.WriteString(`^`)
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		if c == ' ' || c == '\t' {
+			for i < len(pattern) && (pattern[i] == ' ' || pattern[i] == '\t') {
+				i++
+			}
+			regex.WriteString(`\s+`)
+			continue
+		}
+		if c != '%' {
+			regex.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+			continue
+		}
+		if strings.HasPrefix(pattern[i:], "%%") {
+			regex.WriteString("%")
+			i += 2
+			continue
+		}
+		m := conversionRegexp.FindStringSubmatch(pattern[i:])
+		if m == nil {
+			return nil, fmt.Errorf("invalid conversion at %v of pattern %v", i, pattern)
+		}
+		i += len(m[0])
+		leftAlign, width, name, arg := m[1] == "-", m[2] != "", m[3], m[4]
+		var key, group string
+		switch name {
+		case "n":
+			continue
+		case "d", "date":
+			df, err := parseDateFormat(arg)
+			if err != nil {
+				return nil, err
+			}
+			cp.date = df
+			key, group = KeyTimestamp, "("+df.regex+")"
+		case "X", "mdc":
+			if arg == "" {
+				return nil, fmt.Errorf("%%%v without key is not supported", name)
+			}
+			key, group = arg, `(.*?)`
+		default:
+			conv, ok := conversions[name]
+			if !ok {
+				return nil, fmt.Errorf("conversion %%%v in pattern %v is not supported", name, pattern)
+			}
+			key, group = conv.key, conv.regex
+		}
+		// 指定了宽度时会用空格补齐，右对齐时空格在前面，左对齐时在后面
+		if width && !leftAlign {
+			regex.WriteString(`\s*`)
+		}
+		regex.WriteString(group)
+		if width && leftAlign {
+			regex.WriteString(`\s*`)
+		}
+		cp.keys = append(cp.keys, key)
+	}
+	regex.WriteString(`\s*$`)
+	re, err := regexp.Compile(regex.String())
+	if err != nil {
+		return nil, fmt.Errorf("compile pattern %v error %v", pattern, err)
+	}
+	cp.regex = re
+	return cp, nil
+}
@@ -0,0 +1,163 @@
+package logfmt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeLogfmt, NewParser)
+}
+
+// Parser 解析 logfmt 格式的日志，即 key=value 空格分隔的键值对，value 可以用双引号括起来
+type Parser struct {
+	name                 string
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeLogfmt
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := parseLine(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = fmt.Errorf("parse logfmt line error %v, raw data is: %s", err, line)
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			// 和 json 一样 schema 不固定，label 不覆盖数据
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+// parseLine 按顺序扫描 key=value，只有 key 没有 = 时值为 true，key= 时值为空字符串，
+// 重复的 key 以最后一个为准
+func parseLine(line string) (Data, error) {
+	d := make(Data)
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("unexpected character %q at position %v", line[i], i)
+		}
+		if i >= len(line) || line[i] != '=' {
+			if i < len(line) && line[i] == '"' {
+				return nil, fmt.Errorf("unexpected quote in key at position %v", i)
+			}
+			d[key] = true
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			end, err := quotedEnd(line, i)
+			if err != nil {
+				return nil, err
+			}
+			value, err := strconv.Unquote(line[i:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value of key %v: %v", key, err)
+			}
+			d[key] = value
+			i = end
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		d[key] = inferValue(line[start:i])
+	}
+	if len(d) == 0 {
+		return nil, errors.New("no key=value pair found")
+	}
+	return d, nil
+}
+
+// quotedEnd 返回从 start 开始的双引号字符串结束之后的位置
+func quotedEnd(line string, start int) (int, error) {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted value at position %v", start)
+}
+
+// inferValue 推断没有引号的值的类型，依次尝试 int64、float64 和 bool，都不是时作为字符串
+func inferValue(v string) interface{} {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+	// ParseFloat 也能解析 NaN、Inf 这样的字符串，这里只把包含数字的值当做浮点数
+	if strings.ContainsAny(v, "0123456789") {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	switch v {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return v
+}
@@ -0,0 +1,77 @@
+package logfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "logfmt",
+		parser.KeyLabels:     "machine nb110,level debug",
+	})
+	assert.NoError(t, err)
+	lines := []string{
+		`time=2018-01-02T15:04:05Z level=info msg="request \"finished\"" status=200 duration=0.032 cached=false empty= debug`,
+		`at=error code=H12 desc="Request timeout" method=GET path="/" dyno=web.1 connect=1ms bytes=-1 ratio=1e3 nan=NaN`,
+		"",
+		`msg="unterminated`,
+		`=value`,
+	}
+	datas, err := p.Parse(lines)
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{2}, st.DatasourceSkipIndex)
+
+	expected := []Data{
+		{
+			"time":     "2018-01-02T15:04:05Z",
+			"level":    "info",
+			"msg":      `request "finished"`,
+			"status":   int64(200),
+			"duration": 0.032,
+			"cached":   false,
+			"empty":    "",
+			"debug":    true,
+			"machine":  "nb110",
+		},
+		{
+			"at":      "error",
+			"code":    "H12",
+			"desc":    "Request timeout",
+			"method":  "GET",
+			"path":    "/",
+			"dyno":    "web.1",
+			"connect": "1ms",
+			"bytes":   int64(-1),
+			"ratio":   float64(1000),
+			"nan":     "NaN",
+			"machine": "nb110",
+			"level":   "debug",
+		},
+		{KeyPandoraStash: `msg="unterminated`},
+		{KeyPandoraStash: `=value`},
+	}
+	assert.Equal(t, expected, datas)
+	assert.Equal(t, parser.TypeLogfmt, p.(parser.ParserType).Type())
+}
+
+func TestLogfmtParserDisableRecordErrData(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyDisableRecordErrData: "true",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{`a="b`, `a=1`})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, []int{0}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{{"a": int64(1)}}, datas)
+}
@@ -22,6 +22,30 @@ type Flushable interface {
 	Flush() (Data, error)
 }
 
+// DataParser 可以直接处理 reader.StructuredReader 读出的结构化数据，
+// 返回的结果以及统计信息与把数据序列化后调用 Parse 一致
+type DataParser interface {
+	ParseData(datas []Data) ([]Data, error)
+}
+
+// BytesParser 可以直接解析 []byte 格式的行，runner 会复用 lines 的内存，
+// 所以返回的数据不能引用 lines 中的任何字节
+type BytesParser interface {
+	ParseBytes(lines [][]byte) ([]Data, error)
+}
+
+// ParseBytes 在 p 实现了 BytesParser 时直接解析，否则把每一行拷贝为字符串后调用 Parse
+func ParseBytes(p Parser, lines [][]byte) ([]Data, error) {
+	if bp, ok := p.(BytesParser); ok {
+		return bp.ParseBytes(lines)
+	}
+	strs := make([]string, len(lines))
+	for i, line := range lines {
+		strs[i] = string(line)
+	}
+	return p.Parse(strs)
+}
+
 // conf 字段
 const (
 	KeyParserName           = GlobalKeyName
@@ -30,6 +54,23 @@ const (
 	KeyDisableRecordErrData = "disable_record_errdata"
 )
 
+// 解析之后按照 schema 转换字段类型
+const (
+	KeySchema           = "schema"             // 逗号分隔的 "字段名 类型 [默认值]"，类型为 long/float/bool/date/string
+	KeySchemaOnError    = "schema_on_error"    // 转换失败时的处理方式 drop/label/default
+	KeySchemaErrorLabel = "schema_error_label" // schema_on_error 为 label 时记录错误信息的字段
+)
+
+// KeyAutoLabels 自动添加的标签，逗号分隔，可选 hostname、local_ip、runner_name
+const KeyAutoLabels = "auto_labels"
+
+// 可以自动添加的标签
+const (
+	AutoLabelHostname   = KeyHostName
+	AutoLabelLocalIP    = "local_ip"
+	AutoLabelRunnerName = KeyRunnerName
+)
+
 // parser 的类型
 const (
 	TypeCSV        = "csv"
@@ -44,6 +85,15 @@ const (
 	TypeNginx      = "nginx"
 	TypeSyslog     = "syslog"
 	TypeMySQL      = "mysqllog"
+	TypeErrorLog   = "errorlog"
+	TypeLogfmt     = "logfmt"
+	TypeProtobuf   = "protobuf"
+	TypeAvro       = "avro"
+	TypeW3C        = "w3c"
+	TypeLog4j      = "log4j"
+	TypeKV         = "kv"
+	TypeCEF        = "cef"
+	TypeXML        = "xml"
 )
 
 // 数据常量类型
@@ -54,6 +104,7 @@ const (
 	TypeLong    DataType = "long"
 	TypeString  DataType = "string"
 	TypeDate    DataType = "date"
+	TypeBool    DataType = "bool"
 	TypeJSONMap DataType = "jsonmap"
 )
 
@@ -106,5 +157,9 @@ func (ps *Registry) NewLogParser(conf conf.MapConf) (p Parser, err error) {
 	if !exist {
 		return nil, fmt.Errorf("parser type not supported: %v", t)
 	}
-	return f(conf)
+	p, err = f(conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewSchemaParser(p, conf)
 }
@@ -0,0 +1,256 @@
+package protobuf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// descriptor.proto 中字段的类型和标签，这里只解析 FileDescriptorSet 中解码需要的部分
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+
+	labelRepeated = 3
+)
+
+// messageDesc 是一个消息类型的描述，name 为带 package 的全名，不带开头的 "."
+type messageDesc struct {
+	name     string
+	fields   map[int32]*fieldDesc
+	mapEntry bool
+}
+
+type fieldDesc struct {
+	name     string
+	number   int32
+	typ      int
+	repeated bool
+	typeName string // message 和 enum 类型字段的类型全名，不带开头的 "."
+
+	message *messageDesc // 在 link 中根据 typeName 设置
+	enum    *enumDesc
+}
+
+type enumDesc struct {
+	name   string
+	values map[int32]string
+}
+
+// descriptorSet 包含 FileDescriptorSet 中所有的消息和枚举类型，key 为类型全名
+type descriptorSet struct {
+	messages map[string]*messageDesc
+	enums    map[string]*enumDesc
+}
+
+// parseDescriptorSet 解析 protoc --descriptor_set_out 生成的 FileDescriptorSet，
+// 引用了其他文件中类型的时候需要同时加上 --include_imports
+func parseDescriptorSet(buf []byte) (*descriptorSet, error) {
+	set := &descriptorSet{
+		messages: make(map[string]*messageDesc),
+		enums:    make(map[string]*enumDesc),
+	}
+	err := readFields(buf, func(f wireField) error {
+		// FileDescriptorSet.file = 1
+		if f.number == 1 && f.wireType == wireBytes {
+			return set.parseFile(f.buf)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parse FileDescriptorSet error %v", err)
+	}
+	if err = set.link(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s *descriptorSet) parseFile(buf []byte) error {
+	var pkg string
+	var messages, enums [][]byte
+	err := readFields(buf, func(f wireField) error {
+		if f.wireType != wireBytes {
+			return nil
+		}
+		// FileDescriptorProto: package = 2, message_type = 4, enum_type = 5
+		switch f.number {
+		case 2:
+			pkg = string(f.buf)
+		case 4:
+			messages = append(messages, f.buf)
+		case 5:
+			enums = append(enums, f.buf)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// package 可能出现在 message_type 之后，所以先读完整个文件再解析其中的类型
+	for _, m := range messages {
+		if err = s.parseMessage(pkg, m); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err = s.parseEnum(pkg, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fullName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (s *descriptorSet) parseMessage(scope string, buf []byte) error {
+	m := &messageDesc{fields: make(map[int32]*fieldDesc)}
+	var fields, nested, enums [][]byte
+	err := readFields(buf, func(f wireField) error {
+		if f.wireType != wireBytes {
+			return nil
+		}
+		// DescriptorProto: name = 1, field = 2, nested_type = 3, enum_type = 4, options = 7
+		switch f.number {
+		case 1:
+			m.name = string(f.buf)
+		case 2:
+			fields = append(fields, f.buf)
+		case 3:
+			nested = append(nested, f.buf)
+		case 4:
+			enums = append(enums, f.buf)
+		case 7:
+			// MessageOptions.map_entry = 7
+			return readFields(f.buf, func(o wireField) error {
+				if o.number == 7 && o.wireType == wireVarint {
+					m.mapEntry = o.num != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.name = fullName(scope, m.name)
+	for _, fb := range fields {
+		fd, err := parseField(fb)
+		if err != nil {
+			return fmt.Errorf("parse field of message %v error %v", m.name, err)
+		}
+		m.fields[fd.number] = fd
+	}
+	s.messages[m.name] = m
+	for _, nb := range nested {
+		if err = s.parseMessage(m.name, nb); err != nil {
+			return err
+		}
+	}
+	for _, eb := range enums {
+		if err = s.parseEnum(m.name, eb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseField(buf []byte) (*fieldDesc, error) {
+	fd := &fieldDesc{}
+	err := readFields(buf, func(f wireField) error {
+		// FieldDescriptorProto: name = 1, number = 3, label = 4, type = 5, type_name = 6
+		switch f.number {
+		case 1:
+			fd.name = string(f.buf)
+		case 3:
+			fd.number = int32(f.num)
+		case 4:
+			fd.repeated = f.num == labelRepeated
+		case 5:
+			fd.typ = int(f.num)
+		case 6:
+			fd.typeName = strings.TrimPrefix(string(f.buf), ".")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fd.typ == typeGroup {
+		return nil, fmt.Errorf("group field %v is not supported", fd.name)
+	}
+	return fd, nil
+}
+
+func (s *descriptorSet) parseEnum(scope string, buf []byte) error {
+	e := &enumDesc{values: make(map[int32]string)}
+	err := readFields(buf, func(f wireField) error {
+		// EnumDescriptorProto: name = 1, value = 2; EnumValueDescriptorProto: name = 1, number = 2
+		switch f.number {
+		case 1:
+			e.name = string(f.buf)
+		case 2:
+			var name string
+			var number int32
+			err := readFields(f.buf, func(v wireField) error {
+				switch v.number {
+				case 1:
+					name = string(v.buf)
+				case 2:
+					number = int32(v.num)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			e.values[number] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e.name = fullName(scope, e.name)
+	s.enums[e.name] = e
+	return nil
+}
+
+// link 把 message 和 enum 类型的字段关联到对应的类型描述
+func (s *descriptorSet) link() error {
+	for _, m := range s.messages {
+		for _, fd := range m.fields {
+			switch fd.typ {
+			case typeMessage:
+				if fd.message = s.messages[fd.typeName]; fd.message == nil {
+					return fmt.Errorf("message type %v of field %v.%v not found, add --include_imports when generating descriptor set", fd.typeName, m.name, fd.name)
+				}
+			case typeEnum:
+				// 找不到枚举类型时直接输出数值
+				fd.enum = s.enums[fd.typeName]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package protobuf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func init() {
+	parser.RegisterConstructor(parser.TypeProtobuf, NewParser)
+}
+
+// Parser 根据 FileDescriptorSet 中的消息定义解析 protobuf 编码的数据，字段名称作为 key，
+// 嵌套的消息解析为 map，repeated 字段解析为数组，枚举解析为名称，bytes 字段输出为 base64 字符串，
+// 没有出现在数据中的字段不输出
+type Parser struct {
+	name                 string
+	message              *messageDesc
+	encoding             string
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	descriptorPath, err := c.GetString(parser.KeyProtobufDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	messageName, err := c.GetString(parser.KeyProtobufMessage)
+	if err != nil {
+		return nil, err
+	}
+	encoding, _ := c.GetStringOr(parser.KeyProtobufEncoding, parser.ProtobufEncodingRaw)
+	switch encoding {
+	case parser.ProtobufEncodingRaw, parser.ProtobufEncodingBase64, parser.ProtobufEncodingDelimited:
+	default:
+		return nil, fmt.Errorf("%v %v not supported, must be one of %v, %v, %v", parser.KeyProtobufEncoding, encoding,
+			parser.ProtobufEncodingRaw, parser.ProtobufEncodingBase64, parser.ProtobufEncodingDelimited)
+	}
+	content, err := ioutil.ReadFile(descriptorPath)
+	if err != nil {
+		return nil, fmt.Errorf("read protobuf descriptor set %v error %v", descriptorPath, err)
+	}
+	set, err := parseDescriptorSet(content)
+	if err != nil {
+		return nil, err
+	}
+	message, ok := set.messages[strings.TrimPrefix(messageName, ".")]
+	if !ok {
+		return nil, fmt.Errorf("message %v not found in protobuf descriptor set %v", messageName, descriptorPath)
+	}
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	for _, fd := range message.fields {
+		nameMap[fd.name] = struct{}{}
+	}
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		message:              message,
+		encoding:             encoding,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeProtobuf
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		if p.encoding == parser.ProtobufEncodingBase64 {
+			line = strings.TrimSpace(line)
+		}
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		ds, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = err
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, d := range ds {
+			for _, l := range p.labels {
+				d[l.Name] = l.Value
+			}
+		}
+		se.AddSuccess()
+		datas = append(datas, ds...)
+	}
+	return datas, se
+}
+
+func (p *Parser) parse(line string) ([]Data, error) {
+	var msgs [][]byte
+	switch p.encoding {
+	case parser.ProtobufEncodingBase64:
+		buf, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("decode base64 protobuf data error %v", err)
+		}
+		msgs = [][]byte{buf}
+	case parser.ProtobufEncodingDelimited:
+		var err error
+		if msgs, err = splitDelimited([]byte(line)); err != nil {
+			return nil, fmt.Errorf("split length-prefixed protobuf data error %v", err)
+		}
+	default:
+		msgs = [][]byte{[]byte(line)}
+	}
+	datas := make([]Data, 0, len(msgs))
+	for _, msg := range msgs {
+		m, err := decodeMessage(p.message, msg)
+		if err != nil {
+			return nil, fmt.Errorf("decode protobuf message %v error %v", p.message.name, err)
+		}
+		datas = append(datas, Data(m))
+	}
+	return datas, nil
+}
+
+// decodeMessage 按照消息定义解码一条消息，消息定义中没有的字段被忽略
+func decodeMessage(md *messageDesc, buf []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	err := readFields(buf, func(f wireField) error {
+		fd, ok := md.fields[f.number]
+		if !ok {
+			return nil
+		}
+		if fd.repeated && f.wireType == wireBytes && isPackable(fd.typ) {
+			values, err := decodePacked(fd, f.buf)
+			if err != nil {
+				return err
+			}
+			arr, _ := m[fd.name].([]interface{})
+			m[fd.name] = append(arr, values...)
+			return nil
+		}
+		v, err := decodeValue(fd, f)
+		if err != nil {
+			return err
+		}
+		if fd.typ == typeMessage && fd.message.mapEntry {
+			entry := v.(map[string]interface{})
+			mv, _ := m[fd.name].(map[string]interface{})
+			if mv == nil {
+				mv = make(map[string]interface{})
+				m[fd.name] = mv
+			}
+			// map entry 的 key 为 1，value 为 2，key 统一转为字符串
+			mv[fmt.Sprint(entry[fieldName(fd.message, 1)])] = entry[fieldName(fd.message, 2)]
+			return nil
+		}
+		if fd.repeated {
+			arr, _ := m[fd.name].([]interface{})
+			m[fd.name] = append(arr, v)
+			return nil
+		}
+		m[fd.name] = v
+		return nil
+	})
+	return m, err
+}
+
+func fieldName(md *messageDesc, number int32) string {
+	if fd, ok := md.fields[number]; ok {
+		return fd.name
+	}
+	return ""
+}
+
+func isPackable(typ int) bool {
+	switch typ {
+	case typeString, typeBytes, typeMessage:
+		return false
+	}
+	return true
+}
+
+func wireTypeOf(typ int) int {
+	switch typ {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	}
+	return wireVarint
+}
+
+// decodePacked 解码 packed 编码的 repeated 数值字段
+func decodePacked(fd *fieldDesc, buf []byte) ([]interface{}, error) {
+	var values []interface{}
+	wireType := wireTypeOf(fd.typ)
+	for len(buf) > 0 {
+		f := wireField{number: fd.number, wireType: wireType}
+		var n int
+		var err error
+		switch wireType {
+		case wireFixed64:
+			f.num, err = decodeFixed(buf, 8)
+			n = 8
+		case wireFixed32:
+			f.num, err = decodeFixed(buf, 4)
+			n = 4
+		default:
+			f.num, n, err = decodeVarint(buf)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+		v, err := decodeValue(fd, f)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func decodeValue(fd *fieldDesc, f wireField) (interface{}, error) {
+	if expect := wireTypeOf(fd.typ); f.wireType != expect {
+		return nil, fmt.Errorf("field %v expect wire type %v but got %v", fd.name, expect, f.wireType)
+	}
+	switch fd.typ {
+	case typeDouble:
+		return math.Float64frombits(f.num), nil
+	case typeFloat:
+		return float64(math.Float32frombits(uint32(f.num))), nil
+	case typeInt64, typeSfixed64:
+		return int64(f.num), nil
+	case typeInt32, typeSfixed32:
+		return int64(int32(f.num)), nil
+	case typeUint64, typeFixed64:
+		return f.num, nil
+	case typeUint32, typeFixed32:
+		return int64(uint32(f.num)), nil
+	case typeSint32, typeSint64:
+		return int64(f.num>>1) ^ -int64(f.num&1), nil
+	case typeBool:
+		return f.num != 0, nil
+	case typeEnum:
+		if fd.enum != nil {
+			if name, ok := fd.enum.values[int32(f.num)]; ok {
+				return name, nil
+			}
+		}
+		return int64(int32(f.num)), nil
+	case typeString:
+		return string(f.buf), nil
+	case typeBytes:
+		return base64.StdEncoding.EncodeToString(f.buf), nil
+	case typeMessage:
+		return decodeMessage(fd.message, f.buf)
+	}
+	return nil, fmt.Errorf("field %v has unsupported type %v", fd.name, fd.typ)
+}
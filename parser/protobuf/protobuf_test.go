@@ -0,0 +1,197 @@
+package protobuf
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func appendVarint(buf []byte, x uint64) []byte {
+	for x >= 0x80 {
+		buf = append(buf, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(buf, byte(x))
+}
+
+func appendTag(buf []byte, number, wireType int) []byte {
+	return appendVarint(buf, uint64(number<<3|wireType))
+}
+
+func appendVarintField(buf []byte, number int, x uint64) []byte {
+	return appendVarint(appendTag(buf, number, wireVarint), x)
+}
+
+func appendBytesField(buf []byte, number int, b []byte) []byte {
+	buf = appendVarint(appendTag(buf, number, wireBytes), uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendFixed64Field(buf []byte, number int, x uint64) []byte {
+	buf = appendTag(buf, number, wireFixed64)
+	for i := 0; i < 8; i++ {
+		buf = append(buf, byte(x>>(8*uint(i))))
+	}
+	return buf
+}
+
+func fieldProto(name string, number, label, typ int, typeName string) []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(name))
+	b = appendVarintField(b, 3, uint64(number))
+	b = appendVarintField(b, 4, uint64(label))
+	b = appendVarintField(b, 5, uint64(typ))
+	if typeName != "" {
+		b = appendBytesField(b, 6, []byte(typeName))
+	}
+	return b
+}
+
+// testDescriptorSet 对应下面的 proto 文件
+//
+//	package logs;
+//	message AccessLog {
+//	  enum Level { INFO = 0; ERROR = 1; }
+//	  message Client { string ip = 1; }
+//	  string path = 1;
+//	  int32 status = 2;
+//	  double latency = 3;
+//	  bool cached = 4;
+//	  repeated int64 sizes = 5;
+//	  Level level = 6;
+//	  Client client = 7;
+//	  map<string, string> headers = 8;
+//	  sint64 offset = 9;
+//	  bytes raw = 10;
+//	  repeated string tags = 11;
+//	}
+func testDescriptorSet() []byte {
+	const optional, repeated = 1, 3
+	var level []byte
+	level = appendBytesField(level, 1, []byte("Level"))
+	level = appendBytesField(level, 2, appendVarintField(appendBytesField(nil, 1, []byte("INFO")), 2, 0))
+	level = appendBytesField(level, 2, appendVarintField(appendBytesField(nil, 1, []byte("ERROR")), 2, 1))
+
+	var client []byte
+	client = appendBytesField(client, 1, []byte("Client"))
+	client = appendBytesField(client, 2, fieldProto("ip", 1, optional, typeString, ""))
+
+	var entry []byte
+	entry = appendBytesField(entry, 1, []byte("HeadersEntry"))
+	entry = appendBytesField(entry, 2, fieldProto("key", 1, optional, typeString, ""))
+	entry = appendBytesField(entry, 2, fieldProto("value", 2, optional, typeString, ""))
+	entry = appendBytesField(entry, 7, appendVarintField(nil, 7, 1))
+
+	var msg []byte
+	msg = appendBytesField(msg, 1, []byte("AccessLog"))
+	msg = appendBytesField(msg, 2, fieldProto("path", 1, optional, typeString, ""))
+	msg = appendBytesField(msg, 2, fieldProto("status", 2, optional, typeInt32, ""))
+	msg = appendBytesField(msg, 2, fieldProto("latency", 3, optional, typeDouble, ""))
+	msg = appendBytesField(msg, 2, fieldProto("cached", 4, optional, typeBool, ""))
+	msg = appendBytesField(msg, 2, fieldProto("sizes", 5, repeated, typeInt64, ""))
+	msg = appendBytesField(msg, 2, fieldProto("level", 6, optional, typeEnum, ".logs.AccessLog.Level"))
+	msg = appendBytesField(msg, 2, fieldProto("client", 7, optional, typeMessage, ".logs.AccessLog.Client"))
+	msg = appendBytesField(msg, 2, fieldProto("headers", 8, repeated, typeMessage, ".logs.AccessLog.HeadersEntry"))
+	msg = appendBytesField(msg, 2, fieldProto("offset", 9, optional, typeSint64, ""))
+	msg = appendBytesField(msg, 2, fieldProto("raw", 10, optional, typeBytes, ""))
+	msg = appendBytesField(msg, 2, fieldProto("tags", 11, repeated, typeString, ""))
+	msg = appendBytesField(msg, 3, client)
+	msg = appendBytesField(msg, 3, entry)
+	msg = appendBytesField(msg, 4, level)
+
+	var file []byte
+	file = appendBytesField(file, 1, []byte("logs.proto"))
+	file = appendBytesField(file, 4, msg)
+	file = appendBytesField(file, 2, []byte("logs"))
+	return appendBytesField(nil, 1, file)
+}
+
+func testMessage(path string) []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(path))
+	b = appendVarintField(b, 2, 200)
+	b = appendFixed64Field(b, 3, math.Float64bits(0.25))
+	b = appendVarintField(b, 4, 1)
+	b = appendBytesField(b, 5, appendVarint(appendVarint(nil, 10), 20))
+	b = appendVarintField(b, 5, 30)
+	b = appendVarintField(b, 6, 1)
+	b = appendBytesField(b, 7, appendBytesField(nil, 1, []byte("1.2.3.4")))
+	b = appendBytesField(b, 8, appendBytesField(appendBytesField(nil, 1, []byte("host")), 2, []byte("a.com")))
+	b = appendVarintField(b, 9, 3) // zigzag -2
+	b = appendBytesField(b, 10, []byte{0xff, 0x00})
+	b = appendBytesField(b, 11, []byte("t1"))
+	b = appendBytesField(b, 11, []byte("t2"))
+	b = appendVarintField(b, 99, 1) // 未定义的字段被忽略
+	return b
+}
+
+func expectedData(path string) Data {
+	return Data{
+		"path":    path,
+		"status":  int64(200),
+		"latency": 0.25,
+		"cached":  true,
+		"sizes":   []interface{}{int64(10), int64(20), int64(30)},
+		"level":   "ERROR",
+		"client":  map[string]interface{}{"ip": "1.2.3.4"},
+		"headers": map[string]interface{}{"host": "a.com"},
+		"offset":  int64(-2),
+		"raw":     "/wA=",
+		"tags":    []interface{}{"t1", "t2"},
+		"machine": "nb110",
+	}
+}
+
+func TestProtobufParser(t *testing.T) {
+	dir := "TestProtobufParser"
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+	descPath := filepath.Join(dir, "logs.desc")
+	assert.NoError(t, ioutil.WriteFile(descPath, testDescriptorSet(), 0644))
+
+	c := conf.MapConf{
+		parser.KeyParserName:         "protobuf",
+		parser.KeyProtobufDescriptor: descPath,
+		parser.KeyProtobufMessage:    ".logs.AccessLog",
+		parser.KeyLabels:             "machine nb110,path ignored",
+	}
+	p, err := NewParser(c)
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{string(testMessage("/a")), "", string([]byte{0x0a, 0x05, 'a'})})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), st.Success)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, []int{1}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{expectedData("/a"), {KeyPandoraStash: string([]byte{0x0a, 0x05, 'a'})}}, datas)
+
+	c[parser.KeyProtobufEncoding] = parser.ProtobufEncodingBase64
+	p, err = NewParser(c)
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{base64.StdEncoding.EncodeToString(testMessage("/b")) + "\n"})
+	assert.Equal(t, []Data{expectedData("/b")}, datas)
+
+	c[parser.KeyProtobufEncoding] = parser.ProtobufEncodingDelimited
+	p, err = NewParser(c)
+	assert.NoError(t, err)
+	var delimited []byte
+	for _, path := range []string{"/c", "/d"} {
+		msg := testMessage(path)
+		delimited = append(appendVarint(delimited, uint64(len(msg))), msg...)
+	}
+	datas, _ = p.Parse([]string{string(delimited)})
+	assert.Equal(t, []Data{expectedData("/c"), expectedData("/d")}, datas)
+
+	c[parser.KeyProtobufMessage] = "logs.NotExist"
+	_, err = NewParser(c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// protobuf 编码中的 wire type，group 已经废弃，不支持
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("protobuf data truncated")
+
+// wireField 是按照 wire 格式读出的一个字段，varint 和 fixed 类型的值在 num 中，length-delimited 类型的值在 buf 中
+type wireField struct {
+	number   int32
+	wireType int
+	num      uint64
+	buf      []byte
+}
+
+// decodeVarint 返回 buf 开头的 varint 以及占用的字节数
+func decodeVarint(buf []byte) (uint64, int, error) {
+	var x uint64
+	for i := 0; i < len(buf) && i < 10; i++ {
+		b := buf[i]
+		x |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return x, i + 1, nil
+		}
+	}
+	if len(buf) >= 10 {
+		return 0, 0, errors.New("protobuf varint overflow")
+	}
+	return 0, 0, errTruncated
+}
+
+func decodeFixed(buf []byte, size int) (uint64, error) {
+	if len(buf) < size {
+		return 0, errTruncated
+	}
+	var x uint64
+	for i := size - 1; i >= 0; i-- {
+		x = x<<8 | uint64(buf[i])
+	}
+	return x, nil
+}
+
+// readFields 依次读出一条消息中的所有字段，每读出一个字段调用一次 fn
+func readFields(buf []byte, fn func(f wireField) error) error {
+	for len(buf) > 0 {
+		tag, n, err := decodeVarint(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+		f := wireField{number: int32(tag >> 3), wireType: int(tag & 7)}
+		if f.number <= 0 {
+			return fmt.Errorf("invalid protobuf field number %v", f.number)
+		}
+		switch f.wireType {
+		case wireVarint:
+			if f.num, n, err = decodeVarint(buf); err != nil {
+				return err
+			}
+		case wireFixed64:
+			if f.num, err = decodeFixed(buf, 8); err != nil {
+				return err
+			}
+			n = 8
+		case wireFixed32:
+			if f.num, err = decodeFixed(buf, 4); err != nil {
+				return err
+			}
+			n = 4
+		case wireBytes:
+			var size uint64
+			var m int
+			if size, m, err = decodeVarint(buf); err != nil {
+				return err
+			}
+			if size > uint64(len(buf)-m) {
+				return errTruncated
+			}
+			f.buf = buf[m : m+int(size)]
+			n = m + int(size)
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %v of field %v", f.wireType, f.number)
+		}
+		buf = buf[n:]
+		if err = fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitDelimited 把多条以 varint 长度作为前缀的消息拆开，即 Java 中 writeDelimitedTo 写出的格式
+func splitDelimited(buf []byte) ([][]byte, error) {
+	var msgs [][]byte
+	for len(buf) > 0 {
+		size, n, err := decodeVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if size > uint64(len(buf)-n) {
+			return nil, errTruncated
+		}
+		msgs = append(msgs, buf[n:n+int(size)])
+		buf = buf[n+int(size):]
+	}
+	return msgs, nil
+}
@@ -22,10 +22,15 @@ type Parser struct {
 
 func NewParser(c conf.MapConf) (parser.Parser, error) {
 	name, _ := c.GetStringOr(parser.KeyParserName, "")
-	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
 	withtimestamp, _ := c.GetBoolOr(parser.KeyTimestamp, true)
-	nameMap := make(map[string]struct{})
-	labels := parser.GetLabels(labelList, nameMap)
+	nameMap := map[string]struct{}{parser.KeyRaw: {}}
+	if withtimestamp {
+		nameMap[parser.KeyTimestamp] = struct{}{}
+	}
+	labels, err := parser.NewLabels(c, nameMap)
+	if err != nil {
+		return nil, err
+	}
 
 	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
 
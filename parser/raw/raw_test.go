@@ -1,6 +1,7 @@
 package raw
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -70,3 +71,47 @@ func Test_RawlogParserForErrData(t *testing.T) {
 		t.Fatalf("parse label error")
 	}
 }
+
+func Test_RawlogParseBytes(t *testing.T) {
+	p, err := NewParser(conf.MapConf{parser.KeyTimestamp: "false"})
+	assert.NoError(t, err)
+	buf := []byte("line1\n \nline2")
+	// raw parser 没有实现 BytesParser，ParseBytes 拷贝为字符串后调用 Parse
+	datas, err := parser.ParseBytes(p, [][]byte{buf[:6], buf[6:8], buf[8:]})
+	se, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), se.Success)
+	buf[0] = 'x'
+	assert.Equal(t, []Data{{parser.KeyRaw: "line1\n"}, {parser.KeyRaw: "line2"}}, datas)
+}
+
+func Test_RawlogParserAutoLabels(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyTimestamp:  "false",
+		parser.KeyLabels:     "app logkit,raw ignored",
+		parser.KeyAutoLabels: "hostname, local_ip, runner_name",
+		KeyRunnerName:        "runner1",
+	})
+	assert.NoError(t, err)
+	datas, _ := p.Parse([]string{"line1"})
+	assert.Len(t, datas, 1)
+	hostname, _ := os.Hostname()
+	assert.Equal(t, "line1", datas[0][parser.KeyRaw])
+	assert.Equal(t, "logkit", datas[0]["app"])
+	assert.Equal(t, hostname, datas[0][parser.AutoLabelHostname])
+	assert.NotEmpty(t, datas[0][parser.AutoLabelLocalIP])
+	assert.Equal(t, "runner1", datas[0][parser.AutoLabelRunnerName])
+
+	// 静态标签优先，没有 runner 名称时忽略 runner_name
+	p, err = NewParser(conf.MapConf{
+		parser.KeyTimestamp:  "false",
+		parser.KeyLabels:     "hostname fixed",
+		parser.KeyAutoLabels: "hostname,runner_name",
+	})
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{"line1"})
+	assert.Equal(t, []Data{{parser.KeyRaw: "line1", "hostname": "fixed"}}, datas)
+
+	_, err = NewParser(conf.MapConf{parser.KeyAutoLabels: "mac"})
+	assert.Error(t, err)
+}
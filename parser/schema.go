@@ -0,0 +1,310 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/times"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// schema 中字段转换失败时的处理方式
+const (
+	SchemaOnErrorDrop    = "drop"    // 删除这个字段
+	SchemaOnErrorLabel   = "label"   // 删除这个字段，并把错误信息记录在 schema_error_label 字段中
+	SchemaOnErrorDefault = "default" // 使用 schema 中配置的默认值，没有配置时使用类型的零值
+
+	DefaultSchemaErrorLabel = "schema_error"
+)
+
+type schemaField struct {
+	name       string
+	keys       []string
+	dataType   DataType
+	defaultVal interface{}
+}
+
+// schemaParser 在 Parser 解析之后按照 schema 把字段转换为指定的类型，保证下游得到的字段类型固定，
+// 不改变每一行对应的数据，所以 StatsError 与原来的解析器一致
+type schemaParser struct {
+	Parser
+	fields         []schemaField
+	onError        string
+	errorLabel     string
+	timeZoneOffset int
+	location       *time.Location
+}
+
+// flushableSchemaParser 在原来的解析器是 Flushable 时使用，保证 runner 仍然会发送 flush 信号
+type flushableSchemaParser struct {
+	*schemaParser
+}
+
+// dataSchemaParser 在原来的解析器是 DataParser 时使用，保证 runner 仍然可以直接处理结构化数据
+type dataSchemaParser struct {
+	*schemaParser
+}
+
+// NewSchemaParser 根据 c 中的 schema 配置在 p 之后进行类型转换，没有配置 schema 时直接返回 p
+func NewSchemaParser(p Parser, c conf.MapConf) (Parser, error) {
+	schema, _ := c.GetStringOr(KeySchema, "")
+	if strings.TrimSpace(schema) == "" {
+		return p, nil
+	}
+	fields, err := parseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	onError, _ := c.GetStringOr(KeySchemaOnError, SchemaOnErrorDrop)
+	switch onError {
+	case SchemaOnErrorDrop, SchemaOnErrorLabel, SchemaOnErrorDefault:
+	default:
+		return nil, fmt.Errorf("%v %v is not supported, should be one of %v, %v, %v", KeySchemaOnError, onError, SchemaOnErrorDrop, SchemaOnErrorLabel, SchemaOnErrorDefault)
+	}
+	errorLabel, _ := c.GetStringOr(KeySchemaErrorLabel, DefaultSchemaErrorLabel)
+	timeZoneOffsetRaw, _ := c.GetStringOr(KeyTimeZoneOffset, "")
+	timeZone, _ := c.GetStringOr(KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", KeyTimeZone, err)
+	}
+	sp := &schemaParser{
+		Parser:         p,
+		fields:         fields,
+		onError:        onError,
+		errorLabel:     errorLabel,
+		timeZoneOffset: ParseTimeZoneOffset(timeZoneOffsetRaw),
+		location:       location,
+	}
+	if _, ok := p.(Flushable); ok {
+		return flushableSchemaParser{sp}, nil
+	}
+	if _, ok := p.(DataParser); ok {
+		return dataSchemaParser{sp}, nil
+	}
+	return sp, nil
+}
+
+// parseSchema 解析逗号分隔的 "字段名 类型 [默认值]"，字段名可以用 . 表示嵌套的字段
+func parseSchema(schema string) ([]schemaField, error) {
+	var fields []schemaField
+	for _, f := range strings.Split(schema, ",") {
+		parts := strings.Fields(f)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("%v [%v] should be \"fieldName type [default]\"", KeySchema, f)
+		}
+		sf := schemaField{name: parts[0], keys: GetKeys(parts[0]), dataType: DataType(strings.ToLower(parts[1]))}
+		switch sf.dataType {
+		case TypeLong, TypeFloat, TypeBool, TypeDate, TypeString:
+		default:
+			return nil, fmt.Errorf("%v type %v of field %v is not supported", KeySchema, parts[1], parts[0])
+		}
+		if len(parts) > 2 {
+			raw := strings.Join(parts[2:], " ")
+			v, err := coerceValue(raw, sf.dataType, 0, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%v default value %v of field %v error: %v", KeySchema, raw, parts[0], err)
+			}
+			sf.defaultVal = v
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+func (p *schemaParser) Type() string {
+	if pt, ok := p.Parser.(ParserType); ok {
+		return pt.Type()
+	}
+	return ""
+}
+
+func (p *schemaParser) Parse(lines []string) ([]Data, error) {
+	datas, err := p.Parser.Parse(lines)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+// ParseBytes 在原来的解析器实现了 BytesParser 时仍然直接解析 []byte
+func (p *schemaParser) ParseBytes(lines [][]byte) ([]Data, error) {
+	datas, err := ParseBytes(p.Parser, lines)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+// apply 转换 d 中 schema 配置的字段，不存在的字段保持不存在，解析失败的数据不做转换
+func (p *schemaParser) apply(d Data) {
+	if d == nil {
+		return
+	}
+	if _, ok := d[KeyPandoraStash]; ok {
+		return
+	}
+	m := map[string]interface{}(d)
+	var errMsgs []string
+	for _, f := range p.fields {
+		val, err := GetMapValue(m, f.keys...)
+		if err != nil {
+			continue
+		}
+		v, err := coerceValue(val, f.dataType, p.timeZoneOffset, p.location)
+		if err == nil {
+			SetMapValue(m, v, false, f.keys...)
+			continue
+		}
+		log.Debugf("parser %v convert field %v to %v error %v", p.Name(), f.name, f.dataType, err)
+		switch p.onError {
+		case SchemaOnErrorDefault:
+			SetMapValue(m, f.zeroValue(), false, f.keys...)
+		case SchemaOnErrorLabel:
+			DeleteMapValue(m, f.keys...)
+			errMsgs = append(errMsgs, fmt.Sprintf("%v: %v", f.name, err))
+		default:
+			DeleteMapValue(m, f.keys...)
+		}
+	}
+	if len(errMsgs) > 0 {
+		d[p.errorLabel] = strings.Join(errMsgs, "; ")
+	}
+}
+
+func (f schemaField) zeroValue() interface{} {
+	if f.defaultVal != nil {
+		return f.defaultVal
+	}
+	switch f.dataType {
+	case TypeLong:
+		return int64(0)
+	case TypeFloat:
+		return float64(0)
+	case TypeBool:
+		return false
+	case TypeDate:
+		return time.Now().Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+// coerceValue 把 val 转换为 dataType 对应的类型，long 为 int64，float 为 float64，date 为 RFC3339Nano 格式的字符串
+func coerceValue(val interface{}, dataType DataType, timeZoneOffset int, loc *time.Location) (interface{}, error) {
+	if n, ok := val.(json.Number); ok {
+		val = n.String()
+	}
+	switch dataType {
+	case TypeLong:
+		switch v := val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		case float32, float64:
+			f := toFloat(v)
+			if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int64(f), nil
+		case string:
+			v = strings.TrimSpace(v)
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f != math.Trunc(f) {
+				return nil, fmt.Errorf("%q is not an integer", v)
+			}
+			return int64(f), nil
+		}
+	case TypeFloat:
+		switch v := val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return strconv.ParseFloat(fmt.Sprint(v), 64)
+		case float32, float64:
+			return toFloat(v), nil
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+	case TypeBool:
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			switch fmt.Sprint(v) {
+			case "0":
+				return false, nil
+			case "1":
+				return true, nil
+			}
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		}
+	case TypeDate:
+		var ts time.Time
+		switch v := val.(type) {
+		case time.Time:
+			ts = v
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			t, err := times.StrToTimeInLocation(fmt.Sprint(v), loc)
+			if err != nil {
+				return nil, err
+			}
+			ts = t
+		case string:
+			t, err := times.StrToTimeInLocation(strings.TrimSpace(v), loc)
+			if err != nil {
+				return nil, err
+			}
+			ts = t
+		default:
+			return nil, fmt.Errorf("can not convert %T to %v", val, dataType)
+		}
+		return ts.Add(time.Duration(timeZoneOffset) * time.Hour).Format(time.RFC3339Nano), nil
+	case TypeString:
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case map[string]interface{}, Data, []interface{}:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	}
+	return nil, fmt.Errorf("can not convert %v(%T) to %v", val, val, dataType)
+}
+
+func toFloat(v interface{}) float64 {
+	if f, ok := v.(float32); ok {
+		return float64(f)
+	}
+	return v.(float64)
+}
+
+func (p dataSchemaParser) ParseData(datas []Data) ([]Data, error) {
+	datas, err := p.Parser.(DataParser).ParseData(datas)
+	for _, d := range datas {
+		p.apply(d)
+	}
+	return datas, err
+}
+
+func (p flushableSchemaParser) Flush() (Data, error) {
+	d, err := p.Parser.(Flushable).Flush()
+	p.apply(d)
+	return d, err
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestSchemaParser(t *testing.T) {
+	ps := NewRegistry()
+	assert.NoError(t, ps.RegisterParser("kv", func(conf.MapConf) (Parser, error) { return &kvParser{}, nil }))
+
+	p, err := ps.NewLogParser(conf.MapConf{KeyParserType: "kv"})
+	assert.NoError(t, err)
+	assert.Equal(t, &kvParser{}, p)
+
+	p, err = ps.NewLogParser(conf.MapConf{
+		KeyParserType: "kv",
+		KeySchema:     "a long, b float, c bool, d date, e long",
+		KeyTimeZone:   "+08:00",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "kv", p.(ParserType).Type())
+	_, ok := p.(BytesParser)
+	assert.True(t, ok)
+	datas, err := p.Parse([]string{"a=1 b=1.5 c=true d=2018-01-02T15:04:05 x=y", "a=x b=y c=2 d=z e=1.0", "bad"})
+	se, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), se.Success)
+	assert.Equal(t, []Data{
+		{"a": int64(1), "b": 1.5, "c": true, "d": "2018-01-02T15:04:05+08:00", "x": "y"},
+		// 默认删除转换失败的字段
+		{"e": int64(1)},
+		{KeyPandoraStash: "bad"},
+	}, datas)
+
+	p, err = ps.NewLogParser(conf.MapConf{
+		KeyParserType:       "kv",
+		KeySchema:           "a long, b float 1.5, c bool",
+		KeySchemaOnError:    SchemaOnErrorDefault,
+		KeySchemaErrorLabel: "ignored",
+	})
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{"a=x b=y c=z"})
+	assert.Equal(t, []Data{{"a": int64(0), "b": 1.5, "c": false}}, datas)
+
+	p, err = ps.NewLogParser(conf.MapConf{
+		KeyParserType:       "kv",
+		KeySchema:           "a long, b long",
+		KeySchemaOnError:    SchemaOnErrorLabel,
+		KeySchemaErrorLabel: "err",
+	})
+	assert.NoError(t, err)
+	datas, _ = ParseBytes(p, [][]byte{[]byte("a=x b=2.5 c=1"), []byte("a=1")})
+	assert.Equal(t, []Data{
+		{"c": "1", "err": `a: "x" is not an integer; b: "2.5" is not an integer`},
+		{"a": int64(1)},
+	}, datas)
+
+	p, err = ps.NewLogParser(conf.MapConf{KeyParserType: "kv", KeySchema: "d date"})
+	assert.NoError(t, err)
+	fp := flushableSchemaParser{p.(*schemaParser)}
+	fp.Parser = &flushKvParser{}
+	d, err := fp.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, Data{"msg": "level=warn"}, d)
+
+	for _, c := range []conf.MapConf{
+		{KeyParserType: "kv", KeySchema: "a"},
+		{KeyParserType: "kv", KeySchema: "a jsonmap"},
+		{KeyParserType: "kv", KeySchema: "a long x"},
+		{KeyParserType: "kv", KeySchema: "a long", KeySchemaOnError: "ignore"},
+	} {
+		_, err = ps.NewLogParser(c)
+		assert.Error(t, err, c[KeySchema])
+	}
+}
+
+func TestSchemaParserOptionalInterfaces(t *testing.T) {
+	ps := NewRegistry()
+	assert.NoError(t, ps.RegisterParser("kv", func(conf.MapConf) (Parser, error) { return &kvParser{}, nil }))
+	assert.NoError(t, ps.RegisterParser("datakv", func(conf.MapConf) (Parser, error) { return &dataKvParser{}, nil }))
+
+	p, err := ps.NewLogParser(conf.MapConf{KeyParserType: "datakv", KeySchema: "a long"})
+	assert.NoError(t, err)
+	dp, ok := p.(DataParser)
+	assert.True(t, ok)
+	datas, err := dp.ParseData([]Data{{"level": "info", "a": "1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []Data{{"level": "INFO", "a": int64(1)}}, datas)
+	datas, _ = ParseBytes(p, [][]byte{[]byte("a=2")})
+	assert.Equal(t, []Data{{"bytes": "1", "a": int64(2)}}, datas)
+
+	// 再经过 parser_chain 包装后仍然可以直接处理结构化数据
+	p, err = ps.NewParserChain(p, []ChainConfig{{Field: "msg", Parser: conf.MapConf{KeyParserType: "kv"}}})
+	assert.NoError(t, err)
+	dp, ok = p.(DataParser)
+	assert.True(t, ok)
+	datas, err = dp.ParseData([]Data{{"a": "3", "msg": "b=c"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []Data{{"a": int64(3), "b": "c"}}, datas)
+
+	p, err = ps.NewLogParser(conf.MapConf{KeyParserType: "kv", KeySchema: "a long"})
+	assert.NoError(t, err)
+	_, ok = p.(DataParser)
+	assert.False(t, ok)
+}
+
+func TestCoerceValue(t *testing.T) {
+	loc := time.UTC
+	tests := []struct {
+		val      interface{}
+		dataType DataType
+		exp      interface{}
+	}{
+		{int(3), TypeLong, int64(3)},
+		{float64(3), TypeLong, int64(3)},
+		{json.Number("4"), TypeLong, int64(4)},
+		{" 5 ", TypeLong, int64(5)},
+		{int32(2), TypeFloat, float64(2)},
+		{float32(0.5), TypeFloat, float64(0.5)},
+		{"1e3", TypeFloat, float64(1000)},
+		{1, TypeBool, true},
+		{"false", TypeBool, false},
+		{int64(1514905445), TypeDate, "2018-01-02T15:04:05Z"},
+		{time.Date(2018, 1, 2, 15, 4, 5, 0, loc), TypeDate, "2018-01-02T15:04:05Z"},
+		{12, TypeString, "12"},
+		{map[string]interface{}{"a": 1}, TypeString, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		v, err := coerceValue(tt.val, tt.dataType, 0, loc)
+		assert.NoError(t, err, "%v", tt.val)
+		assert.Equal(t, tt.exp, v, "%v", tt.val)
+	}
+	for _, tt := range []struct {
+		val      interface{}
+		dataType DataType
+	}{
+		{1.5, TypeLong},
+		{true, TypeLong},
+		{"x", TypeFloat},
+		{2, TypeBool},
+		{1.5, TypeDate},
+	} {
+		_, err := coerceValue(tt.val, tt.dataType, 0, loc)
+		assert.Error(t, err, "%v", tt.val)
+	}
+}
@@ -1,11 +1,14 @@
 package parser
 
 import (
+	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/qiniu/logkit/conf"
 	. "github.com/qiniu/logkit/utils/models"
+	utilsos "github.com/qiniu/logkit/utils/os"
 
 	"github.com/qiniu/log"
 )
@@ -60,6 +63,61 @@ func GetLabels(labelList []string, nameMap map[string]struct{}) (labels []Label)
 	return
 }
 
+// NewLabels 根据 labels 和 auto_labels 配置生成标签，labels 中配置的静态标签优先，
+// nameMap 中已经存在的标签名会被忽略
+func NewLabels(c conf.MapConf, nameMap map[string]struct{}) ([]Label, error) {
+	labelList, _ := c.GetStringListOr(KeyLabels, []string{})
+	labels := GetLabels(labelList, nameMap)
+	autoLabels, err := GetAutoLabels(c, nameMap)
+	if err != nil {
+		return nil, err
+	}
+	return append(labels, autoLabels...), nil
+}
+
+// GetAutoLabels 生成 auto_labels 中配置的主机名、本机 IP 和 runner 名称标签，
+// 这些值在创建 parser 时就确定下来，不会在每次解析时重新获取
+func GetAutoLabels(c conf.MapConf, nameMap map[string]struct{}) ([]Label, error) {
+	autoList, _ := c.GetStringListOr(KeyAutoLabels, []string{})
+	labels := make([]Label, 0, len(autoList))
+	for _, name := range autoList {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := nameMap[name]; ok {
+			log.Warnf("auto label %v was duplicated, ignore it", name)
+			continue
+		}
+		var value string
+		switch name {
+		case AutoLabelHostname:
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("get hostname for auto label error: %v", err)
+			}
+			value = hostname
+		case AutoLabelLocalIP:
+			ip, err := utilsos.GetLocalIP()
+			if err != nil {
+				return nil, fmt.Errorf("get local ip for auto label error: %v", err)
+			}
+			value = ip
+		case AutoLabelRunnerName:
+			value, _ = c.GetStringOr(KeyRunnerName, "")
+			if value == "" {
+				log.Warnf("runner name not found, ignore auto label %v", name)
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("auto label %v is not supported, should be one of %v, %v, %v", name, AutoLabelHostname, AutoLabelLocalIP, AutoLabelRunnerName)
+		}
+		nameMap[name] = struct{}{}
+		labels = append(labels, newLabel(name, value))
+	}
+	return labels, nil
+}
+
 func ConvertWebParserConfig(conf conf.MapConf) conf.MapConf {
 	if conf == nil {
 		return conf
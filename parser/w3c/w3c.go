@@ -0,0 +1,237 @@
+package w3c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	"github.com/qiniu/logkit/times"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	fieldsDirective = "#Fields:"
+	nullValue       = "-"
+
+	// KeyTimestamp 是 date 和 time 字段合并之后的时间字段
+	KeyTimestamp = "timestamp"
+	dateField    = "date"
+	timeField    = "time"
+	timeLayout   = "2006-01-02 15:04:05"
+)
+
+// longFields 是按照整数解析的字段，其他字段都是字符串，time-taken 在 IIS 中是毫秒数，其他服务器中可能是秒数，
+// 无法解析为整数时按照浮点数解析
+var longFields = map[string]bool{
+	"s-port":          true,
+	"c-port":          true,
+	"sc-status":       true,
+	"sc-substatus":    true,
+	"sc-win32-status": true,
+	"sc-bytes":        true,
+	"cs-bytes":        true,
+	"time-taken":      true,
+}
+
+func init() {
+	parser.RegisterConstructor(parser.TypeW3C, NewParser)
+}
+
+type w3cField struct {
+	name string // 原始的字段名称，如 cs(User-Agent)
+	key  string // 解析后的字段名称，如 cs_User_Agent
+	long bool
+}
+
+// Parser 解析 W3C 扩展日志格式(IIS 日志)，字段名称从 #Fields: 指令中获取，每次遇到新的 #Fields: 指令都会更新，
+// 所以文件轮转之后字段变化也能正确解析，值为 - 的字段不输出，date 和 time 字段合并为 timestamp
+type Parser struct {
+	name                 string
+	fields               []w3cField // 初始为 w3c_default_fields 中配置的字段
+	location             *time.Location
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	defaultFields, _ := c.GetStringOr(parser.KeyW3CDefaultFields, "")
+	timeZone, _ := c.GetStringOr(parser.KeyTimeZone, "")
+	location, err := times.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("parse key %v error %v", parser.KeyTimeZone, err)
+	}
+	if location == nil {
+		// W3C 格式规定时间为 UTC 时间
+		location = time.UTC
+	}
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		fields:               parseFields(defaultFields),
+		location:             location,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeW3C
+}
+
+func parseFields(s string) []w3cField {
+	names := strings.Fields(s)
+	fields := make([]w3cField, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, w3cField{
+			name: name,
+			key:  strings.TrimRight(PandoraKey(name), "_"),
+			long: longFields[strings.ToLower(name)],
+		})
+	}
+	return fields
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		// #Software、#Version、#Date 等指令只需要跳过
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, fieldsDirective) {
+				p.fields = parseFields(line[len(fieldsDirective):])
+			}
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = err
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+func (p *Parser) parse(line string) (Data, error) {
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("no #Fields directive found before log line [%v], set %v if the log header was already read", line, parser.KeyW3CDefaultFields)
+	}
+	values, err := splitValues(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(p.fields) {
+		return nil, fmt.Errorf("log line [%v] has %v values but #Fields has %v fields", line, len(values), len(p.fields))
+	}
+	d := make(Data, len(values))
+	var date, tm string
+	for i, f := range p.fields {
+		v := values[i]
+		if v == nullValue {
+			continue
+		}
+		switch {
+		case f.name == dateField:
+			date = v
+		case f.name == timeField:
+			tm = v
+		case f.long:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				d[f.key] = n
+			} else if fv, err := strconv.ParseFloat(v, 64); err == nil {
+				d[f.key] = fv
+			} else {
+				return nil, fmt.Errorf("field %v value %v is not a number", f.name, v)
+			}
+		default:
+			d[f.key] = v
+		}
+	}
+	if date != "" && tm != "" {
+		t, err := time.ParseInLocation(timeLayout, date+" "+tm, p.location)
+		if err != nil {
+			return nil, fmt.Errorf("parse date %v time %v error %v", date, tm, err)
+		}
+		d[KeyTimestamp] = t.Format(time.RFC3339Nano)
+	} else if date != "" {
+		d[dateField] = date
+	} else if tm != "" {
+		d[timeField] = tm
+	}
+	return d, nil
+}
+
+// splitValues 按照空格分隔一行数据，W3C 格式允许值用双引号括起来，引号中两个连续的双引号表示一个双引号
+func splitValues(line string) ([]string, error) {
+	var values []string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		if line[i] != '"' {
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			values = append(values, line[start:i])
+			continue
+		}
+		var sb bytes.Buffer
+		closed := false
+		for i++; i < len(line); i++ {
+			if line[i] != '"' {
+				sb.WriteByte(line[i])
+				continue
+			}
+			if i+1 < len(line) && line[i+1] == '"' {
+				sb.WriteByte('"')
+				i++
+				continue
+			}
+			i++
+			closed = true
+			break
+		}
+		if !closed {
+			return nil, errors.New("unterminated quoted value in log line")
+		}
+		values = append(values, sb.String())
+	}
+	return values, nil
+}
@@ -0,0 +1,87 @@
+package w3c
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestW3CParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "w3c",
+		parser.KeyLabels:     "machine nb110",
+	})
+	assert.NoError(t, err)
+	lines := []string{
+		"2018-01-02 15:04:05 GET /before-header 200",
+		"#Software: Microsoft Internet Information Services 10.0",
+		"#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port c-ip cs(User-Agent) sc-status time-taken",
+		"2018-01-02 15:04:05 10.0.0.1 GET /index.html - 80 192.168.1.10 Mozilla/5.0+(Windows+NT+10.0) 200 15",
+		`2018-01-02 15:04:06 10.0.0.1 POST "/a ""b""" q=1 80 192.168.1.11 - 500 0.5`,
+		"2018-01-02 15:04:07 10.0.0.1 GET /short",
+		"",
+		// 文件轮转之后的新文件字段发生了变化
+		"#Fields: time cs-method sc-status sc-bytes",
+		"15:05:00 GET 404 x",
+		"15:05:01 GET 304 0",
+	}
+	datas, err := p.Parse(lines)
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), st.Success)
+	assert.Equal(t, int64(3), st.Errors)
+	assert.Equal(t, []int{1, 2, 6, 7}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{KeyPandoraStash: "2018-01-02 15:04:05 GET /before-header 200"},
+		{
+			"timestamp":     "2018-01-02T15:04:05Z",
+			"s_ip":          "10.0.0.1",
+			"cs_method":     "GET",
+			"cs_uri_stem":   "/index.html",
+			"s_port":        int64(80),
+			"c_ip":          "192.168.1.10",
+			"cs_User_Agent": "Mozilla/5.0+(Windows+NT+10.0)",
+			"sc_status":     int64(200),
+			"time_taken":    int64(15),
+			"machine":       "nb110",
+		},
+		{
+			"timestamp":    "2018-01-02T15:04:06Z",
+			"s_ip":         "10.0.0.1",
+			"cs_method":    "POST",
+			"cs_uri_stem":  `/a "b"`,
+			"cs_uri_query": "q=1",
+			"s_port":       int64(80),
+			"c_ip":         "192.168.1.11",
+			"sc_status":    int64(500),
+			"time_taken":   0.5,
+			"machine":      "nb110",
+		},
+		{KeyPandoraStash: "2018-01-02 15:04:07 10.0.0.1 GET /short"},
+		{KeyPandoraStash: "15:05:00 GET 404 x"},
+		{
+			"time":      "15:05:01",
+			"cs_method": "GET",
+			"sc_status": int64(304),
+			"sc_bytes":  int64(0),
+			"machine":   "nb110",
+		},
+	}, datas)
+}
+
+func TestW3CParserDefaultFields(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyW3CDefaultFields: "date time cs-method sc-status",
+		parser.KeyTimeZone:         "+08:00",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{"2018-01-02 15:04:05 GET 200"})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), st.Errors)
+	assert.Equal(t, []Data{{"timestamp": "2018-01-02T15:04:05+08:00", "cs_method": "GET", "sc_status": int64(200)}}, datas)
+}
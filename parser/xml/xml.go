@@ -0,0 +1,137 @@
+package xml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// KeyText 元素同时有属性或子元素和文本时，文本对应的字段名
+const KeyText = "_text"
+
+func init() {
+	parser.RegisterConstructor(parser.TypeXML, NewParser)
+}
+
+type field struct {
+	name  string
+	xpath *xpath
+}
+
+// Parser 把每一行作为一个 XML 文档解析，默认把根元素的属性和子元素转换为字段，
+// 配置了 xml_xpaths 时只取出 XPath 匹配到的值，如导出为 XML 的 Windows 事件以及 SOAP 日志
+type Parser struct {
+	name                 string
+	fields               []field
+	keepTree             bool
+	attrPrefix           string
+	labels               []parser.Label
+	disableRecordErrData bool
+}
+
+func NewParser(c conf.MapConf) (parser.Parser, error) {
+	name, _ := c.GetStringOr(parser.KeyParserName, "")
+	xpaths, _ := c.GetStringListOr(parser.KeyXMLXPaths, []string{})
+	fields := make([]field, 0, len(xpaths))
+	for _, f := range xpaths {
+		parts := strings.SplitN(f, " ", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("%v [%v] should be \"fieldName xpath\"", parser.KeyXMLXPaths, f)
+		}
+		xp, err := compileXPath(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field{name: parts[0], xpath: xp})
+	}
+	keepTree, _ := c.GetBoolOr(parser.KeyXMLKeepTree, false)
+	attrPrefix, _ := c.GetStringOr(parser.KeyXMLAttrPrefix, "")
+	labelList, _ := c.GetStringListOr(parser.KeyLabels, []string{})
+	nameMap := make(map[string]struct{})
+	labels := parser.GetLabels(labelList, nameMap)
+	disableRecordErrData, _ := c.GetBoolOr(parser.KeyDisableRecordErrData, false)
+
+	return &Parser{
+		name:                 name,
+		fields:               fields,
+		keepTree:             keepTree || len(fields) == 0,
+		attrPrefix:           attrPrefix,
+		labels:               labels,
+		disableRecordErrData: disableRecordErrData,
+	}, nil
+}
+
+func (p *Parser) Name() string {
+	return p.name
+}
+
+func (p *Parser) Type() string {
+	return parser.TypeXML
+}
+
+func (p *Parser) Parse(lines []string) ([]Data, error) {
+	var datas []Data
+	se := &StatsError{}
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 {
+			se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			continue
+		}
+		d, err := p.parse(line)
+		if err != nil {
+			se.AddErrors()
+			se.ErrorDetail = fmt.Errorf("parse xml line error %v, raw data is: %s", err, line)
+			if !p.disableRecordErrData {
+				errData := make(Data)
+				errData[KeyPandoraStash] = line
+				datas = append(datas, errData)
+			} else {
+				se.DatasourceSkipIndex = append(se.DatasourceSkipIndex, idx)
+			}
+			continue
+		}
+		for _, l := range p.labels {
+			// schema 不固定，label 不覆盖数据
+			if _, ok := d[l.Name]; ok {
+				continue
+			}
+			d[l.Name] = l.Value
+		}
+		se.AddSuccess()
+		datas = append(datas, d)
+	}
+	return datas, se
+}
+
+// parse 中 XPath 取出的字段优先于根元素转换出的字段，匹配到多个值时为数组，没有匹配到时没有这个字段
+func (p *Parser) parse(line string) (Data, error) {
+	doc, err := parseDocument(line)
+	if err != nil {
+		return nil, err
+	}
+	d := make(Data)
+	if p.keepTree {
+		root := doc.children[0]
+		switch v := root.toValue(p.attrPrefix).(type) {
+		case map[string]interface{}:
+			d = Data(v)
+		default:
+			d[root.name] = v
+		}
+	}
+	for _, f := range p.fields {
+		values := f.xpath.eval(doc, p.attrPrefix)
+		switch len(values) {
+		case 0:
+		case 1:
+			d[f.name] = values[0]
+		default:
+			d[f.name] = values
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,98 @@
+package xml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/parser"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const winEvent = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Microsoft-Windows-Security-Auditing" Guid="{54849625}"/>
+    <EventID>4624</EventID>
+    <Computer>host01</Computer>
+  </System>
+  <EventData>
+    <Data Name="TargetUserName">admin</Data>
+    <Data Name="LogonType">2</Data>
+  </EventData>
+</Event>`
+
+func TestXMLParser(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyParserName: "xml",
+		parser.KeyLabels:     "machine nb110,System ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, parser.TypeXML, p.(parser.ParserType).Type())
+	datas, err := p.Parse([]string{
+		winEvent,
+		"",
+		`<?xml version="1.0" encoding="UTF-8"?><msg level="info">hello<b>x</b></msg>`,
+		"<a>1</a>",
+		"<a><b></a>",
+		"<a/><b/>",
+	})
+	st, ok := err.(*StatsError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), st.Success)
+	assert.Equal(t, int64(2), st.Errors)
+	assert.Equal(t, []int{1}, st.DatasourceSkipIndex)
+	assert.Equal(t, []Data{
+		{
+			"System": map[string]interface{}{
+				"Provider": map[string]interface{}{"Name": "Microsoft-Windows-Security-Auditing", "Guid": "{54849625}"},
+				"EventID":  "4624",
+				"Computer": "host01",
+			},
+			"EventData": map[string]interface{}{
+				"Data": []interface{}{
+					map[string]interface{}{"Name": "TargetUserName", KeyText: "admin"},
+					map[string]interface{}{"Name": "LogonType", KeyText: "2"},
+				},
+			},
+			"machine": "nb110",
+		},
+		{"level": "info", "b": "x", KeyText: "hello", "machine": "nb110", "System": "ignored"},
+		{"a": "1", "machine": "nb110", "System": "ignored"},
+		{KeyPandoraStash: "<a><b></a>"},
+		{KeyPandoraStash: "<a/><b/>"},
+	}, datas)
+}
+
+func TestXMLParserXPath(t *testing.T) {
+	p, err := NewParser(conf.MapConf{
+		parser.KeyXMLXPaths: "event_id /Event/System/EventID, provider //Provider/@Name, user //Data[@Name='TargetUserName']," +
+			"data /Event/EventData/Data[2]/text(), last //Data[last()]/@Name, names //Data/@Name, system Event/System[Computer='host01']/Computer, none //Missing",
+	})
+	assert.NoError(t, err)
+	datas, err := p.Parse([]string{winEvent})
+	assert.Equal(t, int64(1), err.(*StatsError).Success)
+	assert.Equal(t, []Data{{
+		"event_id": "4624",
+		"provider": "Microsoft-Windows-Security-Auditing",
+		"user":     map[string]interface{}{"Name": "TargetUserName", KeyText: "admin"},
+		"data":     "2",
+		"last":     "LogonType",
+		"names":    []interface{}{"TargetUserName", "LogonType"},
+		"system":   "host01",
+	}}, datas)
+
+	p, err = NewParser(conf.MapConf{
+		parser.KeyXMLXPaths:     "id //EventID",
+		parser.KeyXMLKeepTree:   "true",
+		parser.KeyXMLAttrPrefix: "attr_",
+	})
+	assert.NoError(t, err)
+	datas, _ = p.Parse([]string{`<e x="1"><EventID>2</EventID></e>`})
+	assert.Equal(t, []Data{{"attr_x": "1", "EventID": "2", "id": "2"}}, datas)
+
+	for _, xpaths := range []string{"id", "id /a/@b/c", "id /a[", "id /a[b=c]", "id /a[0]", "id //", "id /@b[1]"} {
+		_, err = NewParser(conf.MapConf{parser.KeyXMLXPaths: xpaths})
+		assert.Error(t, err, xpaths)
+	}
+}
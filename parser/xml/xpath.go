@@ -0,0 +1,373 @@
+package xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// node 是 XML 文档中的元素，只保留本地名称，忽略命名空间
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	children []*node
+	text     string // 直接包含的文本，去掉了两端的空白字符
+}
+
+func (n *node) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// parseDocument 解析 XML 文档，返回一个虚拟的文档节点，根元素是它唯一的子节点
+func parseDocument(s string) (*node, error) {
+	doc := &node{}
+	stack := []*node{doc}
+	texts := []*bytes.Buffer{{}}
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 1 && len(doc.children) > 0 {
+				return nil, errors.New("xml document should have only one root element")
+			}
+			n := &node{name: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs = append(n.attrs, xml.Attr{Name: xml.Name{Local: a.Name.Local}, Value: a.Value})
+			}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+			texts = append(texts, &bytes.Buffer{})
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			n.text = strings.TrimSpace(texts[len(texts)-1].String())
+			stack, texts = stack[:len(stack)-1], texts[:len(texts)-1]
+		case xml.CharData:
+			texts[len(texts)-1].Write(t)
+		}
+	}
+	if len(doc.children) == 0 {
+		return nil, errors.New("no xml element found")
+	}
+	return doc, nil
+}
+
+// toValue 把元素转换为字段的值，没有属性和子元素时是文本，否则是 map，
+// 属性加上 attrPrefix 作为 key，同名的子元素或属性合并为数组，同时还有文本时文本放在 KeyText 中
+func (n *node) toValue(attrPrefix string) interface{} {
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return n.text
+	}
+	m := make(map[string]interface{}, len(n.attrs)+len(n.children))
+	for _, a := range n.attrs {
+		addValue(m, attrPrefix+a.Name.Local, a.Value)
+	}
+	for _, c := range n.children {
+		addValue(m, c.name, c.toValue(attrPrefix))
+	}
+	if n.text != "" {
+		addValue(m, KeyText, n.text)
+	}
+	return m
+}
+
+func addValue(m map[string]interface{}, key string, v interface{}) {
+	old, ok := m[key]
+	if !ok {
+		m[key] = v
+		return
+	}
+	if arr, ok := old.([]interface{}); ok {
+		m[key] = append(arr, v)
+		return
+	}
+	m[key] = []interface{}{old, v}
+}
+
+// xpath 支持的 XPath 子集：/a/b、//b、*、@attr、@*、text()，以及 [n]、[last()]、[@attr]、[@attr='v']、[child='v'] 条件
+type xpath struct {
+	expr  string
+	steps []step
+}
+
+type step struct {
+	descendant bool // 以 // 开始，匹配任意深度的子孙节点
+	name       string
+	attr       bool
+	text       bool
+	predicates []predicate
+}
+
+type predicate struct {
+	index    int // 从 1 开始的位置，-1 表示 last()
+	attr     string
+	child    string
+	value    string
+	hasValue bool
+}
+
+func compileXPath(expr string) (*xpath, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("empty xpath")
+	}
+	s := expr
+	if !strings.HasPrefix(s, "/") {
+		// 相对路径从根元素开始匹配
+		s = "/" + s
+	}
+	var steps []step
+	for len(s) > 0 {
+		var st step
+		switch {
+		case strings.HasPrefix(s, "//"):
+			st.descendant = true
+			s = s[2:]
+		case strings.HasPrefix(s, "/"):
+			s = s[1:]
+		default:
+			return nil, fmt.Errorf("invalid xpath %v", expr)
+		}
+		end := stepEnd(s)
+		part := s[:end]
+		s = s[end:]
+		if err := st.parse(part); err != nil {
+			return nil, fmt.Errorf("invalid xpath %v: %v", expr, err)
+		}
+		if len(steps) > 0 && (steps[len(steps)-1].attr || steps[len(steps)-1].text) {
+			return nil, fmt.Errorf("invalid xpath %v: attribute and text() should be the last step", expr)
+		}
+		steps = append(steps, st)
+	}
+	return &xpath{expr: expr, steps: steps}, nil
+}
+
+// stepEnd 返回下一个不在 [] 中的 / 的位置
+func stepEnd(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			return i
+		}
+	}
+	return len(s)
+}
+
+func (st *step) parse(s string) error {
+	idx := strings.IndexByte(s, '[')
+	name := s
+	if idx >= 0 {
+		name = s[:idx]
+	}
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return errors.New("empty step")
+	case name == "text()":
+		st.text = true
+	case strings.HasPrefix(name, "@"):
+		st.attr = true
+		name = name[1:]
+		if name == "" {
+			return errors.New("empty attribute name")
+		}
+	}
+	if i := strings.IndexByte(name, ':'); i >= 0 && name != "text()" {
+		// 忽略命名空间前缀
+		name = name[i+1:]
+	}
+	st.name = name
+	for idx >= 0 {
+		s = s[idx+1:]
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return errors.New("unterminated [")
+		}
+		p, err := parsePredicate(strings.TrimSpace(s[:end]))
+		if err != nil {
+			return err
+		}
+		st.predicates = append(st.predicates, p)
+		s = s[end+1:]
+		if s == "" {
+			break
+		}
+		if s[0] != '[' {
+			return fmt.Errorf("unexpected %v after predicate", s)
+		}
+		idx = 0
+	}
+	if (st.attr || st.text) && len(st.predicates) > 0 {
+		return errors.New("predicates on attribute or text() are not supported")
+	}
+	return nil
+}
+
+func parsePredicate(s string) (predicate, error) {
+	var p predicate
+	if s == "last()" {
+		p.index = -1
+		return p, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return p, fmt.Errorf("invalid position %v", s)
+		}
+		p.index = n
+		return p, nil
+	}
+	key := s
+	if eq := strings.IndexByte(s, '='); eq >= 0 {
+		key = strings.TrimSpace(s[:eq])
+		v := strings.TrimSpace(s[eq+1:])
+		if len(v) < 2 || (v[0] != '\'' && v[0] != '"') || v[len(v)-1] != v[0] {
+			return p, fmt.Errorf("value in predicate [%v] should be quoted", s)
+		}
+		p.value, p.hasValue = v[1:len(v)-1], true
+	}
+	if strings.HasPrefix(key, "@") {
+		p.attr = key[1:]
+	} else {
+		p.child = key
+	}
+	if p.attr == "" && p.child == "" {
+		return p, fmt.Errorf("invalid predicate [%v]", s)
+	}
+	return p, nil
+}
+
+func (p predicate) match(n *node) bool {
+	if p.attr != "" {
+		v, ok := n.attr(p.attr)
+		return ok && (!p.hasValue || v == p.value)
+	}
+	for _, c := range n.children {
+		if c.name == p.child && (!p.hasValue || c.text == p.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// eval 在文档中查找匹配的节点，元素按 toValue 转换，属性和 text() 为字符串
+func (xp *xpath) eval(doc *node, attrPrefix string) []interface{} {
+	nodes := []*node{doc}
+	for _, st := range xp.steps {
+		if st.descendant {
+			nodes = descendantsOrSelf(nodes)
+		}
+		if st.attr || st.text {
+			var values []interface{}
+			for _, n := range nodes {
+				if st.text {
+					if n.text != "" {
+						values = append(values, n.text)
+					}
+					continue
+				}
+				for _, a := range n.attrs {
+					if st.name == "*" || a.Name.Local == st.name {
+						values = append(values, a.Value)
+					}
+				}
+			}
+			return values
+		}
+		var next []*node
+		for _, n := range nodes {
+			next = append(next, st.children(n)...)
+		}
+		nodes = next
+	}
+	values := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, n.toValue(attrPrefix))
+	}
+	return values
+}
+
+// children 返回 n 中匹配名称和条件的子元素，位置条件按照之前条件过滤后的顺序计算
+func (st step) children(n *node) []*node {
+	var matched []*node
+	for _, c := range n.children {
+		if st.name == "*" || c.name == st.name {
+			matched = append(matched, c)
+		}
+	}
+	for _, p := range st.predicates {
+		if len(matched) == 0 {
+			break
+		}
+		if p.index != 0 {
+			i := p.index
+			if i < 0 {
+				i = len(matched)
+			}
+			if i > len(matched) {
+				return nil
+			}
+			matched = matched[i-1 : i]
+			continue
+		}
+		filtered := matched[:0:0]
+		for _, c := range matched {
+			if p.match(c) {
+				filtered = append(filtered, c)
+			}
+		}
+		matched = filtered
+	}
+	return matched
+}
+
+func descendantsOrSelf(nodes []*node) []*node {
+	seen := make(map[*node]bool)
+	var ret []*node
+	var walk func(n *node)
+	walk = func(n *node) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		ret = append(ret, n)
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return ret
+}
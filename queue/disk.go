@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math/rand"
 	"os"
@@ -18,6 +19,27 @@ import (
 	"github.com/qiniu/logkit/rateio"
 )
 
+// 每条消息的格式为 4 字节长度 + [4 字节 CRC32] + 数据，长度的最高位表示带有 CRC32，
+// 没有该标记的是旧版本写入的消息，读取时不做校验
+const (
+	crcFlag       uint32 = 1 << 31
+	sizeHeaderLen        = 4
+	crcHeaderLen         = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// errCorruptMessage 表示消息长度正常但是 CRC 校验失败，可以跳过这条消息继续读取
+	errCorruptMessage = errors.New("message crc32 mismatch")
+	errInvalidSize    = errors.New("invalid message read size")
+)
+
+// CorruptionCounter 返回读取时跳过的损坏消息数
+type CorruptionCounter interface {
+	Corrupted() int64
+}
+
 // diskQueue implements the BackendQueue interface
 // providing a filesystem backed FIFO queue
 type diskQueue struct {
@@ -30,6 +52,7 @@ type diskQueue struct {
 	writeFileNum int64
 	depth        int64
 	depthMemory  int64
+	corrupted    int64
 
 	sync.RWMutex
 
@@ -130,6 +153,17 @@ func (d *diskQueue) Depth() int64 {
 	return atomic.LoadInt64(&d.depth) + atomic.LoadInt64(&d.depthMemory)
 }
 
+// MemoryDepth returns the depth of the memory channel
+func (d *diskQueue) MemoryDepth() int64 {
+	return atomic.LoadInt64(&d.depthMemory)
+}
+
+// Corrupted returns the number of corrupt messages skipped, a bad file whose
+// message boundaries are lost counts as one
+func (d *diskQueue) Corrupted() int64 {
+	return atomic.LoadInt64(&d.corrupted)
+}
+
 // ReadChan returns the []byte channel for reading data
 func (d *diskQueue) ReadChan() <-chan []byte {
 	return d.readChan
@@ -266,7 +300,6 @@ func (d *diskQueue) skipToNextRWFile() error {
 // while advancing read positions and rolling files, if necessary
 func (d *diskQueue) readOne() ([]byte, error) {
 	var err error
-	var msgSize int32
 
 	if d.readFile == nil {
 		curFileName := d.fileName(d.readFileNum)
@@ -289,29 +322,14 @@ func (d *diskQueue) readOne() ([]byte, error) {
 		d.reader = bufio.NewReader(d.readFile)
 	}
 
-	err = binary.Read(d.reader, binary.BigEndian, &msgSize)
-	if err != nil {
-		d.readFile.Close()
-		d.readFile = nil
-		return nil, err
-	}
-
-	// msgSize 大小不合法，意味着可能磁盘数据损坏，应该立刻报错退出
-	if msgSize < d.minMsgSize || msgSize > d.maxMsgSize {
-		d.readFile.Close()
-		d.readFile = nil
-		return nil, fmt.Errorf("invalid message read size (%d)", msgSize)
-	}
-
-	readBuf := make([]byte, msgSize)
-	_, err = io.ReadFull(d.reader, readBuf)
-	if err != nil {
+	readBuf, totalBytes, _, err := readMessage(d.reader, d.minMsgSize, d.maxMsgSize)
+	if err != nil && err != errCorruptMessage {
 		d.readFile.Close()
 		d.readFile = nil
 		return nil, err
 	}
-
-	totalBytes := int64(4 + msgSize)
+	// CRC 校验失败时消息边界仍然是完整的，先推进 next* 位置，由调用方跳过这条消息
+	corruptErr := err
 
 	// we only advance next* because we have not yet sent this to consumers
 	// (where readFileNum, readPos will actually be advanced)
@@ -333,7 +351,47 @@ func (d *diskQueue) readOne() ([]byte, error) {
 		d.nextReadPos = 0
 	}
 
-	return readBuf, nil
+	return readBuf, corruptErr
+}
+
+// readMessage 读取一条消息，返回消息内容、消息在文件中占用的字节数以及是否带有 CRC32，
+// CRC 校验失败时返回 errCorruptMessage，此时占用的字节数仍然有效
+func readMessage(r io.Reader, minSize, maxSize int32) (data []byte, totalBytes int64, hasCRC bool, err error) {
+	var header [crcHeaderLen]byte
+	if _, err = io.ReadFull(r, header[:sizeHeaderLen]); err != nil {
+		return
+	}
+	raw := binary.BigEndian.Uint32(header[:sizeHeaderLen])
+	hasCRC = raw&crcFlag != 0
+	msgSize := int32(raw &^ crcFlag)
+	// msgSize 大小不合法，意味着可能磁盘数据损坏，无法再找到下一条消息的位置
+	if msgSize < minSize || msgSize > maxSize {
+		return nil, 0, hasCRC, fmt.Errorf("%v (%d)", errInvalidSize, msgSize)
+	}
+	headerLen := sizeHeaderLen
+	if hasCRC {
+		if _, err = io.ReadFull(r, header[sizeHeaderLen:]); err != nil {
+			return
+		}
+		headerLen = crcHeaderLen
+	}
+	data = make([]byte, msgSize)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, 0, hasCRC, err
+	}
+	totalBytes = int64(headerLen) + int64(msgSize)
+	if hasCRC && crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[sizeHeaderLen:]) {
+		err = errCorruptMessage
+	}
+	return
+}
+
+// writeMessageHeader 写入带有 CRC32 的消息头
+func writeMessageHeader(buf *bytes.Buffer, data []byte) {
+	var header [crcHeaderLen]byte
+	binary.BigEndian.PutUint32(header[:sizeHeaderLen], uint32(len(data))|crcFlag)
+	binary.BigEndian.PutUint32(header[sizeHeaderLen:], crc32.Checksum(data, crcTable))
+	buf.Write(header[:])
 }
 
 // writeOne performs a low level filesystem write for a single []byte
@@ -367,10 +425,7 @@ func (d *diskQueue) writeOne(data []byte) error {
 	}
 
 	d.writeBuf.Reset()
-	err = binary.Write(&d.writeBuf, binary.BigEndian, dataLen)
-	if err != nil {
-		return err
-	}
+	writeMessageHeader(&d.writeBuf, data)
 
 	mr := io.MultiReader(&d.writeBuf, bytes.NewReader(data))
 	writer := rateio.NewRateWriter(d.writeFile, d.writeLimit)
@@ -384,7 +439,7 @@ func (d *diskQueue) writeOne(data []byte) error {
 	}
 	writer.Close()
 
-	totalBytes := int64(4 + dataLen)
+	totalBytes := int64(crcHeaderLen) + int64(dataLen)
 	d.writePos += totalBytes
 	atomic.AddInt64(&d.depth, 1)
 
@@ -584,6 +639,19 @@ func (d *diskQueue) moveForward() {
 	d.checkTailCorruption(depth)
 }
 
+// moveToNextReadFile 删除已经读完的文件，从下一个文件开始读
+func (d *diskQueue) moveToNextReadFile() {
+	fn := d.fileName(d.readFileNum)
+	if err := os.Remove(fn); err != nil {
+		log.Warnf("ERROR: failed to Remove(%s) - %s", fn, err)
+	}
+	d.readFileNum++
+	d.readPos = 0
+	d.nextReadFileNum = d.readFileNum
+	d.nextReadPos = 0
+	d.needSync = true
+}
+
 func (d *diskQueue) handleReadError() {
 	// jump to the next read file and rename the current (bad) file
 	if d.readFileNum == d.writeFileNum {
@@ -661,7 +729,20 @@ func (d *diskQueue) ioLoop() {
 			if (d.readFileNum < d.writeFileNum) || (d.readPos < d.writePos) {
 				if d.nextReadPos == d.readPos {
 					dataRead, err = d.readOne()
+					if err == errCorruptMessage {
+						atomic.AddInt64(&d.corrupted, 1)
+						log.Errorf("ERROR: diskqueue(%s) skip corrupt message at %d of %s - %s",
+							d.name, d.readPos, d.fileName(d.readFileNum), err)
+						d.moveForward()
+						continue
+					}
+					if err == io.EOF && d.readFileNum < d.writeFileNum {
+						// 文件刚好在消息边界结束（例如 repair 之后的文件），直接读下一个文件
+						d.moveToNextReadFile()
+						continue
+					}
 					if err != nil {
+						atomic.AddInt64(&d.corrupted, 1)
 						log.Warnf("ERROR: reading from diskqueue(%s) at %d of %s - %s",
 							d.name, d.readPos, d.fileName(d.readFileNum), err)
 						// NOTE: 根据 handleReadError() 的逻辑，只要读发生错误，就会调过当前这个文件，直接开始读下一个文件
@@ -96,7 +96,7 @@ func TestDiskQueueRoll(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 	msg := bytes.Repeat([]byte{0}, 10)
 	ml := int64(len(msg))
-	dq := NewDiskQueue(dqName, tmpDir, 9*(ml+4), int32(ml), 1<<10, 2500, 2500, 2*time.Second, 10*1024*1024, false, 0)
+	dq := NewDiskQueue(dqName, tmpDir, 9*(ml+crcHeaderLen), int32(ml), 1<<10, 2500, 2500, 2*time.Second, 10*1024*1024, false, 0)
 	assert.NotEqual(t, dq, nil)
 	assert.Equal(t, dq.Depth(), int64(0))
 
@@ -256,7 +256,7 @@ func TestDiskQueueCorruption(t *testing.T) {
 	// require a non-zero message length for the corrupt (len 0) test below
 	dq := NewDiskQueue(dqName, tmpDir, 1000, 10, 1<<10, 5, 5, 2*time.Second, 10*1024*1024, false, 0)
 
-	msg := make([]byte, 123) // 127 bytes per message, 8 (1016 bytes) messages per file
+	msg := make([]byte, 123) // 131 bytes per message, 8 (1048 bytes) messages per file
 	for i := 0; i < 25; i++ {
 		dq.Put(msg)
 	}
@@ -464,3 +464,53 @@ func BenchmarkDiskQueueGet(b *testing.B) {
 		<-dq.ReadChan()
 	}
 }
+
+func TestDiskQueueCRC(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("nsq-test-%d", time.Now().UnixNano()))
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dqName := "test_disk_queue_crc"
+	dq := NewDiskQueue(dqName, tmpDir, 1024, 0, 1<<10, 1, 1, 2*time.Second, 10*1024*1024, false, 0)
+	for _, msg := range []string{"aaaa", "bbbb", "cccc"} {
+		assert.NoError(t, dq.Put([]byte(msg)))
+	}
+	dq.Close()
+
+	// 修改第二条消息的内容，长度不变，CRC 校验失败后跳过
+	fn := dq.(*diskQueue).fileName(0)
+	data, err := ioutil.ReadFile(fn)
+	assert.NoError(t, err)
+	data[2*crcHeaderLen+4]++
+	assert.NoError(t, ioutil.WriteFile(fn, data, 0600))
+
+	dq = NewDiskQueue(dqName, tmpDir, 1024, 0, 1<<10, 1, 1, 2*time.Second, 10*1024*1024, false, 0)
+	defer dq.Close()
+	assert.Equal(t, "aaaa", string(<-dq.ReadChan()))
+	assert.Equal(t, "cccc", string(<-dq.ReadChan()))
+	assert.Equal(t, int64(1), dq.(CorruptionCounter).Corrupted())
+	for dq.Depth() != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDiskQueueLegacyFormat(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("nsq-test-%d", time.Now().UnixNano()))
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dqName := "test_disk_queue_legacy"
+	// 旧版本写入的消息只有 4 字节长度
+	legacy := []byte{0, 0, 0, 3, 'o', 'l', 'd'}
+	assert.NoError(t, ioutil.WriteFile(path.Join(tmpDir, dqName+".diskqueue.000000.dat"), legacy, 0600))
+	assert.NoError(t, ioutil.WriteFile(path.Join(tmpDir, dqName+".diskqueue.meta.dat"), []byte("1\n0,0\n0,7\n"), 0600))
+
+	dq := NewDiskQueue(dqName, tmpDir, 1024, 0, 1<<10, 1, 1, 2*time.Second, 10*1024*1024, false, 0)
+	defer dq.Close()
+	assert.NoError(t, dq.Put([]byte("new")))
+	assert.Equal(t, "old", string(<-dq.ReadChan()))
+	assert.Equal(t, "new", string(<-dq.ReadChan()))
+	assert.Equal(t, int64(0), dq.(CorruptionCounter).Corrupted())
+}
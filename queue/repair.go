@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const metaDataFileSuffix = ".diskqueue.meta.dat"
+
+// SegmentReport 是一个 diskqueue 数据文件的检查结果
+type SegmentReport struct {
+	File      string
+	Missing   bool
+	Messages  int64 // 可以正常读取的消息数
+	Legacy    int64 // 其中没有 CRC32 的旧格式消息数
+	Corrupted int64 // CRC32 校验失败的消息数
+	// TruncatedBytes 文件末尾无法解析的字节数，通常是写入时进程崩溃或者长度损坏导致
+	TruncatedBytes int64
+}
+
+// DiskQueueReport 是一个 diskqueue 的检查结果，只检查还没有被读取的部分
+type DiskQueueReport struct {
+	Name         string
+	Depth        int64
+	ReadFileNum  int64
+	ReadPos      int64
+	WriteFileNum int64
+	WritePos     int64
+	Segments     []SegmentReport
+	Messages     int64
+	Corrupted    int64
+}
+
+// Healthy 返回队列是否没有损坏，并且 meta 中记录的深度与实际消息数一致
+func (r *DiskQueueReport) Healthy() bool {
+	if r.Corrupted > 0 || r.Messages != r.Depth {
+		return false
+	}
+	for _, s := range r.Segments {
+		if s.Missing || s.TruncatedBytes > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DiskQueueNames 返回 dataPath 下所有 diskqueue 的名称
+func DiskQueueNames(dataPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dataPath, "*"+metaDataFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(m), metaDataFileSuffix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// InspectDiskQueue 检查 diskqueue 中未读取的数据，不会修改任何文件
+func InspectDiskQueue(dataPath, name string) (*DiskQueueReport, error) {
+	return scanDiskQueue(dataPath, name, false)
+}
+
+// RepairDiskQueue 去掉 diskqueue 中损坏的消息，把剩余的消息以带 CRC32 的格式重新写入，
+// 并修正 meta 中的读写位置和深度。需要在使用该队列的 logkit 停止后执行，返回的是修复前的检查结果
+func RepairDiskQueue(dataPath, name string) (*DiskQueueReport, error) {
+	return scanDiskQueue(dataPath, name, true)
+}
+
+func scanDiskQueue(dataPath, name string, repair bool) (*DiskQueueReport, error) {
+	d := &diskQueue{name: name, dataPath: dataPath}
+	if err := d.retrieveMetaData(); err != nil {
+		return nil, fmt.Errorf("read diskqueue %v meta error %v", name, err)
+	}
+	report := &DiskQueueReport{
+		Name:         name,
+		Depth:        d.depth,
+		ReadFileNum:  d.readFileNum,
+		ReadPos:      d.readPos,
+		WriteFileNum: d.writeFileNum,
+		WritePos:     d.writePos,
+	}
+	var depth, lastSize int64
+	for num := d.readFileNum; num <= d.writeFileNum; num++ {
+		var start int64
+		if num == d.readFileNum {
+			start = d.readPos
+		}
+		var out *bytes.Buffer
+		if repair {
+			out = &bytes.Buffer{}
+		}
+		seg, err := scanSegment(d.fileName(num), start, out)
+		if err != nil {
+			return nil, err
+		}
+		report.Segments = append(report.Segments, seg)
+		report.Messages += seg.Messages
+		report.Corrupted += seg.Corrupted
+		if !repair {
+			continue
+		}
+		// 缺失或者为空的文件写成空文件，读取时会直接跳到下一个文件
+		if err = writeFileAtomic(d.fileName(num), out.Bytes()); err != nil {
+			return nil, err
+		}
+		depth += seg.Messages
+		lastSize = int64(out.Len())
+	}
+	if repair {
+		d.depth = depth
+		d.readPos = 0
+		d.writePos = lastSize
+		if err := d.persistMetaData(); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// scanSegment 从 start 开始读取数据文件中的消息，out 不为 nil 时把有效的消息写入 out
+func scanSegment(fileName string, start int64, out *bytes.Buffer) (seg SegmentReport, err error) {
+	seg.File = fileName
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		seg.Missing = true
+		return seg, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	// 写入的数据没有落盘时 meta 中的位置可能超过文件大小
+	if start > info.Size() {
+		return seg, nil
+	}
+	if _, err = f.Seek(start, io.SeekStart); err != nil {
+		return
+	}
+	r := bufio.NewReader(f)
+	pos := start
+	for pos < info.Size() {
+		maxSize := info.Size() - pos
+		if maxSize > math.MaxInt32 {
+			maxSize = math.MaxInt32
+		}
+		data, totalBytes, hasCRC, rerr := readMessage(r, 0, int32(maxSize))
+		if rerr == errCorruptMessage {
+			seg.Corrupted++
+			pos += totalBytes
+			continue
+		}
+		if rerr != nil {
+			// 消息边界已经无法确定，剩余的数据全部丢弃
+			seg.TruncatedBytes = info.Size() - pos
+			break
+		}
+		seg.Messages++
+		if !hasCRC {
+			seg.Legacy++
+		}
+		pos += totalBytes
+		if out != nil {
+			writeMessageHeader(out, data)
+			out.Write(data)
+		}
+	}
+	return seg, nil
+}
+
+func writeFileAtomic(fileName string, data []byte) error {
+	tmpFileName := fileName + ".repair.tmp"
+	f, err := os.OpenFile(tmpFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpFileName)
+		return err
+	}
+	f.Sync()
+	f.Close()
+	return AtomicRename(tmpFileName, fileName)
+}
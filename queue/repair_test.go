@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairDiskQueue(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestRepairDiskQueue")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dqName := "test_repair"
+	// 每条消息 8+2 字节，每个文件 3 条消息
+	newQueue := func() BackendQueue {
+		return NewDiskQueue(dqName, tmpDir, 25, 0, 1<<10, 1, 1, 2*time.Second, 10*1024*1024, false, 0)
+	}
+	dq := newQueue()
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, dq.Put([]byte(fmt.Sprintf("m%d", i))))
+	}
+	assert.Equal(t, "m0", string(<-dq.ReadChan()))
+	dq.Close()
+
+	// 第一个文件的 m1 CRC 损坏，第二个文件的 m5 被截断
+	d := dq.(*diskQueue)
+	data, err := ioutil.ReadFile(d.fileName(0))
+	assert.NoError(t, err)
+	data[10+crcHeaderLen]++
+	assert.NoError(t, ioutil.WriteFile(d.fileName(0), data, 0600))
+	assert.NoError(t, os.Truncate(d.fileName(1), 25))
+
+	names, err := DiskQueueNames(tmpDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dqName}, names)
+
+	report, err := InspectDiskQueue(tmpDir, dqName)
+	assert.NoError(t, err)
+	assert.False(t, report.Healthy())
+	assert.Equal(t, int64(7), report.Depth)
+	assert.Equal(t, int64(5), report.Messages)
+	assert.Equal(t, int64(1), report.Corrupted)
+	assert.Len(t, report.Segments, 3)
+	assert.Equal(t, int64(5), report.Segments[1].TruncatedBytes)
+
+	_, err = RepairDiskQueue(tmpDir, dqName)
+	assert.NoError(t, err)
+	report, err = InspectDiskQueue(tmpDir, dqName)
+	assert.NoError(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, int64(5), report.Depth)
+
+	dq = newQueue()
+	defer dq.Close()
+	for _, msg := range []string{"m2", "m3", "m4", "m6", "m7"} {
+		assert.Equal(t, msg, string(<-dq.ReadChan()))
+	}
+	assert.NoError(t, dq.Put([]byte("m8")))
+	assert.Equal(t, "m8", string(<-dq.ReadChan()))
+	assert.Equal(t, int64(0), dq.(CorruptionCounter).Corrupted())
+
+	_, err = InspectDiskQueue(tmpDir, "notexist")
+	assert.Error(t, err)
+}
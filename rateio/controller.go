@@ -16,31 +16,40 @@ type Controller struct {
 	cond          *sync.Cond
 	done          chan struct{}
 	ratePerSecond int
-	closeOnce     *sync.Once
+	closed        bool
+	closeOnce     sync.Once
 }
 
-func NewController(ratePerSecond int) *Controller {
+func windowCapacity(ratePerSecond int) int {
 	capacity := ratePerSecond * int(Window) / int(time.Second)
 	if capacity < 64 {
 		capacity = 64
 	}
+	return capacity
+}
+
+func NewController(ratePerSecond int) *Controller {
+	capacity := windowCapacity(ratePerSecond)
 	self := &Controller{
 		ratePerSecond: ratePerSecond,
 		threshold:     capacity,
 		capacity:      capacity,
 		cond:          sync.NewCond(new(sync.Mutex)),
 		done:          make(chan struct{}, 1),
-		closeOnce:     &sync.Once{},
 	}
-	go self.run(capacity)
+	go self.run()
 	return self
 }
 
 func (self *Controller) assign(size int) int {
 	self.cond.L.Lock()
-	for self.capacity == 0 {
+	for self.capacity == 0 && self.ratePerSecond > 0 && !self.closed {
 		self.cond.Wait()
 	}
+	if self.ratePerSecond <= 0 || self.closed {
+		self.cond.L.Unlock()
+		return size
+	}
 	if size > self.capacity {
 		size = self.capacity
 	}
@@ -63,30 +72,41 @@ func (self *Controller) fill(size int) {
 	self.cond.Broadcast()
 }
 
-func (self *Controller) run(capacity int) {
+func (self *Controller) run() {
 	t := time.NewTicker(Window)
 	for {
 		select {
 		case <-t.C:
 			self.cond.L.Lock()
-			self.capacity = capacity
+			self.capacity = self.threshold
 			self.cond.L.Unlock()
 			self.cond.Broadcast()
 		case <-self.done:
 			t.Stop()
-			// 认为Close一定发生在所有Read之后
 			return
 		}
 	}
 }
 
+// Close 之后不再限速，正在等待的 Read、Write 和 Wait 会立即返回，避免 goroutine 一直阻塞
 func (self *Controller) Close() error {
 	self.closeOnce.Do(func() {
+		self.cond.L.Lock()
+		self.closed = true
+		self.cond.L.Unlock()
+		self.cond.Broadcast()
 		self.done <- struct{}{}
 	})
 	return nil
 }
 
+// Wait blocks until size bytes can be consumed within the rate limit.
+func (self *Controller) Wait(size int) {
+	for size > 0 {
+		size -= self.assign(size)
+	}
+}
+
 func (self *Controller) Reader(underlying io.Reader) io.Reader {
 	return &rateReader{
 		underlying: underlying,
@@ -102,5 +122,20 @@ func (self *Controller) Writer(underlying io.Writer) io.Writer {
 }
 
 func (self *Controller) GetRateLimit() int {
+	self.cond.L.Lock()
+	defer self.cond.L.Unlock()
 	return self.ratePerSecond
 }
+
+// SetRateLimit changes the rate at runtime, readers and writers blocked by the
+// old rate are woken up. A ratePerSecond not greater than 0 disables the limit.
+func (self *Controller) SetRateLimit(ratePerSecond int) {
+	self.cond.L.Lock()
+	self.ratePerSecond = ratePerSecond
+	if ratePerSecond > 0 {
+		self.threshold = windowCapacity(ratePerSecond)
+		self.capacity = self.threshold
+	}
+	self.cond.L.Unlock()
+	self.cond.Broadcast()
+}
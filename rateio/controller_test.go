@@ -99,3 +99,65 @@ func TestControllerWriter(t *testing.T) {
 		assert.Equal(t, b, b2.Bytes())
 	}
 }
+
+func TestControllerWait(t *testing.T) {
+	c := NewController(1024 * 1024)
+	defer c.Close()
+	start := time.Now()
+	c.Wait(512 * 1024)
+	c.Wait(512 * 1024)
+	elapsed := time.Since(start)
+	assert.True(t, elapsed > 800*time.Millisecond, elapsed)
+	assert.True(t, elapsed < 1500*time.Millisecond, elapsed)
+}
+
+func TestControllerSetRateLimit(t *testing.T) {
+	c := NewController(64 * 1024)
+	defer c.Close()
+
+	// a waiter blocked by the low rate is released when the limit is removed
+	done := make(chan struct{})
+	go func() {
+		c.Wait(64 * 1024 * 1024)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	c.SetRateLimit(0)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not released after the limit is removed")
+	}
+	assert.Equal(t, 0, c.GetRateLimit())
+
+	c.SetRateLimit(1024 * 1024)
+	assert.Equal(t, 1024*1024, c.GetRateLimit())
+	start := time.Now()
+	c.Wait(512 * 1024)
+	c.Wait(512 * 1024)
+	elapsed := time.Since(start)
+	assert.True(t, elapsed > 800*time.Millisecond, elapsed)
+	assert.True(t, elapsed < 1500*time.Millisecond, elapsed)
+}
+
+func TestControllerClose(t *testing.T) {
+	c := NewController(64 * 1024)
+
+	// a waiter blocked by the rate limit is released when the controller is closed
+	done := make(chan struct{})
+	go func() {
+		c.Wait(64 * 1024 * 1024)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, c.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiter is not released after the controller is closed")
+	}
+
+	// Wait after Close returns immediately and Close can be called again
+	c.Wait(64 * 1024 * 1024)
+	assert.NoError(t, c.Close())
+}
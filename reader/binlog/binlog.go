@@ -0,0 +1,730 @@
+// Package binlog 作为 MySQL 的从库读取 binlog，把 ROW 格式中每一行的插入、更新、删除转为一条结构化的数据，
+// 读取的位置 (binlog 文件名和位置，或者 gtid 集合) 在 SyncMeta 时保存，重启后从上次的位置继续读取
+package binlog
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/json-iterator/go"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// positionFile 是 meta 中保存读取位置的文件名
+	positionFile   = "mysql.binlog"
+	connectTimeout = 10 * time.Second
+	reconnectDelay = 3 * time.Second
+	// heartbeatPeriod 是要求主库在没有新事件时发送心跳的间隔，超过 readTimeout 没有收到任何事件认为连接已经断开
+	heartbeatPeriod = 10 * time.Second
+	readTimeout     = 3 * heartbeatPeriod
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeMySQLBinlog, NewReader)
+}
+
+// position 是读取到的位置，Pos 是当前事务开始的位置，Skip 是这个事务中已经读取的行数，
+// GTIDSet 是当前事务之前已经执行的事务，重启后从事务的开始重新读取并跳过已经读取的行
+type position struct {
+	File    string `json:"file"`
+	Pos     uint32 `json:"pos"`
+	GTIDSet string `json:"gtid_set,omitempty"`
+	Skip    int    `json:"skip,omitempty"`
+}
+
+// rowEvent 是一行数据的变化以及读取到这一行后的位置，data 为空时只更新位置
+type rowEvent struct {
+	data  Data
+	bytes int64
+	pos   position
+}
+
+var _ reader.StructuredReader = &Reader{}
+
+type Reader struct {
+	meta      *reader.Meta
+	addr      string
+	network   string
+	user      string
+	password  string
+	tlsConfig *tls.Config
+	db        *sql.DB
+	serverID  uint32
+	tables    []string
+	useGTID   bool
+
+	status   int32
+	readChan chan rowEvent
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mux  sync.Mutex
+	conn *conn
+	// pos 是 SyncMeta 时需要保存的位置，synced 是最后一次保存的位置
+	pos    position
+	synced position
+	// sent 是最后放入 readChan 的位置，重新连接时从这个位置继续，只在读取 binlog 的 goroutine 中使用
+	sent position
+
+	// columns 缓存从 information_schema 查询到的列信息，执行 DDL 后清空
+	columns map[string][]*column
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	datasource, err := c.GetString(reader.KeyMysqlDataSource)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := mysql.ParseDSN(datasource + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", reader.KeyMysqlDataSource, err)
+	}
+	var tlsConfig *tls.Config
+	switch strings.ToLower(cfg.TLSConfig) {
+	case "", "false":
+	case "true":
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		tlsConfig = &tls.Config{ServerName: host}
+	case "skip-verify":
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	default:
+		return nil, fmt.Errorf("tls config %q not supported, should be true or skip-verify", cfg.TLSConfig)
+	}
+	serverID, _ := c.GetIntOr(reader.KeyMySQLBinlogServerID, 0)
+	if serverID < 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeyMySQLBinlogServerID)
+	}
+	if serverID == 0 {
+		// server id 在复制拓扑中需要唯一，默认根据 runner 名称生成
+		serverID = int(crc32.ChecksumIEEE([]byte("logkit_"+meta.RunnerName))&0x7fffffff | 1)
+	}
+	tables, _ := c.GetStringListOr(reader.KeyMySQLBinlogTables, nil)
+	for _, pattern := range tables {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, ".") {
+			return nil, fmt.Errorf("invalid %v pattern %q, should be like db.table or db.*", reader.KeyMySQLBinlogTables, pattern)
+		}
+	}
+	useGTID, _ := c.GetBoolOr(reader.KeyMySQLBinlogGTID, false)
+
+	cfg.DBName = "information_schema"
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{
+		meta:      meta,
+		addr:      cfg.Addr,
+		network:   cfg.Net,
+		user:      cfg.User,
+		password:  cfg.Passwd,
+		tlsConfig: tlsConfig,
+		db:        db,
+		serverID:  uint32(serverID),
+		tables:    tables,
+		useGTID:   useGTID,
+		status:    reader.StatusInit,
+		readChan:  make(chan rowEvent),
+		done:      make(chan struct{}),
+		columns:   make(map[string][]*column),
+	}
+	r.pos = r.loadPosition()
+	r.synced = r.pos
+	r.sent = r.pos
+	return r, nil
+}
+
+// loadPosition 读取 meta 中保存的位置
+func (r *Reader) loadPosition() position {
+	data, err := r.meta.ReadValue(positionFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Runner[%v] %v read meta error: %v, omit meta data...", r.meta.RunnerName, r.Name(), err)
+		}
+		return position{}
+	}
+	var pos position
+	if err = json.Unmarshal(data, &pos); err != nil {
+		log.Errorf("Runner[%v] %v meta data is corrupted err: %v, omit meta data...", r.meta.RunnerName, r.Name(), err)
+		return position{}
+	}
+	return pos
+}
+
+func (r *Reader) Name() string {
+	return "MySQLBinlogReader<" + r.addr + ">"
+}
+
+func (r *Reader) Source() string {
+	return r.addr
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("MySQL binlog reader not support read mode")
+}
+
+func (r *Reader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	r.wg.Add(1)
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *Reader) running() bool {
+	return atomic.LoadInt32(&r.status) == reader.StatusRunning
+}
+
+// run 与主库的连接断开后等待一段时间重连，从最后读取的位置继续
+func (r *Reader) run() {
+	defer r.wg.Done()
+	for r.running() {
+		err := r.session()
+		if !r.running() {
+			return
+		}
+		log.Errorf("Runner[%v] %v %v, reconnect after %v", r.meta.RunnerName, r.Name(), err, reconnectDelay)
+		r.setStatsError(err.Error())
+		select {
+		case <-r.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// masterStatus 查询主库当前的 binlog 位置，作为第一次启动时的读取位置
+func (r *Reader) masterStatus() (position, error) {
+	rows, err := r.db.Query("SHOW MASTER STATUS")
+	if err != nil {
+		return position{}, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return position{}, err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return position{}, err
+		}
+		return position{}, errors.New("binary log is not enabled")
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return position{}, err
+	}
+	var pos position
+	for i, col := range cols {
+		switch col {
+		case "File":
+			pos.File = values[i].String
+		case "Position":
+			p, err := strconv.ParseUint(values[i].String, 10, 32)
+			if err != nil {
+				return position{}, fmt.Errorf("invalid binlog position %q", values[i].String)
+			}
+			pos.Pos = uint32(p)
+		case "Executed_Gtid_Set":
+			pos.GTIDSet = strings.Replace(values[i].String, "\n", "", -1)
+		}
+	}
+	return pos, nil
+}
+
+// checksumEnabled 查询主库是否在 binlog 事件中写入 CRC32，MySQL 5.6 以下没有这个变量
+func (r *Reader) checksumEnabled() bool {
+	var checksum string
+	if err := r.db.QueryRow("SELECT @@GLOBAL.binlog_checksum").Scan(&checksum); err != nil {
+		return false
+	}
+	return !strings.EqualFold(checksum, "NONE")
+}
+
+// session 建立复制连接并请求 binlog，之后一直读取事件直到连接出错或者 reader 关闭
+func (r *Reader) session() error {
+	pos := r.sent
+	if pos.File == "" && pos.GTIDSet == "" {
+		var err error
+		if pos, err = r.masterStatus(); err != nil {
+			return fmt.Errorf("get master status error: %v", err)
+		}
+		if r.useGTID {
+			var mode string
+			if err = r.db.QueryRow("SELECT @@GLOBAL.gtid_mode").Scan(&mode); err != nil || !strings.EqualFold(mode, "ON") {
+				return fmt.Errorf("%v is true but gtid_mode of mysql is not ON", reader.KeyMySQLBinlogGTID)
+			}
+		}
+		log.Infof("Runner[%v] %v start from %v:%v", r.meta.RunnerName, r.Name(), pos.File, pos.Pos)
+		r.sent = pos
+	}
+	var format string
+	if err := r.db.QueryRow("SELECT @@GLOBAL.binlog_format").Scan(&format); err == nil && !strings.EqualFold(format, "ROW") {
+		log.Warnf("Runner[%v] %v binlog_format is %v, only ROW format events can be read", r.meta.RunnerName, r.Name(), format)
+	}
+	checksum := r.checksumEnabled()
+
+	c, err := dial(r.network, r.addr, r.user, r.password, r.tlsConfig, connectTimeout)
+	if err != nil {
+		return fmt.Errorf("connect to mysql error: %v", err)
+	}
+	defer c.Close()
+	r.mux.Lock()
+	if !r.running() {
+		r.mux.Unlock()
+		return nil
+	}
+	r.conn = c
+	r.mux.Unlock()
+	defer func() {
+		r.mux.Lock()
+		r.conn = nil
+		r.mux.Unlock()
+	}()
+
+	c.SetDeadline(time.Now().Add(connectTimeout))
+	if checksum {
+		if err = c.exec("SET @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+			return err
+		}
+	}
+	if err = c.exec(fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeatPeriod.Nanoseconds())); err != nil {
+		return err
+	}
+	s := &stream{r: r, file: pos.File, skip: pos.Skip, executed: newGTIDSet()}
+	if r.useGTID {
+		if s.executed, err = parseGTIDSet(pos.GTIDSet); err != nil {
+			return err
+		}
+		err = c.binlogDumpGTID(r.serverID, s.executed)
+	} else {
+		if pos.Pos < 4 {
+			pos.Pos = 4
+		}
+		err = c.binlogDump(r.serverID, pos.File, pos.Pos)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		c.SetDeadline(time.Now().Add(readTimeout))
+		data, err := c.readEvent()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("binlog dump finished by master")
+			}
+			return err
+		}
+		h, body, err := parseEvent(data, checksum)
+		if err != nil {
+			return err
+		}
+		if err = s.handle(h, body); err != nil {
+			return err
+		}
+		if !r.running() {
+			return nil
+		}
+	}
+}
+
+// stream 记录一个复制连接中当前所在的文件以及事务
+type stream struct {
+	r        *Reader
+	file     string
+	executed *gtidSet
+	tables   map[uint64]*tableMap
+
+	inTx  bool
+	began bool
+	// txStart 是当前事务开始的位置，txGTID 是当前事务的 gtid
+	txStart uint32
+	txSID   string
+	txGNO   int64
+	rows    int
+	// skip 是重新连接后第一个事务中需要跳过的已经读取的行数
+	skip int
+}
+
+func (s *stream) handle(h eventHeader, body []byte) error {
+	switch {
+	case h.typ == eventRotate:
+		_, file, err := parseRotate(body)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	case h.typ == eventGTID:
+		sid, gno, err := parseGTID(body)
+		if err != nil {
+			return err
+		}
+		s.startTx(h)
+		s.txSID, s.txGNO = sid, gno
+	case h.typ == eventAnonymousGTID:
+		s.startTx(h)
+	case h.typ == eventQuery:
+		_, query, err := parseQuery(body)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isBegin(query):
+			if !s.inTx {
+				s.startTx(h)
+			}
+			s.began = true
+		case isCommit(query):
+			return s.endTx(h)
+		default:
+			// DDL 可能修改了表结构，重新查询列信息
+			s.r.columns = make(map[string][]*column)
+			if !s.began {
+				return s.endTx(h)
+			}
+		}
+	case h.typ == eventXID:
+		return s.endTx(h)
+	case h.typ == eventTableMap:
+		tm, err := parseTableMap(body)
+		if err != nil {
+			return err
+		}
+		if !s.inTx {
+			s.startTx(h)
+		}
+		if s.tables == nil {
+			s.tables = make(map[uint64]*tableMap)
+		}
+		s.tables[tm.id] = tm
+	case isRowsEvent(h.typ):
+		return s.handleRows(h, body)
+	}
+	return nil
+}
+
+func (s *stream) startTx(h eventHeader) {
+	s.inTx = true
+	s.began = false
+	s.txStart = h.startPos()
+	s.txSID, s.txGNO = "", 0
+	s.rows = 0
+}
+
+// endTx 在事务结束后更新位置，之后重启时从下一个事务开始读取
+func (s *stream) endTx(h eventHeader) error {
+	if s.txSID != "" {
+		s.executed.add(s.txSID, s.txGNO)
+	}
+	s.inTx, s.began = false, false
+	s.txSID, s.txGNO = "", 0
+	s.tables = nil
+	s.skip = 0
+	if h.logPos == 0 {
+		return nil
+	}
+	s.r.send(rowEvent{pos: position{File: s.file, Pos: h.logPos, GTIDSet: s.executed.String()}})
+	return nil
+}
+
+func (s *stream) handleRows(h eventHeader, body []byte) error {
+	id, err := rowsTableID(body)
+	if err != nil {
+		return err
+	}
+	tm, ok := s.tables[id]
+	if !ok {
+		return fmt.Errorf("table map of table id %v not found", id)
+	}
+	if !s.r.matchTable(tm.schema, tm.table) {
+		return nil
+	}
+	cols, err := s.r.tableColumns(tm)
+	if err != nil {
+		return err
+	}
+	changes, err := parseRows(h.typ, body, cols)
+	if err != nil {
+		return fmt.Errorf("parse rows event of %v.%v error: %v", tm.schema, tm.table, err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	typ := rowsType(h.typ)
+	size := int64(h.size) / int64(len(changes))
+	for _, change := range changes {
+		s.rows++
+		if s.skip > 0 {
+			s.skip--
+			continue
+		}
+		data := Data{
+			"database":    tm.schema,
+			"table":       tm.table,
+			"type":        typ,
+			"timestamp":   time.Unix(int64(h.timestamp), 0).UTC().Format(time.RFC3339),
+			"binlog_file": s.file,
+			"binlog_pos":  h.logPos,
+		}
+		if s.txSID != "" {
+			data["gtid"] = formatSID(s.txSID) + ":" + fmt.Sprint(s.txGNO)
+		}
+		switch typ {
+		case "insert":
+			data["data"] = change.after
+		case "update":
+			data["data"] = change.after
+			data["old"] = change.before
+		case "delete":
+			data["data"] = change.before
+		}
+		pos := position{File: s.file, Pos: s.txStart, GTIDSet: s.executed.String(), Skip: s.rows}
+		if !s.r.send(rowEvent{data: data, bytes: size, pos: pos}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// matchTable 判断表是否需要读取，没有配置 mysql_binlog_tables 时读取所有的表
+func (r *Reader) matchTable(schema, table string) bool {
+	if len(r.tables) == 0 {
+		return true
+	}
+	name := schema + "." + table
+	for _, pattern := range r.tables {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tableColumns 返回 TABLE_MAP 中每一列的信息，列名等信息从 information_schema 中查询
+func (r *Reader) tableColumns(tm *tableMap) ([]*column, error) {
+	key := tm.schema + "." + tm.table
+	infos, ok := r.columns[key]
+	if !ok {
+		var err error
+		if infos, err = r.queryColumns(tm.schema, tm.table); err != nil {
+			return nil, fmt.Errorf("query columns of %v error: %v", key, err)
+		}
+		r.columns[key] = infos
+	}
+	if len(infos) != len(tm.types) {
+		// 读取的是表结构修改之前的 binlog 时列数可能不一致，这时无法确定列名，使用列的序号作为列名
+		log.Warnf("Runner[%v] %v table %v has %v columns but binlog has %v, use column index as name",
+			r.meta.RunnerName, r.Name(), key, len(infos), len(tm.types))
+		infos = nil
+	}
+	cols := make([]*column, len(tm.types))
+	for i := range tm.types {
+		col := &column{name: fmt.Sprintf("col_%d", i+1)}
+		if infos != nil {
+			*col = *infos[i]
+		}
+		col.typ, col.meta = tm.types[i], tm.metas[i]
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+func (r *Reader) queryColumns(schema, table string) ([]*column, error) {
+	rows, err := r.db.Query("SELECT COLUMN_NAME, COLUMN_TYPE, DATA_TYPE FROM COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []*column
+	for rows.Next() {
+		var name, columnType, dataType string
+		if err = rows.Scan(&name, &columnType, &dataType); err != nil {
+			return nil, err
+		}
+		cols = append(cols, newColumn(name, columnType, dataType))
+	}
+	return cols, rows.Err()
+}
+
+// newColumn 根据 information_schema 中的 COLUMN_TYPE 和 DATA_TYPE 生成列信息
+func newColumn(name, columnType, dataType string) *column {
+	col := &column{name: name}
+	columnType = strings.ToLower(columnType)
+	col.unsigned = strings.Contains(columnType, "unsigned")
+	switch strings.ToLower(dataType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		col.binary = true
+	case "enum", "set":
+		col.values = parseEnumValues(columnType)
+	}
+	return col
+}
+
+// parseEnumValues 解析 enum('a','b') 或 set('a','b') 中的可选值
+func parseEnumValues(columnType string) []string {
+	start, end := strings.Index(columnType, "("), strings.LastIndex(columnType, ")")
+	if start < 0 || end <= start {
+		return nil
+	}
+	var values []string
+	s := columnType[start+1 : end]
+	for len(s) > 0 {
+		if s[0] != '\'' {
+			s = s[1:]
+			continue
+		}
+		var value []byte
+		i := 1
+		for ; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					value = append(value, '\'')
+					i++
+					continue
+				}
+				break
+			}
+			value = append(value, s[i])
+		}
+		values = append(values, string(value))
+		if i >= len(s) {
+			break
+		}
+		s = s[i+1:]
+	}
+	return values
+}
+
+// send 把数据放入 readChan，reader 关闭时返回 false
+func (r *Reader) send(ev rowEvent) bool {
+	select {
+	case r.readChan <- ev:
+		r.sent = ev.pos
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// readEvent 读取下一行数据，只更新位置的事件直接记录位置，不返回给调用方
+func (r *Reader) readEvent() (rowEvent, bool) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-r.readChan:
+			r.mux.Lock()
+			r.pos = ev.pos
+			r.mux.Unlock()
+			if ev.data != nil {
+				return ev, true
+			}
+		case <-timer.C:
+			return rowEvent{}, false
+		}
+	}
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	ev, ok := r.readEvent()
+	if !ok {
+		return "", nil
+	}
+	bytes, err := jsoniter.Marshal(ev.data)
+	if err != nil {
+		log.Errorf("Runner[%v] %v json marshal inner error %v", r.meta.RunnerName, ev.data, err)
+		return "", nil
+	}
+	return string(bytes), nil
+}
+
+// ReadStructured 直接返回读取到的一行数据的变化，与 ReadLine 序列化后再经 json parser 解析的结果一致
+func (r *Reader) ReadStructured() (Data, int64, error) {
+	ev, ok := r.readEvent()
+	if !ok {
+		return nil, 0, nil
+	}
+	return ev.data, ev.bytes, nil
+}
+
+// SyncMeta 保存最后读取的位置，重启后从这个位置继续读取
+func (r *Reader) SyncMeta() {
+	r.mux.Lock()
+	pos := r.pos
+	changed := pos != r.synced
+	r.mux.Unlock()
+	if !changed {
+		return
+	}
+	data, err := json.Marshal(pos)
+	if err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	if err = r.meta.WriteValue(positionFile, data); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	r.mux.Lock()
+	r.synced = pos
+	r.mux.Unlock()
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) != reader.StatusRunning {
+		return r.db.Close()
+	}
+	close(r.done)
+	r.mux.Lock()
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mux.Unlock()
+	r.wg.Wait()
+	log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	return r.db.Close()
+}
@@ -0,0 +1,347 @@
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const testSID = "3e11fa4771ca11e19e33c80aa9429562"
+
+func TestGTIDSet(t *testing.T) {
+	g, err := parseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7, 4e11fa47-71ca-11e1-9e33-c80aa9429562:3")
+	assert.NoError(t, err)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,4e11fa47-71ca-11e1-9e33-c80aa9429562:3", g.String())
+	g.add(testSID, 6)
+	g.add(testSID, 9)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7:9,4e11fa47-71ca-11e1-9e33-c80aa9429562:3", g.String())
+
+	encoded := g.encode()
+	assert.EqualValues(t, 2, binary.LittleEndian.Uint64(encoded))
+	// 第一个 sid 有两个区间 [1,8) [9,10)
+	assert.EqualValues(t, 2, binary.LittleEndian.Uint64(encoded[24:]))
+	assert.EqualValues(t, 1, binary.LittleEndian.Uint64(encoded[32:]))
+	assert.EqualValues(t, 8, binary.LittleEndian.Uint64(encoded[40:]))
+	assert.Len(t, encoded, 8+(16+8+2*16)+(16+8+16))
+
+	_, err = parseGTIDSet("not-a-uuid:1")
+	assert.Error(t, err)
+	_, err = parseGTIDSet(formatSID(testSID) + ":5-3")
+	assert.Error(t, err)
+}
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		col  column
+		data []byte
+		exp  interface{}
+		n    int
+	}{
+		{column{typ: typeTiny}, []byte{0xff}, int64(-1), 1},
+		{column{typ: typeTiny, unsigned: true}, []byte{0xff}, uint64(255), 1},
+		{column{typ: typeInt24}, []byte{0xfe, 0xff, 0xff}, int64(-2), 3},
+		{column{typ: typeLong}, []byte{0x01, 0x02, 0x00, 0x00}, int64(513), 4},
+		{column{typ: typeLongLong, unsigned: true}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(18446744073709551615), 8},
+		{column{typ: typeFloat, meta: 4}, []byte{0xcd, 0xcc, 0x8c, 0x3f}, 1.1, 4},
+		{column{typ: typeYear}, []byte{118}, int64(2018), 1},
+		{column{typ: typeDate}, []byte{0xe1, 0xc4, 0x0f}, "2018-07-01", 3},
+		{column{typ: typeVarchar, meta: 255}, []byte{3, 'a', 'b', 'c'}, "abc", 4},
+		{column{typ: typeVarchar, meta: 1024}, []byte{3, 0, 'a', 'b', 'c'}, "abc", 5},
+		{column{typ: typeVarchar, meta: 255, binary: true}, []byte{2, 0xff, 0x00}, "/wA=", 3},
+		// CHAR(10) 的 meta 为 real type 0xfe 和长度 30
+		{column{typ: typeString, meta: 0xfe1e}, []byte{2, 'o', 'k'}, "ok", 3},
+		{column{typ: typeString, meta: uint16(typeEnum)<<8 | 1, values: []string{"a", "b"}}, []byte{2}, "b", 1},
+		{column{typ: typeString, meta: uint16(typeSet)<<8 | 1, values: []string{"a", "b", "c"}}, []byte{5}, "a,c", 1},
+		{column{typ: typeBit, meta: 0x0104}, []byte{0x01, 0x02}, uint64(258), 2},
+		{column{typ: typeBlob, meta: 2}, []byte{2, 0, 'h', 'i'}, "hi", 4},
+		{column{typ: typeNewDecimal, meta: 14<<8 | 4}, []byte{0x81, 0x0d, 0xfb, 0x38, 0xd2, 0x04, 0xd2}, "1234567890.1234", 7},
+		{column{typ: typeNewDecimal, meta: 14<<8 | 4}, []byte{0x7e, 0xf2, 0x04, 0xc7, 0x2d, 0xfb, 0x2d}, "-1234567890.1234", 7},
+		{column{typ: typeNewDecimal, meta: 5<<8 | 2}, []byte{0x80, 0x00, 0x05}, "0.05", 3},
+		{column{typ: typeTimestamp2, meta: 3}, []byte{0x5b, 0x38, 0xab, 0x00, 0x04, 0xce}, "2018-07-01T10:20:48.123Z", 6},
+		{column{typ: typeTime2}, []byte{0x80, 0xa5, 0x1e}, "10:20:30", 3},
+		{column{typ: typeTime2}, []byte{0x7f, 0xef, 0x7d}, "-01:02:03", 3},
+	}
+	for _, test := range tests {
+		col := test.col
+		v, n, err := decodeValue(test.data, &col)
+		assert.NoError(t, err)
+		assert.Equal(t, test.exp, v, "type %v meta %x", col.typ, col.meta)
+		assert.Equal(t, test.n, n)
+	}
+
+	// DATETIME2(6) 2018-07-01 10:20:30.123456
+	ymd := int64(2018*13+7)<<5 | 1
+	hms := int64(10<<12 | 20<<6 | 30)
+	v := ymd<<17 | hms + 0x8000000000
+	data := []byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v), 0x01, 0xe2, 0x40}
+	got, n, err := decodeValue(data, &column{typ: typeDatetime2, meta: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, "2018-07-01 10:20:30.123456", got)
+	assert.Equal(t, 8, n)
+
+	_, _, err = decodeValue([]byte{5, 'a'}, &column{typ: typeVarchar, meta: 10})
+	assert.Error(t, err)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	data := []byte{
+		jsonSmallObject,
+		2, 0, 32, 0,
+		18, 0, 1, 0, 19, 0, 1, 0,
+		jsonInt16, 1, 0, jsonSmallArray, 20, 0,
+		'a', 'b',
+		2, 0, 12, 0,
+		jsonLiteral, jsonLiteralTrue, 0, jsonString, 10, 0,
+		1, 'x',
+	}
+	v, n, err := decodeValue(append([]byte{byte(len(data)), 0, 0, 0}, data...), &column{typ: typeJSON, meta: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, 4+len(data), n)
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": []interface{}{true, "x"}}, v)
+
+	v, err = decodeJSON([]byte{jsonLiteral, jsonLiteralNull})
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	_, err = decodeJSON([]byte{jsonSmallObject, 1, 0})
+	assert.Error(t, err)
+}
+
+func TestParseEnumValues(t *testing.T) {
+	assert.Equal(t, []string{"a", "b'c", "d,e"}, parseEnumValues("enum('a','b''c','d,e')"))
+	assert.Equal(t, []string{"x"}, parseEnumValues("set('x')"))
+	col := newColumn("id", "int(10) unsigned", "int")
+	assert.True(t, col.unsigned)
+	assert.True(t, newColumn("b", "varbinary(16)", "varbinary").binary)
+}
+
+// tableMapBody 生成 db.t 的 TABLE_MAP_EVENT，包括一个 INT 列和一个 VARCHAR(255) 列
+func tableMapBody(id byte) []byte {
+	body := []byte{id, 0, 0, 0, 0, 0, 1, 0}
+	body = append(body, 2, 'd', 'b', 0, 1, 't', 0)
+	body = append(body, 2, typeLong, typeVarchar)
+	body = append(body, 2, 0xff, 0x00)
+	return append(body, 0x02)
+}
+
+func TestParseTableMapAndRows(t *testing.T) {
+	tm, err := parseTableMap(tableMapBody(7))
+	assert.NoError(t, err)
+	assert.Equal(t, &tableMap{id: 7, schema: "db", table: "t", types: []byte{typeLong, typeVarchar}, metas: []uint16{0, 255}}, tm)
+
+	cols := []*column{{name: "id", typ: typeLong}, {name: "name", typ: typeVarchar, meta: 255}}
+	body := []byte{7, 0, 0, 0, 0, 0, 1, 0, 2, 0, 2, 0x03, 0x03}
+	// before: id=1, name=NULL  after: id=1, name="a"
+	body = append(body, 0x02, 1, 0, 0, 0)
+	body = append(body, 0x00, 1, 0, 0, 0, 1, 'a')
+	changes, err := parseRows(eventUpdateRowsV2, body, cols)
+	assert.NoError(t, err)
+	assert.Equal(t, []rowChange{{
+		before: map[string]interface{}{"id": int64(1), "name": nil},
+		after:  map[string]interface{}{"id": int64(1), "name": "a"},
+	}}, changes)
+
+	// binlog_row_image=MINIMAL 时 delete 只有主键
+	body = []byte{7, 0, 0, 0, 0, 0, 1, 0, 2, 0x01, 0x00, 2, 0, 0, 0}
+	changes, err = parseRows(eventDeleteRowsV1, body, cols)
+	assert.NoError(t, err)
+	assert.Equal(t, []rowChange{{before: map[string]interface{}{"id": int64(2)}}}, changes)
+
+	_, err = parseRows(eventWriteRowsV1, []byte{7, 0, 0, 0, 0, 0, 1, 0, 3, 0x07}, cols)
+	assert.Error(t, err)
+}
+
+func writeRowsBody(id byte, ids ...byte) []byte {
+	body := []byte{id, 0, 0, 0, 0, 0, 1, 0, 2, 0, 2, 0x03}
+	for _, i := range ids {
+		body = append(body, 0x00, i, 0, 0, 0, 1, 'a'+i)
+	}
+	return body
+}
+
+func gtidBody(gno byte) []byte {
+	body := []byte{1}
+	body = append(body, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62)
+	return append(body, gno, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func queryBody(query string) []byte {
+	body := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 'd', 'b', 0}
+	return append(body, query...)
+}
+
+// replay 把一个包含两行数据的事务交给 stream 处理，返回读取到的数据
+func replay(t *testing.T, s *stream) []rowEvent {
+	events := []struct {
+		h    eventHeader
+		body []byte
+	}{
+		{eventHeader{typ: eventGTID, size: 65, logPos: 219}, gtidBody(5)},
+		{eventHeader{typ: eventQuery, size: 60, logPos: 279}, queryBody("BEGIN")},
+		{eventHeader{typ: eventTableMap, size: 40, logPos: 319}, tableMapBody(7)},
+		{eventHeader{typ: eventWriteRowsV2, size: 60, logPos: 379, timestamp: 1530440448}, writeRowsBody(7, 1, 2)},
+		{eventHeader{typ: eventXID, size: 31, logPos: 410}, []byte{1, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, ev := range events {
+		assert.NoError(t, s.handle(ev.h, ev.body))
+	}
+	var got []rowEvent
+	for len(s.r.readChan) > 0 {
+		got = append(got, <-s.r.readChan)
+	}
+	return got
+}
+
+func TestStreamSkip(t *testing.T) {
+	newStream := func(skip int) *stream {
+		r := &Reader{
+			meta:     &reader.Meta{RunnerName: "TestStreamSkip"},
+			readChan: make(chan rowEvent, 10),
+			done:     make(chan struct{}),
+			columns: map[string][]*column{
+				"db.t": {{name: "id"}, {name: "name"}},
+			},
+		}
+		return &stream{r: r, file: "mysql-bin.000001", skip: skip, executed: newGTIDSet()}
+	}
+	got := replay(t, newStream(0))
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, Data{
+			"database":    "db",
+			"table":       "t",
+			"type":        "insert",
+			"timestamp":   "2018-07-01T10:20:48Z",
+			"binlog_file": "mysql-bin.000001",
+			"binlog_pos":  uint32(379),
+			"gtid":        formatSID(testSID) + ":5",
+			"data":        map[string]interface{}{"id": int64(1), "name": "b"},
+		}, got[0].data)
+		assert.Equal(t, position{File: "mysql-bin.000001", Pos: 154, Skip: 1}, got[0].pos)
+		assert.Equal(t, position{File: "mysql-bin.000001", Pos: 154, Skip: 2}, got[1].pos)
+		assert.Nil(t, got[2].data)
+		assert.Equal(t, position{File: "mysql-bin.000001", Pos: 410, GTIDSet: formatSID(testSID) + ":5"}, got[2].pos)
+	}
+
+	// 从事务的开始重新读取时跳过已经读取的第一行
+	got = replay(t, newStream(1))
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, map[string]interface{}{"id": int64(2), "name": "c"}, got[0].data["data"])
+		assert.Equal(t, 2, got[0].pos.Skip)
+	}
+
+	s := newStream(0)
+	s.r.tables = []string{"other.*"}
+	got = replay(t, s)
+	if assert.Len(t, got, 1) {
+		assert.Nil(t, got[0].data)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	scramble := []byte("0123456789abcdefghij")
+	event := []byte{0, 0, 0, 0, eventHeartbeat, 1, 0, 0, 0, 19, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	errCh := make(chan error, 1)
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer nc.Close()
+		c := &conn{Conn: nc, br: bufio.NewReader(nc)}
+		handshake := append([]byte{10}, "5.7.22-log"...)
+		handshake = append(handshake, 0, 1, 0, 0, 0)
+		handshake = append(handshake, scramble[:8]...)
+		handshake = append(handshake, 0, 0xff, 0xf7, charsetUTF8General, 2, 0, 0xff, 0x81, 21)
+		handshake = append(handshake, make([]byte, 10)...)
+		handshake = append(handshake, scramble[8:]...)
+		handshake = append(handshake, 0)
+		handshake = append(handshake, nativePassword...)
+		handshake = append(handshake, 0)
+		c.writePacket(handshake)
+		resp, err := c.readPacket()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		expect := append([]byte("repl\x00\x14"), scramblePassword(scramble, []byte("secret"))...)
+		if string(resp[32:32+len(expect)]) != string(expect) {
+			c.writePacket([]byte{packetErr, 0x15, 0x04, '#', '2', '8', '0', '0', '0', 'd', 'e', 'n', 'i', 'e', 'd'})
+			errCh <- nil
+			return
+		}
+		c.writePacket([]byte{packetOK, 0, 0, 2, 0, 0, 0})
+		if _, err = c.readPacket(); err != nil {
+			errCh <- err
+			return
+		}
+		c.writePacket([]byte{packetOK, 0, 0, 2, 0, 0, 0})
+		if _, err = c.readPacket(); err != nil {
+			errCh <- err
+			return
+		}
+		c.writePacket(append([]byte{packetOK}, event...))
+		errCh <- nil
+	}()
+
+	c, err := dial("tcp", ln.Addr().String(), "repl", "secret", nil, connectTimeout)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.NoError(t, c.exec("SET @master_heartbeat_period = 1"))
+	assert.NoError(t, c.binlogDump(1001, "mysql-bin.000001", 4))
+	data, err := c.readEvent()
+	assert.NoError(t, err)
+	assert.Equal(t, event, data)
+	assert.NoError(t, <-errCh)
+
+	err = parseErr([]byte{packetErr, 0x15, 0x04, '#', '2', '8', '0', '0', '0', 'd', 'e', 'n', 'i', 'e', 'd'})
+	assert.Equal(t, &MySQLError{Code: 1045, Message: "denied"}, err)
+}
+
+func TestBinlogReaderMeta(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	c := conf.MapConf{
+		reader.KeyMetaPath:        MetaDir,
+		reader.KeyFileDone:        MetaDir,
+		reader.KeyMode:            reader.ModeMySQLBinlog,
+		reader.KeyMysqlDataSource: "repl:secret@tcp(127.0.0.1:3306)",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+
+	c[reader.KeyMySQLBinlogTables] = "db"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+	c[reader.KeyMySQLBinlogTables] = "db.*,other.t"
+
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	br := r.(*Reader)
+	assert.Equal(t, "MySQLBinlogReader<127.0.0.1:3306>", br.Name())
+	assert.True(t, br.matchTable("db", "t1"))
+	assert.True(t, br.matchTable("other", "t"))
+	assert.False(t, br.matchTable("other", "t2"))
+	assert.NotZero(t, br.serverID)
+
+	br.pos = position{File: "mysql-bin.000002", Pos: 154, GTIDSet: formatSID(testSID) + ":1-5", Skip: 3}
+	br.SyncMeta()
+	assert.NoError(t, br.Close())
+
+	r, err = NewReader(meta, c)
+	assert.NoError(t, err)
+	assert.Equal(t, position{File: "mysql-bin.000002", Pos: 154, GTIDSet: formatSID(testSID) + ":1-5", Skip: 3}, r.(*Reader).sent)
+	assert.NoError(t, r.Close())
+}
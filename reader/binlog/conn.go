@@ -0,0 +1,330 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MySQL 协议中 reader 用到的命令和标志
+const (
+	comQuery           = 0x03
+	comBinlogDump      = 0x12
+	comBinlogDumpGTID  = 0x1e
+	packetOK           = 0x00
+	packetEOF          = 0xfe
+	packetErr          = 0xff
+	maxPacketSize      = 1<<24 - 1
+	charsetUTF8General = 33
+
+	clientLongPassword = 0x00000001
+	clientLongFlag     = 0x00000004
+	clientProtocol41   = 0x00000200
+	clientSSL          = 0x00000800
+	clientTransactions = 0x00002000
+	clientSecureConn   = 0x00008000
+	clientPluginAuth   = 0x00080000
+
+	nativePassword = "mysql_native_password"
+)
+
+// conn 是用于复制的 MySQL 连接，只实现了读取 binlog 需要的部分
+type conn struct {
+	net.Conn
+	br  *bufio.Reader
+	seq byte
+}
+
+func dial(network, addr, user, password string, tlsConfig *tls.Config, timeout time.Duration) (*conn, error) {
+	nc, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, br: bufio.NewReaderSize(nc, 64*1024)}
+	nc.SetDeadline(time.Now().Add(timeout))
+	if err = c.handshake(user, password, tlsConfig); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// readPacket 读取一个完整的包，超过 16MB 被拆分的包会拼接起来
+func (c *conn) readPacket() ([]byte, error) {
+	var data []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(c.br, buf); err != nil {
+			return nil, err
+		}
+		if data == nil {
+			data = buf
+		} else {
+			data = append(data, buf...)
+		}
+		if length < maxPacketSize {
+			return data, nil
+		}
+	}
+}
+
+func (c *conn) writePacket(data []byte) error {
+	for {
+		length := len(data)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+		header := []byte{byte(length), byte(length >> 8), byte(length >> 16), c.seq}
+		if _, err := c.Conn.Write(append(header, data[:length]...)); err != nil {
+			return err
+		}
+		c.seq++
+		data = data[length:]
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (c *conn) writeCommand(data []byte) error {
+	c.seq = 0
+	return c.writePacket(data)
+}
+
+// handshake 解析服务端的 HandshakeV10，回复 HandshakeResponse41 完成认证
+func (c *conn) handshake(user, password string, tlsConfig *tls.Config) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] == packetErr {
+		return parseErr(data)
+	}
+	if len(data) < 1 || data[0] != 10 {
+		return errors.New("binlog: unsupported protocol version")
+	}
+	pos := bytes.IndexByte(data[1:], 0)
+	if pos < 0 || len(data) < 1+pos+1+4+8+1+2 {
+		return errors.New("binlog: malformed handshake packet")
+	}
+	pos += 2 + 4
+	scramble := append([]byte{}, data[pos:pos+8]...)
+	pos += 8 + 1
+	capability := uint32(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	plugin := nativePassword
+	if len(data) >= pos+1+2+2+1+10 {
+		capability |= uint32(binary.LittleEndian.Uint16(data[pos+3:])) << 16
+		authLen := int(data[pos+5])
+		pos += 1 + 2 + 2 + 1 + 10
+		if capability&clientSecureConn != 0 {
+			n := authLen - 8
+			if n < 13 {
+				n = 13
+			}
+			if len(data) < pos+n {
+				return errors.New("binlog: malformed handshake packet")
+			}
+			scramble = append(scramble, bytes.TrimRight(data[pos:pos+n], "\x00")...)
+			pos += n
+		}
+		if capability&clientPluginAuth != 0 && pos < len(data) {
+			plugin = string(bytes.TrimRight(data[pos:], "\x00"))
+		}
+	}
+	if capability&clientProtocol41 == 0 {
+		return errors.New("binlog: server does not support protocol 4.1")
+	}
+
+	flags := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions | clientSecureConn | clientPluginAuth)
+	if tlsConfig != nil {
+		if capability&clientSSL == 0 {
+			return errors.New("binlog: server does not support TLS")
+		}
+		flags |= clientSSL
+		req := make([]byte, 32)
+		binary.LittleEndian.PutUint32(req, flags)
+		binary.LittleEndian.PutUint32(req[4:], maxPacketSize)
+		req[8] = charsetUTF8General
+		if err = c.writePacket(req); err != nil {
+			return err
+		}
+		tc := tls.Client(c.Conn, tlsConfig)
+		if err = tc.Handshake(); err != nil {
+			return err
+		}
+		c.Conn = tc
+		c.br = bufio.NewReaderSize(tc, 64*1024)
+	}
+
+	auth, err := authResponse(plugin, scramble, password)
+	if err != nil {
+		return err
+	}
+	resp := make([]byte, 32, 32+len(user)+1+1+len(auth)+len(plugin)+1)
+	binary.LittleEndian.PutUint32(resp, flags)
+	binary.LittleEndian.PutUint32(resp[4:], maxPacketSize)
+	resp[8] = charsetUTF8General
+	resp = append(resp, user...)
+	resp = append(resp, 0, byte(len(auth)))
+	resp = append(resp, auth...)
+	resp = append(resp, plugin...)
+	resp = append(resp, 0)
+	if err = c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.authResult(password)
+}
+
+// authResult 读取认证结果，服务端要求切换认证方式时使用新的 scramble 重新计算
+func (c *conn) authResult(password string) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(data) == 0:
+		return errors.New("binlog: empty auth result")
+	case data[0] == packetOK:
+		return nil
+	case data[0] == packetErr:
+		return parseErr(data)
+	case data[0] == packetEOF:
+		plugin := nativePassword
+		var scramble []byte
+		if pos := bytes.IndexByte(data[1:], 0); pos >= 0 {
+			plugin = string(data[1 : 1+pos])
+			scramble = bytes.TrimRight(data[2+pos:], "\x00")
+		}
+		auth, err := authResponse(plugin, scramble, password)
+		if err != nil {
+			return err
+		}
+		if err = c.writePacket(auth); err != nil {
+			return err
+		}
+		return c.authResult(password)
+	}
+	return fmt.Errorf("binlog: unexpected auth result packet 0x%x", data[0])
+}
+
+func authResponse(plugin string, scramble []byte, password string) ([]byte, error) {
+	if plugin != nativePassword {
+		return nil, fmt.Errorf("binlog: auth plugin %v not supported, use %v", plugin, nativePassword)
+	}
+	return scramblePassword(scramble, []byte(password)), nil
+}
+
+// scramblePassword 计算 mysql_native_password 的认证数据: SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+func scramblePassword(scramble, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+	if len(scramble) > 20 {
+		scramble = scramble[:20]
+	}
+	stage1 := sha1.Sum(password)
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stage2[:])
+	token := h.Sum(nil)
+	for i := range token {
+		token[i] ^= stage1[i]
+	}
+	return token
+}
+
+// exec 执行不返回结果集的语句
+func (c *conn) exec(query string) error {
+	if err := c.writeCommand(append([]byte{comQuery}, query...)); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] == packetErr {
+		return parseErr(data)
+	}
+	if len(data) == 0 || data[0] != packetOK {
+		return fmt.Errorf("binlog: unexpected result of %q", query)
+	}
+	return nil
+}
+
+// binlogDump 从 file 的 pos 位置开始请求 binlog
+func (c *conn) binlogDump(serverID uint32, file string, pos uint32) error {
+	data := make([]byte, 11, 11+len(file))
+	data[0] = comBinlogDump
+	binary.LittleEndian.PutUint32(data[1:], pos)
+	binary.LittleEndian.PutUint32(data[7:], serverID)
+	return c.writeCommand(append(data, file...))
+}
+
+// binlogDumpGTID 请求 gtid 集合之外的所有 binlog
+func (c *conn) binlogDumpGTID(serverID uint32, gtids *gtidSet) error {
+	set := gtids.encode()
+	data := make([]byte, 1+2+4+4+8+4, 1+2+4+4+8+4+len(set))
+	data[0] = comBinlogDumpGTID
+	binary.LittleEndian.PutUint32(data[3:], serverID)
+	binary.LittleEndian.PutUint64(data[11:], 4)
+	binary.LittleEndian.PutUint32(data[19:], uint32(len(set)))
+	return c.writeCommand(append(data, set...))
+}
+
+// readEvent 读取 binlog dump 返回的一个事件
+func (c *conn) readEvent() ([]byte, error) {
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("binlog: empty packet")
+	case data[0] == packetOK:
+		return data[1:], nil
+	case data[0] == packetErr:
+		return nil, parseErr(data)
+	case data[0] == packetEOF && len(data) < 9:
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("binlog: unexpected packet 0x%x", data[0])
+}
+
+// MySQLError 是服务端返回的 ERR 包
+type MySQLError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *MySQLError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Code, e.Message)
+}
+
+func parseErr(data []byte) error {
+	if len(data) < 3 {
+		return errors.New("binlog: malformed error packet")
+	}
+	e := &MySQLError{Code: binary.LittleEndian.Uint16(data[1:])}
+	msg := data[3:]
+	if len(msg) > 0 && msg[0] == '#' && len(msg) >= 6 {
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
@@ -0,0 +1,354 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// reader 用到的 binlog 事件类型
+const (
+	eventQuery         = 2
+	eventRotate        = 4
+	eventXID           = 16
+	eventTableMap      = 19
+	eventWriteRowsV1   = 23
+	eventUpdateRowsV1  = 24
+	eventDeleteRowsV1  = 25
+	eventHeartbeat     = 27
+	eventWriteRowsV2   = 30
+	eventUpdateRowsV2  = 31
+	eventDeleteRowsV2  = 32
+	eventGTID          = 33
+	eventAnonymousGTID = 34
+
+	eventHeaderSize = 19
+)
+
+var errShortEvent = errors.New("binlog: event too short")
+
+type eventHeader struct {
+	timestamp uint32
+	typ       byte
+	size      uint32
+	// logPos 是下一个事件在 binlog 文件中的位置
+	logPos uint32
+}
+
+// startPos 是这个事件在 binlog 文件中的位置
+func (h eventHeader) startPos() uint32 {
+	if h.logPos < h.size {
+		return 0
+	}
+	return h.logPos - h.size
+}
+
+// parseEvent 解析事件头，开启了 checksum 时去掉末尾的 CRC32
+func parseEvent(data []byte, checksum bool) (eventHeader, []byte, error) {
+	if len(data) < eventHeaderSize {
+		return eventHeader{}, nil, errShortEvent
+	}
+	h := eventHeader{
+		timestamp: binary.LittleEndian.Uint32(data),
+		typ:       data[4],
+		size:      binary.LittleEndian.Uint32(data[9:]),
+		logPos:    binary.LittleEndian.Uint32(data[13:]),
+	}
+	// 服务端开始发送时伪造的 ROTATE 事件不一定带有 checksum，通过校验判断
+	if checksum && len(data) >= eventHeaderSize+4 {
+		n := len(data) - 4
+		if crc32.ChecksumIEEE(data[:n]) == binary.LittleEndian.Uint32(data[n:]) {
+			data = data[:n]
+		}
+	}
+	return h, data[eventHeaderSize:], nil
+}
+
+func parseRotate(body []byte) (uint64, string, error) {
+	if len(body) < 8 {
+		return 0, "", errShortEvent
+	}
+	return binary.LittleEndian.Uint64(body), string(body[8:]), nil
+}
+
+// parseQuery 返回 QUERY_EVENT 中的默认数据库和语句
+func parseQuery(body []byte) (string, string, error) {
+	if len(body) < 13 {
+		return "", "", errShortEvent
+	}
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:]))
+	pos := 13 + statusLen
+	if len(body) < pos+schemaLen+1 {
+		return "", "", errShortEvent
+	}
+	return string(body[pos : pos+schemaLen]), string(body[pos+schemaLen+1:]), nil
+}
+
+// parseGTID 返回 GTID_EVENT 中的 server uuid 和事务序号
+func parseGTID(body []byte) (string, int64, error) {
+	if len(body) < 25 {
+		return "", 0, errShortEvent
+	}
+	return hex.EncodeToString(body[1:17]), int64(binary.LittleEndian.Uint64(body[17:])), nil
+}
+
+// readLenEnc 解析 length encoded integer
+func readLenEnc(data []byte) (uint64, int, error) {
+	if len(data) < 1 {
+		return 0, 0, errShortEvent
+	}
+	switch data[0] {
+	case 0xfc:
+		if len(data) < 3 {
+			return 0, 0, errShortEvent
+		}
+		return uint64(binary.LittleEndian.Uint16(data[1:])), 3, nil
+	case 0xfd:
+		if len(data) < 4 {
+			return 0, 0, errShortEvent
+		}
+		return uint64(data[1]) | uint64(data[2])<<8 | uint64(data[3])<<16, 4, nil
+	case 0xfe:
+		if len(data) < 9 {
+			return 0, 0, errShortEvent
+		}
+		return binary.LittleEndian.Uint64(data[1:]), 9, nil
+	}
+	return uint64(data[0]), 1, nil
+}
+
+func readTableID(data []byte) uint64 {
+	return uint64(data[0]) | uint64(data[1])<<8 | uint64(data[2])<<16 | uint64(data[3])<<24 |
+		uint64(data[4])<<32 | uint64(data[5])<<40
+}
+
+// tableMap 是 TABLE_MAP_EVENT 中表的结构，后面的 ROWS 事件通过 table id 引用
+type tableMap struct {
+	id     uint64
+	schema string
+	table  string
+	types  []byte
+	metas  []uint16
+}
+
+func parseTableMap(body []byte) (*tableMap, error) {
+	if len(body) < 9 {
+		return nil, errShortEvent
+	}
+	tm := &tableMap{id: readTableID(body)}
+	pos := 8
+	schemaLen := int(body[pos])
+	if len(body) < pos+1+schemaLen+2 {
+		return nil, errShortEvent
+	}
+	tm.schema = string(body[pos+1 : pos+1+schemaLen])
+	pos += 1 + schemaLen + 1
+	tableLen := int(body[pos])
+	if len(body) < pos+1+tableLen+1 {
+		return nil, errShortEvent
+	}
+	tm.table = string(body[pos+1 : pos+1+tableLen])
+	pos += 1 + tableLen + 1
+	count, n, err := readLenEnc(body[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+	if uint64(len(body)) < uint64(pos)+count {
+		return nil, errShortEvent
+	}
+	tm.types = append([]byte{}, body[pos:pos+int(count)]...)
+	pos += int(count)
+	metaLen, n, err := readLenEnc(body[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+	if uint64(len(body)) < uint64(pos)+metaLen {
+		return nil, errShortEvent
+	}
+	if tm.metas, err = parseColumnMetas(tm.types, body[pos:pos+int(metaLen)]); err != nil {
+		return nil, err
+	}
+	return tm, nil
+}
+
+// parseColumnMetas 解析每一列的 meta，不同类型的 meta 长度不同
+func parseColumnMetas(types []byte, data []byte) ([]uint16, error) {
+	metas := make([]uint16, len(types))
+	pos := 0
+	for i, t := range types {
+		switch t {
+		case typeString, typeNewDecimal, typeEnum, typeSet:
+			if len(data) < pos+2 {
+				return nil, errShortEvent
+			}
+			metas[i] = uint16(data[pos])<<8 | uint16(data[pos+1])
+			pos += 2
+		case typeVarchar, typeVarString, typeBit:
+			if len(data) < pos+2 {
+				return nil, errShortEvent
+			}
+			metas[i] = binary.LittleEndian.Uint16(data[pos:])
+			pos += 2
+		case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeDouble, typeFloat, typeGeometry, typeJSON,
+			typeTimestamp2, typeDatetime2, typeTime2:
+			if len(data) < pos+1 {
+				return nil, errShortEvent
+			}
+			metas[i] = uint16(data[pos])
+			pos++
+		}
+	}
+	return metas, nil
+}
+
+// rowChange 是一行数据的变化，insert 只有 after，delete 只有 before
+type rowChange struct {
+	before map[string]interface{}
+	after  map[string]interface{}
+}
+
+func isRowsEvent(typ byte) bool {
+	switch typ {
+	case eventWriteRowsV1, eventUpdateRowsV1, eventDeleteRowsV1, eventWriteRowsV2, eventUpdateRowsV2, eventDeleteRowsV2:
+		return true
+	}
+	return false
+}
+
+// rowsType 返回 ROWS 事件对应的操作类型
+func rowsType(typ byte) string {
+	switch typ {
+	case eventWriteRowsV1, eventWriteRowsV2:
+		return "insert"
+	case eventUpdateRowsV1, eventUpdateRowsV2:
+		return "update"
+	}
+	return "delete"
+}
+
+func rowsTableID(body []byte) (uint64, error) {
+	if len(body) < 6 {
+		return 0, errShortEvent
+	}
+	return readTableID(body), nil
+}
+
+// parseRows 解析 WRITE/UPDATE/DELETE_ROWS 事件中的所有行，cols 与 TABLE_MAP 中的列一一对应
+func parseRows(typ byte, body []byte, cols []*column) ([]rowChange, error) {
+	if len(body) < 8 {
+		return nil, errShortEvent
+	}
+	pos := 8
+	if typ == eventWriteRowsV2 || typ == eventUpdateRowsV2 || typ == eventDeleteRowsV2 {
+		if len(body) < pos+2 {
+			return nil, errShortEvent
+		}
+		extraLen := int(binary.LittleEndian.Uint16(body[pos:]))
+		if extraLen < 2 || len(body) < pos+extraLen {
+			return nil, errShortEvent
+		}
+		pos += extraLen
+	}
+	count, n, err := readLenEnc(body[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+	if int(count) != len(cols) {
+		return nil, fmt.Errorf("binlog: rows event has %v columns but table map has %v", count, len(cols))
+	}
+	bitmapLen := (len(cols) + 7) / 8
+	if len(body) < pos+bitmapLen {
+		return nil, errShortEvent
+	}
+	present := body[pos : pos+bitmapLen]
+	pos += bitmapLen
+	isUpdate := typ == eventUpdateRowsV1 || typ == eventUpdateRowsV2
+	presentAfter := present
+	if isUpdate {
+		if len(body) < pos+bitmapLen {
+			return nil, errShortEvent
+		}
+		presentAfter = body[pos : pos+bitmapLen]
+		pos += bitmapLen
+	}
+
+	var changes []rowChange
+	for pos < len(body) {
+		row, n, err := parseRow(body[pos:], cols, present)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		var change rowChange
+		switch {
+		case isUpdate:
+			change.before = row
+			if change.after, n, err = parseRow(body[pos:], cols, presentAfter); err != nil {
+				return nil, err
+			}
+			pos += n
+		case typ == eventDeleteRowsV1 || typ == eventDeleteRowsV2:
+			change.before = row
+		default:
+			change.after = row
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+// parseRow 解析一行数据，binlog_row_image 不是 FULL 时没有出现的列不会包含在结果中
+func parseRow(data []byte, cols []*column, present []byte) (map[string]interface{}, int, error) {
+	var presentCount int
+	for i := range cols {
+		if bitSet(present, i) {
+			presentCount++
+		}
+	}
+	nullLen := (presentCount + 7) / 8
+	if len(data) < nullLen {
+		return nil, 0, errShortEvent
+	}
+	nulls := data[:nullLen]
+	pos := nullLen
+	row := make(map[string]interface{}, presentCount)
+	idx := 0
+	for i, col := range cols {
+		if !bitSet(present, i) {
+			continue
+		}
+		if bitSet(nulls, idx) {
+			row[col.name] = nil
+			idx++
+			continue
+		}
+		idx++
+		v, n, err := decodeValue(data[pos:], col)
+		if err != nil {
+			return nil, 0, fmt.Errorf("decode column %v error: %v", col.name, err)
+		}
+		row[col.name] = v
+		pos += n
+	}
+	return row, pos, nil
+}
+
+// isBegin、isCommit 判断 QUERY_EVENT 是否为事务的开始和结束
+func isBegin(query string) bool {
+	return strings.EqualFold(query, "BEGIN")
+}
+
+func isCommit(query string) bool {
+	return strings.EqualFold(query, "COMMIT") || strings.EqualFold(query, "ROLLBACK")
+}
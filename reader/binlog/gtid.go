@@ -0,0 +1,143 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// interval 是左闭右开的 gno 区间 [start, end)
+type interval struct {
+	start, end int64
+}
+
+// gtidSet 是 MySQL 的 gtid 集合，格式如 3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7,...
+type gtidSet struct {
+	sets map[string][]interval
+}
+
+func newGTIDSet() *gtidSet {
+	return &gtidSet{sets: make(map[string][]interval)}
+}
+
+func parseGTIDSet(s string) (*gtidSet, error) {
+	g := newGTIDSet()
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		sid, err := parseSID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields[1:] {
+			bounds := strings.SplitN(field, "-", 2)
+			start, err := strconv.ParseInt(bounds[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gtid interval %q", field)
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+					return nil, fmt.Errorf("invalid gtid interval %q", field)
+				}
+			}
+			if start <= 0 || end < start {
+				return nil, fmt.Errorf("invalid gtid interval %q", field)
+			}
+			g.addInterval(sid, interval{start, end + 1})
+		}
+	}
+	return g, nil
+}
+
+// parseSID 把 uuid 转为去掉横线的小写形式
+func parseSID(s string) (string, error) {
+	sid := strings.ToLower(strings.Replace(strings.TrimSpace(s), "-", "", -1))
+	if b, err := hex.DecodeString(sid); err != nil || len(b) != 16 {
+		return "", fmt.Errorf("invalid gtid server uuid %q", s)
+	}
+	return sid, nil
+}
+
+func formatSID(sid string) string {
+	return sid[:8] + "-" + sid[8:12] + "-" + sid[12:16] + "-" + sid[16:20] + "-" + sid[20:]
+}
+
+// add 把一个事务的 gtid 加入集合
+func (g *gtidSet) add(sid string, gno int64) {
+	g.addInterval(sid, interval{gno, gno + 1})
+}
+
+// addInterval 加入一个区间并合并相邻或者重叠的区间
+func (g *gtidSet) addInterval(sid string, iv interval) {
+	ivs := append(g.sets[sid], iv)
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i].start < ivs[j].start })
+	merged := ivs[:1]
+	for _, cur := range ivs[1:] {
+		last := &merged[len(merged)-1]
+		if cur.start <= last.end {
+			if cur.end > last.end {
+				last.end = cur.end
+			}
+			continue
+		}
+		merged = append(merged, cur)
+	}
+	g.sets[sid] = merged
+}
+
+func (g *gtidSet) sids() []string {
+	sids := make([]string, 0, len(g.sets))
+	for sid := range g.sets {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	return sids
+}
+
+func (g *gtidSet) String() string {
+	if g == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(g.sets))
+	for _, sid := range g.sids() {
+		part := formatSID(sid)
+		for _, iv := range g.sets[sid] {
+			if iv.end-1 == iv.start {
+				part += ":" + strconv.FormatInt(iv.start, 10)
+			} else {
+				part += ":" + strconv.FormatInt(iv.start, 10) + "-" + strconv.FormatInt(iv.end-1, 10)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encode 按照 COM_BINLOG_DUMP_GTID 的格式编码
+func (g *gtidSet) encode() []byte {
+	sids := g.sids()
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(len(sids)))
+	for _, sid := range sids {
+		b, _ := hex.DecodeString(sid)
+		buf = append(buf, b...)
+		ivs := g.sets[sid]
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(ivs)))
+		buf = append(buf, n[:]...)
+		for _, iv := range ivs {
+			binary.LittleEndian.PutUint64(n[:], uint64(iv.start))
+			buf = append(buf, n[:]...)
+			binary.LittleEndian.PutUint64(n[:], uint64(iv.end))
+			buf = append(buf, n[:]...)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,219 @@
+package binlog
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MySQL JSON 列的二进制格式中的类型
+const (
+	jsonSmallObject = 0x00
+	jsonLargeObject = 0x01
+	jsonSmallArray  = 0x02
+	jsonLargeArray  = 0x03
+	jsonLiteral     = 0x04
+	jsonInt16       = 0x05
+	jsonUint16      = 0x06
+	jsonInt32       = 0x07
+	jsonUint32      = 0x08
+	jsonInt64       = 0x09
+	jsonUint64      = 0x0a
+	jsonDouble      = 0x0b
+	jsonString      = 0x0c
+	jsonOpaque      = 0x0f
+
+	jsonLiteralNull  = 0x00
+	jsonLiteralTrue  = 0x01
+	jsonLiteralFalse = 0x02
+)
+
+var errMalformedJSON = errors.New("binlog: malformed json value")
+
+// decodeJSON 把 JSON 列的二进制格式转为对应的 Go 类型
+func decodeJSON(data []byte) (interface{}, error) {
+	if len(data) < 1 {
+		return nil, errMalformedJSON
+	}
+	return decodeJSONValue(data[0], data[1:])
+}
+
+func decodeJSONValue(typ byte, data []byte) (interface{}, error) {
+	switch typ {
+	case jsonSmallObject:
+		return decodeJSONComposite(data, false, true)
+	case jsonLargeObject:
+		return decodeJSONComposite(data, true, true)
+	case jsonSmallArray:
+		return decodeJSONComposite(data, false, false)
+	case jsonLargeArray:
+		return decodeJSONComposite(data, true, false)
+	case jsonLiteral:
+		if len(data) < 1 {
+			return nil, errMalformedJSON
+		}
+		switch data[0] {
+		case jsonLiteralNull:
+			return nil, nil
+		case jsonLiteralTrue:
+			return true, nil
+		case jsonLiteralFalse:
+			return false, nil
+		}
+		return nil, errMalformedJSON
+	case jsonInt16:
+		if len(data) < 2 {
+			return nil, errMalformedJSON
+		}
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case jsonUint16:
+		if len(data) < 2 {
+			return nil, errMalformedJSON
+		}
+		return uint64(binary.LittleEndian.Uint16(data)), nil
+	case jsonInt32:
+		if len(data) < 4 {
+			return nil, errMalformedJSON
+		}
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case jsonUint32:
+		if len(data) < 4 {
+			return nil, errMalformedJSON
+		}
+		return uint64(binary.LittleEndian.Uint32(data)), nil
+	case jsonInt64:
+		if len(data) < 8 {
+			return nil, errMalformedJSON
+		}
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case jsonUint64:
+		if len(data) < 8 {
+			return nil, errMalformedJSON
+		}
+		return binary.LittleEndian.Uint64(data), nil
+	case jsonDouble:
+		if len(data) < 8 {
+			return nil, errMalformedJSON
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case jsonString:
+		length, n, err := decodeVarLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < n+length {
+			return nil, errMalformedJSON
+		}
+		return string(data[n : n+length]), nil
+	case jsonOpaque:
+		// opaque 是 DATE、DECIMAL 等没有对应 JSON 类型的 MySQL 值，原样以 base64 输出
+		if len(data) < 1 {
+			return nil, errMalformedJSON
+		}
+		length, n, err := decodeVarLen(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 1+n+length {
+			return nil, errMalformedJSON
+		}
+		return base64.StdEncoding.EncodeToString(data[1+n : 1+n+length]), nil
+	}
+	return nil, fmt.Errorf("binlog: unknown json type 0x%x", typ)
+}
+
+// decodeVarLen 解析每个字节低 7 位表示长度、最高位表示是否还有后续字节的变长整数
+func decodeVarLen(data []byte) (int, int, error) {
+	var length int
+	for i := 0; i < 5 && i < len(data); i++ {
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return length, i + 1, nil
+		}
+	}
+	return 0, 0, errMalformedJSON
+}
+
+// decodeJSONComposite 解析对象和数组，offset 都是相对于对象或数组的起始位置
+func decodeJSONComposite(data []byte, large, isObject bool) (interface{}, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(b []byte) int {
+		if large {
+			return int(binary.LittleEndian.Uint32(b))
+		}
+		return int(binary.LittleEndian.Uint16(b))
+	}
+	if len(data) < 2*offsetSize {
+		return nil, errMalformedJSON
+	}
+	count, size := readOffset(data), readOffset(data[offsetSize:])
+	if size > len(data) {
+		return nil, errMalformedJSON
+	}
+	data = data[:size]
+	pos := 2 * offsetSize
+
+	var keys []string
+	if isObject {
+		keys = make([]string, count)
+		for i := 0; i < count; i++ {
+			if len(data) < pos+offsetSize+2 {
+				return nil, errMalformedJSON
+			}
+			keyOffset, keyLen := readOffset(data[pos:]), int(binary.LittleEndian.Uint16(data[pos+offsetSize:]))
+			if len(data) < keyOffset+keyLen {
+				return nil, errMalformedJSON
+			}
+			keys[i] = string(data[keyOffset : keyOffset+keyLen])
+			pos += offsetSize + 2
+		}
+	}
+
+	values := make([]interface{}, count)
+	for i := 0; i < count; i++ {
+		if len(data) < pos+1+offsetSize {
+			return nil, errMalformedJSON
+		}
+		typ := data[pos]
+		var v interface{}
+		var err error
+		if jsonInlined(typ, large) {
+			v, err = decodeJSONValue(typ, data[pos+1:pos+1+offsetSize])
+		} else {
+			offset := readOffset(data[pos+1:])
+			if offset >= len(data) {
+				return nil, errMalformedJSON
+			}
+			v, err = decodeJSONValue(typ, data[offset:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		pos += 1 + offsetSize
+	}
+	if !isObject {
+		return values, nil
+	}
+	obj := make(map[string]interface{}, count)
+	for i, k := range keys {
+		obj[k] = values[i]
+	}
+	return obj, nil
+}
+
+// jsonInlined 判断值是否直接存放在 value entry 中，large 格式中 32 位整数也是内联的
+func jsonInlined(typ byte, large bool) bool {
+	switch typ {
+	case jsonLiteral, jsonInt16, jsonUint16:
+		return true
+	case jsonInt32, jsonUint32:
+		return large
+	}
+	return false
+}
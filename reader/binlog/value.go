@@ -0,0 +1,441 @@
+package binlog
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binlog 中的列类型
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDatetime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+var errShortData = errors.New("binlog: row data too short")
+
+// column 是一列的类型信息，类型和 meta 来自 TABLE_MAP_EVENT，其余来自 information_schema
+type column struct {
+	name     string
+	typ      byte
+	meta     uint16
+	unsigned bool
+	// binary 为 true 的 blob、binary 等列输出 base64 编码后的字符串
+	binary bool
+	// values 是 enum 和 set 的可选值
+	values []string
+}
+
+// decodeValue 解析一列的值，返回值以及占用的字节数
+func decodeValue(data []byte, col *column) (interface{}, int, error) {
+	typ, meta := col.typ, col.meta
+	if typ == typeString && meta >= 256 {
+		b0, b1 := byte(meta>>8), byte(meta)
+		if b0&0x30 != 0x30 {
+			meta = uint16(b1) | uint16((b0&0x30)^0x30)<<4
+			typ = b0 | 0x30
+		} else {
+			meta = uint16(b1)
+			typ = b0
+		}
+	}
+	switch typ {
+	case typeNull:
+		return nil, 0, nil
+	case typeTiny:
+		if len(data) < 1 {
+			return nil, 0, errShortData
+		}
+		if col.unsigned {
+			return uint64(data[0]), 1, nil
+		}
+		return int64(int8(data[0])), 1, nil
+	case typeShort:
+		if len(data) < 2 {
+			return nil, 0, errShortData
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if col.unsigned {
+			return uint64(v), 2, nil
+		}
+		return int64(int16(v)), 2, nil
+	case typeInt24:
+		if len(data) < 3 {
+			return nil, 0, errShortData
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		if col.unsigned {
+			return uint64(v), 3, nil
+		}
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int64(int32(v)), 3, nil
+	case typeLong:
+		if len(data) < 4 {
+			return nil, 0, errShortData
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if col.unsigned {
+			return uint64(v), 4, nil
+		}
+		return int64(int32(v)), 4, nil
+	case typeLongLong:
+		if len(data) < 8 {
+			return nil, 0, errShortData
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if col.unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+	case typeFloat:
+		if len(data) < 4 {
+			return nil, 0, errShortData
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		// 按照 float32 的精度转换，避免 1.1 变成 1.100000023841858
+		v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+		return v, 4, nil
+	case typeDouble:
+		if len(data) < 8 {
+			return nil, 0, errShortData
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case typeNewDecimal:
+		return decodeDecimal(data, int(meta>>8), int(meta&0xff))
+	case typeYear:
+		if len(data) < 1 {
+			return nil, 0, errShortData
+		}
+		if data[0] == 0 {
+			return int64(0), 1, nil
+		}
+		return int64(data[0]) + 1900, 1, nil
+	case typeDate, typeNewDate:
+		if len(data) < 3 {
+			return nil, 0, errShortData
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), 3, nil
+	case typeTime:
+		if len(data) < 3 {
+			return nil, 0, errShortData
+		}
+		v := int32(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+		if v&0x800000 != 0 {
+			v |= -0x1000000
+		}
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v%10000)/100, v%100), 3, nil
+	case typeDatetime:
+		if len(data) < 8 {
+			return nil, 0, errShortData
+		}
+		v := binary.LittleEndian.Uint64(data)
+		d, t := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, (d%10000)/100, d%100, t/10000, (t%10000)/100, t%100), 8, nil
+	case typeTimestamp:
+		if len(data) < 4 {
+			return nil, 0, errShortData
+		}
+		return time.Unix(int64(binary.LittleEndian.Uint32(data)), 0).UTC().Format(time.RFC3339Nano), 4, nil
+	case typeTimestamp2:
+		return decodeTimestamp2(data, int(meta))
+	case typeDatetime2:
+		return decodeDatetime2(data, int(meta))
+	case typeTime2:
+		return decodeTime2(data, int(meta))
+	case typeVarchar, typeVarString, typeString:
+		v, n, err := decodeString(data, int(meta))
+		if err != nil {
+			return nil, 0, err
+		}
+		return col.stringValue(v), n, nil
+	case typeEnum:
+		size := int(meta & 0xff)
+		if size != 1 && size != 2 {
+			return nil, 0, fmt.Errorf("binlog: invalid enum size %v", size)
+		}
+		if len(data) < size {
+			return nil, 0, errShortData
+		}
+		idx := int(data[0])
+		if size == 2 {
+			idx = int(binary.LittleEndian.Uint16(data))
+		}
+		if idx == 0 {
+			return "", size, nil
+		}
+		if idx <= len(col.values) {
+			return col.values[idx-1], size, nil
+		}
+		return int64(idx), size, nil
+	case typeSet:
+		size := int(meta & 0xff)
+		if size < 1 || size > 8 || len(data) < size {
+			return nil, 0, errShortData
+		}
+		var bits uint64
+		for i := size - 1; i >= 0; i-- {
+			bits = bits<<8 | uint64(data[i])
+		}
+		if len(col.values) == 0 {
+			return bits, size, nil
+		}
+		var members []string
+		for i, v := range col.values {
+			if bits&(1<<uint(i)) != 0 {
+				members = append(members, v)
+			}
+		}
+		return strings.Join(members, ","), size, nil
+	case typeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		size := (nbits + 7) / 8
+		if len(data) < size {
+			return nil, 0, errShortData
+		}
+		var v uint64
+		for _, b := range data[:size] {
+			v = v<<8 | uint64(b)
+		}
+		return v, size, nil
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON:
+		size := int(meta)
+		if size < 1 || size > 4 || len(data) < size {
+			return nil, 0, errShortData
+		}
+		var length int
+		for i := size - 1; i >= 0; i-- {
+			length = length<<8 | int(data[i])
+		}
+		if len(data) < size+length {
+			return nil, 0, errShortData
+		}
+		v := data[size : size+length]
+		if typ == typeJSON {
+			if length == 0 {
+				return nil, size, nil
+			}
+			j, err := decodeJSON(v)
+			return j, size + length, err
+		}
+		if typ == typeGeometry {
+			return base64.StdEncoding.EncodeToString(v), size + length, nil
+		}
+		return col.stringValue(v), size + length, nil
+	}
+	return nil, 0, fmt.Errorf("binlog: unsupported column type %v", col.typ)
+}
+
+func (col *column) stringValue(v []byte) string {
+	if col.binary {
+		return base64.StdEncoding.EncodeToString(v)
+	}
+	return string(v)
+}
+
+// decodeString 解析长度前缀的字符串，最大长度小于 256 时前缀为 1 个字节，否则为 2 个字节
+func decodeString(data []byte, maxLen int) ([]byte, int, error) {
+	if maxLen < 256 {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, 0, errShortData
+		}
+		return data[1 : 1+int(data[0])], 1 + int(data[0]), nil
+	}
+	if len(data) < 2 {
+		return nil, 0, errShortData
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+length {
+		return nil, 0, errShortData
+	}
+	return data[2 : 2+length], 2 + length, nil
+}
+
+func bigEndian(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// decimal 每 9 位十进制数存储为 4 个字节，不足 9 位时需要的字节数
+var decimalBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeDecimal 解析 DECIMAL 的二进制格式，返回字符串以保留精度
+func decodeDecimal(data []byte, precision, scale int) (interface{}, int, error) {
+	integral := precision - scale
+	fullInt, partInt := integral/9, integral%9
+	fullFrac, partFrac := scale/9, scale%9
+	size := fullInt*4 + decimalBytes[partInt] + fullFrac*4 + decimalBytes[partFrac]
+	if size == 0 || len(data) < size {
+		return nil, 0, errShortData
+	}
+	buf := append([]byte{}, data[:size]...)
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+	var sb []byte
+	pos := 0
+	if n := decimalBytes[partInt]; n > 0 {
+		sb = strconv.AppendUint(sb, bigEndian(buf[pos:pos+n]), 10)
+		pos += n
+	}
+	for i := 0; i < fullInt; i++ {
+		sb = append(sb, fmt.Sprintf("%09d", binary.BigEndian.Uint32(buf[pos:]))...)
+		pos += 4
+	}
+	intPart := strings.TrimLeft(string(sb), "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if negative {
+		intPart = "-" + intPart
+	}
+	if scale == 0 {
+		return intPart, size, nil
+	}
+	frac := make([]byte, 0, scale)
+	for i := 0; i < fullFrac; i++ {
+		frac = append(frac, fmt.Sprintf("%09d", binary.BigEndian.Uint32(buf[pos:]))...)
+		pos += 4
+	}
+	if n := decimalBytes[partFrac]; n > 0 {
+		frac = append(frac, fmt.Sprintf("%0*d", partFrac, bigEndian(buf[pos:pos+n]))...)
+	}
+	return intPart + "." + string(frac), size, nil
+}
+
+// decodeFrac 解析 TIMESTAMP2、DATETIME2、TIME2 中的小数秒，返回微秒以及占用的字节数
+func decodeFrac(data []byte, fsp int) (int, int, error) {
+	n := (fsp + 1) / 2
+	if len(data) < n {
+		return 0, 0, errShortData
+	}
+	v := int(bigEndian(data[:n]))
+	switch n {
+	case 1:
+		v *= 10000
+	case 2:
+		v *= 100
+	}
+	return v, n, nil
+}
+
+func formatFrac(usec, fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", usec)[:fsp]
+}
+
+func decodeTimestamp2(data []byte, fsp int) (interface{}, int, error) {
+	if len(data) < 4 {
+		return nil, 0, errShortData
+	}
+	usec, n, err := decodeFrac(data[4:], fsp)
+	if err != nil {
+		return nil, 0, err
+	}
+	sec := int64(binary.BigEndian.Uint32(data))
+	return time.Unix(sec, int64(usec)*1000).UTC().Format(time.RFC3339Nano), 4 + n, nil
+}
+
+func decodeDatetime2(data []byte, fsp int) (interface{}, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errShortData
+	}
+	usec, n, err := decodeFrac(data[5:], fsp)
+	if err != nil {
+		return nil, 0, err
+	}
+	v := int64(bigEndian(data[:5])) - 0x8000000000
+	if v == 0 {
+		return "0000-00-00 00:00:00" + formatFrac(0, fsp), 5 + n, nil
+	}
+	ym := (v >> 22) & (1<<17 - 1)
+	ymd := v >> 17
+	hms := v & (1<<17 - 1)
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d%s", ym/13, ym%13, ymd&31, hms>>12, (hms>>6)&63, hms&63, formatFrac(usec, fsp)), 5 + n, nil
+}
+
+func decodeTime2(data []byte, fsp int) (interface{}, int, error) {
+	n := 3 + (fsp+1)/2
+	if len(data) < n {
+		return nil, 0, errShortData
+	}
+	var tmp int64
+	switch (fsp + 1) / 2 {
+	case 0:
+		tmp = (int64(bigEndian(data[:3])) - 0x800000) << 24
+	case 1:
+		intPart := int64(bigEndian(data[:3])) - 0x800000
+		frac := int64(data[3])
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x100
+		}
+		tmp = intPart<<24 + frac*10000
+	case 2:
+		intPart := int64(bigEndian(data[:3])) - 0x800000
+		frac := int64(bigEndian(data[3:5]))
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		tmp = intPart<<24 + frac*100
+	case 3:
+		tmp = int64(bigEndian(data[:6])) - 0x800000000000
+	}
+	sign := ""
+	if tmp < 0 {
+		sign, tmp = "-", -tmp
+	}
+	hms := tmp >> 24
+	usec := int(tmp % (1 << 24))
+	return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, (hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), formatFrac(usec, fsp)), n, nil
+}
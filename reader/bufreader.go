@@ -14,9 +14,11 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/axgle/mahonia"
@@ -29,6 +31,9 @@ import (
 const (
 	DefaultBufSize           = 4096
 	MaxHeadPatternBufferSize = 20 * 1024 * 1024
+
+	// headerLineFile 保存 mark_first_line 时当前文件的表头，内容为 "文件路径\n表头"
+	headerLineFile = "header.line"
 )
 
 var (
@@ -58,20 +63,49 @@ type BufReader struct {
 	lastRuneSize  int
 	lastSync      LastSync
 
-	mux     sync.Mutex
-	decoder mahonia.Decoder
+	mux      sync.Mutex
+	encoding string // 当前使用的编码，文件带有 BOM 时以 BOM 为准
+	decoder  mahonia.Decoder
 
 	Meta            *Meta // 存放offset的元信息
 	multiLineRegexp *regexp.Regexp
+	continuePattern *ContinuePattern // 不为 nil 时按照 continue pattern 拼接多行，不能和 multiLineRegexp 同时使用
 
 	stats     StatsInfo
 	statsLock sync.RWMutex
 
+	dedup  *Deduper    // 为 nil 时不去重
+	filter *LineFilter // 为 nil 时不过滤
+
+	// delimiter 不为 nil 时代替 ReadString 等方法传入的 delim 切分数据，UTF-16 编码时不生效
+	delimiter *Delimiter
+
+	maxLineLength int    // 一行最多读取的字节数，为 0 时不限制
+	maxLineAction string // 超过 maxLineLength 时截断还是拆分
+	discarding    bool   // 正在丢弃被截断的行剩下的部分
+	readTruncated bool   // 最近一次 ReadString 读到的数据是否被截断或者拆分
+
+	multiLineTimeout  time.Duration // 多行缓存超过这个时间没有新的数据时直接发送，为 0 时一直等待下一个行首
+	multiLineMaxLines int           // 多行缓存达到这个行数时直接发送，为 0 时不限制
+	lastCacheTime     time.Time     // 最近一次向 mutiLineCache 中加入数据的时间
+
 	lastErrShowTime time.Time
 
+	markFirstLine bool   // 在每个文件的第一个非空行开头加上 HeaderLineMarker
+	markedSource  string // 最近一次加上标记的文件
+	pendingHeader string // 从 meta 恢复读取进度后需要先返回的表头，已经加上了 HeaderLineMarker
+
 	// 这里的变量用于记录buffer中的数据从底层的哪个DataSource出来的，用于精准定位seqfile的DataSource
 	lastRdSource []SourceIndex
 	latestSource string
+
+	// 以下变量用于计算最近一次 ReadLine 返回的数据在文件中的位置，均为转码前的字节数
+	lastReadLen   int // 最近一次 ReadString 读取的字节数，包括截断时丢弃的部分
+	lineLen       int // 最近一次 ReadLine 返回的数据的字节数
+	cacheLen      int // mutiLineCache 中数据的字节数
+	sourceMeta    SourceMeta
+	hasSourceMeta bool
+	lineTruncated bool // 最近一次 ReadLine 返回的数据是否被截断或者拆分，多行模式下不记录
 }
 
 type SourceIndex struct {
@@ -130,12 +164,19 @@ func NewReaderSize(rd FileReader, meta *Meta, size int) (*BufReader, error) {
 	r.reset(make([]byte, size), rd)
 
 	r.Meta = meta
-	if r.Meta.GetEncodingWay() != "" {
-		r.decoder = mahonia.NewDecoder(r.Meta.GetEncodingWay())
-		if r.decoder == nil {
-			log.Warnf("Encoding Way [%v] is not supported, will read as utf-8", r.Meta.GetEncodingWay())
+	r.setEncoding(r.Meta.GetEncodingWay())
+	// 从文件中间恢复读取时读不到文件开头的 BOM，需要单独检测一次
+	if fp, ok := rd.(FilePositioner); ok {
+		if _, offset := fp.Position(); offset > 0 {
+			if enc, ok := fileBOMEncoding(rd.Source()); ok {
+				r.setEncoding(enc)
+			}
 		}
 	}
+	// UTF-16 按两个字节对齐切分行，buffer 写满时整个返回，所以大小也要对齐
+	if r.utf16Order() != 0 && len(r.buf)%2 != 0 {
+		r.buf = append(r.buf, 0)
+	}
 	if meta.IsExist() && meta.IsValid() {
 		r.r = readPos
 		r.w = writePos
@@ -151,12 +192,19 @@ func NewReaderSize(rd FileReader, meta *Meta, size int) (*BufReader, error) {
 	}
 	if len(linesbytes) > 0 {
 		r.mutiLineCache = append(r.mutiLineCache, string(linesbytes))
+		r.cacheLen = len(linesbytes)
 	}
 	return r, nil
 }
 
 func (b *BufReader) SetMode(mode string, v interface{}) (err error) {
-	b.multiLineRegexp, err = HeadPatternMode(mode, v)
+	if mode == ReadModeContinuePattern {
+		b.continuePattern, err = ContinuePatternMode(mode, v)
+		b.multiLineRegexp = nil
+	} else {
+		b.multiLineRegexp, err = HeadPatternMode(mode, v)
+		b.continuePattern = nil
+	}
 	if err != nil {
 		err = fmt.Errorf("%v set mode error %v ", b.Name(), err)
 		return
@@ -164,6 +212,38 @@ func (b *BufReader) SetMode(mode string, v interface{}) (err error) {
 	return
 }
 
+// SetMaxLineLength 设置一行最多读取的字节数，action 为 MaxLineTruncate 时丢弃超过的部分，
+// 为 MaxLineSplit 时超过的部分作为新的一行，length 为 0 时不限制
+func (b *BufReader) SetMaxLineLength(length int, action string) {
+	b.mux.Lock()
+	b.maxLineLength = length
+	b.maxLineAction = action
+	b.mux.Unlock()
+}
+
+// SetMultiLineFlush 设置多行模式下缓存的数据在没有等到下一个行首时的发送条件，
+// timeout 为缓存多长时间没有新的数据，maxLines 为缓存的最大行数，为 0 时不限制
+func (b *BufReader) SetMultiLineFlush(timeout time.Duration, maxLines int) {
+	b.mux.Lock()
+	b.multiLineTimeout = timeout
+	b.multiLineMaxLines = maxLines
+	b.mux.Unlock()
+}
+
+// SetLineFilter 设置过滤数据使用的 LineFilter，为 nil 时不过滤
+func (b *BufReader) SetLineFilter(f *LineFilter) {
+	b.mux.Lock()
+	b.filter = f
+	b.mux.Unlock()
+}
+
+// SetDelimiter 设置切分数据使用的分隔符，为 nil 时按照换行切分
+func (b *BufReader) SetDelimiter(d *Delimiter) {
+	b.mux.Lock()
+	b.delimiter = d
+	b.mux.Unlock()
+}
+
 func (b *BufReader) reset(buf []byte, r FileReader) {
 	*b = BufReader{
 		buf:           buf,
@@ -224,10 +304,14 @@ func (b *BufReader) fill() {
 
 	// Read new data: try a limited number of times.
 	for i := maxConsecutiveEmptyReads; i > 0; i-- {
+		atStart := b.atFileStart()
 		n, err := b.rd.Read(b.buf[b.w:])
 		if n < 0 {
 			panic(errNegativeRead)
 		}
+		if atStart && n > 0 {
+			n = b.skipBOM(n)
+		}
 		if b.latestSource != b.rd.Source() {
 			//这个情况表示文件的数据源出现了变化，在buf中已经出现了2个数据源的数据，要定位是哪个位置的数据出现的分隔
 			if rc, ok := b.rd.(NewLineBytesRecorder); ok {
@@ -283,15 +367,20 @@ func (b *BufReader) readSlice(delim byte) (line []byte, err error) {
 			return
 		}
 		// Search buffer.
-		if i := bytes.IndexByte(b.buf[b.r:b.w], delim); i >= 0 {
-			line = b.buf[b.r : b.r+i+1]
-			b.r += i + 1
+		if i := b.indexLineEnd(b.buf[b.r:b.w], delim); i >= 0 {
+			line = b.buf[b.r : b.r+i]
+			b.r += i
 			break
 		}
 		// Pending error?
 		if b.err != nil {
-			line = b.buf[b.r:b.w]
-			b.r = b.w
+			end := b.w
+			// UTF-16 的文件可能只写入了一个字符的一半，留到下次读取，避免之后的数据错位
+			if b.utf16Order() != 0 && (b.w-b.r)%2 != 0 {
+				end--
+			}
+			line = b.buf[b.r:end]
+			b.r = end
 			err = b.readErr()
 			break
 		}
@@ -322,15 +411,27 @@ func (b *BufReader) readSlice(delim byte) (line []byte, err error) {
 // readBytes returns err != nil if and only if the returned data does not end in
 // delim.
 // For simple uses, a Scanner may be more convenient.
-func (b *BufReader) readBytes(delim byte) ([]byte, error) {
+func (b *BufReader) readBytes(delim byte) ([]byte, int, error) {
+	if b.discarding {
+		if err := b.discardLine(delim); err != nil || b.discarding {
+			return nil, 0, err
+		}
+	}
+	b.readTruncated = false
 	// Use readSlice to look for array,
 	// accumulating full buffers.
 	var frag []byte
 	var full [][]byte
 	var err error
+	n, consumed := 0, 0
 	for {
 		var e error
 		frag, e = b.readSlice(delim)
+		consumed += len(frag)
+		if b.maxLineLength > 0 && n+len(frag) > b.maxLineLength {
+			frag, consumed = b.cutLine(frag, b.maxLineLength-n, consumed, e)
+			break
+		}
 		if e == nil { // got final fragment
 			break
 		}
@@ -344,12 +445,9 @@ func (b *BufReader) readBytes(delim byte) ([]byte, error) {
 		buf := make([]byte, len(frag))
 		copy(buf, frag)
 		full = append(full, buf)
+		n += len(buf)
 	}
 	// Allocate new buffer to hold the full pieces and the fragment.
-	n := 0
-	for i := range full {
-		n += len(full[i])
-	}
 	n += len(frag)
 
 	// Copy full pieces and fragment in.
@@ -359,7 +457,61 @@ func (b *BufReader) readBytes(delim byte) ([]byte, error) {
 		n += copy(buf[n:], full[i])
 	}
 	copy(buf[n:], frag)
-	return buf, err
+	return buf, consumed, err
+}
+
+// cutLine 在一行超过 maxLineLength 时只保留 frag 的前 keep 个字节，拆分时把剩下的部分放回 buffer，
+// 截断时行还没有结束则继续丢弃到下一个分隔符，返回保留的部分以及这一行实际读取的字节数
+func (b *BufReader) cutLine(frag []byte, keep, consumed int, err error) ([]byte, int) {
+	keep = b.alignCut(frag, keep)
+	b.readTruncated = true
+	if b.maxLineAction == MaxLineSplit {
+		b.mux.Lock()
+		b.r -= len(frag) - keep
+		b.mux.Unlock()
+		return frag[:keep], consumed - (len(frag) - keep)
+	}
+	if err != nil {
+		b.discarding = true
+	}
+	log.Warnf("Runner[%v] %v line is longer than %v bytes, truncated", b.Meta.RunnerName, b.Name(), b.maxLineLength)
+	return frag[:keep], consumed
+}
+
+// alignCut 调整截断的位置，避免把一个字符拆成两半，其他多字节编码无法判断字符边界，不做调整
+func (b *BufReader) alignCut(p []byte, keep int) int {
+	if b.utf16Order() != 0 {
+		if k := keep &^ 1; k > 0 {
+			return k
+		}
+		return keep
+	}
+	if b.needDecode() {
+		return keep
+	}
+	for i := keep; i > keep-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(p[i]) {
+			return i
+		}
+	}
+	return keep
+}
+
+// discardLine 丢弃被截断的行剩下的部分，读到分隔符后结束
+func (b *BufReader) discardLine(delim byte) error {
+	for {
+		line, err := b.readSlice(delim)
+		if err == nil {
+			// reader 停止时不会读到数据
+			if len(line) > 0 {
+				b.discarding = false
+			}
+			return nil
+		}
+		if err != ErrBufferFull {
+			return err
+		}
+	}
 }
 
 // ReadString reads until the first occurrence of delim in the input,
@@ -370,41 +522,51 @@ func (b *BufReader) readBytes(delim byte) ([]byte, error) {
 // delim.
 // For simple uses, a Scanner may be more convenient.
 func (b *BufReader) ReadString(delim byte) (ret string, err error) {
-	bytes, err := b.readBytes(delim)
+	bytes, consumed, err := b.readBytes(delim)
+	b.lastReadLen = consumed
 	ret = *(*string)(unsafe.Pointer(&bytes))
 	//默认都是utf-8
-	if b.Meta.GetEncodingWay() != "" && b.Meta.GetEncodingWay() != "utf-8" && b.decoder != nil {
+	if b.needDecode() {
 		ret = b.decoder.ConvertString(ret)
 	}
 	return
 }
 
-//ReadPattern读取日志直到匹配行首模式串
+//ReadPattern读取日志直到匹配行首模式串，配置 continue pattern 时读取到不属于当前数据的行或者当前数据的最后一行为止
 func (b *BufReader) ReadPattern() (string, error) {
 	var maxTimes int = 0
 	for {
+		// multiline_max_lines 为 1 时新的行首本身就达到了最大行数
+		if b.reachMultiLineMaxLines() {
+			return b.flushMutiLine(), nil
+		}
 		line, err := b.ReadString('\n')
 		//读取到line的情况
 		if len(line) > 0 {
-			if len(b.mutiLineCache) <= 0 {
-				b.mutiLineCache = []string{line}
-				continue
-			}
+			b.lastCacheTime = time.Now()
 			//匹配行首，成功则返回之前的cache，否则加入到cache，返回空串
-			if b.multiLineRegexp.Match([]byte(line)) {
+			if len(b.mutiLineCache) > 0 && b.startsEvent(line) {
 				tmp := line
 				line = string(b.FormMutiLine())
 				b.mutiLineCache = make([]string, 0, 16)
 				b.mutiLineCache = append(b.mutiLineCache, tmp)
+				b.lineLen, b.cacheLen = b.cacheLen, b.lastReadLen
 				return line, err
 			}
 			b.mutiLineCache = append(b.mutiLineCache, line)
+			b.cacheLen += b.lastReadLen
 			maxTimes = 0
+			if b.endsEvent(line) || b.reachMultiLineMaxLines() {
+				return b.flushMutiLine(), err
+			}
 		} else { //读取不到日志
 			if err != nil {
-				line = string(b.FormMutiLine())
-				b.mutiLineCache = make([]string, 0, 16)
-				return line, err
+				return b.flushMutiLine(), err
+			}
+			// 缓存的数据长时间等不到下一个行首，例如文件最后一条多行日志，直接发送
+			if b.multiLineTimeout > 0 && len(b.mutiLineCache) > 0 && time.Since(b.lastCacheTime) >= b.multiLineTimeout {
+				log.Debugf("Runner[%v] %v flush %v cached lines after %v without new head", b.Meta.RunnerName, b.Name(), len(b.mutiLineCache), b.multiLineTimeout)
+				return b.flushMutiLine(), nil
 			}
 			maxTimes++
 			//对于又没有错误，也读取不到日志的情况，最多允许10次重试
@@ -415,13 +577,36 @@ func (b *BufReader) ReadPattern() (string, error) {
 		}
 		//对于读取到了Cache的情况，继续循环，直到超过最大限制
 		if b.calcMutiLineCache() > MaxHeadPatternBufferSize {
-			line = string(b.FormMutiLine())
-			b.mutiLineCache = make([]string, 0, 16)
-			return line, err
+			return b.flushMutiLine(), err
 		}
 	}
 }
 
+// flushMutiLine 返回 mutiLineCache 中缓存的所有数据并清空缓存
+func (b *BufReader) flushMutiLine() string {
+	line := string(b.FormMutiLine())
+	b.mutiLineCache = make([]string, 0, 16)
+	b.lineLen, b.cacheLen = b.cacheLen, 0
+	return line
+}
+
+// startsEvent 判断 line 是否为新的一条数据的开始，mutiLineCache 中缓存的数据需要先返回
+func (b *BufReader) startsEvent(line string) bool {
+	if b.continuePattern != nil {
+		return b.continuePattern.startsEvent(line)
+	}
+	return b.multiLineRegexp.MatchString(line)
+}
+
+// endsEvent 判断 line 是否为一条数据的最后一行，只有 continue pattern 的 before 模式能够确定
+func (b *BufReader) endsEvent(line string) bool {
+	return b.continuePattern != nil && b.continuePattern.endsEvent(line)
+}
+
+func (b *BufReader) reachMultiLineMaxLines() bool {
+	return b.multiLineMaxLines > 0 && len(b.mutiLineCache) >= b.multiLineMaxLines
+}
+
 func (b *BufReader) FormMutiLine() []byte {
 	if len(b.mutiLineCache) <= 0 {
 		return make([]byte, 0)
@@ -448,23 +633,40 @@ func (b *BufReader) calcMutiLineCache() (ret int) {
 
 //ReadLine returns a string line as a normal Reader
 func (b *BufReader) ReadLine() (ret string, err error) {
-	if b.multiLineRegexp == nil {
+	if b.pendingHeader != "" {
+		ret, b.pendingHeader = b.pendingHeader, ""
+		return ret, nil
+	}
+	if b.multiLineRegexp == nil && b.continuePattern == nil {
 		ret, err = b.ReadString('\n')
-		if os.IsNotExist(err) {
-			if b.lastErrShowTime.Add(5 * time.Second).Before(time.Now()) {
-				log.Errorf("%v ReadLine err %v", b.Meta.RunnerName, err)
-				b.lastErrShowTime = time.Now()
-			}
-		}
+		b.lineLen = b.lastReadLen
+		b.lineTruncated = b.readTruncated
+		b.logNotExist(err)
 	} else {
 		ret, err = b.ReadPattern()
+		b.lineTruncated = false
 	}
-	if skp, ok := b.rd.(LineSkipper); ok {
-		if skp.IsNewOpen() {
-			log.Infof("%v Skip line %v as first line skipper was configured %v", b.Meta.RunnerName, ret)
-			ret = ""
-			skp.SetSkipped()
-		}
+	if b.delimiter != nil {
+		ret = b.delimiter.trim(ret)
+	}
+	// 表头不经过过滤和去重，不同文件的表头相同时也都要交给解析器
+	header := false
+	if b.skipNewOpenLine(ret) {
+		ret = ""
+	} else if b.markNewOpenLine(ret) {
+		ret = HeaderLineMarker + ret
+		header = true
+	}
+	if len(ret) > 0 && !header && b.filter != nil && b.filter.Drop(ret) {
+		log.Debugf("Runner[%v] %v drop filtered line %v", b.Meta.RunnerName, b.Name(), ret)
+		ret = ""
+	}
+	if len(ret) > 0 && !header && b.dedup != nil && b.dedup.Duplicate(ret) {
+		log.Debugf("Runner[%v] %v drop duplicate line %v", b.Meta.RunnerName, b.Name(), ret)
+		ret = ""
+	}
+	if len(ret) > 0 {
+		b.recordSourceMeta()
 	}
 	if err != nil && err != io.EOF {
 		b.setStatsError(err.Error())
@@ -472,6 +674,275 @@ func (b *BufReader) ReadLine() (ret string, err error) {
 	return
 }
 
+// ReadLineBytes 把读到的一行追加到 dst 后返回，不需要转码、去重、过滤，也没有配置多行、分隔符和最大长度时不会为每一行分配内存，
+// 其他情况通过 ReadLine 读取后再追加
+func (b *BufReader) ReadLineBytes(dst []byte) ([]byte, error) {
+	if b.pendingHeader != "" {
+		dst = append(dst, b.pendingHeader...)
+		b.pendingHeader = ""
+		return dst, nil
+	}
+	if b.multiLineRegexp != nil || b.continuePattern != nil || b.needDecode() || b.dedup != nil || b.filter != nil || b.delimiter != nil || b.maxLineLength > 0 {
+		line, err := b.ReadLine()
+		return append(dst, line...), err
+	}
+	n := len(dst)
+	dst, err := b.appendBytes(dst, '\n')
+	b.lineLen = len(dst) - n
+	b.logNotExist(err)
+	if b.skipNewOpenLine(dst[n:]) {
+		dst = dst[:n]
+	} else if b.markFirstLine && b.markNewOpenLine(string(dst[n:])) {
+		dst = append(dst[:n], append([]byte(HeaderLineMarker), dst[n:]...)...)
+	}
+	if len(dst) > n {
+		b.recordSourceMeta()
+	}
+	if err != nil && err != io.EOF {
+		b.setStatsError(err.Error())
+	}
+	return dst, err
+}
+
+// appendBytes 与 readBytes 相同，但是把读到的数据追加到 dst 中
+func (b *BufReader) appendBytes(dst []byte, delim byte) ([]byte, error) {
+	for {
+		frag, err := b.readSlice(delim)
+		dst = append(dst, frag...)
+		if err != ErrBufferFull {
+			return dst, err
+		}
+	}
+}
+
+// recordSourceMeta 根据底层 FileReader 已经读取到的位置减去 buffer 中还没有读取的部分，
+// 计算刚刚读到的数据在文件中的起始位置。数据来自上一个文件或者位置算不出来时不记录
+func (b *BufReader) recordSourceMeta() {
+	b.hasSourceMeta = false
+	fp, ok := b.rd.(FilePositioner)
+	if !ok {
+		return
+	}
+	source := b.Source()
+	if source != b.rd.Source() {
+		return
+	}
+	inode, offset := fp.Position()
+	b.mux.Lock()
+	offset -= int64(b.buffered() + b.cacheLen + b.lineLen)
+	b.mux.Unlock()
+	if offset < 0 {
+		return
+	}
+	b.sourceMeta = SourceMeta{Path: source, Inode: inode, Offset: offset, Truncated: b.lineTruncated}
+	b.hasSourceMeta = true
+}
+
+// Position 返回底层文件的 inode 以及已经读取的位置，不包括 buffer 中还没有读取的部分
+func (b *BufReader) Position() (inode uint64, offset int64, ok bool) {
+	fp, ok := b.rd.(FilePositioner)
+	if !ok {
+		return 0, 0, false
+	}
+	inode, offset = fp.Position()
+	b.mux.Lock()
+	offset -= int64(b.buffered())
+	b.mux.Unlock()
+	return inode, offset, true
+}
+
+// SourceMeta 返回最近一次 ReadLine 读到的数据所在的文件和位置
+func (b *BufReader) SourceMeta() (SourceMeta, bool) {
+	return b.sourceMeta, b.hasSourceMeta
+}
+
+func (b *BufReader) needDecode() bool {
+	return b.decoder != nil
+}
+
+// setEncoding 设置读取使用的编码，空或者 UTF-8 不需要转码，不支持的编码按照 UTF-8 读取
+func (b *BufReader) setEncoding(e string) {
+	e = strings.ToUpper(e)
+	if e == "UTF-8" {
+		e = ""
+	}
+	b.encoding, b.decoder = e, nil
+	if e == "" {
+		return
+	}
+	b.decoder = mahonia.NewDecoder(e)
+	if b.decoder == nil {
+		log.Warnf("Encoding Way [%v] is not supported, will read as utf-8", e)
+		b.encoding = ""
+	}
+}
+
+const (
+	utf16LE = 1
+	utf16BE = 2
+)
+
+// utf16Order 返回 UTF-16 的字节序，不带 BOM 的 UTF-16 按照大端处理，与 mahonia 一致
+func (b *BufReader) utf16Order() int {
+	switch b.encoding {
+	case "UTF-16LE":
+		return utf16LE
+	case "UTF-16", "UTF-16BE":
+		return utf16BE
+	}
+	return 0
+}
+
+// indexDelim 返回分隔符最后一个字节在 p 中的位置，UTF-16 的分隔符占两个字节并且必须在字符边界上
+func (b *BufReader) indexDelim(p []byte, delim byte) int {
+	switch b.utf16Order() {
+	case utf16LE:
+		for i := 0; i+1 < len(p); i += 2 {
+			if p[i] == delim && p[i+1] == 0 {
+				return i + 1
+			}
+		}
+		return -1
+	case utf16BE:
+		for i := 0; i+1 < len(p); i += 2 {
+			if p[i] == 0 && p[i+1] == delim {
+				return i + 1
+			}
+		}
+		return -1
+	}
+	return bytes.IndexByte(p, delim)
+}
+
+// indexLineEnd 返回 p 中第一行结束(包括分隔符)的位置，没有找到时返回 -1
+func (b *BufReader) indexLineEnd(p []byte, delim byte) int {
+	if b.delimiter != nil && b.utf16Order() == 0 {
+		// 已经出错或者 buffer 已满时不会再读到更多数据，匹配到末尾的分隔符也是完整的
+		return b.delimiter.index(p, b.err != nil || b.buffered() >= len(b.buf))
+	}
+	if i := b.indexDelim(p, delim); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+// atFileStart 返回底层文件是否还没有读取任何数据，即下次读取的内容从文件开头开始
+func (b *BufReader) atFileStart() bool {
+	fp, ok := b.rd.(FilePositioner)
+	if !ok {
+		return false
+	}
+	_, offset := fp.Position()
+	return offset == 0
+}
+
+var boms = []struct {
+	bom      []byte
+	encoding string
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, "UTF-8"},
+	{[]byte{0xff, 0xfe}, "UTF-16LE"},
+	{[]byte{0xfe, 0xff}, "UTF-16BE"},
+}
+
+func detectBOM(p []byte) (encoding string, size int) {
+	for _, v := range boms {
+		if bytes.HasPrefix(p, v.bom) {
+			return v.encoding, len(v.bom)
+		}
+	}
+	return "", 0
+}
+
+// skipBOM 检查从文件开头读到 buffer 中的 n 个字节，带有 BOM 时切换到对应的编码并把 BOM 从 buffer 中去掉，返回剩下的字节数
+func (b *BufReader) skipBOM(n int) int {
+	p := b.buf[b.w : b.w+n]
+	enc, size := detectBOM(p)
+	if size == 0 {
+		return n
+	}
+	old := b.encoding
+	b.setEncoding(enc)
+	if b.encoding != old {
+		log.Infof("Runner[%v] %v has %v BOM, read it as %v instead of %q", b.Meta.RunnerName, b.rd.Source(), enc, enc, old)
+	}
+	n = copy(p, p[size:])
+	if b.utf16Order() != 0 && len(b.buf)%2 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	return n
+}
+
+// fileBOMEncoding 读取文件开头的 BOM，返回对应的编码
+func fileBOMEncoding(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	p := make([]byte, 3)
+	n, _ := io.ReadFull(f, p)
+	enc, size := detectBOM(p[:n])
+	return enc, size > 0
+}
+
+func (b *BufReader) logNotExist(err error) {
+	if os.IsNotExist(err) {
+		if b.lastErrShowTime.Add(5 * time.Second).Before(time.Now()) {
+			log.Errorf("%v ReadLine err %v", b.Meta.RunnerName, err)
+			b.lastErrShowTime = time.Now()
+		}
+	}
+}
+
+// skipNewOpenLine 在配置了跳过首行并且文件刚打开时返回 true
+func (b *BufReader) skipNewOpenLine(line interface{}) bool {
+	skp, ok := b.rd.(LineSkipper)
+	if !ok || !skp.IsNewOpen() {
+		return false
+	}
+	log.Infof("%v Skip line %s as first line skipper was configured", b.Meta.RunnerName, line)
+	skp.SetSkipped()
+	return true
+}
+
+// markNewOpenLine 在配置了标记首行并且刚刚读到的是一个新文件的第一个非空行时返回 true，
+// buffer 中可能同时有上一个文件的数据，所以按照这一行的数据源判断。
+// 表头同时保存在 meta 中，重启后从 meta 记录的位置继续读取时由 restoreHeaderLine 重新返回
+func (b *BufReader) markNewOpenLine(line string) bool {
+	if !b.markFirstLine || len(strings.TrimSpace(line)) == 0 {
+		return false
+	}
+	source := b.Source()
+	if source == b.markedSource {
+		return false
+	}
+	b.markedSource = source
+	if err := b.Meta.WriteValue(headerLineFile, []byte(source+"\n"+line)); err != nil {
+		log.Errorf("Runner[%v] %v save header line of %v error %v", b.Meta.RunnerName, b.Name(), source, err)
+	}
+	return true
+}
+
+// restoreHeaderLine 在从 meta 记录的位置继续读取 source 时调用，source 的表头之前已经读过了，
+// 下一次读取时先返回 meta 中保存的表头，解析器重启后才能继续按照表头解析
+func (b *BufReader) restoreHeaderLine(source string) {
+	b.markedSource = source
+	data, err := b.Meta.ReadValue(headerLineFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Runner[%v] %v read header line error %v", b.Meta.RunnerName, b.Name(), err)
+		}
+		return
+	}
+	parts := strings.SplitN(string(data), "\n", 2)
+	if len(parts) != 2 || parts[0] != source {
+		log.Warnf("Runner[%v] %v header line of %v not found in meta", b.Meta.RunnerName, b.Name(), source)
+		return
+	}
+	b.pendingHeader = HeaderLineMarker + parts[1]
+}
+
 var errNegativeWrite = errors.New("bufio: writer returned negative count from Write")
 
 // writeBuf writes the Reader's buffer to the writer.
@@ -524,6 +995,26 @@ func (b *BufReader) Lag() (rl *LagInfo, err error) {
 	return rl, fmt.Errorf("internal reader haven't support lag info yet")
 }
 
+// DetectTruncate 检查底层文件是否被原地截断，截断后从头开始读取，buffer 中还没有读完的内容属于截断前的文件，直接丢弃
+func (b *BufReader) DetectTruncate() (bool, error) {
+	td, ok := b.rd.(TruncateDetector)
+	if !ok {
+		return false, nil
+	}
+	truncated, err := td.DetectTruncate()
+	if !truncated || err != nil {
+		return truncated, err
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.w > b.r {
+		log.Debugf("Runner[%v] %v drop %v bytes buffered before truncated", b.Meta.RunnerName, b.Name(), b.w-b.r)
+	}
+	b.r, b.w = 0, 0
+	b.err = nil
+	return true, nil
+}
+
 func (b *BufReader) SyncMeta() {
 	b.mux.Lock()
 	defer b.mux.Unlock()
@@ -1,10 +1,14 @@
 package reader
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 
 	"github.com/stretchr/testify/assert"
 
@@ -245,6 +249,43 @@ func Test_BuffReaderBufSizeLarge(t *testing.T) {
 	r.Close()
 }
 
+func Test_BuffReaderReadLineBytes(t *testing.T) {
+	longLine := strings.Repeat("abcdefghij", 5)
+	createSeqFile(1000, "123456789\n"+longLine+"\n")
+	defer DestroyDir()
+	c := conf.MapConf{
+		"log_path":        Dir,
+		"meta_path":       MetaDir,
+		"mode":            DirMode,
+		"ignore_hidden":   "true",
+		"reader_buf_size": "24",
+		"read_from":       "oldest",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	br, ok := r.(BytesReader)
+	assert.True(t, ok)
+
+	bufp := GetLineBuffer()
+	defer PutLineBuffer(bufp)
+	buf := append(*bufp, "prefix:"...)
+	ends := []int{len(buf)}
+	for {
+		buf, err = br.ReadLineBytes(buf)
+		if err != nil {
+			break
+		}
+		ends = append(ends, len(buf))
+	}
+	assert.Len(t, ends, 7)
+	// 每一行都追加在之前的数据之后，超过 buffer 大小的行也是完整的一行
+	assert.Equal(t, "prefix:", string(buf[:ends[0]]))
+	assert.Equal(t, "123456789\n", string(buf[ends[0]:ends[1]]))
+	assert.Equal(t, longLine+"\n", string(buf[ends[1]:ends[2]]))
+	*bufp = buf
+}
+
 func Test_GBKEncoding(t *testing.T) {
 	body := "\x82\x31\x89\x38"
 	createSeqFile(1000, body)
@@ -313,6 +354,314 @@ func Test_NoPanicEncoding(t *testing.T) {
 	r.Close()
 }
 
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var p []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			p = append(p, byte(c>>8), byte(c))
+		} else {
+			p = append(p, byte(c), byte(c>>8))
+		}
+	}
+	return p
+}
+
+func Test_UTF16Encoding(t *testing.T) {
+	CreateDir()
+	defer DestroyDir()
+	path := filepath.Join(Dir, "utf16.log")
+	// "ਊ" 的小端编码是 0a 0a，不能被当作换行
+	content := append([]byte{0xff, 0xfe}, encodeUTF16("你好\nਊworld\r\nabc\n12", false)...)
+	assert.NoError(t, ioutil.WriteFile(path, append(content, 0x33), DefaultFilePerm))
+	c := conf.MapConf{
+		"mode":            ModeFile,
+		"log_path":        path,
+		"meta_path":       MetaDir,
+		"reader_buf_size": "15",
+		"read_from":       "oldest",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	var rest []string
+	for {
+		line, err := r.ReadLine()
+		if len(line) > 0 {
+			rest = append(rest, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	// 只写入了一半的字符不会被读出
+	assert.Equal(t, []string{"你好\n", "ਊworld\r\n", "abc\n", "12"}, rest)
+	r.Close()
+
+	os.RemoveAll(MetaDir)
+	assert.NoError(t, ioutil.WriteFile(path, encodeUTF16("中文\nabc\n", true), DefaultFilePerm))
+	c["encoding"] = "UTF-16BE"
+	r, err = NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	line, err := r.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "中文\n", line)
+	line, err = r.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc\n", line)
+	r.Close()
+}
+
+func Test_UTF8BOM(t *testing.T) {
+	CreateDir()
+	defer DestroyDir()
+	path := filepath.Join(Dir, "bom.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("\xef\xbb\xbfabc\n"), DefaultFilePerm))
+	c := conf.MapConf{
+		"mode":      ModeFile,
+		"log_path":  path,
+		"meta_path": MetaDir,
+		"read_from": "oldest",
+		"encoding":  "gbk",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	line, err := r.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc\n", line)
+	r.Close()
+}
+
+func Test_LineDelimiter(t *testing.T) {
+	tests := []struct {
+		conf    conf.MapConf
+		content string
+		expect  []string
+	}{
+		{
+			conf:    conf.MapConf{KeyLineDelimiter: `\r\n`},
+			content: "a\nb\r\nc\r\nd",
+			expect:  []string{"a\nb", "c", "d"},
+		},
+		{
+			conf:    conf.MapConf{KeyLineDelimiter: `\x1e`},
+			content: "abcdefghijklmnopqrstuvwxyz\x1e12\x1e",
+			expect:  []string{"abcdefghijklmnopqrstuvwxyz", "12"},
+		},
+		{
+			conf:    conf.MapConf{KeyLineDelimiterRegex: `;+`},
+			content: "abcdefghijklmn;;;;;;;;;;;;;;;;;;;;o;p",
+			expect:  []string{"abcdefghijklmn", "o", "p"},
+		},
+	}
+	for _, test := range tests {
+		CreateDir()
+		path := filepath.Join(Dir, "delimiter.log")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(test.content), DefaultFilePerm))
+		c := conf.MapConf{
+			"mode":            ModeFile,
+			"log_path":        path,
+			"meta_path":       MetaDir,
+			"read_from":       "oldest",
+			"reader_buf_size": "16",
+		}
+		for k, v := range test.conf {
+			c[k] = v
+		}
+		r, err := NewFileBufReader(c, false)
+		assert.NoError(t, err)
+		var lines []string
+		for i := 0; i < 10; i++ {
+			line, err := r.ReadLine()
+			if line != "" {
+				lines = append(lines, line)
+			}
+			if err == io.EOF {
+				break
+			}
+		}
+		assert.Equal(t, test.expect, lines, test.content)
+		r.Close()
+		DestroyDir()
+	}
+
+	_, err := NewDelimiterWithConf(conf.MapConf{KeyLineDelimiter: ";", KeyLineDelimiterRegex: ";"})
+	assert.Error(t, err)
+	_, err = NewDelimiterWithConf(conf.MapConf{KeyLineDelimiterRegex: ";*"})
+	assert.Error(t, err)
+	d, err := NewDelimiterWithConf(conf.MapConf{KeyLineDelimiter: `\n`})
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+func Test_LineFilter(t *testing.T) {
+	CreateDir()
+	defer DestroyDir()
+	path := filepath.Join(Dir, "filter.log")
+	CreateFile(path, "INFO a\nDEBUG b\nINFO c health\nWARN d\nERROR e\n")
+	c := conf.MapConf{
+		"mode":                ModeFile,
+		"log_path":            path,
+		"meta_path":           MetaDir,
+		"read_from":           "oldest",
+		KeyLineIncludePattern: "^(INFO|WARN|ERROR) ",
+		KeyLineExcludePattern: "health",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	var lines []string
+	for {
+		line, err := r.ReadLine()
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"INFO a\n", "WARN d\n", "ERROR e\n"}, lines)
+
+	f, err := NewLineFilterWithConf(conf.MapConf{})
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+	_, err = NewLineFilterWithConf(conf.MapConf{KeyLineExcludePattern: "("})
+	assert.Error(t, err)
+}
+
+func Test_MarkFileFirstLine(t *testing.T) {
+	createSeqFile(1000, "\nname,age\nalice,1\n")
+	defer DestroyDir()
+	c := conf.MapConf{
+		"log_path":           Dir,
+		"meta_path":          MetaDir,
+		"mode":               DirMode,
+		"read_from":          "oldest",
+		"reader_buf_size":    "24",
+		KeyMarkFileFirstLine: "true",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	var lines []string
+	for i := 0; i < 20 && len(lines) < 2*len(Files); i++ {
+		line, err := r.ReadLine()
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		if err != nil && err != io.EOF {
+			assert.NoError(t, err)
+		}
+	}
+	var expect []string
+	for range Files {
+		expect = append(expect, HeaderLineMarker+"name,age\n", "alice,1\n")
+	}
+	assert.Equal(t, expect, lines)
+}
+
+func Test_MarkFileFirstLineResume(t *testing.T) {
+	CreateDir()
+	defer DestroyDir()
+	CreateFile(filepath.Join(Dir, "a.csv"), "name,age\nalice,1\nbob,2\n")
+	c := conf.MapConf{
+		"log_path":            Dir,
+		"meta_path":           MetaDir,
+		"mode":                DirMode,
+		"read_from":           "oldest",
+		KeyMarkFileFirstLine:  "true",
+		KeyLineIncludePattern: "^(alice|bob),",
+	}
+	readLines := func(r Reader, n int) (lines []string) {
+		for i := 0; i < 10 && len(lines) < n; i++ {
+			line, err := r.ReadLine()
+			if line != "" {
+				lines = append(lines, line)
+			}
+			if err != nil && err != io.EOF {
+				assert.NoError(t, err)
+			}
+		}
+		return
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	// 表头不会被过滤掉
+	assert.Equal(t, []string{HeaderLineMarker + "name,age\n", "alice,1\n"}, readLines(r, 2))
+	r.SyncMeta()
+	r.Close()
+
+	// 从 meta 中的位置继续读取时先返回保存的表头
+	r, err = NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{HeaderLineMarker + "name,age\n", "bob,2\n"}, readLines(r, 2))
+}
+
+func Test_MaxLineLength(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz\nshort\n你好世界\n"
+	tests := []struct {
+		action    string
+		expect    []string
+		offsets   []int64
+		truncated []bool
+	}{
+		{
+			action:    MaxLineTruncate,
+			expect:    []string{"0123456789", "short\n", "你好世"},
+			offsets:   []int64{0, 37, 43},
+			truncated: []bool{true, false, true},
+		},
+		{
+			action:    MaxLineSplit,
+			expect:    []string{"0123456789", "abcdefghij", "klmnopqrst", "uvwxyz\n", "short\n", "你好世", "界\n"},
+			offsets:   []int64{0, 10, 20, 30, 37, 43, 52},
+			truncated: []bool{true, true, true, false, false, true, false},
+		},
+	}
+	for _, test := range tests {
+		CreateDir()
+		path := filepath.Join(Dir, "maxline.log")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), DefaultFilePerm))
+		c := conf.MapConf{
+			"mode":            ModeFile,
+			"log_path":        path,
+			"meta_path":       MetaDir,
+			"read_from":       "oldest",
+			"reader_buf_size": "16",
+			KeyMaxLineLength:  "10",
+			KeyMaxLineAction:  test.action,
+		}
+		r, err := NewFileBufReader(c, false)
+		assert.NoError(t, err)
+		var lines []string
+		var offsets []int64
+		var truncated []bool
+		for i := 0; i < 20; i++ {
+			line, err := r.ReadLine()
+			if line != "" {
+				lines = append(lines, line)
+				sm, ok := r.(SourceMetaReader).SourceMeta()
+				assert.True(t, ok)
+				offsets = append(offsets, sm.Offset)
+				truncated = append(truncated, sm.Truncated)
+			}
+			if err == io.EOF {
+				break
+			}
+		}
+		assert.Equal(t, test.expect, lines, test.action)
+		assert.Equal(t, test.offsets, offsets, test.action)
+		assert.Equal(t, test.truncated, truncated, test.action)
+		r.Close()
+		DestroyDir()
+	}
+
+	_, _, err := MaxLineConf(conf.MapConf{KeyMaxLineLength: "-1"})
+	assert.Error(t, err)
+	_, _, err = MaxLineConf(conf.MapConf{KeyMaxLineAction: "drop"})
+	assert.Error(t, err)
+}
+
 func Test_BuffReaderMultiLine(t *testing.T) {
 	body := "test123\n12\n34\n56\ntest\nxtestx\n123\n"
 	createSeqFile(1000, body)
@@ -370,6 +719,101 @@ func Test_BuffReaderMultiLine(t *testing.T) {
 	r.Close()
 }
 
+func Test_BuffReaderMultiLineFlush(t *testing.T) {
+	createSeqFile(1000, "test1\na\nb\nc\ntest2\nd\n")
+	defer DestroyDir()
+	c := conf.MapConf{
+		"log_path":           Dir,
+		"meta_path":          MetaDir,
+		"mode":               DirMode,
+		"read_from":          "oldest",
+		"head_pattern":       "^test",
+		KeyMultiLineTimeout:  "100ms",
+		KeyMultiLineMaxLines: "3",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	var lines []string
+	start := time.Now()
+	for len(lines) < 3 && time.Since(start) < 5*time.Second {
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	// 达到最大行数时直接发送，剩下的 c 单独作为一条；最后一条等不到下一个行首，超时后发送
+	assert.Equal(t, []string{"test1\na\nb\n", "c\n", "test2\nd\n"}, lines)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	_, _, err = MultiLineConf(conf.MapConf{KeyMultiLineTimeout: "abc"})
+	assert.Error(t, err)
+	_, _, err = MultiLineConf(conf.MapConf{KeyMultiLineMaxLines: "-1"})
+	assert.Error(t, err)
+}
+
+func Test_BuffReaderContinuePattern(t *testing.T) {
+	tests := []struct {
+		content string
+		pattern string
+		match   string
+		expect  []string
+	}{
+		{
+			content: "Exception in thread main\n\tat a.b(c.java:1)\n\tat d.e(f.java:2)\nnext line\nlast\n  more\n",
+			pattern: `^\s`,
+			match:   ContinueMatchAfter,
+			expect:  []string{"Exception in thread main\n\tat a.b(c.java:1)\n\tat d.e(f.java:2)\n", "next line\n", "last\n  more\n"},
+		},
+		{
+			content: "a \\\nb \\\nc\nd\ne \\\nf\n",
+			pattern: `\\$`,
+			match:   ContinueMatchBefore,
+			expect:  []string{"a \\\nb \\\nc\n", "d\n", "e \\\nf\n"},
+		},
+	}
+	for _, test := range tests {
+		CreateDir()
+		path := filepath.Join(Dir, "continue.log")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(test.content), DefaultFilePerm))
+		c := conf.MapConf{
+			"mode":             ModeFile,
+			"log_path":         path,
+			"meta_path":        MetaDir,
+			"read_from":        "oldest",
+			KeyContinuePattern: test.pattern,
+			KeyContinueMatch:   test.match,
+		}
+		r, err := NewFileBufReader(c, false)
+		assert.NoError(t, err)
+		var lines []string
+		for i := 0; i < 20; i++ {
+			line, err := r.ReadLine()
+			if line != "" {
+				lines = append(lines, line)
+			}
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, test.expect, lines, test.match)
+		r.Close()
+		DestroyDir()
+	}
+
+	_, err := NewContinuePatternWithConf(conf.MapConf{KeyContinuePattern: "^\\s", KeyContinueMatch: "middle"})
+	assert.Error(t, err)
+	_, err = NewFileBufReader(conf.MapConf{
+		"mode":             ModeFile,
+		"log_path":         "continue.log",
+		KeyHeadPattern:     "^a",
+		KeyContinuePattern: "^\\s",
+	}, false)
+	assert.Error(t, err)
+}
+
 func Test_BuffReaderStats(t *testing.T) {
 	body := "Test_BuffReaderStats\n"
 	createSeqFile(1000, body)
@@ -3,16 +3,27 @@ package builtin
 
 import (
 	_ "github.com/qiniu/logkit/reader/autofile"
+	_ "github.com/qiniu/logkit/reader/binlog"
 	_ "github.com/qiniu/logkit/reader/cloudtrail"
 	_ "github.com/qiniu/logkit/reader/cloudwatch"
+	_ "github.com/qiniu/logkit/reader/docker"
 	_ "github.com/qiniu/logkit/reader/elastic"
+	_ "github.com/qiniu/logkit/reader/grpc"
 	_ "github.com/qiniu/logkit/reader/http"
+	_ "github.com/qiniu/logkit/reader/journald"
+	_ "github.com/qiniu/logkit/reader/k8s"
 	_ "github.com/qiniu/logkit/reader/kafka"
+	_ "github.com/qiniu/logkit/reader/loopback"
 	_ "github.com/qiniu/logkit/reader/mongo"
+	_ "github.com/qiniu/logkit/reader/mqtt"
+	_ "github.com/qiniu/logkit/reader/nats"
 	_ "github.com/qiniu/logkit/reader/redis"
+	_ "github.com/qiniu/logkit/reader/s3"
 	_ "github.com/qiniu/logkit/reader/script"
 	_ "github.com/qiniu/logkit/reader/snmp"
 	_ "github.com/qiniu/logkit/reader/socket"
 	_ "github.com/qiniu/logkit/reader/sql"
+	_ "github.com/qiniu/logkit/reader/syslog"
 	_ "github.com/qiniu/logkit/reader/tailx"
+	_ "github.com/qiniu/logkit/reader/wineventlog"
 )
@@ -2,6 +2,7 @@ package cloudwatch
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,7 +34,14 @@ type (
 		Metrics         []*Metric
 		CacheTTL        time.Duration
 		RateLimit       int64
+		LogGroups       []string       // 读取这些日志组中的日志
+		LogGroupPattern *regexp.Regexp // 同时读取名称匹配的日志组，为 nil 时只读取 LogGroups
+		StreamPrefixes  []string       // 只读取名称以其中之一开头的日志流，为空时读取所有日志流
 		client          cloudwatchClient
+		logsClient      cloudwatchLogsClient
+		logsStartTime   int64 // 没有读取进度的日志流从这个时间开始读取，单位为毫秒，为 0 时从头读取
+		streams         map[string]*logStream
+		streamsLock     sync.Mutex
 		metricCache     *MetricCache
 		meta            *reader.Meta
 		status          int32
@@ -73,8 +81,27 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (c reader.Reader, err error
 	if err != nil {
 		return
 	}
+	logGroups, _ := conf.GetStringListOr(reader.KeyLogGroups, []string{})
+	logGroupPattern, _ := conf.GetStringOr(reader.KeyLogGroupPattern, "")
+	streamPrefixes, _ := conf.GetStringListOr(reader.KeyLogStreamPrefix, []string{})
+	var groupRegexp *regexp.Regexp
+	if logGroupPattern != "" {
+		if groupRegexp, err = regexp.Compile(logGroupPattern); err != nil {
+			err = fmt.Errorf("%v %v compile error %v", reader.KeyLogGroupPattern, logGroupPattern, err)
+			return
+		}
+	}
+	// 配置了日志组时只读取日志，不需要 namespace
 	namespace, err := conf.GetString(reader.KeyNamespace)
 	if err != nil {
+		if len(logGroups) == 0 && groupRegexp == nil {
+			return
+		}
+		err = nil
+	}
+	whence, _ := conf.GetStringOr(reader.KeyWhence, reader.WhenceOldest)
+	if whence != reader.WhenceOldest && whence != reader.WhenceNewest {
+		err = fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyWhence, whence, reader.WhenceOldest, reader.WhenceNewest)
 		return
 	}
 
@@ -148,10 +175,21 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (c reader.Reader, err error
 		Metrics = []*Metric{{MetricNames: metrics, Dimensions: dimensions}}
 	}
 
+	var logsStartTime int64
+	if whence == reader.WhenceNewest {
+		logsStartTime = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
 	return &CloudWatch{
 		Region:          region,
 		Namespace:       namespace,
+		LogGroups:       logGroups,
+		LogGroupPattern: groupRegexp,
+		StreamPrefixes:  streamPrefixes,
 		client:          cloudwatch.New(configProvider, cfg),
+		logsClient:      newLogsClient(configProvider, cfg),
+		logsStartTime:   logsStartTime,
+		streams:         make(map[string]*logStream),
 		RateLimit:       ratelimit,
 		CacheTTL:        ttl,
 		Delay:           delay,
@@ -203,7 +241,9 @@ func (c *CloudWatch) Close() error {
 	return nil
 }
 
-func (c *CloudWatch) SyncMeta() {}
+func (c *CloudWatch) SyncMeta() {
+	c.syncLogStreams()
+}
 
 func isIn(metrics []string, now string) bool {
 	for _, v := range metrics {
@@ -317,7 +357,21 @@ func (s *CloudWatch) sendError(err error) {
 	s.errChan <- err
 }
 
+// Gather 收集 namespace 中的 metrics，配置了日志组时还会读取日志，返回最后一个错误
 func (c *CloudWatch) Gather() error {
+	var lastErr error
+	if c.Namespace != "" {
+		lastErr = c.GatherMetrics()
+	}
+	if c.logsEnabled() {
+		if err := c.GatherLogs(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (c *CloudWatch) GatherMetrics() error {
 	var lastErr error
 	metrics, err := SelectMetrics(c)
 	if err != nil {
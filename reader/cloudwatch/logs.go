@@ -0,0 +1,267 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"github.com/qiniu/log"
+	"github.com/qiniu/pandora-go-sdk/base/ratelimit"
+
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/utils/models"
+	utilsos "github.com/qiniu/logkit/utils/os"
+)
+
+// streamCheckpointName 是日志流的读取进度在 sub meta 中的名称
+const streamCheckpointName = "stream_checkpoint"
+
+var errLogsStopped = errors.New("cloudwatch logs reader stopped")
+
+// logStream 是一个日志流的读取状态，读取进度保存在以日志组和日志流名称命名的 sub meta 中，和 tailx 中每个文件的 meta 一样
+type logStream struct {
+	group         string
+	name          string
+	meta          *reader.Meta
+	checkpoint    streamCheckpoint // 只在 streamsLock 中修改
+	synced        streamCheckpoint // 最近一次写入 meta 的进度
+	lastIngestion int64            // 上次读取时 DescribeLogStreams 返回的最近写入时间，没有变化时不需要再读取
+}
+
+// streamCheckpoint 是日志流的读取进度，NextToken 失效时从 LastTimestamp 之后继续读取
+type streamCheckpoint struct {
+	NextToken     string `json:"next_token"`
+	LastTimestamp int64  `json:"last_timestamp"`
+}
+
+func (c *CloudWatch) logsEnabled() bool {
+	return len(c.LogGroups) > 0 || c.LogGroupPattern != nil
+}
+
+// selectLogGroups 返回需要读取的日志组，包括 log_groups 中填写的以及 log_group_pattern 匹配的日志组
+func (c *CloudWatch) selectLogGroups(lmtr *ratelimit.Limiter) ([]string, error) {
+	groups := make(map[string]bool)
+	for _, g := range c.LogGroups {
+		groups[g] = true
+	}
+	if c.LogGroupPattern != nil {
+		var token string
+		for {
+			lmtr.Assign(1)
+			resp, err := c.logsClient.DescribeLogGroups(&describeLogGroupsInput{NextToken: token})
+			if err != nil {
+				return nil, err
+			}
+			for _, g := range resp.LogGroups {
+				if c.LogGroupPattern.MatchString(g.LogGroupName) {
+					groups[g.LogGroupName] = true
+				}
+			}
+			if token = resp.NextToken; token == "" {
+				break
+			}
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// selectLogStreams 返回日志组中需要读取的日志流，配置了 log_stream_prefix 时只返回名称以其中之一开头的日志流
+func (c *CloudWatch) selectLogStreams(group string, lmtr *ratelimit.Limiter) ([]logStreamInfo, error) {
+	prefixes := c.StreamPrefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	var streams []logStreamInfo
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		var token string
+		for {
+			lmtr.Assign(1)
+			resp, err := c.logsClient.DescribeLogStreams(&describeLogStreamsInput{
+				LogGroupName:        group,
+				LogStreamNamePrefix: prefix,
+				NextToken:           token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range resp.LogStreams {
+				if !seen[s.LogStreamName] {
+					seen[s.LogStreamName] = true
+					streams = append(streams, s)
+				}
+			}
+			if token = resp.NextToken; token == "" {
+				break
+			}
+		}
+	}
+	return streams, nil
+}
+
+// GatherLogs 读取所有日志组中日志流的新数据，一个日志组出错时继续读取其他日志组，返回最后一个错误
+func (c *CloudWatch) GatherLogs() error {
+	lmtr := ratelimit.NewLimiter(c.RateLimit)
+	defer lmtr.Close()
+	groups, err := c.selectLogGroups(lmtr)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, group := range groups {
+		streams, err := c.selectLogStreams(group, lmtr)
+		if err != nil {
+			log.Errorf("runner[%v] Reader[%v] describe log streams of %v error %v", c.meta.RunnerName, c.Name(), group, err)
+			lastErr = err
+			c.sendError(err)
+			continue
+		}
+		for _, info := range streams {
+			ls, err := c.getLogStream(group, info.LogStreamName)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if info.LastIngestionTime != 0 && info.LastIngestionTime == ls.lastIngestion {
+				continue
+			}
+			err = c.gatherStream(ls, lmtr)
+			if err == errLogsStopped {
+				return nil
+			}
+			if err != nil {
+				log.Errorf("runner[%v] Reader[%v] get log events of %v/%v error %v", c.meta.RunnerName, c.Name(), group, info.LogStreamName, err)
+				lastErr = err
+				c.sendError(err)
+				continue
+			}
+			ls.lastIngestion = info.LastIngestionTime
+		}
+	}
+	return lastErr
+}
+
+// getLogStream 返回日志流的读取状态，第一次读取时创建 sub meta 并恢复之前保存的读取进度
+func (c *CloudWatch) getLogStream(group, name string) (*logStream, error) {
+	key := group + "/" + name
+	c.streamsLock.Lock()
+	defer c.streamsLock.Unlock()
+	if ls, ok := c.streams[key]; ok {
+		return ls, nil
+	}
+	rpath := utilsos.SafeFileName(key)
+	subMetaPath := filepath.Join(c.meta.Dir, rpath)
+	subMeta, err := reader.NewMeta(subMetaPath, subMetaPath, key, reader.ModeCloudWatch, c.meta.TagFile, reader.DefautFileRetention)
+	if err != nil {
+		return nil, err
+	}
+	subMeta.RunnerName = c.meta.RunnerName
+	subMeta.ShareStore(c.meta, rpath)
+	ls := &logStream{group: group, name: name, meta: subMeta}
+	content, err := subMeta.ReadValue(streamCheckpointName)
+	if err == nil {
+		if err = json.Unmarshal(content, &ls.checkpoint); err != nil {
+			log.Warnf("runner[%v] Reader[%v] ignore invalid checkpoint of %v: %v", c.meta.RunnerName, c.Name(), key, err)
+			ls.checkpoint = streamCheckpoint{}
+		}
+		ls.synced = ls.checkpoint
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err = c.meta.AddSubMeta(rpath, subMeta); err != nil {
+		return nil, err
+	}
+	c.streams[key] = ls
+	return ls, nil
+}
+
+// gatherStream 从读取进度开始读取日志流中所有的新数据，每一页数据都被 ReadLine 取走之后才更新读取进度
+func (c *CloudWatch) gatherStream(ls *logStream, lmtr *ratelimit.Limiter) error {
+	c.streamsLock.Lock()
+	cp := ls.checkpoint
+	c.streamsLock.Unlock()
+	for {
+		input := &getLogEventsInput{
+			LogGroupName:  ls.group,
+			LogStreamName: ls.name,
+			NextToken:     cp.NextToken,
+			StartFromHead: true,
+		}
+		if input.NextToken == "" {
+			if cp.LastTimestamp > 0 {
+				// 时间相同的数据可能会被跳过，只在 token 失效时发生
+				input.StartTime = cp.LastTimestamp + 1
+			} else {
+				input.StartTime = c.logsStartTime
+			}
+		}
+		lmtr.Assign(1)
+		resp, err := c.logsClient.GetLogEvents(input)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && input.NextToken != "" && aerr.Code() == "InvalidParameterException" {
+				log.Warnf("runner[%v] Reader[%v] next token of %v/%v is invalid, read from timestamp %v: %v", c.meta.RunnerName, c.Name(), ls.group, ls.name, cp.LastTimestamp, err)
+				cp.NextToken = ""
+				continue
+			}
+			return err
+		}
+		for _, event := range resp.Events {
+			data := models.Data{
+				"log_group":         ls.group,
+				"log_stream":        ls.name,
+				"message":           event.Message,
+				reader.KeyTimestamp: time.Unix(0, event.Timestamp*int64(time.Millisecond)),
+				"ingestion_time":    time.Unix(0, event.IngestionTime*int64(time.Millisecond)),
+			}
+			select {
+			case c.DataChan <- data:
+			case <-c.StopChan:
+				return errLogsStopped
+			}
+			if event.Timestamp > cp.LastTimestamp {
+				cp.LastTimestamp = event.Timestamp
+			}
+		}
+		end := len(resp.Events) == 0 || resp.NextForwardToken == "" || resp.NextForwardToken == input.NextToken
+		if resp.NextForwardToken != "" {
+			cp.NextToken = resp.NextForwardToken
+		}
+		c.streamsLock.Lock()
+		ls.checkpoint = cp
+		c.streamsLock.Unlock()
+		if end {
+			return nil
+		}
+	}
+}
+
+// syncLogStreams 把读取进度有变化的日志流写入 meta
+func (c *CloudWatch) syncLogStreams() {
+	c.streamsLock.Lock()
+	defer c.streamsLock.Unlock()
+	for key, ls := range c.streams {
+		if ls.checkpoint == ls.synced {
+			continue
+		}
+		content, err := json.Marshal(ls.checkpoint)
+		if err != nil {
+			log.Errorf("runner[%v] Reader[%v] marshal checkpoint of %v error %v", c.meta.RunnerName, c.Name(), key, err)
+			continue
+		}
+		if err = ls.meta.WriteValue(streamCheckpointName, content); err != nil {
+			log.Errorf("runner[%v] Reader[%v] write checkpoint of %v error %v", c.meta.RunnerName, c.Name(), key, err)
+			continue
+		}
+		ls.synced = ls.checkpoint
+	}
+}
@@ -0,0 +1,173 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// vendor 中的 aws-sdk-go 没有 cloudwatchlogs 包，这里按照 CloudWatch Logs 的 JSON 1.1 协议实现读取日志需要的三个接口，
+// 请求的签名、重试和鉴权仍然由 aws-sdk-go 处理
+const (
+	logsServiceName  = "logs"
+	logsAPIVersion   = "2014-03-28"
+	logsTargetPrefix = "Logs_20140328"
+)
+
+type (
+	cloudwatchLogsClient interface {
+		DescribeLogGroups(*describeLogGroupsInput) (*describeLogGroupsOutput, error)
+		DescribeLogStreams(*describeLogStreamsInput) (*describeLogStreamsOutput, error)
+		GetLogEvents(*getLogEventsInput) (*getLogEventsOutput, error)
+	}
+
+	describeLogGroupsInput struct {
+		LogGroupNamePrefix string `json:"logGroupNamePrefix,omitempty"`
+		NextToken          string `json:"nextToken,omitempty"`
+	}
+
+	describeLogGroupsOutput struct {
+		LogGroups []logGroup `json:"logGroups"`
+		NextToken string     `json:"nextToken"`
+	}
+
+	logGroup struct {
+		LogGroupName string `json:"logGroupName"`
+	}
+
+	describeLogStreamsInput struct {
+		LogGroupName        string `json:"logGroupName"`
+		LogStreamNamePrefix string `json:"logStreamNamePrefix,omitempty"`
+		NextToken           string `json:"nextToken,omitempty"`
+	}
+
+	describeLogStreamsOutput struct {
+		LogStreams []logStreamInfo `json:"logStreams"`
+		NextToken  string          `json:"nextToken"`
+	}
+
+	logStreamInfo struct {
+		LogStreamName     string `json:"logStreamName"`
+		LastIngestionTime int64  `json:"lastIngestionTime"`
+	}
+
+	getLogEventsInput struct {
+		LogGroupName  string `json:"logGroupName"`
+		LogStreamName string `json:"logStreamName"`
+		StartTime     int64  `json:"startTime,omitempty"`
+		NextToken     string `json:"nextToken,omitempty"`
+		StartFromHead bool   `json:"startFromHead"`
+	}
+
+	getLogEventsOutput struct {
+		Events           []logEvent `json:"events"`
+		NextForwardToken string     `json:"nextForwardToken"`
+	}
+
+	logEvent struct {
+		Timestamp     int64  `json:"timestamp"`
+		IngestionTime int64  `json:"ingestionTime"`
+		Message       string `json:"message"`
+	}
+
+	logsClient struct {
+		*client.Client
+	}
+)
+
+func newLogsClient(p client.ConfigProvider, cfgs ...*aws.Config) *logsClient {
+	c := p.ClientConfig(logsServiceName, cfgs...)
+	svc := &logsClient{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   logsServiceName,
+				SigningName:   c.SigningName,
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    logsAPIVersion,
+				JSONVersion:   "1.1",
+				TargetPrefix:  logsTargetPrefix,
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(request.NamedHandler{Name: "logkit.logs.Build", Fn: buildLogsRequest})
+	svc.Handlers.Unmarshal.PushBackNamed(request.NamedHandler{Name: "logkit.logs.Unmarshal", Fn: unmarshalLogsResponse})
+	svc.Handlers.UnmarshalError.PushBackNamed(request.NamedHandler{Name: "logkit.logs.UnmarshalError", Fn: unmarshalLogsError})
+	return svc
+}
+
+func (c *logsClient) send(name string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	return c.NewRequest(op, input, output).Send()
+}
+
+func (c *logsClient) DescribeLogGroups(input *describeLogGroupsInput) (*describeLogGroupsOutput, error) {
+	output := &describeLogGroupsOutput{}
+	return output, c.send("DescribeLogGroups", input, output)
+}
+
+func (c *logsClient) DescribeLogStreams(input *describeLogStreamsInput) (*describeLogStreamsOutput, error) {
+	output := &describeLogStreamsOutput{}
+	return output, c.send("DescribeLogStreams", input, output)
+}
+
+func (c *logsClient) GetLogEvents(input *getLogEventsInput) (*getLogEventsOutput, error) {
+	output := &getLogEventsOutput{}
+	return output, c.send("GetLogEvents", input, output)
+}
+
+func buildLogsRequest(r *request.Request) {
+	body, err := json.Marshal(r.Params)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed encoding JSON RPC request", err)
+		return
+	}
+	r.SetBufferBody(body)
+	r.HTTPRequest.Header.Set("X-Amz-Target", r.ClientInfo.TargetPrefix+"."+r.Operation.Name)
+	r.HTTPRequest.Header.Set("Content-Type", "application/x-amz-json-"+r.ClientInfo.JSONVersion)
+}
+
+func unmarshalLogsResponse(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	r.RequestID = r.HTTPResponse.Header.Get("X-Amzn-Requestid")
+	if err := json.NewDecoder(r.HTTPResponse.Body).Decode(r.Data); err != nil && err != io.EOF {
+		r.Error = awserr.New("SerializationError", "failed decoding JSON RPC response", err)
+	}
+}
+
+func unmarshalLogsError(r *request.Request) {
+	defer r.HTTPResponse.Body.Close()
+	body, err := ioutil.ReadAll(r.HTTPResponse.Body)
+	if err != nil {
+		r.Error = awserr.New("SerializationError", "failed reading JSON RPC error response", err)
+		return
+	}
+	var resp struct {
+		Code    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil || resp.Code == "" {
+		resp.Code = "UnknownError"
+		resp.Message = string(body)
+	}
+	// __type 可能带有 com.amazonaws 的前缀，如 com.amazonaws.logs#ResourceNotFoundException
+	if i := strings.LastIndex(resp.Code, "#"); i >= 0 {
+		resp.Code = resp.Code[i+1:]
+	}
+	r.Error = awserr.NewRequestFailure(awserr.New(resp.Code, resp.Message, nil), r.HTTPResponse.StatusCode, r.HTTPResponse.Header.Get("X-Amzn-Requestid"))
+}
@@ -0,0 +1,168 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/utils/models"
+)
+
+// mockLogsClient 中每页返回一条数据，token 为下一条数据的下标
+type mockLogsClient struct {
+	groups  []string
+	streams map[string][]string
+	events  map[string][]string
+	expired bool // 为 true 时所有的 token 都已经失效
+}
+
+func (m *mockLogsClient) DescribeLogGroups(input *describeLogGroupsInput) (*describeLogGroupsOutput, error) {
+	out := &describeLogGroupsOutput{}
+	for _, g := range m.groups {
+		out.LogGroups = append(out.LogGroups, logGroup{LogGroupName: g})
+	}
+	return out, nil
+}
+
+func (m *mockLogsClient) DescribeLogStreams(input *describeLogStreamsInput) (*describeLogStreamsOutput, error) {
+	out := &describeLogStreamsOutput{}
+	for _, s := range m.streams[input.LogGroupName] {
+		if strings.HasPrefix(s, input.LogStreamNamePrefix) {
+			out.LogStreams = append(out.LogStreams, logStreamInfo{LogStreamName: s})
+		}
+	}
+	return out, nil
+}
+
+func (m *mockLogsClient) GetLogEvents(input *getLogEventsInput) (*getLogEventsOutput, error) {
+	if input.NextToken != "" && m.expired {
+		return nil, awserr.New("InvalidParameterException", "token expired", nil)
+	}
+	events := m.events[input.LogGroupName+"/"+input.LogStreamName]
+	idx := 0
+	if input.NextToken != "" {
+		idx, _ = strconv.Atoi(input.NextToken)
+	} else {
+		for idx < len(events) && int64(idx+1) < input.StartTime {
+			idx++
+		}
+	}
+	out := &getLogEventsOutput{NextForwardToken: strconv.Itoa(idx)}
+	if idx < len(events) {
+		// 第 i 条数据的时间为 i+1 毫秒
+		out.Events = []logEvent{{Timestamp: int64(idx + 1), Message: events[idx]}}
+		out.NextForwardToken = strconv.Itoa(idx + 1)
+	}
+	return out, nil
+}
+
+func newTestLogsReader(t *testing.T, dir string, client cloudwatchLogsClient) *CloudWatch {
+	meta, err := reader.NewMeta(dir, dir, "", reader.ModeCloudWatch, "", reader.DefautFileRetention)
+	assert.NoError(t, err)
+	return &CloudWatch{
+		Region:          "us-east-1",
+		LogGroups:       []string{"app"},
+		LogGroupPattern: regexp.MustCompile("^/aws/lambda/"),
+		StreamPrefixes:  []string{"2018/", "prod"},
+		RateLimit:       100,
+		logsClient:      client,
+		meta:            meta,
+		streams:         make(map[string]*logStream),
+		StopChan:        make(chan struct{}),
+		DataChan:        make(chan models.Data, 100),
+		errChan:         make(chan error, 100),
+	}
+}
+
+func readMessages(c *CloudWatch) []string {
+	var messages []string
+	for len(c.DataChan) > 0 {
+		d := <-c.DataChan
+		messages = append(messages, d["log_group"].(string)+"/"+d["log_stream"].(string)+":"+d["message"].(string))
+	}
+	return messages
+}
+
+func TestGatherLogs(t *testing.T) {
+	dir := "TestGatherLogs"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	client := &mockLogsClient{
+		groups: []string{"/aws/lambda/f1", "/aws/ecs/s1", "app"},
+		streams: map[string][]string{
+			"/aws/lambda/f1": {"2018/01/01/[$LATEST]a", "test"},
+			"app":            {"prod-1"},
+		},
+		events: map[string][]string{
+			"/aws/lambda/f1/2018/01/01/[$LATEST]a": {"a1", "a2"},
+			"/aws/lambda/f1/test":                  {"t1"},
+			"app/prod-1":                           {"p1"},
+		},
+	}
+	c := newTestLogsReader(t, dir, client)
+	assert.NoError(t, c.GatherLogs())
+	assert.Equal(t, []string{"/aws/lambda/f1/2018/01/01/[$LATEST]a:a1", "/aws/lambda/f1/2018/01/01/[$LATEST]a:a2", "app/prod-1:p1"}, readMessages(c))
+	c.SyncMeta()
+
+	// 新的 reader 从保存的进度继续读取
+	client.events["/aws/lambda/f1/2018/01/01/[$LATEST]a"] = append(client.events["/aws/lambda/f1/2018/01/01/[$LATEST]a"], "a3")
+	c = newTestLogsReader(t, dir, client)
+	assert.NoError(t, c.GatherLogs())
+	assert.Equal(t, []string{"/aws/lambda/f1/2018/01/01/[$LATEST]a:a3"}, readMessages(c))
+
+	// token 失效时从最后一条数据的时间之后继续读取
+	client.expired = true
+	client.events["app/prod-1"] = append(client.events["app/prod-1"], "p2")
+	assert.NoError(t, c.GatherLogs())
+	assert.Equal(t, []string{"app/prod-1:p2"}, readMessages(c))
+}
+
+func TestLogsClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.NotEmpty(t, r.Header.Get("Authorization"))
+		var input getLogEventsInput
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		switch r.Header.Get("X-Amz-Target") {
+		case "Logs_20140328.GetLogEvents":
+			assert.Equal(t, "g", input.LogGroupName)
+			assert.True(t, input.StartFromHead)
+			w.Write([]byte(`{"events":[{"timestamp":1,"ingestionTime":2,"message":"hello"}],"nextForwardToken":"f/1"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.logs#ResourceNotFoundException","message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("ak", "sk", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	assert.NoError(t, err)
+	client := newLogsClient(sess)
+
+	out, err := client.GetLogEvents(&getLogEventsInput{LogGroupName: "g", LogStreamName: "s", StartFromHead: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []logEvent{{Timestamp: 1, IngestionTime: 2, Message: "hello"}}, out.Events)
+	assert.Equal(t, "f/1", out.NextForwardToken)
+
+	_, err = client.DescribeLogStreams(&describeLogStreamsInput{LogGroupName: "g"})
+	aerr, ok := err.(awserr.RequestFailure)
+	assert.True(t, ok)
+	assert.Equal(t, "ResourceNotFoundException", aerr.Code())
+	assert.Equal(t, http.StatusBadRequest, aerr.StatusCode())
+}
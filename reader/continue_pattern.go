@@ -0,0 +1,71 @@
+package reader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+// ContinuePattern 是另一种多行模式，根据一行是否为上一行的延续来拼接数据，适用于 head_pattern 无法描述的格式。
+// Before 为 false 时匹配 Regexp 的行追加到上一行后面，如以空白开头的异常堆栈；
+// Before 为 true 时匹配 Regexp 的行和下一行属于同一条数据，如以反斜杠结尾的行
+type ContinuePattern struct {
+	Regexp *regexp.Regexp
+	Before bool
+}
+
+// NewContinuePatternWithConf 根据 continue_pattern 和 continue_match 创建 ContinuePattern，没有配置 continue_pattern 时返回 nil
+func NewContinuePatternWithConf(conf conf.MapConf) (*ContinuePattern, error) {
+	pattern, _ := conf.GetStringOr(KeyContinuePattern, "")
+	if pattern == "" {
+		return nil, nil
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%v %v compile error %v", KeyContinuePattern, pattern, err)
+	}
+	match, _ := conf.GetStringOr(KeyContinueMatch, ContinueMatchAfter)
+	if match != ContinueMatchAfter && match != ContinueMatchBefore {
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", KeyContinueMatch, match, ContinueMatchAfter, ContinueMatchBefore)
+	}
+	return &ContinuePattern{Regexp: reg, Before: match == ContinueMatchBefore}, nil
+}
+
+// ContinuePatternMode 解析 SetMode 传入的 ContinuePattern，值为 string 时按照正则表达式编译，匹配的行追加到上一行后面
+func ContinuePatternMode(mode string, v interface{}) (*ContinuePattern, error) {
+	if mode != ReadModeContinuePattern {
+		return nil, fmt.Errorf("unknown ContinuePatternMode %v", mode)
+	}
+	switch value := v.(type) {
+	case *ContinuePattern:
+		if value == nil || value.Regexp == nil {
+			return nil, fmt.Errorf(" %v is empty continue pattern", v)
+		}
+		return value, nil
+	case string:
+		reg, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v compile error %v ", value, err)
+		}
+		return &ContinuePattern{Regexp: reg}, nil
+	default:
+		return nil, fmt.Errorf(" %v is not pattern string or *ContinuePattern type value", v)
+	}
+}
+
+// match 去掉行尾的换行后再匹配，\\$ 这样的正则表达式才能匹配到以反斜杠结尾的行
+func (c *ContinuePattern) match(line string) bool {
+	return c.Regexp.MatchString(strings.TrimRight(line, "\r\n"))
+}
+
+// startsEvent 判断 line 是否为新的一条数据的开始，Before 为 true 时由上一行决定，这里总是返回 false
+func (c *ContinuePattern) startsEvent(line string) bool {
+	return !c.Before && !c.match(line)
+}
+
+// endsEvent 判断 line 是否为一条数据的最后一行，只在 Before 为 true 时生效
+func (c *ContinuePattern) endsEvent(line string) bool {
+	return c.Before && !c.match(line)
+}
@@ -0,0 +1,89 @@
+package reader
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+const DefaultDedupTTL = "10m"
+
+type dedupEntry struct {
+	hash uint64
+	seen time.Time
+}
+
+// Deduper 记录最近读到的数据的哈希值，窗口大小和过期时间内再次出现完全相同的数据时丢弃。
+// 过期时间从数据第一次出现开始计算，重复出现不会延长，避免一直重复的数据永远读不到，不支持并发调用
+type Deduper struct {
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[uint64]*list.Element
+	now     func() time.Time
+}
+
+func NewDeduper(size int, ttl time.Duration) *Deduper {
+	return &Deduper{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[uint64]*list.Element, size),
+		now:     time.Now,
+	}
+}
+
+// NewDeduperWithConf 根据 dedup_window 和 dedup_ttl 创建 Deduper，没有开启去重时返回 nil
+func NewDeduperWithConf(conf conf.MapConf) (*Deduper, error) {
+	size, _ := conf.GetIntOr(KeyDedupWindow, 0)
+	if size < 0 {
+		return nil, fmt.Errorf("%v should not be negative", KeyDedupWindow)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	ttlStr, _ := conf.GetStringOr(KeyDedupTTL, DefaultDedupTTL)
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil {
+		return nil, fmt.Errorf("%v %q is not a valid duration: %v", KeyDedupTTL, ttlStr, err)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("%v should be positive", KeyDedupTTL)
+	}
+	return NewDeduper(size, ttl), nil
+}
+
+// Duplicate 返回 line 是否在窗口中出现过，没有出现过时把它加入窗口
+func (d *Deduper) Duplicate(line string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	sum := h.Sum64()
+	now := d.now()
+	d.evict(now)
+	if _, ok := d.entries[sum]; ok {
+		return true
+	}
+	d.entries[sum] = d.order.PushBack(&dedupEntry{hash: sum, seen: now})
+	if d.order.Len() > d.size {
+		d.remove(d.order.Front())
+	}
+	return false
+}
+
+// evict 删除已经过期的数据，窗口中的数据按照第一次出现的时间排列，只需要从头检查
+func (d *Deduper) evict(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		if now.Sub(e.Value.(*dedupEntry).seen) < d.ttl {
+			return
+		}
+		d.remove(e)
+	}
+}
+
+func (d *Deduper) remove(e *list.Element) {
+	delete(d.entries, e.Value.(*dedupEntry).hash)
+	d.order.Remove(e)
+}
@@ -0,0 +1,83 @@
+package reader
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/reader/test"
+)
+
+func TestDeduper(t *testing.T) {
+	now := time.Now()
+	d := NewDeduper(2, time.Minute)
+	d.now = func() time.Time { return now }
+
+	assert.False(t, d.Duplicate("a"))
+	assert.True(t, d.Duplicate("a"))
+	assert.False(t, d.Duplicate("b"))
+	assert.False(t, d.Duplicate("c"))
+	// 超过窗口大小，最早的 a 被挤出
+	assert.False(t, d.Duplicate("a"))
+	assert.True(t, d.Duplicate("c"))
+
+	// 重复出现不会延长过期时间
+	now = now.Add(59 * time.Second)
+	assert.True(t, d.Duplicate("c"))
+	now = now.Add(time.Second)
+	assert.False(t, d.Duplicate("c"))
+	// a 也已经过期，只剩下重新加入的 c
+	assert.Equal(t, 1, d.order.Len())
+	assert.Equal(t, 1, len(d.entries))
+}
+
+func TestNewDeduperWithConf(t *testing.T) {
+	d, err := NewDeduperWithConf(conf.MapConf{})
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+
+	d, err = NewDeduperWithConf(conf.MapConf{KeyDedupWindow: "100"})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, d.size)
+	assert.Equal(t, 10*time.Minute, d.ttl)
+
+	_, err = NewDeduperWithConf(conf.MapConf{KeyDedupWindow: "-1"})
+	assert.Error(t, err)
+	_, err = NewDeduperWithConf(conf.MapConf{KeyDedupWindow: "100", KeyDedupTTL: "abc"})
+	assert.Error(t, err)
+	_, err = NewDeduperWithConf(conf.MapConf{KeyDedupWindow: "100", KeyDedupTTL: "0s"})
+	assert.Error(t, err)
+}
+
+func TestBufReaderDedup(t *testing.T) {
+	CreateDir()
+	defer DestroyDir()
+	path := filepath.Join(Dir, "dedup.log")
+	CreateFile(path, "a\nb\na\nc\nb\n")
+	c := conf.MapConf{
+		"mode":         ModeFile,
+		"log_path":     path,
+		"meta_path":    MetaDir,
+		"read_from":    "oldest",
+		KeyDedupWindow: "10",
+	}
+	r, err := NewFileBufReader(c, false)
+	assert.NoError(t, err)
+	defer r.Close()
+	var lines []string
+	for {
+		line, err := r.ReadLine()
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"a\n", "b\n", "c\n"}, lines)
+}
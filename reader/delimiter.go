@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+// Delimiter 是 BufReader 切分数据使用的分隔符，可以是固定的字节序列或者正则表达式，
+// 在转码前的原始数据上匹配，读取到的数据不包含分隔符
+type Delimiter struct {
+	literal []byte
+	regexp  *regexp.Regexp
+	suffix  *regexp.Regexp // 匹配数据末尾的分隔符，用于去掉分隔符
+}
+
+// NewDelimiter 创建固定字节序列的分隔符
+func NewDelimiter(delim []byte) (*Delimiter, error) {
+	if len(delim) == 0 {
+		return nil, errors.New("line delimiter should not be empty")
+	}
+	return &Delimiter{literal: delim}, nil
+}
+
+// NewRegexpDelimiter 创建正则表达式的分隔符，分隔符不能匹配空字符串
+func NewRegexpDelimiter(pattern string) (*Delimiter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.MatchString("") {
+		return nil, fmt.Errorf("line delimiter regexp %q should not match empty string", pattern)
+	}
+	return &Delimiter{
+		regexp: re,
+		suffix: regexp.MustCompile("(?:" + pattern + ")$"),
+	}, nil
+}
+
+// NewDelimiterWithConf 根据 line_delimiter 或者 line_delimiter_regex 创建分隔符，
+// line_delimiter 支持 \r\n、\x1e 这样的转义写法，没有配置或者为 \n 时返回 nil，按照默认的换行切分
+func NewDelimiterWithConf(conf conf.MapConf) (*Delimiter, error) {
+	literal, _ := conf.GetStringOr(KeyLineDelimiter, "")
+	pattern, _ := conf.GetStringOr(KeyLineDelimiterRegex, "")
+	if literal != "" && pattern != "" {
+		return nil, fmt.Errorf("%v and %v can not be set at the same time", KeyLineDelimiter, KeyLineDelimiterRegex)
+	}
+	if pattern != "" {
+		return NewRegexpDelimiter(pattern)
+	}
+	if literal == "" {
+		return nil, nil
+	}
+	delim, err := strconv.Unquote(`"` + strings.Replace(literal, `"`, `\"`, -1) + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("%v %q is invalid: %v", KeyLineDelimiter, literal, err)
+	}
+	if delim == "\n" {
+		return nil, nil
+	}
+	return NewDelimiter([]byte(delim))
+}
+
+// index 返回 p 中第一个分隔符结束的位置，没有找到时返回 -1。
+// 正则表达式匹配到 p 的末尾时后面的数据可能还属于分隔符，full 为 false 时也返回 -1，等读取更多的数据后再匹配
+func (d *Delimiter) index(p []byte, full bool) int {
+	if d.literal != nil {
+		if i := bytes.Index(p, d.literal); i >= 0 {
+			return i + len(d.literal)
+		}
+		return -1
+	}
+	loc := d.regexp.FindIndex(p)
+	if loc == nil || (loc[1] == len(p) && !full) {
+		return -1
+	}
+	return loc[1]
+}
+
+// trim 去掉 line 末尾的分隔符
+func (d *Delimiter) trim(line string) string {
+	if d.literal != nil {
+		return strings.TrimSuffix(line, string(d.literal))
+	}
+	if loc := d.suffix.FindStringIndex(line); loc != nil {
+		return line[:loc[0]]
+	}
+	return line
+}
@@ -0,0 +1,573 @@
+// Package docker 通过 Docker API 读取容器的 stdout 和 stderr，每个容器的读取位置(最后一条日志的时间戳)保存在各自的 submeta 中，
+// 重启后从上次发送成功的日志之后继续读取
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+	utilsos "github.com/qiniu/logkit/utils/os"
+)
+
+// 读取到的数据中的字段
+const (
+	KeyLog           = "log"
+	KeyStream        = "stream"
+	KeyTime          = "time"
+	KeyContainerID   = "docker_container_id"
+	KeyContainerName = "docker_container_name"
+	KeyImage         = "docker_image"
+	KeyLabels        = "docker_labels"
+)
+
+const (
+	// apiTimeout 是列出和查看容器的请求超时时间，读取日志的请求没有超时
+	apiTimeout = 10 * time.Second
+	// maxLineSize 是一行日志的最大长度，超过后直接输出已经读到的部分
+	maxLineSize = 16 * 1024 * 1024
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeDocker, NewReader)
+}
+
+type container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+
+	name string
+	tty  bool
+}
+
+type line struct {
+	id   string
+	data Data
+	ts   int64
+	size int64
+}
+
+// containerMeta 记录一个容器的读取位置，位置为日志的时间戳(纳秒)
+type containerMeta struct {
+	meta *reader.Meta
+	// readOffset 是最近一次放入 readChan 的日志的时间戳，重新读取这个容器时从这里继续
+	readOffset int64
+	// offset 是最近一次 ReadData 返回的日志的时间戳，SyncMeta 时保存
+	offset int64
+	synced bool
+}
+
+type Reader struct {
+	meta         *reader.Meta
+	host         string
+	baseURL      string
+	client       *http.Client
+	filters      string
+	whence       string
+	statInterval time.Duration
+
+	status int32
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	readChan chan line
+
+	mux        sync.Mutex
+	containers map[string]*containerMeta
+	running    map[string]bool
+	// started 表示已经完成过一次容器的发现，之后发现的容器都是新启动的，从头开始读取
+	started bool
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	host, _ := c.GetStringOr(reader.KeyDockerHost, reader.DefaultDockerHost)
+	labels, _ := c.GetStringListOr(reader.KeyDockerLabelFilters, []string{})
+	names, _ := c.GetStringListOr(reader.KeyDockerNameFilters, []string{})
+	whence, _ := c.GetStringOr(reader.KeyWhence, reader.WhenceNewest)
+	if whence != reader.WhenceOldest && whence != reader.WhenceNewest {
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyWhence, whence, reader.WhenceOldest, reader.WhenceNewest)
+	}
+	statIntervalDur, _ := c.GetStringOr(reader.KeyStatInterval, "10s")
+	statInterval, err := time.ParseDuration(statIntervalDur)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, client, err := newClient(host)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := buildFilters(labels, names)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Reader{
+		meta:         meta,
+		host:         host,
+		baseURL:      baseURL,
+		client:       client,
+		filters:      filters,
+		whence:       whence,
+		statInterval: statInterval,
+		status:       reader.StatusInit,
+		ctx:          ctx,
+		cancel:       cancel,
+		readChan:     make(chan line, 100),
+		containers:   make(map[string]*containerMeta),
+		running:      make(map[string]bool),
+	}, nil
+}
+
+// newClient 根据 docker_host 创建访问 Docker API 的 client，支持 unix:// 和 tcp://
+func newClient(host string) (string, *http.Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return "http://docker", &http.Client{Transport: transport}, nil
+	case "tcp", "http":
+		return "http://" + u.Host, &http.Client{}, nil
+	}
+	return "", nil, fmt.Errorf("%v %v not supported, should be unix:// or tcp://", reader.KeyDockerHost, host)
+}
+
+// buildFilters 返回列出容器时使用的 filters 参数，label 的格式为 key 或者 key=value
+func buildFilters(labels, names []string) (string, error) {
+	filters := map[string][]string{
+		"status": {"running"},
+	}
+	for _, l := range labels {
+		if l = strings.TrimSpace(l); l != "" {
+			filters["label"] = append(filters["label"], l)
+		}
+	}
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			filters["name"] = append(filters["name"], n)
+		}
+	}
+	b, err := json.Marshal(filters)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *Reader) Name() string {
+	return "DockerReader<" + r.host + ">"
+}
+
+func (r *Reader) Source() string {
+	return r.host
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("DockerReader not support readmode")
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+func (r *Reader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+func (r *Reader) run() {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		if err := r.discover(); err != nil {
+			log.Errorf("Runner[%v] %v list containers error: %v", r.meta.RunnerName, r.Name(), err)
+			r.setStatsError(err.Error())
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(r.statInterval):
+		}
+	}
+}
+
+// get 请求 Docker API 并把返回的 JSON 解析到 v 中
+func (r *Reader) get(path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(r.ctx, apiTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %v: %v %v", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover 列出满足过滤条件的容器，为新发现的容器开始读取日志，并清理已经退出并且保存了读取位置的容器
+func (r *Reader) discover() error {
+	var list []container
+	if err := r.get("/containers/json?filters="+url.QueryEscape(r.filters), &list); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	first := !r.started
+	r.started = true
+	listed := make(map[string]bool, len(list))
+	var news []container
+	for _, c := range list {
+		listed[c.ID] = true
+		if !r.running[c.ID] {
+			news = append(news, c)
+		}
+	}
+	for id, cm := range r.containers {
+		if !listed[id] && !r.running[id] && cm.synced {
+			r.meta.RemoveSubMeta(id)
+			delete(r.containers, id)
+		}
+	}
+	r.mux.Unlock()
+
+	for _, c := range news {
+		var inspect struct {
+			Config struct {
+				Tty bool `json:"Tty"`
+			} `json:"Config"`
+		}
+		if err := r.get("/containers/"+c.ID+"/json", &inspect); err != nil {
+			log.Errorf("Runner[%v] %v inspect container %v error: %v", r.meta.RunnerName, r.Name(), c.ID, err)
+			continue
+		}
+		c.tty = inspect.Config.Tty
+		if len(c.Names) > 0 {
+			c.name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		cm, err := r.containerMeta(c.ID)
+		if err != nil {
+			log.Errorf("Runner[%v] %v create meta for container %v error: %v", r.meta.RunnerName, r.Name(), c.ID, err)
+			continue
+		}
+		r.mux.Lock()
+		r.running[c.ID] = true
+		since := cm.readOffset
+		r.mux.Unlock()
+		// 第一次发现的容器在没有读取记录时按照 read_from 决定是否读取已有的日志
+		tail := since == 0 && first && r.whence == reader.WhenceNewest
+		go r.follow(c, since, tail)
+	}
+	return nil
+}
+
+// containerMeta 返回容器的 submeta，第一次使用时从 meta 中读取上次保存的位置
+func (r *Reader) containerMeta(id string) (*containerMeta, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if cm, ok := r.containers[id]; ok {
+		return cm, nil
+	}
+	subMetaPath := filepath.Join(r.meta.Dir, utilsos.SafeFileName(id))
+	subMeta, err := reader.NewMeta(subMetaPath, subMetaPath, id, reader.ModeDocker, r.meta.TagFile, reader.DefautFileRetention)
+	if err != nil {
+		return nil, err
+	}
+	subMeta.ShareStore(r.meta, id)
+	subMeta.RunnerName = r.meta.RunnerName
+	_, offset, err := subMeta.ReadOffset()
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Runner[%v] %v container %v meta data is corrupted err: %v, omit meta data...", r.meta.RunnerName, r.Name(), id, err)
+	}
+	if err = r.meta.AddSubMeta(id, subMeta); err != nil {
+		log.Errorf("Runner[%v] %v add submeta for container %v err %v", r.meta.RunnerName, r.Name(), id, err)
+	}
+	cm := &containerMeta{meta: subMeta, readOffset: offset, offset: offset, synced: true}
+	r.containers[id] = cm
+	return cm, nil
+}
+
+// follow 读取一个容器的日志直到容器退出或者 reader 被关闭，退出后下一次 discover 时如果容器仍在运行会重新读取
+func (r *Reader) follow(c container, since int64, tail bool) {
+	defer func() {
+		r.mux.Lock()
+		delete(r.running, c.ID)
+		r.mux.Unlock()
+	}()
+	query := url.Values{}
+	query.Set("follow", "1")
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("timestamps", "1")
+	if tail {
+		query.Set("tail", "0")
+	} else if since > 0 {
+		query.Set("since", fmt.Sprintf("%d.%09d", since/int64(time.Second), since%int64(time.Second)))
+	}
+	req, err := http.NewRequest(http.MethodGet, r.baseURL+"/containers/"+c.ID+"/logs?"+query.Encode(), nil)
+	if err != nil {
+		r.setStatsError(err.Error())
+		return
+	}
+	resp, err := r.client.Do(req.WithContext(r.ctx))
+	if err != nil {
+		if atomic.LoadInt32(&r.status) == reader.StatusRunning {
+			log.Errorf("Runner[%v] %v read logs of container %v error: %v", r.meta.RunnerName, r.Name(), c.ID, err)
+			r.setStatsError(err.Error())
+		}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("read logs of container %v: %v %v", c.ID, resp.Status, strings.TrimSpace(string(body)))
+		log.Errorf("Runner[%v] %v %v", r.meta.RunnerName, r.Name(), err)
+		r.setStatsError(err.Error())
+		return
+	}
+	log.Infof("Runner[%v] %v start reading container %v(%v)", r.meta.RunnerName, r.Name(), c.name, c.ID)
+
+	lr := newLineReader(func(stream string, l []byte) bool {
+		return r.putLine(c, stream, l, since)
+	})
+	if c.tty {
+		err = lr.readRaw(resp.Body)
+	} else {
+		err = lr.readMultiplexed(resp.Body)
+	}
+	if err != nil && atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		log.Errorf("Runner[%v] %v read logs of container %v error: %v", r.meta.RunnerName, r.Name(), c.ID, err)
+		r.setStatsError(err.Error())
+		return
+	}
+	log.Infof("Runner[%v] %v stop reading container %v(%v)", r.meta.RunnerName, r.Name(), c.name, c.ID)
+}
+
+// putLine 解析带时间戳的一行日志并放入 readChan，时间戳不晚于 since 的日志已经读取过，直接跳过
+func (r *Reader) putLine(c container, stream string, l []byte, since int64) bool {
+	raw := strings.TrimRight(string(l), "\r\n")
+	data := Data{
+		KeyStream:        stream,
+		KeyContainerID:   c.ID,
+		KeyContainerName: c.name,
+		KeyImage:         c.Image,
+	}
+	if len(c.Labels) > 0 {
+		labels := make(map[string]interface{}, len(c.Labels))
+		for k, v := range c.Labels {
+			labels[k] = v
+		}
+		data[KeyLabels] = labels
+	}
+	var ts int64
+	if idx := strings.IndexByte(raw, ' '); idx > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, raw[:idx]); err == nil {
+			ts = t.UnixNano()
+			data[KeyTime] = raw[:idx]
+			raw = raw[idx+1:]
+		}
+	}
+	if ts > 0 && ts <= since {
+		return true
+	}
+	data[KeyLog] = raw
+	e := line{id: c.ID, data: data, ts: ts, size: int64(len(l))}
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		select {
+		case r.readChan <- e:
+			if ts > 0 {
+				r.mux.Lock()
+				if cm, ok := r.containers[c.ID]; ok {
+					cm.readOffset = ts
+				}
+				r.mux.Unlock()
+			}
+			return true
+		case <-time.After(time.Second):
+		}
+	}
+	return false
+}
+
+// lineReader 把 Docker API 返回的日志流按照 stdout、stderr 分别拆分成行
+type lineReader struct {
+	bufs map[string]*bytes.Buffer
+	emit func(stream string, l []byte) bool
+}
+
+func newLineReader(emit func(stream string, l []byte) bool) *lineReader {
+	return &lineReader{bufs: make(map[string]*bytes.Buffer), emit: emit}
+}
+
+// write 追加 stream 中的一段内容，每得到完整的一行调用一次 emit，emit 返回 false 时停止
+func (lr *lineReader) write(stream string, p []byte) bool {
+	b, ok := lr.bufs[stream]
+	if !ok {
+		b = &bytes.Buffer{}
+		lr.bufs[stream] = b
+	}
+	b.Write(p)
+	for {
+		idx := bytes.IndexByte(b.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		if !lr.emit(stream, b.Next(idx+1)) {
+			return false
+		}
+	}
+	if b.Len() >= maxLineSize {
+		ok := lr.emit(stream, b.Bytes())
+		b.Reset()
+		return ok
+	}
+	return true
+}
+
+// readRaw 读取使用 TTY 的容器的日志，stdout 和 stderr 没有区分
+func (lr *lineReader) readRaw(body io.Reader) error {
+	br := bufio.NewReader(body)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := br.Read(buf)
+		if n > 0 && !lr.write("stdout", buf[:n]) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readMultiplexed 读取没有使用 TTY 的容器的日志，每一段内容前有 8 字节的头: [stream, 0, 0, 0, size(大端 uint32)]
+func (lr *lineReader) readMultiplexed(body io.Reader) error {
+	br := bufio.NewReader(body)
+	header := make([]byte, 8)
+	var buf []byte
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var stream string
+		switch header[0] {
+		case 1:
+			stream = "stdout"
+		case 2:
+			stream = "stderr"
+		default:
+			stream = "stdin"
+		}
+		size := int(binary.BigEndian.Uint32(header[4:]))
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		if _, err := io.ReadFull(br, buf[:size]); err != nil {
+			return err
+		}
+		if !lr.write(stream, buf[:size]) {
+			return nil
+		}
+	}
+}
+
+func (r *Reader) ReadData() (Data, int64, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case l := <-r.readChan:
+		if l.ts > 0 {
+			r.mux.Lock()
+			if cm, ok := r.containers[l.id]; ok {
+				cm.offset = l.ts
+				cm.synced = false
+			}
+			r.mux.Unlock()
+		}
+		return l.data, l.size, nil
+	case <-timer.C:
+	}
+	return nil, 0, nil
+}
+
+// SyncMeta 把每个容器最近一次返回的日志的时间戳保存到各自的 submeta 中，runner 在数据发送成功后调用
+func (r *Reader) SyncMeta() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for id, cm := range r.containers {
+		if cm.synced {
+			continue
+		}
+		if err := cm.meta.WriteOffset(id, cm.offset); err != nil {
+			log.Errorf("Runner[%v] %v SyncMeta of container %v error %v", r.meta.RunnerName, r.Name(), id, err)
+			continue
+		}
+		cm.synced = true
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	r.cancel()
+	return nil
+}
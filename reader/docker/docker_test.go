@@ -0,0 +1,161 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func frame(stream byte, content string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+	return append(header, content...)
+}
+
+func TestReadMultiplexed(t *testing.T) {
+	var body bytes.Buffer
+	body.Write(frame(1, "2018-06-01T08:00:00.000000001Z hel"))
+	body.Write(frame(2, "2018-06-01T08:00:00.000000002Z oops\n"))
+	body.Write(frame(1, "lo\n2018-06-01T08:00:00.000000003Z world\n"))
+
+	var got []string
+	lr := newLineReader(func(stream string, l []byte) bool {
+		got = append(got, stream+"|"+string(l))
+		return true
+	})
+	assert.NoError(t, lr.readMultiplexed(&body))
+	assert.Equal(t, []string{
+		"stderr|2018-06-01T08:00:00.000000002Z oops\n",
+		"stdout|2018-06-01T08:00:00.000000001Z hello\n",
+		"stdout|2018-06-01T08:00:00.000000003Z world\n",
+	}, got)
+
+	got = nil
+	assert.NoError(t, lr.readRaw(strings.NewReader("a\r\nb\n")))
+	assert.Equal(t, []string{"stdout|a\r\n", "stdout|b\n"}, got)
+}
+
+func TestBuildFilters(t *testing.T) {
+	filters, err := buildFilters([]string{"app=nginx", " env "}, []string{"web"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"label":["app=nginx","env"],"name":["web"],"status":["running"]}`, filters)
+
+	_, _, err = newClient("npipe:////./pipe/docker_engine")
+	assert.Error(t, err)
+}
+
+type fakeDocker struct {
+	mux    sync.Mutex
+	since  []string
+	tails  []string
+	filter string
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/containers/json":
+		f.mux.Lock()
+		f.filter = req.URL.Query().Get("filters")
+		f.mux.Unlock()
+		w.Write([]byte(`[{"Id":"abc123","Names":["/web"],"Image":"nginx:1.15","Labels":{"app":"nginx"}}]`))
+	case "/containers/abc123/json":
+		w.Write([]byte(`{"Config":{"Tty":false}}`))
+	case "/containers/abc123/logs":
+		f.mux.Lock()
+		f.since = append(f.since, req.URL.Query().Get("since"))
+		f.tails = append(f.tails, req.URL.Query().Get("tail"))
+		f.mux.Unlock()
+		w.Write(frame(1, "2018-06-01T08:00:00.000000001Z GET /index.html\n"))
+		w.Write(frame(2, "2018-06-01T08:00:00.000000002Z connect() failed\n"))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func readN(t *testing.T, r reader.Reader, n, tries int) []Data {
+	dr := r.(*Reader)
+	var datas []Data
+	for i := 0; i < tries && len(datas) < n; i++ {
+		data, _, err := dr.ReadData()
+		assert.NoError(t, err)
+		if data != nil {
+			datas = append(datas, data)
+		}
+	}
+	return datas
+}
+
+func TestReadData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestDockerReadData")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fd := &fakeDocker{}
+	server := httptest.NewServer(fd)
+	defer server.Close()
+
+	c := conf.MapConf{
+		reader.KeyMetaPath:           filepath.Join(dir, "meta"),
+		reader.KeyMode:               reader.ModeDocker,
+		reader.KeyDockerHost:         "tcp://" + strings.TrimPrefix(server.URL, "http://"),
+		reader.KeyDockerLabelFilters: "app=nginx",
+		reader.KeyWhence:             reader.WhenceOldest,
+		reader.KeyStatInterval:       "1h",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+
+	datas := readN(t, r, 2, 10)
+	assert.Equal(t, []Data{
+		{
+			KeyLog:           "GET /index.html",
+			KeyStream:        "stdout",
+			KeyTime:          "2018-06-01T08:00:00.000000001Z",
+			KeyContainerID:   "abc123",
+			KeyContainerName: "web",
+			KeyImage:         "nginx:1.15",
+			KeyLabels:        map[string]interface{}{"app": "nginx"},
+		},
+		{
+			KeyLog:           "connect() failed",
+			KeyStream:        "stderr",
+			KeyTime:          "2018-06-01T08:00:00.000000002Z",
+			KeyContainerID:   "abc123",
+			KeyContainerName: "web",
+			KeyImage:         "nginx:1.15",
+			KeyLabels:        map[string]interface{}{"app": "nginx"},
+		},
+	}, datas)
+	r.SyncMeta()
+	assert.NoError(t, r.Close())
+
+	// 重启后从保存的时间戳之后继续读取，已经读取过的日志被跳过
+	meta, err = reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err = NewReader(meta, c)
+	assert.NoError(t, err)
+	assert.Empty(t, readN(t, r, 1, 3))
+	assert.NoError(t, r.Close())
+
+	fd.mux.Lock()
+	defer fd.mux.Unlock()
+	assert.Equal(t, `{"label":["app=nginx"],"status":["running"]}`, fd.filter)
+	assert.Equal(t, []string{"", "1527840000.000000002"}, fd.since)
+	assert.Equal(t, []string{"", ""}, fd.tails)
+}
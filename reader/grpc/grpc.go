@@ -0,0 +1,314 @@
+// Package grpc 提供 logkit.proto 中定义的 LogIngest 服务，应用通过 gRPC 流直接发送日志，
+// 日志写入磁盘缓存后才会确认，logkit 重启后继续读取缓存中的数据。
+// gRPC 基于 HTTP/2，服务通过 net/http 的 HTTP/2 支持实现，因此必须配置 TLS 证书。
+package grpc
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/queue"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultSyncEvery       = 10
+	DefaultMaxBytesPerFile = 500 * 1024 * 1024
+	DefaultWriteSpeedLimit = 10 * 1024 * 1024 // 默认写速限制为10MB
+
+	// sendMethod 是 LogIngest.Send 的请求路径
+	sendMethod = "/logkit.LogIngest/Send"
+)
+
+// gRPC 的状态码
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+type statusError struct {
+	code    int
+	message string
+}
+
+func newStatus(code int, message string) *statusError {
+	return &statusError{code: code, message: message}
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("grpc status %v: %v", e.code, e.message)
+}
+
+func init() {
+	reader.RegisterConstructor(reader.ModeGRPC, NewReader)
+}
+
+type Reader struct {
+	address   string
+	authToken string
+	maxSize   int
+	tlsConfig *tls.Config
+
+	meta   *reader.Meta
+	status int32
+
+	listener net.Listener
+	server   *http.Server
+	bufQueue queue.BackendQueue
+	readChan <-chan []byte
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	address, _ := c.GetStringOr(reader.KeyGRPCAddress, reader.DefaultGRPCAddress)
+	authToken, _ := c.GetStringOr(reader.KeyGRPCAuthToken, "")
+	maxSize, _ := c.GetIntOr(reader.KeyGRPCMaxMessageSize, reader.DefaultGRPCMaxMessageSize)
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeyGRPCMaxMessageSize)
+	}
+	certPath, err := c.GetString(reader.KeyGRPCTLSCertPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := c.GetString(reader.KeyGRPCTLSKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	caPath, _ := c.GetStringOr(reader.KeyGRPCTLSCAPath, "")
+	tlsConfig, err := newTLSConfig(certPath, keyPath, caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = CreateDirIfNotExist(meta.BufFile()); err != nil {
+		return nil, err
+	}
+	bq := queue.NewDiskQueue(Hash("GRPCReader<"+address+">_buffer"), meta.BufFile(), DefaultMaxBytesPerFile, 0,
+		DefaultMaxBytesPerFile, DefaultSyncEvery, DefaultSyncEvery, time.Second*2, DefaultWriteSpeedLimit, false, 0)
+	return &Reader{
+		address:   address,
+		authToken: authToken,
+		maxSize:   maxSize,
+		tlsConfig: tlsConfig,
+		meta:      meta,
+		status:    reader.StatusInit,
+		bufQueue:  bq,
+		readChan:  bq.ReadChan(),
+	}, nil
+}
+
+// newTLSConfig 加载服务端证书，配置了 CA 证书时要求客户端提供由该 CA 签发的证书
+func newTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate error %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca error %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in %v", caPath)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (r *Reader) Name() string {
+	return "GRPCReader<" + r.address + ">"
+}
+
+func (r *Reader) Source() string {
+	return r.address
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("GRPCReader not support read mode")
+}
+
+func (r *Reader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return fmt.Errorf("runner[%v] %v already started", r.meta.RunnerName, r.Name())
+	}
+	var err error
+	if r.listener, err = net.Listen("tcp", r.address); err != nil {
+		atomic.StoreInt32(&r.status, reader.StatusInit)
+		return err
+	}
+	// ServeTLS 会在 TLSConfig 中加上 h2，客户端通过 ALPN 协商使用 HTTP/2
+	r.server = &http.Server{
+		Handler:   r,
+		TLSConfig: r.tlsConfig,
+	}
+	go func() {
+		if err := r.server.ServeTLS(r.listener, "", ""); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Runner[%v] %v serve error: %v", r.meta.RunnerName, r.Name(), err)
+		}
+	}()
+	log.Infof("Runner[%v] %v has started and listener service on %v", r.meta.RunnerName, r.Name(), r.address)
+	return nil
+}
+
+func (r *Reader) ReadLine() (data string, err error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		if err = r.Start(); err != nil {
+			log.Error(err)
+			return "", err
+		}
+	}
+	timer := time.NewTimer(time.Second)
+	select {
+	case dat := <-r.readChan:
+		data = string(dat)
+	case <-timer.C:
+	}
+	timer.Stop()
+	return
+}
+
+// Close 先停止 gRPC 服务，再关闭缓存队列，已经确认的数据都在磁盘中，重启后继续读取
+func (r *Reader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.status, reader.StatusRunning, reader.StatusStopping) {
+		log.Infof("Runner[%v] %v stopping", r.meta.RunnerName, r.Name())
+	}
+	if r.server != nil {
+		r.server.Close()
+	} else if r.listener != nil {
+		r.listener.Close()
+	}
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	return r.bufQueue.Close()
+}
+
+func (r *Reader) SyncMeta() {}
+
+// ServeHTTP 处理 LogIngest.Send 调用，状态码和错误信息通过 HTTP/2 的 trailer 返回
+func (r *Reader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || req.Method != http.MethodPost || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "only gRPC requests are supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if req.URL.Path != sendMethod {
+		finish(w, newStatus(codeUnimplemented, "unknown method "+req.URL.Path))
+		return
+	}
+	if !r.authorized(req) {
+		finish(w, newStatus(codeUnauthenticated, "invalid auth token"))
+		return
+	}
+	var compressed bool
+	switch req.Header.Get("Grpc-Encoding") {
+	case "", "identity":
+	case "gzip":
+		compressed = true
+	default:
+		w.Header().Set("Grpc-Accept-Encoding", "gzip")
+		finish(w, newStatus(codeUnimplemented, "unsupported grpc-encoding "+req.Header.Get("Grpc-Encoding")))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	finish(w, r.receive(w, req.Body, compressed))
+}
+
+// authorized 检查 metadata 中的 authorization: Bearer <token>，没有配置 grpc_auth_token 时不需要认证
+func (r *Reader) authorized(req *http.Request) bool {
+	if r.authToken == "" {
+		return true
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(r.authToken)) == 1
+}
+
+// receive 读取客户端发送的每个 LogRequest，其中的日志全部写入缓存后回复累计的条数
+func (r *Reader) receive(w http.ResponseWriter, body io.Reader, compressed bool) error {
+	br := bufio.NewReader(body)
+	flusher, _ := w.(http.Flusher)
+	var received uint64
+	for {
+		msg, err := readMessage(br, compressed, r.maxSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		lines, err := unmarshalLogRequest(msg)
+		if err != nil {
+			return newStatus(codeInvalidArgument, "invalid LogRequest: "+err.Error())
+		}
+		for _, line := range lines {
+			if err = r.bufQueue.Put([]byte(line)); err != nil {
+				log.Errorf("Runner[%v] %v put data into buffer error: %v", r.meta.RunnerName, r.Name(), err)
+				return newStatus(codeUnavailable, "buffer data error: "+err.Error())
+			}
+			received++
+		}
+		if err = writeMessage(w, marshalLogResponse(received)); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// finish 设置 grpc-status 和 grpc-message，err 为空时表示调用成功
+func finish(w http.ResponseWriter, err error) {
+	if err == nil {
+		w.Header().Set("Grpc-Status", strconv.Itoa(codeOK))
+		return
+	}
+	status, ok := err.(*statusError)
+	if !ok {
+		status = newStatus(codeInternal, err.Error())
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(status.message))
+}
+
+// encodeGRPCMessage 按照 gRPC 协议对错误信息做百分号编码
+func encodeGRPCMessage(msg string) string {
+	var buf []byte
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			buf = append(buf, c)
+			continue
+		}
+		buf = append(buf, fmt.Sprintf("%%%02X", c)...)
+	}
+	return string(buf)
+}
@@ -0,0 +1,201 @@
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func writeTestCert(t *testing.T, certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func newTestReader(t *testing.T, c conf.MapConf) *Reader {
+	certPath, keyPath := filepath.Join(MetaDir, "cert.pem"), filepath.Join(MetaDir, "key.pem")
+	assert.NoError(t, os.MkdirAll(MetaDir, 0755))
+	writeTestCert(t, certPath, keyPath)
+	c[reader.KeyGRPCTLSCertPath] = certPath
+	c[reader.KeyGRPCTLSKeyPath] = keyPath
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: MetaDir,
+		reader.KeyFileDone: MetaDir,
+		reader.KeyMode:     reader.ModeGRPC,
+		KeyRunnerName:      t.Name(),
+	})
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return r.(*Reader)
+}
+
+func logRequest(lines ...string) []byte {
+	var buf []byte
+	for _, line := range lines {
+		buf = append(buf, 1<<3|wireBytes, byte(len(line)))
+		buf = append(buf, line...)
+	}
+	return buf
+}
+
+func frame(data []byte, compress bool) []byte {
+	var buf bytes.Buffer
+	if !compress {
+		writeMessage(&buf, data)
+		return buf.Bytes()
+	}
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	zw.Write(data)
+	zw.Close()
+	writeMessage(&buf, zbuf.Bytes())
+	b := buf.Bytes()
+	b[0] = 1
+	return b
+}
+
+func call(r *Reader, path string, header http.Header, body []byte) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", "application/grpc")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestUnmarshalLogRequest(t *testing.T) {
+	// 未知的 varint、fixed32 和 bytes 字段被忽略
+	data := append([]byte{2<<3 | wireVarint, 0x96, 0x01, 3<<3 | wireFixed32, 1, 2, 3, 4, 4<<3 | wireBytes, 1, 'x'}, logRequest("a", "")...)
+	lines, err := unmarshalLogRequest(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", ""}, lines)
+
+	_, err = unmarshalLogRequest([]byte{1<<3 | wireBytes, 5, 'a'})
+	assert.Error(t, err)
+	_, err = unmarshalLogRequest([]byte{1<<3 | 3})
+	assert.Error(t, err)
+
+	assert.Nil(t, marshalLogResponse(0))
+	assert.Equal(t, []byte{0x08, 0xac, 0x02}, marshalLogResponse(300))
+}
+
+func TestGRPCReader(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	r := newTestReader(t, conf.MapConf{
+		reader.KeyGRPCAddress:        "127.0.0.1:0",
+		reader.KeyGRPCAuthToken:      "secret",
+		reader.KeyGRPCMaxMessageSize: "64",
+	})
+	defer r.Close()
+	auth := http.Header{"Authorization": {"Bearer secret"}, "Grpc-Encoding": {"gzip"}}
+
+	body := append(frame(logRequest("line1", "line2"), false), frame(logRequest("line3"), true)...)
+	resp := call(r, sendMethod, auth, body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+	br := bufio.NewReader(resp.Body)
+	msg, err := readMessage(br, false, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, marshalLogResponse(2), msg)
+	msg, err = readMessage(br, false, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, marshalLogResponse(3), msg)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+	for _, exp := range []string{"line1", "line2", "line3"} {
+		got, err := r.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+	}
+
+	resp = call(r, sendMethod, nil, frame(logRequest("x"), false))
+	assert.Equal(t, "16", resp.Header.Get("Grpc-Status"))
+	resp = call(r, "/logkit.LogIngest/Other", auth, nil)
+	assert.Equal(t, "12", resp.Header.Get("Grpc-Status"))
+	resp = call(r, sendMethod, http.Header{"Authorization": {"Bearer secret"}, "Grpc-Encoding": {"snappy"}}, nil)
+	assert.Equal(t, "12", resp.Header.Get("Grpc-Status"))
+	assert.Equal(t, "gzip", resp.Header.Get("Grpc-Accept-Encoding"))
+
+	resp = call(r, sendMethod, auth, frame(make([]byte, 65), false))
+	assert.Equal(t, "8", resp.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "message size 65 exceeds the limit 64", resp.Trailer.Get("Grpc-Message"))
+	resp = call(r, sendMethod, auth, frame([]byte{1<<3 | wireBytes, 9}, false)[:6])
+	assert.Equal(t, "3", resp.Trailer.Get("Grpc-Status"))
+
+	// 不是 HTTP/2 的请求直接拒绝
+	req := httptest.NewRequest(http.MethodPost, sendMethod, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// ReadLine 时已经启动了服务，通过 ALPN 协商 HTTP/2
+	conn, err := tls.Dial("tcp", r.listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol)
+		conn.Close()
+	}
+}
+
+func TestGRPCReaderRestart(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	c := conf.MapConf{reader.KeyGRPCAddress: "127.0.0.1:0"}
+	r := newTestReader(t, c)
+	resp := call(r, sendMethod, nil, frame(logRequest("a", "b"), false))
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	assert.NoError(t, r.Close())
+
+	// 已经确认的数据在重启后仍然可以读取
+	r = newTestReader(t, c)
+	defer r.Close()
+	for _, exp := range []string{"a", "b"} {
+		got, err := r.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, exp, got)
+	}
+
+	_, err := NewReader(r.meta, conf.MapConf{})
+	assert.Error(t, err)
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	assert.Equal(t, "bad 100%25 %E4%B8%AD%0A", encodeGRPCMessage("bad 100% 中\n"))
+}
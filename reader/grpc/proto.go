@@ -0,0 +1,139 @@
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// protobuf 的 wire type
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+func readVarint(data []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		v |= uint64(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errMalformed
+}
+
+// unmarshalLogRequest 解析 logkit.proto 中的 LogRequest，忽略不认识的字段
+func unmarshalLogRequest(data []byte) ([]string, error) {
+	var lines []string
+	for len(data) > 0 {
+		key, n, err := readVarint(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case wireVarint:
+			if _, n, err = readVarint(data); err != nil {
+				return nil, err
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			length, m, err := readVarint(data)
+			if err != nil {
+				return nil, err
+			}
+			if length > uint64(len(data)-m) {
+				return nil, errMalformed
+			}
+			if field == 1 {
+				lines = append(lines, string(data[m:m+int(length)]))
+			}
+			n = m + int(length)
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %v", wire)
+		}
+		if n > len(data) {
+			return nil, errMalformed
+		}
+		data = data[n:]
+	}
+	return lines, nil
+}
+
+// marshalLogResponse 生成 LogResponse，received 为 0 时按照 proto3 的规则不输出字段
+func marshalLogResponse(received uint64) []byte {
+	if received == 0 {
+		return nil
+	}
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64)
+	buf[0] = 1<<3 | wireVarint
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], received)
+	return append(buf, tmp[:n]...)
+}
+
+// readMessage 读取一个 gRPC 消息，消息前有 1 个字节的压缩标志和 4 个字节的长度
+func readMessage(r *bufio.Reader, compressed bool, maxSize int) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, newStatus(codeInvalidArgument, "message header is truncated")
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > uint32(maxSize) {
+		return nil, newStatus(codeResourceExhausted, fmt.Sprintf("message size %v exceeds the limit %v", length, maxSize))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, newStatus(codeInvalidArgument, "message is truncated")
+		}
+		return nil, err
+	}
+	switch header[0] {
+	case 0:
+		return data, nil
+	case 1:
+		if !compressed {
+			return nil, newStatus(codeInvalidArgument, "compressed message without grpc-encoding")
+		}
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, newStatus(codeInvalidArgument, "invalid gzip message: "+err.Error())
+		}
+		// 解压后的数据同样限制大小
+		data, err = ioutil.ReadAll(io.LimitReader(gr, int64(maxSize)+1))
+		if err != nil {
+			return nil, newStatus(codeInvalidArgument, "invalid gzip message: "+err.Error())
+		}
+		if len(data) > maxSize {
+			return nil, newStatus(codeResourceExhausted, fmt.Sprintf("decompressed message exceeds the limit %v", maxSize))
+		}
+		return data, nil
+	}
+	return nil, newStatus(codeInvalidArgument, fmt.Sprintf("invalid compressed flag %v", header[0]))
+}
+
+func writeMessage(w io.Writer, data []byte) error {
+	buf := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(data)))
+	copy(buf[5:], data)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,48 @@
+package reader
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// GzipSuffix 结尾的文件被当作 gzip 压缩的文件，读取时解压，通常是 logrotate 轮转后压缩的文件
+const GzipSuffix = ".gz"
+
+// IsGzipFile 根据后缀判断文件是否是 gzip 压缩的文件
+func IsGzipFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), GzipSuffix)
+}
+
+// countReader 记录读取的字节数，用于计算 gzip 文件读取的进度
+type countReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (n int, err error) {
+	n, err = c.Reader.Read(p)
+	c.n += int64(n)
+	return
+}
+
+// gzipReadCloser 解压 gzip 文件，限速作用在压缩后的数据上
+type gzipReadCloser struct {
+	*gzip.Reader
+	src  *countReader
+	rate io.Closer
+}
+
+func newGzipReadCloser(rate io.ReadCloser) (*gzipReadCloser, error) {
+	src := &countReader{Reader: rate}
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: zr, src: src, rate: rate}, nil
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.rate.Close()
+}
@@ -2,12 +2,18 @@ package http
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -26,6 +32,7 @@ const (
 	DefaultMaxBodySize     = 100 * 1024 * 1024
 	DefaultMaxBytesPerFile = 500 * 1024 * 1024
 	DefaultWriteSpeedLimit = 10 * 1024 * 1024 // 默认写速限制为10MB
+	DefaultShutdownTimeout = 10 * time.Second // 关闭时等待正在处理的请求结束的最长时间
 )
 
 func init() {
@@ -33,13 +40,15 @@ func init() {
 }
 
 type Reader struct {
-	address string
-	path    string
+	address   string
+	path      string
+	authToken string
 
 	meta   *reader.Meta
 	status int32
 
 	listener net.Listener
+	server   *http.Server
 	bufQueue queue.BackendQueue
 	readChan <-chan []byte
 }
@@ -47,6 +56,7 @@ type Reader struct {
 func NewReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
 	address, _ := conf.GetStringOr(reader.KeyHTTPServiceAddress, reader.DefaultHTTPServiceAddress)
 	path, _ := conf.GetStringOr(reader.KeyHTTPServicePath, reader.DefaultHTTPServicePath)
+	authToken, _ := conf.GetStringOr(reader.KeyHTTPAuthToken, "")
 	address, _ = RemoveHttpProtocal(address)
 
 	bq := queue.NewDiskQueue(Hash("Reader<"+address+">_buffer"), meta.BufFile(), DefaultMaxBytesPerFile, 0,
@@ -57,12 +67,13 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
 	}
 	readChan := bq.ReadChan()
 	return &Reader{
-		address:  address,
-		path:     path,
-		meta:     meta,
-		bufQueue: bq,
-		readChan: readChan,
-		status:   reader.StatusInit,
+		address:   address,
+		path:      path,
+		authToken: authToken,
+		meta:      meta,
+		bufQueue:  bq,
+		readChan:  readChan,
+		status:    reader.StatusInit,
 	}, nil
 }
 
@@ -86,12 +97,12 @@ func (h *Reader) Start() error {
 		return err
 	}
 
-	server := &http.Server{
+	h.server = &http.Server{
 		Handler: r,
 		Addr:    h.address,
 	}
 	go func() {
-		server.Serve(h.listener)
+		h.server.Serve(h.listener)
 	}()
 	log.Infof("runner[%v] Reader[%v] has started and listener service on %v\n", h.meta.RunnerName, h.Name(), h.address)
 	return nil
@@ -119,22 +130,32 @@ func (h *Reader) SetMode(mode string, v interface{}) error {
 	return fmt.Errorf("runner[%v] Reader[%v] not support read mode\n", h.meta.RunnerName, h.Name())
 }
 
+// Close 先停止 http 服务并等待正在处理的请求结束，再关闭缓存队列，保证已经接收到的数据都写入磁盘，重启后继续读取
 func (h *Reader) Close() error {
 	if atomic.CompareAndSwapInt32(&h.status, reader.StatusRunning, reader.StatusStopping) {
 		log.Infof("Runner[%v] Reader[%v] stopping", h.meta.RunnerName, h.Name())
-	} else {
-		h.bufQueue.Close()
 	}
-	if h.listener != nil {
+	if h.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		if err := h.server.Shutdown(ctx); err != nil {
+			log.Warnf("Runner[%v] Reader[%v] shutdown http server error %v, close it", h.meta.RunnerName, h.Name(), err)
+			h.server.Close()
+		}
+		cancel()
+	} else if h.listener != nil {
 		h.listener.Close()
 	}
-	return nil
+	atomic.StoreInt32(&h.status, reader.StatusStopped)
+	return h.bufQueue.Close()
 }
 
 func (h *Reader) SyncMeta() {}
 
 func (h *Reader) postData() echo.HandlerFunc {
 	return func(c echo.Context) error {
+		if !h.authorized(c.Request()) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid auth token"})
+		}
 		if err := h.pickUpData(c.Request()); err != nil {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 		}
@@ -142,6 +163,18 @@ func (h *Reader) postData() echo.HandlerFunc {
 	}
 }
 
+// authorized 检查请求头中的 Authorization: Bearer <token>，没有配置 http_auth_token 时不需要认证
+func (h *Reader) authorized(req *http.Request) bool {
+	if h.authToken == "" {
+		return true
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.authToken)) == 1
+}
+
 func (h *Reader) pickUpData(req *http.Request) (err error) {
 	if req.ContentLength > DefaultMaxBodySize {
 		return errors.New("the request body is too large")
@@ -156,25 +189,86 @@ func (h *Reader) pickUpData(req *http.Request) (err error) {
 			return fmt.Errorf("read gzip body error %v", err)
 		}
 	}
-	r := bufio.NewReader(reqBody)
-	return h.storageData(r)
+	// 解压后的数据同样限制大小，超出后读取时会返回错误
+	r := bufio.NewReader(http.MaxBytesReader(nil, reqBody, DefaultMaxBodySize))
+	// Content-Type 为 application/json 并且是 JSON 数组时，数组中的每个元素作为一条数据
+	var lines [][]byte
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == ApplicationJson && isJSONArray(r) {
+		lines, err = splitJSONArray(r)
+	} else {
+		lines, err = h.splitLines(r)
+	}
+	if err != nil {
+		return err
+	}
+	// 整个请求都读取成功后才放入缓存队列，返回错误时不会有部分数据已经入队
+	for _, line := range lines {
+		if err = h.bufQueue.Put(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isJSONArray(r *bufio.Reader) bool {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0] == '['
+		}
+	}
 }
 
-func (h *Reader) storageData(r *bufio.Reader) (err error) {
+// splitLines 按行读取请求中的数据，忽略空行
+func (h *Reader) splitLines(r *bufio.Reader) ([][]byte, error) {
+	var lines [][]byte
 	for {
 		line, err := h.readLine(r)
 		if err != nil {
-			if err != io.EOF {
-				log.Errorf("runner[%v] Reader[%v] read data from http request error, %v\n", h.meta.RunnerName, h.Name(), err)
+			if err == io.EOF {
+				return lines, nil
 			}
-			break
+			log.Errorf("runner[%v] Reader[%v] read data from http request error, %v\n", h.meta.RunnerName, h.Name(), err)
+			return nil, err
 		}
 		if line == "" {
 			continue
 		}
-		h.bufQueue.Put([]byte(line))
+		lines = append(lines, []byte(line))
 	}
-	return
+}
+
+// splitJSONArray 把 JSON 数组中的每个元素作为一行，字符串元素直接作为一行，其他元素保持 JSON 格式
+func splitJSONArray(r *bufio.Reader) ([][]byte, error) {
+	var elems []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elems); err != nil {
+		return nil, fmt.Errorf("decode json array error %v", err)
+	}
+	lines := make([][]byte, 0, len(elems))
+	for _, elem := range elems {
+		var line []byte
+		var str string
+		if json.Unmarshal(elem, &str) == nil {
+			line = []byte(str)
+		} else {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, elem); err != nil {
+				return nil, err
+			}
+			line = buf.Bytes()
+		}
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
 }
 
 func (h *Reader) readLine(r *bufio.Reader) (str string, err error) {
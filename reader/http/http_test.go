@@ -78,3 +78,79 @@ func TestNewHttpReader(t *testing.T) {
 		assert.Equal(t, val, got)
 	}
 }
+
+func newTestReader(t *testing.T, c conf.MapConf) *Reader {
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: MetaDir,
+		reader.KeyFileDone: MetaDir,
+		reader.KeyMode:     reader.ModeHTTP,
+		KeyRunnerName:      "TestHttpReader",
+	})
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	return r.(*Reader)
+}
+
+func post(t *testing.T, url, contentType, token, body string) int {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(body)))
+	assert.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set(ContentTypeHeader, contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHttpReaderBatch(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	c := conf.MapConf{
+		reader.KeyHTTPServiceAddress: "127.0.0.1:7111",
+		reader.KeyHTTPAuthToken:      "secret",
+	}
+	httpReader := newTestReader(t, c)
+	assert.NoError(t, httpReader.Start())
+	url := "http://127.0.0.1:7111" + reader.DefaultHTTPServicePath
+
+	assert.Equal(t, http.StatusUnauthorized, post(t, url, "", "", "a"))
+	assert.Equal(t, http.StatusUnauthorized, post(t, url, "", "wrong", "a"))
+	assert.Equal(t, http.StatusOK, post(t, url, "", "secret", "a\n\nb\n"))
+	assert.Equal(t, http.StatusOK, post(t, url, ApplicationJson+"; charset=utf-8", "secret", ` ["c", {"d": 1}, 2]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, url, ApplicationJson, "secret", `["e",`))
+	// 请求读到一半出错时已经读到的行也不会放入队列
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("x\ny\n"))
+	zw.Close()
+	assert.Equal(t, http.StatusBadRequest, post(t, url, "application/gzip", "secret", gz.String()[:gz.Len()-4]))
+	// 非 JSON 数组时按行读取
+	assert.Equal(t, http.StatusOK, post(t, url, ApplicationJson, "secret", `{"f": 1}`))
+	// 不是 application/json 时，以 [ 开头的数据也按行读取
+	assert.Equal(t, http.StatusOK, post(t, url, "", "secret", "[INFO] g"))
+
+	exp := []string{"a", "b", "c", `{"d":1}`, "2", `{"f": 1}`, "[INFO] g"}
+	for _, e := range exp[:3] {
+		got, err := httpReader.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, e, got)
+	}
+
+	// 关闭后未读取的数据保存在磁盘中，重启后继续读取
+	assert.NoError(t, httpReader.Close())
+	assert.Error(t, func() error {
+		_, err := http.Post(url, "", bytes.NewReader([]byte("h")))
+		return err
+	}())
+	httpReader = newTestReader(t, c)
+	defer httpReader.Close()
+	for _, e := range exp[3:] {
+		got, err := httpReader.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, e, got)
+	}
+}
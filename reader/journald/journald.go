@@ -0,0 +1,297 @@
+// Package journald 通过 journalctl -o json --follow 读取 systemd journal，读取的位置(cursor)保存在 meta 中，
+// 重启后从上次发送成功的位置之后继续读取
+package journald
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// KeyCursor 是 journal 中每条日志的位置，用于断点续读
+const KeyCursor = "__CURSOR"
+
+const (
+	// restartInterval 是 journalctl 异常退出后重新启动的间隔
+	restartInterval = 3 * time.Second
+	// maxEntrySize 是 journalctl 输出的一条日志的最大长度
+	maxEntrySize = 8 * 1024 * 1024
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeJournald, NewReader)
+}
+
+type entry struct {
+	data   Data
+	cursor string
+	size   int64
+}
+
+type Reader struct {
+	meta       *reader.Meta
+	journalctl string
+	args       []string // 除了 cursor 之外的 journalctl 参数
+	whence     string
+
+	status int32
+	mux    sync.Mutex
+	cmd    *exec.Cmd
+
+	readChan chan entry
+
+	// readCursor 是最近一次放入 readChan 的日志的 cursor，journalctl 重启后从这里继续
+	readCursor string
+	// cursor 是最近一次 ReadData 返回的日志的 cursor，SyncMeta 时保存
+	cursor string
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	journalctl, _ := c.GetStringOr(reader.KeyJournaldJournalctl, reader.DefaultJournalctl)
+	units, _ := c.GetStringListOr(reader.KeyJournaldUnits, []string{})
+	priority, _ := c.GetStringOr(reader.KeyJournaldPriority, "")
+	directory, _ := c.GetStringOr(reader.KeyJournaldDirectory, "")
+	whence, _ := c.GetStringOr(reader.KeyWhence, reader.WhenceNewest)
+	if whence != reader.WhenceOldest && whence != reader.WhenceNewest {
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyWhence, whence, reader.WhenceOldest, reader.WhenceNewest)
+	}
+
+	args := []string{"--output=json", "--follow", "--no-pager", "--quiet"}
+	for _, unit := range units {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			args = append(args, "--unit="+unit)
+		}
+	}
+	if priority != "" {
+		args = append(args, "--priority="+priority)
+	}
+	if directory != "" {
+		args = append(args, "--directory="+directory)
+	}
+
+	r := &Reader{
+		meta:       meta,
+		journalctl: journalctl,
+		args:       args,
+		whence:     whence,
+		status:     reader.StatusInit,
+		readChan:   make(chan entry, 100),
+	}
+	cursor, _, err := meta.ReadOffset()
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Runner[%v] %v -meta data is corrupted err: %v, omit meta data...", meta.RunnerName, meta.MetaFile(), err)
+	}
+	r.readCursor, r.cursor = cursor, cursor
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "JournaldReader<" + r.journalctl + ">"
+}
+
+func (r *Reader) Source() string {
+	return "journald"
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("JournaldReader not support readmode")
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+func (r *Reader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+// commandArgs 返回启动 journalctl 的参数，有 cursor 时从 cursor 之后继续读取
+func (r *Reader) commandArgs(cursor string) []string {
+	args := append([]string{}, r.args...)
+	switch {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case r.whence == reader.WhenceNewest:
+		args = append(args, "--lines=0")
+	}
+	return args
+}
+
+func (r *Reader) run() {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		if err := r.follow(); err != nil {
+			log.Errorf("Runner[%v] %v journalctl exited: %v, restart after %v", r.meta.RunnerName, r.Name(), err, restartInterval)
+			r.setStatsError(err.Error())
+		}
+		if atomic.LoadInt32(&r.status) != reader.StatusRunning {
+			return
+		}
+		time.Sleep(restartInterval)
+	}
+}
+
+// follow 启动 journalctl 并把读到的日志放入 readChan，直到 journalctl 退出或者 reader 被关闭
+func (r *Reader) follow() error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(r.journalctl, r.commandArgs(r.readCursor)...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	r.cmd = cmd
+	r.mux.Unlock()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		data, err := parseEntry(line)
+		if err != nil {
+			log.Warnf("Runner[%v] %v parse journal entry error %v, ignore it...", r.meta.RunnerName, r.Name(), err)
+			continue
+		}
+		cursor, _ := data[KeyCursor].(string)
+		if !r.put(entry{data: data, cursor: cursor, size: int64(len(line))}) {
+			break
+		}
+		if cursor != "" {
+			r.readCursor = cursor
+		}
+	}
+	scanErr := scanner.Err()
+	if atomic.LoadInt32(&r.status) != reader.StatusRunning {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil
+	}
+	if scanErr != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return scanErr
+	}
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return errors.New("journalctl exited unexpectedly")
+}
+
+// put 在 reader 运行时一直等待 readChan 有空位，reader 关闭后返回 false
+func (r *Reader) put(e entry) bool {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		select {
+		case r.readChan <- e:
+			return true
+		case <-time.After(time.Second):
+		}
+	}
+	return false
+}
+
+// parseEntry 解析 journalctl -o json 输出的一条日志。不可打印的字段值被输出为字节数组，转为字符串；
+// 同一个字段出现多次时为字符串数组，保持不变
+func parseEntry(line []byte) (Data, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	data := make(Data, len(fields))
+	for k, v := range fields {
+		if arr, ok := v.([]interface{}); ok {
+			if b, ok := toBytes(arr); ok {
+				v = string(b)
+			}
+		}
+		data[k] = v
+	}
+	return data, nil
+}
+
+func toBytes(arr []interface{}) ([]byte, bool) {
+	b := make([]byte, 0, len(arr))
+	for _, v := range arr {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f > 255 {
+			return nil, false
+		}
+		b = append(b, byte(f))
+	}
+	return b, true
+}
+
+func (r *Reader) ReadData() (Data, int64, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case e := <-r.readChan:
+		if e.cursor != "" {
+			r.cursor = e.cursor
+		}
+		return e.data, e.size, nil
+	case <-timer.C:
+	}
+	return nil, 0, nil
+}
+
+// SyncMeta 保存最近一次返回的日志的 cursor，runner 在数据发送成功后调用
+func (r *Reader) SyncMeta() {
+	if r.cursor == "" {
+		return
+	}
+	if err := r.meta.WriteOffset(r.cursor, 0); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.cmd != nil && r.cmd.Process != nil {
+		r.cmd.Process.Kill()
+	}
+	return nil
+}
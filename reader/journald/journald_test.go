@@ -0,0 +1,85 @@
+package journald
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestParseEntry(t *testing.T) {
+	data, err := parseEntry([]byte(`{"__CURSOR":"s=1;i=2","MESSAGE":[104,105],"PRIORITY":"6","TAG":["a","b"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Data{
+		"__CURSOR": "s=1;i=2",
+		"MESSAGE":  "hi",
+		"PRIORITY": "6",
+		"TAG":      []interface{}{"a", "b"},
+	}, data)
+
+	_, err = parseEntry([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestReadData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestJournaldReadData")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// 用脚本模拟 journalctl，记录启动参数后输出两条日志
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "journalctl")
+	content := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+echo '{"__CURSOR":"c1","MESSAGE":"first","_SYSTEMD_UNIT":"nginx.service"}'
+echo '{"__CURSOR":"c2","MESSAGE":"second","_SYSTEMD_UNIT":"nginx.service"}'
+sleep 10
+`
+	assert.NoError(t, ioutil.WriteFile(script, []byte(content), 0755))
+
+	c := conf.MapConf{
+		reader.KeyMetaPath:           filepath.Join(dir, "meta"),
+		reader.KeyMode:               reader.ModeJournald,
+		reader.KeyJournaldJournalctl: script,
+		reader.KeyJournaldUnits:      "nginx.service, sshd.service",
+		reader.KeyJournaldPriority:   "warning",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	jr := r.(*Reader)
+
+	var msgs []interface{}
+	for i := 0; i < 5 && len(msgs) < 2; i++ {
+		data, _, err := jr.ReadData()
+		assert.NoError(t, err)
+		if data != nil {
+			msgs = append(msgs, data["MESSAGE"])
+		}
+	}
+	assert.Equal(t, []interface{}{"first", "second"}, msgs)
+	args, err := ioutil.ReadFile(argsFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "--output=json --follow --no-pager --quiet --unit=nginx.service --unit=sshd.service --priority=warning --lines=0\n", string(args))
+	jr.SyncMeta()
+	assert.NoError(t, jr.Close())
+
+	// 重启后从保存的 cursor 之后继续读取
+	r, err = NewReader(meta, c)
+	assert.NoError(t, err)
+	jr = r.(*Reader)
+	assert.Equal(t, "c2", jr.cursor)
+	assert.Equal(t, "--after-cursor=c2", jr.commandArgs(jr.readCursor)[7])
+	assert.NoError(t, jr.Close())
+
+	c[reader.KeyWhence] = "from_time"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+}
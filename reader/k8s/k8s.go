@@ -0,0 +1,214 @@
+// Package k8s 读取 kubelet 写在 /var/log/containers 下的容器日志，去掉 docker json-file 或者 CRI 格式的包装，
+// 并根据文件名加上 pod、namespace 和容器的信息
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/reader/tailx"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// 读取到的数据中的字段
+const (
+	KeyLog           = "log"
+	KeyStream        = "stream"
+	KeyTime          = "time"
+	KeyPodName       = "k8s_pod_name"
+	KeyNamespace     = "k8s_namespace"
+	KeyContainerName = "k8s_container_name"
+	KeyContainerID   = "k8s_container_id"
+)
+
+// maxPartialSize 是拼接被拆分的长日志时最多缓存的字节数，超过后直接输出已经拼接的部分
+const maxPartialSize = 16 * 1024 * 1024
+
+func init() {
+	reader.RegisterConstructor(reader.ModeK8s, NewReader)
+}
+
+// Reader 使用 tailx 追踪所有容器的日志文件，读取到的每一行都是一条结构化的数据，不再经过 parser
+type Reader struct {
+	*tailx.Reader
+	format string
+
+	// partial 记录每个文件中还没有结束的日志，docker 和 CRI 会把超过 16KB 的日志拆分成多行
+	partial map[string]*bytes.Buffer
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	format, _ := c.GetStringOr(reader.KeyK8sLogFormat, reader.K8sLogFormatAuto)
+	switch format {
+	case reader.K8sLogFormatAuto, reader.K8sLogFormatDocker, reader.K8sLogFormatCRI:
+	default:
+		return nil, fmt.Errorf("%v %v not supported, should be one of %v, %v, %v", reader.KeyK8sLogFormat, format,
+			reader.K8sLogFormatAuto, reader.K8sLogFormatDocker, reader.K8sLogFormatCRI)
+	}
+	tc := make(conf.MapConf, len(c)+1)
+	for k, v := range c {
+		tc[k] = v
+	}
+	if path, _ := tc.GetStringOr(reader.KeyLogPath, ""); path == "" {
+		tc[reader.KeyLogPath] = reader.DefaultK8sLogPath
+	}
+	tr, err := tailx.NewReader(meta, tc)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		Reader:  tr.(*tailx.Reader),
+		format:  format,
+		partial: make(map[string]*bytes.Buffer),
+	}, nil
+}
+
+func (r *Reader) Name() string {
+	return "K8sReader:" + r.Reader.Name()
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return fmt.Errorf("%v not support read mode", r.Name())
+}
+
+// ReadData 读取一条完整的容器日志，被拆分的日志拼接之后再返回，没有数据时返回 nil
+func (r *Reader) ReadData() (Data, int64, error) {
+	var size int64
+	for {
+		line, err := r.Reader.ReadLine()
+		if line == "" {
+			return nil, size, err
+		}
+		size += int64(len(line))
+		path := r.Reader.Source()
+		raw := strings.TrimRight(line, "\r\n")
+		entry, ok := parseLine(r.format, raw)
+		if !ok {
+			// 无法识别的格式原样输出，不丢弃数据
+			entry = logEntry{log: raw}
+		}
+		if entry.partial {
+			b, ok := r.partial[path]
+			if !ok {
+				b = &bytes.Buffer{}
+				r.partial[path] = b
+			}
+			b.WriteString(entry.log)
+			if b.Len() < maxPartialSize {
+				continue
+			}
+		}
+		if b, ok := r.partial[path]; ok {
+			delete(r.partial, path)
+			if !entry.partial {
+				b.WriteString(entry.log)
+			}
+			entry.log = b.String()
+		}
+		data := Data{
+			KeyLog: strings.TrimSuffix(entry.log, "\n"),
+		}
+		if entry.stream != "" {
+			data[KeyStream] = entry.stream
+		}
+		if entry.time != "" {
+			data[KeyTime] = entry.time
+		}
+		addContainerInfo(data, path)
+		return data, size, nil
+	}
+}
+
+type logEntry struct {
+	log     string
+	stream  string
+	time    string
+	partial bool
+}
+
+// parseLine 解析容器运行时写入文件的一行日志
+func parseLine(format, line string) (logEntry, bool) {
+	switch format {
+	case reader.K8sLogFormatDocker:
+		return parseDocker(line)
+	case reader.K8sLogFormatCRI:
+		return parseCRI(line)
+	}
+	if strings.HasPrefix(line, "{") {
+		return parseDocker(line)
+	}
+	return parseCRI(line)
+}
+
+// parseDocker 解析 docker json-file 格式: {"log":"message\n","stream":"stdout","time":"2018-06-01T08:00:00.000000000Z"}，
+// log 不以换行结尾时表示这一行被拆分了，后面还有内容
+func parseDocker(line string) (logEntry, bool) {
+	var dl struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &dl); err != nil {
+		return logEntry{}, false
+	}
+	return logEntry{
+		log:     dl.Log,
+		stream:  dl.Stream,
+		time:    dl.Time,
+		partial: !strings.HasSuffix(dl.Log, "\n"),
+	}, true
+}
+
+// parseCRI 解析 CRI 格式: 2018-06-01T08:00:00.000000000Z stdout F message，
+// 第三列的 tag 为 P 时表示这一行被拆分了，旧版本的 CRI 没有 tag 这一列
+func parseCRI(line string) (logEntry, bool) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return logEntry{}, false
+	}
+	if parts[1] != "stdout" && parts[1] != "stderr" {
+		return logEntry{}, false
+	}
+	entry := logEntry{time: parts[0], stream: parts[1]}
+	tags := strings.Split(parts[2], ":")
+	switch tags[0] {
+	case "P":
+		entry.partial = true
+		fallthrough
+	case "F":
+		if len(parts) == 4 {
+			entry.log = parts[3]
+		}
+	default:
+		entry.log = strings.Join(parts[2:], " ")
+	}
+	return entry, true
+}
+
+// addContainerInfo 根据 kubelet 创建的文件名 <pod>_<namespace>_<container>-<container_id>.log 加上容器的信息，
+// pod、namespace 和容器的名称都不能包含下划线
+func addContainerInfo(data Data, path string) {
+	name := strings.TrimSuffix(filepath.Base(path), ".log")
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) != 3 {
+		return
+	}
+	data[KeyPodName] = parts[0]
+	data[KeyNamespace] = parts[1]
+	container := parts[2]
+	if idx := strings.LastIndex(container, "-"); idx > 0 {
+		data[KeyContainerID] = container[idx+1:]
+		container = container[:idx]
+	}
+	data[KeyContainerName] = container
+}
@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		format string
+		line   string
+		exp    logEntry
+		ok     bool
+	}{
+		{
+			format: reader.K8sLogFormatAuto,
+			line:   `{"log":"hello\n","stream":"stdout","time":"2018-06-01T08:00:00.000000001Z"}`,
+			exp:    logEntry{log: "hello\n", stream: "stdout", time: "2018-06-01T08:00:00.000000001Z"},
+			ok:     true,
+		},
+		{
+			format: reader.K8sLogFormatDocker,
+			line:   `{"log":"hel","stream":"stderr","time":"2018-06-01T08:00:00.000000001Z"}`,
+			exp:    logEntry{log: "hel", stream: "stderr", time: "2018-06-01T08:00:00.000000001Z", partial: true},
+			ok:     true,
+		},
+		{
+			format: reader.K8sLogFormatAuto,
+			line:   "2018-06-01T08:00:00.000000001Z stdout F hello world",
+			exp:    logEntry{log: "hello world", stream: "stdout", time: "2018-06-01T08:00:00.000000001Z"},
+			ok:     true,
+		},
+		{
+			format: reader.K8sLogFormatCRI,
+			line:   "2018-06-01T08:00:00.000000001Z stderr P hello",
+			exp:    logEntry{log: "hello", stream: "stderr", time: "2018-06-01T08:00:00.000000001Z", partial: true},
+			ok:     true,
+		},
+		{
+			format: reader.K8sLogFormatCRI,
+			line:   "2018-06-01T08:00:00.000000001Z stdout hello world",
+			exp:    logEntry{log: "hello world", stream: "stdout", time: "2018-06-01T08:00:00.000000001Z"},
+			ok:     true,
+		},
+		{
+			format: reader.K8sLogFormatAuto,
+			line:   "hello world",
+			ok:     false,
+		},
+		{
+			format: reader.K8sLogFormatDocker,
+			line:   "2018-06-01T08:00:00.000000001Z stdout F hello",
+			ok:     false,
+		},
+	}
+	for _, ti := range tests {
+		got, ok := parseLine(ti.format, ti.line)
+		assert.Equal(t, ti.ok, ok, ti.line)
+		if ok {
+			assert.Equal(t, ti.exp, got, ti.line)
+		}
+	}
+}
+
+func TestAddContainerInfo(t *testing.T) {
+	data := Data{}
+	addContainerInfo(data, "/var/log/containers/nginx-6d4cf56db6-abcde_default_nginx-0123456789abcdef.log")
+	assert.Equal(t, Data{
+		KeyPodName:       "nginx-6d4cf56db6-abcde",
+		KeyNamespace:     "default",
+		KeyContainerName: "nginx",
+		KeyContainerID:   "0123456789abcdef",
+	}, data)
+
+	data = Data{}
+	addContainerInfo(data, "/var/log/containers/app.log")
+	assert.Equal(t, Data{}, data)
+}
+
+func TestReadData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestK8sReadData")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logDir := filepath.Join(dir, "containers")
+	assert.NoError(t, os.Mkdir(logDir, 0755))
+	content := `{"log":"hel","stream":"stdout","time":"2018-06-01T08:00:00.000000001Z"}
+{"log":"lo\n","stream":"stdout","time":"2018-06-01T08:00:00.000000002Z"}
+not a container log
+`
+	path := filepath.Join(logDir, "web-0_prod_app-abcdef.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	c := conf.MapConf{
+		reader.KeyLogPath:  filepath.Join(logDir, "*.log"),
+		reader.KeyMetaPath: filepath.Join(dir, "meta"),
+		reader.KeyMode:     reader.ModeK8s,
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	c[reader.KeyK8sLogFormat] = "json"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+
+	delete(c, reader.KeyK8sLogFormat)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	kr := r.(*Reader)
+
+	var datas []Data
+	for i := 0; i < 10 && len(datas) < 2; i++ {
+		data, _, err := kr.ReadData()
+		assert.NoError(t, err)
+		if data != nil {
+			datas = append(datas, data)
+		}
+	}
+	assert.Equal(t, []Data{
+		{
+			KeyLog:           "hello",
+			KeyStream:        "stdout",
+			KeyTime:          "2018-06-01T08:00:00.000000002Z",
+			KeyPodName:       "web-0",
+			KeyNamespace:     "prod",
+			KeyContainerName: "app",
+			KeyContainerID:   "abcdef",
+		},
+		{
+			KeyLog:           "not a container log",
+			KeyPodName:       "web-0",
+			KeyNamespace:     "prod",
+			KeyContainerName: "app",
+			KeyContainerID:   "abcdef",
+		},
+	}, datas)
+}
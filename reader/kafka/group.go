@@ -0,0 +1,783 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	groupProtocolType = "consumer"
+	groupProtocol     = "range"
+
+	groupSessionTimeout    = 10 * time.Second
+	groupHeartbeatInterval = 3 * time.Second
+	groupRetryInterval     = 3 * time.Second
+	// groupTopicRefresh 是使用 kafka_topic_regex 时重新检查 topic 列表的间隔，topic 变化后重新加入 group
+	groupTopicRefresh = time.Minute
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeKafkaGroup, NewGroupReader)
+}
+
+var _ reader.StructuredReader = &GroupReader{}
+
+type groupMessage struct {
+	msg        *sarama.ConsumerMessage
+	generation int32
+}
+
+// GroupReader 直接使用 Kafka 的 consumer group 协议消费数据，读取进度提交到 Kafka 中，不依赖 zookeeper
+type GroupReader struct {
+	meta       *reader.Meta
+	groupID    string
+	topics     []string
+	topicRegex *regexp.Regexp
+	initial    int64
+
+	client   sarama.Client
+	consumer sarama.Consumer
+
+	status int32
+	quit   chan struct{}
+	done   chan struct{}
+	msgs   chan groupMessage
+
+	mux        sync.Mutex
+	memberID   string
+	generation int32
+	// positions 是每个 partition 下一条要读取的 offset，committed 是已经提交的 offset
+	positions map[string]map[int32]int64
+	committed map[string]map[int32]int64
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewGroupReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	groupID, err := c.GetString(reader.KeyKafkaGroupID)
+	if err != nil {
+		return nil, err
+	}
+	brokers, err := c.GetStringList(reader.KeyKafkaBrokers)
+	if err != nil {
+		return nil, err
+	}
+	topics, _ := c.GetStringListOr(reader.KeyKafkaTopic, nil)
+	pattern, _ := c.GetStringOr(reader.KeyKafkaTopicRegex, "")
+	if len(topics) == 0 && pattern == "" {
+		return nil, fmt.Errorf("%v or %v is required", reader.KeyKafkaTopic, reader.KeyKafkaTopicRegex)
+	}
+	var topicRegex *regexp.Regexp
+	if pattern != "" {
+		if topicRegex, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid %v %q: %v", reader.KeyKafkaTopicRegex, pattern, err)
+		}
+	}
+	whence, _ := c.GetStringOr(reader.KeyWhence, reader.WhenceOldest)
+	var initial int64
+	switch strings.ToLower(whence) {
+	case reader.WhenceOldest, "":
+		initial = sarama.OffsetOldest
+	case reader.WhenceNewest:
+		initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyWhence, whence, reader.WhenceOldest, reader.WhenceNewest)
+	}
+	config, err := newGroupConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sarama.Logger = log.Std
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("runner[%v] connect to kafka %v error: %v", meta.RunnerName, brokers, err)
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &GroupReader{
+		meta:       meta,
+		groupID:    groupID,
+		topics:     topics,
+		topicRegex: topicRegex,
+		initial:    initial,
+		client:     client,
+		consumer:   consumer,
+		status:     reader.StatusInit,
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		msgs:       make(chan groupMessage, 100),
+		positions:  make(map[string]map[int32]int64),
+		committed:  make(map[string]map[int32]int64),
+	}, nil
+}
+
+// newGroupConfig 根据 kafka_version 以及 SASL、TLS 相关的配置生成 sarama 的配置
+func newGroupConfig(c conf.MapConf) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "logkit"
+	config.Consumer.Return.Errors = true
+
+	version, _ := c.GetStringOr(reader.KeyKafkaVersion, reader.DefaultKafkaVersion)
+	v, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v %q: %v", reader.KeyKafkaVersion, version, err)
+	}
+	if !v.IsAtLeast(sarama.V0_9_0_0) {
+		return nil, fmt.Errorf("%v %v not supported, consumer group requires kafka 0.9.0.0 or later", reader.KeyKafkaVersion, version)
+	}
+	config.Version = v
+
+	mechanism, _ := c.GetStringOr(reader.KeyKafkaSASLMechanism, reader.KafkaSASLNone)
+	switch mechanism {
+	case reader.KafkaSASLNone, "":
+	case reader.KafkaSASLPlain, reader.KafkaSASLSCRAMSHA256, reader.KafkaSASLSCRAMSHA512:
+		user, err := c.GetString(reader.KeyKafkaSASLUsername)
+		if err != nil {
+			return nil, err
+		}
+		password, _ := c.GetStringOr(reader.KeyKafkaSASLPassword, "")
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = user
+		config.Net.SASL.Password = password
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+		if mechanism != reader.KafkaSASLPlain {
+			config.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClient(config.Net.SASL.Mechanism)
+		}
+	default:
+		return nil, fmt.Errorf("%v %v not supported, should be one of %v, %v, %v, %v", reader.KeyKafkaSASLMechanism, mechanism,
+			reader.KafkaSASLNone, reader.KafkaSASLPlain, reader.KafkaSASLSCRAMSHA256, reader.KafkaSASLSCRAMSHA512)
+	}
+
+	if enable, _ := c.GetBoolOr(reader.KeyKafkaTLS, false); enable {
+		caPath, _ := c.GetStringOr(reader.KeyKafkaTLSCAPath, "")
+		certPath, _ := c.GetStringOr(reader.KeyKafkaTLSCertPath, "")
+		keyPath, _ := c.GetStringOr(reader.KeyKafkaTLSKeyPath, "")
+		insecure, _ := c.GetBoolOr(reader.KeyKafkaTLSInsecureSkipVerify, false)
+		tlsConfig, err := newTLSConfig(caPath, certPath, keyPath, insecure)
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	return config, config.Validate()
+}
+
+func newTLSConfig(caPath, certPath, keyPath string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca error %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in %v", caPath)
+		}
+		config.RootCAs = pool
+	}
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate error %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (r *GroupReader) Name() string {
+	return fmt.Sprintf("KafkaGroupReader:[%s],[%s]", r.topicNames(), r.groupID)
+}
+
+func (r *GroupReader) Source() string {
+	return fmt.Sprintf("[%s],[%s]", r.topicNames(), r.groupID)
+}
+
+func (r *GroupReader) topicNames() string {
+	names := strings.Join(r.topics, ",")
+	if r.topicRegex != nil {
+		if names != "" {
+			names += ","
+		}
+		names += r.topicRegex.String()
+	}
+	return names
+}
+
+func (r *GroupReader) SetMode(mode string, v interface{}) error {
+	return errors.New("KafkaGroupReader not support read mode")
+}
+
+func (r *GroupReader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+func (r *GroupReader) run() {
+	defer close(r.done)
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		topics, err := r.subscribedTopics()
+		if err == nil {
+			if err = r.consume(topics); err == nil {
+				continue
+			}
+		}
+		log.Errorf("Runner[%v] %v consume error: %v, retry after %v", r.meta.RunnerName, r.Name(), err, groupRetryInterval)
+		r.setStatsError(err.Error())
+		select {
+		case <-r.quit:
+			return
+		case <-time.After(groupRetryInterval):
+		}
+	}
+}
+
+// subscribedTopics 返回 kafka_topic 以及 kafka_topic_regex 匹配到的 topic，kafka 内部的 topic 不会被匹配
+func (r *GroupReader) subscribedTopics() ([]string, error) {
+	set := make(map[string]bool)
+	for _, topic := range r.topics {
+		set[topic] = true
+	}
+	if r.topicRegex != nil {
+		if err := r.client.RefreshMetadata(); err != nil {
+			return nil, err
+		}
+		all, err := r.client.Topics()
+		if err != nil {
+			return nil, err
+		}
+		for _, topic := range all {
+			if !strings.HasPrefix(topic, "__") && r.topicRegex.MatchString(topic) {
+				set[topic] = true
+			}
+		}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no topic matches %v", r.topicRegex)
+	}
+	topics := make([]string, 0, len(set))
+	for topic := range set {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// consume 加入 group 并消费分配到的 partition，直到需要重新平衡或者 reader 被关闭
+func (r *GroupReader) consume(topics []string) error {
+	generation, assignment, err := r.join(topics)
+	if err != nil {
+		return err
+	}
+	committed, err := r.fetchOffsets(assignment)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var pcs []sarama.PartitionConsumer
+	defer func() {
+		close(stop)
+		for _, pc := range pcs {
+			pc.AsyncClose()
+		}
+		wg.Wait()
+	}()
+
+	positions := make(map[string]map[int32]int64, len(assignment))
+	for topic, partitions := range assignment {
+		positions[topic] = make(map[int32]int64, len(partitions))
+	}
+	r.mux.Lock()
+	r.generation = generation
+	r.positions = positions
+	r.committed = committed
+	r.mux.Unlock()
+	for topic, partitions := range assignment {
+		for _, partition := range partitions {
+			pc, offset, err := r.consumePartition(topic, partition, committed[topic][partition])
+			if err != nil {
+				return fmt.Errorf("consume %v/%v error: %v", topic, partition, err)
+			}
+			r.mux.Lock()
+			positions[topic][partition] = offset
+			r.mux.Unlock()
+			pcs = append(pcs, pc)
+			wg.Add(1)
+			go r.forward(pc, generation, stop, &wg)
+		}
+	}
+	log.Infof("Runner[%v] %v joined group generation %v, assigned %v", r.meta.RunnerName, r.Name(), generation, assignment)
+
+	return r.heartbeatLoop(topics, generation)
+}
+
+// join 加入 group，leader 负责按照 range 策略分配 partition，返回本次的 generation 和分配给自己的 partition
+func (r *GroupReader) join(topics []string) (int32, map[string][]int32, error) {
+	coordinator, err := r.client.Coordinator(r.groupID)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.mux.Lock()
+	memberID := r.memberID
+	r.mux.Unlock()
+
+	joinReq := &sarama.JoinGroupRequest{
+		GroupId:        r.groupID,
+		SessionTimeout: int32(groupSessionTimeout / time.Millisecond),
+		MemberId:       memberID,
+		ProtocolType:   groupProtocolType,
+	}
+	if err = joinReq.AddGroupProtocolMetadata(groupProtocol, &sarama.ConsumerGroupMemberMetadata{Topics: topics}); err != nil {
+		return 0, nil, err
+	}
+	joinResp, err := coordinator.JoinGroup(joinReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	if joinResp.Err != sarama.ErrNoError {
+		return 0, nil, r.groupError(joinResp.Err)
+	}
+	r.mux.Lock()
+	r.memberID = joinResp.MemberId
+	r.mux.Unlock()
+
+	syncReq := &sarama.SyncGroupRequest{
+		GroupId:      r.groupID,
+		GenerationId: joinResp.GenerationId,
+		MemberId:     joinResp.MemberId,
+	}
+	if joinResp.LeaderId == joinResp.MemberId {
+		members, err := joinResp.GetMembers()
+		if err != nil {
+			return 0, nil, err
+		}
+		memberTopics := make(map[string][]string, len(members))
+		partitions := make(map[string][]int32)
+		for id, member := range members {
+			memberTopics[id] = member.Topics
+			for _, topic := range member.Topics {
+				if _, ok := partitions[topic]; ok {
+					continue
+				}
+				if partitions[topic], err = r.client.Partitions(topic); err != nil {
+					return 0, nil, fmt.Errorf("get partitions of %v error: %v", topic, err)
+				}
+			}
+		}
+		for id, assignment := range rangeAssign(memberTopics, partitions) {
+			if err = syncReq.AddGroupAssignmentMember(id, &sarama.ConsumerGroupMemberAssignment{Topics: assignment}); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	syncResp, err := coordinator.SyncGroup(syncReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	if syncResp.Err != sarama.ErrNoError {
+		return 0, nil, r.groupError(syncResp.Err)
+	}
+	if len(syncResp.MemberAssignment) == 0 {
+		return joinResp.GenerationId, nil, nil
+	}
+	assignment, err := syncResp.GetMemberAssignment()
+	if err != nil {
+		return 0, nil, err
+	}
+	return joinResp.GenerationId, assignment.Topics, nil
+}
+
+// groupError 在成员失效时清空 member id，在协调者变化时刷新协调者，下次重新加入 group 时使用
+func (r *GroupReader) groupError(kerr sarama.KError) error {
+	switch kerr {
+	case sarama.ErrUnknownMemberId, sarama.ErrIllegalGeneration:
+		r.mux.Lock()
+		r.memberID = ""
+		r.mux.Unlock()
+	case sarama.ErrNotCoordinatorForConsumer, sarama.ErrConsumerCoordinatorNotAvailable:
+		r.client.RefreshCoordinator(r.groupID)
+	}
+	return kerr
+}
+
+// rangeAssign 与 Kafka 的 RangeAssignor 相同，每个 topic 排序后的 partition 按顺序平均分成连续的几段，依次分给排序后订阅了这个 topic 的成员
+func rangeAssign(members map[string][]string, partitions map[string][]int32) map[string]map[string][]int32 {
+	consumers := make(map[string][]string)
+	assignment := make(map[string]map[string][]int32, len(members))
+	for id, topics := range members {
+		assignment[id] = make(map[string][]int32)
+		for _, topic := range topics {
+			consumers[topic] = append(consumers[topic], id)
+		}
+	}
+	for topic, ids := range consumers {
+		sort.Strings(ids)
+		ps := append([]int32(nil), partitions[topic]...)
+		sort.Slice(ps, func(i, j int) bool { return ps[i] < ps[j] })
+		n, extra := len(ps)/len(ids), len(ps)%len(ids)
+		start := 0
+		for i, id := range ids {
+			count := n
+			if i < extra {
+				count++
+			}
+			if count > 0 {
+				assignment[id][topic] = ps[start : start+count]
+			}
+			start += count
+		}
+	}
+	return assignment
+}
+
+// fetchOffsets 获取 group 在各个 partition 上已经提交的 offset，没有提交过的为 -1
+func (r *GroupReader) fetchOffsets(assignment map[string][]int32) (map[string]map[int32]int64, error) {
+	offsets := make(map[string]map[int32]int64, len(assignment))
+	if len(assignment) == 0 {
+		return offsets, nil
+	}
+	coordinator, err := r.client.Coordinator(r.groupID)
+	if err != nil {
+		return nil, err
+	}
+	req := &sarama.OffsetFetchRequest{ConsumerGroup: r.groupID, Version: 1}
+	for topic, partitions := range assignment {
+		for _, partition := range partitions {
+			req.AddPartition(topic, partition)
+		}
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, err
+	}
+	for topic, partitions := range assignment {
+		offsets[topic] = make(map[int32]int64, len(partitions))
+		for _, partition := range partitions {
+			block := resp.GetBlock(topic, partition)
+			if block == nil {
+				return nil, fmt.Errorf("offset of %v/%v is missing in response", topic, partition)
+			}
+			if block.Err != sarama.ErrNoError {
+				return nil, r.groupError(block.Err)
+			}
+			offsets[topic][partition] = block.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// consumePartition 从已经提交的 offset 开始消费，没有提交过或者已经过期时根据 read_from 从最早或者最新的位置开始
+func (r *GroupReader) consumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, int64, error) {
+	var err error
+	if offset < 0 {
+		if offset, err = r.client.GetOffset(topic, partition, r.initial); err != nil {
+			return nil, 0, err
+		}
+	}
+	pc, err := r.consumer.ConsumePartition(topic, partition, offset)
+	if err == sarama.ErrOffsetOutOfRange {
+		log.Warnf("Runner[%v] %v committed offset %v of %v/%v is out of range, reset it", r.meta.RunnerName, r.Name(), offset, topic, partition)
+		if offset, err = r.client.GetOffset(topic, partition, r.initial); err != nil {
+			return nil, 0, err
+		}
+		pc, err = r.consumer.ConsumePartition(topic, partition, offset)
+	}
+	return pc, offset, err
+}
+
+// forward 把一个 partition 的消息放入 msgs，stop 关闭后丢弃剩余的消息直到 partition consumer 关闭
+func (r *GroupReader) forward(pc sarama.PartitionConsumer, generation int32, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	msgs, errs := pc.Messages(), pc.Errors()
+	for msgs != nil || errs != nil {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			select {
+			case r.msgs <- groupMessage{msg: msg, generation: generation}:
+			case <-stop:
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Errorf("Runner[%v] %v consumer error: %v", r.meta.RunnerName, r.Name(), err)
+			r.setStatsError(err.Error())
+		}
+	}
+}
+
+// heartbeatLoop 定期发送心跳，group 开始重新平衡或者订阅的 topic 发生变化时返回 nil，reader 关闭时离开 group
+func (r *GroupReader) heartbeatLoop(topics []string, generation int32) error {
+	heartbeat := time.NewTicker(groupHeartbeatInterval)
+	defer heartbeat.Stop()
+	var refresh <-chan time.Time
+	if r.topicRegex != nil {
+		ticker := time.NewTicker(groupTopicRefresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+	for {
+		select {
+		case <-r.quit:
+			r.leave()
+			return nil
+		case <-heartbeat.C:
+			if rebalance, err := r.heartbeat(generation); err != nil || rebalance {
+				return err
+			}
+		case <-refresh:
+			current, err := r.subscribedTopics()
+			if err != nil {
+				log.Warnf("Runner[%v] %v refresh topics error: %v", r.meta.RunnerName, r.Name(), err)
+				continue
+			}
+			if strings.Join(current, ",") != strings.Join(topics, ",") {
+				log.Infof("Runner[%v] %v topics changed to %v, rejoin group", r.meta.RunnerName, r.Name(), current)
+				return nil
+			}
+		}
+	}
+}
+
+func (r *GroupReader) heartbeat(generation int32) (rebalance bool, err error) {
+	coordinator, err := r.client.Coordinator(r.groupID)
+	if err != nil {
+		return false, err
+	}
+	r.mux.Lock()
+	memberID := r.memberID
+	r.mux.Unlock()
+	resp, err := coordinator.Heartbeat(&sarama.HeartbeatRequest{
+		GroupId:      r.groupID,
+		GenerationId: generation,
+		MemberId:     memberID,
+	})
+	if err != nil {
+		return false, err
+	}
+	switch resp.Err {
+	case sarama.ErrNoError:
+		return false, nil
+	case sarama.ErrRebalanceInProgress:
+		return true, nil
+	case sarama.ErrUnknownMemberId, sarama.ErrIllegalGeneration:
+		r.groupError(resp.Err)
+		return true, nil
+	}
+	return false, r.groupError(resp.Err)
+}
+
+func (r *GroupReader) leave() {
+	r.mux.Lock()
+	memberID := r.memberID
+	r.mux.Unlock()
+	if memberID == "" {
+		return
+	}
+	coordinator, err := r.client.Coordinator(r.groupID)
+	if err == nil {
+		_, err = coordinator.LeaveGroup(&sarama.LeaveGroupRequest{GroupId: r.groupID, MemberId: memberID})
+	}
+	if err != nil {
+		log.Warnf("Runner[%v] %v leave group error: %v", r.meta.RunnerName, r.Name(), err)
+	}
+}
+
+func (r *GroupReader) ReadLine() (string, error) {
+	return string(r.readValue()), nil
+}
+
+// ReadStructured 把 JSON 对象格式的消息直接解析为 Data，其他消息作为原始字符串交给 parser 处理
+func (r *GroupReader) ReadStructured() (Data, int64, error) {
+	value := r.readValue()
+	if len(value) == 0 {
+		return nil, 0, nil
+	}
+	data := make(Data)
+	if jsonTool.Unmarshal(value, &data) != nil {
+		data = Data{KeyPandoraStash: string(value)}
+	}
+	return data, int64(len(value)), nil
+}
+
+// readValue 返回下一条消息并更新 partition 的读取位置，重新平衡之前的消息已经不属于自己，直接丢弃
+func (r *GroupReader) readValue() []byte {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-r.msgs:
+			r.mux.Lock()
+			if m.generation != r.generation {
+				r.mux.Unlock()
+				continue
+			}
+			if tp, ok := r.positions[m.msg.Topic]; ok {
+				tp[m.msg.Partition] = m.msg.Offset + 1
+			}
+			r.mux.Unlock()
+			if len(m.msg.Value) == 0 {
+				continue
+			}
+			return m.msg.Value
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// SyncMeta 把已经读取的位置提交到 Kafka，runner 在数据发送成功后调用
+func (r *GroupReader) SyncMeta() {
+	r.mux.Lock()
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           r.groupID,
+		ConsumerGroupGeneration: r.generation,
+		ConsumerID:              r.memberID,
+		RetentionTime:           -1,
+	}
+	pending := 0
+	for topic, partitions := range r.positions {
+		for partition, offset := range partitions {
+			if offset > r.committed[topic][partition] {
+				req.AddBlock(topic, partition, offset, 0, "")
+				pending++
+			}
+		}
+	}
+	committed := r.committed
+	r.mux.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	coordinator, err := r.client.Coordinator(r.groupID)
+	var resp *sarama.OffsetCommitResponse
+	if err == nil {
+		resp, err = coordinator.CommitOffset(req)
+	}
+	if err != nil {
+		log.Errorf("Runner[%v] %v commit offsets error: %v", r.meta.RunnerName, r.Name(), err)
+		r.setStatsError(err.Error())
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for topic, partitions := range resp.Errors {
+		for partition, kerr := range partitions {
+			if kerr != sarama.ErrNoError {
+				log.Errorf("Runner[%v] %v commit offset of %v/%v error: %v", r.meta.RunnerName, r.Name(), topic, partition, kerr)
+				r.setStatsError(kerr.Error())
+				continue
+			}
+			// 提交期间可能已经重新平衡，只更新本次 generation 的记录
+			if offset, _, err := req.Offset(topic, partition); err == nil && committed[topic] != nil {
+				committed[topic][partition] = offset
+			}
+		}
+	}
+}
+
+// PartitionLag 返回当前分配到的每个 partition 中还没有读取的消息数
+func (r *GroupReader) PartitionLag() (map[string]map[int32]int64, error) {
+	r.mux.Lock()
+	positions := make(map[string]map[int32]int64, len(r.positions))
+	for topic, partitions := range r.positions {
+		positions[topic] = make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			positions[topic][partition] = offset
+		}
+	}
+	r.mux.Unlock()
+
+	for topic, partitions := range positions {
+		for partition, offset := range partitions {
+			newest, err := r.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("get newest offset of %v/%v error: %v", topic, partition, err)
+			}
+			lag := newest - offset
+			if lag < 0 {
+				lag = 0
+			}
+			partitions[partition] = lag
+		}
+	}
+	return positions, nil
+}
+
+func (r *GroupReader) Lag() (*LagInfo, error) {
+	lags, err := r.PartitionLag()
+	if err != nil {
+		return nil, err
+	}
+	rl := &LagInfo{SizeUnit: "records"}
+	for _, partitions := range lags {
+		for _, lag := range partitions {
+			rl.Size += lag
+		}
+	}
+	return rl, nil
+}
+
+func (r *GroupReader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *GroupReader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *GroupReader) Close() error {
+	switch atomic.SwapInt32(&r.status, reader.StatusStopped) {
+	case reader.StatusStopped:
+		return nil
+	case reader.StatusRunning:
+		close(r.quit)
+		<-r.done
+	}
+	if err := r.consumer.Close(); err != nil {
+		log.Warnf("Runner[%v] %v close consumer error: %v", r.meta.RunnerName, r.Name(), err)
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// RFC 7677 中 SCRAM-SHA-256 的示例
+func TestSCRAMClient(t *testing.T) {
+	client := newSCRAMClient(sarama.SASLTypeSCRAMSHA256)().(*scramClient)
+	assert.NoError(t, client.Begin("user", "pencil", ""))
+	client.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	msg, err := client.Step("")
+	assert.NoError(t, err)
+	assert.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", msg)
+
+	msg, err = client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.NoError(t, err)
+	assert.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", msg)
+	assert.False(t, client.Done())
+
+	_, err = client.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.NoError(t, err)
+	assert.True(t, client.Done())
+
+	// 服务端的签名不正确时认证失败
+	client = newSCRAMClient(sarama.SASLTypeSCRAMSHA256)().(*scramClient)
+	assert.NoError(t, client.Begin("user", "wrong", ""))
+	client.nonce = "rOprNGfwEbeRWgbNEkqO"
+	client.Step("")
+	client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	_, err = client.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.Error(t, err)
+}
+
+func TestRangeAssign(t *testing.T) {
+	members := map[string][]string{
+		"c2": {"a", "b"},
+		"c1": {"a"},
+		"c3": {"b"},
+	}
+	partitions := map[string][]int32{
+		"a": {2, 0, 1},
+		"b": {0},
+	}
+	exp := map[string]map[string][]int32{
+		"c1": {"a": {0, 1}},
+		"c2": {"a": {2}, "b": {0}},
+		"c3": {},
+	}
+	assert.Equal(t, exp, rangeAssign(members, partitions))
+}
+
+func TestNewGroupReaderConfig(t *testing.T) {
+	_, err := newGroupConfig(conf.MapConf{reader.KeyKafkaVersion: "0.8.2.0"})
+	assert.Error(t, err)
+	_, err = newGroupConfig(conf.MapConf{reader.KeyKafkaSASLMechanism: "GSSAPI"})
+	assert.Error(t, err)
+	_, err = newGroupConfig(conf.MapConf{reader.KeyKafkaSASLMechanism: reader.KafkaSASLPlain})
+	assert.Error(t, err)
+
+	config, err := newGroupConfig(conf.MapConf{
+		reader.KeyKafkaSASLMechanism: reader.KafkaSASLSCRAMSHA512,
+		reader.KeyKafkaSASLUsername:  "user",
+		reader.KeyKafkaSASLPassword:  "pass",
+		reader.KeyKafkaTLS:           "true",
+	})
+	assert.NoError(t, err)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.True(t, config.Net.TLS.Enable)
+}
+
+func TestGroupReader(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	join := &sarama.JoinGroupRequest{}
+	assert.NoError(t, join.AddGroupProtocolMetadata(groupProtocol, &sarama.ConsumerGroupMemberMetadata{Topics: []string{"logs"}}))
+	sync := &sarama.SyncGroupRequest{}
+	assert.NoError(t, sync.AddGroupAssignmentMember("m1", &sarama.ConsumerGroupMemberAssignment{
+		Topics: map[string][]int32{"logs": {0, 1}},
+	}))
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs", 0, broker.BrokerID()).
+			SetLeader("logs", 1, broker.BrokerID()).
+			SetLeader("other", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "g1", broker),
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId:  1,
+			GroupProtocol: groupProtocol,
+			LeaderId:      "m1",
+			MemberId:      "m1",
+			Members:       map[string][]byte{"m1": join.OrderedGroupProtocols[0].Metadata},
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: sync.GroupAssignments["m1"],
+		}),
+		"HeartbeatRequest":  sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest": sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("g1", "logs", 0, 1, "", sarama.ErrNoError).
+			SetOffset("g1", "logs", 1, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("logs", 0, sarama.OffsetOldest, 0).
+			SetOffset("logs", 0, sarama.OffsetNewest, 3).
+			SetOffset("logs", 1, sarama.OffsetOldest, 0).
+			SetOffset("logs", 1, sarama.OffsetNewest, 2),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).
+			SetVersion(2).
+			SetMessage("logs", 0, 1, sarama.StringEncoder(`{"a":1}`)).
+			SetMessage("logs", 0, 2, sarama.StringEncoder("hello")).
+			SetMessage("logs", 1, 0, sarama.StringEncoder("p1")).
+			SetHighWaterMark("logs", 0, 3).
+			SetHighWaterMark("logs", 1, 2),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+
+	c := conf.MapConf{
+		reader.KeyMetaPath:        MetaDir,
+		reader.KeyFileDone:        MetaDir,
+		reader.KeyMode:            reader.ModeKafkaGroup,
+		reader.KeyKafkaGroupID:    "g1",
+		reader.KeyKafkaBrokers:    broker.Addr(),
+		reader.KeyKafkaTopicRegex: "^lo",
+		reader.KeyKafkaVersion:    "0.10.0.0",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	defer os.RemoveAll(MetaDir)
+	rd, err := NewGroupReader(meta, c)
+	assert.NoError(t, err)
+	r := rd.(*GroupReader)
+	defer r.Close()
+
+	var lines []string
+	var datas []Data
+	for i := 0; i < 10 && len(lines)+len(datas) < 3; i++ {
+		data, _, err := r.ReadStructured()
+		assert.NoError(t, err)
+		if data == nil {
+			continue
+		}
+		if raw, ok := data[KeyPandoraStash]; ok {
+			lines = append(lines, raw.(string))
+		} else {
+			datas = append(datas, data)
+		}
+	}
+	// 两个 partition 的消息顺序不确定
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines, "hello")
+	assert.Contains(t, lines, "p1")
+	assert.Len(t, datas, 1)
+
+	lag, err := r.Lag()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), lag.Size)
+
+	r.SyncMeta()
+	var commit *sarama.OffsetCommitRequest
+	var syncReq *sarama.SyncGroupRequest
+	for _, rr := range broker.History() {
+		switch req := rr.Request.(type) {
+		case *sarama.OffsetCommitRequest:
+			commit = req
+		case *sarama.SyncGroupRequest:
+			syncReq = req
+		}
+	}
+	if assert.NotNil(t, syncReq) {
+		assignment := &sarama.SyncGroupResponse{MemberAssignment: syncReq.GroupAssignments["m1"]}
+		a, err := assignment.GetMemberAssignment()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]int32{"logs": {0, 1}}, a.Topics)
+	}
+	if assert.NotNil(t, commit) {
+		assert.Equal(t, "m1", commit.ConsumerID)
+		assert.Equal(t, int32(1), commit.ConsumerGroupGeneration)
+		offset, _, err := commit.Offset("logs", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), offset)
+		offset, _, err = commit.Offset("logs", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), offset)
+	}
+	assert.NoError(t, r.Close())
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/json-iterator/go"
 	"github.com/wvanbergen/kafka/consumergroup"
 
 	"github.com/qiniu/log"
@@ -21,6 +22,14 @@ func init() {
 	reader.RegisterConstructor(reader.ModeKafka, NewReader)
 }
 
+// jsonTool 与 json parser 的配置一致，保证直接解析出的数据与经过 parser 的相同
+var jsonTool = jsoniter.Config{
+	EscapeHTML: true,
+	UseNumber:  true,
+}.Froze()
+
+var _ reader.StructuredReader = &Reader{}
+
 type Reader struct {
 	meta             *reader.Meta
 	ConsumerGroup    string
@@ -134,6 +143,24 @@ func (kr *Reader) Source() string {
 }
 
 func (kr *Reader) ReadLine() (data string, err error) {
+	value, err := kr.readValue()
+	return string(value), err
+}
+
+// ReadStructured 把 JSON 对象格式的消息直接解析为 Data，其他消息作为原始字符串交给 parser 处理
+func (kr *Reader) ReadStructured() (Data, int64, error) {
+	value, err := kr.readValue()
+	if err != nil || len(value) == 0 {
+		return nil, 0, err
+	}
+	data := make(Data)
+	if jsonTool.Unmarshal(value, &data) != nil {
+		data = Data{KeyPandoraStash: string(value)}
+	}
+	return data, int64(len(value)), nil
+}
+
+func (kr *Reader) readValue() (value []byte, err error) {
 	timer := time.NewTimer(time.Second)
 	select {
 	case err = <-kr.errs:
@@ -144,7 +171,7 @@ func (kr *Reader) ReadLine() (data string, err error) {
 		}
 	case msg := <-kr.in:
 		if msg != nil && msg.Value != nil && len(msg.Value) > 0 {
-			data = string(msg.Value)
+			value = msg.Value
 			kr.curMsg = msg
 			kr.statsLock.Lock()
 			if tp, ok := kr.curOffsets[msg.Topic]; ok {
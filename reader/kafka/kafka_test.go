@@ -1,14 +1,16 @@
 package kafka
 
 import (
+	"encoding/json"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/qiniu/logkit/conf"
+	"github.com/Shopify/sarama"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/reader"
 	. "github.com/qiniu/logkit/reader/test"
 	. "github.com/qiniu/logkit/utils/models"
@@ -38,3 +40,33 @@ func TestKafkaReader(t *testing.T) {
 
 	assert.Equal(t, StatsInfo{}, er.Status())
 }
+
+func TestKafkaReadStructured(t *testing.T) {
+	in := make(chan *sarama.ConsumerMessage, 3)
+	er := &Reader{
+		meta:       &reader.Meta{RunnerName: "TestKafkaReadStructured"},
+		in:         in,
+		errs:       make(chan error),
+		mux:        new(sync.Mutex),
+		statsLock:  new(sync.RWMutex),
+		curOffsets: map[string]map[int32]int64{},
+	}
+	in <- &sarama.ConsumerMessage{Topic: "topic1", Partition: 1, Offset: 10, Value: []byte(`{"a":1,"b":"x"}`)}
+	in <- &sarama.ConsumerMessage{Topic: "topic1", Partition: 1, Offset: 11, Value: []byte(`[{"a":2}]`)}
+	in <- &sarama.ConsumerMessage{Topic: "topic1", Partition: 1, Offset: 12, Value: []byte(`raw line`)}
+
+	data, bytes, err := er.ReadStructured()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(15), bytes)
+	assert.Equal(t, Data{"a": json.Number("1"), "b": "x"}, data)
+	assert.Equal(t, int64(10), er.curOffsets["topic1"][1])
+
+	// 不是 JSON 对象的消息作为原始字符串交给 parser
+	data, _, err = er.ReadStructured()
+	assert.NoError(t, err)
+	assert.Equal(t, Data{KeyPandoraStash: `[{"a":2}]`}, data)
+	data, _, err = er.ReadStructured()
+	assert.NoError(t, err)
+	assert.Equal(t, Data{KeyPandoraStash: "raw line"}, data)
+	assert.Equal(t, int64(12), er.curOffsets["topic1"][1])
+}
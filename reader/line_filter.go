@@ -0,0 +1,45 @@
+package reader
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+// LineFilter 在 BufReader 中按照正则表达式过滤读到的数据，被过滤掉的数据不会交给 parser，
+// 多行模式下匹配的是拼接之后的整条数据，创建之后不再修改，可以在多个 BufReader 之间共享
+type LineFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// NewLineFilterWithConf 根据 line_include_pattern 和 line_exclude_pattern 创建 LineFilter，都没有配置时返回 nil
+func NewLineFilterWithConf(conf conf.MapConf) (*LineFilter, error) {
+	include, _ := conf.GetStringOr(KeyLineIncludePattern, "")
+	exclude, _ := conf.GetStringOr(KeyLineExcludePattern, "")
+	if include == "" && exclude == "" {
+		return nil, nil
+	}
+	f := &LineFilter{}
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("%v %v compile error %v", KeyLineIncludePattern, include, err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("%v %v compile error %v", KeyLineExcludePattern, exclude, err)
+		}
+	}
+	return f, nil
+}
+
+// Drop 返回 line 是否需要丢弃，配置了 include 时不匹配的数据被丢弃，匹配 exclude 的数据总是被丢弃
+func (f *LineFilter) Drop(line string) bool {
+	if f.include != nil && !f.include.MatchString(line) {
+		return true
+	}
+	return f.exclude != nil && f.exclude.MatchString(line)
+}
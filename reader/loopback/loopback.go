@@ -0,0 +1,247 @@
+// Package loopback 实现了同一个 logkit 中 runner 之间的数据传递: loopback sender 发送的数据
+// 会被所有 loopback_name 相同的 loopback reader 读取, 从而可以不经过 Kafka 等外部服务,
+// 把多个 runner 串联成多级的处理流程
+package loopback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/queue"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	DefaultMemorySize      = 100 // 内存模式下最多缓存的批次数
+	DefaultPutTimeout      = time.Second
+	DefaultSyncEvery       = 10
+	DefaultMaxBytesPerFile = 500 * 1024 * 1024
+	DefaultWriteSpeedLimit = 10 * 1024 * 1024
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeLoopback, NewReader)
+}
+
+// hub 记录每个 loopback_name 下正在运行的 reader
+var hub = struct {
+	mutex   sync.RWMutex
+	readers map[string]map[*Reader]struct{}
+}{readers: make(map[string]map[*Reader]struct{})}
+
+func subscribe(r *Reader) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	rs, ok := hub.readers[r.loopbackName]
+	if !ok {
+		rs = make(map[*Reader]struct{})
+		hub.readers[r.loopbackName] = rs
+	}
+	rs[r] = struct{}{}
+}
+
+func unsubscribe(r *Reader) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	rs, ok := hub.readers[r.loopbackName]
+	if !ok {
+		return
+	}
+	delete(rs, r)
+	if len(rs) == 0 {
+		delete(hub.readers, r.loopbackName)
+	}
+}
+
+// Publish 把一批数据交给所有 loopback_name 为 name 的 reader, 每个 reader 都会收到一份完整的数据;
+// 没有正在运行的 reader 或者有 reader 的缓存已满时返回错误, 由 sender 重试, 重试时已经成功的 reader 会收到重复的数据
+func Publish(name string, datas []Data) error {
+	hub.mutex.RLock()
+	readers := make([]*Reader, 0, len(hub.readers[name]))
+	for r := range hub.readers[name] {
+		readers = append(readers, r)
+	}
+	hub.mutex.RUnlock()
+	if len(readers) == 0 {
+		return fmt.Errorf("no loopback reader of %v is running", name)
+	}
+
+	var errs []string
+	for _, r := range readers {
+		if err := r.put(datas); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+type Reader struct {
+	meta         *reader.Meta
+	loopbackName string
+	status       int32
+
+	// 内存模式
+	memChan chan []Data
+	// 磁盘模式
+	bufQueue queue.BackendQueue
+	readChan <-chan []byte
+
+	// 当前正在读取的批次
+	cur      []Data
+	curBytes int64
+}
+
+func NewReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
+	loopbackName, err := conf.GetString(reader.KeyLoopbackName)
+	if err != nil {
+		return nil, err
+	}
+	buffer, _ := conf.GetStringOr(reader.KeyLoopbackBuffer, reader.LoopbackBufferMemory)
+	r := &Reader{
+		meta:         meta,
+		loopbackName: loopbackName,
+		status:       reader.StatusInit,
+	}
+	switch buffer {
+	case reader.LoopbackBufferMemory:
+		size, _ := conf.GetIntOr(reader.KeyLoopbackMemorySize, DefaultMemorySize)
+		if size <= 0 {
+			size = DefaultMemorySize
+		}
+		r.memChan = make(chan []Data, size)
+	case reader.LoopbackBufferDisk:
+		if err = CreateDirIfNotExist(meta.BufFile()); err != nil {
+			return nil, err
+		}
+		r.bufQueue = queue.NewDiskQueue(Hash("Reader<loopback_"+loopbackName+">_buffer"), meta.BufFile(), DefaultMaxBytesPerFile, 0,
+			DefaultMaxBytesPerFile, DefaultSyncEvery, DefaultSyncEvery, time.Second*2, DefaultWriteSpeedLimit, false, 0)
+		r.readChan = r.bufQueue.ReadChan()
+	default:
+		return nil, fmt.Errorf("%v should be %v or %v, but got %v", reader.KeyLoopbackBuffer,
+			reader.LoopbackBufferMemory, reader.LoopbackBufferDisk, buffer)
+	}
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "LoopbackReader<" + r.loopbackName + ">"
+}
+
+func (r *Reader) Source() string {
+	return "loopback://" + r.loopbackName
+}
+
+// put 在 sender 的 goroutine 中调用
+func (r *Reader) put(datas []Data) error {
+	if atomic.LoadInt32(&r.status) != reader.StatusRunning {
+		return fmt.Errorf("%v is not running", r.Name())
+	}
+	if r.bufQueue != nil {
+		msg, err := json.Marshal(datas)
+		if err != nil {
+			return err
+		}
+		return r.bufQueue.Put(msg)
+	}
+
+	// 下游 runner 会修改数据, 上游的其他 sender 可能还在使用, 所以放入的是一份拷贝
+	cp := make([]Data, len(datas))
+	for i, d := range datas {
+		cp[i] = make(Data, len(d))
+		for k, v := range d {
+			cp[i][k] = v
+		}
+	}
+	timer := time.NewTimer(DefaultPutTimeout)
+	defer timer.Stop()
+	select {
+	case r.memChan <- cp:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("runner[%v] %v buffer is full", r.meta.RunnerName, r.Name())
+	}
+}
+
+func (r *Reader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	subscribe(r)
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+func (r *Reader) ReadData() (Data, int64, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	if len(r.cur) == 0 {
+		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+		select {
+		case datas := <-r.memChan:
+			r.cur, r.curBytes = datas, 0
+		case msg, ok := <-r.readChan:
+			if !ok {
+				return nil, 0, nil
+			}
+			var datas []Data
+			if err := json.Unmarshal(msg, &datas); err != nil {
+				return nil, 0, fmt.Errorf("runner[%v] %v unmarshal buffered datas error %v", r.meta.RunnerName, r.Name(), err)
+			}
+			r.cur = datas
+			if len(datas) > 0 {
+				r.curBytes = int64(len(msg) / len(datas))
+			}
+		case <-timer.C:
+			return nil, 0, nil
+		}
+	}
+	if len(r.cur) == 0 {
+		return nil, 0, nil
+	}
+	data := r.cur[0]
+	r.cur = r.cur[1:]
+	return data, r.curBytes, nil
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return fmt.Errorf("runner[%v] %v not support read mode", r.meta.RunnerName, r.Name())
+}
+
+// Close 之后内存模式中缓存的数据会丢失, 磁盘模式中的数据在下次启动后继续读取(正在读取的批次除外)
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	unsubscribe(r)
+	if r.bufQueue != nil {
+		return r.bufQueue.Close()
+	}
+	return nil
+}
+
+func (r *Reader) SyncMeta() {}
+
+func (r *Reader) Lag() (*LagInfo, error) {
+	var total int64
+	if r.bufQueue != nil {
+		total = r.bufQueue.Depth()
+	} else {
+		total = int64(len(r.memChan))
+	}
+	return &LagInfo{Size: total, SizeUnit: "batches"}, nil
+}
@@ -0,0 +1,93 @@
+package loopback
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func newTestReader(t *testing.T, runnerName string, c conf.MapConf) *Reader {
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: "./meta_" + runnerName,
+		reader.KeyMode:     reader.ModeLoopback,
+		KeyRunnerName:      runnerName,
+	})
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	return r.(*Reader)
+}
+
+func readAll(r *Reader, n int) []Data {
+	var datas []Data
+	for i := 0; i < n*2 && len(datas) < n; i++ {
+		d, _, err := r.ReadData()
+		if err == nil && d != nil {
+			datas = append(datas, d)
+		}
+	}
+	return datas
+}
+
+func TestLoopbackMemory(t *testing.T) {
+	defer os.RemoveAll("./meta_TestLoopbackMemory1")
+	defer os.RemoveAll("./meta_TestLoopbackMemory2")
+	assert.Error(t, Publish("TestLoopbackMemory", []Data{{"a": 1}}))
+
+	c := conf.MapConf{reader.KeyLoopbackName: "TestLoopbackMemory", reader.KeyLoopbackMemorySize: "1"}
+	r1 := newTestReader(t, "TestLoopbackMemory1", c)
+	r2 := newTestReader(t, "TestLoopbackMemory2", c)
+	defer r1.Close()
+	r1.Start()
+	r2.Start()
+
+	src := []Data{{"a": 1}, {"a": 2}}
+	assert.NoError(t, Publish("TestLoopbackMemory", src))
+	// 缓存已满
+	assert.Error(t, Publish("TestLoopbackMemory", src))
+	lag, err := r1.Lag()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), lag.Size)
+
+	// 每个 reader 都收到一份拷贝
+	got1 := readAll(r1, 2)
+	assert.Equal(t, src, got1)
+	got1[0]["a"] = 100
+	assert.Equal(t, src, readAll(r2, 2))
+	assert.Equal(t, 1, src[0]["a"])
+
+	// 停止的 reader 不再接收数据
+	r2.Close()
+	assert.NoError(t, Publish("TestLoopbackMemory", src))
+	assert.Len(t, readAll(r1, 2), 2)
+	d, _, err := r1.ReadData()
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+func TestLoopbackDisk(t *testing.T) {
+	defer os.RemoveAll("./meta_TestLoopbackDisk")
+	c := conf.MapConf{reader.KeyLoopbackName: "TestLoopbackDisk", reader.KeyLoopbackBuffer: reader.LoopbackBufferDisk}
+	r := newTestReader(t, "TestLoopbackDisk", c)
+	r.Start()
+	assert.NoError(t, Publish("TestLoopbackDisk", []Data{{"a": "1"}, {"a": "2"}}))
+	assert.NoError(t, Publish("TestLoopbackDisk", []Data{{"a": "3"}}))
+	datas := readAll(r, 1)
+	assert.Equal(t, []Data{{"a": "1"}}, datas)
+	r.Close()
+
+	// 磁盘中的数据在重启后继续读取
+	r = newTestReader(t, "TestLoopbackDisk", c)
+	defer r.Close()
+	assert.Equal(t, []Data{{"a": "3"}}, readAll(r, 1))
+
+	_, err := NewReader(r.meta, conf.MapConf{reader.KeyLoopbackName: "x", reader.KeyLoopbackBuffer: "x"})
+	assert.Error(t, err)
+	_, err = NewReader(r.meta, conf.MapConf{})
+	assert.Error(t, err)
+}
@@ -3,12 +3,14 @@ package reader
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/json-iterator/go"
@@ -28,6 +30,7 @@ const (
 	bufFilePath       = "buf.dat"
 	lineCacheFilePath = "cache.dat"
 	statisticFileName = "statistic.meta"
+	subMetaListFile   = "submeta.list" // 非文件的 MetaStore 中记录 sub meta 的前缀，每行一个
 	doneFileRetention = "donefile_retention"
 	ftSaveLogPath     = "ft_log" // ft log 在 meta 中的文件夹名字
 )
@@ -59,6 +62,7 @@ type Meta struct {
 	encodingWay       string //文件编码格式，默认为utf-8
 	logpath           string
 	dataSourceTag     string                 //记录文件路径的标签名称
+	sourceMetaTag     string                 //记录文件路径、inode 和 offset 的标签名称
 	TagFile           string                 //记录tag文件路径的标签名称
 	tags              map[string]interface{} //记录tag文件内容
 	Readlimit         int                    //读取磁盘限速单位 MB/s
@@ -68,6 +72,10 @@ type Meta struct {
 	extrainfo         map[string]string
 
 	subMetas map[string]*Meta //对于tailx模式的情况会有嵌套的meta
+
+	store       MetaStore // 保存 offset、缓存等 checkpoint 信息
+	storePrefix string    // store 中 key 的前缀
+	subListMux  sync.Mutex
 }
 
 func getValidDir(dir string) (realPath string, err error) {
@@ -126,6 +134,7 @@ func NewMeta(metadir, filedonedir, logpath, mode, tagfile string, donefileRetent
 		tags:              tags,
 		Readlimit:         defaultIOLimit * 1024 * 1024,
 		subMetas:          make(map[string]*Meta),
+		store:             NewFileMetaStore(metadir),
 	}, nil
 }
 
@@ -166,6 +175,7 @@ func NewMetaWithConf(conf conf.MapConf) (meta *Meta, err error) {
 		log.Debugf("Runner[%v] Using %s as default metaPath", runnerName, metapath)
 	}
 	datasourceTag, _ := conf.GetStringOr(KeyDataSourceTag, "")
+	sourceMetaTag, _ := conf.GetStringOr(KeySourceMetaTag, "")
 	filedonepath, _ := conf.GetStringOr(KeyFileDone, metapath)
 	donefileRetention, _ := conf.GetIntOr(doneFileRetention, DefautFileRetention)
 	readlimit, _ := conf.GetIntOr(KeyReadIOLimit, defaultIOLimit)
@@ -174,6 +184,11 @@ func NewMetaWithConf(conf conf.MapConf) (meta *Meta, err error) {
 		log.Warnf("Runner[%v] %s - newMeta failed, err:%v", runnerName, metapath, err)
 		return
 	}
+	meta.store, meta.storePrefix, err = newMetaStoreWithConf(conf, meta.Dir, runnerName)
+	if err != nil {
+		log.Warnf("Runner[%v] %s - new meta store failed, err:%v", runnerName, metapath, err)
+		return nil, err
+	}
 	extrainfo, _ := conf.GetBoolOr(ExtraInfo, false)
 	if extrainfo {
 		meta.extrainfo = utilsos.GetExtraInfo()
@@ -185,6 +200,7 @@ func NewMetaWithConf(conf conf.MapConf) (meta *Meta, err error) {
 		meta.SetEncodingWay(strings.ToLower(decoder))
 	}
 	meta.dataSourceTag = datasourceTag
+	meta.sourceMetaTag = sourceMetaTag
 	meta.Readlimit = readlimit * 1024 * 1024 //readlimit*MB
 	meta.RunnerName = runnerName
 	return
@@ -205,6 +221,68 @@ func (m *Meta) RemoveSubMeta(key string) {
 	delete(m.subMetas, key)
 }
 
+// ShareStore 让 m 使用 parent 的 MetaStore，key 保存在 parent 的 sub 前缀下，用于 tailx 等嵌套的 meta
+func (m *Meta) ShareStore(parent *Meta, sub string) {
+	m.store = parent.metaStore()
+	m.storePrefix = path.Join(parent.storePrefix, sub)
+	if _, ok := m.store.(*FileMetaStore); !ok {
+		if err := parent.recordSubMeta(sub); err != nil {
+			log.Errorf("record sub meta %v to meta store %v error %v", sub, m.store.Name(), err)
+		}
+	}
+}
+
+// readSubMetas 返回记录在非文件的 MetaStore 中的 sub meta 前缀，文件的 MetaStore 直接遍历文件夹即可
+func (m *Meta) readSubMetas() ([]string, error) {
+	content, err := m.metaStore().Get(m.storeKey(subMetaListFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subs []string
+	for _, sub := range strings.Split(string(content), "\n") {
+		if sub = strings.TrimSpace(sub); sub != "" {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// recordSubMeta 把 sub meta 的前缀记录到 MetaStore 中，导出时据此找到 sub meta 的 key
+func (m *Meta) recordSubMeta(sub string) error {
+	m.subListMux.Lock()
+	defer m.subListMux.Unlock()
+	subs, err := m.readSubMetas()
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		if s == sub {
+			return nil
+		}
+	}
+	subs = append(subs, sub)
+	return m.metaStore().Put(m.storeKey(subMetaListFile), []byte(strings.Join(subs, "\n")+"\n"))
+}
+
+// Store 返回保存 checkpoint 信息的 MetaStore
+func (m *Meta) Store() MetaStore {
+	return m.metaStore()
+}
+
+func (m *Meta) metaStore() MetaStore {
+	if m.store == nil {
+		m.store = NewFileMetaStore(m.Dir)
+	}
+	return m.store
+}
+
+func (m *Meta) storeKey(name string) string {
+	return path.Join(m.storePrefix, name)
+}
+
 func (m *Meta) IsExist() bool {
 	return !m.IsNotExist()
 }
@@ -215,8 +293,7 @@ func (m *Meta) IsValid() bool {
 
 // IsNotExist meta 不存在，用来判断是第一次创建
 func (m *Meta) IsNotExist() bool {
-	path := m.MetaFile()
-	_, err := os.Stat(path)
+	_, err := m.metaStore().Get(m.storeKey(metaFileName))
 	return os.IsNotExist(err)
 }
 
@@ -237,96 +314,77 @@ func (m *Meta) Clear() error {
 		log.Errorf("Runner[%v] remove %v err %v", m.RunnerName, m.Dir, err)
 		return err
 	}
+	if _, ok := m.metaStore().(*FileMetaStore); !ok {
+		for _, name := range []string{metaFileName, bufMetaFilePath, bufFilePath, lineCacheFilePath, statisticFileName} {
+			if err = m.metaStore().Delete(m.storeKey(name)); err != nil {
+				log.Errorf("Runner[%v] delete %v from meta store %v err %v", m.RunnerName, name, m.metaStore().Name(), err)
+				return err
+			}
+		}
+	}
 	return os.MkdirAll(m.Dir, DefaultDirPerm)
 }
 
+// ResetOffset 只清除读取进度和缓存，保留 done 文件，用于文件轮转后路径上的新文件从头开始读取，
+// 已经读完的文件仍然可以被 cleaner 清理
+func (m *Meta) ResetOffset() error {
+	for _, name := range []string{metaFileName, bufMetaFilePath, bufFilePath, lineCacheFilePath} {
+		if err := m.metaStore().Delete(m.storeKey(name)); err != nil {
+			log.Errorf("Runner[%v] delete %v from meta store %v err %v", m.RunnerName, name, m.metaStore().Name(), err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Meta) CacheLineFile() string {
 	return m.lineCacheFile
 }
 
 func (m *Meta) ReadCacheLine() ([]byte, error) {
-	return ioutil.ReadFile(m.CacheLineFile())
+	return m.metaStore().Get(m.storeKey(lineCacheFilePath))
 }
 
 func (m *Meta) WriteCacheLine(lines string) error {
-	return ioutil.WriteFile(m.CacheLineFile(), []byte(lines), DefaultFilePerm)
+	return m.metaStore().Put(m.storeKey(lineCacheFilePath), []byte(lines))
 }
 
 func (m *Meta) ReadBufMeta() (r, w, bufsize int, err error) {
-	f, err := os.Open(m.BufMetaFile())
+	data, err := m.metaStore().Get(m.storeKey(bufMetaFilePath))
 	if err != nil {
 		return
 	}
-	defer f.Close()
-	_, err = fmt.Fscanf(f, bufMetaFormat, &r, &w, &bufsize)
+	_, err = fmt.Sscanf(string(data), bufMetaFormat, &r, &w, &bufsize)
 	return
 }
 
 func (m *Meta) ReadBuf(buf []byte) (n int, err error) {
-	f, err := os.Open(m.BufFile())
+	data, err := m.metaStore().Get(m.storeKey(bufFilePath))
 	if err != nil {
 		return
 	}
-	defer f.Close()
-	return f.Read(buf)
+	if len(data) == 0 && len(buf) > 0 {
+		return 0, io.EOF
+	}
+	return copy(buf, data), nil
 }
 
 func (m *Meta) WriteBuf(buf []byte, r, w, bufsize int) (err error) {
-	var f *os.File
-	bufMetaFileName := m.BufMetaFile()
-	bufFileName := m.BufFile()
-
-	tmpBufMetaFileName := fmt.Sprintf("%s.%d.tmp", bufMetaFileName, rand.Int())
-	tmpBufFileName := fmt.Sprintf("%s.%d.tmp", bufFileName, rand.Int())
-
-	defer func() {
-		os.RemoveAll(tmpBufMetaFileName)
-		os.RemoveAll(tmpBufFileName)
-	}()
-
-	// write to tmp file
-	f, err = os.OpenFile(tmpBufMetaFileName, os.O_RDWR|os.O_CREATE, DefaultFilePerm)
-	if err != nil {
-		return
-	}
-	_, err = fmt.Fprintf(f, bufMetaFormat, r, w, bufsize)
-	if err != nil {
-		f.Close()
-		return
-	}
-	f.Sync()
-	f.Close()
-
-	// write to tmp file
-	f, err = os.OpenFile(tmpBufFileName, os.O_RDWR|os.O_CREATE, DefaultFilePerm)
-	if err != nil {
-		return
-	}
-
-	_, err = f.Write(buf)
+	err = m.metaStore().Put(m.storeKey(bufMetaFilePath), []byte(fmt.Sprintf(bufMetaFormat, r, w, bufsize)))
 	if err != nil {
-		f.Close()
 		return
 	}
-	f.Sync()
-	f.Close()
-
-	err = os.Rename(tmpBufMetaFileName, bufMetaFileName)
-	if err != nil {
-		return
-	}
-	return os.Rename(tmpBufFileName, bufFileName)
+	return m.metaStore().Put(m.storeKey(bufFilePath), buf)
 }
 
 // ReadOffset 读取当前读取的文件和offset
 func (m *Meta) ReadOffset() (currFile string, offset int64, err error) {
-	f, err := os.Open(m.MetaFile())
+	data, err := m.metaStore().Get(m.storeKey(metaFileName))
 	if err != nil {
 		return
 	}
-	defer f.Close()
 
-	_, err = fmt.Fscanf(f, metaFormat, &currFile, &offset)
+	_, err = fmt.Sscanf(string(data), metaFormat, &currFile, &offset)
 	if err != nil {
 		log.Debugf("meta file format err %v", err)
 		return
@@ -376,24 +434,17 @@ func (m *Meta) ReadRecordsFile(recordsFile string) ([]string, error) {
 
 // WriteOffset 将当前文件和offset写入meta中
 func (m *Meta) WriteOffset(currFile string, offset int64) (err error) {
-	var f *os.File
-	fileName := m.MetaFile()
-	tmpFileName := fmt.Sprintf("%s.%d.tmp", fileName, rand.Int())
+	return m.metaStore().Put(m.storeKey(metaFileName), []byte(fmt.Sprintf(metaFormat, currFile, offset)))
+}
 
-	// write to tmp file
-	f, err = os.OpenFile(tmpFileName, os.O_RDWR|os.O_CREATE, DefaultFilePerm)
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintf(f, metaFormat, currFile, offset)
-	if err != nil {
-		f.Close()
-		return err
-	}
-	f.Sync()
-	f.Close()
+// ReadValue 读取 reader 自己保存的读取进度，如 windows 事件日志的 bookmark，不存在时返回的 error 满足 os.IsNotExist
+func (m *Meta) ReadValue(name string) ([]byte, error) {
+	return m.metaStore().Get(m.storeKey(name))
+}
 
-	return os.Rename(tmpFileName, fileName)
+// WriteValue 保存 reader 自己的读取进度，内容无法用 WriteOffset 的 文件名+offset 格式表示时使用
+func (m *Meta) WriteValue(name string, value []byte) error {
+	return m.metaStore().Put(m.storeKey(name), value)
 }
 
 // AppendDoneFile 将处理完的文件写入doneFile中
@@ -606,6 +657,10 @@ func (m *Meta) GetDataSourceTag() string {
 	return m.dataSourceTag
 }
 
+func (m *Meta) GetSourceMetaTag() string {
+	return m.sourceMetaTag
+}
+
 func (m *Meta) GetTagFile() string {
 	return m.TagFile
 }
@@ -618,10 +673,10 @@ func (m *Meta) Reset() error {
 	if m == nil {
 		return errors.New("Reset error as meta is nil")
 	}
-	if err := os.RemoveAll(m.statisticPath); err != nil {
+	if err := m.metaStore().Delete(m.storeKey(statisticFileName)); err != nil {
 		return err
 	}
-	if err := os.RemoveAll(m.metaFilePath); err != nil {
+	if err := m.metaStore().Delete(m.storeKey(metaFileName)); err != nil {
 		return err
 	}
 	// DoneFilePath 默认为 meta 文件夹，不能直接删除
@@ -652,7 +707,7 @@ func (m *Meta) Reset() error {
 }
 
 func (m *Meta) ReadStatistic() (stat Statistic, err error) {
-	statData, err := ioutil.ReadFile(m.StatisticFile())
+	statData, err := m.metaStore().Get(m.storeKey(statisticFileName))
 	if statData == nil || err != nil {
 		return
 	}
@@ -665,7 +720,7 @@ func (m *Meta) WriteStatistic(stat *Statistic) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(m.StatisticFile(), statStr, DefaultFilePerm)
+	return m.metaStore().Put(m.storeKey(statisticFileName), statStr)
 }
 
 func (m *Meta) ExtraInfo() map[string]string {
@@ -0,0 +1,186 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// MetaSnapshot 是 meta 中所有读取进度的快照，可以在另一台机器上导入，用于迁移 runner
+type MetaSnapshot struct {
+	RunnerName string    `json:"runner_name"`
+	Mode       string    `json:"mode"`
+	LogPath    string    `json:"logpath"`
+	ExportTime time.Time `json:"export_time"`
+	// Store 是 MetaStore 中的内容，key 为去掉 runner 前缀后的相对路径，包括 tailx 等嵌套的 sub meta
+	Store map[string][]byte `json:"store"`
+	// DoneFiles 是 done 文件夹下记录已经读取完成的文件，key 为文件名
+	DoneFiles map[string][]byte `json:"done_files,omitempty"`
+}
+
+// storeFileNames 是 meta 写入 MetaStore 的固定的 key，非文件的 MetaStore 无法列出所有 key，只导出这些
+var storeFileNames = []string{metaFileName, bufMetaFilePath, bufFilePath, lineCacheFilePath, statisticFileName, headerLineFile, subMetaListFile}
+
+// Export 导出 meta 中的读取进度，ft sender 的缓存队列不属于读取进度，不会导出
+func (m *Meta) Export() (*MetaSnapshot, error) {
+	snapshot := &MetaSnapshot{
+		RunnerName: m.RunnerName,
+		Mode:       m.mode,
+		LogPath:    m.logpath,
+		ExportTime: time.Now(),
+		Store:      make(map[string][]byte),
+		DoneFiles:  make(map[string][]byte),
+	}
+	var err error
+	if _, ok := m.metaStore().(*FileMetaStore); ok {
+		err = m.exportDir(snapshot)
+	} else {
+		err = m.exportStore(snapshot, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(m.DoneFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !isDoneFileName(f.Name()) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(m.DoneFilePath, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.DoneFiles[f.Name()] = content
+	}
+	return snapshot, nil
+}
+
+// exportDir 导出 meta 文件夹下的所有文件，文件的相对路径就是 FileMetaStore 中的 key
+func (m *Meta) exportDir(snapshot *MetaSnapshot) error {
+	return filepath.Walk(m.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(m.Dir, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p == m.ftSaveLogPath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(rel, ".tmp") {
+			return nil
+		}
+		if filepath.Dir(p) == filepath.Clean(m.DoneFilePath) && isDoneFileName(info.Name()) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		snapshot.Store[filepath.ToSlash(rel)] = content
+		return nil
+	})
+}
+
+// exportStore 从非文件的 MetaStore 中导出固定的 key，sub 为 sub meta 相对于最上层 meta 的前缀，
+// sub meta 从 MetaStore 中记录的前缀列出，导出时 reader 不需要在运行
+func (m *Meta) exportStore(snapshot *MetaSnapshot, sub string) error {
+	for _, name := range storeFileNames {
+		content, err := m.metaStore().Get(m.storeKey(name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		snapshot.Store[path.Join(sub, name)] = content
+	}
+	subs, err := m.readSubMetas()
+	if err != nil {
+		return err
+	}
+	for _, key := range subs {
+		sm := &Meta{store: m.metaStore(), storePrefix: m.storeKey(key)}
+		if err := sm.exportStore(snapshot, path.Join(sub, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import 把 Export 导出的读取进度写入 meta，已经存在的同名 key 会被覆盖，
+// 导入时 runner 需要处于停止状态，否则 reader 会用内存中的进度覆盖导入的内容
+func (m *Meta) Import(snapshot *MetaSnapshot) error {
+	if snapshot == nil {
+		return errors.New("meta snapshot is empty")
+	}
+	if snapshot.Mode != "" && m.mode != "" && snapshot.Mode != m.mode {
+		return fmt.Errorf("meta snapshot of mode %v can not be imported to reader of mode %v", snapshot.Mode, m.mode)
+	}
+	for key := range snapshot.Store {
+		if !validSnapshotKey(key) {
+			return fmt.Errorf("invalid key %q in meta snapshot", key)
+		}
+	}
+	for name := range snapshot.DoneFiles {
+		if !isDoneFileName(name) || filepath.Base(name) != name {
+			return fmt.Errorf("invalid done file %q in meta snapshot", name)
+		}
+	}
+
+	_, isFileStore := m.metaStore().(*FileMetaStore)
+	for key, content := range snapshot.Store {
+		if isFileStore {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(m.Dir, filepath.FromSlash(key))), DefaultDirPerm); err != nil {
+				return err
+			}
+		}
+		if err := m.metaStore().Put(m.storeKey(key), content); err != nil {
+			return fmt.Errorf("import %v to meta store %v error %v", key, m.metaStore().Name(), err)
+		}
+		// 从文件的 MetaStore 导出的快照中没有 sub meta 的记录，导入到非文件的 MetaStore 时补上，之后才能再次导出
+		if sub := path.Dir(key); !isFileStore && sub != "." && path.Base(key) != subMetaListFile {
+			if err := m.recordSubMeta(sub); err != nil {
+				return fmt.Errorf("import sub meta %v to meta store %v error %v", sub, m.metaStore().Name(), err)
+			}
+		}
+	}
+	if len(snapshot.DoneFiles) > 0 {
+		if err := os.MkdirAll(m.DoneFilePath, DefaultDirPerm); err != nil {
+			return err
+		}
+	}
+	for name, content := range snapshot.DoneFiles {
+		if err := ioutil.WriteFile(filepath.Join(m.DoneFilePath, name), content, DefaultFilePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isDoneFileName(name string) bool {
+	return strings.HasPrefix(name, DoneFileName) || strings.HasPrefix(name, deletedFileName)
+}
+
+// validSnapshotKey 检查 key 是否为不会跳出 meta 文件夹的相对路径
+func validSnapshotKey(key string) bool {
+	if key == "" || path.IsAbs(key) || strings.Contains(key, `\`) {
+		return false
+	}
+	clean := path.Clean(key)
+	return clean == key && clean != "." && clean != ".." && !strings.HasPrefix(clean, "../")
+}
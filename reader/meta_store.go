@@ -0,0 +1,127 @@
+package reader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// MetaStore 保存 reader 的 offset、缓存等 checkpoint 信息，默认保存在本地 meta 文件夹中，
+// 也可以保存在 Redis、etcd 中，使无状态的容器或者主备部署的 logkit 可以共享读取进度
+type MetaStore interface {
+	Name() string
+	// Get 读取 key 对应的内容，key 不存在时返回的 error 满足 os.IsNotExist
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	// Delete 删除 key，key 不存在时不返回错误
+	Delete(key string) error
+}
+
+// meta store 的 conf 字段
+const (
+	KeyMetaStore         = "meta_store"
+	KeyMetaStoreAddress  = "meta_store_address"
+	KeyMetaStorePassword = "meta_store_password"
+	KeyMetaStoreRedisDB  = "meta_store_redis_db"
+	KeyMetaStorePrefix   = "meta_store_prefix"
+	KeyMetaStoreTimeout  = "meta_store_timeout"
+)
+
+// KeyMetaStore 的可选项
+const (
+	MetaStoreFile  = "file"
+	MetaStoreRedis = "redis"
+	MetaStoreEtcd  = "etcd"
+)
+
+const (
+	defaultMetaStorePrefix  = "logkit"
+	defaultMetaStoreTimeout = 5 * time.Second
+)
+
+// newMetaStoreWithConf 根据配置创建 MetaStore，返回的 prefix 用于区分不同 runner 的 key
+func newMetaStoreWithConf(c conf.MapConf, metaDir, runnerName string) (store MetaStore, prefix string, err error) {
+	storeType, _ := c.GetStringOr(KeyMetaStore, MetaStoreFile)
+	if storeType == MetaStoreFile {
+		return NewFileMetaStore(metaDir), "", nil
+	}
+	address, err := c.GetString(KeyMetaStoreAddress)
+	if err != nil {
+		return nil, "", err
+	}
+	timeout, _ := c.GetStringOr(KeyMetaStoreTimeout, defaultMetaStoreTimeout.String())
+	dur, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse %v %v error %v", KeyMetaStoreTimeout, timeout, err)
+	}
+	prefix, _ = c.GetStringOr(KeyMetaStorePrefix, defaultMetaStorePrefix)
+	prefix = path.Join(prefix, runnerName)
+	switch storeType {
+	case MetaStoreRedis:
+		password, _ := c.GetStringOr(KeyMetaStorePassword, "")
+		db, _ := c.GetIntOr(KeyMetaStoreRedisDB, 0)
+		store = NewRedisMetaStore(address, password, db, dur)
+	case MetaStoreEtcd:
+		endpoints, _ := c.GetStringList(KeyMetaStoreAddress)
+		store, err = NewEtcdMetaStore(endpoints, dur)
+	default:
+		err = fmt.Errorf("meta store type unsupported: %v", storeType)
+	}
+	return
+}
+
+// FileMetaStore 把 key 作为 dir 下的相对路径保存，与之前 meta 文件夹的布局一致
+type FileMetaStore struct {
+	dir string
+}
+
+func NewFileMetaStore(dir string) *FileMetaStore {
+	return &FileMetaStore{dir: dir}
+}
+
+func (s *FileMetaStore) Name() string {
+	return MetaStoreFile + ":" + s.dir
+}
+
+func (s *FileMetaStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *FileMetaStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(key))
+}
+
+// Put 先写入临时文件再 rename，避免进程退出时留下不完整的 meta
+func (s *FileMetaStore) Put(key string, value []byte) (err error) {
+	fileName := s.path(key)
+	tmpFileName := fmt.Sprintf("%s.%d.tmp", fileName, rand.Int())
+	defer os.RemoveAll(tmpFileName)
+
+	f, err := os.OpenFile(tmpFileName, os.O_RDWR|os.O_CREATE, DefaultFilePerm)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if err != nil {
+		f.Close()
+		return
+	}
+	f.Sync()
+	f.Close()
+	return os.Rename(tmpFileName, fileName)
+}
+
+func (s *FileMetaStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
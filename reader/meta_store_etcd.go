@@ -0,0 +1,110 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+)
+
+// EtcdMetaStore 通过 etcd v3 的 HTTP 网关(grpc-gateway)读写 meta，不依赖 etcd 的 grpc 客户端，
+// 配置多个 endpoint 时按顺序尝试，直到有一个请求成功
+type EtcdMetaStore struct {
+	endpoints []string
+	client    *http.Client
+}
+
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Kvs []etcdKeyValue `json:"kvs"`
+}
+
+func NewEtcdMetaStore(endpoints []string, timeout time.Duration) (*EtcdMetaStore, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("etcd meta store endpoints is empty")
+	}
+	eps := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		if !strings.HasPrefix(ep, "http://") && !strings.HasPrefix(ep, "https://") {
+			ep = "http://" + ep
+		}
+		eps[i] = strings.TrimSuffix(ep, "/")
+	}
+	return &EtcdMetaStore{
+		endpoints: eps,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (s *EtcdMetaStore) Name() string {
+	return MetaStoreEtcd + ":" + strings.Join(s.endpoints, ",")
+}
+
+func (s *EtcdMetaStore) Get(key string) ([]byte, error) {
+	var resp etcdRangeResponse
+	if err := s.call("/v3/kv/range", etcdKeyValue{Key: encodeEtcd([]byte(key))}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+}
+
+func (s *EtcdMetaStore) Put(key string, value []byte) error {
+	return s.call("/v3/kv/put", etcdKeyValue{Key: encodeEtcd([]byte(key)), Value: encodeEtcd(value)}, nil)
+}
+
+func (s *EtcdMetaStore) Delete(key string) error {
+	return s.call("/v3/kv/deleterange", etcdKeyValue{Key: encodeEtcd([]byte(key))}, nil)
+}
+
+func (s *EtcdMetaStore) call(api string, req interface{}, resp interface{}) (err error) {
+	body, err := jsoniter.Marshal(req)
+	if err != nil {
+		return err
+	}
+	for _, ep := range s.endpoints {
+		var data []byte
+		data, err = s.post(ep+api, body)
+		if err != nil {
+			continue
+		}
+		if resp == nil {
+			return nil
+		}
+		return jsoniter.Unmarshal(data, resp)
+	}
+	return err
+}
+
+func (s *EtcdMetaStore) post(url string, body []byte) ([]byte, error) {
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("etcd %v return status %v: %s", url, resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+func encodeEtcd(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
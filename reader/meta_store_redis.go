@@ -0,0 +1,48 @@
+package reader
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisMetaStore 把 meta 保存在 Redis 的字符串 key 中
+type RedisMetaStore struct {
+	address string
+	client  *redis.Client
+}
+
+func NewRedisMetaStore(address, password string, db int, timeout time.Duration) *RedisMetaStore {
+	return &RedisMetaStore{
+		address: address,
+		client: redis.NewClient(&redis.Options{
+			Addr:         address,
+			Password:     password,
+			DB:           db,
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		}),
+	}
+}
+
+func (s *RedisMetaStore) Name() string {
+	return MetaStoreRedis + ":" + s.address
+}
+
+func (s *RedisMetaStore) Get(key string) ([]byte, error) {
+	value, err := s.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, os.ErrNotExist
+	}
+	return value, err
+}
+
+func (s *RedisMetaStore) Put(key string, value []byte) error {
+	return s.client.Set(key, value, 0).Err()
+}
+
+func (s *RedisMetaStore) Delete(key string) error {
+	return s.client.Del(key).Err()
+}
@@ -0,0 +1,180 @@
+package reader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// fakeEtcd 模拟 etcd v3 HTTP 网关的 kv 接口
+type fakeEtcd struct {
+	mutex sync.Mutex
+	kvs   map[string]string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req etcdKeyValue
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case "/v3/kv/put":
+		f.kvs[req.Key] = req.Value
+	case "/v3/kv/deleterange":
+		delete(f.kvs, req.Key)
+	case "/v3/kv/range":
+		resp := etcdRangeResponse{}
+		if v, ok := f.kvs[req.Key]; ok {
+			resp.Kvs = append(resp.Kvs, etcdKeyValue{Key: req.Key, Value: v})
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func (f *fakeEtcd) keys() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var keys []string
+	for k := range f.kvs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func testMetaStore(t *testing.T, store MetaStore) {
+	_, err := store.Get("a/file.meta")
+	assert.True(t, os.IsNotExist(err), store.Name())
+	assert.NoError(t, store.Put("a/file.meta", []byte("content")))
+	value, err := store.Get("a/file.meta")
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(value))
+	assert.NoError(t, store.Delete("a/file.meta"))
+	assert.NoError(t, store.Delete("a/file.meta"))
+	_, err = store.Get("a/file.meta")
+	assert.True(t, os.IsNotExist(err), store.Name())
+}
+
+func TestFileMetaStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestFileMetaStore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "a"), 0755))
+	testMetaStore(t, NewFileMetaStore(dir))
+}
+
+func TestEtcdMetaStore(t *testing.T) {
+	etcd := &fakeEtcd{kvs: map[string]string{}}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	_, err := NewEtcdMetaStore(nil, 0)
+	assert.Error(t, err)
+	// 第一个地址不可用时使用下一个地址
+	store, err := NewEtcdMetaStore([]string{"127.0.0.1:1", strings.TrimPrefix(server.URL, "http://")}, 0)
+	assert.NoError(t, err)
+	testMetaStore(t, store)
+}
+
+func TestMetaWithEtcdStore(t *testing.T) {
+	etcd := &fakeEtcd{kvs: map[string]string{}}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "TestMetaWithEtcdStore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte("a\n"), 0644))
+
+	c := conf.MapConf{
+		KeyLogPath:          logPath,
+		KeyMetaPath:         filepath.Join(dir, "meta"),
+		KeyMode:             ModeFile,
+		KeyRunnerName:       "runner1",
+		KeyMetaStore:        MetaStoreEtcd,
+		KeyMetaStoreAddress: server.URL,
+	}
+	meta, err := NewMetaWithConf(c)
+	assert.NoError(t, err)
+	assert.True(t, meta.IsNotExist())
+	assert.NoError(t, meta.WriteOffset(logPath, 2))
+	assert.NoError(t, meta.WriteBuf([]byte("abc"), 1, 3, 3))
+	assert.False(t, meta.IsNotExist())
+	// 本地 meta 文件夹中没有 checkpoint 信息
+	_, err = os.Stat(meta.MetaFile())
+	assert.True(t, os.IsNotExist(err))
+
+	// 另一个相同配置的 logkit 可以读到进度
+	other, err := NewMetaWithConf(c)
+	assert.NoError(t, err)
+	file, offset, err := other.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, logPath, file)
+	assert.Equal(t, int64(2), offset)
+	r, w, size, err := other.ReadBufMeta()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3, 3}, []int{r, w, size})
+	buf := make([]byte, size)
+	_, err = other.ReadBuf(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(buf))
+
+	sub, err := NewMeta(filepath.Join(dir, "meta", "sub"), filepath.Join(dir, "meta", "sub"), logPath, ModeFile, "", DefautFileRetention)
+	assert.NoError(t, err)
+	sub.ShareStore(meta, "sub")
+	assert.NoError(t, sub.WriteCacheLine("line"))
+	assert.Len(t, etcd.keys(), 5)
+	_, err = other.store.Get("logkit/runner1/sub/cache.dat")
+	assert.NoError(t, err)
+
+	// 新创建的 meta 没有 sub meta，从 MetaStore 中记录的前缀导出 sub meta
+	snapshot, err := other.Export()
+	assert.NoError(t, err)
+	assert.Equal(t, "line", string(snapshot.Store["sub/"+lineCacheFilePath]))
+	assert.Equal(t, "abc", string(snapshot.Store[bufFilePath]))
+	fileDir := filepath.Join(dir, "file")
+	fileMeta, err := NewMeta(fileDir, fileDir, logPath, ModeFile, "", DefautFileRetention)
+	assert.NoError(t, err)
+	assert.NoError(t, fileMeta.Import(snapshot))
+	fileSnapshot, err := fileMeta.Export()
+	assert.NoError(t, err)
+	delete(fileSnapshot.Store, subMetaListFile)
+
+	// 从文件的 MetaStore 导出的快照导入后也可以再导出 sub meta
+	c[KeyRunnerName] = "runner2"
+	imported, err := NewMetaWithConf(c)
+	assert.NoError(t, err)
+	assert.NoError(t, imported.Import(fileSnapshot))
+	snapshot, err = imported.Export()
+	assert.NoError(t, err)
+	assert.Equal(t, "line", string(snapshot.Store["sub/"+lineCacheFilePath]))
+	assert.NoError(t, imported.Clear())
+	c[KeyRunnerName] = "runner1"
+
+	assert.NoError(t, other.Clear())
+	assert.True(t, meta.IsNotExist())
+	// sub meta 的 key 以及记录的前缀不会被清除
+	assert.Len(t, etcd.keys(), 4)
+
+	c[KeyMetaStore] = "zookeeper"
+	_, err = NewMetaWithConf(c)
+	assert.Error(t, err)
+}
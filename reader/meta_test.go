@@ -1,7 +1,9 @@
 package reader
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -243,3 +245,49 @@ func Test_GetLogFiles2(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMetaExportImport(t *testing.T) {
+	srcDir, dstDir := filepath.Join(MetaDir, "src"), filepath.Join(MetaDir, "dst")
+	defer os.RemoveAll(MetaDir)
+	src, err := NewMeta(srcDir, srcDir, "/var/log/app.log", ModeTailx, "", 7)
+	assert.NoError(t, err)
+	assert.NoError(t, src.WriteOffset("/var/log/app.log", 100))
+	sub, err := NewMeta(filepath.Join(srcDir, "sub"), filepath.Join(srcDir, "sub"), "/var/log/app.log", ModeFile, "", 7)
+	assert.NoError(t, err)
+	sub.ShareStore(src, "sub")
+	assert.NoError(t, sub.WriteOffset("/var/log/app.log", 200))
+	assert.NoError(t, ioutil.WriteFile(src.DoneFile(), []byte("/var/log/app.log.1\n"), DefaultFilePerm))
+
+	snapshot, err := src.Export()
+	assert.NoError(t, err)
+	assert.Equal(t, ModeTailx, snapshot.Mode)
+	assert.Contains(t, snapshot.Store, metaFileName)
+	assert.Contains(t, snapshot.Store, "sub/"+metaFileName)
+	assert.NotContains(t, snapshot.Store, filepath.Base(src.DoneFile()))
+	assert.Equal(t, 1, len(snapshot.DoneFiles))
+
+	data, err := json.Marshal(snapshot)
+	assert.NoError(t, err)
+	var imported MetaSnapshot
+	assert.NoError(t, json.Unmarshal(data, &imported))
+
+	dst, err := NewMeta(dstDir, dstDir, "/var/log/app.log", ModeTailx, "", 7)
+	assert.NoError(t, err)
+	assert.NoError(t, dst.Import(&imported))
+	file, offset, err := dst.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/log/app.log", file)
+	assert.Equal(t, int64(100), offset)
+	subOffset, err := ioutil.ReadFile(filepath.Join(dstDir, "sub", metaFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/log/app.log\t200\n", string(subOffset))
+	done, err := ioutil.ReadFile(filepath.Join(dstDir, filepath.Base(src.DoneFile())))
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/log/app.log.1\n", string(done))
+
+	fileMeta, err := NewMeta(filepath.Join(MetaDir, "file"), filepath.Join(MetaDir, "file"), "/var/log/app.log", ModeFile, "", 7)
+	assert.NoError(t, err)
+	assert.Error(t, fileMeta.Import(&imported))
+	assert.Error(t, dst.Import(&MetaSnapshot{Store: map[string][]byte{"../escape": nil}}))
+	assert.Error(t, dst.Import(&MetaSnapshot{DoneFiles: map[string][]byte{"other": nil}}))
+}
@@ -31,6 +31,14 @@ func init() {
 	reader.RegisterConstructor(reader.ModeMongo, NewReader)
 }
 
+// document 是读取到的一条 mongo 文档以及它的 bson 字节数
+type document struct {
+	data  bson.M
+	bytes int64
+}
+
+var _ reader.StructuredReader = &Reader{}
+
 type Reader struct {
 	host              string
 	database          string
@@ -42,7 +50,7 @@ type Reader struct {
 	Cron         *cron.Cron //定时任务
 	loop         bool
 	loopDuration time.Duration
-	readChan     chan []byte //bson
+	readChan     chan document
 	errChan      chan error
 	meta         *reader.Meta // 记录offset的元数据
 	session      *mgo.Session
@@ -95,7 +103,7 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (mr reader.Reader, err erro
 		collectionFilters: map[string]CollectionFilter{},
 		Cron:              cron.New(),
 		status:            reader.StatusInit,
-		readChan:          make(chan []byte),
+		readChan:          make(chan document),
 		errChan:           make(chan error),
 		execOnStart:       execOnStart,
 		started:           false,
@@ -205,13 +213,34 @@ func (mr *Reader) LoopRun() {
 }
 
 func (mr *Reader) ReadLine() (data string, err error) {
+	doc, err := mr.readDocument()
+	if err != nil || doc.data == nil {
+		return "", err
+	}
+	bytes, err := jsoniter.Marshal(doc.data)
+	if err != nil {
+		log.Errorf("Runner[%v] %v json marshal inner error %v", mr.meta.RunnerName, doc.data, err)
+		return "", nil
+	}
+	return string(bytes), nil
+}
+
+// ReadStructured 直接返回读取到的文档, 除了数字保留原始的类型外, 与 ReadLine 序列化后再经 json parser 解析的结果一致
+func (mr *Reader) ReadStructured() (Data, int64, error) {
+	doc, err := mr.readDocument()
+	if err != nil || doc.data == nil {
+		return nil, 0, err
+	}
+	return Data(convertBsonMap(doc.data)), doc.bytes, nil
+}
+
+func (mr *Reader) readDocument() (doc document, err error) {
 	if !mr.started {
 		mr.Start()
 	}
 	timer := time.NewTimer(time.Second)
 	select {
-	case dat := <-mr.readChan:
-		data = string(dat)
+	case doc = <-mr.readChan:
 	case err = <-mr.errChan:
 	case <-timer.C:
 	}
@@ -219,6 +248,35 @@ func (mr *Reader) ReadLine() (data string, err error) {
 	return
 }
 
+// convertBsonMap 把 bson 文档转为 JSON 序列化后的形式: ObjectId 转为 hex 字符串, 时间转为 RFC3339 格式的字符串
+func convertBsonMap(m bson.M) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[k] = convertBsonValue(v)
+	}
+	return ret
+}
+
+func convertBsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case bson.M:
+		return convertBsonMap(val)
+	case map[string]interface{}:
+		return convertBsonMap(bson.M(val))
+	case []interface{}:
+		ret := make([]interface{}, len(val))
+		for i := range val {
+			ret[i] = convertBsonValue(val[i])
+		}
+		return ret
+	case bson.ObjectId:
+		return val.Hex()
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
 func (mr *Reader) run() {
 	var err error
 	// 防止并发run
@@ -311,21 +369,21 @@ func (mr *Reader) exec() (err error) {
 
 	iter := mr.catQuery(mr.collection, mr.offset, mr.session).Iter()
 
-	var result bson.M
-	for iter.Next(&result) {
+	var raw bson.Raw
+	for iter.Next(&raw) {
 		if atomic.LoadInt32(&mr.status) == reader.StatusStopping {
 			log.Warnf("Runner[%v] %v stopped from running", mr.meta.RunnerName, mr.Name())
 			return nil
 		}
+		result := bson.M{}
+		if ierr := raw.Unmarshal(&result); ierr != nil {
+			log.Errorf("Runner[%v] %v bson unmarshal error %v", mr.meta.RunnerName, mr.Name(), ierr)
+			continue
+		}
 		if id, ok := result[mr.offsetkey]; ok {
 			mr.offset = id
 		}
-		bytes, ierr := jsoniter.Marshal(result)
-		if ierr != nil {
-			log.Errorf("Runner[%v] %v json marshal inner error %v", mr.meta.RunnerName, result, ierr)
-		}
-		mr.readChan <- bytes
-		result = bson.M{}
+		mr.readChan <- document{data: result, bytes: int64(len(raw.Data))}
 	}
 	if err := iter.Err(); err != nil {
 		return err
@@ -3,6 +3,7 @@ package mongo
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/mgo.v2/bson"
@@ -33,7 +34,7 @@ func TestMongoReader(t *testing.T) {
 
 		collectionFilters: map[string]CollectionFilter{},
 		status:            reader.StatusInit,
-		readChan:          make(chan []byte),
+		readChan:          make(chan document),
 	}
 	assert.EqualValues(t, "MongoReader:127.0.0.1:12701_testdb_coll", er.Name())
 	er.SyncMeta()
@@ -51,3 +52,39 @@ func TestMongoReader(t *testing.T) {
 
 	assert.Equal(t, StatsInfo{}, er.Status())
 }
+
+func TestMongoReadStructured(t *testing.T) {
+	id := bson.ObjectIdHex("5b0e4c3a8d6f4a3b2c1d0e9f")
+	ts := time.Date(2018, 5, 30, 8, 0, 0, 0, time.UTC)
+	er := &Reader{
+		meta:     &reader.Meta{RunnerName: "TestMongoReadStructured"},
+		started:  true,
+		readChan: make(chan document, 1),
+		errChan:  make(chan error),
+	}
+	doc := bson.M{
+		"_id":  id,
+		"name": "logkit",
+		"at":   ts,
+		"tags": []interface{}{"a", bson.M{"ref": id}},
+		"size": 10,
+	}
+	er.readChan <- document{data: doc, bytes: 100}
+
+	data, bytes, err := er.ReadStructured()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), bytes)
+	assert.Equal(t, Data{
+		"_id":  id.Hex(),
+		"name": "logkit",
+		"at":   "2018-05-30T08:00:00Z",
+		"tags": []interface{}{"a", map[string]interface{}{"ref": id.Hex()}},
+		"size": 10,
+	}, data)
+
+	// 没有数据时超时返回空
+	data, bytes, err = er.ReadStructured()
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.Equal(t, int64(0), bytes)
+}
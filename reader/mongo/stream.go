@@ -0,0 +1,528 @@
+package mongo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/utils"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// positionFile 是 meta 中保存 change stream 的 resume token 或者 oplog 时间戳的文件名
+	positionFile = "mongo.stream"
+	// awaitTime 是每次 getMore 或者 oplog tailable cursor 等待新数据的最长时间
+	awaitTime      = time.Second
+	socketTimeout  = 30 * time.Second
+	reconnectDelay = 3 * time.Second
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeMongoStream, NewStreamReader)
+}
+
+// position 是读取到的位置，change stream 记录 resume token，oplog 记录最后一条的 ts
+type position struct {
+	Namespace   string `json:"ns"`
+	ResumeToken []byte `json:"resume_token,omitempty"`
+	Timestamp   int64  `json:"ts,omitempty"`
+}
+
+// event 是一条变更事件以及读取到这条事件后的位置
+type event struct {
+	data  bson.M
+	bytes int64
+	pos   position
+}
+
+var _ reader.StructuredReader = &StreamReader{}
+
+// StreamReader 通过 change stream (MongoDB 3.6 及以上) 或者 tail oplog 读取 collection 的变更，
+// 读取的位置在 SyncMeta 时保存，重启后从上次的位置继续读取，每个变更只读取一次
+type StreamReader struct {
+	meta         *reader.Meta
+	host         string
+	database     string
+	collection   string
+	streamType   string
+	updateLookup bool
+	batchSize    int
+
+	status   int32
+	readChan chan event
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mux sync.Mutex
+	// pos 是 SyncMeta 时需要保存的位置，synced 是最后一次保存的位置
+	pos    position
+	synced position
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewStreamReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
+	database, err := conf.GetString(reader.KeyMongoDatabase)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := conf.GetString(reader.KeyMongoCollection)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := conf.GetStringOr(reader.KeyMongoHost, "localhost:27017")
+	streamType, _ := conf.GetStringOr(reader.KeyMongoStreamType, reader.MongoStreamAuto)
+	switch streamType {
+	case reader.MongoStreamAuto, reader.MongoStreamChangeStream, reader.MongoStreamOplog:
+	default:
+		return nil, fmt.Errorf("%v %q not supported, should be %v, %v or %v", reader.KeyMongoStreamType, streamType,
+			reader.MongoStreamAuto, reader.MongoStreamChangeStream, reader.MongoStreamOplog)
+	}
+	updateLookup, _ := conf.GetBoolOr(reader.KeyMongoUpdateLookup, true)
+	batchSize, _ := conf.GetIntOr(reader.KeyMongoReadBatch, 100)
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeyMongoReadBatch)
+	}
+
+	r := &StreamReader{
+		meta:         meta,
+		host:         host,
+		database:     database,
+		collection:   collection,
+		streamType:   streamType,
+		updateLookup: updateLookup,
+		batchSize:    batchSize,
+		status:       reader.StatusInit,
+		readChan:     make(chan event),
+		done:         make(chan struct{}),
+	}
+	r.pos = r.loadPosition()
+	r.synced = r.pos
+	return r, nil
+}
+
+func (r *StreamReader) namespace() string {
+	return r.database + "." + r.collection
+}
+
+// loadPosition 读取 meta 中保存的位置，database 或者 collection 变化后之前的位置不再使用
+func (r *StreamReader) loadPosition() position {
+	pos := position{Namespace: r.namespace()}
+	data, err := r.meta.ReadValue(positionFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Runner[%v] %v read meta error: %v, omit meta data...", r.meta.RunnerName, r.Name(), err)
+		}
+		return pos
+	}
+	var saved position
+	if err = json.Unmarshal(data, &saved); err != nil {
+		log.Errorf("Runner[%v] %v meta data is corrupted err: %v, omit meta data...", r.meta.RunnerName, r.Name(), err)
+		return pos
+	}
+	if saved.Namespace != pos.Namespace {
+		return pos
+	}
+	return saved
+}
+
+func (r *StreamReader) Name() string {
+	return "MongoStreamReader:" + r.Source()
+}
+
+func (r *StreamReader) Source() string {
+	return r.host + "_" + r.database + "_" + r.collection
+}
+
+func (r *StreamReader) SetMode(mode string, v interface{}) error {
+	return errors.New("MongoDB stream reader not support read mode")
+}
+
+func (r *StreamReader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	r.wg.Add(1)
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *StreamReader) running() bool {
+	return atomic.LoadInt32(&r.status) == reader.StatusRunning
+}
+
+// run 读取出错后等待一段时间重新连接，从最后发送出去的位置继续读取
+func (r *StreamReader) run() {
+	defer r.wg.Done()
+	for r.running() {
+		err := r.exec()
+		if !r.running() {
+			return
+		}
+		log.Errorf("Runner[%v] %v %v, retry after %v", r.meta.RunnerName, r.Name(), err, reconnectDelay)
+		r.setStatsError(err.Error())
+		select {
+		case <-r.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (r *StreamReader) exec() error {
+	session, err := utils.MongoDail(r.host, "", 0)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(socketTimeout)
+	session.SetSyncTimeout(socketTimeout)
+
+	// 重新连接时从最后读取的位置继续，之前的 cursor 中没有读取的变更由新的 cursor 重新读取
+	r.mux.Lock()
+	pos := r.pos
+	r.mux.Unlock()
+
+	useOplog := r.streamType == reader.MongoStreamOplog
+	if r.streamType == reader.MongoStreamAuto {
+		info, err := session.BuildInfo()
+		if err != nil {
+			return err
+		}
+		useOplog = !info.VersionAtLeast(3, 6)
+	}
+	if useOplog {
+		return r.tailOplog(session, pos)
+	}
+	return r.watch(session, pos)
+}
+
+// cursorResult 是 aggregate 和 getMore 命令的返回结果
+type cursorResult struct {
+	Cursor struct {
+		ID         int64      `bson:"id"`
+		FirstBatch []bson.Raw `bson:"firstBatch"`
+		NextBatch  []bson.Raw `bson:"nextBatch"`
+	} `bson:"cursor"`
+}
+
+// changeStreamCommand 生成打开 change stream 的 aggregate 命令，有 resume token 时从 token 之后继续读取
+func changeStreamCommand(collection string, token []byte, updateLookup bool, batchSize int) bson.D {
+	stage := bson.D{}
+	if updateLookup {
+		stage = append(stage, bson.DocElem{Name: "fullDocument", Value: "updateLookup"})
+	}
+	if len(token) > 0 {
+		stage = append(stage, bson.DocElem{Name: "resumeAfter", Value: bson.Raw{Kind: 0x03, Data: token}})
+	}
+	return bson.D{
+		{Name: "aggregate", Value: collection},
+		{Name: "pipeline", Value: []bson.M{{"$changeStream": stage}}},
+		{Name: "cursor", Value: bson.M{"batchSize": batchSize}},
+	}
+}
+
+// watch 使用 aggregate 的 $changeStream 打开 change stream，之后不断调用 getMore 读取新的变更
+func (r *StreamReader) watch(session *mgo.Session, pos position) error {
+	db := session.DB(r.database)
+	var result cursorResult
+	if err := db.Run(changeStreamCommand(r.collection, pos.ResumeToken, r.updateLookup, r.batchSize), &result); err != nil {
+		return fmt.Errorf("open change stream error: %v", err)
+	}
+	cursorID := result.Cursor.ID
+	defer func() {
+		if cursorID != 0 {
+			db.Run(bson.D{{Name: "killCursors", Value: r.collection}, {Name: "cursors", Value: []int64{cursorID}}}, nil)
+		}
+	}()
+	batch := result.Cursor.FirstBatch
+	for {
+		for _, raw := range batch {
+			ev, err := changeEvent(raw, r.namespace())
+			if err != nil {
+				return err
+			}
+			if !r.send(ev) {
+				return nil
+			}
+			if ev.data == nil {
+				// invalidate 之后 change stream 不能再从这个 token 恢复，重新打开时从最新的位置开始
+				return errors.New("change stream invalidated, collection may be dropped or renamed")
+			}
+		}
+		if !r.running() {
+			return nil
+		}
+		if cursorID == 0 {
+			return errors.New("change stream cursor closed")
+		}
+		result = cursorResult{}
+		err := db.Run(bson.D{
+			{Name: "getMore", Value: cursorID},
+			{Name: "collection", Value: r.collection},
+			{Name: "batchSize", Value: r.batchSize},
+			{Name: "maxTimeMS", Value: int64(awaitTime / time.Millisecond)},
+		}, &result)
+		if err != nil {
+			cursorID = 0
+			return fmt.Errorf("read change stream error: %v", err)
+		}
+		cursorID = result.Cursor.ID
+		batch = result.Cursor.NextBatch
+	}
+}
+
+// changeEvent 把 change stream 返回的事件去掉 _id (即 resume token) 后作为一条数据，
+// invalidate 事件返回的 data 为 nil，读取后只清空位置，不产生数据
+func changeEvent(raw bson.Raw, ns string) (event, error) {
+	var token struct {
+		ID bson.Raw `bson:"_id"`
+	}
+	if err := raw.Unmarshal(&token); err != nil {
+		return event{}, fmt.Errorf("unmarshal change event error: %v", err)
+	}
+	data := bson.M{}
+	if err := raw.Unmarshal(&data); err != nil {
+		return event{}, fmt.Errorf("unmarshal change event error: %v", err)
+	}
+	if data["operationType"] == "invalidate" {
+		return event{pos: position{Namespace: ns}}, nil
+	}
+	delete(data, "_id")
+	return event{
+		data:  data,
+		bytes: int64(len(raw.Data)),
+		pos:   position{Namespace: ns, ResumeToken: token.ID.Data},
+	}, nil
+}
+
+// oplogEntry 是 local.oplog.rs 中的一条记录
+type oplogEntry struct {
+	Timestamp bson.MongoTimestamp `bson:"ts"`
+	Op        string              `bson:"op"`
+	Namespace string              `bson:"ns"`
+	Object    bson.M              `bson:"o"`
+	Object2   bson.M              `bson:"o2"`
+}
+
+// tailOplog 用于不支持 change stream 的旧版本，tail local.oplog.rs 中这个 collection 的记录，
+// 没有保存位置时从当前最新的记录之后开始读取
+func (r *StreamReader) tailOplog(session *mgo.Session, pos position) error {
+	oplog := session.DB("local").C("oplog.rs")
+	ts := bson.MongoTimestamp(pos.Timestamp)
+	if ts == 0 {
+		var last oplogEntry
+		if err := oplog.Find(nil).Sort("-$natural").One(&last); err != nil {
+			return fmt.Errorf("find latest oplog error: %v", err)
+		}
+		ts = last.Timestamp
+	}
+	query := bson.M{
+		"ns": r.namespace(),
+		"ts": bson.M{"$gt": ts},
+		"op": bson.M{"$in": []string{"i", "u", "d"}},
+	}
+	iter := oplog.Find(query).Batch(r.batchSize).LogReplay().Tail(awaitTime)
+	defer iter.Close()
+	coll := session.DB(r.database).C(r.collection)
+	var raw bson.Raw
+	for {
+		for iter.Next(&raw) {
+			var entry oplogEntry
+			if err := raw.Unmarshal(&entry); err != nil {
+				return fmt.Errorf("unmarshal oplog error: %v", err)
+			}
+			data := oplogEvent(entry)
+			if r.updateLookup && data["operationType"] == "update" {
+				var doc bson.M
+				if err := coll.Find(entry.Object2).One(&doc); err == nil {
+					data["fullDocument"] = doc
+				} else if err != mgo.ErrNotFound {
+					return fmt.Errorf("lookup updated document error: %v", err)
+				}
+			}
+			ev := event{
+				data:  data,
+				bytes: int64(len(raw.Data)),
+				pos:   position{Namespace: r.namespace(), Timestamp: int64(entry.Timestamp)},
+			}
+			if !r.send(ev) {
+				return nil
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("tail oplog error: %v", err)
+		}
+		if !r.running() {
+			return nil
+		}
+		if !iter.Timeout() {
+			return errors.New("oplog cursor closed")
+		}
+	}
+}
+
+// oplogEvent 把 oplog 记录转为与 change stream 事件相同的格式
+func oplogEvent(entry oplogEntry) bson.M {
+	db, coll := entry.Namespace, ""
+	if idx := strings.Index(entry.Namespace, "."); idx >= 0 {
+		db, coll = entry.Namespace[:idx], entry.Namespace[idx+1:]
+	}
+	data := bson.M{
+		"ns":          bson.M{"db": db, "coll": coll},
+		"clusterTime": entry.Timestamp,
+	}
+	switch entry.Op {
+	case "i":
+		data["operationType"] = "insert"
+		data["documentKey"] = bson.M{"_id": entry.Object["_id"]}
+		data["fullDocument"] = entry.Object
+	case "d":
+		data["operationType"] = "delete"
+		data["documentKey"] = entry.Object
+	case "u":
+		data["documentKey"] = entry.Object2
+		if !isUpdateOperators(entry.Object) {
+			data["operationType"] = "replace"
+			data["fullDocument"] = entry.Object
+			break
+		}
+		data["operationType"] = "update"
+		updated := bson.M{}
+		if set, ok := entry.Object["$set"].(bson.M); ok {
+			updated = set
+		}
+		removed := []interface{}{}
+		if unset, ok := entry.Object["$unset"].(bson.M); ok {
+			for field := range unset {
+				removed = append(removed, field)
+			}
+		}
+		data["updateDescription"] = bson.M{"updatedFields": updated, "removedFields": removed}
+	}
+	return data
+}
+
+// isUpdateOperators 判断 update 的 oplog 记录是 $set 等修改操作，还是整个文档的替换
+func isUpdateOperators(o bson.M) bool {
+	for k := range o {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// send 把事件放入 readChan，reader 关闭时返回 false
+func (r *StreamReader) send(ev event) bool {
+	select {
+	case r.readChan <- ev:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *StreamReader) readEvent() (event, bool) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case ev := <-r.readChan:
+		r.mux.Lock()
+		r.pos = ev.pos
+		r.mux.Unlock()
+		return ev, ev.data != nil
+	case <-timer.C:
+	}
+	return event{}, false
+}
+
+func (r *StreamReader) ReadLine() (string, error) {
+	ev, ok := r.readEvent()
+	if !ok {
+		return "", nil
+	}
+	bytes, err := jsoniter.Marshal(ev.data)
+	if err != nil {
+		log.Errorf("Runner[%v] %v json marshal inner error %v", r.meta.RunnerName, ev.data, err)
+		return "", nil
+	}
+	return string(bytes), nil
+}
+
+// ReadStructured 直接返回读取到的变更事件, 与 ReadLine 序列化后再经 json parser 解析的结果一致
+func (r *StreamReader) ReadStructured() (Data, int64, error) {
+	ev, ok := r.readEvent()
+	if !ok {
+		return nil, 0, nil
+	}
+	return Data(convertBsonMap(ev.data)), ev.bytes, nil
+}
+
+// SyncMeta 保存最后读取的变更的位置，重启后从这个位置之后继续读取
+func (r *StreamReader) SyncMeta() {
+	r.mux.Lock()
+	pos := r.pos
+	changed := !samePosition(pos, r.synced)
+	r.mux.Unlock()
+	if !changed {
+		return
+	}
+	data, err := json.Marshal(pos)
+	if err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	if err = r.meta.WriteValue(positionFile, data); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	r.mux.Lock()
+	r.synced = pos
+	r.mux.Unlock()
+}
+
+func samePosition(a, b position) bool {
+	return a.Namespace == b.Namespace && a.Timestamp == b.Timestamp && string(a.ResumeToken) == string(b.ResumeToken)
+}
+
+func (r *StreamReader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *StreamReader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *StreamReader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) != reader.StatusRunning {
+		return nil
+	}
+	close(r.done)
+	r.wg.Wait()
+	log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	return nil
+}
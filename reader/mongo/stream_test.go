@@ -0,0 +1,143 @@
+package mongo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+)
+
+func TestChangeStreamCommand(t *testing.T) {
+	cmd := changeStreamCommand("coll", nil, false, 10)
+	assert.Equal(t, bson.D{
+		{Name: "aggregate", Value: "coll"},
+		{Name: "pipeline", Value: []bson.M{{"$changeStream": bson.D{}}}},
+		{Name: "cursor", Value: bson.M{"batchSize": 10}},
+	}, cmd)
+
+	token, err := bson.Marshal(bson.M{"_data": "825B0E4C3A000000012B022C0100296E5A1004"})
+	assert.NoError(t, err)
+	cmd = changeStreamCommand("coll", token, true, 10)
+	assert.Equal(t, []bson.M{{"$changeStream": bson.D{
+		{Name: "fullDocument", Value: "updateLookup"},
+		{Name: "resumeAfter", Value: bson.Raw{Kind: 0x03, Data: token}},
+	}}}, cmd[1].Value)
+	_, err = bson.Marshal(cmd)
+	assert.NoError(t, err)
+}
+
+func TestChangeEvent(t *testing.T) {
+	id := bson.ObjectIdHex("5b0e4c3a8d6f4a3b2c1d0e9f")
+	token := bson.M{"_data": "825B0E4C3A"}
+	data, err := bson.Marshal(bson.M{
+		"_id":           token,
+		"operationType": "insert",
+		"ns":            bson.M{"db": "testdb", "coll": "coll"},
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "a": 1},
+	})
+	assert.NoError(t, err)
+	ev, err := changeEvent(bson.Raw{Kind: 0x03, Data: data}, "testdb.coll")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"operationType": "insert",
+		"ns":            map[string]interface{}{"db": "testdb", "coll": "coll"},
+		"documentKey":   map[string]interface{}{"_id": id.Hex()},
+		"fullDocument":  map[string]interface{}{"_id": id.Hex(), "a": 1},
+	}, convertBsonMap(ev.data))
+	assert.EqualValues(t, len(data), ev.bytes)
+	tokenData, err := bson.Marshal(token)
+	assert.NoError(t, err)
+	assert.Equal(t, position{Namespace: "testdb.coll", ResumeToken: tokenData}, ev.pos)
+
+	data, err = bson.Marshal(bson.M{"_id": token, "operationType": "invalidate"})
+	assert.NoError(t, err)
+	ev, err = changeEvent(bson.Raw{Kind: 0x03, Data: data}, "testdb.coll")
+	assert.NoError(t, err)
+	assert.Nil(t, ev.data)
+	assert.Equal(t, position{Namespace: "testdb.coll"}, ev.pos)
+}
+
+func TestOplogEvent(t *testing.T) {
+	id := bson.ObjectIdHex("5b0e4c3a8d6f4a3b2c1d0e9f")
+	ts := bson.MongoTimestamp(6561939485749493761)
+	ns := bson.M{"db": "testdb", "coll": "coll"}
+
+	assert.Equal(t, bson.M{
+		"operationType": "insert",
+		"ns":            ns,
+		"clusterTime":   ts,
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "a": 1},
+	}, oplogEvent(oplogEntry{Timestamp: ts, Op: "i", Namespace: "testdb.coll", Object: bson.M{"_id": id, "a": 1}}))
+
+	assert.Equal(t, bson.M{
+		"operationType": "update",
+		"ns":            ns,
+		"clusterTime":   ts,
+		"documentKey":   bson.M{"_id": id},
+		"updateDescription": bson.M{
+			"updatedFields": bson.M{"a": 2},
+			"removedFields": []interface{}{"b"},
+		},
+	}, oplogEvent(oplogEntry{Timestamp: ts, Op: "u", Namespace: "testdb.coll",
+		Object: bson.M{"$set": bson.M{"a": 2}, "$unset": bson.M{"b": true}}, Object2: bson.M{"_id": id}}))
+
+	assert.Equal(t, bson.M{
+		"operationType": "replace",
+		"ns":            ns,
+		"clusterTime":   ts,
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "a": 3},
+	}, oplogEvent(oplogEntry{Timestamp: ts, Op: "u", Namespace: "testdb.coll",
+		Object: bson.M{"_id": id, "a": 3}, Object2: bson.M{"_id": id}}))
+
+	assert.Equal(t, bson.M{
+		"operationType": "delete",
+		"ns":            ns,
+		"clusterTime":   ts,
+		"documentKey":   bson.M{"_id": id},
+	}, oplogEvent(oplogEntry{Timestamp: ts, Op: "d", Namespace: "testdb.coll", Object: bson.M{"_id": id}}))
+}
+
+func TestStreamReaderSyncMeta(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	c := conf.MapConf{
+		reader.KeyMetaPath:        MetaDir,
+		reader.KeyFileDone:        MetaDir,
+		reader.KeyMode:            reader.ModeMongoStream,
+		reader.KeyMongoHost:       "127.0.0.1:12701",
+		reader.KeyMongoDatabase:   "testdb",
+		reader.KeyMongoCollection: "coll",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+
+	c[reader.KeyMongoStreamType] = "binlog"
+	_, err = NewStreamReader(meta, c)
+	assert.Error(t, err)
+	c[reader.KeyMongoStreamType] = reader.MongoStreamOplog
+
+	r, err := NewStreamReader(meta, c)
+	assert.NoError(t, err)
+	sr := r.(*StreamReader)
+	assert.Equal(t, "MongoStreamReader:127.0.0.1:12701_testdb_coll", sr.Name())
+	assert.Equal(t, position{Namespace: "testdb.coll"}, sr.pos)
+
+	sr.pos.Timestamp = 6561939485749493761
+	sr.SyncMeta()
+	r, err = NewStreamReader(meta, c)
+	assert.NoError(t, err)
+	assert.Equal(t, position{Namespace: "testdb.coll", Timestamp: 6561939485749493761}, r.(*StreamReader).pos)
+
+	// collection 变化后不再使用之前保存的位置
+	c[reader.KeyMongoCollection] = "coll2"
+	r, err = NewStreamReader(meta, c)
+	assert.NoError(t, err)
+	assert.Equal(t, position{Namespace: "testdb.coll2"}, r.(*StreamReader).pos)
+}
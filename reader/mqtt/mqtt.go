@@ -0,0 +1,401 @@
+// Package mqtt 订阅 MQTT broker 上的 topic 读取消息，每条消息的 payload 作为一行数据，
+// 只实现了 reader 需要的 MQTT 3.1.1 客户端部分，支持 QoS 0 和 QoS 1
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	subscribeID    = 1
+	reconnectDelay = 3 * time.Second
+	connectTimeout = 10 * time.Second
+)
+
+const (
+	notDelivered = iota
+	deliveredUnacked
+	deliveredSynced
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeMQTT, NewReader)
+}
+
+type Reader struct {
+	meta      *reader.Meta
+	broker    string
+	topics    []string
+	qos       byte
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	tlsConfig *tls.Config
+
+	status   int32
+	readChan chan *publish
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mux      sync.Mutex
+	conn     net.Conn
+	writeMux sync.Mutex
+	// unacked 是已经读取但还没有 SyncMeta 的 QoS 1 消息 id，SyncMeta 后才回复 PUBACK
+	unacked []uint16
+	// lastID 是最后一次 SyncMeta 保存的消息 id
+	lastID int64
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	broker, err := c.GetString(reader.KeyMQTTBroker)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid %v %q, should be like tcp://127.0.0.1:1883", reader.KeyMQTTBroker, broker)
+	}
+	var tlsConfig *tls.Config
+	switch u.Scheme {
+	case "tcp":
+	case "ssl", "tls":
+		skipVerify, _ := c.GetBoolOr(reader.KeyMQTTInsecureSkipVerify, false)
+		tlsConfig = &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: skipVerify}
+	default:
+		return nil, fmt.Errorf("unknown protocol %q in %v, should be tcp, ssl or tls", u.Scheme, broker)
+	}
+	topics, err := c.GetStringList(reader.KeyMQTTTopics)
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%v is empty", reader.KeyMQTTTopics)
+	}
+	qos, _ := c.GetIntOr(reader.KeyMQTTQoS, reader.DefaultMQTTQoS)
+	if qos != 0 && qos != 1 {
+		return nil, fmt.Errorf("%v %v not supported, should be 0 or 1", reader.KeyMQTTQoS, qos)
+	}
+	clientID, _ := c.GetStringOr(reader.KeyMQTTClientID, "")
+	if clientID == "" {
+		// QoS 1 依赖 broker 上的持久会话，client id 需要在重启前后保持不变
+		name := meta.RunnerName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		clientID = "logkit_" + name
+	}
+	username, _ := c.GetStringOr(reader.KeyMQTTUsername, "")
+	password, _ := c.GetStringOr(reader.KeyMQTTPassword, "")
+	keepAlive, _ := c.GetIntOr(reader.KeyMQTTKeepAlive, reader.DefaultMQTTKeepAlive)
+	if keepAlive <= 0 || keepAlive > 65535 {
+		return nil, fmt.Errorf("%v should be between 1 and 65535", reader.KeyMQTTKeepAlive)
+	}
+
+	r := &Reader{
+		meta:      meta,
+		broker:    u.Host,
+		topics:    topics,
+		qos:       byte(qos),
+		clientID:  clientID,
+		username:  username,
+		password:  password,
+		keepAlive: time.Duration(keepAlive) * time.Second,
+		tlsConfig: tlsConfig,
+		status:    reader.StatusInit,
+		readChan:  make(chan *publish, 100),
+		done:      make(chan struct{}),
+		lastID:    -1,
+	}
+	if id, offset, err := meta.ReadOffset(); err == nil && id == clientID {
+		r.lastID = offset
+	}
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "MQTTReader<" + r.broker + ">"
+}
+
+func (r *Reader) Source() string {
+	return r.broker
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("MQTTReader not support read mode")
+}
+
+func (r *Reader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	r.wg.Add(1)
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *Reader) running() bool {
+	return atomic.LoadInt32(&r.status) == reader.StatusRunning
+}
+
+// run 保持与 broker 的连接，连接断开后等待一段时间重连
+func (r *Reader) run() {
+	defer r.wg.Done()
+	for r.running() {
+		err := r.session()
+		if !r.running() {
+			return
+		}
+		log.Errorf("Runner[%v] %v %v, reconnect after %v", r.meta.RunnerName, r.Name(), err, reconnectDelay)
+		r.setStatsError(err.Error())
+		select {
+		case <-r.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (r *Reader) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if r.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", r.broker, r.tlsConfig)
+	}
+	return dialer.Dial("tcp", r.broker)
+}
+
+// session 建立连接并订阅，之后一直读取消息直到连接出错或者 reader 关闭
+func (r *Reader) session() error {
+	conn, err := r.dial()
+	if err != nil {
+		return fmt.Errorf("connect to broker error: %v", err)
+	}
+	defer conn.Close()
+	r.mux.Lock()
+	if !r.running() {
+		r.mux.Unlock()
+		return nil
+	}
+	r.conn = conn
+	r.mux.Unlock()
+	defer func() {
+		r.mux.Lock()
+		r.conn = nil
+		r.mux.Unlock()
+	}()
+
+	br := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(connectTimeout))
+	// QoS 1 使用持久会话，未确认的消息 broker 会在重连后重新发送
+	cleanSession := r.qos == 0
+	if err = r.write(conn, connectPacket(r.clientID, r.username, r.password, cleanSession, uint16(r.keepAlive/time.Second))); err != nil {
+		return err
+	}
+	p, err := readPacket(br)
+	if err != nil {
+		return err
+	}
+	if err = checkConnack(p); err != nil {
+		return err
+	}
+	if err = r.write(conn, subscribePacket(subscribeID, r.topics, r.qos)); err != nil {
+		return err
+	}
+	// 持久会话中 broker 可能在 SUBACK 之前就重新发送未确认的消息
+	for {
+		if p, err = readPacket(br); err != nil {
+			return err
+		}
+		if p.typ != packetPublish {
+			break
+		}
+		if err = r.handlePublish(conn, p); err != nil {
+			return err
+		}
+	}
+	if err = checkSuback(p, subscribeID, r.topics); err != nil {
+		return err
+	}
+	log.Infof("Runner[%v] %v subscribed %v", r.meta.RunnerName, r.Name(), r.topics)
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go r.ping(conn, pingDone)
+	for {
+		conn.SetReadDeadline(time.Now().Add(r.keepAlive * 3 / 2))
+		p, err := readPacket(br)
+		if err != nil {
+			return err
+		}
+		switch p.typ {
+		case packetPublish:
+			if err = r.handlePublish(conn, p); err != nil {
+				return err
+			}
+		case packetPingresp:
+		default:
+			return fmt.Errorf("unexpected packet type %v", p.typ)
+		}
+	}
+}
+
+// ping 每隔 keepalive 的一半发送一次 PINGREQ，避免 broker 断开空闲的连接
+func (r *Reader) ping(conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(r.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := r.write(conn, &packet{typ: packetPingreq}); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (r *Reader) write(conn net.Conn, p *packet) error {
+	r.writeMux.Lock()
+	defer r.writeMux.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(connectTimeout))
+	_, err := conn.Write(p.encode())
+	return err
+}
+
+// handlePublish 把消息放入 readChan，重新发送的消息如果已经读取过则不再重复读取
+func (r *Reader) handlePublish(conn net.Conn, p *packet) error {
+	pub, err := parsePublish(p)
+	if err != nil {
+		return err
+	}
+	if pub.qos > 0 && pub.dup {
+		switch r.delivered(pub.id) {
+		case deliveredUnacked:
+			return nil
+		case deliveredSynced:
+			return r.write(conn, pubackPacket(pub.id))
+		}
+	}
+	for r.running() {
+		select {
+		case r.readChan <- pub:
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// delivered 判断重新发送的消息是否已经读取过，已经读取还没有 SyncMeta 的等待 SyncMeta 时确认，
+// 与保存的最后一个消息 id 相同的说明 SyncMeta 之后没来得及确认，直接回复 PUBACK
+func (r *Reader) delivered(id uint16) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, unacked := range r.unacked {
+		if unacked == id {
+			return deliveredUnacked
+		}
+	}
+	if int64(id) == r.lastID {
+		return deliveredSynced
+	}
+	return notDelivered
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		if err := r.Start(); err != nil {
+			return "", err
+		}
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case pub := <-r.readChan:
+		if pub.qos > 0 {
+			r.mux.Lock()
+			r.unacked = append(r.unacked, pub.id)
+			r.mux.Unlock()
+		}
+		return string(pub.payload), nil
+	case <-timer.C:
+	}
+	return "", nil
+}
+
+// SyncMeta 保存最后读取的消息 id，然后确认已经读取的 QoS 1 消息，确认前退出的消息 broker 会重新发送
+func (r *Reader) SyncMeta() {
+	r.mux.Lock()
+	ids := r.unacked
+	r.unacked = nil
+	conn := r.conn
+	r.mux.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	last := int64(ids[len(ids)-1])
+	if err := r.meta.WriteOffset(r.clientID, last); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+	}
+	r.mux.Lock()
+	r.lastID = last
+	r.mux.Unlock()
+	if conn == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := r.write(conn, pubackPacket(id)); err != nil {
+			log.Errorf("Runner[%v] %v send PUBACK error %v", r.meta.RunnerName, r.Name(), err)
+			return
+		}
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) != reader.StatusRunning {
+		return nil
+	}
+	close(r.done)
+	r.mux.Lock()
+	if r.conn != nil {
+		r.write(r.conn, &packet{typ: packetDisconnect})
+		r.conn.Close()
+	}
+	r.mux.Unlock()
+	r.wg.Wait()
+	log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	return nil
+}
@@ -0,0 +1,146 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+)
+
+func publishPacket(pub *publish) *packet {
+	flags := pub.qos << 1
+	if pub.dup {
+		flags |= flagDup
+	}
+	body := appendString(nil, pub.topic)
+	if pub.qos > 0 {
+		body = appendUint16(body, pub.id)
+	}
+	return &packet{typ: packetPublish, flags: flags, body: append(body, pub.payload...)}
+}
+
+func TestPacket(t *testing.T) {
+	pub := &publish{topic: "a/b", id: 300, qos: 1, dup: true, payload: make([]byte, 200)}
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(publishPacket(pub).encode())))
+	assert.NoError(t, err)
+	assert.Equal(t, byte(packetPublish), p.typ)
+	got, err := parsePublish(p)
+	assert.NoError(t, err)
+	assert.Equal(t, pub, got)
+
+	_, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff})))
+	assert.Error(t, err)
+	assert.Error(t, checkConnack(&packet{typ: packetConnack, body: []byte{0, 5}}))
+	assert.Error(t, checkSuback(&packet{typ: packetSuback, body: []byte{0, 1, 0x80}}, 1, []string{"a"}))
+}
+
+// fakeBroker 接受一个连接，完成 CONNECT 和 SUBSCRIBE 后把 conn 交给测试
+func fakeBroker(t *testing.T, l net.Listener) (net.Conn, *bufio.Reader, *packet) {
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	br := bufio.NewReader(conn)
+	connect, err := readPacket(br)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(packetConnect), connect.typ)
+	conn.Write((&packet{typ: packetConnack, body: []byte{0, 0}}).encode())
+	sub, err := readPacket(br)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(packetSubscribe), sub.typ)
+	return conn, br, connect
+}
+
+func suback(conn net.Conn) {
+	conn.Write((&packet{typ: packetSuback, body: []byte{0, subscribeID, 1}}).encode())
+}
+
+func readPuback(t *testing.T, conn net.Conn, br *bufio.Reader) uint16 {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		p, err := readPacket(br)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		if p.typ == packetPuback {
+			return binary.BigEndian.Uint16(p.body)
+		}
+	}
+}
+
+func newTestReader(t *testing.T, addr string) *Reader {
+	c := conf.MapConf{
+		reader.KeyMetaPath:   MetaDir,
+		reader.KeyFileDone:   MetaDir,
+		reader.KeyMode:       reader.ModeMQTT,
+		reader.KeyMQTTBroker: "tcp://" + addr,
+		reader.KeyMQTTTopics: "devices/+/logs",
+		reader.KeyMQTTQoS:    "1",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	meta.RunnerName = "TestMQTTReader"
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	return r.(*Reader)
+}
+
+func readLine(t *testing.T, r *Reader) string {
+	for i := 0; i < 5; i++ {
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestMQTTReader(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	r := newTestReader(t, l.Addr().String())
+	assert.NoError(t, r.Start())
+	conn, br, connect := fakeBroker(t, l)
+	// QoS 1 不使用 clean session
+	assert.Equal(t, byte(0), connect.body[7]&flagCleanSession)
+	suback(conn)
+
+	conn.Write(publishPacket(&publish{topic: "devices/1/logs", id: 1, qos: 1, payload: []byte("hello")}).encode())
+	conn.Write(publishPacket(&publish{topic: "devices/2/logs", payload: []byte("world")}).encode())
+	conn.Write(publishPacket(&publish{topic: "devices/1/logs", id: 2, qos: 1, payload: []byte("unacked")}).encode())
+	assert.Equal(t, "hello", readLine(t, r))
+	assert.Equal(t, "world", readLine(t, r))
+	r.SyncMeta()
+	assert.Equal(t, uint16(1), readPuback(t, conn, br))
+	id, offset, err := r.meta.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, "logkit_TestMQTTReader", id)
+	assert.Equal(t, int64(1), offset)
+	assert.NoError(t, r.Close())
+	conn.Close()
+
+	// 重启后 broker 重新发送未确认的消息，已经确认过的只回复 PUBACK
+	r = newTestReader(t, l.Addr().String())
+	defer r.Close()
+	assert.NoError(t, r.Start())
+	conn, br, _ = fakeBroker(t, l)
+	defer conn.Close()
+	conn.Write(publishPacket(&publish{topic: "devices/1/logs", id: 1, qos: 1, dup: true, payload: []byte("hello")}).encode())
+	conn.Write(publishPacket(&publish{topic: "devices/1/logs", id: 2, qos: 1, dup: true, payload: []byte("unacked")}).encode())
+	suback(conn)
+	assert.Equal(t, uint16(1), readPuback(t, conn, br))
+	assert.Equal(t, "unacked", readLine(t, r))
+	r.SyncMeta()
+	assert.Equal(t, uint16(2), readPuback(t, conn, br))
+}
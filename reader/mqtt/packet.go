@@ -0,0 +1,203 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 中 reader 用到的控制报文类型
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	protocolLevel311  = 4
+	maxRemainingBytes = 4
+)
+
+// connect flags
+const (
+	flagCleanSession = 0x02
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// flagDup 表示 PUBLISH 是重新发送的
+const flagDup = 0x08
+
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+type publish struct {
+	topic   string
+	id      uint16
+	qos     byte
+	dup     bool
+	payload []byte
+}
+
+// readPacket 读取一个完整的控制报文
+func readPacket(br *bufio.Reader) (*packet, error) {
+	first, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, shift := 0, uint(0)
+	for i := 0; ; i++ {
+		if i >= maxRemainingBytes {
+			return nil, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	p := &packet{typ: first >> 4, flags: first & 0x0f, body: make([]byte, length)}
+	if _, err = io.ReadFull(br, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// encode 按照固定报头、剩余长度、报文内容的顺序编码
+func (p *packet) encode() []byte {
+	buf := []byte{p.typ<<4 | p.flags}
+	length := len(p.body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, p.body...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func readString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("mqtt: malformed string")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, errors.New("mqtt: malformed string")
+	}
+	return string(body[2 : 2+n]), body[2+n:], nil
+}
+
+func connectPacket(clientID, username, password string, cleanSession bool, keepAlive uint16) *packet {
+	var flags byte
+	if cleanSession {
+		flags |= flagCleanSession
+	}
+	if username != "" {
+		flags |= flagUsername
+	}
+	if password != "" {
+		flags |= flagPassword
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel311, flags)
+	body = appendUint16(body, keepAlive)
+	body = appendString(body, clientID)
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	return &packet{typ: packetConnect, body: body}
+}
+
+// checkConnack 检查 CONNACK 中的返回码
+func checkConnack(p *packet) error {
+	if p.typ != packetConnack || len(p.body) != 2 {
+		return fmt.Errorf("mqtt: expect CONNACK but got packet type %v", p.typ)
+	}
+	if code := p.body[1]; code != 0 {
+		if msg, ok := connackErrors[code]; ok {
+			return fmt.Errorf("mqtt: connection refused, %v", msg)
+		}
+		return fmt.Errorf("mqtt: connection refused, return code %v", code)
+	}
+	return nil
+}
+
+func subscribePacket(id uint16, topics []string, qos byte) *packet {
+	body := appendUint16(nil, id)
+	for _, topic := range topics {
+		body = appendString(body, topic)
+		body = append(body, qos)
+	}
+	return &packet{typ: packetSubscribe, flags: 0x02, body: body}
+}
+
+// checkSuback 检查每个 topic 的订阅结果，0x80 表示订阅失败
+func checkSuback(p *packet, id uint16, topics []string) error {
+	if p.typ != packetSuback || len(p.body) != 2+len(topics) || binary.BigEndian.Uint16(p.body) != id {
+		return fmt.Errorf("mqtt: expect SUBACK but got packet type %v", p.typ)
+	}
+	for i, code := range p.body[2:] {
+		if code == 0x80 {
+			return fmt.Errorf("mqtt: subscribe topic %v failed", topics[i])
+		}
+	}
+	return nil
+}
+
+func parsePublish(p *packet) (*publish, error) {
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return nil, err
+	}
+	pub := &publish{topic: topic, qos: (p.flags >> 1) & 0x03, dup: p.flags&flagDup != 0}
+	if pub.qos > 0 {
+		if len(rest) < 2 {
+			return nil, errors.New("mqtt: malformed PUBLISH packet")
+		}
+		pub.id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	pub.payload = rest
+	return pub, nil
+}
+
+func pubackPacket(id uint16) *packet {
+	return &packet{typ: packetPuback, body: appendUint16(nil, id)}
+}
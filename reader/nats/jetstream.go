@@ -0,0 +1,129 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jsAPIPrefix = "$JS.API."
+	jsAckPrefix = "$JS.ACK."
+	jsAck       = "+ACK"
+
+	// pullExpires 是每个拉取请求的等待时间，没有消息时服务端在超时后回复 408
+	pullExpires = 5 * time.Second
+)
+
+type consumerConfig struct {
+	DurableName    string   `json:"durable_name"`
+	DeliverPolicy  string   `json:"deliver_policy"`
+	AckPolicy      string   `json:"ack_policy"`
+	AckWait        int64    `json:"ack_wait"`
+	FilterSubject  string   `json:"filter_subject,omitempty"`
+	FilterSubjects []string `json:"filter_subjects,omitempty"`
+}
+
+type createConsumerRequest struct {
+	Stream string         `json:"stream_name"`
+	Config consumerConfig `json:"config"`
+}
+
+type apiError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+type apiResponse struct {
+	Type  string    `json:"type"`
+	Error *apiError `json:"error"`
+}
+
+type pullRequest struct {
+	Batch   int   `json:"batch"`
+	Expires int64 `json:"expires"`
+}
+
+// createConsumerSubject 返回创建 durable consumer 的 API subject，consumer 已经存在并且配置相同时服务端直接返回成功
+func createConsumerSubject(stream, durable string) string {
+	return jsAPIPrefix + "CONSUMER.DURABLE.CREATE." + stream + "." + durable
+}
+
+func pullSubject(stream, durable string) string {
+	return jsAPIPrefix + "CONSUMER.MSG.NEXT." + stream + "." + durable
+}
+
+// newConsumerRequest 生成 explicit ack 的 pull consumer 配置，多个 subject 需要服务端 2.10 以上的版本
+func newConsumerRequest(stream, durable string, subjects []string, ackWait time.Duration) ([]byte, error) {
+	req := createConsumerRequest{
+		Stream: stream,
+		Config: consumerConfig{
+			DurableName:   durable,
+			DeliverPolicy: "all",
+			AckPolicy:     "explicit",
+			AckWait:       int64(ackWait),
+		},
+	}
+	if len(subjects) == 1 {
+		req.Config.FilterSubject = subjects[0]
+	} else if len(subjects) > 1 {
+		req.Config.FilterSubjects = subjects
+	}
+	return json.Marshal(req)
+}
+
+// checkAPIResponse 检查 JetStream API 的回复，503 表示服务端没有开启 JetStream
+func checkAPIResponse(msg *message) error {
+	if msg.status == 503 {
+		return fmt.Errorf("no responders for %v, is JetStream enabled?", msg.subject)
+	}
+	var resp apiResponse
+	if err := json.Unmarshal(msg.data, &resp); err != nil {
+		return fmt.Errorf("parse JetStream API response error: %v", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("JetStream API error %v(%v): %v", resp.Error.Code, resp.Error.ErrCode, resp.Error.Description)
+	}
+	return nil
+}
+
+func newPullRequest(batch int) []byte {
+	data, _ := json.Marshal(pullRequest{Batch: batch, Expires: int64(pullExpires)})
+	return data
+}
+
+// ackMeta 是从消息回复地址中解析出的 JetStream 元信息
+type ackMeta struct {
+	stream    string
+	consumer  string
+	delivered uint64
+	streamSeq uint64
+}
+
+// parseAckSubject 解析 $JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>.<timestamp>.<pending>，
+// 新版本的服务端在 $JS.ACK 之后还有 domain 和 account hash 两段，以及结尾的随机串
+func parseAckSubject(subject string) (*ackMeta, error) {
+	if !strings.HasPrefix(subject, jsAckPrefix) {
+		return nil, fmt.Errorf("%q is not a JetStream ack subject", subject)
+	}
+	tokens := strings.Split(subject[len(jsAckPrefix):], ".")
+	switch {
+	case len(tokens) == 7:
+	case len(tokens) >= 9:
+		tokens = tokens[2:]
+	default:
+		return nil, fmt.Errorf("invalid JetStream ack subject %q", subject)
+	}
+	delivered, err := strconv.ParseUint(tokens[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JetStream ack subject %q", subject)
+	}
+	seq, err := strconv.ParseUint(tokens[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JetStream ack subject %q", subject)
+	}
+	return &ackMeta{stream: tokens[0], consumer: tokens[1], delivered: delivered, streamSeq: seq}, nil
+}
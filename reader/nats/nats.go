@@ -0,0 +1,499 @@
+// Package nats 订阅 NATS 上的 subject 读取消息，每条消息的 payload 作为一行数据。
+// 开启 JetStream 时使用 durable 的 pull consumer，消息发送成功后才确认，保证至少一次投递；
+// 只实现了 reader 需要的客户端协议部分
+package nats
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	defaultPort    = "4222"
+	reconnectDelay = 3 * time.Second
+	connectTimeout = 10 * time.Second
+	// pingInterval 是客户端发送 PING 的间隔，超过 1.5 倍间隔没有收到任何数据则认为连接已经断开
+	pingInterval = 30 * time.Second
+
+	// jsSID 是 JetStream 模式下订阅 inbox 的 sid，API 的回复和拉取的消息都发送到 inbox
+	jsSID = 1
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeNATS, NewReader)
+}
+
+// received 是读取到的一条消息，ack 为 JetStream 消息的确认地址
+type received struct {
+	subject string
+	seq     uint64
+	ack     string
+	data    []byte
+}
+
+type Reader struct {
+	meta       *reader.Meta
+	servers    []*url.URL
+	subjects   []string
+	queue      string
+	username   string
+	password   string
+	token      string
+	skipVerify bool
+
+	jetStream bool
+	stream    string
+	durable   string
+	batchSize int
+	ackWait   time.Duration
+
+	status   int32
+	readChan chan *received
+	done     chan struct{}
+	wg       sync.WaitGroup
+	next     int
+
+	mux  sync.Mutex
+	conn *conn
+	// unacked 是已经读取但还没有 SyncMeta 的 JetStream 消息的确认地址，SyncMeta 后才确认
+	unacked []string
+	// last 是最近一次 ReadLine 读到的消息，只在 runner 的 goroutine 中使用
+	last *received
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	addrs, _ := c.GetStringListOr(reader.KeyNATSServers, []string{reader.DefaultNATSServer})
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%v is empty", reader.KeyNATSServers)
+	}
+	servers := make([]*url.URL, 0, len(addrs))
+	for _, addr := range addrs {
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid %v %q, should be like nats://127.0.0.1:4222", reader.KeyNATSServers, addr)
+		}
+		if u.Scheme != "nats" && u.Scheme != "tls" {
+			return nil, fmt.Errorf("unknown protocol %q in %v, should be nats or tls", u.Scheme, addr)
+		}
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+		}
+		servers = append(servers, u)
+	}
+	subjects, _ := c.GetStringListOr(reader.KeyNATSSubjects, nil)
+	queue, _ := c.GetStringOr(reader.KeyNATSQueueGroup, "")
+	username, _ := c.GetStringOr(reader.KeyNATSUsername, "")
+	password, _ := c.GetStringOr(reader.KeyNATSPassword, "")
+	token, _ := c.GetStringOr(reader.KeyNATSToken, "")
+	skipVerify, _ := c.GetBoolOr(reader.KeyNATSInsecureSkipVerify, false)
+	jetStream, _ := c.GetBoolOr(reader.KeyNATSJetStream, false)
+
+	r := &Reader{
+		meta:       meta,
+		servers:    servers,
+		subjects:   subjects,
+		queue:      queue,
+		username:   username,
+		password:   password,
+		token:      token,
+		skipVerify: skipVerify,
+		jetStream:  jetStream,
+		status:     reader.StatusInit,
+		readChan:   make(chan *received, 100),
+		done:       make(chan struct{}),
+	}
+	if !jetStream {
+		if len(subjects) == 0 {
+			return nil, fmt.Errorf("%v is empty", reader.KeyNATSSubjects)
+		}
+		return r, nil
+	}
+
+	var err error
+	if r.stream, err = c.GetString(reader.KeyNATSStream); err != nil {
+		return nil, err
+	}
+	r.durable, _ = c.GetStringOr(reader.KeyNATSDurable, "")
+	if r.durable == "" {
+		// durable consumer 在服务端保存消费位置，名称需要在重启前后保持不变
+		name := meta.RunnerName
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		r.durable = "logkit_" + name
+	}
+	r.durable = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(r.durable)
+	if r.batchSize, _ = c.GetIntOr(reader.KeyNATSBatchSize, reader.DefaultNATSBatchSize); r.batchSize <= 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeyNATSBatchSize)
+	}
+	ackWait, _ := c.GetIntOr(reader.KeyNATSAckWait, reader.DefaultNATSAckWait)
+	if ackWait <= 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeyNATSAckWait)
+	}
+	r.ackWait = time.Duration(ackWait) * time.Second
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "NATSReader<" + r.Source() + ">"
+}
+
+func (r *Reader) Source() string {
+	hosts := make([]string, len(r.servers))
+	for i, u := range r.servers {
+		hosts[i] = u.Host
+	}
+	return strings.Join(hosts, ",")
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("NATSReader not support read mode")
+}
+
+func (r *Reader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	r.wg.Add(1)
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *Reader) running() bool {
+	return atomic.LoadInt32(&r.status) == reader.StatusRunning
+}
+
+// run 保持与服务端的连接，连接断开后等待一段时间依次重连下一个服务端
+func (r *Reader) run() {
+	defer r.wg.Done()
+	for r.running() {
+		server := r.servers[r.next%len(r.servers)]
+		r.next++
+		err := r.session(server)
+		if !r.running() {
+			return
+		}
+		log.Errorf("Runner[%v] %v %v: %v, reconnect after %v", r.meta.RunnerName, r.Name(), server.Host, err, reconnectDelay)
+		r.setStatsError(err.Error())
+		select {
+		case <-r.done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// dial 建立连接并完成握手，地址中的用户名密码在没有单独配置时使用
+func (r *Reader) dial(server *url.URL) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", server.Host, connectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to server error: %v", err)
+	}
+	var tlsConfig *tls.Config
+	if server.Scheme == "tls" {
+		tlsConfig = &tls.Config{ServerName: server.Hostname(), InsecureSkipVerify: r.skipVerify}
+	}
+	ci := connectInfo{
+		Name:      "logkit_" + r.meta.RunnerName,
+		Lang:      "go",
+		Version:   "logkit",
+		Protocol:  1,
+		User:      r.username,
+		Pass:      r.password,
+		AuthToken: r.token,
+	}
+	if server.User != nil && ci.User == "" && ci.AuthToken == "" {
+		if pass, ok := server.User.Password(); ok {
+			ci.User, ci.Pass = server.User.Username(), pass
+		} else {
+			ci.AuthToken = server.User.Username()
+		}
+	}
+	nc.SetDeadline(time.Now().Add(connectTimeout))
+	c, err := handshake(nc, tlsConfig, ci)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	if r.jetStream && !c.info.Headers {
+		c.Close()
+		return nil, fmt.Errorf("server %v does not support headers, which is required by JetStream", c.info.Version)
+	}
+	nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// session 建立连接并订阅，之后一直读取消息直到连接出错或者 reader 关闭
+func (r *Reader) session(server *url.URL) error {
+	c, err := r.dial(server)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	r.mux.Lock()
+	if !r.running() {
+		r.mux.Unlock()
+		return nil
+	}
+	r.conn = c
+	r.mux.Unlock()
+	defer func() {
+		r.mux.Lock()
+		r.conn = nil
+		r.mux.Unlock()
+	}()
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go r.ping(c, pingDone)
+	if r.jetStream {
+		return r.consume(c)
+	}
+	for i, subject := range r.subjects {
+		if err = c.subscribe(subject, r.queue, i+1); err != nil {
+			return err
+		}
+	}
+	log.Infof("Runner[%v] %v subscribed %v on %v", r.meta.RunnerName, r.Name(), r.subjects, server.Host)
+	for {
+		msg, err := r.readMsg(c)
+		if err != nil {
+			return err
+		}
+		r.deliver(&received{subject: msg.subject, data: msg.data})
+	}
+}
+
+// consume 创建 durable consumer 后不断拉取消息，上一次拉取的消息全部收到或者拉取超时后再拉取下一批
+func (r *Reader) consume(c *conn) error {
+	inbox, err := newInbox()
+	if err != nil {
+		return err
+	}
+	if err = c.subscribe(inbox+".*", "", jsSID); err != nil {
+		return err
+	}
+	req, err := newConsumerRequest(r.stream, r.durable, r.subjects, r.ackWait)
+	if err != nil {
+		return err
+	}
+	if err = c.publish(createConsumerSubject(r.stream, r.durable), inbox+".api", req); err != nil {
+		return err
+	}
+	for {
+		msg, err := r.readMsg(c)
+		if err != nil {
+			return err
+		}
+		if msg.subject == inbox+".api" {
+			if err = checkAPIResponse(msg); err != nil {
+				return fmt.Errorf("create consumer %v on stream %v error: %v", r.durable, r.stream, err)
+			}
+			break
+		}
+	}
+	log.Infof("Runner[%v] %v consuming stream %v with durable consumer %v", r.meta.RunnerName, r.Name(), r.stream, r.durable)
+
+	var pending int
+	for {
+		if pending <= 0 {
+			if err = c.publish(pullSubject(r.stream, r.durable), inbox+".pull", newPullRequest(r.batchSize)); err != nil {
+				return err
+			}
+			pending = r.batchSize
+		}
+		msg, err := r.readMsg(c)
+		if err != nil {
+			return err
+		}
+		// 拉取到的消息使用原始的 subject，只有状态消息的 subject 是 inbox
+		switch msg.status {
+		case 0:
+		case 404, 408:
+			// 没有更多消息或者拉取请求超时
+			pending = 0
+			continue
+		case 409:
+			if strings.Contains(msg.desc, "Consumer Deleted") {
+				return fmt.Errorf("consumer %v is deleted", r.durable)
+			}
+			pending = 0
+			continue
+		default:
+			continue
+		}
+		pending--
+		am, err := parseAckSubject(msg.reply)
+		if err != nil {
+			log.Warnf("Runner[%v] %v %v", r.meta.RunnerName, r.Name(), err)
+			continue
+		}
+		if am.delivered > 1 {
+			log.Debugf("Runner[%v] %v message %v of stream %v is redelivered %v times", r.meta.RunnerName, r.Name(), am.streamSeq, am.stream, am.delivered)
+		}
+		r.deliver(&received{subject: msg.subject, seq: am.streamSeq, ack: msg.reply, data: msg.data})
+	}
+}
+
+// readMsg 读取下一条 MSG 或 HMSG，同时处理 PING 和服务端的错误
+func (r *Reader) readMsg(c *conn) (*message, error) {
+	for {
+		c.SetReadDeadline(time.Now().Add(pingInterval * 3 / 2))
+		op, err := c.readOp()
+		if err != nil {
+			return nil, err
+		}
+		switch op.name {
+		case opMsg, opHMsg:
+			return op.msg, nil
+		case opPing:
+			if err = c.write("PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case opErr:
+			return nil, fmt.Errorf("server error: %v", op.args)
+		case opPong, opOK, opInfo:
+		default:
+			return nil, fmt.Errorf("unexpected operation %q", op.name)
+		}
+	}
+}
+
+// ping 定期发送 PING，服务端回复的 PONG 会刷新读取的超时时间
+func (r *Reader) ping(c *conn, done chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write("PING\r\n"); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+func (r *Reader) deliver(msg *received) {
+	for r.running() {
+		select {
+		case r.readChan <- msg:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func newInbox() (string, error) {
+	b := make([]byte, 11)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_INBOX." + hex.EncodeToString(b), nil
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		if err := r.Start(); err != nil {
+			return "", err
+		}
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case msg := <-r.readChan:
+		if msg.ack != "" {
+			r.mux.Lock()
+			r.unacked = append(r.unacked, msg.ack)
+			r.mux.Unlock()
+		}
+		r.last = msg
+		return string(msg.data), nil
+	case <-timer.C:
+	}
+	return "", nil
+}
+
+// MessageMeta 返回最近一次读到的消息的 subject，JetStream 模式下还包括消息在 stream 中的序号
+func (r *Reader) MessageMeta() (map[string]interface{}, bool) {
+	if r.last == nil {
+		return nil, false
+	}
+	meta := map[string]interface{}{"subject": r.last.subject}
+	if r.jetStream {
+		meta["sequence"] = r.last.seq
+	}
+	return meta, true
+}
+
+// SyncMeta 确认已经读取的 JetStream 消息，consumer 的消费位置保存在服务端，
+// 确认前退出或者超过 ack wait 没有确认的消息服务端会重新投递
+func (r *Reader) SyncMeta() {
+	r.mux.Lock()
+	acks := r.unacked
+	r.unacked = nil
+	c := r.conn
+	r.mux.Unlock()
+	if len(acks) == 0 {
+		return
+	}
+	if c == nil {
+		log.Warnf("Runner[%v] %v connection lost, %v messages will be redelivered", r.meta.RunnerName, r.Name(), len(acks))
+		return
+	}
+	for _, ack := range acks {
+		if err := c.publish(ack, "", []byte(jsAck)); err != nil {
+			log.Errorf("Runner[%v] %v ack message error %v", r.meta.RunnerName, r.Name(), err)
+			return
+		}
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) != reader.StatusRunning {
+		return nil
+	}
+	close(r.done)
+	r.mux.Lock()
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mux.Unlock()
+	r.wg.Wait()
+	log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	return nil
+}
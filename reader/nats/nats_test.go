@@ -0,0 +1,276 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestReadOp(t *testing.T) {
+	status := "NATS/1.0 408 Request Timeout\r\n\r\n"
+	data := "MSG logs.a 1 5\r\nhello\r\n" +
+		fmt.Sprintf("HMSG _INBOX.x.pull 1 %v %v\r\n%v\r\n", len(status), len(status), status) +
+		"HMSG logs.b 2 $JS.ACK.S.C.1.2.3.4.5 12 17\r\nNATS/1.0\r\n\r\nworld\r\n" +
+		"-ERR 'Authorization Violation'\r\n" +
+		"MSG logs.a 1 5\r\nhel"
+	c := &conn{br: bufio.NewReader(strings.NewReader(data))}
+	op, err := c.readOp()
+	assert.NoError(t, err)
+	assert.Equal(t, &message{subject: "logs.a", sid: 1, data: []byte("hello")}, op.msg)
+	op, err = c.readOp()
+	assert.NoError(t, err)
+	assert.Equal(t, 408, op.msg.status)
+	assert.Equal(t, "Request Timeout", op.msg.desc)
+	assert.Empty(t, op.msg.data)
+	op, err = c.readOp()
+	assert.NoError(t, err)
+	assert.Equal(t, &message{subject: "logs.b", sid: 2, reply: "$JS.ACK.S.C.1.2.3.4.5", data: []byte("world")}, op.msg)
+	op, err = c.readOp()
+	assert.NoError(t, err)
+	assert.Equal(t, opErr, op.name)
+	assert.Equal(t, "Authorization Violation", op.args)
+	_, err = c.readOp()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	c = &conn{br: bufio.NewReader(strings.NewReader("MSG logs.a x 5\r\nhello\r\n"))}
+	_, err = c.readOp()
+	assert.Error(t, err)
+}
+
+func TestParseAckSubject(t *testing.T) {
+	am, err := parseAckSubject("$JS.ACK.LOGS.logkit.2.15.10.1530000000000000000.3")
+	assert.NoError(t, err)
+	assert.Equal(t, &ackMeta{stream: "LOGS", consumer: "logkit", delivered: 2, streamSeq: 15}, am)
+	am, err = parseAckSubject("$JS.ACK.hub.ACCHASH.LOGS.logkit.1.16.11.1530000000000000000.0.abc")
+	assert.NoError(t, err)
+	assert.Equal(t, &ackMeta{stream: "LOGS", consumer: "logkit", delivered: 1, streamSeq: 16}, am)
+	_, err = parseAckSubject("$JS.ACK.LOGS.logkit.x.15.10.1.3")
+	assert.Error(t, err)
+	_, err = parseAckSubject("_INBOX.abc")
+	assert.Error(t, err)
+}
+
+// fakeServer 接受一个连接并完成握手，之后由测试读写
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func acceptClient(t *testing.T, l net.Listener) (*fakeServer, map[string]interface{}) {
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	s := &fakeServer{t: t, conn: conn, br: bufio.NewReader(conn)}
+	s.write(`INFO {"server_id":"test","version":"2.10.0","headers":true,"jetstream":true}` + "\r\n")
+	line := s.readLine()
+	assert.True(t, strings.HasPrefix(line, "CONNECT "))
+	var connect map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &connect))
+	assert.Equal(t, "PING", s.readLine())
+	s.write("PONG\r\n")
+	return s, connect
+}
+
+func (s *fakeServer) write(data string) {
+	_, err := io.WriteString(s.conn, data)
+	assert.NoError(s.t, err)
+}
+
+func (s *fakeServer) readLine() string {
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := s.br.ReadString('\n')
+	assert.NoError(s.t, err)
+	return strings.TrimRight(line, "\r\n")
+}
+
+// readPub 读取一个 PUB，返回 subject、reply 和 payload
+func (s *fakeServer) readPub() (string, string, string) {
+	fields := strings.Fields(s.readLine())
+	if !assert.True(s.t, len(fields) == 3 || len(fields) == 4, fields) || !assert.Equal(s.t, "PUB", fields[0]) {
+		s.t.FailNow()
+	}
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	assert.NoError(s.t, err)
+	buf := make([]byte, n+2)
+	_, err = io.ReadFull(s.br, buf)
+	assert.NoError(s.t, err)
+	if len(fields) == 4 {
+		return fields[1], fields[2], string(buf[:n])
+	}
+	return fields[1], "", string(buf[:n])
+}
+
+func newTestReader(t *testing.T, c conf.MapConf) *Reader {
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: MetaDir,
+		reader.KeyFileDone: MetaDir,
+		reader.KeyMode:     reader.ModeNATS,
+		KeyRunnerName:      t.Name(),
+	})
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return r.(*Reader)
+}
+
+func readLine(t *testing.T, r *Reader) string {
+	for i := 0; i < 5; i++ {
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestNATSReader(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	r := newTestReader(t, conf.MapConf{
+		reader.KeyNATSServers:    "nats://user:pass@" + l.Addr().String(),
+		reader.KeyNATSSubjects:   "logs.a, logs.>",
+		reader.KeyNATSQueueGroup: "logkit",
+	})
+	defer r.Close()
+	_, ok := r.MessageMeta()
+	assert.False(t, ok)
+	assert.NoError(t, r.Start())
+	s, connect := acceptClient(t, l)
+	defer s.conn.Close()
+	assert.Equal(t, "user", connect["user"])
+	assert.Equal(t, "pass", connect["pass"])
+	assert.Equal(t, "SUB logs.a logkit 1", s.readLine())
+	assert.Equal(t, "SUB logs.> logkit 2", s.readLine())
+
+	s.write("PING\r\nMSG logs.a 1 5\r\nhello\r\n")
+	assert.Equal(t, "PONG", s.readLine())
+	s.write("MSG logs.b.c 2 _INBOX.reply 5\r\nworld\r\n")
+	assert.Equal(t, "hello", readLine(t, r))
+	meta, ok := r.MessageMeta()
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"subject": "logs.a"}, meta)
+	assert.Equal(t, "world", readLine(t, r))
+	meta, _ = r.MessageMeta()
+	assert.Equal(t, map[string]interface{}{"subject": "logs.b.c"}, meta)
+
+	// 服务端返回错误后重连
+	s.write("-ERR 'Stale Connection'\r\n")
+	s.conn.Close()
+	s, _ = acceptClient(t, l)
+	defer s.conn.Close()
+	assert.Equal(t, "SUB logs.a logkit 1", s.readLine())
+	assert.Contains(t, r.Status().LastError, "Stale Connection")
+}
+
+func TestNATSJetStream(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	r := newTestReader(t, conf.MapConf{
+		reader.KeyNATSServers:   "nats://" + l.Addr().String(),
+		reader.KeyNATSSubjects:  "logs.>",
+		reader.KeyNATSJetStream: "true",
+		reader.KeyNATSStream:    "LOGS",
+		reader.KeyNATSBatchSize: "2",
+		reader.KeyNATSToken:     "secret",
+	})
+	defer r.Close()
+	assert.Equal(t, "logkit_TestNATSJetStream", r.durable)
+	assert.NoError(t, r.Start())
+	s, connect := acceptClient(t, l)
+	defer s.conn.Close()
+	assert.Equal(t, "secret", connect["auth_token"])
+	assert.Equal(t, true, connect["headers"])
+
+	fields := strings.Fields(s.readLine())
+	assert.Equal(t, "SUB", fields[0])
+	inbox := strings.TrimSuffix(fields[1], ".*")
+	subject, reply, payload := s.readPub()
+	assert.Equal(t, "$JS.API.CONSUMER.DURABLE.CREATE.LOGS.logkit_TestNATSJetStream", subject)
+	assert.Equal(t, inbox+".api", reply)
+	assert.JSONEq(t, `{"stream_name":"LOGS","config":{"durable_name":"logkit_TestNATSJetStream","deliver_policy":"all",
+		"ack_policy":"explicit","ack_wait":60000000000,"filter_subject":"logs.>"}}`, payload)
+	resp := `{"type":"io.nats.jetstream.api.v1.consumer_create_response","name":"logkit_TestNATSJetStream"}`
+	s.write(fmt.Sprintf("MSG %v 1 %v\r\n%v\r\n", reply, len(resp), resp))
+
+	subject, reply, payload = s.readPub()
+	assert.Equal(t, "$JS.API.CONSUMER.MSG.NEXT.LOGS.logkit_TestNATSJetStream", subject)
+	assert.Equal(t, inbox+".pull", reply)
+	assert.JSONEq(t, `{"batch":2,"expires":5000000000}`, payload)
+	s.write("MSG logs.a 1 $JS.ACK.LOGS.logkit_TestNATSJetStream.1.7.1.1530000000000000000.1 5\r\nhello\r\n")
+	status := "NATS/1.0 408 Request Timeout\r\n\r\n"
+	s.write(fmt.Sprintf("HMSG %v 1 %v %v\r\n%v\r\n", reply, len(status), len(status), status))
+
+	// 拉取超时后再次拉取
+	subject, _, _ = s.readPub()
+	assert.Equal(t, "$JS.API.CONSUMER.MSG.NEXT.LOGS.logkit_TestNATSJetStream", subject)
+	s.write("MSG logs.b 1 $JS.ACK.LOGS.logkit_TestNATSJetStream.2.9.2.1530000000000000000.0 5\r\nworld\r\n")
+	assert.Equal(t, "hello", readLine(t, r))
+	meta, _ := r.MessageMeta()
+	assert.Equal(t, map[string]interface{}{"subject": "logs.a", "sequence": uint64(7)}, meta)
+	assert.Equal(t, "world", readLine(t, r))
+	meta, _ = r.MessageMeta()
+	assert.Equal(t, map[string]interface{}{"subject": "logs.b", "sequence": uint64(9)}, meta)
+
+	r.SyncMeta()
+	subject, _, payload = s.readPub()
+	assert.Equal(t, "$JS.ACK.LOGS.logkit_TestNATSJetStream.1.7.1.1530000000000000000.1", subject)
+	assert.Equal(t, "+ACK", payload)
+	subject, _, _ = s.readPub()
+	assert.Equal(t, "$JS.ACK.LOGS.logkit_TestNATSJetStream.2.9.2.1530000000000000000.0", subject)
+}
+
+func TestNATSJetStreamError(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	r := newTestReader(t, conf.MapConf{
+		reader.KeyNATSServers:   "nats://" + l.Addr().String(),
+		reader.KeyNATSJetStream: "true",
+		reader.KeyNATSStream:    "LOGS",
+		reader.KeyNATSDurable:   "my.durable",
+	})
+	defer r.Close()
+	assert.Equal(t, "my_durable", r.durable)
+	assert.NoError(t, r.Start())
+	s, _ := acceptClient(t, l)
+	defer s.conn.Close()
+	s.readLine()
+	_, reply, payload := s.readPub()
+	assert.NotContains(t, payload, "filter_subject")
+	resp := `{"type":"io.nats.jetstream.api.v1.consumer_create_response","error":{"code":404,"err_code":10059,"description":"stream not found"}}`
+	s.write(fmt.Sprintf("MSG %v 1 %v\r\n%v\r\n", reply, len(resp), resp))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "create consumer my_durable on stream LOGS error: JetStream API error 404(10059): stream not found", r.Status().LastError)
+
+	_, err = NewReader(r.meta, conf.MapConf{reader.KeyNATSSubjects: "a", reader.KeyNATSJetStream: "true"})
+	assert.Error(t, err)
+	_, err = NewReader(r.meta, conf.MapConf{})
+	assert.Error(t, err)
+	_, err = NewReader(r.meta, conf.MapConf{reader.KeyNATSServers: "http://127.0.0.1", reader.KeyNATSSubjects: "a"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端协议中 reader 用到的操作
+const (
+	opInfo = "INFO"
+	opMsg  = "MSG"
+	opHMsg = "HMSG"
+	opPing = "PING"
+	opPong = "PONG"
+	opOK   = "+OK"
+	opErr  = "-ERR"
+
+	headerLine = "NATS/1.0"
+)
+
+type serverInfo struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	TLSRequired  bool   `json:"tls_required"`
+	AuthRequired bool   `json:"auth_required"`
+	Headers      bool   `json:"headers"`
+	JetStream    bool   `json:"jetstream"`
+}
+
+type connectInfo struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	TLSRequired  bool   `json:"tls_required"`
+	Name         string `json:"name"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	AuthToken    string `json:"auth_token,omitempty"`
+}
+
+// message 是服务端发送的 MSG 或 HMSG，status 是 header 第一行中的状态码，如 JetStream 拉取超时的 408
+type message struct {
+	subject string
+	sid     int
+	reply   string
+	status  int
+	desc    string
+	data    []byte
+}
+
+type operation struct {
+	name string
+	args string
+	msg  *message
+}
+
+// conn 是到 NATS 服务端的一个连接，读操作只在一个 goroutine 中进行，写操作可以并发
+type conn struct {
+	net.Conn
+	br   *bufio.Reader
+	info serverInfo
+	wmux sync.Mutex
+}
+
+// handshake 读取服务端的 INFO，需要时升级为 TLS，然后发送 CONNECT 并等待 PING 的回复
+func handshake(nc net.Conn, tlsConfig *tls.Config, ci connectInfo) (*conn, error) {
+	c := &conn{Conn: nc, br: bufio.NewReader(nc)}
+	op, err := c.readOp()
+	if err != nil {
+		return nil, err
+	}
+	if op.name != opInfo {
+		return nil, fmt.Errorf("expect INFO from server, got %v", op.name)
+	}
+	if err = json.Unmarshal([]byte(op.args), &c.info); err != nil {
+		return nil, fmt.Errorf("parse server INFO error: %v", err)
+	}
+	if tlsConfig == nil && c.info.TLSRequired {
+		return nil, errors.New("server requires TLS, please use tls:// in server address")
+	}
+	if tlsConfig != nil {
+		tc := tls.Client(nc, tlsConfig)
+		if err = tc.Handshake(); err != nil {
+			return nil, fmt.Errorf("tls handshake error: %v", err)
+		}
+		c.Conn, c.br = tc, bufio.NewReader(tc)
+		ci.TLSRequired = true
+	}
+	ci.Headers = c.info.Headers
+	ci.NoResponders = c.info.Headers
+	data, err := json.Marshal(ci)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.write("CONNECT " + string(data) + "\r\nPING\r\n"); err != nil {
+		return nil, err
+	}
+	for {
+		if op, err = c.readOp(); err != nil {
+			return nil, err
+		}
+		switch op.name {
+		case opPong:
+			return c, nil
+		case opErr:
+			return nil, fmt.Errorf("connect error: %v", op.args)
+		case opPing:
+			if err = c.write("PONG\r\n"); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readOp 读取一个操作，MSG 和 HMSG 会同时读取 header 和 payload
+func (c *conn) readOp() (*operation, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	op := &operation{name: line, args: ""}
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		op.name, op.args = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	op.name = strings.ToUpper(op.name)
+	switch op.name {
+	case opMsg, opHMsg:
+		op.msg, err = c.readMsg(op.name == opHMsg, op.args)
+	case opErr:
+		op.args = strings.Trim(op.args, "'")
+	}
+	return op, err
+}
+
+// readMsg 解析 MSG <subject> <sid> [reply-to] <#bytes> 或者
+// HMSG <subject> <sid> [reply-to] <#header bytes> <#total bytes>，然后读取数据
+func (c *conn) readMsg(hasHeader bool, args string) (*message, error) {
+	fields := strings.Fields(args)
+	n := 3
+	if hasHeader {
+		n = 4
+	}
+	if len(fields) != n && len(fields) != n+1 {
+		return nil, fmt.Errorf("invalid message arguments %q", args)
+	}
+	msg := &message{subject: fields[0]}
+	var err error
+	if msg.sid, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, fmt.Errorf("invalid message sid %q", fields[1])
+	}
+	if len(fields) == n+1 {
+		msg.reply = fields[2]
+	}
+	sizes := fields[len(fields)-n+2:]
+	total, err := strconv.Atoi(sizes[len(sizes)-1])
+	if err != nil || total < 0 {
+		return nil, fmt.Errorf("invalid message size %q", sizes[len(sizes)-1])
+	}
+	headerSize := 0
+	if hasHeader {
+		if headerSize, err = strconv.Atoi(sizes[0]); err != nil || headerSize < 0 || headerSize > total {
+			return nil, fmt.Errorf("invalid message header size %q", sizes[0])
+		}
+	}
+	buf := make([]byte, total+2)
+	if _, err = io.ReadFull(c.br, buf); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(buf, []byte("\r\n")) {
+		return nil, errors.New("message is not terminated by CRLF")
+	}
+	if hasHeader {
+		msg.status, msg.desc = parseStatus(buf[:headerSize])
+	}
+	msg.data = buf[headerSize:total]
+	return msg, nil
+}
+
+// parseStatus 解析 header 第一行 NATS/1.0 [status [description]]，没有状态码时返回 0
+func parseStatus(header []byte) (int, string) {
+	line := string(header)
+	if i := strings.Index(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, headerLine) {
+		return 0, ""
+	}
+	fields := strings.SplitN(strings.TrimSpace(line[len(headerLine):]), " ", 2)
+	status, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, ""
+	}
+	if len(fields) == 2 {
+		return status, fields[1]
+	}
+	return status, ""
+}
+
+func (c *conn) write(s string) error {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	c.SetWriteDeadline(time.Now().Add(connectTimeout))
+	_, err := io.WriteString(c.Conn, s)
+	return err
+}
+
+func (c *conn) subscribe(subject, queue string, sid int) error {
+	if queue != "" {
+		return c.write(fmt.Sprintf("SUB %v %v %v\r\n", subject, queue, sid))
+	}
+	return c.write(fmt.Sprintf("SUB %v %v\r\n", subject, sid))
+}
+
+func (c *conn) publish(subject, reply string, data []byte) error {
+	if reply != "" {
+		return c.write(fmt.Sprintf("PUB %v %v %v\r\n%s\r\n", subject, reply, len(data), data))
+	}
+	return c.write(fmt.Sprintf("PUB %v %v\r\n%s\r\n", subject, len(data), data))
+}
@@ -3,6 +3,8 @@ package reader
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/qiniu/log"
 
@@ -28,6 +30,21 @@ type DataReader interface {
 	ReadData() (Data, int64, error)
 }
 
+// StructuredReader 代表读取的数据本身就是结构化的读取器，如 mongo 的文档、kafka 中的 JSON 消息，
+// 它们的 ReadLine 返回序列化后的 JSON 字符串。当 parser 实现了 parser.DataParser 时，runner 会改用
+// ReadStructured 直接读取数据，省去序列化成字符串后再由 parser 反序列化的开销
+type StructuredReader interface {
+	// ReadStructured 读取一条数据以及数据的实际读取字节，无法转为结构化数据时返回只包含 KeyPandoraStash 的原始字符串
+	ReadStructured() (Data, int64, error)
+}
+
+// BytesReader 代表可以把一行数据追加到调用方提供的 buffer 中的读取器，
+// 调用方可以复用 buffer（参见 GetLineBuffer），避免每一行都分配一个新的字符串
+type BytesReader interface {
+	// ReadLineBytes 把读到的一行追加到 dst 后返回，返回的切片归调用方所有
+	ReadLineBytes(dst []byte) ([]byte, error)
+}
+
 // StatsReader 是一个通用的带有统计接口的reader
 type StatsReader interface {
 	//Name reader名称
@@ -35,11 +52,63 @@ type StatsReader interface {
 	Status() StatsInfo
 }
 
+// FileStatus 是同时读取多个文件的 reader 中单个文件的读取状态
+type FileStatus struct {
+	Path      string    `json:"path"`
+	RealPath  string    `json:"real_path"`
+	Inode     uint64    `json:"inode"`
+	Offset    int64     `json:"offset"`
+	Lag       int64     `json:"lag"`
+	LastRead  time.Time `json:"last_read,omitempty"`
+	Lines     int64     `json:"lines"`
+	Errors    int64     `json:"errors"`
+	LastError string    `json:"last_error,omitempty"`
+	Inactive  bool      `json:"inactive"`
+}
+
+// DetailedStatusReader 可以返回每个文件的读取状态，StatsReader 中汇总的 LastError 无法看出是哪个文件出了问题
+type DetailedStatusReader interface {
+	DetailedStatus() []FileStatus
+}
+
 //获取数据lag的接口
 type LagReader interface {
 	Lag() (*LagInfo, error)
 }
 
+// TruncateDetector 的 FileReader 可以检测文件被原地截断(如 >file 或者 logrotate 的 copytruncate)，截断后从头开始读取
+type TruncateDetector interface {
+	DetectTruncate() (bool, error)
+}
+
+// SourceMeta 是一行数据在源文件中的位置
+type SourceMeta struct {
+	Path   string
+	Inode  uint64
+	Offset int64 // 这一行在文件中的起始位置，gzip 文件为解压后的位置
+	// Truncated 表示这一行超过了 max_line_length，被截断或者拆分成了多条
+	Truncated bool
+}
+
+// SourceMetaReader 可以返回最近一次 ReadLine 读到的数据所在的文件和位置，
+// 配置了 KeySourceMetaTag 时 runner 会把它加入到解析后的数据中
+type SourceMetaReader interface {
+	// SourceMeta 返回最近一次读到的数据的位置，位置未知时返回 false
+	SourceMeta() (SourceMeta, bool)
+}
+
+// MessageMetaReader 可以返回最近一次 ReadLine 读到的消息的元信息，如消息队列中的 subject 和序号，
+// 配置了 KeySourceMetaTag 时 runner 会把它加入到解析后的数据中
+type MessageMetaReader interface {
+	// MessageMeta 返回最近一次读到的消息的元信息，还没有读到消息时返回 false
+	MessageMeta() (map[string]interface{}, bool)
+}
+
+// FilePositioner 的 FileReader 可以返回当前读取的文件 inode 以及已经读取到的 offset
+type FilePositioner interface {
+	Position() (inode uint64, offset int64)
+}
+
 // FileReader reader 接口方法
 type FileReader interface {
 	Name() string
@@ -73,19 +142,61 @@ const (
 	KeyMysqlEncoding     = "encoding"
 	KeyReadIOLimit       = "readio_limit"
 	KeyDataSourceTag     = "datasource_tag"
+	KeySourceMetaTag     = "sourcemeta_tag"
 	KeyTagFile           = "tag_file"
 	KeyHeadPattern       = "head_pattern"
 	KeyNewFileNewLine    = "newfile_newline"
 	KeySkipFileFirstLine = "skip_first_line"
+	KeyMarkFileFirstLine = "mark_first_line"
 
 	// 忽略隐藏文件
 	KeyIgnoreHiddenFile = "ignore_hidden"
 	KeyIgnoreFileSuffix = "ignore_file_suffix"
 	KeyValidFilePattern = "valid_file_pattern"
 
-	KeyExpire       = "expire"
-	KeyMaxOpenFiles = "max_open_files"
-	KeyStatInterval = "stat_interval"
+	KeyExpire         = "expire"
+	KeyMaxOpenFiles   = "max_open_files"
+	KeyStatInterval   = "stat_interval"
+	KeyStatMode       = "stat_mode"
+	KeyLogPathExclude = "log_path_exclude"
+
+	KeyTailxEOFSleep        = "tailx_eof_sleep"
+	KeyTailxIdleSleep       = "tailx_idle_sleep"
+	KeyTailxInactiveTimeout = "tailx_inactive_timeout"
+	KeyTailxBackoff         = "tailx_backoff"
+	KeyTailxMaxSleep        = "tailx_max_sleep"
+
+	KeyStartTime = "start_time"
+
+	KeyReadSpeedLimit      = "read_speed_limit"
+	KeyReadSpeedLimitTotal = "read_speed_limit_total"
+
+	// 去重窗口保留最近多少条不同数据的哈希值，0 表示不去重；dedup_ttl 是数据第一次出现之后多长时间内的重复数据会被丢弃
+	KeyDedupWindow = "dedup_window"
+	KeyDedupTTL    = "dedup_ttl"
+
+	// 在 reader 中按照正则表达式过滤数据，配置 line_include_pattern 时只保留匹配的数据，匹配 line_exclude_pattern 的数据被丢弃
+	KeyLineIncludePattern = "line_include_pattern"
+	KeyLineExcludePattern = "line_exclude_pattern"
+
+	// 切分数据的分隔符，默认为换行；line_delimiter 为固定的字节序列，支持 \r\n、\x1e 这样的转义写法，
+	// line_delimiter_regex 为正则表达式，两者只能配置一个
+	KeyLineDelimiter      = "line_delimiter"
+	KeyLineDelimiterRegex = "line_delimiter_regex"
+
+	// 一行最多读取的字节数，为 0 时不限制；超过时根据 max_line_action 截断或者拆分成多条
+	KeyMaxLineLength = "max_line_length"
+	KeyMaxLineAction = "max_line_action"
+
+	// 配置 head_pattern 时，已经缓存的多行数据超过 multiline_timeout 没有新的数据或者缓存的行数达到 multiline_max_lines 时直接发送，
+	// 不再等待下一个行首，都为 0 时不限制
+	KeyMultiLineTimeout  = "multiline_timeout"
+	KeyMultiLineMaxLines = "multiline_max_lines"
+
+	// 另一种多行模式，匹配 continue_pattern 的行根据 continue_match 追加到上一行后面(after)或者和下一行拼接(before)，
+	// 不能和 head_pattern 同时配置
+	KeyContinuePattern = "continue_pattern"
+	KeyContinueMatch   = "continue_match"
 
 	KeyMysqlOffsetKey   = "mysql_offset_key"
 	KeyMysqlReadBatch   = "mysql_limit_batch"
@@ -97,6 +208,10 @@ const (
 	KeyMysqlHistoryAll  = "mysql_history_all"
 	KyeMysqlTable       = "mysql_table"
 
+	KeyMySQLBinlogServerID = "mysql_binlog_server_id"
+	KeyMySQLBinlogTables   = "mysql_binlog_tables"
+	KeyMySQLBinlogGTID     = "mysql_binlog_gtid"
+
 	KeySQLSchema        = "sql_schema"
 	KeyMagicLagDuration = "magic_lag_duration"
 
@@ -108,13 +223,14 @@ const (
 	KeyMssqlCron        = "mssql_cron"
 	KeyMssqlExecOnStart = "mssql_exec_onstart"
 
-	KeyPGsqlOffsetKey   = "postgres_offset_key"
-	KeyPGsqlReadBatch   = "postgres_limit_batch"
-	KeyPGsqlDataSource  = "postgres_datasource"
-	KeyPGsqlDataBase    = "postgres_database"
-	KeyPGsqlSQL         = "postgres_sql"
-	KeyPGsqlCron        = "postgres_cron"
-	KeyPGsqlExecOnStart = "postgres_exec_onstart"
+	KeyPGsqlOffsetKey    = "postgres_offset_key"
+	KeyPGsqlReadBatch    = "postgres_limit_batch"
+	KeyPGsqlDataSource   = "postgres_datasource"
+	KeyPGsqlDataBase     = "postgres_database"
+	KeyPGsqlSQL          = "postgres_sql"
+	KeyPGsqlCron         = "postgres_cron"
+	KeyPGsqlExecOnStart  = "postgres_exec_onstart"
+	KeyPGsqlTimestampKey = "postgres_timestamp_key"
 
 	KeyESReadBatch = "es_limit_batch"
 	KeyESIndex     = "es_index"
@@ -133,6 +249,13 @@ const (
 	KeyMongoFilters     = "mongo_filters"
 	KeyMongoCert        = "mongo_cacert"
 
+	KeyMongoStreamType   = "mongo_stream_type"
+	KeyMongoUpdateLookup = "mongo_update_lookup"
+
+	MongoStreamAuto         = "auto"
+	MongoStreamChangeStream = "change_stream"
+	MongoStreamOplog        = "oplog"
+
 	KeyKafkaGroupID          = "kafka_groupid"
 	KeyKafkaTopic            = "kafka_topic"
 	KeyKafkaZookeeper        = "kafka_zookeeper"
@@ -142,6 +265,8 @@ const (
 	KeyExecInterpreter   = "script_exec_interprepter"
 	KeyScriptCron        = "script_cron"
 	KeyScriptExecOnStart = "script_exec_onstart"
+	KeyScriptTimeout     = "script_timeout"
+	KeyScriptReadStderr  = "script_read_stderr"
 
 	KeyErrDirectReturn = "errDirectReturn"
 )
@@ -152,34 +277,78 @@ var defaultIgnoreFileSuffix = []string{
 
 // FileReader's modes
 const (
-	ModeDir        = "dir"
-	ModeFile       = "file"
-	ModeTailx      = "tailx"
-	ModeFileAuto   = "fileauto"
-	ModeMySQL      = "mysql"
-	ModeMSSQL      = "mssql"
-	ModePostgreSQL = "postgres"
-	ModeElastic    = "elastic"
-	ModeMongo      = "mongo"
-	ModeKafka      = "kafka"
-	ModeRedis      = "redis"
-	ModeSocket     = "socket"
-	ModeHTTP       = "http"
-	ModeScript     = "script"
-	ModeSnmp       = "snmp"
-	ModeCloudWatch = "cloudwatch"
-	ModeCloudTrail = "cloudtrail"
+	ModeDir         = "dir"
+	ModeFile        = "file"
+	ModeTailx       = "tailx"
+	ModeFileAuto    = "fileauto"
+	ModeMySQL       = "mysql"
+	ModeMySQLBinlog = "mysql_binlog"
+	ModeMSSQL       = "mssql"
+	ModePostgreSQL  = "postgres"
+	ModeElastic     = "elastic"
+	ModeMongo       = "mongo"
+	ModeMongoStream = "mongo_stream"
+	ModeKafka       = "kafka"
+	ModeRedis       = "redis"
+	ModeSocket      = "socket"
+	ModeHTTP        = "http"
+	ModeScript      = "script"
+	ModeSnmp        = "snmp"
+	ModeSnmpTrap    = "snmp_trap"
+	ModeCloudWatch  = "cloudwatch"
+	ModeCloudTrail  = "cloudtrail"
+	ModeLoopback    = "loopback"
+	ModeK8s         = "k8s"
+	ModeJournald    = "journald"
+	ModeWinEventLog = "wineventlog"
+	ModeDocker      = "docker"
+	ModeS3          = "s3"
+	ModeKafkaGroup  = "kafka_group"
+	ModeSyslog      = "syslog"
+	ModeMQTT        = "mqtt"
+	ModeGRPC        = "grpc"
+	ModeNATS        = "nats"
 )
 
 const (
 	ReadModeHeadPatternString = "mode_head_pattern_string"
 	ReadModeHeadPatternRegexp = "mode_head_pattern_regexp"
+	ReadModeContinuePattern   = "mode_continue_pattern"
+)
+
+// KeyContinueMatch 的可选项，匹配 continue_pattern 的行属于上一条数据还是和下一行属于同一条数据
+const (
+	ContinueMatchAfter  = "after"
+	ContinueMatchBefore = "before"
 )
 
 // KeyWhence 的可选项
 const (
 	WhenceOldest = "oldest"
 	WhenceNewest = "newest"
+	// WhenceFromTime 只有 tailx 支持，修改时间早于 KeyStartTime 的文件从末尾开始读取，其他文件从头开始读取
+	WhenceFromTime = "from_time"
+)
+
+// KeyLogPathExclude 中以此开头的是正则表达式，其他为通配符
+const ExcludeRegexPrefix = "regex:"
+
+// KeyStatMode 的可选项，tailx 通过定时扫描还是文件系统通知(inotify 等)发现新文件
+const (
+	StatModePoll  = "poll"
+	StatModeWatch = "watch"
+)
+
+// KeyMaxLineAction 的可选项，超过 max_line_length 的部分丢弃还是作为新的一行
+const (
+	MaxLineTruncate = "truncate"
+	MaxLineSplit    = "split"
+)
+
+// KeyTailxBackoff 的可选项，tailx 连续读不到内容时休息时间固定还是指数增长
+const (
+	TailxBackoffFixed       = "fixed"
+	TailxBackoffExponential = "exponential"
 )
 
 const (
@@ -193,6 +362,31 @@ const (
 	StatusRunning
 )
 
+// 超过该大小的 buffer 不再放回 pool，避免偶尔的大批次长期占用内存
+const maxPooledLineBufferSize = 32 * 1024 * 1024
+
+var lineBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 64*1024)
+		return &buf
+	},
+}
+
+// GetLineBuffer 从 pool 中获取一个长度为 0 的 buffer，用完后调用 PutLineBuffer 归还
+func GetLineBuffer() *[]byte {
+	buf := lineBufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// PutLineBuffer 归还 buffer，归还后调用方不能再引用其中的数据
+func PutLineBuffer(buf *[]byte) {
+	if buf == nil || cap(*buf) > maxPooledLineBufferSize {
+		return
+	}
+	lineBufferPool.Put(buf)
+}
+
 func NewReader(conf conf.MapConf, errDirectReturn bool) (reader Reader, err error) {
 	rs := NewRegistry()
 	return rs.NewReader(conf, errDirectReturn)
@@ -257,6 +451,13 @@ func (reg *Registry) NewReaderWithMeta(conf conf.MapConf, meta *Meta, errDirectR
 	}
 	mode, _ := conf.GetStringOr(KeyMode, ModeDir)
 	headPattern, _ := conf.GetStringOr(KeyHeadPattern, "")
+	continuePattern, err := NewContinuePatternWithConf(conf)
+	if err != nil {
+		return
+	}
+	if headPattern != "" && continuePattern != nil {
+		return nil, fmt.Errorf("%v and %v can not be set at the same time", KeyHeadPattern, KeyContinuePattern)
+	}
 
 	constructor, exist := reg.readerTypeMap[mode]
 	if !exist {
@@ -270,6 +471,9 @@ func (reg *Registry) NewReaderWithMeta(conf conf.MapConf, meta *Meta, errDirectR
 	if headPattern != "" {
 		err = reader.SetMode(ReadModeHeadPatternString, headPattern)
 	}
+	if continuePattern != nil {
+		err = reader.SetMode(ReadModeContinuePattern, continuePattern)
+	}
 	return
 }
 
@@ -287,12 +491,47 @@ func NewFileDirReader(meta *Meta, conf conf.MapConf) (reader Reader, err error)
 	validFilesRegex, _ := conf.GetStringOr(KeyValidFilePattern, "*")
 	newfileNewLine, _ := conf.GetBoolOr(KeyNewFileNewLine, false)
 	skipFirstLine, _ := conf.GetBoolOr(KeySkipFileFirstLine, false)
+	markFirstLine, _ := conf.GetBoolOr(KeyMarkFileFirstLine, false)
+	dedup, err := NewDeduperWithConf(conf)
+	if err != nil {
+		return
+	}
+	filter, err := NewLineFilterWithConf(conf)
+	if err != nil {
+		return
+	}
+	delimiter, err := NewDelimiterWithConf(conf)
+	if err != nil {
+		return
+	}
+	maxLineLength, maxLineAction, err := MaxLineConf(conf)
+	if err != nil {
+		return
+	}
+	multiLineTimeout, multiLineMaxLines, err := MultiLineConf(conf)
+	if err != nil {
+		return
+	}
 	fr, err := NewSeqFile(meta, logpath, ignoreHidden, newfileNewLine, ignoreFileSuffix, validFilesRegex, whence)
 	if err != nil {
 		return
 	}
 	fr.SkipFileFirstLine = skipFirstLine
-	return NewReaderSize(fr, meta, bufSize)
+	br, err := NewReaderSize(fr, meta, bufSize)
+	if err != nil {
+		return
+	}
+	br.markFirstLine = markFirstLine
+	if _, offset := fr.Position(); markFirstLine && offset > 0 {
+		// 从 meta 中记录的位置继续读取时，当前文件的第一行之前已经读过了，重新返回保存的表头
+		br.restoreHeaderLine(fr.Source())
+	}
+	br.dedup = dedup
+	br.filter = filter
+	br.delimiter = delimiter
+	br.SetMaxLineLength(maxLineLength, maxLineAction)
+	br.SetMultiLineFlush(multiLineTimeout, multiLineMaxLines)
+	return br, nil
 }
 
 func NewSingleFileReader(meta *Meta, conf conf.MapConf) (reader Reader, err error) {
@@ -303,10 +542,71 @@ func NewSingleFileReader(meta *Meta, conf conf.MapConf) (reader Reader, err erro
 	bufSize, _ := conf.GetIntOr(KeyBufSize, DefaultBufSize)
 	whence, _ := conf.GetStringOr(KeyWhence, WhenceOldest)
 	errDirectReturn, _ := conf.GetBoolOr(KeyErrDirectReturn, true)
+	dedup, err := NewDeduperWithConf(conf)
+	if err != nil {
+		return
+	}
+	filter, err := NewLineFilterWithConf(conf)
+	if err != nil {
+		return
+	}
+	delimiter, err := NewDelimiterWithConf(conf)
+	if err != nil {
+		return
+	}
+	maxLineLength, maxLineAction, err := MaxLineConf(conf)
+	if err != nil {
+		return
+	}
+	multiLineTimeout, multiLineMaxLines, err := MultiLineConf(conf)
+	if err != nil {
+		return
+	}
 
 	fr, err := NewSingleFile(meta, logpath, whence, errDirectReturn)
 	if err != nil {
 		return
 	}
-	return NewReaderSize(fr, meta, bufSize)
+	br, err := NewReaderSize(fr, meta, bufSize)
+	if err != nil {
+		return
+	}
+	br.dedup = dedup
+	br.filter = filter
+	br.delimiter = delimiter
+	br.SetMaxLineLength(maxLineLength, maxLineAction)
+	br.SetMultiLineFlush(multiLineTimeout, multiLineMaxLines)
+	return br, nil
+}
+
+// MaxLineConf 解析 max_line_length 和 max_line_action
+func MaxLineConf(conf conf.MapConf) (length int, action string, err error) {
+	length, _ = conf.GetIntOr(KeyMaxLineLength, 0)
+	if length < 0 {
+		return 0, "", fmt.Errorf("%v should not be negative", KeyMaxLineLength)
+	}
+	action, _ = conf.GetStringOr(KeyMaxLineAction, MaxLineTruncate)
+	if action != MaxLineTruncate && action != MaxLineSplit {
+		return 0, "", fmt.Errorf("%v %v not supported, should be %v or %v", KeyMaxLineAction, action, MaxLineTruncate, MaxLineSplit)
+	}
+	return length, action, nil
+}
+
+// MultiLineConf 解析 multiline_timeout 和 multiline_max_lines
+func MultiLineConf(conf conf.MapConf) (timeout time.Duration, maxLines int, err error) {
+	timeoutStr, _ := conf.GetStringOr(KeyMultiLineTimeout, "")
+	if timeoutStr != "" {
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%v %q is not a valid duration: %v", KeyMultiLineTimeout, timeoutStr, err)
+		}
+		if timeout < 0 {
+			return 0, 0, fmt.Errorf("%v should not be negative", KeyMultiLineTimeout)
+		}
+	}
+	maxLines, _ = conf.GetIntOr(KeyMultiLineMaxLines, 0)
+	if maxLines < 0 {
+		return 0, 0, fmt.Errorf("%v should not be negative", KeyMultiLineMaxLines)
+	}
+	return timeout, maxLines, nil
 }
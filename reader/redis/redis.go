@@ -1,8 +1,10 @@
 package redis
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,15 @@ import (
 	. "github.com/qiniu/logkit/utils/models"
 )
 
+const (
+	// streamFile 是 meta 中保存每个 stream 最后读取的 id 的文件名
+	streamFile = "redis.stream"
+	// streamStartID 是没有读取记录的 stream 开始读取的位置，从头开始读取
+	streamStartID = "0-0"
+	// streamBatchCount 是 XREAD 每次读取的最大条数
+	streamBatchCount = 100
+)
+
 func init() {
 	reader.RegisterConstructor(reader.ModeRedis, NewReader)
 }
@@ -35,6 +46,10 @@ type Reader struct {
 
 	stats     StatsInfo
 	statsLock sync.RWMutex
+
+	// streamIDs 记录 stream 模式下每个 stream 最后读取的 id
+	streamIDs map[string]string
+	idLock    sync.Mutex
 }
 
 type Options struct {
@@ -77,13 +92,18 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (rr reader.Reader, err erro
 		timeout:  timeout,
 		dataType: dataType,
 	}
-	client := redis.NewClient(&redis.Options{
+	redisOpts := &redis.Options{
 		Addr:     opt.address,
 		DB:       opt.db,
 		Password: opt.password,
-	})
+	}
+	if dataType == reader.DataTypeStream {
+		// XREAD 的 BLOCK 时间内没有返回，读取超时需要比 BLOCK 时间长
+		redisOpts.ReadTimeout = timeout + 3*time.Second
+	}
+	client := redis.NewClient(redisOpts)
 
-	return &Reader{
+	r := &Reader{
 		meta:      meta,
 		opts:      opt,
 		client:    client,
@@ -93,7 +113,27 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (rr reader.Reader, err erro
 		mux:       sync.Mutex{},
 		started:   false,
 		statsLock: sync.RWMutex{},
-	}, nil
+		streamIDs: make(map[string]string),
+	}
+	if dataType == reader.DataTypeStream {
+		r.loadStreamIDs()
+	}
+	return r, nil
+}
+
+// loadStreamIDs 从 meta 中读取每个 stream 最后读取的 id
+func (rr *Reader) loadStreamIDs() {
+	data, err := rr.meta.ReadValue(streamFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Runner[%v] %v read meta error: %v, omit meta data...", rr.meta.RunnerName, rr.Name(), err)
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &rr.streamIDs); err != nil {
+		log.Errorf("Runner[%v] %v meta data is corrupted err: %v, omit meta data...", rr.meta.RunnerName, rr.Name(), err)
+		rr.streamIDs = make(map[string]string)
+	}
 }
 
 func (rr *Reader) Name() string {
@@ -155,9 +195,22 @@ func (s *Reader) sendError(err error) {
 	s.errChan <- err
 }
 
+// SyncMeta 只有 stream 模式需要保存读取进度，其他模式读取时就已经从 redis 中删除或者无法重新读取
 func (rr *Reader) SyncMeta() {
-	log.Debugf("Runner[%v] %v redis reader do not support meta sync", rr.meta.RunnerName, rr.Name())
-	return
+	if rr.opts.dataType != reader.DataTypeStream {
+		log.Debugf("Runner[%v] %v redis reader do not support meta sync", rr.meta.RunnerName, rr.Name())
+		return
+	}
+	rr.idLock.Lock()
+	data, err := json.Marshal(rr.streamIDs)
+	rr.idLock.Unlock()
+	if err != nil {
+		log.Errorf("Runner[%v] %v marshal meta error %v", rr.meta.RunnerName, rr.Name(), err)
+		return
+	}
+	if err = rr.meta.WriteValue(streamFile, data); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", rr.meta.RunnerName, rr.Name(), err)
+	}
 }
 
 func (rr *Reader) Start() {
@@ -177,6 +230,7 @@ func (rr *Reader) Start() {
 	case reader.DataTypeSet:
 	case reader.DateTypeSortedSet:
 	case reader.DateTypeHash:
+	case reader.DataTypeStream:
 	default:
 		err := fmt.Errorf("data Type < %v > not exist, exit", rr.opts.dataType)
 		log.Error(err)
@@ -296,6 +350,14 @@ func (rr *Reader) run() (err error) {
 					rr.readChan <- anHash
 				}
 			}
+		case reader.DataTypeStream:
+			if subErr := rr.readStreams(); subErr != nil {
+				err = fmt.Errorf("runner[%v] %v XREAD redis error %v", rr.meta.RunnerName, rr.Name(), subErr)
+				log.Error(err)
+				rr.setStatsError(err.Error())
+				rr.sendError(err)
+				time.Sleep(time.Second)
+			}
 		default:
 			err = fmt.Errorf("data Type < %v > not exist, exit", rr.opts.dataType)
 			log.Error(err)
@@ -306,6 +368,93 @@ func (rr *Reader) run() (err error) {
 	}
 }
 
+type streamEntry struct {
+	stream string
+	id     string
+	fields map[string]string
+}
+
+// readStreams 从所有 stream 上次读取的位置之后读取新的消息，每条消息的 field 组成一个 json 字符串
+func (rr *Reader) readStreams() error {
+	args := []interface{}{"XREAD", "COUNT", streamBatchCount, "BLOCK", int64(rr.opts.timeout / time.Millisecond), "STREAMS"}
+	for _, key := range rr.opts.key {
+		args = append(args, key)
+	}
+	rr.idLock.Lock()
+	for _, key := range rr.opts.key {
+		id, ok := rr.streamIDs[key]
+		if !ok {
+			id = streamStartID
+		}
+		args = append(args, id)
+	}
+	rr.idLock.Unlock()
+
+	cmd := redis.NewCmd(args...)
+	rr.client.Process(cmd)
+	res, err := cmd.Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries, err := parseStreamReply(res)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		data, err := json.Marshal(entry.fields)
+		if err != nil {
+			return err
+		}
+		rr.readChan <- string(data)
+		rr.idLock.Lock()
+		rr.streamIDs[entry.stream] = entry.id
+		rr.idLock.Unlock()
+	}
+	return nil
+}
+
+// parseStreamReply 解析 XREAD 的返回结果，格式为 [[stream, [[id, [field, value, ...]], ...]], ...]
+func parseStreamReply(res interface{}) ([]streamEntry, error) {
+	streams, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected XREAD reply %v", res)
+	}
+	var entries []streamEntry
+	for _, s := range streams {
+		stream, ok := s.([]interface{})
+		if !ok || len(stream) != 2 {
+			return nil, fmt.Errorf("unexpected XREAD stream reply %v", s)
+		}
+		name, ok := stream[0].(string)
+		items, ok2 := stream[1].([]interface{})
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("unexpected XREAD stream reply %v", s)
+		}
+		for _, item := range items {
+			msg, ok := item.([]interface{})
+			if !ok || len(msg) != 2 {
+				return nil, fmt.Errorf("unexpected XREAD entry %v", item)
+			}
+			id, ok := msg[0].(string)
+			kvs, ok2 := msg[1].([]interface{})
+			if !ok || !ok2 || len(kvs)%2 != 0 {
+				return nil, fmt.Errorf("unexpected XREAD entry %v", item)
+			}
+			fields := make(map[string]string, len(kvs)/2)
+			for i := 0; i < len(kvs); i += 2 {
+				field, _ := kvs[i].(string)
+				value, _ := kvs[i+1].(string)
+				fields[field] = value
+			}
+			entries = append(entries, streamEntry{stream: name, id: id, fields: fields})
+		}
+	}
+	return entries, nil
+}
+
 func (rr *Reader) SetMode(mode string, v interface{}) error {
 	return errors.New("RedisReader not support read mode")
 }
@@ -1,12 +1,14 @@
 package redis
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/qiniu/logkit/conf"
 	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
 	. "github.com/qiniu/logkit/utils/models"
 )
 
@@ -21,3 +23,47 @@ func TestNewRedisReader(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, StatsInfo{}, rr.Status())
 }
+
+func TestParseStreamReply(t *testing.T) {
+	res := []interface{}{
+		[]interface{}{"s1", []interface{}{
+			[]interface{}{"1-0", []interface{}{"a", "1", "b", "2"}},
+			[]interface{}{"2-0", []interface{}{"a", "3"}},
+		}},
+		[]interface{}{"s2", []interface{}{
+			[]interface{}{"1-1", []interface{}{"c", "4"}},
+		}},
+	}
+	entries, err := parseStreamReply(res)
+	assert.NoError(t, err)
+	assert.Equal(t, []streamEntry{
+		{stream: "s1", id: "1-0", fields: map[string]string{"a": "1", "b": "2"}},
+		{stream: "s1", id: "2-0", fields: map[string]string{"a": "3"}},
+		{stream: "s2", id: "1-1", fields: map[string]string{"c": "4"}},
+	}, entries)
+
+	_, err = parseStreamReply([]interface{}{[]interface{}{"s1", []interface{}{[]interface{}{"1-0", []interface{}{"a"}}}}})
+	assert.Error(t, err)
+}
+
+func TestRedisStreamMeta(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	c := conf.MapConf{
+		reader.KeyMetaPath:      MetaDir,
+		reader.KeyFileDone:      MetaDir,
+		reader.KeyMode:          reader.ModeRedis,
+		reader.KeyRedisDataType: reader.DataTypeStream,
+		reader.KeyRedisKey:      "s1,s2",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	rr, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	r := rr.(*Reader)
+	r.streamIDs["s1"] = "2-0"
+	r.SyncMeta()
+
+	rr, err = NewReader(meta, c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"s1": "2-0"}, rr.(*Reader).streamIDs)
+}
@@ -20,6 +20,104 @@ const (
 	KeySyncConcurrent = "sync_concurrent"
 )
 
+// Constants for S3
+const (
+	KeyS3Endpoint    = "s3_endpoint"
+	KeyS3Compression = "s3_compression"
+	KeyS3SQSQueueURL = "s3_sqs_queue_url"
+
+	S3CompressionAuto = "auto"
+	S3CompressionGzip = "gzip"
+	S3CompressionNone = "none"
+)
+
+// Constants for KafkaGroup
+const (
+	KeyKafkaBrokers               = "kafka_brokers"
+	KeyKafkaTopicRegex            = "kafka_topic_regex"
+	KeyKafkaVersion               = "kafka_version"
+	KeyKafkaSASLMechanism         = "kafka_sasl_mechanism"
+	KeyKafkaSASLUsername          = "kafka_sasl_username"
+	KeyKafkaSASLPassword          = "kafka_sasl_password"
+	KeyKafkaTLS                   = "kafka_tls"
+	KeyKafkaTLSCAPath             = "kafka_tls_ca_path"
+	KeyKafkaTLSCertPath           = "kafka_tls_cert_path"
+	KeyKafkaTLSKeyPath            = "kafka_tls_key_path"
+	KeyKafkaTLSInsecureSkipVerify = "kafka_tls_insecure_skip_verify"
+
+	KafkaSASLNone        = "none"
+	KafkaSASLPlain       = "PLAIN"
+	KafkaSASLSCRAMSHA256 = "SCRAM-SHA-256"
+	KafkaSASLSCRAMSHA512 = "SCRAM-SHA-512"
+
+	DefaultKafkaVersion = "0.10.2.0"
+)
+
+// Constants for Syslog
+const (
+	KeySyslogAddress        = "syslog_address"
+	KeySyslogRFC            = "syslog_rfc"
+	KeySyslogMaxMessageSize = "syslog_max_message_size"
+	KeySyslogTLSCertPath    = "syslog_tls_cert_path"
+	KeySyslogTLSKeyPath     = "syslog_tls_key_path"
+	KeySyslogTLSCAPath      = "syslog_tls_ca_path"
+
+	SyslogRFCAuto = "automatic"
+	SyslogRFC3164 = "rfc3164"
+	SyslogRFC5424 = "rfc5424"
+
+	DefaultSyslogAddress        = "udp://0.0.0.0:514"
+	DefaultSyslogMaxMessageSize = 64 * 1024
+)
+
+// Constants for MQTT
+const (
+	KeyMQTTBroker             = "mqtt_broker"
+	KeyMQTTTopics             = "mqtt_topics"
+	KeyMQTTQoS                = "mqtt_qos"
+	KeyMQTTClientID           = "mqtt_client_id"
+	KeyMQTTUsername           = "mqtt_username"
+	KeyMQTTPassword           = "mqtt_password"
+	KeyMQTTKeepAlive          = "mqtt_keep_alive"
+	KeyMQTTInsecureSkipVerify = "mqtt_insecure_skip_verify"
+
+	DefaultMQTTQoS       = 0
+	DefaultMQTTKeepAlive = 30
+)
+
+// Constants for gRPC
+const (
+	KeyGRPCAddress        = "grpc_address"
+	KeyGRPCAuthToken      = "grpc_auth_token"
+	KeyGRPCMaxMessageSize = "grpc_max_message_size"
+	KeyGRPCTLSCertPath    = "grpc_tls_cert_path"
+	KeyGRPCTLSKeyPath     = "grpc_tls_key_path"
+	KeyGRPCTLSCAPath      = "grpc_tls_ca_path"
+
+	DefaultGRPCAddress        = "0.0.0.0:9600"
+	DefaultGRPCMaxMessageSize = 4 * 1024 * 1024
+)
+
+// Constants for NATS
+const (
+	KeyNATSServers            = "nats_servers"
+	KeyNATSSubjects           = "nats_subjects"
+	KeyNATSQueueGroup         = "nats_queue_group"
+	KeyNATSUsername           = "nats_username"
+	KeyNATSPassword           = "nats_password"
+	KeyNATSToken              = "nats_token"
+	KeyNATSInsecureSkipVerify = "nats_insecure_skip_verify"
+	KeyNATSJetStream          = "nats_jetstream"
+	KeyNATSStream             = "nats_stream"
+	KeyNATSDurable            = "nats_durable"
+	KeyNATSBatchSize          = "nats_batch_size"
+	KeyNATSAckWait            = "nats_ack_wait"
+
+	DefaultNATSServer    = "nats://127.0.0.1:4222"
+	DefaultNATSBatchSize = 100
+	DefaultNATSAckWait   = 60
+)
+
 // Constants for cloudwatch
 const (
 	KeyRegion = "region"
@@ -47,6 +145,11 @@ const (
 	KeyCacheTTL             = "cache_ttl"
 	KeyPeriod               = "period"
 	KeyDelay                = "delay"
+
+	// 读取 CloudWatch Logs 中的日志，配置了其中之一时 namespace 可以不填
+	KeyLogGroups       = "log_groups"
+	KeyLogGroupPattern = "log_group_pattern"
+	KeyLogStreamPrefix = "log_stream_prefix"
 )
 
 // Constants for Elastic
@@ -60,11 +163,58 @@ const (
 const (
 	KeyHTTPServiceAddress = "http_service_address"
 	KeyHTTPServicePath    = "http_service_path"
+	KeyHTTPAuthToken      = "http_auth_token"
 
 	DefaultHTTPServiceAddress = ":4000"
 	DefaultHTTPServicePath    = "/logkit/data"
 )
 
+// Constants for Loopback
+const (
+	KeyLoopbackName       = "loopback_name"
+	KeyLoopbackBuffer     = "loopback_buffer"
+	KeyLoopbackMemorySize = "loopback_memory_size"
+
+	LoopbackBufferMemory = "memory"
+	LoopbackBufferDisk   = "disk"
+)
+
+// Constants for K8s
+const (
+	KeyK8sLogFormat = "k8s_log_format"
+
+	K8sLogFormatAuto   = "auto"
+	K8sLogFormatDocker = "docker"
+	K8sLogFormatCRI    = "cri"
+
+	DefaultK8sLogPath = "/var/log/containers/*.log"
+)
+
+// Constants for Journald
+const (
+	KeyJournaldUnits      = "journald_units"
+	KeyJournaldPriority   = "journald_priority"
+	KeyJournaldDirectory  = "journald_directory"
+	KeyJournaldJournalctl = "journald_journalctl"
+
+	DefaultJournalctl = "journalctl"
+)
+
+// Constants for WinEventLog
+const (
+	KeyWinEventLogChannels = "wineventlog_channels"
+	KeyWinEventLogQuery    = "wineventlog_query"
+)
+
+// Constants for Docker
+const (
+	KeyDockerHost         = "docker_host"
+	KeyDockerLabelFilters = "docker_label_filters"
+	KeyDockerNameFilters  = "docker_name_filters"
+
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+)
+
 // Constants for Redis
 const (
 	DateTypeHash          = "hash"
@@ -74,6 +224,7 @@ const (
 	DataTypeList          = "list"
 	DataTypeChannel       = "channel"
 	DataTypePatterChannel = "pattern_channel"
+	DataTypeStream        = "stream"
 
 	KeyRedisDataType   = "redis_datatype" // 必填
 	KeyRedisDB         = "redis_db"       //默认 是0
@@ -111,6 +262,11 @@ const (
 
 	KeySnmpTableName = "snmp_table"
 	KeyTimestamp     = "timestamp"
+
+	KeySnmpTrapAddress  = "snmp_trap_address"
+	KeySnmpTrapMibPaths = "snmp_trap_mib_paths"
+
+	DefaultSnmpTrapAddress = "0.0.0.0:162"
 )
 
 // Constants for Socket
@@ -148,6 +304,14 @@ const (
 	// 0 表示关闭keep_alive
 	// 默认5分钟
 	KeySocketKeepAlivePeriod = "socket_keep_alive_period"
+
+	// TLS 服务端证书和私钥的路径，需要同时配置
+	// 仅用于 stream sockets (e.g. TCP).
+	KeySocketTLSCert = "socket_tls_cert"
+	KeySocketTLSKey  = "socket_tls_key"
+
+	// 客户端 CA 证书的路径，配置后要求客户端提供由该 CA 签发的证书
+	KeySocketTLSClientCA = "socket_tls_client_ca"
 )
 
 // ModeUsages 和 ModeTooltips 用途说明
@@ -158,18 +322,32 @@ var (
 		{ModeFile, "从文件读取( file 模式)"},
 		{ModeTailx, "从文件读取( tailx 模式)"},
 		{ModeMySQL, "从 MySQL 读取"},
+		{ModeMySQLBinlog, "从 MySQL binlog 读取数据变更"},
 		{ModeMSSQL, "从 MSSQL 读取"},
 		{ModePostgreSQL, "从 PostgreSQL 读取"},
 		{ModeElastic, "从 Elasticsearch 读取"},
 		{ModeMongo, "从 MongoDB 读取"},
+		{ModeMongoStream, "从 MongoDB 读取变更( change stream 模式)"},
 		{ModeKafka, "从 Kafka 读取"},
 		{ModeRedis, "从 Redis 读取"},
 		{ModeSocket, "从 Socket 读取"},
 		{ModeHTTP, "从 http 请求中读取"},
 		{ModeScript, "从脚本的执行结果中读取"},
 		{ModeSnmp, "从 SNMP 服务中读取"},
+		{ModeSnmpTrap, "接收 SNMP trap"},
 		{ModeCloudWatch, "从 AWS Cloudwatch 中读取"},
 		{ModeCloudTrail, "从 AWS CloudTrail 中读取"},
+		{ModeLoopback, "从同一个 logkit 中其他 runner 的 loopback sender 读取"},
+		{ModeK8s, "从 Kubernetes 容器日志读取"},
+		{ModeJournald, "从 systemd journal 读取"},
+		{ModeWinEventLog, "从 Windows 事件日志读取"},
+		{ModeDocker, "从 Docker API 读取容器日志"},
+		{ModeS3, "从 AWS S3 读取"},
+		{ModeKafkaGroup, "从 Kafka 读取( consumer group 模式)"},
+		{ModeSyslog, "接收 syslog 消息"},
+		{ModeMQTT, "订阅 MQTT 消息"},
+		{ModeGRPC, "通过 gRPC 接收日志"},
+		{ModeNATS, "订阅 NATS 消息"},
 	}
 
 	ModeToolTips = []KeyValue{
@@ -178,18 +356,32 @@ var (
 		{ModeFile, "logkit会不断读取文件追加的数据。该模式的经典日志存储方式类似于nginx的日志rotate方式，日志名称为固定的名称，如access.log,rotate时直接move成新的文件如access.log.1，新的数据仍然写入到access.log。"},
 		{ModeTailx, "展开并匹配所有符合表达式的文件，并持续读取所有有数据追加的文件。每隔stat_interval的时间，重新刷新一遍logpath模式串，添加新增的文件。该模式比较灵活，几乎可以读取所有日志更新，需要注意的是，使用tailx模式容易导致文件句柄打开过多。tailx模式的文件重复判断标准为文件名称，若使用rename, copy等方式改变日志名称，并且新的名字在logpath模式串的包含范围内，在read_from为oldest的情况下则会导致重复写入数据。"},
 		{ModeMySQL, "MySQL Reader是以定时任务的形式去执行mysql语句，将mysql读取到的内容全部获取则任务结束，等到下一个定时任务的到来，也可以仅执行一次。"},
+		{ModeMySQLBinlog, "MySQL Binlog Reader 作为从库连接 MySQL 读取 binlog，不需要反复执行 SQL 查询整个表。binlog_format 需要为 ROW，每一行的插入、更新、删除输出为包括 database、table、type、data、old 等字段的 json 字符串，需要使用json的parser解析，列名从 information_schema 中查询。读取的位置(binlog 文件名和位置，开启 gtid 时为 gtid 集合)在数据发送成功后保存在 meta 中，重启后从上次的位置继续读取；第一次启动时从主库当前的位置开始读取。使用的账号需要有 REPLICATION SLAVE、REPLICATION CLIENT 权限以及读取表结构的权限，并且使用 mysql_native_password 认证。"},
 		{ModeMSSQL, "Microsoft SQL Server Reader是以定时任务的形式去执行sql语句，将sql读取到的内容全部获取则任务结束，等到下一个定时任务的到来，也可以仅执行一次。"},
 		{ModePostgreSQL, "PostgreSQL Reader是以定时任务的形式去执行 PostgreSQL 查询语句，将 PostgreSQL 读取到的内容全部获取则任务结束，等到下一个定时任务的到来，也可以仅执行一次。"},
 		{ModeElastic, "Elasticsearch Reader 是logkit提供的从Elasticsearch读取日志的配置方式。Elasticsearch Reader输出的是json字符串，需要使用json的parser解析。"},
 		{ModeMongo, "MongoDB reader 是logkit提供的从MongoDB读取数据的配置方式。MongoDB reader 输出的是json字符串，需要使用json的parser解析。"},
+		{ModeMongoStream, "MongoDB Stream Reader 通过 change stream 读取 collection 中文档的插入、更新、替换和删除，不需要定时轮询整个 collection。MongoDB 3.6 以下的版本不支持 change stream，改为 tail local.oplog.rs 中这个 collection 的记录，两种方式都要求 MongoDB 以副本集方式部署。每个变更输出为包括 operationType、ns、documentKey、fullDocument、updateDescription 等字段的 json 字符串，需要使用json的parser解析。读取的位置(resume token 或者 oplog 的 ts)在数据发送成功后保存在 meta 中，重启后从上次的位置之后继续读取；第一次启动时从当前最新的位置开始读取，不读取之前已有的数据。"},
 		{ModeKafka, "Kafka reader 是logkit提供的从Kafka读取数据的配置方式。Kafka reader 输出的是raw data，可根据具体情况自定义parser进行解析。"},
-		{ModeRedis, "Redis Reader 是logkit提供的从Redis读取日志的配置方式。Redis Reader 输出的是redis中存储的字符串，具体字符串是什么格式，可以在parser中用对应方式解析。"},
+		{ModeRedis, "Redis Reader 是logkit提供的从Redis读取日志的配置方式。Redis Reader 输出的是redis中存储的字符串，具体字符串是什么格式，可以在parser中用对应方式解析。stream 模式下每条消息的所有 field 组成一个 json 字符串输出，最后读取的 stream id 保存在 meta 中，重启后从该位置继续读取。"},
 		{ModeSocket, `Socket Reader 是logkit提供的以端口监听的方式接受并读取日志的形式，主要支持tcp\udp\unix套接字 这三大类协议。`},
-		{ModeHTTP, `Http Reader 是 logkit 提供的以 http post 请求的方式接受并读取日志的形式。该 reader 支持 gzip, 但请在请求头中添加Content-Encoding=gzip 或者 Content-Type=application/gzip，默认接收 request body 中所有的数据作为要读取的日志, 限制 request body 小于 100MB，默认将 request body 中的数据使用 \n 分割, 每行作为一条数据`},
-		{ModeScript, "Script Reader是以定时任务的形式执行脚本，将脚本执行的结果全部获取则任务结束，等到下一个定时任务的到来，也可以仅执行一次。"},
+		{ModeHTTP, `Http Reader 是 logkit 提供的以 http post 请求的方式接受并读取日志的形式。该 reader 支持 gzip, 但请在请求头中添加Content-Encoding=gzip 或者 Content-Type=application/gzip，默认接收 request body 中所有的数据作为要读取的日志, 限制 request body 小于 100MB，默认将 request body 中的数据使用 \n 分割, 每行作为一条数据；Content-Type 为 application/json 且 body 为 JSON 数组时，数组中的每个元素作为一条数据；配置 http_auth_token 后需要在请求头中带上 Authorization: Bearer <token>；接收到的数据会先写入磁盘队列，重启后不会丢失`},
+		{ModeScript, "Script Reader是以定时任务的形式执行脚本，将脚本执行的结果全部获取则任务结束，等到下一个定时任务的到来，也可以仅执行一次。脚本退出码不为0或者超过script_timeout时视为执行失败，标准错误的内容会记录在错误信息中，3秒后重试。最近一次执行成功的时间保存在 meta 中，重启后如果错过了定时任务会立即补执行一次。"},
 		{ModeSnmp, "Snmp Reader 可以从 Snmp 服务中收集数据。snmp_fields 和 snmp_tables 这两项配置需要填入符合 json数组 格式的字符串, 字符串内的双引号需要转义。"},
+		{ModeSnmpTrap, "Snmp Trap Reader 监听 UDP 端口接收网络设备发送的 SNMP v2c 和 v3 trap，每个 trap 转为一行 JSON 数据，包括 trap_version、trap_source、trap_oid、trap_name、trap_uptime 以及 varbinds 字段，需要配合 json parser 使用。snmp_trap_mib_paths 中的 MIB 文件用于把 OID 转换为名称，INTEGER 类型的可选值转换为对应的标签。配置 snmp_sec_name 后接收该用户发送的 v3 trap，认证和加密参数与 snmp reader 相同。UDP 接收的数据无法重新读取，logkit 停止期间发送的 trap 会丢失。"},
 		{ModeCloudWatch, "CloudWatch Reader 可以从 AWS CloudWatch 服务的接口中获取数据。"},
 		{ModeCloudTrail, "CloudTrail Reader 可以从 AWS CloudTrail 服务的接口中获取数据。"},
+		{ModeLoopback, "Loopback Reader 读取同一个 logkit 中 loopback_name 相同的 loopback sender 发送的数据，读取到的已经是解析后的数据，不会再经过 parser，可以用来把多个 runner 串联起来，例如一个 runner 负责解析和聚合，再交给多个 runner 分别路由发送。多个 loopback reader 使用同一个 loopback_name 时每个 reader 都会收到一份完整的数据。注意不要让 runner 把数据发送给自己。"},
+		{ModeK8s, "K8s Reader 读取 kubelet 在 /var/log/containers 下为每个容器创建的日志文件，自动识别 docker json-file 和 CRI (containerd、CRI-O) 两种格式，去掉格式的包装后得到原始日志 log 以及 stream、time，并根据文件名加上 k8s_pod_name、k8s_namespace、k8s_container_name 和 k8s_container_id 字段。被容器运行时拆分成多行的长日志会重新拼接成一条。读取到的已经是结构化的数据，不会再经过 parser，可以使用 transformer 继续解析 log 字段。"},
+		{ModeJournald, "Journald Reader 通过 journalctl -o json --follow 读取 systemd journal，每条日志的所有字段(如 MESSAGE、PRIORITY、_SYSTEMD_UNIT、__REALTIME_TIMESTAMP)组成一条数据，不会再经过 parser。读取的位置(__CURSOR)在数据发送成功后保存在 meta 中，重启后从上次的位置之后继续读取。运行 logkit 的用户需要有读取 journal 的权限(如属于 systemd-journal 组)。"},
+		{ModeWinEventLog, "WinEventLog Reader 订阅 Windows 事件日志的 channel(如 Application、System、Security)，每个事件转为一条结构化的数据，包括 event_id、level、provider_name、time_created、event_data 以及事件的描述信息 message 等字段，不会再经过 parser。读取的位置(bookmark)在数据发送成功后保存在 meta 中，重启后从上次的位置之后继续读取。只能在 Windows 上使用，读取 Security 需要管理员权限。"},
+		{ModeDocker, "Docker Reader 通过 Docker API 列出满足 label 和名称过滤条件的容器，读取每个容器的 stdout 和 stderr，得到原始日志 log 以及 stream、time，并加上 docker_container_id、docker_container_name、docker_image 和 docker_labels 字段，不会再经过 parser。每个容器的读取位置(最后一条日志的时间戳)在数据发送成功后保存在各自的 meta 中，重启后从上次的位置之后继续读取。不依赖容器的日志驱动写入的文件，但需要能访问 Docker 的 socket。"},
+		{ModeS3, "S3 Reader 读取 S3 bucket 中 prefix 下的 object，如 ELB、ALB、CloudFront 写入的访问日志，gzip 压缩的 object 自动解压，按行读取后经过 parser 解析。新的 object 通过定期列出 prefix 发现，也可以配置接收 S3 事件通知的 SQS 队列，在 object 写入后立即读取。读取完成的 object 和正在读取的位置在数据发送成功后保存在 meta 中，每个 object 只读取一次。"},
+		{ModeKafkaGroup, "Kafka Group Reader 直接连接 Kafka 的 broker，使用 Kafka 的 consumer group 协议协同消费，读取进度在数据发送成功后提交到 Kafka 中，不依赖 zookeeper，需要 Kafka 0.9 及以上的版本。支持按正则表达式订阅 topic、SASL/PLAIN、SCRAM-SHA-256、SCRAM-SHA-512 认证以及 TLS 加密，lag 为分配到的各个 partition 中未读取的消息数之和。JSON 对象格式的消息直接解析为结构化的数据，其他消息交给 parser 处理。"},
+		{ModeSyslog, "Syslog Reader 作为 syslog 服务端监听 UDP、TCP 或者 TLS 端口接收 syslog 消息，可以代替 rsyslog 作为中转。TCP 和 TLS 连接上的消息支持 RFC6587 的 octet counting 以及换行分隔两种分帧方式。消息按照 RFC3164 或 RFC5424 格式解析为 priority、facility、severity、hostname、timestamp 等字段，不会再经过 parser，无法解析的消息原样放在 pandora_stash 字段中。网络接收的数据无法重新读取，logkit 停止期间发送的消息会丢失。"},
+		{ModeMQTT, "MQTT Reader 作为 MQTT 3.1.1 客户端订阅 broker 上的 topic，每条消息的 payload 作为一行数据，可以用来收集 IoT 设备的日志。QoS 为 0 时使用 clean session，logkit 停止期间发送的消息会丢失；QoS 为 1 时使用持久会话，消息发送成功后才回复 PUBACK，并把最后确认的消息 id 保存在 meta 中，未确认的消息 broker 会在重连后重新发送，重启前后需要保持 client id 不变。"},
+		{ModeGRPC, "gRPC Reader 提供 logkit.proto 中定义的 LogIngest 服务（proto 文件位于 reader/grpc/logkit.proto），应用通过双向流 Send 持续发送 LogRequest，每个请求中的日志写入磁盘缓存后才回复 LogResponse 确认累计接收的条数，重启后缓存中的数据不会丢失。gRPC 基于 HTTP/2，必须配置 TLS 证书；支持 gzip 压缩的消息，配置 grpc_auth_token 后需要在 metadata 中带上 authorization: Bearer <token>。"},
+		{ModeNATS, "NATS Reader 订阅 NATS 上的 subject，每条消息的 payload 作为一行数据。不开启 JetStream 时直接订阅，logkit 停止期间发送的消息会丢失，多个 logkit 可以通过 nats_queue_group 分担同一个 subject 的消息；开启 JetStream 时在 nats_stream 上创建 durable 的 pull consumer，消息发送成功后才确认，消费位置保存在服务端，未确认的消息会重新投递。配置 sourcemeta_tag 后会把消息的 subject 以及 JetStream 中的序号(sequence)记录到解析出来的数据中。"},
 	}
 )
 
@@ -203,6 +395,54 @@ var (
 		Advance:      true,
 		ToolTip:      "一个文件夹，记录本次reader的读取位置，默认会自动生成",
 	}
+	OptionMetaStore = Option{
+		KeyName:       KeyMetaStore,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{MetaStoreFile, MetaStoreRedis, MetaStoreEtcd},
+		Default:       MetaStoreFile,
+		Description:   "读取进度保存方式(meta_store)",
+		Advance:       true,
+		ToolTip:       "读取位置等信息默认保存在本地的meta_path中，选择redis或etcd后保存在远端，容器化部署或主备部署的logkit可以共享读取进度",
+	}
+	OptionMetaStoreAddress = Option{
+		KeyName:      KeyMetaStoreAddress,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: true,
+		Description:  "读取进度保存地址(meta_store_address)",
+		Advance:      true,
+		ToolTip:      "redis填写host:port，etcd填写v3 HTTP接口地址，多个地址用逗号分隔，如http://127.0.0.1:2379",
+	}
+	OptionMetaStorePassword = Option{
+		KeyName:      KeyMetaStorePassword,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "redis密码(meta_store_password)",
+		Advance:      true,
+		Secret:       true,
+		ToolTip:      "meta_store为redis时的访问密码",
+	}
+	OptionMetaStoreRedisDB = Option{
+		KeyName:      KeyMetaStoreRedisDB,
+		ChooseOnly:   false,
+		Default:      "0",
+		DefaultNoUse: false,
+		Description:  "redis数据库(meta_store_redis_db)",
+		CheckRegex:   "\\d+",
+		Advance:      true,
+		ToolTip:      "meta_store为redis时使用的数据库编号",
+	}
+	OptionMetaStorePrefix = Option{
+		KeyName:      KeyMetaStorePrefix,
+		ChooseOnly:   false,
+		Default:      defaultMetaStorePrefix,
+		DefaultNoUse: false,
+		Description:  "读取进度key前缀(meta_store_prefix)",
+		Advance:      true,
+		ToolTip:      "保存在redis或etcd中的key为 前缀/runner名称/文件名，共享读取进度的logkit需要配置相同的前缀和runner名称",
+	}
 	OptionDataSourceTag = Option{
 		KeyName:      KeyDataSourceTag,
 		ChooseOnly:   false,
@@ -212,6 +452,16 @@ var (
 		Advance:      true,
 		ToolTip:      "把读取日志的路径名称也作为标签，记录到解析出来的数据结果中，此处填写标签名称",
 	}
+	OptionSourceMetaTag = Option{
+		KeyName:      KeySourceMetaTag,
+		ChooseOnly:   false,
+		Default:      "",
+		Placeholder:  "sourcemeta",
+		DefaultNoUse: false,
+		Description:  "文件位置标签(sourcemeta_tag)",
+		Advance:      true,
+		ToolTip:      "把每条日志所在文件的路径(path)、inode 以及在文件中的起始位置(offset)记录到解析出来的数据结果中，此处填写标签名称，不填则不记录",
+	}
 	OptionBuffSize = Option{
 		KeyName:      KeyBufSize,
 		ChooseOnly:   false,
@@ -241,7 +491,86 @@ var (
 		DefaultNoUse: false,
 		Description:  "编码方式(encoding)",
 		Advance:      true,
-		ToolTip:      "读取日志文件的编码方式，默认为UTF-8，即按照UTF-8的编码方式读取文件",
+		ToolTip:      "读取日志文件的编码方式，默认为UTF-8，即按照UTF-8的编码方式读取文件；文件开头带有BOM时按照BOM对应的UTF-8、UTF-16LE或UTF-16BE读取",
+	}
+	OptionDedupWindow = Option{
+		KeyName:      KeyDedupWindow,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "去重窗口大小(dedup_window)",
+		CheckRegex:   "\\d+",
+		Advance:      true,
+		ToolTip:      "记录最近读到的多少条不同数据，窗口内完全相同的数据只保留第一条，不填或者为0表示不去重",
+	}
+	OptionDedupTTL = Option{
+		KeyName:      KeyDedupTTL,
+		ChooseOnly:   false,
+		Default:      DefaultDedupTTL,
+		DefaultNoUse: false,
+		Description:  "去重时间窗口(dedup_ttl)",
+		CheckRegex:   "\\d+(ms|[hms])",
+		Advance:      true,
+		ToolTip:      "数据第一次读到之后在这段时间内重复出现才会被丢弃，仅在配置了去重窗口大小时生效",
+	}
+	OptionLineIncludePattern = Option{
+		KeyName:      KeyLineIncludePattern,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "只读取匹配的数据(line_include_pattern)",
+		Advance:      true,
+		ToolTip:      "填写正则表达式，只有匹配的数据才会交给解析器，不匹配的数据在读取时直接丢弃，配置head_pattern等多行模式时匹配的是拼接后的整条数据",
+	}
+	OptionLineExcludePattern = Option{
+		KeyName:      KeyLineExcludePattern,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "丢弃匹配的数据(line_exclude_pattern)",
+		Advance:      true,
+		ToolTip:      "填写正则表达式，匹配的数据在读取时直接丢弃，不再解析和发送，如填写DEBUG丢弃调试日志，和line_include_pattern同时配置时两个条件都生效",
+	}
+	OptionLineDelimiter = Option{
+		KeyName:      KeyLineDelimiter,
+		ChooseOnly:   false,
+		Default:      "",
+		Placeholder:  "\\r\\n",
+		DefaultNoUse: false,
+		Description:  "数据分隔符(line_delimiter)",
+		Advance:      true,
+		ToolTip:      "按照固定的分隔符切分数据，支持\\r\\n、\\x1e这样的转义写法，读取到的数据不包含分隔符，不填表示按换行切分，UTF-16编码的文件不支持",
+	}
+	OptionLineDelimiterRegex = Option{
+		KeyName:      KeyLineDelimiterRegex,
+		ChooseOnly:   false,
+		Default:      "",
+		Placeholder:  "\\r?\\n",
+		DefaultNoUse: false,
+		Description:  "正则表达式数据分隔符(line_delimiter_regex)",
+		Advance:      true,
+		ToolTip:      "按照匹配正则表达式的分隔符切分数据，不能与line_delimiter同时配置，读取到的数据不包含分隔符",
+	}
+	OptionMaxLineLength = Option{
+		KeyName:      KeyMaxLineLength,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "单行最大长度(max_line_length)",
+		CheckRegex:   "\\d+",
+		Advance:      true,
+		ToolTip:      "一行数据最多读取的字节数，超过时根据max_line_action截断或者拆分，避免超长的行占用过多内存，不填或者为0表示不限制。配置sourcemeta_tag后被截断或拆分的数据中truncated为true",
+	}
+	OptionMaxLineAction = Option{
+		KeyName:       KeyMaxLineAction,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{MaxLineTruncate, MaxLineSplit},
+		Default:       MaxLineTruncate,
+		DefaultNoUse:  false,
+		Description:   "超过单行最大长度时的处理方式(max_line_action)",
+		Advance:       true,
+		ToolTip:       "truncate丢弃超过的部分，split把超过的部分拆分成新的数据",
 	}
 	OptionWhence = Option{
 		KeyName:       KeyWhence,
@@ -271,6 +600,45 @@ var (
 		Advance:      true,
 		ToolTip:      "reader每次读取一行，若要读取多行，请填写head_pattern，表示匹配多行时新的一行的开始符合该正则表达式",
 	}
+	OptionContinuePattern = Option{
+		KeyName:      KeyContinuePattern,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "按正则表达式规则拼接多行(continue_pattern)",
+		Advance:      true,
+		ToolTip:      "另一种多行模式，不能和head_pattern同时填写。匹配该正则表达式的行根据continue_match追加到上一行后面或者和下一行拼接，如以空白开头的异常堆栈可以填写^\\s+，匹配时不包含行尾的换行",
+	}
+	OptionContinueMatch = Option{
+		KeyName:       KeyContinueMatch,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{ContinueMatchAfter, ContinueMatchBefore},
+		Default:       ContinueMatchAfter,
+		DefaultNoUse:  false,
+		Description:   "拼接多行的方式(continue_match)",
+		Advance:       true,
+		ToolTip:       "after表示匹配continue_pattern的行追加到上一行后面；before表示匹配的行和下一行属于同一条数据，如以反斜杠结尾的行，continue_pattern填写\\\\$",
+	}
+	OptionMultiLineTimeout = Option{
+		KeyName:      KeyMultiLineTimeout,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "多行等待超时时间(multiline_timeout)",
+		Advance:      true,
+		ToolTip:      "配置head_pattern时，已经读到的多行数据超过这个时间没有新的数据就直接发送，不再等待下一个行首，如5s、1m，不填表示一直等待",
+	}
+	OptionMultiLineMaxLines = Option{
+		KeyName:      KeyMultiLineMaxLines,
+		ChooseOnly:   false,
+		Default:      "",
+		DefaultNoUse: false,
+		Description:  "多行最大行数(multiline_max_lines)",
+		CheckRegex:   "\\d+",
+		Advance:      true,
+		ToolTip:      "配置head_pattern时，一条多行数据最多包含的行数，达到时直接发送，剩下的行作为新的一条，不填或者为0表示不限制",
+	}
 	OptionSQLSchema = Option{
 		KeyName:      KeySQLSchema,
 		ChooseOnly:   false,
@@ -312,6 +680,18 @@ var (
 		Required:      false,
 		ToolTip:       "常用于带抬头的csv文件，抬头与实际数据类型不一致",
 	}
+	OptionKeyMarkFileFirstLine = Option{
+		KeyName:       KeyMarkFileFirstLine,
+		Element:       Radio,
+		ChooseOnly:    true,
+		ChooseOptions: []interface{}{"false", "true"},
+		Default:       "false",
+		DefaultNoUse:  false,
+		Description:   "标记新文件的第一行(mark_first_line)",
+		Advance:       true,
+		Required:      false,
+		ToolTip:       "为每个文件的第一行加上表头标记，配合csv解析器的csv_schema_from_header从文件抬头获取字段",
+	}
 	OptionKeyValidFilePattern = Option{
 		KeyName:      KeyValidFilePattern,
 		ChooseOnly:   false,
@@ -336,14 +716,33 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      "需要收集的日志的文件夹路径",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionBuffSize,
 		OptionWhence,
 		OptionEncoding,
+		OptionDedupWindow,
+		OptionDedupTTL,
+		OptionLineIncludePattern,
+		OptionLineExcludePattern,
+		OptionLineDelimiter,
+		OptionLineDelimiterRegex,
+		OptionMaxLineLength,
+		OptionMaxLineAction,
 		OptionDataSourceTag,
+		OptionSourceMetaTag,
 		OptionReadIoLimit,
 		OptionHeadPattern,
+		OptionContinuePattern,
+		OptionContinueMatch,
+		OptionMultiLineTimeout,
+		OptionMultiLineMaxLines,
 		OptionKeyNewFileNewLine,
 		OptionKeySkipFileFirstLine,
+		OptionKeyMarkFileFirstLine,
 		{
 			KeyName:       KeyIgnoreHiddenFile,
 			Element:       Radio,
@@ -378,12 +777,30 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      "需要收集的日志的文件路径",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionBuffSize,
 		OptionWhence,
 		OptionDataSourceTag,
+		OptionSourceMetaTag,
 		OptionEncoding,
+		OptionDedupWindow,
+		OptionDedupTTL,
+		OptionLineIncludePattern,
+		OptionLineExcludePattern,
+		OptionLineDelimiter,
+		OptionLineDelimiterRegex,
+		OptionMaxLineLength,
+		OptionMaxLineAction,
 		OptionReadIoLimit,
 		OptionHeadPattern,
+		OptionContinuePattern,
+		OptionContinueMatch,
+		OptionMultiLineTimeout,
+		OptionMultiLineMaxLines,
 	},
 	ModeTailx: {
 		{
@@ -394,15 +811,51 @@ var ModeKeyOptions = map[string][]Option{
 			Placeholder:  "/home/users/*/mylog/*.log",
 			DefaultNoUse: true,
 			Description:  "日志文件路径模式串(log_path)",
-			ToolTip:      "需要收集的日志的文件（夹）模式串路径，写 * 代表通配",
+			ToolTip:      "需要收集的日志的文件（夹）模式串路径，写 * 代表通配，单独一级的 ** 代表任意层级的目录",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionBuffSize,
-		OptionWhence,
+		{
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceOldest, WhenceNewest, WhenceFromTime},
+			Default:       WhenceOldest,
+			Description:   "读取起始位置(read_from)",
+			ToolTip:       "在创建新文件或meta信息损坏的时候(即历史读取记录不存在)，将从数据源的哪个位置开始读取，最新或最老；from_time 表示只读取 start_time 之后写入的文件",
+		},
+		{
+			KeyName:      KeyStartTime,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "2018-01-02T15:04:05+08:00",
+			DefaultNoUse: false,
+			Description:  "读取起始时间(start_time)",
+			Advance:      true,
+			ToolTip:      "read_from 为 from_time 时使用，修改时间早于该时间的文件从末尾开始读取，只读取新写入的内容，其他文件从头开始读取",
+		},
 		OptionEncoding,
+		OptionDedupWindow,
+		OptionDedupTTL,
+		OptionLineIncludePattern,
+		OptionLineExcludePattern,
+		OptionLineDelimiter,
+		OptionLineDelimiterRegex,
+		OptionMaxLineLength,
+		OptionMaxLineAction,
 		OptionReadIoLimit,
 		OptionDataSourceTag,
+		OptionSourceMetaTag,
 		OptionHeadPattern,
+		OptionContinuePattern,
+		OptionContinueMatch,
+		OptionMultiLineTimeout,
+		OptionMultiLineMaxLines,
 		{
 			KeyName:      KeyExpire,
 			ChooseOnly:   false,
@@ -421,7 +874,7 @@ var ModeKeyOptions = map[string][]Option{
 			Description:  "最大打开文件数(max_open_files)",
 			CheckRegex:   "\\d+",
 			Advance:      true,
-			ToolTip:      "最大同时追踪的文件数，默认为256",
+			ToolTip:      "最大同时追踪的文件数，默认为256，达到上限后发现更活跃的新文件时关闭最久没有读到数据的文件",
 		},
 		{
 			KeyName:      KeyStatInterval,
@@ -433,6 +886,98 @@ var ModeKeyOptions = map[string][]Option{
 			Advance:      true,
 			ToolTip:      `感知新增日志的定时检查时间`,
 		},
+		{
+			KeyName:       KeyStatMode,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{StatModePoll, StatModeWatch},
+			Default:       StatModePoll,
+			DefaultNoUse:  false,
+			Description:   "新文件发现方式(stat_mode)",
+			Advance:       true,
+			ToolTip:       `poll 为按照扫描间隔定时扫描；watch 通过文件系统通知在新文件创建后立即开始读取，同时仍然按照扫描间隔定时扫描，NFS 等不支持通知的文件系统上与 poll 相同`,
+		},
+		{
+			KeyName:      KeyLogPathExclude,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "*.gz,*.swp,regex:/audit/",
+			DefaultNoUse: false,
+			Description:  "排除的文件(log_path_exclude)",
+			Advance:      true,
+			ToolTip:      `匹配的文件不会被读取，多个用逗号分隔。以 regex: 开头的为正则表达式，匹配文件完整路径中的任意部分；其他为通配符，不包含路径分隔符时只匹配文件名，否则匹配完整路径`,
+		},
+		{
+			KeyName:      KeyTailxEOFSleep,
+			ChooseOnly:   false,
+			Default:      "5s",
+			DefaultNoUse: false,
+			Description:  "读到文件末尾后的等待时间(tailx_eof_sleep)",
+			CheckRegex:   "\\d+(ms|[hms])",
+			Advance:      true,
+			ToolTip:      `读到文件末尾后等待多久再读取，对延迟要求高时可以调小，如 200ms`,
+		},
+		{
+			KeyName:      KeyTailxIdleSleep,
+			ChooseOnly:   false,
+			Default:      "1s",
+			DefaultNoUse: false,
+			Description:  "未读到完整行时的等待时间(tailx_idle_sleep)",
+			CheckRegex:   "\\d+(ms|[hms])",
+			Advance:      true,
+			ToolTip:      `没有读到完整的一行(如多行模式下还在等待下一行)时等待多久再读取`,
+		},
+		{
+			KeyName:      KeyTailxInactiveTimeout,
+			ChooseOnly:   false,
+			Default:      "1h",
+			DefaultNoUse: false,
+			Description:  "文件不活跃的判定时间(tailx_inactive_timeout)",
+			CheckRegex:   "\\d+[hms]",
+			Advance:      true,
+			ToolTip:      `持续这么久没有读到内容的文件会被标记为不活跃，不活跃且超过 expire 没有修改的文件会放弃追踪`,
+		},
+		{
+			KeyName:       KeyTailxBackoff,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{TailxBackoffFixed, TailxBackoffExponential},
+			Default:       TailxBackoffFixed,
+			DefaultNoUse:  false,
+			Description:   "等待时间增长方式(tailx_backoff)",
+			Advance:       true,
+			ToolTip:       `fixed 每次等待固定时间；exponential 连续读不到内容时等待时间翻倍，直到 tailx_max_sleep，读到内容后恢复`,
+		},
+		{
+			KeyName:      KeyTailxMaxSleep,
+			ChooseOnly:   false,
+			Default:      "30s",
+			DefaultNoUse: false,
+			Description:  "最长等待时间(tailx_max_sleep)",
+			CheckRegex:   "\\d+(ms|[hms])",
+			Advance:      true,
+			ToolTip:      `tailx_backoff 为 exponential 时等待时间的上限`,
+		},
+		{
+			KeyName:      KeyReadSpeedLimit,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "单个文件读取限速(read_speed_limit)",
+			CheckRegex:   "\\d+",
+			Advance:      true,
+			ToolTip:      `每个文件的读取速度上限，单位为KB/s，不填或者为0表示不限制`,
+		},
+		{
+			KeyName:      KeyReadSpeedLimitTotal,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "所有文件读取总限速(read_speed_limit_total)",
+			CheckRegex:   "\\d+",
+			Advance:      true,
+			ToolTip:      `所有正在读取的文件共享的读取速度上限，单位为KB/s，不填或者为0表示不限制`,
+		},
 	},
 	ModeFileAuto: {
 		{
@@ -446,11 +991,28 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      "需要收集的日志文件(夹)路径",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionWhence,
 		OptionEncoding,
+		OptionDedupWindow,
+		OptionDedupTTL,
+		OptionLineIncludePattern,
+		OptionLineExcludePattern,
+		OptionLineDelimiter,
+		OptionLineDelimiterRegex,
+		OptionMaxLineLength,
+		OptionMaxLineAction,
 		OptionDataSourceTag,
 		OptionKeyNewFileNewLine,
 		OptionHeadPattern,
+		OptionContinuePattern,
+		OptionContinueMatch,
+		OptionMultiLineTimeout,
+		OptionMultiLineMaxLines,
 	},
 	ModeMySQL: {
 		{
@@ -519,6 +1081,11 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      "若数据量大，可以填写该字段，分批次查询",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 		{
 			KeyName:       KeyMysqlCron,
@@ -562,6 +1129,57 @@ var ModeKeyOptions = map[string][]Option{
 		OptionSQLSchema,
 		OptionMagicLagDuration,
 	},
+	ModeMySQLBinlog: {
+		{
+			KeyName:       KeyMysqlDataSource,
+			Element:       Text,
+			ChooseOnly:    false,
+			Default:       "",
+			Required:      true,
+			Placeholder:   "<username>:<password>@tcp(<hostname>:<port>)",
+			DefaultNoUse:  true,
+			Description:   "数据库地址(mysql_datasource)",
+			ToolTip:       `mysql数据源所需信息: username: 用户名, password: 用户密码, hostname: mysql地址, port: mysql端口, 示例：一个填写完整的字段类似于:"admin:123456@tcp(10.101.111.1:3306)"，需要 TLS 时在后面加上 ?tls=true 或 ?tls=skip-verify`,
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyMySQLBinlogTables,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Placeholder:  "db1.table1,db2.*",
+			Description:  "读取的表(mysql_binlog_tables)",
+			ToolTip:      "多个表用逗号分隔，格式为 数据库名.表名，支持 * 通配符，默认读取所有的表",
+		},
+		{
+			KeyName:       KeyMySQLBinlogGTID,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "使用gtid定位(mysql_binlog_gtid)",
+			Advance:       true,
+			ToolTip:       "MySQL 开启了 gtid_mode 时可以使用 gtid 集合记录读取位置，主从切换后仍然可以继续读取",
+		},
+		{
+			KeyName:      KeyMySQLBinlogServerID,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "server id(mysql_binlog_server_id)",
+			CheckRegex:   "\\d+",
+			Advance:      true,
+			ToolTip:      "作为从库使用的 server id，不能与其他 MySQL 实例重复，默认根据 runner 名称生成",
+		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionDataSourceTag,
+	},
 	ModeMSSQL: {
 		{
 			KeyName:       KeyMssqlDataSource,
@@ -605,6 +1223,11 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      `指定一个mssql的列名，作为offset的记录，类型必须是整型，建议使用插入(或修改)数据的时间戳(unixnano)作为该字段`,
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 		{
 			KeyName:      KeyMssqlReadBatch,
@@ -624,7 +1247,7 @@ var ModeKeyOptions = map[string][]Option{
 			DefaultNoUse:  false,
 			Description:   "定时任务(mssql_cron)",
 			Advance:       true,
-			ToolTip:       `定时任务触发周期，直接写"loop"循环执行，crontab的写法，类似于* * * * * *，对应的是秒(0~59)，分(0~59)，时(0~23)，日(1~31)，月(1-12)，星期(0~6)，填*号表示所有遍历都执行`,
+			ToolTip:       `定时任务触发周期，直接写"loop"循环执行，crontab的写法，类似于* * * * * *，对应的是秒(0~59)，分(0~59)，时(0~23)，日(1~31)，月(1-12)，星期(0~6)，填*号表示所有遍历都执行；也可以省略秒写成标准的5个字段，或者写成@every 1h`,
 			ToolTipActive: true,
 		},
 		{
@@ -682,7 +1305,21 @@ var ModeKeyOptions = map[string][]Option{
 			Advance:      true,
 			ToolTip:      `指定一个 PostgreSQL 的列名，作为 offset 的记录，类型必须是整型，建议使用插入(或修改)数据的时间戳(unixnano)作为该字段`,
 		},
+		{
+			KeyName:      KeyPGsqlTimestampKey,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: true,
+			Description:  "递增的时间列名称(postgres_timestamp_key)",
+			Advance:      true,
+			ToolTip:      `指定一个 PostgreSQL 中 timestamp 类型的列名，读取到的最大时间保存在 meta 中，每次只读取更新的数据，不能与 postgres_offset_key 同时使用`,
+		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 		{
 			KeyName:      KeyPGsqlReadBatch,
@@ -756,6 +1393,11 @@ var ModeKeyOptions = map[string][]Option{
 			Description:  "app名称(es_type)",
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 		{
 			KeyName:      KeyESReadBatch,
@@ -821,6 +1463,11 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      `指定一个mongo的列名，作为offset的记录，类型必须是整型(比如unixnano的时间，或者自增的primary key)`,
 		},
 		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 		{
 			KeyName:      KeyMongoReadBatch,
@@ -864,9 +1511,79 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTip:      "表示collection的过滤规则，默认不过滤，全部获取",
 		},
 	},
-	ModeKafka: {
+	ModeMongoStream: {
 		{
-			KeyName:      KeyKafkaGroupID,
+			KeyName:       KeyMongoHost,
+			ChooseOnly:    false,
+			Default:       "",
+			Required:      true,
+			Placeholder:   "mongodb://[username:password@]host1[:port1][,host2[:port2],...[,hostN[:portN]]][/[database][?options]]",
+			DefaultNoUse:  true,
+			Description:   "数据库地址(mongo_host)",
+			ToolTip:       `mongodb的url地址，需要是副本集的成员，默认是localhost:27017，扩展形式可以写为： mongodb://[username:password@]host1[:port1][,host2[:port2],...[,hostN[:portN]]][/[database][?options]]`,
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyMongoDatabase,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			Placeholder:  "app123",
+			DefaultNoUse: true,
+			Description:  "数据库名称(mongo_database)",
+			ToolTip:      "",
+		},
+		{
+			KeyName:      KeyMongoCollection,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			Placeholder:  "collection1",
+			DefaultNoUse: true,
+			Description:  "数据表名称(mongo_collection)",
+			ToolTip:      "",
+		},
+		{
+			KeyName:       KeyMongoStreamType,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{MongoStreamAuto, MongoStreamChangeStream, MongoStreamOplog},
+			Default:       MongoStreamAuto,
+			DefaultNoUse:  false,
+			Description:   "读取方式(mongo_stream_type)",
+			ToolTip:       "auto 根据 MongoDB 的版本自动选择，3.6 及以上使用 change stream，以下使用 oplog；使用 oplog 时需要有读取 local 数据库的权限",
+		},
+		{
+			KeyName:       KeyMongoUpdateLookup,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"true", "false"},
+			Default:       "true",
+			DefaultNoUse:  false,
+			Description:   "更新时读取完整文档(mongo_update_lookup)",
+			Advance:       true,
+			ToolTip:       "开启后 update 事件的 fullDocument 中是查询到的更新后的完整文档，关闭后只有 updateDescription 中的修改字段",
+		},
+		{
+			KeyName:      KeyMongoReadBatch,
+			ChooseOnly:   false,
+			Default:      "100",
+			DefaultNoUse: false,
+			Description:  "单批次读取的变更数(mongo_limit_batch)",
+			CheckRegex:   "\\d+",
+			Advance:      true,
+			ToolTip:      "单次请求获取的变更数量",
+		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionDataSourceTag,
+	},
+	ModeKafka: {
+		{
+			KeyName:      KeyKafkaGroupID,
 			ChooseOnly:   false,
 			Default:      "",
 			Required:     true,
@@ -917,149 +1634,881 @@ var ModeKeyOptions = map[string][]Option{
 		},
 		OptionDataSourceTag,
 	},
-	ModeRedis: {
+	ModeKafkaGroup: {
 		{
-			KeyName:       KeyRedisDataType,
+			KeyName:      KeyKafkaGroupID,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			Placeholder:  "logkit1",
+			DefaultNoUse: true,
+			Description:  "consumer组名称(kafka_groupid)",
+			ToolTip:      "kafka组名，多个logkit同时消费时写同一个组名可以协同读取数据",
+		},
+		{
+			KeyName:       KeyKafkaBrokers,
+			ChooseOnly:    false,
+			Default:       "",
+			Required:      true,
+			Placeholder:   "localhost:9092",
+			DefaultNoUse:  true,
+			Description:   "broker地址(kafka_brokers)",
+			ToolTip:       "kafka broker地址列表，多个用逗号分隔，常用端口是9092",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyKafkaTopic,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "test_topic1",
+			DefaultNoUse: false,
+			Description:  "topic名称(kafka_topic)",
+			ToolTip:      "多个topic用逗号分隔，与kafka_topic_regex至少填写一项",
+		},
+		{
+			KeyName:      KeyKafkaTopicRegex,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "^app_.*",
+			DefaultNoUse: false,
+			Description:  "topic正则表达式(kafka_topic_regex)",
+			ToolTip:      "订阅所有名称匹配正则表达式的topic，每分钟检查一次新增的topic",
+		},
+		OptionWhence,
+		{
+			KeyName:      KeyKafkaVersion,
+			ChooseOnly:   false,
+			Default:      DefaultKafkaVersion,
+			DefaultNoUse: false,
+			Description:  "kafka版本(kafka_version)",
+			Advance:      true,
+			ToolTip:      "kafka broker的版本，不能高于实际的版本，最低为0.9.0.0",
+		},
+		{
+			KeyName:       KeyKafkaSASLMechanism,
+			Element:       Radio,
 			ChooseOnly:    true,
-			ChooseOptions: []interface{}{DataTypeList, DataTypeChannel, DataTypePatterChannel, DataTypeString, DataTypeSet, DateTypeSortedSet, DateTypeHash},
-			Description:   "数据读取模式(redis_datatype)",
-			ToolTip:       "",
+			ChooseOptions: []interface{}{KafkaSASLNone, KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512},
+			Default:       KafkaSASLNone,
+			DefaultNoUse:  false,
+			Description:   "SASL认证方式(kafka_sasl_mechanism)",
+			Advance:       true,
 		},
 		{
-			KeyName:       KeyRedisDB,
+			KeyName:      KeyKafkaSASLUsername,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "SASL用户名(kafka_sasl_username)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyKafkaSASLPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "SASL密码(kafka_sasl_password)",
+			Advance:      true,
+			Secret:       true,
+		},
+		{
+			KeyName:       KeyKafkaTLS,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "使用TLS连接(kafka_tls)",
+			Advance:       true,
+		},
+		{
+			KeyName:      KeyKafkaTLSCAPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS CA证书路径(kafka_tls_ca_path)",
+			Advance:      true,
+			ToolTip:      "不填写时使用系统的CA证书",
+		},
+		{
+			KeyName:      KeyKafkaTLSCertPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS客户端证书路径(kafka_tls_cert_path)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyKafkaTLSKeyPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS客户端私钥路径(kafka_tls_key_path)",
+			Advance:      true,
+		},
+		{
+			KeyName:       KeyKafkaTLSInsecureSkipVerify,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "跳过证书校验(kafka_tls_insecure_skip_verify)",
+			Advance:       true,
+		},
+		OptionDataSourceTag,
+	},
+	ModeSyslog: {
+		{
+			KeyName:       KeySyslogAddress,
+			ChooseOnly:    false,
+			Default:       DefaultSyslogAddress,
+			Required:      true,
+			Placeholder:   DefaultSyslogAddress,
+			DefaultNoUse:  false,
+			Description:   "监听地址(syslog_address)",
+			ToolTip:       "支持 udp://、tcp:// 和 tls:// 三种协议，多个地址用逗号分隔，如 udp://0.0.0.0:514,tcp://0.0.0.0:514",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:       KeySyslogRFC,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{SyslogRFCAuto, SyslogRFC3164, SyslogRFC5424},
+			Default:       SyslogRFCAuto,
+			DefaultNoUse:  false,
+			Description:   "消息格式(syslog_rfc)",
+			ToolTip:       "automatic 根据每条消息的内容自动识别 RFC3164 和 RFC5424",
+		},
+		{
+			KeyName:      KeySyslogMaxMessageSize,
+			ChooseOnly:   false,
+			Default:      "65536",
+			DefaultNoUse: false,
+			Description:  "单条消息最大长度(syslog_max_message_size)",
+			Advance:      true,
+			ToolTip:      "TCP 和 TLS 连接上单条消息的最大字节数，超过后关闭连接",
+		},
+		{
+			KeyName:      KeySyslogTLSCertPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS证书路径(syslog_tls_cert_path)",
+			Advance:      true,
+			ToolTip:      "监听 tls:// 地址时必填",
+		},
+		{
+			KeyName:      KeySyslogTLSKeyPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS私钥路径(syslog_tls_key_path)",
+			Advance:      true,
+			ToolTip:      "监听 tls:// 地址时必填",
+		},
+		{
+			KeyName:      KeySyslogTLSCAPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS CA证书路径(syslog_tls_ca_path)",
+			Advance:      true,
+			ToolTip:      "填写后要求客户端提供由该 CA 签发的证书",
+		},
+		OptionDataSourceTag,
+	},
+	ModeMQTT: {
+		{
+			KeyName:       KeyMQTTBroker,
 			ChooseOnly:    false,
 			Default:       "",
 			Required:      true,
-			Placeholder:   "db",
+			Placeholder:   "tcp://127.0.0.1:1883",
 			DefaultNoUse:  true,
-			Description:   "数据库名称(redis_db)",
-			ToolTip:       `Redis的数据库名，默认为"0"`,
+			Description:   "broker地址(mqtt_broker)",
+			ToolTip:       "支持 tcp://、ssl:// 和 tls:// 三种协议，如 tcp://127.0.0.1:1883",
 			ToolTipActive: true,
 		},
 		{
-			KeyName:      KeyRedisKey,
+			KeyName:      KeyMQTTTopics,
 			ChooseOnly:   false,
 			Default:      "",
 			Required:     true,
-			Placeholder:  "key1",
+			Placeholder:  "devices/+/logs",
 			DefaultNoUse: true,
-			Description:  "redis键(redis_key)",
-			ToolTip:      `Redis监听的键值，在不同模式（redis_datatype）下表示不同含义`,
+			Description:  "订阅的topic(mqtt_topics)",
+			ToolTip:      "多个 topic 用逗号分隔，支持 + 和 # 通配符",
 		},
 		{
-			KeyName:      KeyRedisHashArea,
+			KeyName:       KeyMQTTQoS,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"0", "1"},
+			Default:       "0",
+			DefaultNoUse:  false,
+			Description:   "QoS(mqtt_qos)",
+			ToolTip:       "QoS 为 1 时使用持久会话，消息发送成功后才确认，logkit 重启后不会丢失消息",
+		},
+		{
+			KeyName:      KeyMQTTClientID,
 			ChooseOnly:   false,
 			Default:      "",
 			DefaultNoUse: false,
-			Description:  "hash模式对应的数据结构域(redisHash_area)",
+			Description:  "client id(mqtt_client_id)",
 			Advance:      true,
-			ToolTip:      "",
+			ToolTip:      "默认为 logkit_<runner 名称>，QoS 为 1 时重启前后需要保持不变",
 		},
 		{
-			KeyName:       KeyRedisAddress,
+			KeyName:      KeyMQTTUsername,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "用户名(mqtt_username)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyMQTTPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "密码(mqtt_password)",
+			Advance:      true,
+			Secret:       true,
+		},
+		{
+			KeyName:      KeyMQTTKeepAlive,
+			ChooseOnly:   false,
+			Default:      "30",
+			DefaultNoUse: false,
+			Description:  "心跳间隔秒数(mqtt_keep_alive)",
+			Advance:      true,
+		},
+		{
+			KeyName:       KeyMQTTInsecureSkipVerify,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "跳过证书校验(mqtt_insecure_skip_verify)",
+			Advance:       true,
+			ToolTip:       "使用 ssl:// 或 tls:// 时是否跳过 broker 证书的校验",
+		},
+		OptionDataSourceTag,
+	},
+	ModeGRPC: {
+		{
+			KeyName:       KeyGRPCAddress,
 			ChooseOnly:    false,
-			Default:       "",
-			Placeholder:   "127.0.0.1:6379",
+			Default:       DefaultGRPCAddress,
 			Required:      true,
+			Placeholder:   DefaultGRPCAddress,
 			DefaultNoUse:  false,
-			Description:   "数据库地址(redis_address)",
-			ToolTip:       `Redis的地址（IP+端口），默认为"127.0.0.1:6379"`,
+			Description:   "监听地址(grpc_address)",
+			ToolTip:       "gRPC 服务监听的地址和端口，如 0.0.0.0:9600",
 			ToolTipActive: true,
 		},
 		{
-			KeyName:      KeyRedisPassword,
+			KeyName:      KeyGRPCTLSCertPath,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "TLS证书路径(grpc_tls_cert_path)",
+			ToolTip:      "gRPC 基于 HTTP/2，必须使用 TLS",
+		},
+		{
+			KeyName:      KeyGRPCTLSKeyPath,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "TLS私钥路径(grpc_tls_key_path)",
+		},
+		{
+			KeyName:      KeyGRPCTLSCAPath,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS CA证书路径(grpc_tls_ca_path)",
+			Advance:      true,
+			ToolTip:      "填写后要求客户端提供由该 CA 签发的证书",
+		},
+		{
+			KeyName:      KeyGRPCAuthToken,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "认证token(grpc_auth_token)",
+			Advance:      true,
+			Secret:       true,
+			ToolTip:      "填写后 metadata 中需要带上 authorization: Bearer <token>，否则返回 UNAUTHENTICATED",
+		},
+		{
+			KeyName:      KeyGRPCMaxMessageSize,
+			ChooseOnly:   false,
+			Default:      "4194304",
+			DefaultNoUse: false,
+			Description:  "单个消息最大字节数(grpc_max_message_size)",
+			Advance:      true,
+			ToolTip:      "超过后返回 RESOURCE_EXHAUSTED 并结束调用",
+		},
+		OptionDataSourceTag,
+	},
+	ModeNATS: {
+		{
+			KeyName:       KeyNATSServers,
+			ChooseOnly:    false,
+			Default:       DefaultNATSServer,
+			Required:      true,
+			Placeholder:   DefaultNATSServer,
+			DefaultNoUse:  false,
+			Description:   "服务端地址(nats_servers)",
+			ToolTip:       "支持 nats:// 和 tls:// 两种协议，多个地址用逗号分隔，连接断开后依次重连",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyNATSSubjects,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "logs.>",
+			DefaultNoUse: true,
+			Description:  "订阅的subject(nats_subjects)",
+			ToolTip:      "多个 subject 用逗号分隔，支持 * 和 > 通配符；开启 JetStream 时用于过滤 stream 中的消息，不填则读取 stream 中的全部消息",
+		},
+		{
+			KeyName:      KeyNATSQueueGroup,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "queue group(nats_queue_group)",
+			Advance:      true,
+			ToolTip:      "不开启 JetStream 时，同一个 queue group 中的 logkit 分担 subject 中的消息",
+		},
+		{
+			KeyName:       KeyNATSJetStream,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "使用JetStream(nats_jetstream)",
+			ToolTip:       "开启后使用 durable consumer 读取 stream 中的消息，数据发送成功后才确认，logkit 重启后不会丢失消息",
+		},
+		{
+			KeyName:      KeyNATSStream,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "stream名称(nats_stream)",
+			ToolTip:      "开启 JetStream 时必填",
+		},
+		{
+			KeyName:      KeyNATSDurable,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "durable consumer名称(nats_durable)",
+			Advance:      true,
+			ToolTip:      "默认为 logkit_<runner 名称>，重启前后需要保持不变",
+		},
+		{
+			KeyName:      KeyNATSBatchSize,
+			ChooseOnly:   false,
+			Default:      "100",
+			DefaultNoUse: false,
+			Description:  "每次拉取的消息数(nats_batch_size)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyNATSAckWait,
+			ChooseOnly:   false,
+			Default:      "60",
+			DefaultNoUse: false,
+			Description:  "确认超时秒数(nats_ack_wait)",
+			Advance:      true,
+			ToolTip:      "超过这个时间没有确认的消息会重新投递，需要大于数据发送的耗时",
+		},
+		{
+			KeyName:      KeyNATSUsername,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "用户名(nats_username)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyNATSPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "密码(nats_password)",
+			Advance:      true,
+			Secret:       true,
+		},
+		{
+			KeyName:      KeyNATSToken,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "token(nats_token)",
+			Advance:      true,
+			Secret:       true,
+		},
+		{
+			KeyName:       KeyNATSInsecureSkipVerify,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "跳过证书校验(nats_insecure_skip_verify)",
+			Advance:       true,
+			ToolTip:       "使用 tls:// 时是否跳过服务端证书的校验",
+		},
+		OptionDataSourceTag,
+		{
+			KeyName:      KeySourceMetaTag,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "sourcemeta",
+			DefaultNoUse: false,
+			Description:  "消息信息标签(sourcemeta_tag)",
+			Advance:      true,
+			ToolTip:      "把每条消息的 subject 以及 JetStream 中的序号(sequence)记录到解析出来的数据中，此处填写标签名称，不填则不记录",
+		},
+	},
+	ModeRedis: {
+		{
+			KeyName:       KeyRedisDataType,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{DataTypeList, DataTypeChannel, DataTypePatterChannel, DataTypeString, DataTypeSet, DateTypeSortedSet, DateTypeHash, DataTypeStream},
+			Description:   "数据读取模式(redis_datatype)",
+			ToolTip:       "stream 模式使用 XREAD 读取，读取到的 stream id 保存在 meta 中，重启后继续读取",
+		},
+		{
+			KeyName:       KeyRedisDB,
+			ChooseOnly:    false,
+			Default:       "",
+			Required:      true,
+			Placeholder:   "db",
+			DefaultNoUse:  true,
+			Description:   "数据库名称(redis_db)",
+			ToolTip:       `Redis的数据库名，默认为"0"`,
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyRedisKey,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			Placeholder:  "key1",
+			DefaultNoUse: true,
+			Description:  "redis键(redis_key)",
+			ToolTip:      `Redis监听的键值，在不同模式（redis_datatype）下表示不同含义`,
+		},
+		{
+			KeyName:      KeyRedisHashArea,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "hash模式对应的数据结构域(redisHash_area)",
+			Advance:      true,
+			ToolTip:      "",
+		},
+		{
+			KeyName:       KeyRedisAddress,
+			ChooseOnly:    false,
+			Default:       "",
+			Placeholder:   "127.0.0.1:6379",
+			Required:      true,
+			DefaultNoUse:  false,
+			Description:   "数据库地址(redis_address)",
+			ToolTip:       `Redis的地址（IP+端口），默认为"127.0.0.1:6379"`,
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeyRedisPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "密码(redis_password)",
+			Advance:      true,
+		},
+		{
+			KeyName:      KeyTimeoutDuration,
+			ChooseOnly:   false,
+			Default:      "5s",
+			Required:     true,
+			DefaultNoUse: false,
+			Description:  "单次读取超时时间(redis_timeout)",
+			CheckRegex:   "\\d+[ms]",
+			Advance:      true,
+			ToolTip:      "每次等待键值数据的超时时间[m(分)、s(秒)]",
+		},
+		OptionDataSourceTag,
+	},
+	ModeSocket: {
+		{
+			KeyName:       KeySocketServiceAddress,
+			ChooseOnly:    false,
+			Default:       "",
+			Placeholder:   "tcp://127.0.0.1:3110",
+			Required:      true,
+			DefaultNoUse:  true,
+			Description:   "socket监听的地址(socket_service_address)",
+			ToolTip:       "socket监听的地址[协议://端口]，如udp://127.0.0.1:3110",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeySocketMaxConnections,
+			ChooseOnly:   false,
+			Default:      "0",
+			DefaultNoUse: false,
+			Description:  "最大并发连接数(socket_max_connections)",
+			Advance:      true,
+			ToolTip:      "仅tcp协议下生效",
+		},
+		{
+			KeyName:       KeySocketReadTimeout,
+			ChooseOnly:    false,
+			Default:       "1m",
+			DefaultNoUse:  false,
+			Description:   "连接超时时间(socket_read_timeout)",
+			Advance:       true,
+			ToolTip:       "填0为不设置超时",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeySocketReadBufferSize,
+			ChooseOnly:   false,
+			Default:      "65535",
+			DefaultNoUse: false,
+			Description:  "连接缓存大小(socket_read_buffer_size)",
+			Advance:      true,
+			ToolTip:      "仅udp协议下生效",
+		},
+		{
+			KeyName:       KeySocketKeepAlivePeriod,
+			ChooseOnly:    false,
+			Default:       "5m",
+			DefaultNoUse:  false,
+			Description:   "连接保持时长[0为关闭](socket_keep_alive_period)",
+			Advance:       true,
+			ToolTip:       "填0为关闭keep_alive",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeySocketTLSCert,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS证书路径(socket_tls_cert)",
+			Advance:      true,
+			ToolTip:      "仅支持 tcp 和 unix 协议，需要同时填写TLS私钥路径",
+		},
+		{
+			KeyName:      KeySocketTLSKey,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS私钥路径(socket_tls_key)",
+			Advance:      true,
+			ToolTip:      "仅支持 tcp 和 unix 协议，需要同时填写TLS证书路径",
+		},
+		{
+			KeyName:      KeySocketTLSClientCA,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "TLS客户端CA证书路径(socket_tls_client_ca)",
+			Advance:      true,
+			ToolTip:      "填写后要求客户端提供由该 CA 签发的证书",
+		},
+		OptionDataSourceTag,
+	},
+	ModeHTTP: {
+		{
+			KeyName:      KeyHTTPServiceAddress,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  DefaultHTTPServiceAddress,
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "监听的地址和端口(http_service_address)",
+			ToolTip:      "监听的地址和端口，格式为：[<ip/host/不填>:port]，如 :3000 , 监听3000端口的http请求",
+		},
+		{
+			KeyName:      KeyHTTPServicePath,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  DefaultHTTPServicePath,
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "监听地址前缀(http_service_path)",
+			ToolTip:      "监听的请求地址，如 /data ",
+		},
+		{
+			KeyName:      KeyHTTPAuthToken,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "认证token(http_auth_token)",
+			Advance:      true,
+			Secret:       true,
+			ToolTip:      "填写后请求头中需要带上 Authorization: Bearer <token>，否则返回 401",
+		},
+	},
+	ModeLoopback: {
+		{
+			KeyName:      KeyLoopbackName,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "loopback 名称(loopback_name)",
+			ToolTip:      "与上游 runner 中 loopback sender 的 loopback_name 保持一致",
+		},
+		{
+			KeyName:       KeyLoopbackBuffer,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{LoopbackBufferMemory, LoopbackBufferDisk},
+			Default:       LoopbackBufferMemory,
+			Description:   "缓存方式(loopback_buffer)",
+			Advance:       true,
+			ToolTip:       "memory 性能更好，但停止时缓存中的数据会丢失；disk 把数据缓存在 meta_path 下，重启后继续读取",
+		},
+		{
+			KeyName:      KeyLoopbackMemorySize,
+			ChooseOnly:   false,
+			Default:      "100",
+			DefaultNoUse: false,
+			Description:  "内存缓存批次数(loopback_memory_size)",
+			Advance:      true,
+			ToolTip:      "内存模式下最多缓存的批次数，缓存满了之后上游的发送会失败重试",
+		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+	},
+	ModeK8s: {
+		{
+			KeyName:      KeyLogPath,
+			ChooseOnly:   false,
+			Default:      DefaultK8sLogPath,
+			Placeholder:  DefaultK8sLogPath,
+			DefaultNoUse: false,
+			Description:  "日志文件路径(log_path)",
+			ToolTip:      "kubelet 创建的容器日志文件，文件名需要保持 <pod>_<namespace>_<container>-<container_id>.log 的格式，可以通过通配符只读取部分 namespace 的日志",
+		},
+		{
+			KeyName:       KeyK8sLogFormat,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{K8sLogFormatAuto, K8sLogFormatDocker, K8sLogFormatCRI},
+			Default:       K8sLogFormatAuto,
+			Description:   "日志格式(k8s_log_format)",
+			Advance:       true,
+			ToolTip:       "auto 根据每一行自动识别，docker 为 json-file 格式，cri 为 containerd、CRI-O 等使用的格式",
+		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionBuffSize,
+		{
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceOldest, WhenceNewest},
+			Default:       WhenceOldest,
+			Description:   "读取起始位置(read_from)",
+			ToolTip:       "新发现的容器日志从头开始读取还是只读取新写入的内容",
+		},
+		OptionReadIoLimit,
+		OptionDataSourceTag,
+		{
+			KeyName:      KeyExpire,
+			ChooseOnly:   false,
+			Default:      "24h",
+			DefaultNoUse: false,
+			Description:  "忽略文件的最大过期时间(expire)",
+			CheckRegex:   "\\d+[hms]",
+			Advance:      true,
+			ToolTip:      "支持时h、分m、秒s为单位，如 24h，容器退出后日志文件超过这个时间没有更新会被关闭",
+		},
+		{
+			KeyName:      KeyMaxOpenFiles,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "最大打开文件数(max_open_files)",
+			CheckRegex:   "\\d+",
+			Advance:      true,
+			ToolTip:      "最多同时追踪的容器日志文件数，默认为256",
+		},
+		{
+			KeyName:      KeyStatInterval,
+			ChooseOnly:   false,
+			Default:      "3m",
+			DefaultNoUse: false,
+			Description:  "扫描间隔(stat_interval)",
+			CheckRegex:   "\\d+[hms]",
+			Advance:      true,
+			ToolTip:      "每隔多久扫描一次 log_path 发现新创建的容器",
+		},
+	},
+	ModeJournald: {
+		{
+			KeyName:      KeyJournaldUnits,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "nginx.service,sshd.service",
+			DefaultNoUse: false,
+			Description:  "读取的 unit(journald_units)",
+			ToolTip:      "只读取这些 systemd unit 的日志，多个 unit 用逗号分隔，支持 journalctl --unit 的通配符，不填读取所有日志",
+		},
+		{
+			KeyName:      KeyJournaldPriority,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "warning",
+			DefaultNoUse: false,
+			Description:  "日志级别(journald_priority)",
+			ToolTip:      "只读取不低于这个级别的日志，可以是 emerg、alert、crit、err、warning、notice、info、debug 或者 0-7，也可以是 err..warning 这样的范围",
+		},
+		{
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceNewest, WhenceOldest},
+			Default:       WhenceNewest,
+			Description:   "读取起始位置(read_from)",
+			ToolTip:       "没有读取记录时从 journal 中最早的日志开始读取还是只读取新写入的日志",
+		},
+		{
+			KeyName:      KeyJournaldDirectory,
 			ChooseOnly:   false,
 			Default:      "",
+			Placeholder:  "/var/log/journal",
 			DefaultNoUse: false,
-			Description:  "密码(redis_password)",
+			Description:  "journal 目录(journald_directory)",
 			Advance:      true,
+			ToolTip:      "读取指定目录下的 journal 文件，如容器中挂载的宿主机 journal，不填读取本机的 journal",
 		},
 		{
-			KeyName:      KeyTimeoutDuration,
+			KeyName:      KeyJournaldJournalctl,
 			ChooseOnly:   false,
-			Default:      "5s",
-			Required:     true,
+			Default:      DefaultJournalctl,
 			DefaultNoUse: false,
-			Description:  "单次读取超时时间(redis_timeout)",
-			CheckRegex:   "\\d+[ms]",
+			Description:  "journalctl 路径(journald_journalctl)",
 			Advance:      true,
-			ToolTip:      "每次等待键值数据的超时时间[m(分)、s(秒)]",
+			ToolTip:      "journalctl 命令的路径，不在 PATH 中时需要填写",
 		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
 		OptionDataSourceTag,
 	},
-	ModeSocket: {
+	ModeWinEventLog: {
 		{
-			KeyName:       KeySocketServiceAddress,
-			ChooseOnly:    false,
-			Default:       "",
-			Placeholder:   "tcp://127.0.0.1:3110",
-			Required:      true,
-			DefaultNoUse:  true,
-			Description:   "socket监听的地址(socket_service_address)",
-			ToolTip:       "socket监听的地址[协议://端口]，如udp://127.0.0.1:3110",
-			ToolTipActive: true,
+			KeyName:      KeyWinEventLogChannels,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			Placeholder:  "Application,System",
+			DefaultNoUse: true,
+			Description:  "事件日志 channel(wineventlog_channels)",
+			ToolTip:      "需要读取的事件日志 channel，多个用逗号分隔，如 Application,System,Security,Microsoft-Windows-Sysmon/Operational",
 		},
 		{
-			KeyName:      KeySocketMaxConnections,
+			KeyName:      KeyWinEventLogQuery,
 			ChooseOnly:   false,
-			Default:      "0",
+			Default:      "*",
+			Placeholder:  "*[System[(Level=1 or Level=2 or Level=3)]]",
 			DefaultNoUse: false,
-			Description:  "最大并发连接数(socket_max_connections)",
-			Advance:      true,
-			ToolTip:      "仅tcp协议下生效",
+			Description:  "XPath 过滤条件(wineventlog_query)",
+			ToolTip:      "只读取满足 XPath 条件的事件，与事件查看器中筛选当前日志生成的 XPath 相同，默认读取所有事件",
 		},
 		{
-			KeyName:       KeySocketReadTimeout,
-			ChooseOnly:    false,
-			Default:       "1m",
-			DefaultNoUse:  false,
-			Description:   "连接超时时间(socket_read_timeout)",
-			Advance:       true,
-			ToolTip:       "填0为不设置超时",
-			ToolTipActive: true,
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceNewest, WhenceOldest},
+			Default:       WhenceNewest,
+			Description:   "读取起始位置(read_from)",
+			ToolTip:       "没有读取记录时从最早的事件开始读取还是只读取新产生的事件",
 		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionDataSourceTag,
+	},
+	ModeDocker: {
 		{
-			KeyName:      KeySocketReadBufferSize,
+			KeyName:      KeyDockerHost,
 			ChooseOnly:   false,
-			Default:      "65535",
+			Default:      DefaultDockerHost,
+			Placeholder:  DefaultDockerHost,
 			DefaultNoUse: false,
-			Description:  "连接缓存大小(socket_read_buffer_size)",
-			Advance:      true,
-			ToolTip:      "仅udp协议下生效",
+			Description:  "Docker 地址(docker_host)",
+			ToolTip:      "Docker daemon 的地址，支持 unix:///var/run/docker.sock 和 tcp://127.0.0.1:2375 两种格式",
 		},
 		{
-			KeyName:       KeySocketKeepAlivePeriod,
-			ChooseOnly:    false,
-			Default:       "5m",
-			DefaultNoUse:  false,
-			Description:   "连接保持时长[0为关闭](socket_keep_alive_period)",
-			Advance:       true,
-			ToolTip:       "填0为关闭keep_alive",
-			ToolTipActive: true,
+			KeyName:      KeyDockerLabelFilters,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "app=nginx,env",
+			DefaultNoUse: false,
+			Description:  "容器 label 过滤(docker_label_filters)",
+			ToolTip:      "只读取带有这些 label 的容器，格式为 key 或者 key=value，多个用逗号分隔，需要同时满足，不填读取所有容器",
 		},
-		OptionDataSourceTag,
-	},
-	ModeHTTP: {
 		{
-			KeyName:      KeyHTTPServiceAddress,
+			KeyName:      KeyDockerNameFilters,
 			ChooseOnly:   false,
 			Default:      "",
-			Placeholder:  DefaultHTTPServiceAddress,
-			Required:     true,
-			DefaultNoUse: true,
-			Description:  "监听的地址和端口(http_service_address)",
-			ToolTip:      "监听的地址和端口，格式为：[<ip/host/不填>:port]，如 :3000 , 监听3000端口的http请求",
+			Placeholder:  "nginx,web",
+			DefaultNoUse: false,
+			Description:  "容器名称过滤(docker_name_filters)",
+			ToolTip:      "只读取名称中包含这些字符串的容器，多个用逗号分隔，满足其中一个即可，不填读取所有容器",
 		},
 		{
-			KeyName:      KeyHTTPServicePath,
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceNewest, WhenceOldest},
+			Default:       WhenceNewest,
+			Description:   "读取起始位置(read_from)",
+			ToolTip:       "启动时已经在运行并且没有读取记录的容器从最早的日志开始读取还是只读取新产生的日志，之后新启动的容器总是从头读取",
+		},
+		{
+			KeyName:      KeyStatInterval,
 			ChooseOnly:   false,
-			Default:      "",
-			Placeholder:  DefaultHTTPServicePath,
-			Required:     true,
-			DefaultNoUse: true,
-			Description:  "监听地址前缀(http_service_path)",
-			ToolTip:      "监听的请求地址，如 /data ",
+			Default:      "10s",
+			DefaultNoUse: false,
+			Description:  "扫描间隔(stat_interval)",
+			CheckRegex:   "\\d+[hms]",
+			Advance:      true,
+			ToolTip:      "每隔多久列出一次容器，发现新启动的容器",
 		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionDataSourceTag,
 	},
 	ModeScript: {
 		{
@@ -1103,6 +2552,27 @@ var ModeKeyOptions = map[string][]Option{
 			Description:   "启动时立即执行(script_exec_onstart)",
 			ToolTip:       "",
 		},
+		{
+			KeyName:      KeyScriptTimeout,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "30s",
+			DefaultNoUse: false,
+			Description:  "执行超时时间(script_timeout)",
+			Advance:      true,
+			ToolTip:      "脚本执行超过该时间后被强制结束并视为执行失败，如30s、5m，不填表示不限制",
+		},
+		{
+			KeyName:       KeyScriptReadStderr,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"false", "true"},
+			Default:       "false",
+			DefaultNoUse:  false,
+			Description:   "读取标准错误(script_read_stderr)",
+			Advance:       true,
+			ToolTip:       "开启后脚本执行成功时标准错误的输出也作为数据读取，配置sourcemeta_tag后可以通过stream字段区分stdout和stderr，关闭时只记录到日志中",
+		},
 	},
 	ModeCloudWatch: {
 		{
@@ -1121,9 +2591,47 @@ var ModeKeyOptions = map[string][]Option{
 			Default:      "",
 			Placeholder:  "AWS/ELB",
 			DefaultNoUse: true,
-			Required:     true,
 			Description:  "命名空间(namespace)",
-			ToolTip:      "Cloudwatch数据的命名空间",
+			ToolTip:      "Cloudwatch数据的命名空间，只读取日志时可以不填",
+		},
+		{
+			KeyName:      KeyLogGroups,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "/aws/lambda/func1,/aws/lambda/func2",
+			DefaultNoUse: false,
+			Description:  "日志组(log_groups)",
+			ToolTip:      "读取CloudWatch Logs中这些日志组的日志，可填写多个，逗号连接，和namespace至少填写一个",
+		},
+		{
+			KeyName:      KeyLogGroupPattern,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "^/aws/lambda/",
+			DefaultNoUse: false,
+			Description:  "日志组正则表达式(log_group_pattern)",
+			Advance:      true,
+			ToolTip:      "同时读取名称匹配该正则表达式的日志组，新建的日志组在下一个收集间隔被发现",
+		},
+		{
+			KeyName:      KeyLogStreamPrefix,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "日志流前缀(log_stream_prefix)",
+			Advance:      true,
+			ToolTip:      "只读取名称以这些前缀开头的日志流，可填写多个，逗号连接，为空读取所有日志流。每个日志流的读取进度单独保存",
+		},
+		{
+			KeyName:       KeyWhence,
+			Element:       Radio,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{WhenceOldest, WhenceNewest},
+			Default:       WhenceOldest,
+			DefaultNoUse:  false,
+			Description:   "日志读取起始位置(read_from)",
+			Advance:       true,
+			ToolTip:       "没有读取进度的日志流从头开始读取(oldest)还是只读取reader启动之后的日志(newest)",
 		},
 		{
 			KeyName:      KeyRoleArn,
@@ -1456,6 +2964,186 @@ var ModeKeyOptions = map[string][]Option{
 			ToolTipActive: true,
 		},
 	},
+	ModeSnmpTrap: {
+		{
+			KeyName:       KeySnmpTrapAddress,
+			ChooseOnly:    false,
+			Default:       DefaultSnmpTrapAddress,
+			Required:      true,
+			Placeholder:   DefaultSnmpTrapAddress,
+			DefaultNoUse:  false,
+			Description:   "监听地址(snmp_trap_address)",
+			ToolTip:       "接收 trap 的 UDP 地址，监听 162 端口需要 root 权限",
+			ToolTipActive: true,
+		},
+		{
+			KeyName:      KeySnmpTrapMibPaths,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Placeholder:  "/usr/share/snmp/mibs",
+			Description:  "MIB文件路径(snmp_trap_mib_paths)",
+			ToolTip:      "MIB 文件或者目录，多个路径用逗号分隔，用于把 OID 转换为名称",
+		},
+		{
+			KeyName:      KeySnmpReaderCommunity,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "community(snmp_community)",
+			Advance:      true,
+			ToolTip:      "填写后只接收 community 相同的 v2c trap",
+		},
+		{
+			KeyName:      KeySnmpReaderSecName,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "v3用户名(snmp_sec_name)",
+			Advance:      true,
+			ToolTip:      "填写后接收该用户发送的 v3 trap",
+		},
+		{
+			KeyName:       KeySnmpReaderSecLevel,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"authPriv", "authNoPriv", "noAuthNoPriv"},
+			Default:       "authPriv",
+			DefaultNoUse:  false,
+			Description:   "安全等级(snmp_sec_level)",
+			Advance:       true,
+			ToolTip:       "v3 trap 要求的最低安全等级",
+		},
+		{
+			KeyName:       KeySnmpReaderAuthProtocol,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"sha", "md5", ""},
+			DefaultNoUse:  false,
+			Description:   "认证协议(snmp_auth_protocol)",
+			Advance:       true,
+		},
+		{
+			KeyName:      KeySnmpReaderAuthPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "认证密码(snmp_auth_password)",
+			Advance:      true,
+			Secret:       true,
+		},
+		{
+			KeyName:       KeySnmpReaderPrivProtocol,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{"aes", "des", ""},
+			DefaultNoUse:  false,
+			Description:   "隐私协议(snmp_priv_protocol)",
+			Advance:       true,
+		},
+		{
+			KeyName:      KeySnmpReaderPrivPassword,
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "隐私密码(snmp_priv_password)",
+			Advance:      true,
+			Secret:       true,
+		},
+		OptionDataSourceTag,
+	},
+	ModeS3: {
+		{
+			KeyName:      KeyS3Region,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "us-east-1",
+			DefaultNoUse: false,
+			Required:     true,
+			Description:  "区域(s3_region)",
+			ToolTip:      "S3服务区域",
+		},
+		{
+			KeyName:      KeyS3AccessKey,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "访问密钥",
+			DefaultNoUse: false,
+			Description:  "AK(s3_access_key)",
+			ToolTip:      "访问密钥ID(AK)，不填时使用环境变量或者 EC2 实例的 IAM role",
+		},
+		{
+			KeyName:      KeyS3SecretKey,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "访问密钥",
+			DefaultNoUse: false,
+			Description:  "SK(s3_secret_key)",
+			ToolTip:      "与访问密钥ID结合使用的密钥(SK)",
+		},
+		{
+			KeyName:      KeyS3Bucket,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "",
+			DefaultNoUse: false,
+			Required:     true,
+			Description:  "存储桶名称(s3_bucket)",
+			ToolTip:      "存储桶名称",
+		},
+		{
+			KeyName:      KeyS3Prefix,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "AWSLogs/123456789012/elasticloadbalancing/",
+			DefaultNoUse: false,
+			Description:  "object 前缀(s3_prefix)",
+			ToolTip:      "只读取以这个前缀开头的 object",
+		},
+		{
+			KeyName:       KeyS3Compression,
+			ChooseOnly:    true,
+			ChooseOptions: []interface{}{S3CompressionAuto, S3CompressionGzip, S3CompressionNone},
+			Default:       S3CompressionAuto,
+			Description:   "压缩格式(s3_compression)",
+			Advance:       true,
+			ToolTip:       "auto 根据 .gz 后缀或者文件头自动识别 gzip，gzip 总是解压，none 不解压",
+		},
+		{
+			KeyName:      KeyS3SQSQueueURL,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "https://sqs.us-east-1.amazonaws.com/123456789012/elb-logs",
+			DefaultNoUse: false,
+			Description:  "SQS 队列(s3_sqs_queue_url)",
+			Advance:      true,
+			ToolTip:      "接收 bucket 的 ObjectCreated 事件通知的 SQS 队列，填写后不再列出 prefix，object 写入后立即读取",
+		},
+		{
+			KeyName:      KeySyncInterval,
+			ChooseOnly:   false,
+			Default:      "1m",
+			DefaultNoUse: false,
+			Description:  "扫描间隔(sync_interval)",
+			CheckRegex:   "\\d+[hms]",
+			Advance:      true,
+			ToolTip:      "没有配置 SQS 队列时，每隔多久列出一次 prefix 下的 object",
+		},
+		{
+			KeyName:      KeyS3Endpoint,
+			ChooseOnly:   false,
+			Default:      "",
+			Placeholder:  "http://127.0.0.1:9000",
+			DefaultNoUse: false,
+			Description:  "S3 地址(s3_endpoint)",
+			Advance:      true,
+			ToolTip:      "兼容 S3 协议的其他存储的地址，不填时根据区域使用 AWS S3 的地址",
+		},
+		OptionMetaPath,
+		OptionMetaStore,
+		OptionMetaStoreAddress,
+		OptionMetaStorePassword,
+		OptionMetaStoreRedisDB,
+		OptionMetaStorePrefix,
+		OptionDataSourceTag,
+	},
 	ModeCloudTrail: {
 		{
 			KeyName:      KeyS3Region,
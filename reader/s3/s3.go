@@ -0,0 +1,462 @@
+// Package s3 读取 AWS S3 bucket 中 prefix 下的 object，如 ELB、ALB、CloudFront 的访问日志。
+// 新的 object 通过定期列出 prefix 或者接收 SQS 中的 S3 事件通知发现，读取完成的 object 记录在 meta 中，每个 object 只读取一次
+package s3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchellh/goamz/aws"
+	awss3 "github.com/mitchellh/goamz/s3"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// stateFile 是 meta 中保存读取进度的文件名
+	stateFile = "s3.state"
+	// processedRetention 是使用 SQS 时记录已经读取的 object 的时间，超过后不会再收到这个 object 的通知
+	processedRetention = 7 * 24 * time.Hour
+	// retryInterval 是列出或者读取 object 出错后重试的间隔
+	retryInterval = 3 * time.Second
+)
+
+var errStopped = errors.New("reader is stopped")
+
+func init() {
+	reader.RegisterConstructor(reader.ModeS3, NewReader)
+}
+
+type line struct {
+	key  string
+	n    int64 // 这一行在 object 中的行号，从 1 开始
+	text string
+	done bool // object 已经读取完成，这一项只用于记录进度，没有内容
+}
+
+// state 是保存在 meta 中的读取进度
+type state struct {
+	// Processed 记录读取完成的 object 以及完成的时间
+	Processed map[string]int64 `json:"processed"`
+	// Current 和 Lines 是正在读取的 object 以及已经读取的行数，重启后跳过这些行
+	Current string `json:"current"`
+	Lines   int64  `json:"lines"`
+}
+
+// notification 是一条 SQS 消息，消息中所有的 object 都读取完成并保存到 meta 之后才从队列中删除
+type notification struct {
+	receipt   string
+	keys      []string
+	deletable bool
+}
+
+type Reader struct {
+	meta        *reader.Meta
+	bucket      *awss3.Bucket
+	prefix      string
+	compression string
+	interval    time.Duration
+	queue       *sqsQueue // 为 nil 时定期列出 prefix 下的 object
+
+	status int32
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	readChan chan line
+
+	mux sync.Mutex
+	// state 是最近一次 ReadLine 返回的位置，SyncMeta 时保存
+	state state
+	// putLines 记录已经放入 readChan 的行数，queued 记录已经全部放入 readChan 的 object，避免重复读取
+	putLines      map[string]int64
+	queued        map[string]bool
+	notifications []*notification
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	region, _ := c.GetString(reader.KeyS3Region)
+	if region == "" {
+		return nil, fmt.Errorf("%v must not be empty", reader.KeyS3Region)
+	}
+	bucketName, _ := c.GetString(reader.KeyS3Bucket)
+	if bucketName == "" {
+		return nil, fmt.Errorf("%v must not be empty", reader.KeyS3Bucket)
+	}
+	prefix, _ := c.GetStringOr(reader.KeyS3Prefix, "")
+	ak, _ := c.GetStringOr(reader.KeyS3AccessKey, "")
+	sk, _ := c.GetStringOr(reader.KeyS3SecretKey, "")
+	endpoint, _ := c.GetStringOr(reader.KeyS3Endpoint, "")
+	queueURL, _ := c.GetStringOr(reader.KeyS3SQSQueueURL, "")
+	compression, _ := c.GetStringOr(reader.KeyS3Compression, reader.S3CompressionAuto)
+	switch compression {
+	case reader.S3CompressionAuto, reader.S3CompressionGzip, reader.S3CompressionNone:
+	default:
+		return nil, fmt.Errorf("%v %v not supported, should be one of %v, %v, %v", reader.KeyS3Compression, compression,
+			reader.S3CompressionAuto, reader.S3CompressionGzip, reader.S3CompressionNone)
+	}
+	intervalStr, _ := c.GetStringOr(reader.KeySyncInterval, "1m")
+	interval, err := time.ParseDuration(intervalStr)
+	if err != nil {
+		return nil, err
+	}
+
+	awsRegion, ok := aws.Regions[region]
+	if endpoint != "" {
+		awsRegion = aws.Region{Name: region, S3Endpoint: strings.TrimSuffix(endpoint, "/")}
+	} else if !ok {
+		return nil, fmt.Errorf("unknown %v %v, set %v if it is not an AWS region", reader.KeyS3Region, region, reader.KeyS3Endpoint)
+	}
+	// access key 为空时依次尝试环境变量和 EC2 的 IAM role
+	auth, err := aws.GetAuth(ak, sk)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reader{
+		meta:        meta,
+		bucket:      awss3.New(auth, awsRegion).Bucket(bucketName),
+		prefix:      prefix,
+		compression: compression,
+		interval:    interval,
+		status:      reader.StatusInit,
+		ctx:         ctx,
+		cancel:      cancel,
+		readChan:    make(chan line, 100),
+		putLines:    make(map[string]int64),
+		queued:      make(map[string]bool),
+	}
+	if queueURL != "" {
+		r.queue = newSQSQueue(queueURL, region, auth)
+	}
+
+	data, err := meta.ReadValue(stateFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Runner[%v] %v read meta error: %v, omit meta data...", meta.RunnerName, r.Name(), err)
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &r.state); err != nil {
+			log.Errorf("Runner[%v] %v meta data is corrupted err: %v, omit meta data...", meta.RunnerName, r.Name(), err)
+			r.state = state{}
+		}
+	}
+	if r.state.Processed == nil {
+		r.state.Processed = make(map[string]int64)
+	}
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "S3Reader<s3://" + r.bucket.Name + "/" + r.prefix + ">"
+}
+
+// Source 返回最近一次读取的 object
+func (r *Reader) Source() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return "s3://" + r.bucket.Name + "/" + r.state.Current
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("S3Reader not support readmode")
+}
+
+func (r *Reader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+func (r *Reader) run() {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		var err error
+		wait := r.interval
+		if r.queue != nil {
+			err = r.receiveOnce()
+			wait = 0
+		} else {
+			err = r.listOnce()
+		}
+		if err == errStopped {
+			return
+		}
+		if err != nil {
+			log.Errorf("Runner[%v] %v error: %v, retry after %v", r.meta.RunnerName, r.Name(), err, retryInterval)
+			r.setStatsError(err.Error())
+			wait = retryInterval
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// listOnce 列出 prefix 下的所有 object 并依次读取还没有读取过的 object，已经被删除的 object 不再记录
+func (r *Reader) listOnce() error {
+	var keys []string
+	marker := ""
+	for {
+		resp, err := r.bucket.List(r.prefix, "", marker, 0)
+		if err != nil {
+			return err
+		}
+		for _, k := range resp.Contents {
+			if !strings.HasSuffix(k.Key, "/") {
+				keys = append(keys, k.Key)
+			}
+		}
+		if !resp.IsTruncated || len(resp.Contents) == 0 {
+			break
+		}
+		marker = resp.Contents[len(resp.Contents)-1].Key
+	}
+
+	listed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		listed[key] = true
+	}
+	r.mux.Lock()
+	for key := range r.state.Processed {
+		if !listed[key] {
+			delete(r.state.Processed, key)
+		}
+	}
+	r.mux.Unlock()
+
+	for _, key := range keys {
+		if err := r.readObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveOnce 从 SQS 接收一批 S3 事件通知并读取其中的 object，然后删除已经保存到 meta 的消息
+func (r *Reader) receiveOnce() error {
+	msgs, err := r.queue.receive(r.ctx)
+	if err != nil {
+		if atomic.LoadInt32(&r.status) != reader.StatusRunning {
+			return errStopped
+		}
+		return err
+	}
+	for _, msg := range msgs {
+		keys, err := parseS3Event(msg.Body, r.bucket.Name, r.prefix)
+		if err != nil {
+			log.Warnf("Runner[%v] %v parse sqs message error %v, ignore it...", r.meta.RunnerName, r.Name(), err)
+		}
+		for _, key := range keys {
+			if err = r.readObject(key); err != nil {
+				return err
+			}
+		}
+		r.mux.Lock()
+		r.notifications = append(r.notifications, &notification{receipt: msg.ReceiptHandle, keys: keys})
+		r.mux.Unlock()
+	}
+
+	expired := time.Now().Add(-processedRetention).Unix()
+	var deletable []*notification
+	r.mux.Lock()
+	for key, t := range r.state.Processed {
+		if t < expired {
+			delete(r.state.Processed, key)
+		}
+	}
+	remain := r.notifications[:0]
+	for _, n := range r.notifications {
+		if n.deletable || len(n.keys) == 0 {
+			deletable = append(deletable, n)
+		} else {
+			remain = append(remain, n)
+		}
+	}
+	r.notifications = remain
+	r.mux.Unlock()
+
+	for _, n := range deletable {
+		if err = r.queue.delete(r.ctx, n.receipt); err != nil {
+			log.Errorf("Runner[%v] %v delete sqs message error %v", r.meta.RunnerName, r.Name(), err)
+		}
+	}
+	return nil
+}
+
+// readObject 读取一个 object 并把每一行放入 readChan，已经读取过的 object 和行会被跳过
+func (r *Reader) readObject(key string) error {
+	r.mux.Lock()
+	_, processed := r.state.Processed[key]
+	queued := r.queued[key]
+	skip := r.putLines[key]
+	if r.state.Current == key && r.state.Lines > skip {
+		skip = r.state.Lines
+	}
+	r.mux.Unlock()
+	if processed || queued {
+		return nil
+	}
+
+	rc, err := r.bucket.GetReader(key)
+	if err != nil {
+		return fmt.Errorf("get s3://%v/%v: %v", r.bucket.Name, key, err)
+	}
+	defer rc.Close()
+	br, err := r.decompress(key, rc)
+	if err != nil {
+		return fmt.Errorf("decompress s3://%v/%v: %v", r.bucket.Name, key, err)
+	}
+	if skip == 0 {
+		log.Infof("Runner[%v] %v start reading s3://%v/%v", r.meta.RunnerName, r.Name(), r.bucket.Name, key)
+	} else {
+		log.Infof("Runner[%v] %v continue reading s3://%v/%v after line %v", r.meta.RunnerName, r.Name(), r.bucket.Name, key, skip)
+	}
+
+	var n int64
+	for {
+		text, err := br.ReadString('\n')
+		if text != "" {
+			n++
+			if n > skip {
+				if !r.put(line{key: key, n: n, text: text}) {
+					return errStopped
+				}
+				r.mux.Lock()
+				r.putLines[key] = n
+				r.mux.Unlock()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read s3://%v/%v: %v", r.bucket.Name, key, err)
+		}
+	}
+	if !r.put(line{key: key, n: n, done: true}) {
+		return errStopped
+	}
+	r.mux.Lock()
+	r.queued[key] = true
+	r.mux.Unlock()
+	return nil
+}
+
+// decompress 根据 s3_compression 解压 object，auto 时根据 .gz 后缀或者 gzip 的文件头判断
+func (r *Reader) decompress(key string, rd io.Reader) (*bufio.Reader, error) {
+	br := bufio.NewReader(rd)
+	gz := r.compression == reader.S3CompressionGzip
+	if r.compression == reader.S3CompressionAuto {
+		if strings.HasSuffix(key, ".gz") {
+			gz = true
+		} else if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			gz = true
+		}
+	}
+	if !gz {
+		return br, nil
+	}
+	gr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(gr), nil
+}
+
+// put 在 reader 运行时一直等待 readChan 有空位，reader 关闭后返回 false
+func (r *Reader) put(l line) bool {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		select {
+		case r.readChan <- l:
+			return true
+		case <-time.After(time.Second):
+		}
+	}
+	return false
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case l := <-r.readChan:
+		r.mux.Lock()
+		if l.done {
+			r.state.Processed[l.key] = time.Now().Unix()
+			r.state.Current, r.state.Lines = "", 0
+			delete(r.putLines, l.key)
+			delete(r.queued, l.key)
+		} else {
+			r.state.Current, r.state.Lines = l.key, l.n
+		}
+		r.mux.Unlock()
+		return l.text, nil
+	case <-timer.C:
+	}
+	return "", nil
+}
+
+// SyncMeta 保存读取完成的 object 以及正在读取的位置，runner 在数据发送成功后调用
+func (r *Reader) SyncMeta() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	data, err := json.Marshal(r.state)
+	if err != nil {
+		log.Errorf("Runner[%v] %v marshal meta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	if err = r.meta.WriteValue(stateFile, data); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+		return
+	}
+	for _, n := range r.notifications {
+		n.deletable = true
+		for _, key := range n.keys {
+			if _, ok := r.state.Processed[key]; !ok {
+				n.deletable = false
+				break
+			}
+		}
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	r.cancel()
+	return nil
+}
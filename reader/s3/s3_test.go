@@ -0,0 +1,208 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+)
+
+type fakeS3 struct {
+	mux      sync.Mutex
+	objects  map[string][]byte
+	messages []string
+	deleted  []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	switch {
+	case req.URL.Path == "/queue":
+		req.ParseForm()
+		switch req.Form.Get("Action") {
+		case "ReceiveMessage":
+			var b bytes.Buffer
+			b.WriteString("<ReceiveMessageResponse><ReceiveMessageResult>")
+			for i, body := range f.messages {
+				fmt.Fprintf(&b, "<Message><ReceiptHandle>r%d</ReceiptHandle><Body>%s</Body></Message>", i, body)
+			}
+			b.WriteString("</ReceiveMessageResult></ReceiveMessageResponse>")
+			f.messages = nil
+			w.Write(b.Bytes())
+		case "DeleteMessage":
+			f.deleted = append(f.deleted, req.Form.Get("ReceiptHandle"))
+			w.Write([]byte("<DeleteMessageResponse></DeleteMessageResponse>"))
+		}
+	case req.URL.Path == "/logs" || req.URL.Path == "/logs/":
+		prefix := req.URL.Query().Get("prefix")
+		var b bytes.Buffer
+		b.WriteString("<ListBucketResult><Name>logs</Name><IsTruncated>false</IsTruncated>")
+		for _, key := range []string{"elb/a.log", "elb/b.log.gz", "other/c.log"} {
+			if _, ok := f.objects[key]; ok && strings.HasPrefix(key, prefix) {
+				fmt.Fprintf(&b, "<Contents><Key>%s</Key></Contents>", key)
+			}
+		}
+		b.WriteString("</ListBucketResult>")
+		w.Write(b.Bytes())
+	default:
+		data, ok := f.objects[strings.TrimPrefix(req.URL.Path, "/logs/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+func gzipData(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	_, err := gw.Write([]byte(s))
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+	return b.Bytes()
+}
+
+func readLines(t *testing.T, r reader.Reader, n, tries int) []string {
+	var lines []string
+	for i := 0; i < tries && len(lines) < n; i++ {
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func newTestReader(t *testing.T, c conf.MapConf) reader.Reader {
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestReadList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestS3ReadList")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := &fakeS3{objects: map[string][]byte{
+		"elb/a.log":    []byte("1\n2\n3\n"),
+		"elb/b.log.gz": gzipData(t, "4\n5"),
+		"other/c.log":  []byte("6\n"),
+	}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	c := conf.MapConf{
+		reader.KeyMetaPath:    filepath.Join(dir, "meta"),
+		reader.KeyMode:        reader.ModeS3,
+		reader.KeyS3Region:    "test",
+		reader.KeyS3Endpoint:  server.URL,
+		reader.KeyS3AccessKey: "ak",
+		reader.KeyS3SecretKey: "sk",
+		reader.KeyS3Bucket:    "logs",
+		reader.KeyS3Prefix:    "elb/",
+	}
+	r := newTestReader(t, c)
+	assert.Equal(t, []string{"1\n"}, readLines(t, r, 1, 5))
+	r.SyncMeta()
+	assert.NoError(t, r.Close())
+
+	// 重启后从上次保存的行之后继续读取
+	r = newTestReader(t, c)
+	assert.Equal(t, []string{"2\n", "3\n", "4\n", "5"}, readLines(t, r, 4, 10))
+	assert.Equal(t, "s3://logs/elb/b.log.gz", r.Source())
+	readLines(t, r, 1, 1)
+	r.SyncMeta()
+	assert.NoError(t, r.Close())
+
+	// 读取完成的 object 不会重复读取
+	r = newTestReader(t, c)
+	assert.Empty(t, readLines(t, r, 1, 3))
+	assert.NoError(t, r.Close())
+
+	c[reader.KeyS3Compression] = "zip"
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+}
+
+func TestReadSQS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestS3ReadSQS")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := &fakeS3{
+		objects: map[string][]byte{
+			"elb/a b.log": []byte("1\n"),
+		},
+		messages: []string{
+			`{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"logs"},"object":{"key":"elb/a+b.log"}}}]}`,
+			`{"Event":"s3:TestEvent"}`,
+		},
+	}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	c := conf.MapConf{
+		reader.KeyMetaPath:      filepath.Join(dir, "meta"),
+		reader.KeyMode:          reader.ModeS3,
+		reader.KeyS3Region:      "test",
+		reader.KeyS3Endpoint:    server.URL,
+		reader.KeyS3AccessKey:   "ak",
+		reader.KeyS3SecretKey:   "sk",
+		reader.KeyS3Bucket:      "logs",
+		reader.KeyS3SQSQueueURL: server.URL + "/queue",
+	}
+	r := newTestReader(t, c)
+	defer r.Close()
+	assert.Equal(t, []string{"1\n"}, readLines(t, r, 1, 5))
+	readLines(t, r, 1, 1)
+	r.SyncMeta()
+
+	var deleted []string
+	for i := 0; i < 50 && len(deleted) < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+		fs.mux.Lock()
+		deleted = append([]string{}, fs.deleted...)
+		fs.mux.Unlock()
+	}
+	assert.Equal(t, []string{"r1", "r0"}, deleted)
+}
+
+func TestParseS3Event(t *testing.T) {
+	body := `{"Records":[` +
+		`{"eventName":"ObjectCreated:CompleteMultipartUpload","s3":{"bucket":{"name":"logs"},"object":{"key":"elb/2018/06/01/a%3Db.log.gz"}}},` +
+		`{"eventName":"ObjectRemoved:Delete","s3":{"bucket":{"name":"logs"},"object":{"key":"elb/old.log"}}},` +
+		`{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"other"},"object":{"key":"elb/c.log"}}},` +
+		`{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"logs"},"object":{"key":"cdn/d.log"}}}]}`
+	keys, err := parseS3Event(body, "logs", "elb/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"elb/2018/06/01/a=b.log.gz"}, keys)
+
+	sns := fmt.Sprintf(`{"Type":"Notification","Message":%q}`, body)
+	keys, err = parseS3Event(sns, "logs", "elb/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"elb/2018/06/01/a=b.log.gz"}, keys)
+
+	_, err = parseS3Event("not json", "logs", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/mitchellh/goamz/aws"
+)
+
+const (
+	sqsAPIVersion = "2012-11-05"
+	// sqsWaitSeconds 是 ReceiveMessage 长轮询的等待时间
+	sqsWaitSeconds = 20
+	// sqsMaxMessages 是每次 ReceiveMessage 最多取出的消息数
+	sqsMaxMessages = 10
+)
+
+// sqsQueue 是接收 S3 事件通知的 SQS 队列，只实现了 ReceiveMessage 和 DeleteMessage
+type sqsQueue struct {
+	url    string
+	region string
+	signer v4.Signer
+	client *http.Client
+}
+
+type sqsMessage struct {
+	ReceiptHandle string `xml:"ReceiptHandle"`
+	Body          string `xml:"Body"`
+}
+
+func newSQSQueue(queueURL, region string, auth aws.Auth) *sqsQueue {
+	return &sqsQueue{
+		url:    queueURL,
+		region: region,
+		signer: v4.Signer{
+			Credentials: credentials.NewStaticCredentials(auth.AccessKey, auth.SecretKey, auth.Token),
+		},
+		client: &http.Client{Timeout: (sqsWaitSeconds + 10) * time.Second},
+	}
+}
+
+func (q *sqsQueue) call(ctx context.Context, action string, params url.Values, result interface{}) error {
+	params.Set("Action", action)
+	params.Set("Version", sqsAPIVersion)
+	body := params.Encode()
+	req, err := http.NewRequest(http.MethodPost, q.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if _, err = q.signer.Sign(req, strings.NewReader(body), "sqs", q.region, time.Now()); err != nil {
+		return err
+	}
+	resp, err := q.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return fmt.Errorf("sqs %v: %v %v", action, e.Code, e.Message)
+		}
+		return fmt.Errorf("sqs %v: %v %v", action, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if result == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(result)
+}
+
+func (q *sqsQueue) receive(ctx context.Context) ([]sqsMessage, error) {
+	params := url.Values{}
+	params.Set("MaxNumberOfMessages", strconv.Itoa(sqsMaxMessages))
+	params.Set("WaitTimeSeconds", strconv.Itoa(sqsWaitSeconds))
+	var result struct {
+		Messages []sqsMessage `xml:"ReceiveMessageResult>Message"`
+	}
+	if err := q.call(ctx, "ReceiveMessage", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Messages, nil
+}
+
+func (q *sqsQueue) delete(ctx context.Context, receipt string) error {
+	params := url.Values{}
+	params.Set("ReceiptHandle", receipt)
+	return q.call(ctx, "DeleteMessage", params, nil)
+}
+
+// parseS3Event 返回 S3 事件通知中 bucket 下以 prefix 开头的新建 object，支持直接发送到 SQS 和经过 SNS 转发两种消息格式
+func parseS3Event(body, bucket, prefix string) ([]string, error) {
+	var event struct {
+		Records []struct {
+			EventName string `json:"eventName"`
+			S3        struct {
+				Bucket struct {
+					Name string `json:"name"`
+				} `json:"bucket"`
+				Object struct {
+					Key string `json:"key"`
+				} `json:"object"`
+			} `json:"s3"`
+		} `json:"Records"`
+		// Message 是 SNS 转发时原始的事件通知
+		Message string `json:"Message"`
+	}
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return nil, err
+	}
+	if len(event.Records) == 0 && event.Message != "" {
+		return parseS3Event(event.Message, bucket, prefix)
+	}
+	var keys []string
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") || record.S3.Bucket.Name != bucket {
+			continue
+		}
+		// 事件中的 key 经过了 URL 编码
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, "/") {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -1,7 +1,9 @@
 package script
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os/exec"
 	"strings"
 	"sync"
@@ -21,14 +23,26 @@ func init() {
 	reader.RegisterConstructor(reader.ModeScript, NewReader)
 }
 
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+// output 是脚本一次执行的标准输出或者标准错误
+type output struct {
+	data   []byte
+	stream string
+}
+
 type Reader struct {
 	realpath   string // 处理文件路径
 	originpath string
 	scripttype string
 
-	Cron *cron.Cron //定时任务
+	Cron     *cron.Cron //定时任务
+	schedule cron.Schedule
 
-	readChan chan []byte
+	readChan chan output
 	errChan  chan error
 
 	meta *reader.Meta
@@ -40,6 +54,13 @@ type Reader struct {
 	execOnStart  bool
 	loop         bool
 	loopDuration time.Duration
+	timeout      time.Duration
+	readStderr   bool
+	lastStream   string
+
+	// lastRun 是最近一次执行成功的开始时间，SyncMeta 时写入 meta
+	lastRun   time.Time
+	syncedRun time.Time
 
 	stats     StatsInfo
 	statsLock sync.RWMutex
@@ -60,20 +81,39 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (sr reader.Reader, err erro
 	cronSchedule, _ := conf.GetStringOr(reader.KeyScriptCron, "")
 	execOnStart, _ := conf.GetBoolOr(reader.KeyScriptExecOnStart, true)
 	scriptType, _ := conf.GetStringOr(reader.KeyExecInterpreter, "bash")
+	readStderr, _ := conf.GetBoolOr(reader.KeyScriptReadStderr, false)
+	timeoutStr, _ := conf.GetStringOr(reader.KeyScriptTimeout, "")
+	var timeout time.Duration
+	if timeoutStr != "" {
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("%v %q is not a valid duration: %v", reader.KeyScriptTimeout, timeoutStr, err)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("%v should not be negative", reader.KeyScriptTimeout)
+		}
+	}
 	ssr := &Reader{
 		originpath:  originPath,
 		realpath:    path,
 		scripttype:  scriptType,
 		Cron:        cron.New(),
-		readChan:    make(chan []byte),
+		readChan:    make(chan output),
 		errChan:     make(chan error),
 		meta:        meta,
 		status:      reader.StatusInit,
 		mux:         sync.Mutex{},
 		started:     false,
 		execOnStart: execOnStart,
+		timeout:     timeout,
+		readStderr:  readStderr,
 		statsLock:   sync.RWMutex{},
 	}
+	// meta 中记录的是脚本路径和最近一次执行成功的时间(unix 秒)
+	if file, sec, rerr := meta.ReadOffset(); rerr == nil && file == originPath && sec > 0 {
+		ssr.lastRun = time.Unix(sec, 0)
+		ssr.syncedRun = ssr.lastRun
+	}
 
 	//schedule    string     //定时任务配置串
 	if len(cronSchedule) > 0 {
@@ -86,24 +126,35 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (sr reader.Reader, err erro
 				err = nil
 			}
 		} else {
-			err = ssr.Cron.AddFunc(cronSchedule, ssr.run)
+			ssr.schedule, err = parseSchedule(cronSchedule)
 			if err != nil {
 				return
 			}
+			ssr.Cron.Schedule(ssr.schedule, cron.FuncJob(ssr.run))
 			log.Infof("Runner[%v] %v Cron job added with schedule <%v>", ssr.meta.RunnerName, ssr.Name(), cronSchedule)
 		}
 	}
 	return ssr, nil
 }
 
+// parseSchedule 解析定时任务，5 个字段时按照标准的 crontab 格式(分 时 日 月 星期)解析，
+// 否则按照带秒的 6 个字段或者 @every 1h 这类描述符解析
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if len(strings.Fields(spec)) == 5 {
+		return cron.ParseStandard(spec)
+	}
+	return cron.Parse(spec)
+}
+
 func (sr *Reader) ReadLine() (data string, err error) {
 	if !sr.started {
 		sr.Start()
 	}
 	timer := time.NewTimer(time.Second)
 	select {
-	case dat := <-sr.readChan:
-		data = string(dat)
+	case out := <-sr.readChan:
+		data = string(out.data)
+		sr.lastStream = out.stream
 	case err = <-sr.errChan:
 	case <-timer.C:
 	}
@@ -134,7 +185,7 @@ func (sr *Reader) Start() {
 		go sr.LoopRun()
 	} else {
 		sr.Cron.Start()
-		if sr.execOnStart {
+		if sr.execOnStart || sr.missedRun(time.Now()) {
 			go sr.run()
 		}
 	}
@@ -154,7 +205,38 @@ func (sr *Reader) SetMode(mode string, v interface{}) error {
 	return errors.New("ScriptReader not support readmode")
 }
 
-func (sr *Reader) SyncMeta() {}
+// missedRun 返回 logkit 停止期间是否错过了定时任务，错过时启动后立即补执行一次
+func (sr *Reader) missedRun(now time.Time) bool {
+	sr.statsLock.RLock()
+	lastRun := sr.lastRun
+	sr.statsLock.RUnlock()
+	if sr.schedule == nil || lastRun.IsZero() {
+		return false
+	}
+	return !sr.schedule.Next(lastRun).After(now)
+}
+
+// MessageMeta 返回最近一次读到的数据来自脚本的标准输出(stdout)还是标准错误(stderr)
+func (sr *Reader) MessageMeta() (map[string]interface{}, bool) {
+	if sr.lastStream == "" {
+		return nil, false
+	}
+	return map[string]interface{}{"stream": sr.lastStream}, true
+}
+
+// SyncMeta 把最近一次执行成功的时间写入 meta，重启后用来判断是否错过了定时任务
+func (sr *Reader) SyncMeta() {
+	sr.statsLock.Lock()
+	defer sr.statsLock.Unlock()
+	if sr.lastRun.Equal(sr.syncedRun) {
+		return
+	}
+	if err := sr.meta.WriteOffset(sr.originpath, sr.lastRun.Unix()); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", sr.meta.RunnerName, sr.Name(), err)
+		return
+	}
+	sr.syncedRun = sr.lastRun
+}
 
 func (sr *Reader) Close() (err error) {
 	sr.Cron.Stop()
@@ -225,12 +307,48 @@ func (sr *Reader) exec() (err error) {
 	sr.mux.Lock()
 	defer sr.mux.Unlock()
 	command := exec.Command(sr.scripttype, sr.realpath) //初始化Cmd
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
 
-	res, err := command.Output()
+	start := time.Now()
+	if err = command.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+	var timeoutC <-chan time.Time
+	if sr.timeout > 0 {
+		timer := time.NewTimer(sr.timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	// 超时后不等待 Wait 返回，脚本启动的子进程可能还持有输出管道，Wait 会一直等到子进程退出
+	select {
+	case err = <-done:
+	case <-timeoutC:
+		command.Process.Kill()
+		return fmt.Errorf("script %v timed out after %v", sr.realpath, sr.timeout)
+	}
 	if err != nil {
+		if stderr.Len() > 0 {
+			err = fmt.Errorf("%v, stderr: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
 		return err
 	}
-	sr.readChan <- res
+	sr.readChan <- output{data: stdout.Bytes(), stream: streamStdout}
+	if stderr.Len() > 0 {
+		if sr.readStderr {
+			sr.readChan <- output{data: stderr.Bytes(), stream: streamStderr}
+		} else {
+			log.Warnf("Runner[%v] %v script stderr: %s", sr.meta.RunnerName, sr.Name(), bytes.TrimSpace(stderr.Bytes()))
+		}
+	}
+	sr.statsLock.Lock()
+	sr.lastRun = start
+	sr.statsLock.Unlock()
 	return nil
 }
 
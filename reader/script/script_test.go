@@ -3,6 +3,7 @@ package script
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -40,3 +41,71 @@ func Test_scriptFile(t *testing.T) {
 	}
 	assert.Equal(t, "hello world\n", data)
 }
+
+func Test_scriptStderrAndTimeout(t *testing.T) {
+	fileName := os.TempDir() + "/scriptStderr.sh"
+	CreateFile(fileName, "echo out\necho err >&2")
+	defer DeleteFile(fileName)
+	metaDir := os.TempDir() + "/scriptStderrMeta"
+	defer os.RemoveAll(metaDir)
+
+	readerConf := conf.MapConf{
+		reader.KeyExecInterpreter:  "bash",
+		reader.KeyLogPath:          fileName,
+		reader.KeyMetaPath:         metaDir,
+		reader.KeyScriptReadStderr: "true",
+		reader.KeyScriptCron:       "0 4 * * *",
+	}
+	meta, err := reader.NewMetaWithConf(readerConf)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, readerConf)
+	assert.NoError(t, err)
+	sr := r.(*Reader)
+
+	data, err := sr.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "out\n", data)
+	m, ok := sr.MessageMeta()
+	assert.True(t, ok)
+	assert.Equal(t, "stdout", m["stream"])
+	data, err = sr.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "err\n", data)
+	m, _ = sr.MessageMeta()
+	assert.Equal(t, "stderr", m["stream"])
+
+	// 等待 exec 记录执行成功的时间
+	time.Sleep(100 * time.Millisecond)
+	sr.SyncMeta()
+	file, sec, err := meta.ReadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, fileName, file)
+	assert.True(t, sec > 0)
+	sr.Close()
+
+	// 重启后根据 meta 判断是否错过了定时任务
+	r, err = NewReader(meta, readerConf)
+	assert.NoError(t, err)
+	sr = r.(*Reader)
+	assert.Equal(t, sec, sr.lastRun.Unix())
+	assert.False(t, sr.missedRun(sr.lastRun.Add(time.Minute)))
+	assert.True(t, sr.missedRun(sr.lastRun.Add(25*time.Hour)))
+
+	sleepFile := os.TempDir() + "/scriptSleep.sh"
+	CreateFile(sleepFile, "sleep 5")
+	defer DeleteFile(sleepFile)
+	readerConf[reader.KeyLogPath] = sleepFile
+	readerConf[reader.KeyScriptTimeout] = "100ms"
+	r, err = NewReader(meta, readerConf)
+	assert.NoError(t, err)
+	sr = r.(*Reader)
+	start := time.Now()
+	err = sr.exec()
+	assert.True(t, time.Since(start) < 3*time.Second)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+
+	readerConf[reader.KeyScriptTimeout] = "abc"
+	_, err = NewReader(meta, readerConf)
+	assert.Error(t, err)
+}
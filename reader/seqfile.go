@@ -160,7 +160,7 @@ func (sf *SeqFile) getIgnoreCondition() func(os.FileInfo) bool {
 				return false
 			}
 		}
-		match, err := filepath.Match(sf.validFilePattern, fi.Name())
+		match, err := utilsos.Match(sf.validFilePattern, fi.Name())
 		if err != nil {
 			log.Errorf("when read dir %s, get not valid file pattern. Error->%v", sf.dir, err)
 			return false
@@ -565,6 +565,13 @@ func (sf *SeqFile) SyncMeta() (err error) {
 	return sf.meta.WriteOffset(sf.currFile, sf.offset)
 }
 
+// Position 返回当前读取的文件 inode 和已经读取到的 offset
+func (sf *SeqFile) Position() (uint64, int64) {
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	return sf.inode, sf.offset
+}
+
 func (sf *SeqFile) Lag() (rl *LagInfo, err error) {
 	sf.mux.Lock()
 	rl = &LagInfo{Size: -sf.offset, SizeUnit: "bytes"}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,13 +25,20 @@ type SingleFile struct {
 	originpath string
 	pfi        os.FileInfo // path 的文件信息
 	f          *os.File    // 当前处理文件
+	inode      uint64      // 当前处理文件的 inode
 	ratereader io.ReadCloser
-	offset     int64 // 当前处理文件offset
+	offset     int64 // 当前处理文件offset，gzip 文件为解压后的 offset
 	stopped    int32
 
+	gzip     bool // 是否是 gzip 压缩的文件，压缩文件不会再增长，读完一次就结束
+	gzipDone bool // gzip 文件已经读完，记录在 donefile 中
+
 	lastSyncPath   string
 	lastSyncOffset int64
 
+	// DisableReopen 为 true 时只读取已经打开的文件，路径指向新文件时不会重新打开，由调用方负责读取新文件
+	DisableReopen bool
+
 	mux  sync.Mutex
 	meta *Meta // 记录offset的元数据
 }
@@ -95,6 +103,14 @@ func NewSingleFile(meta *Meta, path, whence string, errDirectReturn bool) (sf *S
 		mux:        sync.Mutex{},
 	}
 
+	if sf.inode, err = utilsos.GetIdentifyIDByFile(f); err != nil {
+		log.Warnf("Runner[%v] %s - get inode error %v, ignore...", meta.RunnerName, path, err)
+		err = nil
+	}
+	if IsGzipFile(path) {
+		return sf.initGzip(offset, omitMeta)
+	}
+
 	// 如果meta初始信息损坏
 	if omitMeta {
 		offset, err = sf.startOffset(whence)
@@ -120,6 +136,89 @@ func NewSingleFile(meta *Meta, path, whence string, errDirectReturn bool) (sf *S
 	return sf, nil
 }
 
+// initGzip 初始化 gzip 文件的读取，压缩文件是轮转完成的完整文件，不考虑 whence，没有 meta 时从头开始读取；
+// 已经读完的文件直接返回 EOF，否则在第一次 Read 时再解压并跳过已经读取的部分
+func (sf *SingleFile) initGzip(offset int64, omitMeta bool) (*SingleFile, error) {
+	sf.gzip = true
+	if omitMeta {
+		offset = 0
+	}
+	sf.offset = offset
+	sf.ratereader.Close()
+	sf.ratereader = nil
+	if sf.meta.GetDoneFileInode()[joinFileInode(sf.realpath, strconv.FormatUint(sf.inode, 10))] {
+		log.Debugf("Runner[%v] gzip file %v has been read, ignore it...", sf.meta.RunnerName, sf.realpath)
+		sf.gzipDone = true
+	}
+	return sf, nil
+}
+
+// openGzip 从头解压 gzip 文件并跳过已经读取的 offset
+func (sf *SingleFile) openGzip() error {
+	if _, err := sf.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	rate := rateio.NewRateReader(sf.f, sf.meta.Readlimit)
+	gr, err := newGzipReadCloser(rate)
+	if err != nil {
+		rate.Close()
+		return err
+	}
+	if sf.offset > 0 {
+		_, err = io.CopyN(ioutil.Discard, gr, sf.offset)
+		if err == io.EOF {
+			//遇到Offset超过解压后的文件大小了,重新来过
+			log.Warnf("Runner[%v] gzip file %v is shorter than offset %v, read it from start", sf.meta.RunnerName, sf.realpath, sf.offset)
+			gr.Close()
+			sf.offset = 0
+			return sf.openGzip()
+		}
+		if err != nil {
+			gr.Close()
+			return err
+		}
+	}
+	sf.ratereader = gr
+	return nil
+}
+
+// readGzip 读取解压后的内容，读完后写入 donefile，之后一直返回 EOF；
+// 压缩数据不完整时(如 logrotate 还在压缩)返回 EOF，下次读取时重新解压
+func (sf *SingleFile) readGzip(p []byte) (n int, err error) {
+	if sf.gzipDone {
+		return 0, io.EOF
+	}
+	if sf.ratereader == nil {
+		if err = sf.openGzip(); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+	}
+	n, err = sf.ratereader.Read(p)
+	sf.offset += int64(n)
+	switch err {
+	case io.EOF:
+		sf.gzipDone = true
+		log.Infof("Runner[%v] gzip file %s has been read completely", sf.meta.RunnerName, sf.realpath)
+		if derr := sf.meta.AppendDoneFileInode(sf.realpath, sf.inode); derr != nil {
+			log.Errorf("Runner[%v] AppendDoneFile %v error %v", sf.meta.RunnerName, sf.realpath, derr)
+		}
+		sf.ratereader.Close()
+		sf.ratereader = nil
+	case io.ErrUnexpectedEOF:
+		log.Debugf("Runner[%v] gzip file %s is incomplete, wait for it", sf.meta.RunnerName, sf.realpath)
+		sf.ratereader.Close()
+		sf.ratereader = nil
+		err = io.EOF
+	}
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
 func (sf *SingleFile) statFile(path string) (pfi os.FileInfo, err error) {
 
 	for {
@@ -243,6 +342,7 @@ func (sf *SingleFile) Reopen() (err error) {
 	}
 	sf.pfi = pfi
 	sf.f = f
+	sf.inode = newInode
 	if sf.ratereader != nil {
 		sf.ratereader.Close()
 	}
@@ -252,6 +352,19 @@ func (sf *SingleFile) Reopen() (err error) {
 }
 
 func (sf *SingleFile) reopenForESTALE() (err error) {
+	if sf.gzip {
+		f, err := os.Open(sf.realpath)
+		if err != nil {
+			return err
+		}
+		sf.f.Close()
+		sf.f = f
+		if sf.ratereader != nil {
+			sf.ratereader.Close()
+			sf.ratereader = nil
+		}
+		return nil
+	}
 	f, err := os.Open(sf.originpath)
 	if err != nil {
 		return
@@ -282,7 +395,11 @@ func (sf *SingleFile) Read(p []byte) (n int, err error) {
 	}
 	sf.mux.Lock()
 	defer sf.mux.Unlock()
-	n, err = sf.ratereader.Read(p)
+	if sf.gzip {
+		n, err = sf.readGzip(p)
+	} else {
+		n, err = sf.ratereader.Read(p)
+	}
 	if err != nil && strings.Contains(err.Error(), "stale NFS file handle") {
 		nerr := sf.reopenForESTALE()
 		if nerr != nil {
@@ -290,6 +407,9 @@ func (sf *SingleFile) Read(p []byte) (n int, err error) {
 		}
 		return
 	}
+	if sf.gzip {
+		return
+	}
 	sf.offset += int64(n)
 	if err == io.EOF {
 		//读到了，如果n大于0，先把EOF抹去，返回
@@ -297,6 +417,9 @@ func (sf *SingleFile) Read(p []byte) (n int, err error) {
 			err = nil
 			return
 		}
+		if sf.DisableReopen {
+			return
+		}
 		err = sf.Reopen()
 		if err != nil {
 			return
@@ -308,6 +431,35 @@ func (sf *SingleFile) Read(p []byte) (n int, err error) {
 	return
 }
 
+// DetectTruncate 在文件大小小于当前读取的 offset 时认为文件被原地截断，此时文件的 inode 没有变化，Reopen 无法感知，
+// 直接从头开始读取
+func (sf *SingleFile) DetectTruncate() (bool, error) {
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	if sf.f == nil || sf.gzip {
+		return false, nil
+	}
+	fi, err := sf.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() >= sf.offset {
+		return false, nil
+	}
+	if _, err = sf.f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	sf.offset = 0
+	return true, nil
+}
+
+// Position 返回当前读取的文件 inode 和已经读取到的 offset
+func (sf *SingleFile) Position() (uint64, int64) {
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	return sf.inode, sf.offset
+}
+
 func (sf *SingleFile) SyncMeta() error {
 	sf.mux.Lock()
 	defer sf.mux.Unlock()
@@ -323,6 +475,11 @@ func (sf *SingleFile) SyncMeta() error {
 
 func (sf *SingleFile) Lag() (rl *LagInfo, err error) {
 	sf.mux.Lock()
+	if sf.gzip {
+		rl = sf.gzipLag()
+		sf.mux.Unlock()
+		return rl, nil
+	}
 	rl = &LagInfo{Size: -sf.offset, SizeUnit: "bytes"}
 	sf.mux.Unlock()
 
@@ -340,3 +497,19 @@ func (sf *SingleFile) Lag() (rl *LagInfo, err error) {
 
 	return rl, nil
 }
+
+// gzipLag 返回 gzip 文件还没有读取的压缩数据大小
+func (sf *SingleFile) gzipLag() *LagInfo {
+	rl := &LagInfo{SizeUnit: "bytes"}
+	if sf.gzipDone {
+		return rl
+	}
+	rl.Size = sf.pfi.Size()
+	if gr, ok := sf.ratereader.(*gzipReadCloser); ok {
+		rl.Size -= gr.src.n
+	}
+	if rl.Size < 0 {
+		rl.Size = 0
+	}
+	return rl
+}
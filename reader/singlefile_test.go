@@ -1,6 +1,8 @@
 package reader
 
 import (
+	"bytes"
+	"compress/gzip"
 	"io"
 	"io/ioutil"
 	"os"
@@ -119,6 +121,149 @@ func Test_singleFileNotRotate(t *testing.T) {
 	assert.Equal(t, "67890", string(p))
 }
 
+//测试文件被原地截断的情况
+func Test_singleFileTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Test_singleFileTruncate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+	metaDir := filepath.Join(dir, "meta")
+	CreateFile(fileName, "12345\n67890\n")
+
+	meta, err := NewMeta(metaDir, metaDir, fileName, ModeFile, "", DefautFileRetention)
+	assert.NoError(t, err)
+	sf, err := NewSingleFile(meta, fileName, WhenceOldest, true)
+	assert.NoError(t, err)
+	br, err := NewReaderSize(sf, meta, DefaultBufSize)
+	assert.NoError(t, err)
+	defer br.Close()
+
+	for _, exp := range []string{"12345\n", "67890\n"} {
+		line, err := br.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, exp, line)
+	}
+	_, err = br.ReadLine()
+	assert.Equal(t, io.EOF, err)
+
+	// 文件变大时不是截断
+	appendTestFile(fileName, "abc\n")
+	truncated, err := br.DetectTruncate()
+	assert.NoError(t, err)
+	assert.False(t, truncated)
+	line, err := br.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc\n", line)
+
+	// copytruncate 后文件 inode 不变，原来的 offset 之后已经没有数据
+	assert.NoError(t, os.Truncate(fileName, 0))
+	appendTestFile(fileName, "xyz\n")
+	line, err = br.ReadLine()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "", line)
+	truncated, err = br.DetectTruncate()
+	assert.NoError(t, err)
+	assert.True(t, truncated)
+	line, err = br.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "xyz\n", line)
+	assert.Equal(t, int64(4), sf.offset)
+}
+
+//测试读取 gzip 压缩的文件，包括压缩还没有完成的情况
+func Test_singleFileGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Test_singleFileGzip")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log.1.gz")
+	metaDir := filepath.Join(dir, "meta")
+
+	content := strings.Repeat("hello gzip\n", 1000)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	compressed := buf.Bytes()
+	half := len(compressed) / 2
+	assert.NoError(t, ioutil.WriteFile(fileName, compressed[:half], DefaultFilePerm))
+
+	meta, err := NewMeta(metaDir, metaDir, fileName, ModeFile, "", DefautFileRetention)
+	assert.NoError(t, err)
+	sf, err := NewSingleFile(meta, fileName, WhenceNewest, true)
+	assert.NoError(t, err)
+	// 压缩数据不完整时读到的内容是完整数据的前缀
+	got, err := ioutil.ReadAll(sf)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content, string(got)))
+	assert.False(t, sf.gzipDone)
+
+	appendTestFile(fileName, string(compressed[half:]))
+	rest, err := ioutil.ReadAll(sf)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(got)+string(rest))
+	assert.True(t, sf.gzipDone)
+	assert.Equal(t, int64(len(content)), sf.offset)
+	lag, err := sf.Lag()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), lag.Size)
+	assert.NoError(t, sf.SyncMeta())
+	assert.NoError(t, sf.Close())
+
+	// 读完的文件记录在 donefile 中，再次打开不会重复读取
+	sf, err = NewSingleFile(meta, fileName, WhenceOldest, true)
+	assert.NoError(t, err)
+	n, err := sf.Read(make([]byte, 10))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, n)
+	assert.NoError(t, sf.Close())
+}
+
+//测试 ReadLine 后返回数据在文件中的位置
+func Test_singleFileSourceMeta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Test_singleFileSourceMeta")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+	metaDir := filepath.Join(dir, "meta")
+	CreateFile(fileName, "aa\nbbbb\ncc\n")
+	inode, err := utilsos.GetIdentifyIDByPath(fileName)
+	assert.NoError(t, err)
+
+	meta, err := NewMeta(metaDir, metaDir, fileName, ModeFile, "", DefautFileRetention)
+	assert.NoError(t, err)
+	sf, err := NewSingleFile(meta, fileName, WhenceOldest, true)
+	assert.NoError(t, err)
+	br, err := NewReaderSize(sf, meta, 16)
+	assert.NoError(t, err)
+	defer br.Close()
+	for _, exp := range []SourceMeta{
+		{Path: fileName, Inode: inode, Offset: 0},
+		{Path: fileName, Inode: inode, Offset: 3},
+		{Path: fileName, Inode: inode, Offset: 8},
+	} {
+		_, err = br.ReadLine()
+		assert.NoError(t, err)
+		sm, ok := br.SourceMeta()
+		assert.True(t, ok)
+		assert.Equal(t, exp, sm)
+	}
+
+	// 多行模式下为第一行的位置
+	appendTestFile(fileName, "1a\n b\n2c\n")
+	assert.NoError(t, br.SetMode(ReadModeHeadPatternString, "^[0-9]"))
+	for _, exp := range []struct {
+		line   string
+		offset int64
+	}{{"1a\n b\n", 11}, {"2c\n", 17}} {
+		line, _ := br.ReadLine()
+		assert.Equal(t, exp.line, line)
+		sm, ok := br.SourceMeta()
+		assert.True(t, ok)
+		assert.Equal(t, exp.offset, sm.Offset)
+	}
+}
+
 func appendTestFile(fileName, content string) {
 	f, _ := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, DefaultFilePerm)
 	f.WriteString(content)
@@ -0,0 +1,396 @@
+package snmp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/qiniu/log"
+)
+
+// mibNode 是 MIB 中定义的一个对象，enums 是 INTEGER 类型的可选值
+type mibNode struct {
+	name   string
+	module string
+	enums  map[int64]string
+}
+
+// mibTree 保存数字形式的 OID（不带开头的点）与 MIB 对象的对应关系
+type mibTree struct {
+	nodes map[string]*mibNode
+}
+
+// baseOIDs 是 SNMPv2-SMI 等基础 MIB 中的节点，没有加载这些 MIB 文件时也可以解析其他 MIB
+var baseOIDs = map[string]string{
+	"ccitt":           "0",
+	"iso":             "1",
+	"joint-iso-ccitt": "2",
+	"org":             "1.3",
+	"dod":             "1.3.6",
+	"internet":        "1.3.6.1",
+	"directory":       "1.3.6.1.1",
+	"mgmt":            "1.3.6.1.2",
+	"mib-2":           "1.3.6.1.2.1",
+	"system":          "1.3.6.1.2.1.1",
+	"transmission":    "1.3.6.1.2.1.10",
+	"experimental":    "1.3.6.1.3",
+	"private":         "1.3.6.1.4",
+	"enterprises":     "1.3.6.1.4.1",
+	"security":        "1.3.6.1.5",
+	"snmpV2":          "1.3.6.1.6",
+	"snmpDomains":     "1.3.6.1.6.1",
+	"snmpProxys":      "1.3.6.1.6.2",
+	"snmpModules":     "1.3.6.1.6.3",
+	"zeroDotZero":     "0.0",
+}
+
+// builtinNodes 是 trap 中最常用的对象，不需要加载 MIB 文件也可以转换为名称
+var builtinNodes = map[string]mibNode{
+	"1.3.6.1.2.1.1.3":     {name: "sysUpTime", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.1.1.4.1": {name: "snmpTrapOID", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.1.1.4.3": {name: "snmpTrapEnterprise", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.1.1.5.1": {name: "coldStart", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.1.1.5.2": {name: "warmStart", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.1.1.5.3": {name: "linkDown", module: "IF-MIB"},
+	"1.3.6.1.6.3.1.1.5.4": {name: "linkUp", module: "IF-MIB"},
+	"1.3.6.1.6.3.1.1.5.5": {name: "authenticationFailure", module: "SNMPv2-MIB"},
+	"1.3.6.1.6.3.18.1.3":  {name: "snmpTrapAddress", module: "SNMP-COMMUNITY-MIB"},
+	"1.3.6.1.6.3.18.1.4":  {name: "snmpTrapCommunity", module: "SNMP-COMMUNITY-MIB"},
+}
+
+// 定义对象的宏，名称后面跟着这些关键字的语句最后都以 ::= { parent n } 给出 OID
+var objectMacros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"NOTIFICATION-TYPE":  true,
+	"MODULE-IDENTITY":    true,
+	"OBJECT-IDENTITY":    true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+	"TRAP-TYPE":          true,
+}
+
+// mibDef 是一个尚未转换为数字 OID 的定义，parent 为空时 subIDs 就是完整的 OID
+type mibDef struct {
+	name   string
+	module string
+	parent string
+	subIDs []string
+	syntax string
+	enums  map[int64]string
+}
+
+type mibParser struct {
+	defs []*mibDef
+	// tcs 是 TEXTUAL-CONVENTION 中定义的可选值，OBJECT-TYPE 的 SYNTAX 可以引用
+	tcs map[string]map[int64]string
+}
+
+// loadMIBs 加载文件或者目录中的所有 MIB 文件，无法解析的定义会被忽略
+func loadMIBs(paths []string) (*mibTree, error) {
+	p := &mibParser{tcs: make(map[string]map[int64]string)}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			infos, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, fi := range infos {
+				if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+					continue
+				}
+				files = append(files, filepath.Join(path, fi.Name()))
+			}
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			p.parse(tokenizeMIB(string(data)))
+		}
+	}
+	return p.build(), nil
+}
+
+// tokenizeMIB 把 MIB 文件拆分为标识符、数字和符号，去掉注释，引号中的字符串替换为一个空字符串
+func tokenizeMIB(data string) []string {
+	var tokens []string
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(data[i:], "--"):
+			// 注释到行尾或者下一个 -- 结束
+			end := i + 2
+			for end < len(data) && data[end] != '\n' && !strings.HasPrefix(data[end:], "--") {
+				end++
+			}
+			if strings.HasPrefix(data[end:], "--") {
+				end += 2
+			}
+			i = end
+		case c == '"':
+			end := strings.IndexByte(data[i+1:], '"')
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, `""`)
+			i += end + 2
+		case strings.HasPrefix(data[i:], "::="):
+			tokens = append(tokens, "::=")
+			i += 3
+		case strings.HasPrefix(data[i:], ".."):
+			tokens = append(tokens, "..")
+			i += 2
+		case isMIBIdentChar(c):
+			end := i
+			for end < len(data) && isMIBIdentChar(data[end]) && !strings.HasPrefix(data[end:], "--") {
+				end++
+			}
+			tokens = append(tokens, data[i:end])
+			i = end
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+func isMIBIdentChar(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isLowerIdent(s string) bool {
+	return len(s) > 0 && unicode.IsLower(rune(s[0]))
+}
+
+func isUpperIdent(s string) bool {
+	return len(s) > 0 && unicode.IsUpper(rune(s[0]))
+}
+
+func (p *mibParser) parse(tokens []string) {
+	var module string
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok == "DEFINITIONS" && i > 0:
+			module = tokens[i-1]
+		case tok == "IMPORTS":
+			// 引用的名称与定义的格式相同，需要跳过
+			for i < len(tokens) && tokens[i] != ";" {
+				i++
+			}
+		case tok == "MACRO":
+			for i < len(tokens) && tokens[i] != "END" {
+				i++
+			}
+		case tok == "OBJECT" && i > 0 && i+3 < len(tokens) && tokens[i+1] == "IDENTIFIER" && tokens[i+2] == "::=" && isLowerIdent(tokens[i-1]):
+			def := &mibDef{name: tokens[i-1], module: module}
+			i = parseOIDValue(tokens, i+3, def)
+			p.add(def)
+		case objectMacros[tok] && i > 0 && isLowerIdent(tokens[i-1]):
+			def := &mibDef{name: tokens[i-1], module: module}
+			i = p.parseMacro(tokens, i+1, tok, def)
+			p.add(def)
+		case tok == "::=" && i > 0 && i+1 < len(tokens) && tokens[i+1] == "TEXTUAL-CONVENTION" && isUpperIdent(tokens[i-1]):
+			name := tokens[i-1]
+			for j := i + 2; j < len(tokens) && tokens[j] != "::="; j++ {
+				if tokens[j] == "SYNTAX" {
+					if enums, _ := parseEnums(tokens, j+1); enums != nil {
+						p.tcs[name] = enums
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+func (p *mibParser) add(def *mibDef) {
+	if def.parent != "" || len(def.subIDs) > 0 {
+		p.defs = append(p.defs, def)
+	}
+}
+
+// parseMacro 解析宏中的 SYNTAX 以及最后的 OID，返回语句结束的位置
+func (p *mibParser) parseMacro(tokens []string, i int, macro string, def *mibDef) int {
+	var enterprise string
+	for ; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "SYNTAX":
+			if i+1 >= len(tokens) {
+				return i
+			}
+			def.syntax = tokens[i+1]
+			if enums, end := parseEnums(tokens, i+1); enums != nil {
+				def.enums = enums
+				i = end
+			}
+		case "ENTERPRISE":
+			if i+1 < len(tokens) {
+				enterprise = tokens[i+1]
+			}
+		case "::=":
+			if macro == "TRAP-TYPE" {
+				// SMIv1 的 trap 转换为 SMIv2 的 enterprise.0.specific-trap
+				if i+1 < len(tokens) && enterprise != "" {
+					def.parent = enterprise
+					def.subIDs = []string{"0", tokens[i+1]}
+				}
+				return i + 1
+			}
+			return parseOIDValue(tokens, i+1, def)
+		}
+	}
+	return i
+}
+
+// parseEnums 解析 INTEGER { up(1), down(2) } 中的可选值，返回值以及结束的位置
+func parseEnums(tokens []string, i int) (map[int64]string, int) {
+	if i < len(tokens) && (tokens[i] == "INTEGER" || tokens[i] == "Integer32") {
+		i++
+	}
+	if i >= len(tokens) || tokens[i] != "{" {
+		return nil, i
+	}
+	enums := make(map[int64]string)
+	for i++; i < len(tokens) && tokens[i] != "}"; i++ {
+		if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" {
+			if v, err := strconv.ParseInt(tokens[i+2], 10, 64); err == nil {
+				enums[v] = tokens[i]
+			}
+			i += 3
+		}
+	}
+	return enums, i
+}
+
+// parseOIDValue 解析 { parent 1 2 } 或者 { iso(1) org(3) } 格式的 OID
+func parseOIDValue(tokens []string, i int, def *mibDef) int {
+	if i >= len(tokens) || tokens[i] != "{" {
+		return i
+	}
+	first := true
+	for i++; i < len(tokens) && tokens[i] != "}"; i++ {
+		tok := tokens[i]
+		if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" {
+			def.subIDs = append(def.subIDs, tokens[i+2])
+			i += 3
+		} else if _, err := strconv.ParseUint(tok, 10, 32); err == nil {
+			def.subIDs = append(def.subIDs, tok)
+		} else if first {
+			def.parent = tok
+		} else {
+			// 无法识别的 OID 格式
+			def.parent, def.subIDs = "", nil
+		}
+		first = false
+	}
+	return i
+}
+
+// build 把所有的定义转换为数字 OID，父节点没有定义的对象会被忽略
+func (p *mibParser) build() *mibTree {
+	byName := make(map[string]*mibDef, len(p.defs))
+	for _, def := range p.defs {
+		byName[def.name] = def
+	}
+	resolved := make(map[string]string, len(p.defs))
+	var resolve func(name string, depth int) (string, bool)
+	resolve = func(name string, depth int) (string, bool) {
+		if oid, ok := resolved[name]; ok {
+			return oid, true
+		}
+		if oid, ok := baseOIDs[name]; ok {
+			return oid, true
+		}
+		def, ok := byName[name]
+		if !ok || depth > 64 {
+			return "", false
+		}
+		var parts []string
+		if def.parent != "" {
+			parent, ok := resolve(def.parent, depth+1)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, parent)
+		}
+		parts = append(parts, def.subIDs...)
+		oid := strings.Join(parts, ".")
+		resolved[name] = oid
+		return oid, true
+	}
+
+	tree := newMIBTree()
+	var unresolved []string
+	for _, def := range p.defs {
+		oid, ok := resolve(def.name, 0)
+		if !ok {
+			unresolved = append(unresolved, def.name)
+			continue
+		}
+		node := &mibNode{name: def.name, module: def.module, enums: def.enums}
+		if node.enums == nil {
+			node.enums = p.tcs[def.syntax]
+		}
+		tree.nodes[oid] = node
+	}
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		log.Warnf("snmp trap: parent of %v not found in mib files, ignored", strings.Join(unresolved, ","))
+	}
+	return tree
+}
+
+func newMIBTree() *mibTree {
+	tree := &mibTree{nodes: make(map[string]*mibNode)}
+	for oid, node := range builtinNodes {
+		node := node
+		tree.nodes[oid] = &node
+	}
+	return tree
+}
+
+// lookup 找到 OID 最长的已知前缀，返回对应的对象以及剩余的部分（通常是表的索引）
+func (t *mibTree) lookup(oid string) (*mibNode, string) {
+	oid = strings.TrimPrefix(oid, ".")
+	for prefix := oid; prefix != ""; {
+		if node, ok := t.nodes[prefix]; ok {
+			return node, strings.TrimPrefix(oid[len(prefix):], ".")
+		}
+		idx := strings.LastIndexByte(prefix, '.')
+		if idx < 0 {
+			break
+		}
+		prefix = prefix[:idx]
+	}
+	return nil, oid
+}
+
+// translate 把数字 OID 转换为 ifIndex.3 格式的名称，返回名称和所在的 MIB 模块，未知的 OID 原样返回
+func (t *mibTree) translate(oid string) (string, string, *mibNode) {
+	node, index := t.lookup(oid)
+	if node == nil {
+		return strings.TrimPrefix(oid, "."), "", nil
+	}
+	if index == "" {
+		return node.name, node.module, node
+	}
+	return fmt.Sprintf("%v.%v", node.name, index), node.module, node
+}
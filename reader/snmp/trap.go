@@ -0,0 +1,463 @@
+package snmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/soniah/gosnmp"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// maxTrapSize 是 UDP 数据包的最大长度
+	maxTrapSize = 64 * 1024
+
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeSnmpTrap, NewTrapReader)
+}
+
+// usmUser 是接收 v3 trap 的用户，level 是要求的最低安全等级
+type usmUser struct {
+	name     string
+	level    gosnmp.SnmpV3MsgFlags
+	authHash func() hash.Hash
+	authPass string
+	// keys 缓存每个 engine id 对应的认证密钥，只在接收数据的 goroutine 中使用
+	keys map[string][]byte
+}
+
+// TrapReader 监听 UDP 端口接收 SNMP v2c 和 v3 的 trap，根据 MIB 把 OID 转换为名称
+type TrapReader struct {
+	meta      *reader.Meta
+	address   string
+	community string
+	user      *usmUser
+	mibs      *mibTree
+	parser    *gosnmp.GoSNMP
+
+	status   int32
+	conn     *net.UDPConn
+	readChan chan string
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewTrapReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	address, _ := c.GetStringOr(reader.KeySnmpTrapAddress, reader.DefaultSnmpTrapAddress)
+	community, _ := c.GetStringOr(reader.KeySnmpReaderCommunity, "")
+	mibPaths, _ := c.GetStringListOr(reader.KeySnmpTrapMibPaths, nil)
+	mibs := newMIBTree()
+	if len(mibPaths) > 0 {
+		var err error
+		if mibs, err = loadMIBs(mibPaths); err != nil {
+			return nil, fmt.Errorf("load mib files error: %v", err)
+		}
+	}
+
+	// 日志关闭时 gosnmp 仍然会调用 UsmSecurityParameters 中的 Logger
+	discard := stdlog.New(ioutil.Discard, "", 0)
+	parser := &gosnmp.GoSNMP{
+		Version:       gosnmp.Version3,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.NoAuthNoPriv,
+		Logger:        discard,
+	}
+	var user *usmUser
+	if secName, _ := c.GetStringOr(reader.KeySnmpReaderSecName, ""); secName != "" {
+		var err error
+		if user, err = newUSMUser(c, secName, parser, discard); err != nil {
+			return nil, err
+		}
+	}
+	return &TrapReader{
+		meta:      meta,
+		address:   address,
+		community: community,
+		user:      user,
+		mibs:      mibs,
+		parser:    parser,
+		status:    reader.StatusInit,
+		readChan:  make(chan string, 100),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// newUSMUser 根据配置生成 v3 用户，并设置 gosnmp 解密需要的参数。
+// gosnmp 校验 trap 的认证信息时使用的不是发送方 engine id 生成的密钥，因此认证由 authentic 完成
+func newUSMUser(c conf.MapConf, name string, parser *gosnmp.GoSNMP, logger gosnmp.Logger) (*usmUser, error) {
+	secLevel, _ := c.GetStringOr(reader.KeySnmpReaderSecLevel, "authPriv")
+	authProtocol, _ := c.GetStringOr(reader.KeySnmpReaderAuthProtocol, "")
+	authPassword, _ := c.GetStringOr(reader.KeySnmpReaderAuthPassword, "")
+	privProtocol, _ := c.GetStringOr(reader.KeySnmpReaderPrivProtocol, "")
+	privPassword, _ := c.GetStringOr(reader.KeySnmpReaderPrivPassword, "")
+
+	user := &usmUser{name: name, authPass: authPassword, keys: make(map[string][]byte)}
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:                 name,
+		AuthenticationPassphrase: authPassword,
+		PrivacyPassphrase:        privPassword,
+		Logger:                   logger,
+	}
+	switch strings.ToLower(secLevel) {
+	case "noauthnopriv":
+		user.level = gosnmp.NoAuthNoPriv
+	case "authnopriv":
+		user.level = gosnmp.AuthNoPriv
+	case "authpriv":
+		user.level = gosnmp.AuthPriv
+	default:
+		return nil, fmt.Errorf("invalid %v %q, should be noAuthNoPriv, authNoPriv or authPriv", reader.KeySnmpReaderSecLevel, secLevel)
+	}
+	switch strings.ToLower(authProtocol) {
+	case "md5":
+		sp.AuthenticationProtocol, user.authHash = gosnmp.MD5, md5.New
+	case "sha":
+		sp.AuthenticationProtocol, user.authHash = gosnmp.SHA, sha1.New
+	case "":
+		sp.AuthenticationProtocol = gosnmp.NoAuth
+	default:
+		return nil, fmt.Errorf("invalid %v %q, should be md5 or sha", reader.KeySnmpReaderAuthProtocol, authProtocol)
+	}
+	switch strings.ToLower(privProtocol) {
+	case "des":
+		sp.PrivacyProtocol = gosnmp.DES
+	case "aes":
+		sp.PrivacyProtocol = gosnmp.AES
+	case "":
+		sp.PrivacyProtocol = gosnmp.NoPriv
+	default:
+		return nil, fmt.Errorf("invalid %v %q, should be des or aes", reader.KeySnmpReaderPrivProtocol, privProtocol)
+	}
+	if user.level&gosnmp.AuthNoPriv != 0 && (user.authHash == nil || authPassword == "") {
+		return nil, fmt.Errorf("%v and %v are required when %v is %v", reader.KeySnmpReaderAuthProtocol,
+			reader.KeySnmpReaderAuthPassword, reader.KeySnmpReaderSecLevel, secLevel)
+	}
+	if user.level == gosnmp.AuthPriv && (sp.PrivacyProtocol == gosnmp.NoPriv || privPassword == "") {
+		return nil, fmt.Errorf("%v and %v are required when %v is %v", reader.KeySnmpReaderPrivProtocol,
+			reader.KeySnmpReaderPrivPassword, reader.KeySnmpReaderSecLevel, secLevel)
+	}
+	parser.SecurityParameters = sp
+	return user, nil
+}
+
+// localizedKey 按照 RFC3414 A.2 由密码和 engine id 生成认证密钥
+func (u *usmUser) localizedKey(engineID string) []byte {
+	if key, ok := u.keys[engineID]; ok {
+		return key
+	}
+	h := u.authHash()
+	password := []byte(u.authPass)
+	buf := make([]byte, 64)
+	for i, count := 0, 0; count < 1048576; count += 64 {
+		for j := range buf {
+			buf[j] = password[i%len(password)]
+			i++
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+	h.Reset()
+	h.Write(ku)
+	h.Write([]byte(engineID))
+	h.Write(ku)
+	key := h.Sum(nil)
+	u.keys[engineID] = key
+	return key
+}
+
+// authentic 校验 v3 trap 中的 HMAC-96 认证码
+func (u *usmUser) authentic(msg []byte, sp *gosnmp.UsmSecurityParameters) bool {
+	authParams := []byte(sp.AuthenticationParameters)
+	if len(authParams) != 12 {
+		return false
+	}
+	idx := bytes.Index(msg, authParams)
+	if idx < 0 {
+		return false
+	}
+	buf := append([]byte{}, msg...)
+	for i := idx; i < idx+len(authParams); i++ {
+		buf[i] = 0
+	}
+	mac := hmac.New(u.authHash, u.localizedKey(sp.AuthoritativeEngineID))
+	mac.Write(buf)
+	return hmac.Equal(mac.Sum(nil)[:12], authParams)
+}
+
+func (r *TrapReader) Name() string {
+	return "SnmpTrapReader<" + r.address + ">"
+}
+
+func (r *TrapReader) Source() string {
+	return r.address
+}
+
+func (r *TrapReader) SetMode(mode string, v interface{}) error {
+	return errors.New("SnmpTrapReader not support read mode")
+}
+
+func (r *TrapReader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", r.address)
+	if err == nil {
+		r.conn, err = net.ListenUDP("udp", addr)
+	}
+	if err != nil {
+		atomic.StoreInt32(&r.status, reader.StatusInit)
+		return fmt.Errorf("listen on %v error: %v", r.address, err)
+	}
+	r.wg.Add(1)
+	go r.serve()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *TrapReader) serve() {
+	defer r.wg.Done()
+	buf := make([]byte, maxTrapSize)
+	for {
+		n, addr, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if atomic.LoadInt32(&r.status) == reader.StatusRunning {
+				log.Errorf("Runner[%v] %v read error: %v", r.meta.RunnerName, r.Name(), err)
+				r.setStatsError(err.Error())
+			}
+			return
+		}
+		data, err := r.decode(buf[:n], addr)
+		if err != nil {
+			log.Warnf("Runner[%v] %v drop trap from %v: %v", r.meta.RunnerName, r.Name(), addr, err)
+			r.setStatsError(err.Error())
+			continue
+		}
+		line, err := json.Marshal(data)
+		if err != nil {
+			log.Errorf("Runner[%v] %v json marshal inner error %v", r.meta.RunnerName, data, err)
+			continue
+		}
+		select {
+		case r.readChan <- string(line):
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// decode 解析一个 trap，校验 community 或者 v3 用户后转换为一条数据
+func (r *TrapReader) decode(msg []byte, addr *net.UDPAddr) (Data, error) {
+	// gosnmp 解密时可能修改数据，认证需要使用原始的数据
+	pkt := r.parser.UnmarshalTrap(append([]byte{}, msg...))
+	if pkt == nil {
+		return nil, errors.New("invalid snmp trap packet")
+	}
+	data := Data{
+		reader.KeyTimestamp: time.Now().Format(time.RFC3339Nano),
+		"trap_version":      pkt.Version.String(),
+		"trap_source":       addr.IP.String(),
+	}
+	switch pkt.Version {
+	case gosnmp.Version2c:
+		if r.community != "" && pkt.Community != r.community {
+			return nil, fmt.Errorf("community %q mismatch", pkt.Community)
+		}
+		data["trap_community"] = pkt.Community
+	case gosnmp.Version3:
+		sp, ok := pkt.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok || r.user == nil || sp.UserName != r.user.name {
+			return nil, errors.New("unknown snmp v3 user")
+		}
+		flags := pkt.MsgFlags & gosnmp.AuthPriv
+		if flags&r.user.level != r.user.level {
+			return nil, errors.New("snmp v3 security level is lower than required")
+		}
+		if flags&gosnmp.AuthNoPriv != 0 && (r.user.authHash == nil || !r.user.authentic(msg, sp)) {
+			return nil, errors.New("snmp v3 authentication failed")
+		}
+		data["trap_user"] = sp.UserName
+		data["trap_engine_id"] = hex.EncodeToString([]byte(sp.AuthoritativeEngineID))
+	default:
+		return nil, fmt.Errorf("snmp version %v not supported", pkt.Version)
+	}
+	if pkt.PDUType != gosnmp.SNMPv2Trap {
+		return nil, fmt.Errorf("pdu type %#x is not a trap", pkt.PDUType)
+	}
+
+	varbinds := make([]map[string]interface{}, 0, len(pkt.Variables))
+	for _, v := range pkt.Variables {
+		oid := strings.TrimPrefix(v.Name, ".")
+		switch oid {
+		case oidSysUpTime:
+			data["trap_uptime"] = v.Value
+			continue
+		case oidSnmpTrapOID:
+			if trapOID, ok := v.Value.(string); ok {
+				trapOID = strings.TrimPrefix(trapOID, ".")
+				name, module, _ := r.mibs.translate(trapOID)
+				data["trap_oid"] = trapOID
+				data["trap_name"] = name
+				if module != "" {
+					data["trap_mib"] = module
+				}
+			}
+			continue
+		}
+		varbinds = append(varbinds, r.varbind(oid, v))
+	}
+	data["varbinds"] = varbinds
+	return data, nil
+}
+
+// varbind 把一个变量转换为包含 OID、名称、类型和值的对象，INTEGER 的可选值放在 value_name 中
+func (r *TrapReader) varbind(oid string, v gosnmp.SnmpPDU) map[string]interface{} {
+	name, module, node := r.mibs.translate(oid)
+	vb := map[string]interface{}{
+		"oid":   oid,
+		"name":  name,
+		"type":  asn1TypeName(v.Type),
+		"value": v.Value,
+	}
+	if module != "" {
+		vb["mib"] = module
+	}
+	switch value := v.Value.(type) {
+	case []byte:
+		vb["value"] = octetString(value)
+	case string:
+		if v.Type == gosnmp.ObjectIdentifier {
+			vb["value"] = strings.TrimPrefix(value, ".")
+		}
+	case int:
+		if node != nil {
+			if label, ok := node.enums[int64(value)]; ok {
+				vb["value_name"] = label
+			}
+		}
+	}
+	return vb
+}
+
+// octetString 可以打印的字符串原样输出，其他的（如 MAC 地址）输出为 00:1a:2b 格式的十六进制
+func octetString(b []byte) string {
+	if utf8.Valid(b) {
+		printable := true
+		for _, r := range string(b) {
+			if r < ' ' && r != '\t' && r != '\r' && r != '\n' || r == 0x7f {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(b)
+		}
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+func asn1TypeName(t gosnmp.Asn1BER) string {
+	switch t {
+	case gosnmp.Integer:
+		return "Integer"
+	case gosnmp.OctetString:
+		return "OctetString"
+	case gosnmp.Null:
+		return "Null"
+	case gosnmp.ObjectIdentifier:
+		return "ObjectIdentifier"
+	case gosnmp.IPAddress:
+		return "IpAddress"
+	case gosnmp.Counter32:
+		return "Counter32"
+	case gosnmp.Gauge32:
+		return "Gauge32"
+	case gosnmp.TimeTicks:
+		return "TimeTicks"
+	case gosnmp.Opaque:
+		return "Opaque"
+	case gosnmp.Counter64:
+		return "Counter64"
+	case gosnmp.Uinteger32:
+		return "Unsigned32"
+	case gosnmp.NoSuchObject:
+		return "NoSuchObject"
+	case gosnmp.NoSuchInstance:
+		return "NoSuchInstance"
+	case gosnmp.EndOfMibView:
+		return "EndOfMibView"
+	}
+	return fmt.Sprintf("0x%02x", byte(t))
+}
+
+func (r *TrapReader) ReadLine() (string, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		if err := r.Start(); err != nil {
+			log.Error(err)
+			return "", err
+		}
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case line := <-r.readChan:
+		return line, nil
+	case <-timer.C:
+		return "", nil
+	}
+}
+
+func (r *TrapReader) SyncMeta() {}
+
+func (r *TrapReader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *TrapReader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *TrapReader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) != reader.StatusRunning {
+		return nil
+	}
+	close(r.done)
+	r.conn.Close()
+	r.wg.Wait()
+	log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	return nil
+}
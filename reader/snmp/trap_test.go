@@ -0,0 +1,301 @@
+package snmp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+)
+
+const testMIB = `
+TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, NOTIFICATION-TYPE, Integer32, enterprises
+        FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION FROM SNMPv2-TC;
+
+testMIB MODULE-IDENTITY
+    LAST-UPDATED "201807010000Z"
+    ORGANIZATION "logkit"
+    CONTACT-INFO "::= { bad 1 }"
+    DESCRIPTION  "test mib"
+    ::= { enterprises 99999 }
+
+Status ::= TEXTUAL-CONVENTION
+    STATUS current
+    DESCRIPTION "status"
+    SYNTAX INTEGER { ok(1), failed(2) } -- comment ::= { x 1 }
+
+testObjects OBJECT IDENTIFIER ::= { testMIB 1 }
+testTraps   OBJECT IDENTIFIER ::= { testMIB 0 }
+
+testTable OBJECT-TYPE
+    SYNTAX SEQUENCE OF TestEntry
+    MAX-ACCESS not-accessible
+    STATUS current
+    DESCRIPTION ""
+    ::= { testObjects 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX TestEntry
+    MAX-ACCESS not-accessible
+    STATUS current
+    DESCRIPTION ""
+    INDEX { testIndex }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE { testIndex Integer32, testStatus Status, testLevel INTEGER }
+
+testIndex OBJECT-TYPE
+    SYNTAX Integer32 (1..100)
+    MAX-ACCESS read-only
+    STATUS current
+    DESCRIPTION ""
+    ::= { testEntry 1 }
+
+testStatus OBJECT-TYPE
+    SYNTAX Status
+    MAX-ACCESS read-only
+    STATUS current
+    DESCRIPTION ""
+    ::= { testEntry 2 }
+
+testLevel OBJECT-TYPE
+    SYNTAX INTEGER { low(1), high(2), other(-1) }
+    MAX-ACCESS read-only
+    STATUS current
+    DESCRIPTION ""
+    ::= { testEntry 3 }
+
+testAlarm NOTIFICATION-TYPE
+    OBJECTS { testStatus, testLevel }
+    STATUS current
+    DESCRIPTION ""
+    ::= { testTraps 1 }
+
+testV1Trap TRAP-TYPE
+    ENTERPRISE testMIB
+    VARIABLES { testStatus }
+    DESCRIPTION ""
+    ::= 7
+
+unknownParent OBJECT IDENTIFIER ::= { notDefined 1 }
+
+END
+`
+
+func TestLoadMIBs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mibs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "TEST-MIB.txt"), []byte(testMIB), 0644))
+
+	tree, err := loadMIBs([]string{dir})
+	assert.NoError(t, err)
+	tests := []struct {
+		oid, name, module string
+	}{
+		{"1.3.6.1.4.1.99999", "testMIB", "TEST-MIB"},
+		{".1.3.6.1.4.1.99999.1.1.1.2.5", "testStatus.5", "TEST-MIB"},
+		{"1.3.6.1.4.1.99999.0.1", "testAlarm", "TEST-MIB"},
+		{"1.3.6.1.4.1.99999.0.7", "testV1Trap", "TEST-MIB"},
+		{"1.3.6.1.6.3.1.1.5.3", "linkDown", "IF-MIB"},
+		{"1.3.6.1.2.1.1.3.0", "sysUpTime.0", "SNMPv2-MIB"},
+		{"1.2.3", "1.2.3", ""},
+	}
+	for _, test := range tests {
+		name, module, _ := tree.translate(test.oid)
+		assert.Equal(t, test.name, name, test.oid)
+		assert.Equal(t, test.module, module, test.oid)
+	}
+	_, _, node := tree.translate("1.3.6.1.4.1.99999.1.1.1.2.5")
+	assert.Equal(t, map[int64]string{1: "ok", 2: "failed"}, node.enums)
+	_, _, node = tree.translate("1.3.6.1.4.1.99999.1.1.1.3.5")
+	assert.Equal(t, map[int64]string{1: "low", 2: "high", -1: "other"}, node.enums)
+
+	_, err = loadMIBs([]string{filepath.Join(dir, "not-exist")})
+	assert.Error(t, err)
+}
+
+func newTestTrapReader(t *testing.T, c conf.MapConf) *TrapReader {
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: MetaDir,
+		reader.KeyFileDone: MetaDir,
+		reader.KeyMode:     reader.ModeSnmpTrap,
+	})
+	assert.NoError(t, err)
+	c[reader.KeySnmpTrapAddress] = "127.0.0.1:0"
+	r, err := NewTrapReader(meta, c)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tr := r.(*TrapReader)
+	assert.NoError(t, tr.Start())
+	return tr
+}
+
+func sendTrap(t *testing.T, r *TrapReader, g *gosnmp.GoSNMP) {
+	g.Target = "127.0.0.1"
+	g.Port = uint16(r.conn.LocalAddr().(*net.UDPAddr).Port)
+	g.Timeout = time.Second
+	assert.NoError(t, g.Connect())
+	defer g.Conn.Close()
+	_, err := g.SendTrap(gosnmp.SnmpTrap{Variables: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(12345)},
+		{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.99999.0.1"},
+		{Name: ".1.3.6.1.4.1.99999.1.1.1.2.5", Type: gosnmp.Integer, Value: 2},
+		{Name: ".1.3.6.1.4.1.99999.1.1.1.1.5", Type: gosnmp.OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.4.1.99999.2", Type: gosnmp.OctetString, Value: string([]byte{0x00, 0x1a, 0x2b})},
+	}})
+	assert.NoError(t, err)
+}
+
+// v3SecurityParameters 生成发送 v3 trap 需要的安全参数。
+// gosnmp 只在发现 engine id 时生成密钥，这里先解析一个带 engine id 的 trap 得到包含密钥的参数
+func v3SecurityParameters(t *testing.T, authPassword string) *gosnmp.UsmSecurityParameters {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer conn.Close()
+	g := &gosnmp.GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		Timeout:       time.Second,
+		Version:       gosnmp.Version3,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.NoAuthNoPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "logkit",
+			AuthoritativeEngineID:    "\x80\x00\x1f\x88\x04logkit",
+			AuthoritativeEngineBoots: 1,
+			AuthoritativeEngineTime:  100,
+		},
+	}
+	assert.NoError(t, g.Connect())
+	defer g.Conn.Close()
+	_, err = g.SendTrap(gosnmp.SnmpTrap{Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(0)}}})
+	assert.NoError(t, err)
+	buf := make([]byte, maxTrapSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+
+	parser := &gosnmp.GoSNMP{
+		Version:       gosnmp.Version3,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.NoAuthNoPriv,
+		Logger:        g.Logger,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "logkit",
+			AuthenticationProtocol:   gosnmp.SHA,
+			AuthenticationPassphrase: authPassword,
+			PrivacyProtocol:          gosnmp.AES,
+			PrivacyPassphrase:        "privpassword",
+			Logger:                   g.Logger,
+		},
+	}
+	pkt := parser.UnmarshalTrap(buf[:n])
+	if !assert.NotNil(t, pkt) {
+		t.FailNow()
+	}
+	return pkt.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+}
+
+func readTrap(t *testing.T, r *TrapReader) map[string]interface{} {
+	line, err := r.ReadLine()
+	assert.NoError(t, err)
+	if line == "" {
+		return nil
+	}
+	var data map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(line), &data))
+	return data
+}
+
+func TestTrapReaderV2c(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	mibFile := filepath.Join(os.TempDir(), "TEST-MIB-"+strconv.Itoa(os.Getpid()))
+	assert.NoError(t, ioutil.WriteFile(mibFile, []byte(testMIB), 0644))
+	defer os.Remove(mibFile)
+
+	r := newTestTrapReader(t, conf.MapConf{
+		reader.KeySnmpTrapMibPaths:    mibFile,
+		reader.KeySnmpReaderCommunity: "public",
+	})
+	defer r.Close()
+
+	sendTrap(t, r, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "private"})
+	sendTrap(t, r, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"})
+	data := readTrap(t, r)
+	if !assert.NotNil(t, data) {
+		return
+	}
+	assert.Equal(t, "2c", data["trap_version"])
+	assert.Equal(t, "127.0.0.1", data["trap_source"])
+	assert.Equal(t, "public", data["trap_community"])
+	assert.Equal(t, "1.3.6.1.4.1.99999.0.1", data["trap_oid"])
+	assert.Equal(t, "testAlarm", data["trap_name"])
+	assert.Equal(t, "TEST-MIB", data["trap_mib"])
+	assert.EqualValues(t, 12345, data["trap_uptime"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"oid": "1.3.6.1.4.1.99999.1.1.1.2.5", "name": "testStatus.5", "mib": "TEST-MIB", "type": "Integer", "value": float64(2), "value_name": "failed"},
+		map[string]interface{}{"oid": "1.3.6.1.4.1.99999.1.1.1.1.5", "name": "testIndex.5", "mib": "TEST-MIB", "type": "OctetString", "value": "eth0"},
+		map[string]interface{}{"oid": "1.3.6.1.4.1.99999.2", "name": "testMIB.2", "mib": "TEST-MIB", "type": "OctetString", "value": "00:1a:2b"},
+	}, data["varbinds"])
+	// community 不匹配的 trap 被丢弃
+	assert.Nil(t, readTrap(t, r))
+}
+
+func TestTrapReaderV3(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	r := newTestTrapReader(t, conf.MapConf{
+		reader.KeySnmpReaderSecName:      "logkit",
+		reader.KeySnmpReaderSecLevel:     "authPriv",
+		reader.KeySnmpReaderAuthProtocol: "sha",
+		reader.KeySnmpReaderAuthPassword: "authpassword",
+		reader.KeySnmpReaderPrivProtocol: "aes",
+		reader.KeySnmpReaderPrivPassword: "privpassword",
+	})
+	defer r.Close()
+
+	newClient := func(authPassword string, flags gosnmp.SnmpV3MsgFlags) *gosnmp.GoSNMP {
+		return &gosnmp.GoSNMP{
+			Version:            gosnmp.Version3,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			MsgFlags:           flags,
+			SecurityParameters: v3SecurityParameters(t, authPassword),
+		}
+	}
+	sendTrap(t, r, newClient("wrongpassword", gosnmp.AuthPriv))
+	sendTrap(t, r, newClient("authpassword", gosnmp.AuthNoPriv))
+	sendTrap(t, r, newClient("authpassword", gosnmp.AuthPriv))
+	data := readTrap(t, r)
+	if !assert.NotNil(t, data) {
+		return
+	}
+	assert.Equal(t, "3", data["trap_version"])
+	assert.Equal(t, "logkit", data["trap_user"])
+	assert.Equal(t, "80001f88046c6f676b6974", data["trap_engine_id"])
+	assert.Equal(t, "1.3.6.1.4.1.99999.0.1", data["trap_name"])
+	assert.Len(t, data["varbinds"], 3)
+	// 密码错误以及安全等级不够的 trap 被丢弃
+	assert.Nil(t, readTrap(t, r))
+	assert.NotEmpty(t, r.Status().LastError)
+
+	_, err := NewTrapReader(r.meta, conf.MapConf{
+		reader.KeySnmpReaderSecName:  "logkit",
+		reader.KeySnmpReaderSecLevel: "authNoPriv",
+	})
+	assert.Error(t, err)
+}
@@ -2,9 +2,12 @@ package socket
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"strings"
@@ -62,6 +65,10 @@ func (ssr *streamSocketReader) listen() {
 				log.Error(fmt.Errorf("unable to configure keep alive (%s): %s", ssr.ServiceAddress, err))
 			}
 		}
+		// keep alive 需要设置在原始的 TCP 连接上，所以在这之后再包装成 TLS 连接，握手在第一次读取时进行
+		if ssr.TLSConfig != nil {
+			c = tls.Server(c, ssr.TLSConfig)
+		}
 
 		go ssr.read(c)
 	}
@@ -117,7 +124,7 @@ func (ssr *streamSocketReader) read(c net.Conn) {
 	}
 
 	if err := scnr.Err(); err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
 			log.Debugf("streamSocketReader Timeout : %s", err)
 		} else if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
 			ssr.sendError(err)
@@ -172,6 +179,7 @@ type Reader struct {
 	ReadBufferSize  int
 	ReadTimeout     time.Duration
 	KeepAlivePeriod time.Duration
+	TLSConfig       *tls.Config
 	status          int32
 	meta            *reader.Meta // 记录offset的元数据
 
@@ -338,12 +346,32 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	tlsCert, _ := conf.GetStringOr(reader.KeySocketTLSCert, "")
+	tlsKey, _ := conf.GetStringOr(reader.KeySocketTLSKey, "")
+	tlsClientCA, _ := conf.GetStringOr(reader.KeySocketTLSClientCA, "")
+	var tlsConfig *tls.Config
+	if tlsCert != "" || tlsKey != "" || tlsClientCA != "" {
+		if tlsCert == "" || tlsKey == "" {
+			return nil, fmt.Errorf("%v and %v must be set together", reader.KeySocketTLSCert, reader.KeySocketTLSKey)
+		}
+		// TLS 只能用于面向流的协议，基于数据报的 DTLS 不支持
+		switch proto := strings.SplitN(ServiceAddress, "://", 2)[0]; proto {
+		case "tcp", "tcp4", "tcp6", "unix", "unixpacket":
+		default:
+			return nil, fmt.Errorf("tls is not supported on %v socket, use tcp or unix instead", proto)
+		}
+		if tlsConfig, err = newTLSConfig(tlsCert, tlsKey, tlsClientCA); err != nil {
+			return nil, err
+		}
+	}
 	return &Reader{
 		ServiceAddress:  ServiceAddress,
 		MaxConnections:  MaxConnections,
 		ReadBufferSize:  ReadBufferSize,
 		ReadTimeout:     ReadTimeoutdur,
 		KeepAlivePeriod: KeepAlivePeriodDur,
+		TLSConfig:       tlsConfig,
 		ReadChan:        make(chan []byte),
 		errChan:         make(chan error),
 		status:          reader.StatusInit,
@@ -351,6 +379,28 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (reader.Reader, error) {
 	}, nil
 }
 
+// newTLSConfig 加载服务端证书，配置了客户端 CA 证书时要求客户端提供由该 CA 签发的证书
+func newTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate error %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls client ca error %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in %v", caPath)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
 type unixCloser struct {
 	path   string
 	closer io.Closer
@@ -1,9 +1,19 @@
 package socket
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
 	"log"
 	"log/syslog"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -182,3 +192,112 @@ func TestSocketReaderClosePanic(t *testing.T) {
 	assert.Equal(t, "", line)
 	sysLog.Emerg("this is OK")
 }
+
+func TestTLSSocketReader(t *testing.T) {
+	dir := "TestTLSSocketReader"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	cert := writeTestCert(t, certPath, keyPath)
+
+	logkitConf := conf.MapConf{
+		reader.KeyMetaPath:             MetaDir,
+		reader.KeyFileDone:             MetaDir,
+		KeyRunnerName:                  "TestTLSSocketReader",
+		reader.KeyMode:                 reader.ModeSocket,
+		reader.KeySocketServiceAddress: "tcp://127.0.0.1:5142",
+		reader.KeySocketTLSCert:        certPath,
+		reader.KeySocketTLSKey:         keyPath,
+		reader.KeySocketTLSClientCA:    certPath,
+	}
+	meta, err := reader.NewMetaWithConf(logkitConf)
+	assert.NoError(t, err)
+	defer os.RemoveAll(MetaDir)
+
+	ssr, err := NewReader(meta, logkitConf)
+	assert.NoError(t, err)
+	sr := ssr.(*Reader)
+	assert.NoError(t, sr.Start())
+	defer sr.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	conn, err := tls.Dial("tcp", "127.0.0.1:5142", &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}})
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("hello tls\nthis is OK\n"))
+	assert.NoError(t, err)
+	line, err := sr.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello tls", line)
+	line, err = sr.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "this is OK", line)
+	conn.Close()
+
+	// 没有客户端证书时握手失败，数据不会被读取
+	conn, err = tls.Dial("tcp", "127.0.0.1:5142", &tls.Config{RootCAs: pool})
+	if err == nil {
+		conn.Write([]byte("no client cert\n"))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, err)
+	line, err = sr.ReadLine()
+	assert.Error(t, err)
+	assert.Equal(t, "", line)
+}
+
+func TestSocketReaderTLSConfig(t *testing.T) {
+	dir := "TestSocketReaderTLSConfig"
+	assert.NoError(t, os.Mkdir(dir, DefaultDirPerm))
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certPath, keyPath)
+
+	logkitConf := conf.MapConf{
+		reader.KeyMetaPath:             MetaDir,
+		reader.KeyFileDone:             MetaDir,
+		KeyRunnerName:                  "TestSocketReaderTLSConfig",
+		reader.KeyMode:                 reader.ModeSocket,
+		reader.KeySocketServiceAddress: "udp://:5143",
+		reader.KeySocketTLSCert:        certPath,
+		reader.KeySocketTLSKey:         keyPath,
+	}
+	meta, err := reader.NewMetaWithConf(logkitConf)
+	assert.NoError(t, err)
+	defer os.RemoveAll(MetaDir)
+
+	_, err = NewReader(meta, logkitConf)
+	assert.Error(t, err)
+
+	logkitConf[reader.KeySocketServiceAddress] = "tcp://:5143"
+	delete(logkitConf, reader.KeySocketTLSKey)
+	_, err = NewReader(meta, logkitConf)
+	assert.Error(t, err)
+}
+
+func writeTestCert(t *testing.T, certPath, keyPath string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	assert.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
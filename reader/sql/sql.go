@@ -33,12 +33,16 @@ const (
 	DefaultMySQLTable    = "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA='DATABASE_NAME';"
 	DefaultMySQLDatabase = "SHOW DATABASES;"
 	DefaultPGSQLTable    = "SELECT TABLENAME FROM PG_TABLES WHERE SCHEMANAME='public';"
+	DefaultPGSQLDatabase = "SELECT DATNAME FROM PG_DATABASE WHERE DATISTEMPLATE = false;"
 	DefaultMsSQLTable    = "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE='BASE TABLE' AND TABLE_CATALOG='DATABASE_NAME';"
 
 	SupportReminder = "history all magic only support @(YYYY) @(YY) @(MM) @(DD) @(hh) @(mm) @(ss)"
 	Wildcards       = "*"
 
 	DefaultDoneRecordsFile = "sql.records"
+
+	// pgTimestampLayout 是时间游标在 SQL 中的格式，带上时区，timestamp without time zone 的列会忽略时区
+	pgTimestampLayout = "2006-01-02 15:04:05.999999-07:00"
 )
 
 const (
@@ -91,6 +95,7 @@ type Reader struct {
 	Cron         *cron.Cron //定时任务
 	readBatch    int        // 每次读取的数据量
 	offsetKey    string
+	timestampKey string // 作为读取进度的时间列，offsets 中记录的是该列读取到的最大时间（微秒）
 
 	readChan chan readInfo
 	errChan  chan error
@@ -184,7 +189,7 @@ func (tableRecords *TableRecords) Reset() {
 
 func NewReader(meta *reader.Meta, conf conf.MapConf) (ret reader.Reader, err error) {
 	var readBatch int
-	var dbtype, dataSource, rawDatabase, rawSqls, cronSchedule, offsetKey, encoder, table string
+	var dbtype, dataSource, rawDatabase, rawSqls, cronSchedule, offsetKey, timestampKey, encoder, table string
 	var execOnStart, historyAll bool
 	dbtype, _ = conf.GetStringOr(reader.KeyMode, reader.ModeMySQL)
 	logpath, _ := conf.GetStringOr(reader.KeyLogPath, "")
@@ -269,6 +274,13 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (ret reader.Reader, err err
 		rawSqls, _ = conf.GetStringOr(reader.KeyPGsqlSQL, "")
 		cronSchedule, _ = conf.GetStringOr(reader.KeyPGsqlCron, "")
 		execOnStart, _ = conf.GetBoolOr(reader.KeyPGsqlExecOnStart, true)
+		timestampKey, _ = conf.GetStringOr(reader.KeyPGsqlTimestampKey, "")
+		if timestampKey != "" && offsetKey != "" {
+			return nil, fmt.Errorf("%v and %v can not be used together", reader.KeyPGsqlOffsetKey, reader.KeyPGsqlTimestampKey)
+		}
+		if timestampKey != "" && rawSqls == "" {
+			return nil, fmt.Errorf("%v is required when %v is set", reader.KeyPGsqlSQL, reader.KeyPGsqlTimestampKey)
+		}
 	default:
 		err = fmt.Errorf("%v mode not support in sql reader", dbtype)
 		return nil, err
@@ -295,29 +307,30 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (ret reader.Reader, err err
 	}
 
 	mr := &Reader{
-		datasource:  dataSource,
-		database:    rawDatabase,
-		rawDatabase: rawDatabase,
-		rawsqls:     rawSqls,
-		Cron:        cron.New(),
-		readBatch:   readBatch,
-		readChan:    make(chan readInfo),
-		errChan:     make(chan error),
-		meta:        meta,
-		status:      reader.StatusInit,
-		offsetKey:   offsetKey,
-		syncSQLs:    sqls,
-		dbtype:      dbtype,
-		mux:         sync.Mutex{},
-		started:     false,
-		execOnStart: execOnStart,
-		historyAll:  historyAll,
-		rawTable:    table,
-		table:       table,
-		magicLagDur: mgld,
-		schemas:     schemas,
-		statsLock:   sync.RWMutex{},
-		encoder:     encoder,
+		datasource:   dataSource,
+		database:     rawDatabase,
+		rawDatabase:  rawDatabase,
+		rawsqls:      rawSqls,
+		Cron:         cron.New(),
+		readBatch:    readBatch,
+		readChan:     make(chan readInfo),
+		errChan:      make(chan error),
+		meta:         meta,
+		status:       reader.StatusInit,
+		offsetKey:    offsetKey,
+		timestampKey: timestampKey,
+		syncSQLs:     sqls,
+		dbtype:       dbtype,
+		mux:          sync.Mutex{},
+		started:      false,
+		execOnStart:  execOnStart,
+		historyAll:   historyAll,
+		rawTable:     table,
+		table:        table,
+		magicLagDur:  mgld,
+		schemas:      schemas,
+		statsLock:    sync.RWMutex{},
+		encoder:      encoder,
 	}
 
 	if mr.rawDatabase == "" {
@@ -837,25 +850,9 @@ func (r *Reader) run() {
 	r.database = goMagic(r.rawDatabase, now)
 	r.table = goMagic(r.rawTable, now)
 
-	var connectStr string
-	switch r.dbtype {
-	case reader.ModeMySQL:
-		connectStr = getConnectStr(r.datasource, "", r.encoder)
-	case reader.ModeMSSQL:
-		connectStr = r.datasource + ";database=" + r.database
-	case reader.ModePostgreSQL:
-		spls := strings.Split(r.datasource, " ")
-		contains := false
-		for idx, v := range spls {
-			if strings.Contains(v, "dbname") {
-				contains = true
-				spls[idx] = "dbname=" + r.database
-			}
-		}
-		if !contains {
-			spls = append(spls, "dbname="+r.database)
-		}
-		connectStr = strings.Join(spls, " ")
+	connectStr := r.connectStr(r.database)
+	if r.dbtype == reader.ModeMySQL {
+		connectStr = r.connectStr("")
 	}
 	// 开始work逻辑
 	for {
@@ -940,14 +937,17 @@ func (r *Reader) getInitScans(length int, rows *sql.Rows, sqltype string) (scanA
 	return scanArgs, nochoiced
 }
 
-func (r *Reader) getOffsetIndex(columns []string) int {
-	offsetKeyIndex := -1
-	for idx, key := range columns {
-		if key == r.offsetKey {
+func indexOf(columns []string, key string) int {
+	for idx, column := range columns {
+		if column == key {
 			return idx
 		}
 	}
-	return offsetKeyIndex
+	return -1
+}
+
+func (r *Reader) getOffsetIndex(columns []string) int {
+	return indexOf(columns, r.offsetKey)
 }
 
 func (r *Reader) exec(connectStr string) (err error) {
@@ -1015,7 +1015,7 @@ func (r *Reader) countDB(dbs []string, now time.Time) {
 }
 
 func (r *Reader) execCountDB(curDb string, now time.Time, recordTablesDone TableRecords) error {
-	connectStr := getConnectStr(r.datasource, curDb, r.encoder)
+	connectStr := r.connectStr(curDb)
 	db, err := openSql(r.dbtype, connectStr, r.Name())
 	if err != nil {
 		return err
@@ -1082,7 +1082,7 @@ func (r *Reader) execCountDB(curDb string, now time.Time, recordTablesDone Table
 }
 
 func (r *Reader) execReadDB(curDb string, now time.Time, recordTablesDone TableRecords) (err error) {
-	connectStr := getConnectStr(r.datasource, curDb, r.encoder)
+	connectStr := r.connectStr(curDb)
 	db, err := openSql(r.dbtype, connectStr, r.Name())
 	if err != nil {
 		return err
@@ -1376,6 +1376,9 @@ func convertString(v interface{}) (string, error) {
 		if ret, ok := idv.([]byte); ok {
 			return string(ret), nil
 		}
+		if ret, ok := idv.(time.Time); ok {
+			return ret.Format(time.RFC3339Nano), nil
+		}
 		if idv == nil {
 			return "", nil
 		}
@@ -1384,6 +1387,18 @@ func convertString(v interface{}) (string, error) {
 	return "", fmt.Errorf("%v type can not convert to string", dv.Kind())
 }
 
+// convertTimestamp 把时间类型的列转换为微秒时间戳
+func convertTimestamp(v interface{}) (int64, error) {
+	dpv := reflect.ValueOf(v)
+	if dpv.Kind() != reflect.Ptr || dpv.IsNil() {
+		return 0, errors.New("scanArgs not a pointer")
+	}
+	if t, ok := reflect.Indirect(dpv).Interface().(time.Time); ok {
+		return t.UnixNano() / int64(time.Microsecond), nil
+	}
+	return 0, fmt.Errorf("%v type can not convert to timestamp", reflect.Indirect(dpv).Kind())
+}
+
 func (r *Reader) getSQL(idx int, rawSQL string) (sql string, err error) {
 	rawSQL = strings.TrimSuffix(strings.TrimSpace(rawSQL), ";")
 	switch r.dbtype {
@@ -1402,6 +1417,8 @@ func (r *Reader) getSQL(idx int, rawSQL string) (sql string, err error) {
 	case reader.ModePostgreSQL:
 		if len(r.offsetKey) > 0 {
 			sql = fmt.Sprintf("%s WHERE %v >= %d AND %v < %d;", rawSQL, r.offsetKey, r.offsets[idx], r.offsetKey, r.offsets[idx]+int64(r.readBatch))
+		} else if len(r.timestampKey) > 0 {
+			sql = getTimestampSQL(rawSQL, r.timestampKey, r.offsets[idx], r.readBatch)
 		} else {
 			err = fmt.Errorf("%v dbtype is not support get SQL without id now", r.dbtype)
 		}
@@ -1412,6 +1429,16 @@ func (r *Reader) getSQL(idx int, rawSQL string) (sql string, err error) {
 	return sql, err
 }
 
+// getTimestampSQL 读取 timestampKey 大于上次读取的最大时间的一批数据，为了不把时间相同的数据拆分到两批中，
+// 每批读取到第 readBatch 条数据的时间为止（包含该时间的所有数据），所以每批的条数可能多于 readBatch
+func getTimestampSQL(rawSQL, timestampKey string, cursor int64, readBatch int) string {
+	start := time.Unix(0, cursor*int64(time.Microsecond)).UTC().Format(pgTimestampLayout)
+	return fmt.Sprintf("SELECT * FROM (%s) AS logkit_t WHERE %v > '%s' AND %v <= "+
+		"(SELECT max(%v) FROM (SELECT %v FROM (%s) AS logkit_t WHERE %v > '%s' ORDER BY %v LIMIT %d) AS logkit_b) ORDER BY %v;",
+		rawSQL, timestampKey, start, timestampKey,
+		timestampKey, timestampKey, rawSQL, timestampKey, start, timestampKey, readBatch, timestampKey)
+}
+
 func (r *Reader) checkExit(idx int, db *sql.DB) (bool, int64) {
 	if len(r.offsetKey) <= 0 {
 		return true, -1
@@ -1419,7 +1446,7 @@ func (r *Reader) checkExit(idx int, db *sql.DB) (bool, int64) {
 	rawSQL := r.syncSQLs[idx]
 	rawSQL = strings.TrimSuffix(strings.TrimSpace(rawSQL), ";")
 	var tsql string
-	if r.dbtype == reader.ModeMySQL {
+	if r.dbtype == reader.ModeMySQL || r.dbtype == reader.ModePostgreSQL {
 		tsql = fmt.Sprintf("%s WHERE %v >= %d order by %v limit 1;", rawSQL, r.offsetKey, r.offsets[idx], r.offsetKey)
 	} else {
 		ix := strings.Index(rawSQL, "from")
@@ -1627,7 +1654,7 @@ func (r *Reader) getValidData(db *sql.DB, matchData, matchStr string, startIndex
 			continue
 		}
 
-		rawSql, err := getRawSqls(queryType, s)
+		rawSql, err := getRawSqls(queryType, s, r.dbtype)
 		if err != nil {
 			return validData, sqls, err
 		}
@@ -1639,6 +1666,33 @@ func (r *Reader) getValidData(db *sql.DB, matchData, matchStr string, startIndex
 	return validData, sqls, nil
 }
 
+// connectStr 根据数据库类型返回连接 database 的连接串
+func (r *Reader) connectStr(database string) string {
+	switch r.dbtype {
+	case reader.ModeMSSQL:
+		return r.datasource + ";database=" + database
+	case reader.ModePostgreSQL:
+		return getPGConnectStr(r.datasource, database)
+	}
+	return getConnectStr(r.datasource, database, r.encoder)
+}
+
+// getPGConnectStr 把 datasource 中的 dbname 替换为 database，没有 dbname 时添加
+func getPGConnectStr(datasource, database string) string {
+	spls := strings.Fields(datasource)
+	contains := false
+	for idx, v := range spls {
+		if strings.HasPrefix(v, "dbname=") {
+			contains = true
+			spls[idx] = "dbname=" + database
+		}
+	}
+	if !contains {
+		spls = append(spls, "dbname="+database)
+	}
+	return strings.Join(spls, " ")
+}
+
 func getConnectStr(datasource, database, encoder string) (connectStr string) {
 	connectStr = datasource + "/" + database
 	if encoder != "" {
@@ -1781,12 +1835,17 @@ func (r *Reader) getCheckAll(queryType int) (checkAll bool, err error) {
 }
 
 // 根据 queryType 获取表中所有记录或者表中所有数据的条数的sql语句
-func getRawSqls(queryType int, table string) (sqls string, err error) {
+func getRawSqls(queryType int, table, dbtype string) (sqls string, err error) {
+	// PostgreSQL 中的标识符使用双引号
+	quoted := "`" + table + "`"
+	if dbtype == reader.ModePostgreSQL {
+		quoted = `"` + strings.Replace(table, `"`, `""`, -1) + `"`
+	}
 	switch queryType {
 	case TABLE:
-		sqls += "Select * From `" + table + "`;"
+		sqls += "Select * From " + quoted + ";"
 	case COUNT:
-		sqls += "Select Count(*) From `" + table + "`;"
+		sqls += "Select Count(*) From " + quoted + ";"
 	case DATABASE:
 	default:
 		return "", fmt.Errorf("%v queryType is not support get sql now", queryType)
@@ -1802,6 +1861,9 @@ func (r *Reader) getQuery(queryType int) (query string, err error) {
 		query, err = getDefaultSql(r.database, r.dbtype)
 	case DATABASE:
 		query = DefaultMySQLDatabase
+		if r.dbtype == reader.ModePostgreSQL {
+			query = DefaultPGSQLDatabase
+		}
 	default:
 		return "", fmt.Errorf("%v queryType is not support get sql now", queryType)
 	}
@@ -1877,12 +1939,17 @@ func (r *Reader) execReadSql(db *sql.DB, idx int, rawSql string, tables []string
 	log.Infof("Runner[%v] SQL ：<%v>, schemas: <%v>", r.meta.RunnerName, execSQL, strings.Join(columns, ", "))
 	scanArgs, nochiced := r.getInitScans(len(columns), rows, r.dbtype)
 	var offsetKeyIndex int
+	timestampKeyIndex := -1
 	if r.rawsqls != "" {
 		offsetKeyIndex = r.getOffsetIndex(columns)
+		if r.timestampKey != "" {
+			timestampKeyIndex = indexOf(columns, r.timestampKey)
+		}
 	}
 
 	// Fetch rows
 	var maxOffset int64 = -1
+	var maxTimestamp int64 = -1
 	for rows.Next() {
 		exit = false
 		// get RawBytes from data
@@ -1998,12 +2065,23 @@ func (r *Reader) execReadSql(db *sql.DB, idx int, rawSql string, tables []string
 			continue
 		}
 
+		if r.timestampKey != "" {
+			maxTimestamp = r.updateTimestamp(timestampKeyIndex, maxTimestamp, scanArgs)
+			continue
+		}
 		maxOffset = r.updateOffset(idx, offsetKeyIndex, maxOffset, scanArgs)
 	}
 
 	if maxOffset > 0 {
 		r.offsets[idx] = maxOffset + 1
 	}
+	if maxTimestamp > r.offsets[idx] {
+		r.offsets[idx] = maxTimestamp
+	} else if r.timestampKey != "" && !exit {
+		// 读到了数据但是没有拿到更大的时间，继续读取会重复读到同样的数据
+		log.Errorf("Runner[%v] %v timestamp key %v not found or can not be parsed, exit...", r.meta.RunnerName, r.Name(), r.timestampKey)
+		exit = true
+	}
 	if exit {
 		var newOffsetIdx int64
 		exit, newOffsetIdx = r.checkExit(idx, db)
@@ -2046,6 +2124,22 @@ func (r *Reader) updateOffset(idx, offsetKeyIndex int, maxOffset int64, scanArgs
 	return maxOffset
 }
 
+// updateTimestamp 返回 timestampKey 列的最大时间（微秒）
+func (r *Reader) updateTimestamp(timestampKeyIndex int, maxTimestamp int64, scanArgs []interface{}) int64 {
+	if timestampKeyIndex < 0 {
+		return maxTimestamp
+	}
+	ts, err := convertTimestamp(scanArgs[timestampKeyIndex])
+	if err != nil {
+		log.Errorf("Runner[%v] %v timestamp key value parse error %v, offset was not recorded", r.meta.RunnerName, r.Name(), err)
+		return maxTimestamp
+	}
+	if ts > maxTimestamp {
+		return ts
+	}
+	return maxTimestamp
+}
+
 func (r *Reader) addCount(current int64) {
 	r.countLock.Lock()
 	defer r.countLock.Unlock()
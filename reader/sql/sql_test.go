@@ -1030,10 +1030,59 @@ func Test_getRawSqls(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		sqls, err := getRawSqls(test.queryType, "my_table")
+		sqls, err := getRawSqls(test.queryType, "my_table", reader.ModeMySQL)
 		assert.NoError(t, err)
 		assert.EqualValues(t, test.exp_sqls, sqls)
 	}
+
+	sqls, err := getRawSqls(TABLE, "my_table", reader.ModePostgreSQL)
+	assert.NoError(t, err)
+	assert.EqualValues(t, `Select * From "my_table";`, sqls)
+}
+
+func TestPostgresReader(t *testing.T) {
+	c := conf.MapConf{
+		reader.KeyMetaPath:          MetaDir,
+		reader.KeyMode:              reader.ModePostgreSQL,
+		reader.KeyPGsqlDataSource:   "host=localhost port=5432 dbname=old sslmode=disable",
+		reader.KeyPGsqlDataBase:     "logs",
+		reader.KeyPGsqlTimestampKey: "created_at",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	defer os.RemoveAll(MetaDir)
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+	c[reader.KeyPGsqlSQL] = "select * from logs_@(YYYY)@(MM)@(DD);"
+	c[reader.KeyPGsqlOffsetKey] = "id"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+	delete(c, reader.KeyPGsqlOffsetKey)
+	rr, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	r := rr.(*Reader)
+
+	assert.Equal(t, "host=localhost port=5432 dbname=logs sslmode=disable", r.connectStr("logs"))
+	assert.Equal(t, "host=localhost dbname=logs", getPGConnectStr("host=localhost", "logs"))
+	assert.Equal(t, []string{"select * from logs_" + time.Now().Format("20060102")}, r.syncSQLs)
+
+	r.offsets = []int64{time.Date(2018, 7, 1, 10, 0, 0, 123456000, time.UTC).UnixNano() / int64(time.Microsecond)}
+	gotSQL, err := r.getSQL(0, "select * from logs;")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (select * from logs) AS logkit_t WHERE created_at > '2018-07-01 10:00:00.123456+00:00' AND created_at <= "+
+		"(SELECT max(created_at) FROM (SELECT created_at FROM (select * from logs) AS logkit_t WHERE created_at > '2018-07-01 10:00:00.123456+00:00' "+
+		"ORDER BY created_at LIMIT 100) AS logkit_b) ORDER BY created_at;", gotSQL)
+
+	var v interface{} = time.Date(2018, 7, 1, 18, 0, 0, 1000, time.FixedZone("CST", 8*3600))
+	ts, err := convertTimestamp(&v)
+	assert.NoError(t, err)
+	assert.Equal(t, r.offsets[0]-123456+1, ts)
+	str, err := convertString(&v)
+	assert.NoError(t, err)
+	assert.Equal(t, "2018-07-01T18:00:00.000001+08:00", str)
+	v = "2018"
+	_, err = convertTimestamp(&v)
+	assert.Error(t, err)
 }
 
 func Test_WriteRecordsFile(t *testing.T) {
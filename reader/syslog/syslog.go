@@ -0,0 +1,418 @@
+// Package syslog 监听 UDP、TCP 以及 TLS 端口接收 syslog，解析 RFC3164 和 RFC5424 格式的消息，
+// TCP 连接上的消息支持 RFC6587 的 octet counting 和换行分隔两种分帧方式
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	psyslog "github.com/qiniu/logkit/parser/syslog"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+const (
+	// maxPacketSize 是 UDP 数据包的最大长度
+	maxPacketSize = 64 * 1024
+	// maxCountLength 是 octet counting 中长度的最大位数
+	maxCountLength = 10
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeSyslog, NewReader)
+}
+
+type message struct {
+	data Data
+	size int64
+}
+
+type Reader struct {
+	meta      *reader.Meta
+	addresses []string
+	format    psyslog.Format
+	tlsConfig *tls.Config
+	maxSize   int
+
+	status   int32
+	readChan chan message
+
+	mux     sync.Mutex
+	closers []io.Closer
+	conns   map[net.Conn]struct{}
+	wg      sync.WaitGroup
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	addresses, _ := c.GetStringListOr(reader.KeySyslogAddress, []string{reader.DefaultSyslogAddress})
+	rfc, _ := c.GetStringOr(reader.KeySyslogRFC, reader.SyslogRFCAuto)
+	switch rfc {
+	case reader.SyslogRFCAuto, reader.SyslogRFC3164, reader.SyslogRFC5424:
+	default:
+		return nil, fmt.Errorf("%v %v not supported, should be %v, %v or %v", reader.KeySyslogRFC, rfc,
+			reader.SyslogRFCAuto, reader.SyslogRFC3164, reader.SyslogRFC5424)
+	}
+	maxSize, _ := c.GetIntOr(reader.KeySyslogMaxMessageSize, reader.DefaultSyslogMaxMessageSize)
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("%v should be greater than 0", reader.KeySyslogMaxMessageSize)
+	}
+
+	var useTLS bool
+	for _, address := range addresses {
+		network, _, err := splitAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		useTLS = useTLS || network == "tls"
+	}
+	var tlsConfig *tls.Config
+	if useTLS {
+		certPath, err := c.GetString(reader.KeySyslogTLSCertPath)
+		if err != nil {
+			return nil, err
+		}
+		keyPath, err := c.GetString(reader.KeySyslogTLSKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		caPath, _ := c.GetStringOr(reader.KeySyslogTLSCAPath, "")
+		if tlsConfig, err = newTLSConfig(certPath, keyPath, caPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Reader{
+		meta:      meta,
+		addresses: addresses,
+		format:    psyslog.GetFormt(rfc),
+		tlsConfig: tlsConfig,
+		maxSize:   maxSize,
+		status:    reader.StatusInit,
+		readChan:  make(chan message, 100),
+		conns:     make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// splitAddress 把 udp://0.0.0.0:514 格式的地址拆分为协议和监听地址
+func splitAddress(address string) (network, addr string, err error) {
+	spl := strings.SplitN(address, "://", 2)
+	if len(spl) != 2 || spl[1] == "" {
+		return "", "", fmt.Errorf("invalid %v %q, should be like udp://0.0.0.0:514", reader.KeySyslogAddress, address)
+	}
+	switch spl[0] {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "tls":
+		return spl[0], spl[1], nil
+	}
+	return "", "", fmt.Errorf("unknown protocol %q in %v, should be udp, tcp or tls", spl[0], address)
+}
+
+// newTLSConfig 加载服务端证书，配置了 CA 证书时要求客户端提供由该 CA 签发的证书
+func newTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate error %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca error %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in %v", caPath)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (r *Reader) Name() string {
+	return "SyslogReader<" + strings.Join(r.addresses, ",") + ">"
+}
+
+func (r *Reader) Source() string {
+	return strings.Join(r.addresses, ",")
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("SyslogReader not support read mode")
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+// Start 开始监听所有的地址，有地址监听失败时关闭已经打开的监听，下次读取时重试
+func (r *Reader) Start() error {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return nil
+	}
+	for _, address := range r.addresses {
+		if err := r.listen(address); err != nil {
+			atomic.StoreInt32(&r.status, reader.StatusStopped)
+			r.closeAll()
+			atomic.StoreInt32(&r.status, reader.StatusInit)
+			return fmt.Errorf("listen on %v error: %v", address, err)
+		}
+	}
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+	return nil
+}
+
+func (r *Reader) listen(address string) error {
+	network, addr, err := splitAddress(address)
+	if err != nil {
+		return err
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+		pc, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		r.addCloser(pc)
+		r.wg.Add(1)
+		go r.servePacket(pc)
+	case "tls":
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		l = tls.NewListener(l, r.tlsConfig)
+		r.addCloser(l)
+		r.wg.Add(1)
+		go r.serveStream(l)
+	default:
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		r.addCloser(l)
+		r.wg.Add(1)
+		go r.serveStream(l)
+	}
+	return nil
+}
+
+func (r *Reader) addCloser(c io.Closer) {
+	r.mux.Lock()
+	r.closers = append(r.closers, c)
+	r.mux.Unlock()
+}
+
+// closeAll 关闭所有的监听和连接，并等待处理的 goroutine 退出
+func (r *Reader) closeAll() {
+	r.mux.Lock()
+	for _, c := range r.closers {
+		c.Close()
+	}
+	r.closers = nil
+	for c := range r.conns {
+		c.Close()
+	}
+	r.mux.Unlock()
+	r.wg.Wait()
+}
+
+func (r *Reader) running() bool {
+	return atomic.LoadInt32(&r.status) == reader.StatusRunning
+}
+
+func (r *Reader) servePacket(pc net.PacketConn) {
+	defer r.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if r.running() {
+				log.Errorf("Runner[%v] %v read from %v error: %v", r.meta.RunnerName, r.Name(), pc.LocalAddr(), err)
+				r.setStatsError(err.Error())
+			}
+			return
+		}
+		if !r.put(buf[:n]) {
+			return
+		}
+	}
+}
+
+func (r *Reader) serveStream(l net.Listener) {
+	defer r.wg.Done()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			if r.running() {
+				log.Errorf("Runner[%v] %v accept on %v error: %v", r.meta.RunnerName, r.Name(), l.Addr(), err)
+				r.setStatsError(err.Error())
+			}
+			return
+		}
+		r.mux.Lock()
+		if !r.running() {
+			r.mux.Unlock()
+			c.Close()
+			return
+		}
+		r.conns[c] = struct{}{}
+		r.wg.Add(1)
+		r.mux.Unlock()
+		go r.serveConn(c)
+	}
+}
+
+func (r *Reader) serveConn(c net.Conn) {
+	defer func() {
+		r.mux.Lock()
+		delete(r.conns, c)
+		r.mux.Unlock()
+		c.Close()
+		r.wg.Done()
+	}()
+	br := bufio.NewReaderSize(c, r.maxSize)
+	for {
+		frame, err := readFrame(br, r.maxSize)
+		if err != nil {
+			if err != io.EOF && r.running() {
+				log.Warnf("Runner[%v] %v read from %v error: %v, close the connection", r.meta.RunnerName, r.Name(), c.RemoteAddr(), err)
+			}
+			return
+		}
+		if !r.put(frame) {
+			return
+		}
+	}
+}
+
+// readFrame 读取 TCP 连接上的一条消息，以数字开头的是 RFC6587 的 octet counting 格式 "长度 消息"，否则以换行分隔
+func readFrame(br *bufio.Reader, maxSize int) ([]byte, error) {
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("message is longer than %v bytes", maxSize)
+		}
+		// 连接关闭前的最后一条消息可能没有换行
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), line...), nil
+	}
+
+	n := 0
+	for i := 0; ; i++ {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' || i >= maxCountLength {
+			return nil, errors.New("invalid octet counting frame")
+		}
+		n = n*10 + int(c-'0')
+	}
+	if n <= 0 || n > maxSize {
+		return nil, fmt.Errorf("invalid message length %v in octet counting frame", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(br, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// put 解析一条消息并放入 readChan，空消息直接忽略，reader 关闭后返回 false
+func (r *Reader) put(raw []byte) bool {
+	raw = bytes.TrimRight(raw, "\r\n\x00")
+	if len(raw) == 0 {
+		return true
+	}
+	m := message{data: r.parse(raw), size: int64(len(raw))}
+	for r.running() {
+		select {
+		case r.readChan <- m:
+			return true
+		case <-time.After(time.Second):
+		}
+	}
+	return false
+}
+
+// parse 解析 syslog 消息，得到 priority、facility、severity、hostname 等字段，无法解析的消息原样放在 pandora_stash 中
+func (r *Reader) parse(raw []byte) Data {
+	p := r.format.GetParser(raw)
+	if err := p.Parse(); err != nil && err.Error() != "No structured data" {
+		return Data{KeyPandoraStash: string(raw)}
+	}
+	return Data(p.Dump())
+}
+
+func (r *Reader) ReadData() (Data, int64, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		if err := r.Start(); err != nil {
+			r.setStatsError(err.Error())
+			return nil, 0, err
+		}
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case m := <-r.readChan:
+		return m.data, m.size, nil
+	case <-timer.C:
+	}
+	return nil, 0, nil
+}
+
+// SyncMeta 网络接收的数据无法重新读取，没有需要保存的读取位置
+func (r *Reader) SyncMeta() {}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	if atomic.SwapInt32(&r.status, reader.StatusStopped) == reader.StatusRunning {
+		r.closeAll()
+		log.Infof("Runner[%v] %v stopped", r.meta.RunnerName, r.Name())
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/reader/test"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestReadFrame(t *testing.T) {
+	input := "<34>Oct 11 22:14:15 mymachine su: first\r\n" +
+		"53 <165>1 2003-10-11T22:14:15.003Z host app - ID47 - a\nb" +
+		"<34>Oct 11 22:14:15 mymachine su: last"
+	br := bufio.NewReader(strings.NewReader(input))
+	var frames []string
+	for {
+		frame, err := readFrame(br, 1024)
+		if err != nil {
+			break
+		}
+		frames = append(frames, string(frame))
+	}
+	assert.Equal(t, []string{
+		"<34>Oct 11 22:14:15 mymachine su: first\r\n",
+		"<165>1 2003-10-11T22:14:15.003Z host app - ID47 - a\nb",
+		"<34>Oct 11 22:14:15 mymachine su: last",
+	}, frames)
+
+	_, err := readFrame(bufio.NewReader(strings.NewReader("2048 <34>")), 1024)
+	assert.Error(t, err)
+	_, err = readFrame(bufio.NewReader(strings.NewReader("12x <34>")), 1024)
+	assert.Error(t, err)
+}
+
+func newTestReader(t *testing.T, c conf.MapConf) *Reader {
+	c[reader.KeyMetaPath] = MetaDir
+	c[reader.KeyFileDone] = MetaDir
+	c[reader.KeyMode] = reader.ModeSyslog
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	sr := r.(*Reader)
+	assert.NoError(t, sr.Start())
+	return sr
+}
+
+// listenAddr 返回第 i 个监听的实际地址
+func (r *Reader) listenAddr(i int) string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	switch c := r.closers[i].(type) {
+	case net.PacketConn:
+		return c.LocalAddr().String()
+	case net.Listener:
+		return c.Addr().String()
+	}
+	return ""
+}
+
+func readN(t *testing.T, r *Reader, n int) []Data {
+	var datas []Data
+	for i := 0; i < 5 && len(datas) < n; i++ {
+		data, _, err := r.ReadData()
+		assert.NoError(t, err)
+		if data != nil {
+			datas = append(datas, data)
+		}
+	}
+	return datas
+}
+
+func TestSyslogReader(t *testing.T) {
+	defer os.RemoveAll(MetaDir)
+	r := newTestReader(t, conf.MapConf{
+		reader.KeySyslogAddress: "udp://127.0.0.1:0,tcp://127.0.0.1:0",
+	})
+	defer r.Close()
+
+	udp, err := net.Dial("udp", r.listenAddr(0))
+	assert.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - An application event\n"))
+	assert.NoError(t, err)
+	datas := readN(t, r, 1)
+	if assert.Len(t, datas, 1) {
+		assert.Equal(t, 165, datas[0]["priority"])
+		assert.Equal(t, 20, datas[0]["facility"])
+		assert.Equal(t, 5, datas[0]["severity"])
+		assert.Equal(t, "mymachine.example.com", datas[0]["hostname"])
+		assert.Equal(t, "evntslog", datas[0]["app_name"])
+		assert.Equal(t, "An application event", datas[0]["message"])
+	}
+
+	tcpAddr := r.listenAddr(1)
+	tcp, err := net.Dial("tcp", tcpAddr)
+	assert.NoError(t, err)
+	defer tcp.Close()
+	msg := "<34>Oct 11 22:14:15 mymachine su: 'su root' failed"
+	_, err = tcp.Write([]byte(strconv.Itoa(len(msg)) + " " + msg + msg + "\nnot a syslog message\n"))
+	assert.NoError(t, err)
+	datas = readN(t, r, 3)
+	if assert.Len(t, datas, 3) {
+		for _, data := range datas[:2] {
+			assert.Equal(t, 34, data["priority"])
+			assert.Equal(t, 4, data["facility"])
+			assert.Equal(t, 2, data["severity"])
+			assert.Equal(t, "mymachine", data["hostname"])
+			assert.Equal(t, "su", data["tag"])
+		}
+		assert.Equal(t, Data{KeyPandoraStash: "not a syslog message"}, datas[2])
+	}
+
+	assert.NoError(t, r.Close())
+	_, err = net.Dial("tcp", tcpAddr)
+	assert.Error(t, err)
+}
+
+func TestSyslogReaderTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog_tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(MetaDir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certPath, keyPath)
+
+	c := conf.MapConf{reader.KeySyslogAddress: "tls://127.0.0.1:0"}
+	meta, err := reader.NewMetaWithConf(conf.MapConf{reader.KeyMetaPath: MetaDir, reader.KeyMode: reader.ModeSyslog})
+	assert.NoError(t, err)
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+
+	c[reader.KeySyslogTLSCertPath] = certPath
+	c[reader.KeySyslogTLSKeyPath] = keyPath
+	r := newTestReader(t, c)
+	defer r.Close()
+
+	conn, err := tls.Dial("tcp", r.listenAddr(0), &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<13>1 2018-07-01T10:00:00Z web01 nginx 123 - - hello\n"))
+	assert.NoError(t, err)
+	datas := readN(t, r, 1)
+	if assert.Len(t, datas, 1) {
+		assert.Equal(t, "web01", datas[0]["hostname"])
+		assert.Equal(t, "hello", datas[0]["message"])
+	}
+}
+
+func writeTestCert(t *testing.T, certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
@@ -0,0 +1,77 @@
+package tailx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+)
+
+// backoff 控制 ActiveReader 没有读到数据时休息多久、多久没有数据后认为文件不再活跃
+type backoff struct {
+	eofSleep        time.Duration // 读到文件末尾后的休息时间
+	idleSleep       time.Duration // 没有读到完整的一行(如多行模式下还在等待下一行)时的休息时间
+	inactiveTimeout time.Duration // 持续这么久没有读到内容就设置为 inactive
+	exponential     bool          // 连续读不到内容时休息时间翻倍，直到 maxSleep
+	maxSleep        time.Duration
+}
+
+var defaultBackoff = backoff{
+	eofSleep:        5 * time.Second,
+	idleSleep:       time.Second,
+	inactiveTimeout: time.Hour,
+	maxSleep:        30 * time.Second,
+}
+
+func newBackoff(c conf.MapConf) (bo backoff, err error) {
+	bo = defaultBackoff
+	durations := []struct {
+		key string
+		dur *time.Duration
+	}{
+		{reader.KeyTailxEOFSleep, &bo.eofSleep},
+		{reader.KeyTailxIdleSleep, &bo.idleSleep},
+		{reader.KeyTailxInactiveTimeout, &bo.inactiveTimeout},
+		{reader.KeyTailxMaxSleep, &bo.maxSleep},
+	}
+	for _, d := range durations {
+		s, _ := c.GetStringOr(d.key, "")
+		if s == "" {
+			continue
+		}
+		if *d.dur, err = time.ParseDuration(s); err != nil {
+			return bo, fmt.Errorf("%v %q is not a valid duration: %v", d.key, s, err)
+		}
+		if *d.dur <= 0 {
+			return bo, fmt.Errorf("%v %q should be greater than 0", d.key, s)
+		}
+	}
+	mode, _ := c.GetStringOr(reader.KeyTailxBackoff, reader.TailxBackoffFixed)
+	switch mode {
+	case reader.TailxBackoffFixed:
+	case reader.TailxBackoffExponential:
+		bo.exponential = true
+	default:
+		return bo, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyTailxBackoff, mode, reader.TailxBackoffFixed, reader.TailxBackoffExponential)
+	}
+	return bo, nil
+}
+
+// sleep 返回连续第 misses 次(从1开始)没有读到内容时的休息时间，base 为 eofSleep 或 idleSleep
+func (bo backoff) sleep(base time.Duration, misses int) time.Duration {
+	if !bo.exponential {
+		return base
+	}
+	if base >= bo.maxSleep {
+		return base
+	}
+	d := base
+	for i := 1; i < misses; i++ {
+		d *= 2
+		if d >= bo.maxSleep {
+			return bo.maxSleep
+		}
+	}
+	return d
+}
@@ -0,0 +1,45 @@
+package tailx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+)
+
+func TestBackoff(t *testing.T) {
+	bo, err := newBackoff(conf.MapConf{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultBackoff, bo)
+	assert.Equal(t, 5*time.Second, bo.sleep(bo.eofSleep, 10))
+
+	bo, err = newBackoff(conf.MapConf{
+		reader.KeyTailxEOFSleep:        "100ms",
+		reader.KeyTailxIdleSleep:       "50ms",
+		reader.KeyTailxInactiveTimeout: "10m",
+		reader.KeyTailxBackoff:         reader.TailxBackoffExponential,
+		reader.KeyTailxMaxSleep:        "1s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, bo.inactiveTimeout)
+	for misses, exp := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		assert.Equal(t, exp, bo.sleep(bo.eofSleep, misses), misses)
+	}
+	assert.Equal(t, 50*time.Millisecond, bo.sleep(bo.idleSleep, 1))
+
+	_, err = newBackoff(conf.MapConf{reader.KeyTailxEOFSleep: "abc"})
+	assert.Error(t, err)
+	_, err = newBackoff(conf.MapConf{reader.KeyTailxIdleSleep: "0s"})
+	assert.Error(t, err)
+	_, err = newBackoff(conf.MapConf{reader.KeyTailxBackoff: "linear"})
+	assert.Error(t, err)
+}
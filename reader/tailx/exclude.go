@@ -0,0 +1,60 @@
+package tailx
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/qiniu/logkit/reader"
+	utilsos "github.com/qiniu/logkit/utils/os"
+)
+
+// excludePattern 是 log_path_exclude 中的一项，以 regex: 开头的是正则表达式，匹配完整路径中的任意部分；
+// 其他为通配符，不包含路径分隔符时只匹配文件名，否则匹配完整路径
+type excludePattern struct {
+	glob     string
+	fullPath bool
+	regex    *regexp.Regexp
+}
+
+func newExcludePatterns(patterns []string) ([]excludePattern, error) {
+	var excludes []excludePattern
+	for _, p := range patterns {
+		if strings.HasPrefix(p, reader.ExcludeRegexPrefix) {
+			regex, err := regexp.Compile(strings.TrimPrefix(p, reader.ExcludeRegexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("%v %q is not a valid regex: %v", reader.KeyLogPathExclude, p, err)
+			}
+			excludes = append(excludes, excludePattern{regex: regex})
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%v %q is not a valid pattern: %v", reader.KeyLogPathExclude, p, err)
+		}
+		excludes = append(excludes, excludePattern{glob: p, fullPath: strings.ContainsAny(p, "/"+string(filepath.Separator))})
+	}
+	return excludes, nil
+}
+
+func (e excludePattern) match(path string) bool {
+	if e.regex != nil {
+		return e.regex.MatchString(path)
+	}
+	name := filepath.Base(path)
+	if e.fullPath {
+		name = path
+	}
+	matched, _ := utilsos.Match(e.glob, name)
+	return matched
+}
+
+// isExcluded 判断 path 是否匹配任意一个排除规则
+func isExcluded(excludes []excludePattern, path string) bool {
+	for _, e := range excludes {
+		if e.match(path) {
+			return true
+		}
+	}
+	return false
+}
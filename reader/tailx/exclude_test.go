@@ -0,0 +1,33 @@
+package tailx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExcludePatterns(t *testing.T) {
+	excludes, err := newExcludePatterns([]string{"*.gz", "*.swp", filepath.FromSlash("/logs/audit/*"), "regex:\\.bak\\d*$"})
+	assert.NoError(t, err)
+	tests := map[string]bool{
+		"/logs/app/a.log":        false,
+		"/logs/app/a.log.gz":     true,
+		"/logs/app/.a.log.swp":   true,
+		"/logs/audit/a.log":      true,
+		"/logs/app/audit/a.log":  false,
+		"/logs/app/a.log.bak12":  true,
+		"/logs/app/a.bak.log":    false,
+		"/logs/app.gz/a.log":     false,
+		"/logs/app/a.log.gz.tmp": false,
+	}
+	for path, exp := range tests {
+		assert.Equal(t, exp, isExcluded(excludes, filepath.FromSlash(path)), path)
+	}
+	assert.False(t, isExcluded(nil, "/logs/app/a.log.gz"))
+
+	_, err = newExcludePatterns([]string{"[a"})
+	assert.Error(t, err)
+	_, err = newExcludePatterns([]string{"regex:(a"})
+	assert.Error(t, err)
+}
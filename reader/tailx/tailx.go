@@ -4,21 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/howeyc/fsnotify"
 	"github.com/json-iterator/go"
 
 	"github.com/qiniu/log"
 
 	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/rateio"
 	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/times"
 	. "github.com/qiniu/logkit/utils/models"
+	utilsos "github.com/qiniu/logkit/utils/os"
 )
 
 func init() {
@@ -28,12 +34,18 @@ func init() {
 type Reader struct {
 	started     bool
 	status      int32
-	fileReaders map[string]*ActiveReader
+	fileReaders map[string]*ActiveReader // key 为文件的设备号和 inode，文件改名后仍然由原来的 ActiveReader 读取
 	armapmux    sync.Mutex
 	startmux    sync.Mutex
 	curFile     string
+	curMeta     reader.SourceMeta
+	hasCurMeta  bool
 	headRegexp  *regexp.Regexp
 	cacheMap    map[string]string
+	rotated     map[string]bool // 原来的文件被改名或删除后，路径上出现的新文件从头开始读取
+	doneIDs     map[string]bool // 被改名或删除后已经读完的文件，改名后仍然被匹配到时不再读取
+
+	continuePattern *reader.ContinuePattern // 和 headRegexp 只有一个不为 nil
 
 	msgChan chan Result
 	errChan chan error
@@ -45,24 +57,56 @@ type Reader struct {
 	statInterval   time.Duration
 	maxOpenFiles   int
 	whence         string
+	startTime      time.Time // whence 为 from_time 时，修改时间早于 startTime 的文件从末尾开始读取
+	excludes       []excludePattern
+	backoff        backoff
+	readSpeedLimit int                // 每个文件的读取限速，单位 KB/s，为0表示不限制
+	totalLimit     *rateio.Controller // 所有文件共享的读取限速，为 nil 时不限制
+	dedup          *reader.Deduper    // 所有文件共享的去重窗口，文件改名后被重新匹配时重复读到的数据也能去掉，为 nil 时不去重
+	lineFilter     *reader.LineFilter // 过滤数据，为 nil 时不过滤
+	delimiter      *reader.Delimiter  // 切分数据的分隔符，为 nil 时按照换行切分
+	maxLineLength  int                // 一行最多读取的字节数，为 0 时不限制
+	maxLineAction  string
+
+	multiLineTimeout  time.Duration // 多行缓存超过这个时间没有新的数据时直接发送，为 0 时不限制
+	multiLineMaxLines int           // 多行缓存达到这个行数时直接发送，为 0 时不限制
+
+	// stat_mode 为 watch 时监听可能出现新文件的目录，创建失败时为 nil，只定时扫描
+	watcher *fsnotify.Watcher
+	watched map[string]bool // 已经监听的目录，只在 run 中访问
 
 	stats     StatsInfo
 	statsLock sync.RWMutex
 }
 
+// watchEventQuiet 收到文件系统通知后等待这么久没有新的通知再扫描，合并批量创建文件时的大量通知
+const watchEventQuiet = 10 * time.Millisecond
+
 type ActiveReader struct {
 	cacheLineMux sync.RWMutex
 	br           *reader.BufReader
 	realpath     string
 	originpath   string
+	id           string // 文件的设备号和 inode
 	readcache    string
+	readmeta     reader.SourceMeta // readcache 在文件中的位置，Path 为空时表示未知
 	msgchan      chan<- Result
 	errChan      chan<- error
 	status       int32
 	inactive     int32 //当inactive>0 时才会被expire回收
+	lastActive   int64 // 最近一次读到数据的时间(UnixNano)，达到 maxOpenFiles 时最久没有数据的会被关闭
+	readLines    int64 // 读到的行数
+	readErrors   int64 // 读取出错的次数
+	switched     int32 // >0 表示 originpath 这个符号链接已经指向了其他文件，或者文件被改名、删除，读完当前文件后关闭
+	drained      int32 // switched 之后读到了 EOF，可以被 expire 回收
 	runnerName   string
 
-	emptyLineCnt int
+	emptyLineCnt int           // 连续没有读到内容的次数
+	emptyDur     time.Duration // 连续没有读到内容的时间
+	wake         chan struct{} // 标记 switched 或者关闭时唤醒读到 EOF 后正在休息的 Run，不用等到 eofSleep 结束
+	backoff      backoff
+	readLimit    *rateio.Controller // 这个文件的读取限速，为 nil 时不限制
+	totalLimit   *rateio.Controller // 同一个 tailx reader 中所有文件共享的读取限速，由 Reader 负责关闭
 
 	stats     StatsInfo
 	statsLock sync.RWMutex
@@ -71,21 +115,30 @@ type ActiveReader struct {
 type Result struct {
 	result  string
 	logpath string
+	meta    reader.SourceMeta
 }
 
 func NewActiveReader(originPath, realPath, whence string, meta *reader.Meta, msgChan chan<- Result, errChan chan<- error) (ar *ActiveReader, err error) {
-	rpath := strings.Replace(realPath, string(os.PathSeparator), "_", -1)
+	id, err := utilsos.GetFileID(realPath)
+	if err != nil {
+		return nil, err
+	}
+	rpath := utilsos.SafeFileName(realPath)
 	subMetaPath := filepath.Join(meta.Dir, rpath)
 	subMeta, err := reader.NewMeta(subMetaPath, subMetaPath, realPath, reader.ModeFile, meta.TagFile, reader.DefautFileRetention)
 	if err != nil {
 		return nil, err
 	}
 	subMeta.Readlimit = meta.Readlimit
+	subMeta.SetEncodingWay(meta.GetEncodingWay())
+	subMeta.ShareStore(meta, rpath)
 	//tailx模式下新增runner是因为文件已经感知到了，所以不可能文件不存在，那么如果读取还遇到错误，应该马上返回，所以errDirectReturn=true
 	fr, err := reader.NewSingleFile(subMeta, realPath, whence, true)
 	if err != nil {
 		return
 	}
+	// 轮转后路径上的新文件由新的 ActiveReader 读取，这里只读取打开的文件
+	fr.DisableReopen = true
 	bf, err := reader.NewReaderSize(fr, subMeta, reader.DefaultBufSize)
 	if err != nil {
 		return
@@ -95,10 +148,14 @@ func NewActiveReader(originPath, realPath, whence string, meta *reader.Meta, msg
 		br:           bf,
 		realpath:     realPath,
 		originpath:   originPath,
+		id:           id,
 		msgchan:      msgChan,
 		errChan:      errChan,
 		inactive:     1,
+		wake:         make(chan struct{}, 1),
+		lastActive:   time.Now().UnixNano(),
 		emptyLineCnt: 0,
+		backoff:      defaultBackoff,
 		runnerName:   meta.RunnerName,
 		status:       reader.StatusInit,
 		statsLock:    sync.RWMutex{},
@@ -122,29 +179,59 @@ func (ar *ActiveReader) Run() {
 		if ar.readcache == "" {
 			ar.cacheLineMux.Lock()
 			ar.readcache, err = ar.br.ReadLine()
+			ar.readmeta = reader.SourceMeta{}
+			if sm, ok := ar.br.SourceMeta(); ok && ar.readcache != "" {
+				sm.Path = ar.originpath
+				ar.readmeta = sm
+			}
 			ar.cacheLineMux.Unlock()
+			if ar.readcache != "" {
+				atomic.AddInt64(&ar.readLines, 1)
+			}
 			if err != nil && err != io.EOF {
+				atomic.AddInt64(&ar.readErrors, 1)
 				log.Warnf("Runner[%v] ActiveReader %s read error: %v", ar.runnerName, ar.originpath, err)
 				ar.setStatsError(err.Error())
 				ar.sendError(err)
 				time.Sleep(3 * time.Second)
 				continue
 			}
+			ar.waitRead(len(ar.readcache))
 			if ar.readcache == "" {
 				ar.emptyLineCnt++
 				//文件EOF，同时没有任何内容，代表不是第一次EOF，休息时间设置长一些
 				if err == io.EOF {
+					// 文件被原地截断时 offset 大于文件大小，一直读到 EOF，需要从头开始读取
+					ar.cacheLineMux.Lock()
+					truncated, terr := ar.br.DetectTruncate()
+					ar.cacheLineMux.Unlock()
+					if terr != nil {
+						log.Warnf("Runner[%v] %v detect truncate error: %v", ar.runnerName, ar.originpath, terr)
+					} else if truncated {
+						log.Warnf("Runner[%v] %v was truncated, reopen it from offset 0", ar.runnerName, ar.originpath)
+						continue
+					}
 					atomic.StoreInt32(&ar.inactive, 1)
-					log.Debugf("Runner[%v] %v meet EOF, ActiveReader was inactive now, sleep 5 seconds", ar.runnerName, ar.originpath)
-					time.Sleep(5 * time.Second)
+					if atomic.LoadInt32(&ar.switched) > 0 {
+						atomic.StoreInt32(&ar.drained, 1)
+					}
+					sleep := ar.backoff.sleep(ar.backoff.eofSleep, ar.emptyLineCnt)
+					log.Debugf("Runner[%v] %v meet EOF, ActiveReader was inactive now, sleep %v", ar.runnerName, ar.originpath, sleep)
+					ar.emptyDur += sleep
+					select {
+					case <-time.After(sleep):
+					case <-ar.wake:
+					}
 					continue
 				}
-				// 一小时没读到内容，设置为inactive
-				if ar.emptyLineCnt > 60*60 {
+				// 超过 inactiveTimeout 没读到内容，设置为inactive
+				if ar.emptyDur >= ar.backoff.inactiveTimeout {
 					atomic.StoreInt32(&ar.inactive, 1)
 				}
-				//读取的结果为空，无论如何都sleep 1s
-				time.Sleep(time.Second)
+				//读取的结果为空，无论如何都要休息一下
+				sleep := ar.backoff.sleep(ar.backoff.idleSleep, ar.emptyLineCnt)
+				ar.emptyDur += sleep
+				time.Sleep(sleep)
 				continue
 			}
 		}
@@ -160,7 +247,10 @@ func (ar *ActiveReader) Run() {
 			}
 
 			atomic.StoreInt32(&ar.inactive, 0)
+			atomic.StoreInt32(&ar.drained, 0)
+			atomic.StoreInt64(&ar.lastActive, time.Now().UnixNano())
 			ar.emptyLineCnt = 0
+			ar.emptyDur = 0
 			//做这一层结构为了快速结束
 			if atomic.LoadInt32(&ar.status) == reader.StatusStopped || atomic.LoadInt32(&ar.status) == reader.StatusStopping {
 				log.Debugf("Runner[%v] %v ActiveReader was stopped when waiting to send data", ar.runnerName, ar.originpath)
@@ -168,7 +258,7 @@ func (ar *ActiveReader) Run() {
 				return
 			}
 			select {
-			case ar.msgchan <- Result{result: ar.readcache, logpath: ar.originpath}:
+			case ar.msgchan <- Result{result: ar.readcache, logpath: ar.originpath, meta: ar.readmeta}:
 				ar.cacheLineMux.Lock()
 				ar.readcache = ""
 				ar.cacheLineMux.Unlock()
@@ -177,11 +267,28 @@ func (ar *ActiveReader) Run() {
 		}
 	}
 }
+// waitRead 等待读取 n 字节的限速额度，超过限速时阻塞
+func (ar *ActiveReader) waitRead(n int) {
+	if n <= 0 {
+		return
+	}
+	if ar.readLimit != nil {
+		ar.readLimit.Wait(n)
+	}
+	if ar.totalLimit != nil {
+		ar.totalLimit.Wait(n)
+	}
+}
+
 func (ar *ActiveReader) Close() error {
 	defer log.Warnf("Runner[%v] ActiveReader %s was closed", ar.runnerName, ar.originpath)
+	if ar.readLimit != nil {
+		closeRateLimit(ar.readLimit)
+	}
 	err := ar.br.Close()
 	if atomic.CompareAndSwapInt32(&ar.status, reader.StatusRunning, reader.StatusStopping) {
 		log.Warnf("Runner[%v] ActiveReader %s was closing", ar.runnerName, ar.originpath)
+		ar.wakeup()
 	} else {
 		return err
 	}
@@ -200,6 +307,23 @@ func (ar *ActiveReader) Close() error {
 	return err
 }
 
+// wakeup 唤醒读到 EOF 后正在休息的 Run
+func (ar *ActiveReader) wakeup() {
+	select {
+	case ar.wake <- struct{}{}:
+	default:
+	}
+}
+
+// markSwitched 标记 ActiveReader 读完当前文件后关闭，第一次标记时返回 true
+func (ar *ActiveReader) markSwitched() bool {
+	if !atomic.CompareAndSwapInt32(&ar.switched, 0, 1) {
+		return false
+	}
+	ar.wakeup()
+	return true
+}
+
 func (ar *ActiveReader) setStatsError(err string) {
 	ar.statsLock.Lock()
 	defer ar.statsLock.Unlock()
@@ -228,6 +352,26 @@ func (ar *ActiveReader) Lag() (rl *LagInfo, err error) {
 	return ar.br.Lag()
 }
 
+// DetailedStatus 返回这个文件的读取状态
+func (ar *ActiveReader) DetailedStatus() reader.FileStatus {
+	fs := reader.FileStatus{
+		Path:      ar.originpath,
+		RealPath:  ar.realpath,
+		Lines:     atomic.LoadInt64(&ar.readLines),
+		Errors:    atomic.LoadInt64(&ar.readErrors),
+		LastError: ar.Status().LastError,
+		Inactive:  atomic.LoadInt32(&ar.inactive) > 0,
+	}
+	if fs.Lines > 0 {
+		fs.LastRead = ar.lastActiveTime()
+	}
+	fs.Inode, fs.Offset, _ = ar.br.Position()
+	if lag, err := ar.Lag(); err == nil && lag != nil {
+		fs.Lag = lag.Size
+	}
+	return fs
+}
+
 //除了sync自己的bufreader，还要sync一行linecache
 func (ar *ActiveReader) SyncMeta() string {
 	ar.cacheLineMux.Lock()
@@ -236,12 +380,23 @@ func (ar *ActiveReader) SyncMeta() string {
 	return ar.readcache
 }
 
+func (ar *ActiveReader) lastActiveTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ar.lastActive))
+}
+
 func (ar *ActiveReader) expired(expireDur time.Duration) bool {
+	if atomic.LoadInt32(&ar.drained) > 0 {
+		return true
+	}
+	// 文件被改名或删除后，读完已经打开的文件再回收，避免丢失还没有读取的内容
+	if ar.replaced() {
+		if ar.markSwitched() {
+			log.Infof("Runner[%v] %v was renamed or removed, finish reading it and then close it", ar.runnerName, ar.realpath)
+		}
+		return atomic.LoadInt32(&ar.drained) > 0
+	}
 	fi, err := os.Stat(ar.realpath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return true
-		}
 		log.Errorf("Runner[%v] stat log %v error %v, will not expire it...", ar.runnerName, ar.originpath, err)
 		return false
 	}
@@ -251,16 +406,93 @@ func (ar *ActiveReader) expired(expireDur time.Duration) bool {
 	return false
 }
 
+// replaced 返回 realpath 是否已经不是正在读取的文件，即文件被改名、删除或者路径上已经是新的文件
+func (ar *ActiveReader) replaced() bool {
+	id, err := utilsos.GetFileID(ar.realpath)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return id != ar.id
+}
+
+// movedPath 在 realpath 所在的目录中查找改名后的文件，文件被删除时返回空
+func (ar *ActiveReader) movedPath() string {
+	dir := filepath.Dir(ar.realpath)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Runner[%v] read dir %v error %v", ar.runnerName, dir, err)
+		return ""
+	}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		p := filepath.Join(dir, fi.Name())
+		if id, err := utilsos.GetFileID(p); err == nil && id == ar.id {
+			return p
+		}
+	}
+	return ""
+}
+
 func NewReader(meta *reader.Meta, conf conf.MapConf) (mr reader.Reader, err error) {
 	logPathPattern, err := conf.GetString(reader.KeyLogPath)
 	if err != nil {
 		return
 	}
 	whence, _ := conf.GetStringOr(reader.KeyWhence, reader.WhenceOldest)
+	var startTime time.Time
+	if whence == reader.WhenceFromTime {
+		startTimeStr, err := conf.GetString(reader.KeyStartTime)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v requires %v", reader.KeyWhence, whence, reader.KeyStartTime)
+		}
+		if startTime, err = times.StrToTime(startTimeStr); err != nil {
+			return nil, fmt.Errorf("%v %q is not a valid time: %v", reader.KeyStartTime, startTimeStr, err)
+		}
+	}
 
 	expireDur, _ := conf.GetStringOr(reader.KeyExpire, "24h")
 	statIntervalDur, _ := conf.GetStringOr(reader.KeyStatInterval, "3m")
 	maxOpenFiles, _ := conf.GetIntOr(reader.KeyMaxOpenFiles, 256)
+	excludeList, _ := conf.GetStringListOr(reader.KeyLogPathExclude, nil)
+	excludes, err := newExcludePatterns(excludeList)
+	if err != nil {
+		return nil, err
+	}
+	bo, err := newBackoff(conf)
+	if err != nil {
+		return nil, err
+	}
+	readSpeedLimit, _ := conf.GetIntOr(reader.KeyReadSpeedLimit, 0)
+	totalSpeedLimit, _ := conf.GetIntOr(reader.KeyReadSpeedLimitTotal, 0)
+	if readSpeedLimit < 0 || totalSpeedLimit < 0 {
+		return nil, fmt.Errorf("%v and %v should not be negative", reader.KeyReadSpeedLimit, reader.KeyReadSpeedLimitTotal)
+	}
+	dedup, err := reader.NewDeduperWithConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	lineFilter, err := reader.NewLineFilterWithConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	delimiter, err := reader.NewDelimiterWithConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	maxLineLength, maxLineAction, err := reader.MaxLineConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	multiLineTimeout, multiLineMaxLines, err := reader.MultiLineConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	statMode, _ := conf.GetStringOr(reader.KeyStatMode, reader.StatModePoll)
+	if statMode != reader.StatModePoll && statMode != reader.StatModeWatch {
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyStatMode, statMode, reader.StatModePoll, reader.StatModeWatch)
+	}
 
 	expire, err := time.ParseDuration(expireDur)
 	if err != nil {
@@ -299,26 +531,62 @@ func NewReader(meta *reader.Meta, conf conf.MapConf) (mr reader.Reader, err erro
 		err = nil
 	}
 
+	var watcher *fsnotify.Watcher
+	if statMode == reader.StatModeWatch {
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			log.Warnf("Runner[%v] %v create file watcher error %v, only stat every %v", meta.RunnerName, logPathPattern, err, statInterval)
+			watcher, err = nil, nil
+		}
+	}
+
+	var totalLimit *rateio.Controller
+	if totalSpeedLimit > 0 {
+		totalLimit = rateio.NewController(totalSpeedLimit * 1024)
+	}
+
 	return &Reader{
 		meta:           meta,
 		logPathPattern: logPathPattern,
 		whence:         whence,
+		startTime:      startTime,
 		expire:         expire,
 		statInterval:   statInterval,
 		maxOpenFiles:   maxOpenFiles,
+		excludes:       excludes,
+		backoff:        bo,
+		readSpeedLimit: readSpeedLimit,
+		totalLimit:     totalLimit,
+		dedup:          dedup,
+		lineFilter:     lineFilter,
+		delimiter:      delimiter,
+		maxLineLength:  maxLineLength,
+		maxLineAction:  maxLineAction,
 		started:        false,
 		startmux:       sync.Mutex{},
 		status:         reader.StatusInit,
 		fileReaders:    make(map[string]*ActiveReader), //armapmux
 		cacheMap:       cacheMap,                       //armapmux
+		rotated:        make(map[string]bool),          //armapmux
+		doneIDs:        make(map[string]bool),          //armapmux
 		armapmux:       sync.Mutex{},
 		msgChan:        make(chan Result),
 		errChan:        make(chan error),
 		statsLock:      sync.RWMutex{},
+		watcher:        watcher,
+		watched:        make(map[string]bool),
+
+		multiLineTimeout:  multiLineTimeout,
+		multiLineMaxLines: multiLineMaxLines,
 	}, nil
 
 }
 
+// closeRateLimit 先取消限速唤醒正在等待的读取，再关闭 controller，避免关闭后还在等待的 ActiveReader 永远阻塞
+func closeRateLimit(c *rateio.Controller) {
+	c.SetRateLimit(0)
+	c.Close()
+}
+
 //Expire 函数关闭过期的文件，再更新
 func (mr *Reader) Expire() {
 	var paths []string
@@ -330,13 +598,31 @@ func (mr *Reader) Expire() {
 	if atomic.LoadInt32(&mr.status) == reader.StatusStopped {
 		return
 	}
-	for path, ar := range mr.fileReaders {
+	for id, ar := range mr.fileReaders {
 		if ar.expired(mr.expire) {
 			ar.Close()
-			delete(mr.fileReaders, path)
-			delete(mr.cacheMap, path)
-			mr.meta.RemoveSubMeta(path)
-			paths = append(paths, path)
+			delete(mr.fileReaders, id)
+			delete(mr.cacheMap, ar.realpath)
+			mr.meta.RemoveSubMeta(ar.realpath)
+			if ar.replaced() {
+				// 读取进度属于原来的文件，清除后路径上的新文件从头开始读取
+				mr.doneIDs[id] = true
+				mr.rotated[ar.realpath] = true
+				// 改名后的文件已经读完，记入 done 文件交给 cleaner 清理
+				if moved := ar.movedPath(); moved != "" {
+					inode, err := utilsos.GetIdentifyIDByPath(moved)
+					if err == nil {
+						err = ar.br.Meta.AppendDoneFileInode(moved, inode)
+					}
+					if err != nil {
+						log.Errorf("Runner[%v] append %v to done file error %v", mr.meta.RunnerName, moved, err)
+					}
+				}
+				if err := ar.br.Meta.ResetOffset(); err != nil {
+					log.Errorf("Runner[%v] reset offset of %v error %v", mr.meta.RunnerName, ar.realpath, err)
+				}
+			}
+			paths = append(paths, ar.realpath)
 		}
 	}
 	if len(paths) > 0 {
@@ -345,12 +631,22 @@ func (mr *Reader) Expire() {
 }
 
 func (mr *Reader) SetMode(mode string, value interface{}) (err error) {
+	if mode == reader.ReadModeContinuePattern {
+		cp, err := reader.ContinuePatternMode(mode, value)
+		if err != nil {
+			return fmt.Errorf("%v setmode error %v", mr.Name(), err)
+		}
+		mr.continuePattern = cp
+		mr.headRegexp = nil
+		return nil
+	}
 	reg, err := reader.HeadPatternMode(mode, value)
 	if err != nil {
 		return fmt.Errorf("%v setmode error %v", mr.Name(), err)
 	}
 	if reg != nil {
 		mr.headRegexp = reg
+		mr.continuePattern = nil
 	}
 	return
 }
@@ -367,13 +663,55 @@ func (mr *Reader) sendError(err error) {
 	mr.errChan <- err
 }
 
-func (mr *Reader) StatLogPath() {
-	//达到最大打开文件数，不再追踪
-	if len(mr.fileReaders) >= mr.maxOpenFiles {
-		log.Warnf("Runner[%v] %v meet maxOpenFiles limit %v, ignore Stat new log...", mr.meta.RunnerName, mr.Name(), mr.maxOpenFiles)
-		return
+// evictLRU 关闭最久没有读到数据的 ActiveReader 为新文件腾出位置，只有它最近一次读到数据早于 before 时才关闭，
+// 避免新文件反而不如正在读取的文件活跃时来回切换。关闭前保存读取进度，之后再次追踪时从保存的位置继续读取
+func (mr *Reader) evictLRU(before time.Time) bool {
+	mr.armapmux.Lock()
+	var lruID string
+	var lru *ActiveReader
+	for id, ar := range mr.fileReaders {
+		if lru == nil || ar.lastActiveTime().Before(lru.lastActiveTime()) {
+			lruID, lru = id, ar
+		}
+	}
+	if lru == nil || !lru.lastActiveTime().Before(before) {
+		mr.armapmux.Unlock()
+		return false
+	}
+	lruPath := lru.realpath
+	delete(mr.fileReaders, lruID)
+	mr.meta.RemoveSubMeta(lruPath)
+	mr.armapmux.Unlock()
+
+	if err := lru.Close(); err != nil {
+		log.Errorf("Runner[%v] Close ActiveReader %v error %v", mr.meta.RunnerName, lru.originpath, err)
+	}
+	readcache := lru.SyncMeta()
+	mr.armapmux.Lock()
+	if readcache != "" {
+		mr.cacheMap[lruPath] = readcache
+	} else {
+		delete(mr.cacheMap, lruPath)
+	}
+	mr.armapmux.Unlock()
+	log.Infof("Runner[%v] %v meet maxOpenFiles limit %v, close least recently active logpath %v (last active at %v)",
+		mr.meta.RunnerName, mr.Name(), mr.maxOpenFiles, lruPath, lru.lastActiveTime().Format(time.RFC3339))
+	return true
+}
+
+// fileWhence 返回没有读取记录的文件从哪里开始读取，from_time 模式下 startTime 之后没有修改过的文件只读取新写入的内容
+func (mr *Reader) fileWhence(fi os.FileInfo) string {
+	if mr.whence != reader.WhenceFromTime {
+		return mr.whence
 	}
-	matches, err := filepath.Glob(mr.logPathPattern)
+	if fi.ModTime().Before(mr.startTime) {
+		return reader.WhenceNewest
+	}
+	return reader.WhenceOldest
+}
+
+func (mr *Reader) StatLogPath() {
+	matches, err := utilsos.Glob(mr.logPathPattern)
 	if err != nil {
 		log.Errorf("Runner[%v] stat logPathPattern error %v", mr.meta.RunnerName, err)
 		mr.setStatsError("Runner[" + mr.meta.RunnerName + "] stat logPathPattern error " + err.Error())
@@ -382,7 +720,11 @@ func (mr *Reader) StatLogPath() {
 	if len(matches) > 0 {
 		log.Debugf("Runner[%v] StatLogPath %v find matches: %v", mr.meta.RunnerName, mr.logPathPattern, strings.Join(matches, ", "))
 	}
-	var newaddsPath []string
+	var newaddsPath, skippedPath []string
+	// resolved 记录这次扫描中每个匹配到的路径对应的真实文件，用于发现符号链接指向了新的文件
+	resolved := make(map[string]string, len(matches))
+	// ids 记录这次扫描中匹配到的文件，不再存在的文件从 doneIDs 中删除
+	ids := make(map[string]bool, len(matches))
 	for _, mc := range matches {
 		rp, fi, err := GetRealPath(mc)
 		if err != nil {
@@ -393,11 +735,39 @@ func (mr *Reader) StatLogPath() {
 			log.Debugf("Runner[%v] %v is dir, mode[tailx] only support read file, ignore this match...", mr.meta.RunnerName, mc)
 			continue
 		}
+		if isExcluded(mr.excludes, mc) || isExcluded(mr.excludes, rp) {
+			log.Debugf("Runner[%v] %v is excluded by %v, ignore this match...", mr.meta.RunnerName, mc, reader.KeyLogPathExclude)
+			continue
+		}
+		resolved[mc] = rp
+		id, err := utilsos.GetFileID(rp)
+		if err != nil {
+			log.Errorf("Runner[%v] get file id of %v error %v, ignore this match...", mr.meta.RunnerName, rp, err)
+			continue
+		}
+		ids[id] = true
 		mr.armapmux.Lock()
-		_, ok := mr.fileReaders[rp]
+		cur, ok := mr.fileReaders[id]
+		done := mr.doneIDs[id]
+		prev := mr.readerByPath(rp)
 		mr.armapmux.Unlock()
 		if ok {
-			log.Debugf("Runner[%v] <%v> is collecting, ignore...", mr.meta.RunnerName, rp)
+			if cur.realpath != rp {
+				log.Debugf("Runner[%v] <%v> was renamed to <%v> and is collecting, ignore...", mr.meta.RunnerName, cur.realpath, rp)
+			} else {
+				log.Debugf("Runner[%v] <%v> is collecting, ignore...", mr.meta.RunnerName, rp)
+			}
+			continue
+		}
+		if done {
+			log.Debugf("Runner[%v] <%v> has been read before it was renamed, ignore...", mr.meta.RunnerName, rp)
+			continue
+		}
+		if prev != nil {
+			// 路径上已经是新的文件，原来的文件读完并回收之后再读取新文件，两者使用同一个路径的 meta
+			if prev.markSwitched() {
+				log.Infof("Runner[%v] %v was replaced by a new file, finish reading the old one first", mr.meta.RunnerName, rp)
+			}
 			continue
 		}
 		mr.armapmux.Lock()
@@ -408,7 +778,23 @@ func (mr *Reader) StatLogPath() {
 			log.Debugf("Runner[%v] <%v> is expired, ignore...", mr.meta.RunnerName, mc)
 			continue
 		}
-		ar, err := NewActiveReader(mc, rp, mr.whence, mr.meta, mr.msgChan, mr.errChan)
+		//达到最大打开文件数，关闭最久没有读到数据的文件，没有比新文件更不活跃的文件时不再追踪
+		mr.armapmux.Lock()
+		full := len(mr.fileReaders) >= mr.maxOpenFiles
+		mr.armapmux.Unlock()
+		if full && !mr.evictLRU(fi.ModTime()) {
+			skippedPath = append(skippedPath, rp)
+			continue
+		}
+		whence := mr.fileWhence(fi)
+		mr.armapmux.Lock()
+		rotated := mr.rotated[rp]
+		mr.armapmux.Unlock()
+		if rotated || mr.isSwitchedTarget(mc, rp) {
+			// 轮转后的新文件和符号链接切换到的新文件都是原来文件的延续，从头开始读取
+			whence = reader.WhenceOldest
+		}
+		ar, err := NewActiveReader(mc, rp, whence, mr.meta, mr.msgChan, mr.errChan)
 		if err != nil {
 			err = fmt.Errorf("runner[%v] NewActiveReader for matches %v error %v", mr.meta.RunnerName, rp, err)
 			mr.sendError(err)
@@ -416,12 +802,23 @@ func (mr *Reader) StatLogPath() {
 			continue
 		}
 		ar.readcache = cacheline
+		ar.backoff = mr.backoff
+		if mr.readSpeedLimit > 0 {
+			ar.readLimit = rateio.NewController(mr.readSpeedLimit * 1024)
+		}
+		ar.totalLimit = mr.totalLimit
+		ar.br.SetLineFilter(mr.lineFilter)
+		ar.br.SetDelimiter(mr.delimiter)
+		ar.br.SetMaxLineLength(mr.maxLineLength, mr.maxLineAction)
+		ar.br.SetMultiLineFlush(mr.multiLineTimeout, mr.multiLineMaxLines)
 		if mr.headRegexp != nil {
 			err = ar.br.SetMode(reader.ReadModeHeadPatternRegexp, mr.headRegexp)
-			if err != nil {
-				log.Errorf("Runner[%v] NewActiveReader for matches %v SetMode error %v", mr.meta.RunnerName, rp, err)
-				mr.setStatsError("Runner[" + mr.meta.RunnerName + "] NewActiveReader for matches " + rp + " SetMode error " + err.Error())
-			}
+		} else if mr.continuePattern != nil {
+			err = ar.br.SetMode(reader.ReadModeContinuePattern, mr.continuePattern)
+		}
+		if err != nil {
+			log.Errorf("Runner[%v] NewActiveReader for matches %v SetMode error %v", mr.meta.RunnerName, rp, err)
+			mr.setStatsError("Runner[" + mr.meta.RunnerName + "] NewActiveReader for matches " + rp + " SetMode error " + err.Error())
 		}
 		newaddsPath = append(newaddsPath, rp)
 		mr.armapmux.Lock()
@@ -429,7 +826,8 @@ func (mr *Reader) StatLogPath() {
 			if err = mr.meta.AddSubMeta(rp, ar.br.Meta); err != nil {
 				log.Errorf("Runner[%v] %v add submeta for %v err %v, but this reader will still working", mr.meta.RunnerName, mc, rp, err)
 			}
-			mr.fileReaders[rp] = ar
+			mr.fileReaders[ar.id] = ar
+			delete(mr.rotated, rp)
 		} else {
 			log.Warnf("Runner[%v] %v NewActiveReader but reader was stopped, ignore this...", mr.meta.RunnerName, mc)
 		}
@@ -440,9 +838,62 @@ func (mr *Reader) StatLogPath() {
 			log.Warnf("Runner[%v] %v NewActiveReader but reader was stopped, will not running...", mr.meta.RunnerName, mc)
 		}
 	}
+	mr.switchSymlinks(resolved)
+	mr.armapmux.Lock()
+	for id := range mr.doneIDs {
+		if !ids[id] {
+			delete(mr.doneIDs, id)
+		}
+	}
+	mr.armapmux.Unlock()
 	if len(newaddsPath) > 0 {
 		log.Infof("Runner[%v] StatLogPath find new logpath: %v", mr.meta.RunnerName, strings.Join(newaddsPath, ", "))
 	}
+	if len(skippedPath) > 0 {
+		log.Warnf("Runner[%v] %v meet maxOpenFiles limit %v, ignore new logpath: %v", mr.meta.RunnerName, mr.Name(), mr.maxOpenFiles, strings.Join(skippedPath, ", "))
+	}
+}
+
+// readerByPath 返回从 rp 打开文件的 ActiveReader，调用时需要持有 armapmux
+func (mr *Reader) readerByPath(rp string) *ActiveReader {
+	for _, ar := range mr.fileReaders {
+		if ar.realpath == rp {
+			return ar
+		}
+	}
+	return nil
+}
+
+// isSwitchedTarget 判断 rp 是否是符号链接 mc 新指向的文件，即已经有通过 mc 读取其他文件的 ActiveReader
+func (mr *Reader) isSwitchedTarget(mc, rp string) bool {
+	mr.armapmux.Lock()
+	defer mr.armapmux.Unlock()
+	for _, ar := range mr.fileReaders {
+		if ar.originpath == mc && ar.realpath != rp {
+			return true
+		}
+	}
+	return false
+}
+
+// switchSymlinks 找出通过符号链接读取、而符号链接已经指向其他文件的 ActiveReader，标记为 switched，
+// 它们读到 EOF 后会被 expire 回收。原来的文件如果仍然被 logpath 直接匹配到，就继续按照普通文件追踪
+func (mr *Reader) switchSymlinks(resolved map[string]string) {
+	matched := make(map[string]bool, len(resolved))
+	for _, rp := range resolved {
+		matched[rp] = true
+	}
+	mr.armapmux.Lock()
+	defer mr.armapmux.Unlock()
+	for _, ar := range mr.fileReaders {
+		rp, ok := resolved[ar.originpath]
+		if !ok || rp == ar.realpath || matched[ar.realpath] {
+			continue
+		}
+		if ar.markSwitched() {
+			log.Infof("Runner[%v] %v now links to %v, finish reading %v and then close it", mr.meta.RunnerName, ar.originpath, rp, ar.realpath)
+		}
+	}
 }
 
 func (mr *Reader) getActiveReaders() []*ActiveReader {
@@ -483,6 +934,19 @@ func (mr *Reader) Status() StatsInfo {
 	return mr.stats
 }
 
+// DetailedStatus 返回每个正在读取的文件的读取状态，按照文件路径排序
+func (mr *Reader) DetailedStatus() []reader.FileStatus {
+	ars := mr.getActiveReaders()
+	status := make([]reader.FileStatus, 0, len(ars))
+	for _, ar := range ars {
+		status = append(status, ar.DetailedStatus())
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Path < status[j].Path
+	})
+	return status
+}
+
 func (mr *Reader) Close() (err error) {
 	atomic.StoreInt32(&mr.status, reader.StatusStopped)
 	// 停10ms为了管道中的数据传递完毕，确认reader run函数已经结束不会再读取，保证syncMeta的正确性
@@ -501,6 +965,12 @@ func (mr *Reader) Close() (err error) {
 		}(ar)
 	}
 	wg.Wait()
+	if mr.totalLimit != nil {
+		closeRateLimit(mr.totalLimit)
+	}
+	if mr.watcher != nil {
+		mr.watcher.Close()
+	}
 	//在所有 active readers都关闭后再close msgChan
 	close(mr.msgChan)
 	close(mr.errChan)
@@ -523,17 +993,118 @@ func (mr *Reader) Start() {
 }
 
 func (mr *Reader) run() {
+	var events <-chan *fsnotify.FileEvent
+	var errs <-chan error
+	if mr.watcher != nil {
+		events, errs = mr.watcher.Event, mr.watcher.Error
+	}
 	for {
 		if atomic.LoadInt32(&mr.status) == reader.StatusStopped {
 			log.Warnf("%v stopped from running", mr.Name())
 			return
 		}
 		mr.Expire()
+		mr.watchDirs()
 		mr.StatLogPath()
-		time.Sleep(mr.statInterval)
+		// 有文件系统通知时立即扫描，同时仍然定时扫描，NFS 等收不到通知的情况下与 poll 相同
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			log.Debugf("Runner[%v] %v got file event %v", mr.meta.RunnerName, mr.Name(), ev)
+			drainEvents(events)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Warnf("Runner[%v] %v file watcher error %v", mr.meta.RunnerName, mr.Name(), err)
+		case <-time.After(mr.statInterval):
+		}
 	}
 }
 
+// drainEvents 丢弃 watchEventQuiet 内连续到达的通知，它们会在同一次扫描中处理
+func drainEvents(events <-chan *fsnotify.FileEvent) {
+	timer := time.NewTimer(watchEventQuiet)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			timer.Reset(watchEventQuiet)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// watchDirs 监听所有可能出现匹配文件的目录，即模式串中第一个通配符所在目录的上一级，以及之后每一级匹配到的目录，
+// 新建的目录在收到通知后加入监听，不再存在的目录取消监听
+func (mr *Reader) watchDirs() {
+	if mr.watcher == nil {
+		return
+	}
+	dirs := make(map[string]bool)
+	for _, pattern := range dirPatterns(mr.logPathPattern) {
+		matches, err := utilsos.Glob(pattern)
+		if err != nil {
+			log.Errorf("Runner[%v] glob watch dir %v error %v", mr.meta.RunnerName, pattern, err)
+			continue
+		}
+		for _, mc := range matches {
+			if fi, err := os.Stat(mc); err == nil && fi.IsDir() {
+				dirs[mc] = true
+			}
+		}
+	}
+	for dir := range dirs {
+		if mr.watched[dir] {
+			continue
+		}
+		if err := mr.watcher.WatchFlags(dir, fsnotify.FSN_CREATE|fsnotify.FSN_RENAME); err != nil {
+			log.Warnf("Runner[%v] watch dir %v error %v, new files in it will be found every %v", mr.meta.RunnerName, dir, err, mr.statInterval)
+			continue
+		}
+		mr.watched[dir] = true
+	}
+	for dir := range mr.watched {
+		if !dirs[dir] {
+			// 目录被删除时监听已经自动取消，忽略错误
+			mr.watcher.RemoveWatch(dir)
+			delete(mr.watched, dir)
+		}
+	}
+}
+
+// dirPatterns 返回需要监听的目录模式串，如 /logs/*/app/*.log 返回 /logs、/logs/*、/logs/*/app，
+// 目录中没有通配符时只返回该目录
+func dirPatterns(pattern string) []string {
+	dir := filepath.Dir(pattern)
+	var patterns []string
+	start := 0
+	for i := 0; i <= len(dir); i++ {
+		if i < len(dir) && !os.IsPathSeparator(dir[i]) {
+			continue
+		}
+		if len(patterns) == 0 && strings.ContainsAny(dir[start:i], "*?[") {
+			patterns = append(patterns, filepath.Clean(dir[:start]))
+		}
+		if len(patterns) > 0 && i > start {
+			patterns = append(patterns, dir[:i])
+		}
+		start = i + 1
+	}
+	if len(patterns) == 0 {
+		return []string{dir}
+	}
+	return patterns
+}
+
 func (mr *Reader) ReadLine() (data string, err error) {
 	if !mr.started {
 		mr.Start()
@@ -542,6 +1113,13 @@ func (mr *Reader) ReadLine() (data string, err error) {
 	select {
 	case result := <-mr.msgChan:
 		mr.curFile = result.logpath
+		if mr.dedup != nil && mr.dedup.Duplicate(result.result) {
+			log.Debugf("Runner[%v] %v drop duplicate line %v", mr.meta.RunnerName, result.logpath, result.result)
+			mr.hasCurMeta = false
+			break
+		}
+		mr.curMeta = result.meta
+		mr.hasCurMeta = result.meta.Path != ""
 		data = result.result
 	case err = <-mr.errChan:
 	case <-timer.C:
@@ -550,6 +1128,11 @@ func (mr *Reader) ReadLine() (data string, err error) {
 	return
 }
 
+// SourceMeta 返回最近一次 ReadLine 读到的数据所在的文件和位置
+func (mr *Reader) SourceMeta() (reader.SourceMeta, bool) {
+	return mr.curMeta, mr.hasCurMeta
+}
+
 //SyncMeta 从队列取数据时同步队列，作用在于保证数据不重复。
 func (mr *Reader) SyncMeta() {
 	ars := mr.getActiveReaders()
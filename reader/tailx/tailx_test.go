@@ -4,7 +4,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/qiniu/log"
 
 	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/rateio"
 	"github.com/qiniu/logkit/reader"
 	. "github.com/qiniu/logkit/reader/test"
 	. "github.com/qiniu/logkit/utils/models"
@@ -60,6 +63,26 @@ func Test_ActiveReader(t *testing.T) {
 	ar.Close()
 }
 
+func Test_ActiveReaderEncoding(t *testing.T) {
+	testfile := "Test_ActiveReaderEncoding"
+	CreateDir()
+	meta, err := reader.NewMeta(MetaDir, MetaDir, testfile, reader.ModeDir, "", reader.DefautFileRetention)
+	assert.NoError(t, err)
+	meta.SetEncodingWay("gbk")
+	defer DestroyDir()
+	ppath, err := filepath.Abs(filepath.Join(Dir, testfile))
+	assert.NoError(t, err)
+	CreateFile(ppath, "\xc4\xe3\xba\xc3\n")
+	msgchan := make(chan Result)
+	errChan := make(chan error)
+	ar, err := NewActiveReader(ppath, ppath, reader.WhenceOldest, meta, msgchan, errChan)
+	assert.NoError(t, err)
+	go ar.Run()
+	data := <-msgchan
+	assert.Equal(t, "你好\n", data.result)
+	ar.Close()
+}
+
 func TestStart(t *testing.T) {
 	c := make(chan string)
 
@@ -747,3 +770,398 @@ func TestReaderErrMiddle(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+func TestDirPatterns(t *testing.T) {
+	tests := map[string][]string{
+		"/logs/app/*.log":     {"/logs/app"},
+		"/logs/*/app/*.log":   {"/logs", "/logs/*", "/logs/*/app"},
+		"/logs/svc?/**/a.log": {"/logs", "/logs/svc?", "/logs/svc?/**"},
+		"logs/[ab]/x/y/*.log": {"logs", "logs/[ab]", "logs/[ab]/x", "logs/[ab]/x/y"},
+		"*/a.log":             {".", "*"},
+	}
+	for pattern, exp := range tests {
+		var expPaths []string
+		for _, p := range exp {
+			expPaths = append(expPaths, filepath.FromSlash(p))
+		}
+		assert.Equal(t, expPaths, dirPatterns(filepath.FromSlash(pattern)), pattern)
+	}
+}
+
+func TestStatModeWatch(t *testing.T) {
+	dirname := "TestStatModeWatch"
+	createDirWithName(dirname)
+	defer os.RemoveAll(dirname)
+	logdir := filepath.Join(dirname, "logs")
+	createDirWithName(logdir)
+
+	c := conf.MapConf{
+		"log_path":      filepath.Join(logdir, "*", "*.log"),
+		"meta_path":     filepath.Join(dirname, "meta"),
+		"mode":          reader.ModeTailx,
+		"read_from":     "oldest",
+		"stat_interval": "1h",
+		"stat_mode":     reader.StatModeWatch,
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	mmr, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := mmr.(*Reader)
+	assert.NotNil(t, mr.watcher)
+	defer mr.Close()
+	mr.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	// 扫描间隔为1小时，新建的目录和文件只能通过通知发现
+	svcdir := filepath.Join(logdir, "svc1")
+	createDirWithName(svcdir)
+	time.Sleep(100 * time.Millisecond)
+	createFileWithContent(filepath.Join(svcdir, "a.log"), "abc\n")
+	var data string
+	for i := 0; i < 5 && data == ""; i++ {
+		data, err = mr.ReadLine()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "abc\n", data)
+
+	c["stat_mode"] = "unknown"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+}
+
+func TestReadSpeedLimit(t *testing.T) {
+	dirname := "TestReadSpeedLimit"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":               filepath.Join(dirname, "*.log"),
+		"meta_path":              filepath.Join(dirname, "meta"),
+		"mode":                   reader.ModeTailx,
+		"read_speed_limit":       "20",
+		"read_speed_limit_total": "-1",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+
+	c["read_speed_limit_total"] = "40"
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	tr := r.(*Reader)
+	assert.Equal(t, 20, tr.readSpeedLimit)
+	assert.NotNil(t, tr.totalLimit)
+	defer closeRateLimit(tr.totalLimit)
+
+	// 单个文件 20KB/s，读取 10KB 至少需要等待接近 0.5s
+	ar := &ActiveReader{readLimit: rateio.NewController(20 * 1024), totalLimit: tr.totalLimit}
+	start := time.Now()
+	ar.waitRead(10 * 1024)
+	assert.True(t, time.Since(start) >= 300*time.Millisecond, time.Since(start).String())
+	closeRateLimit(ar.readLimit)
+}
+
+func TestTailxDedup(t *testing.T) {
+	dirname := "TestTailxDedup"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	// 模拟文件改名后被重新匹配，两个文件中的数据相同
+	createFileWithContent(filepath.Join(dirname, "a.log"), "line1\nline2\n")
+	createFileWithContent(filepath.Join(dirname, "b.log"), "line1\nline2\nline3\n")
+	c := conf.MapConf{
+		"log_path":            filepath.Join(dirname, "*.log"),
+		"meta_path":           filepath.Join(dirname, "meta"),
+		"mode":                reader.ModeTailx,
+		"read_from":           reader.WhenceOldest,
+		"stat_interval":       "1s",
+		reader.KeyDedupWindow: "100",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	var lines []string
+	for i := 0; i < 5; i++ {
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	assert.Equal(t, []string{"line1\n", "line2\n", "line3\n"}, lines)
+}
+
+func TestMaxOpenFilesLRU(t *testing.T) {
+	dirname := "TestMaxOpenFilesLRU"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":       filepath.Join(dirname, "*.log"),
+		"meta_path":      filepath.Join(dirname, "meta"),
+		"mode":           reader.ModeTailx,
+		"max_open_files": "1",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := r.(*Reader)
+	defer func() {
+		for _, ar := range mr.getActiveReaders() {
+			ar.Close()
+		}
+	}()
+
+	fa, err := filepath.Abs(filepath.Join(dirname, "a.log"))
+	assert.NoError(t, err)
+	createFileWithContent(fa, "")
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+
+	// 新文件比正在读取的文件更活跃，关闭最久没有读到数据的文件
+	fb, err := filepath.Abs(filepath.Join(dirname, "b.log"))
+	assert.NoError(t, err)
+	createFileWithContent(fb, "")
+	assert.NoError(t, os.Chtimes(fb, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	mr.StatLogPath()
+	ars := mr.getActiveReaders()
+	assert.Len(t, ars, 1)
+	assert.Equal(t, fb, ars[0].realpath)
+
+	// 新文件不如正在读取的文件活跃时不再追踪
+	fc, err := filepath.Abs(filepath.Join(dirname, "c.log"))
+	assert.NoError(t, err)
+	createFileWithContent(fc, "")
+	assert.NoError(t, os.Chtimes(fc, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	mr.StatLogPath()
+	ars = mr.getActiveReaders()
+	assert.Len(t, ars, 1)
+	assert.Equal(t, fb, ars[0].realpath)
+}
+
+func TestWhenceFromTime(t *testing.T) {
+	dirname := "TestWhenceFromTime"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":  filepath.Join(dirname, "*.log"),
+		"meta_path": filepath.Join(dirname, "meta"),
+		"mode":      reader.ModeTailx,
+		"read_from": reader.WhenceFromTime,
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+	c["start_time"] = "abc"
+	_, err = NewReader(meta, c)
+	assert.Error(t, err)
+
+	startTime := time.Now().Add(-time.Hour)
+	c["start_time"] = startTime.Format(time.RFC3339)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := r.(*Reader)
+
+	oldFile := filepath.Join(dirname, "old.log")
+	createFileWithContent(oldFile, "old\n")
+	assert.NoError(t, os.Chtimes(oldFile, startTime.Add(-time.Minute), startTime.Add(-time.Minute)))
+	newFile := filepath.Join(dirname, "new.log")
+	createFileWithContent(newFile, "new\n")
+	for path, exp := range map[string]string{oldFile: reader.WhenceNewest, newFile: reader.WhenceOldest} {
+		fi, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, exp, mr.fileWhence(fi), path)
+	}
+}
+
+func TestDetailedStatus(t *testing.T) {
+	dirname := "TestDetailedStatus"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":  filepath.Join(dirname, "*.log"),
+		"meta_path": filepath.Join(dirname, "meta"),
+		"mode":      reader.ModeTailx,
+		"read_from": reader.WhenceOldest,
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := r.(*Reader)
+	defer func() {
+		for _, ar := range mr.getActiveReaders() {
+			ar.Close()
+		}
+	}()
+
+	fa, err := filepath.Abs(filepath.Join(dirname, "a.log"))
+	assert.NoError(t, err)
+	createFileWithContent(fa, "a1\na2\na3\n")
+	fb, err := filepath.Abs(filepath.Join(dirname, "b.log"))
+	assert.NoError(t, err)
+	createFileWithContent(fb, "")
+	mr.StatLogPath()
+	for i := 0; i < 3; i++ {
+		result := <-mr.msgChan
+		assert.True(t, strings.HasPrefix(result.result, "a"), result.result)
+	}
+
+	status := mr.DetailedStatus()
+	assert.Len(t, status, 2)
+	assert.Equal(t, fa, status[0].RealPath)
+	assert.EqualValues(t, 3, status[0].Lines)
+	assert.EqualValues(t, 9, status[0].Offset)
+	assert.EqualValues(t, 0, status[0].Lag)
+	assert.EqualValues(t, 0, status[0].Errors)
+	assert.False(t, status[0].LastRead.IsZero())
+	assert.Equal(t, fb, status[1].RealPath)
+	assert.EqualValues(t, 0, status[1].Lines)
+	assert.True(t, status[1].LastRead.IsZero())
+}
+
+func TestSymlinkSwitch(t *testing.T) {
+	dirname := "TestSymlinkSwitch"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":         filepath.Join(dirname, "current.log"),
+		"meta_path":        filepath.Join(dirname, "meta"),
+		"mode":             reader.ModeTailx,
+		"read_from":        reader.WhenceNewest,
+		"tailx_eof_sleep":  "50ms",
+		"tailx_idle_sleep": "50ms",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := r.(*Reader)
+	defer func() {
+		for _, ar := range mr.getActiveReaders() {
+			ar.Close()
+		}
+	}()
+	appendFile := func(path, content string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+		assert.NoError(t, err)
+		_, err = f.WriteString(content)
+		assert.NoError(t, err)
+		f.Close()
+	}
+	link := filepath.Join(dirname, "current.log")
+	realDir, err := filepath.Abs(dirname)
+	assert.NoError(t, err)
+	realDir, err = filepath.EvalSymlinks(realDir)
+	assert.NoError(t, err)
+	f1, f2 := filepath.Join(realDir, "app-1.log"), filepath.Join(realDir, "app-2.log")
+
+	appendFile(f1, "a1\n")
+	assert.NoError(t, os.Symlink(f1, link))
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+	appendFile(f1, "a2\n")
+	assert.Equal(t, "a2\n", (<-mr.msgChan).result)
+
+	// 符号链接指向新的文件，新文件从头读取，原来的文件读完后关闭
+	appendFile(f2, "b1\n")
+	assert.NoError(t, os.Remove(link))
+	assert.NoError(t, os.Symlink(f2, link))
+	appendFile(f1, "a3\n")
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 2)
+	got := []string{(<-mr.msgChan).result, (<-mr.msgChan).result}
+	sort.Strings(got)
+	assert.Equal(t, []string{"a3\n", "b1\n"}, got)
+
+	mr.armapmux.Lock()
+	old := mr.readerByPath(f1)
+	mr.armapmux.Unlock()
+	for i := 0; i < 100 && atomic.LoadInt32(&old.drained) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	mr.Expire()
+	ars := mr.getActiveReaders()
+	assert.Len(t, ars, 1)
+	assert.Equal(t, f2, ars[0].realpath)
+}
+
+func TestRenameRotate(t *testing.T) {
+	dirname := "TestRenameRotate"
+	assert.NoError(t, os.Mkdir(dirname, DefaultDirPerm))
+	defer os.RemoveAll(dirname)
+	c := conf.MapConf{
+		"log_path":         filepath.Join(dirname, "app.log*"),
+		"meta_path":        filepath.Join(dirname, "meta"),
+		"mode":             reader.ModeTailx,
+		"read_from":        reader.WhenceNewest,
+		"tailx_eof_sleep":  "50ms",
+		"tailx_idle_sleep": "50ms",
+	}
+	meta, err := reader.NewMetaWithConf(c)
+	assert.NoError(t, err)
+	r, err := NewReader(meta, c)
+	assert.NoError(t, err)
+	mr := r.(*Reader)
+	defer func() {
+		for _, ar := range mr.getActiveReaders() {
+			ar.Close()
+		}
+	}()
+	appendFile := func(path, content string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+		assert.NoError(t, err)
+		_, err = f.WriteString(content)
+		assert.NoError(t, err)
+		f.Close()
+	}
+	current, err := filepath.Abs(filepath.Join(dirname, "app.log"))
+	assert.NoError(t, err)
+	rotated := current + ".1"
+
+	appendFile(current, "a1\n")
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+	appendFile(current, "a2\n")
+	assert.Equal(t, "a2\n", (<-mr.msgChan).result)
+
+	// 改名后的文件仍然被匹配到，由原来的 ActiveReader 继续读取，不会从头再读一遍
+	assert.NoError(t, os.Rename(current, rotated))
+	appendFile(rotated, "a3\n")
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+	assert.Equal(t, "a3\n", (<-mr.msgChan).result)
+
+	// 路径上出现新文件，原来的文件读完后回收，新文件从头开始读取
+	appendFile(current, "b1\n")
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+	mr.armapmux.Lock()
+	old := mr.readerByPath(current)
+	mr.armapmux.Unlock()
+	for i := 0; i < 100 && atomic.LoadInt32(&old.drained) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	mr.Expire()
+	assert.Len(t, mr.getActiveReaders(), 0)
+	mr.StatLogPath()
+	ars := mr.getActiveReaders()
+	if assert.Len(t, ars, 1) {
+		assert.Equal(t, current, ars[0].realpath)
+	}
+	assert.Equal(t, "b1\n", (<-mr.msgChan).result)
+
+	// 读完的旧文件之后再被匹配到也不会重复读取
+	mr.StatLogPath()
+	assert.Len(t, mr.getActiveReaders(), 1)
+	select {
+	case res := <-mr.msgChan:
+		t.Errorf("unexpected line %q from %v", res.result, res.logpath)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,331 @@
+// Package wineventlog 订阅 Windows 事件日志，把每个事件转为一条结构化的数据，读取进度(bookmark)保存在 meta 中，
+// 重启后从上次发送成功的事件之后继续读取
+package wineventlog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// 事件转为数据后的字段
+const (
+	KeyProvider    = "provider_name"
+	KeyEventID     = "event_id"
+	KeyVersion     = "version"
+	KeyLevel       = "level"
+	KeyTask        = "task"
+	KeyOpcode      = "opcode"
+	KeyKeywords    = "keywords"
+	KeyTimeCreated = "time_created"
+	KeyRecordID    = "record_id"
+	KeyProcessID   = "process_id"
+	KeyThreadID    = "thread_id"
+	KeyChannel     = "channel"
+	KeyComputer    = "computer"
+	KeyUserID      = "user_id"
+	KeyEventData   = "event_data"
+	KeyUserData    = "user_data"
+	KeyMessage     = "message"
+)
+
+const (
+	// bookmarkFile 是 meta 中保存 bookmark 的文件名
+	bookmarkFile = "wineventlog.bookmark"
+	// restartInterval 是订阅出错后重新订阅的间隔
+	restartInterval = 3 * time.Second
+)
+
+func init() {
+	reader.RegisterConstructor(reader.ModeWinEventLog, NewReader)
+}
+
+type event struct {
+	data     Data
+	bookmark string
+	size     int64
+}
+
+type Reader struct {
+	meta     *reader.Meta
+	channels []string
+	query    string
+	whence   string
+
+	status   int32
+	readChan chan event
+
+	// readBookmark 是最近一次放入 readChan 的事件的 bookmark，重新订阅时从这里继续
+	readBookmark string
+	// bookmark 是最近一次 ReadData 返回的事件的 bookmark，SyncMeta 时保存
+	bookmark string
+
+	stats     StatsInfo
+	statsLock sync.RWMutex
+}
+
+func NewReader(meta *reader.Meta, c conf.MapConf) (reader.Reader, error) {
+	if err := checkSupported(); err != nil {
+		return nil, err
+	}
+	channels, err := c.GetStringList(reader.KeyWinEventLogChannels)
+	if err != nil {
+		return nil, err
+	}
+	for i := range channels {
+		channels[i] = strings.TrimSpace(channels[i])
+	}
+	query, _ := c.GetStringOr(reader.KeyWinEventLogQuery, "*")
+	whence, _ := c.GetStringOr(reader.KeyWhence, reader.WhenceNewest)
+	if whence != reader.WhenceOldest && whence != reader.WhenceNewest {
+		return nil, fmt.Errorf("%v %v not supported, should be %v or %v", reader.KeyWhence, whence, reader.WhenceOldest, reader.WhenceNewest)
+	}
+	r := &Reader{
+		meta:     meta,
+		channels: channels,
+		query:    query,
+		whence:   whence,
+		status:   reader.StatusInit,
+		readChan: make(chan event, 100),
+	}
+	bookmark, err := meta.ReadValue(bookmarkFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Runner[%v] %v read bookmark error: %v, omit meta data...", meta.RunnerName, r.Name(), err)
+	}
+	r.readBookmark, r.bookmark = string(bookmark), string(bookmark)
+	return r, nil
+}
+
+func (r *Reader) Name() string {
+	return "WinEventLogReader<" + strings.Join(r.channels, ",") + ">"
+}
+
+func (r *Reader) Source() string {
+	return "wineventlog://" + strings.Join(r.channels, ",")
+}
+
+func (r *Reader) SetMode(mode string, v interface{}) error {
+	return errors.New("WinEventLogReader not support readmode")
+}
+
+func (r *Reader) ReadLine() (string, error) {
+	return "", errors.New("method ReadLine is not supported, please use ReadData")
+}
+
+func (r *Reader) Start() {
+	if !atomic.CompareAndSwapInt32(&r.status, reader.StatusInit, reader.StatusRunning) {
+		return
+	}
+	go r.run()
+	log.Infof("Runner[%v] %v started", r.meta.RunnerName, r.Name())
+}
+
+func (r *Reader) run() {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		if err := r.subscribe(); err != nil {
+			log.Errorf("Runner[%v] %v subscribe error: %v, retry after %v", r.meta.RunnerName, r.Name(), err, restartInterval)
+			r.setStatsError(err.Error())
+		}
+		if atomic.LoadInt32(&r.status) != reader.StatusRunning {
+			return
+		}
+		time.Sleep(restartInterval)
+	}
+}
+
+// queryList 返回订阅所有 channel 的结构化查询，每个 channel 使用相同的 XPath 过滤条件
+func (r *Reader) queryList() string {
+	var b bytes.Buffer
+	b.WriteString(`<QueryList><Query Id="0">`)
+	for _, ch := range r.channels {
+		b.WriteString(`<Select Path="`)
+		xml.EscapeText(&b, []byte(ch))
+		b.WriteString(`">`)
+		xml.EscapeText(&b, []byte(r.query))
+		b.WriteString(`</Select>`)
+	}
+	b.WriteString(`</Query></QueryList>`)
+	return b.String()
+}
+
+// put 在 reader 运行时一直等待 readChan 有空位，reader 关闭后返回 false
+func (r *Reader) put(e event) bool {
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		select {
+		case r.readChan <- e:
+			if e.bookmark != "" {
+				r.readBookmark = e.bookmark
+			}
+			return true
+		case <-time.After(time.Second):
+		}
+	}
+	return false
+}
+
+func (r *Reader) ReadData() (Data, int64, error) {
+	if atomic.LoadInt32(&r.status) == reader.StatusInit {
+		r.Start()
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case e := <-r.readChan:
+		if e.bookmark != "" {
+			r.bookmark = e.bookmark
+		}
+		return e.data, e.size, nil
+	case <-timer.C:
+	}
+	return nil, 0, nil
+}
+
+// SyncMeta 保存最近一次返回的事件的 bookmark，runner 在数据发送成功后调用
+func (r *Reader) SyncMeta() {
+	if r.bookmark == "" {
+		return
+	}
+	if err := r.meta.WriteValue(bookmarkFile, []byte(r.bookmark)); err != nil {
+		log.Errorf("Runner[%v] %v SyncMeta error %v", r.meta.RunnerName, r.Name(), err)
+	}
+}
+
+func (r *Reader) setStatsError(err string) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	r.stats.LastError = err
+}
+
+func (r *Reader) Status() StatsInfo {
+	r.statsLock.RLock()
+	defer r.statsLock.RUnlock()
+	return r.stats
+}
+
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.status, reader.StatusStopped)
+	return nil
+}
+
+// xmlEvent 是 EvtRender 输出的事件 XML
+type xmlEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     string `xml:"EventID"`
+		Version     string `xml:"Version"`
+		Level       string `xml:"Level"`
+		Task        string `xml:"Task"`
+		Opcode      string `xml:"Opcode"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID string `xml:"EventRecordID"`
+		Execution     struct {
+			ProcessID string `xml:"ProcessID,attr"`
+			ThreadID  string `xml:"ThreadID,attr"`
+		} `xml:"Execution"`
+		Channel  string `xml:"Channel"`
+		Computer string `xml:"Computer"`
+		Security struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+	EventData struct {
+		Data []xmlData `xml:"Data"`
+	} `xml:"EventData"`
+	UserData struct {
+		Inner struct {
+			Fields []xmlField `xml:",any"`
+		} `xml:",any"`
+	} `xml:"UserData"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+type xmlData struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlField struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// parseEvent 把事件 XML 转为数据，数字类型的字段转为整数，EventData 中没有名字的字段按照顺序命名为 param1、param2...
+func parseEvent(x []byte) (Data, error) {
+	var ev xmlEvent
+	if err := xml.Unmarshal(x, &ev); err != nil {
+		return nil, err
+	}
+	sys := ev.System
+	data := Data{
+		KeyProvider:    sys.Provider.Name,
+		KeyTimeCreated: sys.TimeCreated.SystemTime,
+		KeyChannel:     sys.Channel,
+		KeyComputer:    sys.Computer,
+	}
+	ints := []struct {
+		key   string
+		value string
+	}{
+		{KeyEventID, sys.EventID},
+		{KeyVersion, sys.Version},
+		{KeyLevel, sys.Level},
+		{KeyTask, sys.Task},
+		{KeyOpcode, sys.Opcode},
+		{KeyRecordID, sys.EventRecordID},
+		{KeyProcessID, sys.Execution.ProcessID},
+		{KeyThreadID, sys.Execution.ThreadID},
+	}
+	for _, i := range ints {
+		if v, err := strconv.ParseInt(strings.TrimSpace(i.value), 10, 64); err == nil {
+			data[i.key] = v
+		}
+	}
+	if sys.Keywords != "" {
+		data[KeyKeywords] = sys.Keywords
+	}
+	if sys.Security.UserID != "" {
+		data[KeyUserID] = sys.Security.UserID
+	}
+	if len(ev.EventData.Data) > 0 {
+		eventData := make(map[string]interface{}, len(ev.EventData.Data))
+		for i, d := range ev.EventData.Data {
+			name := d.Name
+			if name == "" {
+				name = "param" + strconv.Itoa(i+1)
+			}
+			eventData[name] = d.Value
+		}
+		data[KeyEventData] = eventData
+	}
+	if fields := ev.UserData.Inner.Fields; len(fields) > 0 {
+		userData := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			userData[f.XMLName.Local] = f.Value
+		}
+		data[KeyUserData] = userData
+	}
+	if msg := strings.TrimSpace(ev.RenderingInfo.Message); msg != "" {
+		data[KeyMessage] = msg
+	}
+	return data, nil
+}
@@ -0,0 +1,13 @@
+// +build !windows
+
+package wineventlog
+
+import "errors"
+
+func checkSupported() error {
+	return errors.New("windows event log reader is only supported on windows")
+}
+
+func (r *Reader) subscribe() error {
+	return checkSupported()
+}
@@ -0,0 +1,114 @@
+package wineventlog
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestParseEvent(t *testing.T) {
+	x := `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'>
+  <System>
+    <Provider Name='Microsoft-Windows-Security-Auditing' Guid='{54849625-5478-4994-A5BA-3E3B0328C30D}'/>
+    <EventID>4624</EventID>
+    <Version>2</Version>
+    <Level>0</Level>
+    <Task>12544</Task>
+    <Opcode>0</Opcode>
+    <Keywords>0x8020000000000000</Keywords>
+    <TimeCreated SystemTime='2018-06-01T08:00:00.123456700Z'/>
+    <EventRecordID>97531</EventRecordID>
+    <Correlation/>
+    <Execution ProcessID='620' ThreadID='4520'/>
+    <Channel>Security</Channel>
+    <Computer>WIN-SERVER</Computer>
+    <Security/>
+  </System>
+  <EventData>
+    <Data Name='SubjectUserName'>WIN-SERVER$</Data>
+    <Data Name='LogonType'>5</Data>
+    <Data>unnamed</Data>
+  </EventData>
+  <RenderingInfo Culture='en-US'>
+    <Message>An account was successfully logged on.</Message>
+  </RenderingInfo>
+</Event>`
+	data, err := parseEvent([]byte(x))
+	assert.NoError(t, err)
+	assert.Equal(t, Data{
+		KeyProvider:    "Microsoft-Windows-Security-Auditing",
+		KeyEventID:     int64(4624),
+		KeyVersion:     int64(2),
+		KeyLevel:       int64(0),
+		KeyTask:        int64(12544),
+		KeyOpcode:      int64(0),
+		KeyKeywords:    "0x8020000000000000",
+		KeyTimeCreated: "2018-06-01T08:00:00.123456700Z",
+		KeyRecordID:    int64(97531),
+		KeyProcessID:   int64(620),
+		KeyThreadID:    int64(4520),
+		KeyChannel:     "Security",
+		KeyComputer:    "WIN-SERVER",
+		KeyEventData: map[string]interface{}{
+			"SubjectUserName": "WIN-SERVER$",
+			"LogonType":       "5",
+			"param3":          "unnamed",
+		},
+		KeyMessage: "An account was successfully logged on.",
+	}, data)
+
+	x = `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'>
+  <System>
+    <Provider Name='Microsoft-Windows-Eventlog'/>
+    <EventID>1102</EventID>
+    <EventRecordID>1</EventRecordID>
+    <Channel>Security</Channel>
+    <Computer>WIN-SERVER</Computer>
+    <Security UserID='S-1-5-18'/>
+  </System>
+  <UserData>
+    <LogFileCleared xmlns='http://manifests.microsoft.com/win/2004/08/windows/eventlog'>
+      <SubjectUserName>admin</SubjectUserName>
+      <SubjectDomainName>WORKGROUP</SubjectDomainName>
+    </LogFileCleared>
+  </UserData>
+</Event>`
+	data, err = parseEvent([]byte(x))
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-5-18", data[KeyUserID])
+	assert.Equal(t, int64(1102), data[KeyEventID])
+	assert.Equal(t, map[string]interface{}{
+		"SubjectUserName":   "admin",
+		"SubjectDomainName": "WORKGROUP",
+	}, data[KeyUserData])
+
+	_, err = parseEvent([]byte("<Event>"))
+	assert.Error(t, err)
+}
+
+func TestQueryList(t *testing.T) {
+	r := &Reader{
+		channels: []string{"Application", "Microsoft-Windows-PowerShell/Operational"},
+		query:    "*[System[(Level=1 or Level=2)]]",
+	}
+	assert.Equal(t, `<QueryList><Query Id="0">`+
+		`<Select Path="Application">*[System[(Level=1 or Level=2)]]</Select>`+
+		`<Select Path="Microsoft-Windows-PowerShell/Operational">*[System[(Level=1 or Level=2)]]</Select>`+
+		`</Query></QueryList>`, r.queryList())
+
+	r = &Reader{channels: []string{"Security"}, query: "*[EventData[Data[@Name='LogonType']>2]]"}
+	assert.Equal(t, `<QueryList><Query Id="0"><Select Path="Security">*[EventData[Data[@Name=&#39;LogonType&#39;]&gt;2]]</Select></Query></QueryList>`, r.queryList())
+}
+
+func TestNewReaderNotSupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows event log is supported on windows")
+	}
+	_, err := NewReader(&reader.Meta{}, conf.MapConf{reader.KeyWinEventLogChannels: "Application"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,209 @@
+// +build windows
+
+package wineventlog
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/qiniu/log"
+
+	"github.com/qiniu/logkit/reader"
+)
+
+var (
+	modwevtapi = windows.NewLazySystemDLL("wevtapi.dll")
+
+	procEvtSubscribe             = modwevtapi.NewProc("EvtSubscribe")
+	procEvtNext                  = modwevtapi.NewProc("EvtNext")
+	procEvtRender                = modwevtapi.NewProc("EvtRender")
+	procEvtClose                 = modwevtapi.NewProc("EvtClose")
+	procEvtCreateBookmark        = modwevtapi.NewProc("EvtCreateBookmark")
+	procEvtUpdateBookmark        = modwevtapi.NewProc("EvtUpdateBookmark")
+	procEvtOpenPublisherMetadata = modwevtapi.NewProc("EvtOpenPublisherMetadata")
+	procEvtFormatMessage         = modwevtapi.NewProc("EvtFormatMessage")
+)
+
+type evtHandle uintptr
+
+const (
+	evtSubscribeToFutureEvents      = 1
+	evtSubscribeStartAtOldestRecord = 2
+	evtSubscribeStartAfterBookmark  = 3
+
+	evtRenderEventXml = 1
+	evtRenderBookmark = 2
+
+	evtFormatMessageXml = 9
+
+	errorNoMoreItems = syscall.Errno(259)
+
+	// eventBatchSize 是每次 EvtNext 最多取出的事件数
+	eventBatchSize = 100
+	// waitTimeout 是等待新事件的超时时间(毫秒)，超时后检查 reader 是否已经关闭
+	waitTimeout = 1000
+)
+
+func checkSupported() error {
+	return modwevtapi.Load()
+}
+
+func evtClose(h evtHandle) {
+	if h != 0 {
+		procEvtClose.Call(uintptr(h))
+	}
+}
+
+// evtRender 把事件或者 bookmark 渲染为 XML
+func evtRender(h evtHandle, flags uint32) (string, error) {
+	buf := make([]uint16, 4096)
+	for {
+		var used, count uint32
+		r, _, err := procEvtRender.Call(0, uintptr(h), uintptr(flags), uintptr(len(buf)*2),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&count)))
+		if r != 0 {
+			return windows.UTF16ToString(buf[:used/2]), nil
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return "", fmt.Errorf("EvtRender: %v", err)
+		}
+		buf = make([]uint16, used/2+1)
+	}
+}
+
+// formatMessage 返回包含 RenderingInfo(事件的描述信息)的 XML，失败时返回空字符串
+func (r *Reader) formatMessage(publishers map[string]evtHandle, provider string, h evtHandle) string {
+	pm, ok := publishers[provider]
+	if !ok {
+		name, err := windows.UTF16PtrFromString(provider)
+		if err != nil {
+			return ""
+		}
+		ret, _, _ := procEvtOpenPublisherMetadata.Call(0, uintptr(unsafe.Pointer(name)), 0, 0, 0)
+		pm = evtHandle(ret)
+		// 打开失败也记录下来，避免每个事件都重试
+		publishers[provider] = pm
+	}
+	if pm == 0 {
+		return ""
+	}
+	buf := make([]uint16, 4096)
+	for {
+		var used uint32
+		ret, _, err := procEvtFormatMessage.Call(uintptr(pm), uintptr(h), 0, 0, 0, evtFormatMessageXml,
+			uintptr(len(buf)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)))
+		if ret != 0 {
+			return windows.UTF16ToString(buf[:used])
+		}
+		if err != windows.ERROR_INSUFFICIENT_BUFFER {
+			return ""
+		}
+		buf = make([]uint16, used+1)
+	}
+}
+
+// subscribe 订阅所有 channel 的事件并放入 readChan，直到出错或者 reader 被关闭
+func (r *Reader) subscribe() error {
+	signal, err := windows.CreateEvent(nil, 0, 1, nil)
+	if err != nil {
+		return fmt.Errorf("CreateEvent: %v", err)
+	}
+	defer windows.CloseHandle(signal)
+
+	var bookmarkXML *uint16
+	flags := uintptr(evtSubscribeToFutureEvents)
+	if r.whence == reader.WhenceOldest {
+		flags = evtSubscribeStartAtOldestRecord
+	}
+	if r.readBookmark != "" {
+		if bookmarkXML, err = windows.UTF16PtrFromString(r.readBookmark); err != nil {
+			return err
+		}
+		flags = evtSubscribeStartAfterBookmark
+	}
+	ret, _, err := procEvtCreateBookmark.Call(uintptr(unsafe.Pointer(bookmarkXML)))
+	bookmark := evtHandle(ret)
+	if bookmark == 0 {
+		return fmt.Errorf("EvtCreateBookmark: %v", err)
+	}
+	defer evtClose(bookmark)
+	subBookmark := bookmark
+	if flags != evtSubscribeStartAfterBookmark {
+		subBookmark = 0
+	}
+
+	query, err := windows.UTF16PtrFromString(r.queryList())
+	if err != nil {
+		return err
+	}
+	ret, _, err = procEvtSubscribe.Call(0, uintptr(signal), 0, uintptr(unsafe.Pointer(query)), uintptr(subBookmark), 0, 0, flags)
+	sub := evtHandle(ret)
+	if sub == 0 {
+		return fmt.Errorf("EvtSubscribe %v: %v", r.queryList(), err)
+	}
+	defer evtClose(sub)
+
+	publishers := make(map[string]evtHandle)
+	defer func() {
+		for _, pm := range publishers {
+			evtClose(pm)
+		}
+	}()
+
+	events := make([]evtHandle, eventBatchSize)
+	for atomic.LoadInt32(&r.status) == reader.StatusRunning {
+		var returned uint32
+		ret, _, err := procEvtNext.Call(uintptr(sub), eventBatchSize, uintptr(unsafe.Pointer(&events[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+		if ret == 0 {
+			if err != errorNoMoreItems {
+				return fmt.Errorf("EvtNext: %v", err)
+			}
+			windows.WaitForSingleObject(signal, waitTimeout)
+			continue
+		}
+		for i := 0; i < int(returned); i++ {
+			ok := r.handleEvent(publishers, bookmark, events[i])
+			evtClose(events[i])
+			if !ok {
+				for _, h := range events[i+1 : returned] {
+					evtClose(h)
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// handleEvent 渲染一个事件并放入 readChan，reader 关闭后返回 false
+func (r *Reader) handleEvent(publishers map[string]evtHandle, bookmark, h evtHandle) bool {
+	x, err := evtRender(h, evtRenderEventXml)
+	if err != nil {
+		log.Warnf("Runner[%v] %v render event error %v, ignore it...", r.meta.RunnerName, r.Name(), err)
+		return true
+	}
+	data, err := parseEvent([]byte(x))
+	if err != nil {
+		log.Warnf("Runner[%v] %v parse event error %v, ignore it...", r.meta.RunnerName, r.Name(), err)
+		return true
+	}
+	if provider, _ := data[KeyProvider].(string); provider != "" {
+		if full := r.formatMessage(publishers, provider, h); full != "" {
+			if withMessage, err := parseEvent([]byte(full)); err == nil && withMessage[KeyMessage] != nil {
+				data[KeyMessage] = withMessage[KeyMessage]
+			}
+		}
+	}
+	var bookmarkXML string
+	if ret, _, _ := procEvtUpdateBookmark.Call(uintptr(bookmark), uintptr(h)); ret != 0 {
+		bookmarkXML, err = evtRender(bookmark, evtRenderBookmark)
+		if err != nil {
+			log.Warnf("Runner[%v] %v render bookmark error %v", r.meta.RunnerName, r.Name(), err)
+		}
+	}
+	return r.put(event{data: data, bookmark: bookmarkXML, size: int64(len(x))})
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+const (
+	TypeKMS = "kms"
+
+	KeyKMSRegion       = "region"     // KMS 所在的 region, 默认使用环境变量 AWS_REGION
+	KeyKMSAccessKey    = "access_key" // access_key 和 secret_key 都不填时使用 aws-sdk 默认的凭证链, 即环境变量、~/.aws/credentials 以及 EC2 实例角色
+	KeyKMSSecretKey    = "secret_key"
+	KeyKMSSessionToken = "session_token" // 临时凭证的 token
+	KeyKMSEndpoint     = "endpoint"      // 自定义的 KMS 地址, 默认为 https://kms.<region>.amazonaws.com
+	KeyKMSTimeout      = "timeout"       // 请求超时时间, 如 10s
+
+	kmsServiceName    = "kms"
+	kmsDecryptTarget  = "TrentService.Decrypt"
+	defaultKMSTimeout = 10 * time.Second
+)
+
+func init() {
+	RegisterConstructor(TypeKMS, NewKMSProvider)
+}
+
+// KMSProvider 调用 AWS KMS 的 Decrypt 接口解密密钥, path 为 base64 编码的密文,
+// 即 aws kms encrypt 输出的 CiphertextBlob, 如 secret:kms:AQICAHh...
+type KMSProvider struct {
+	region   string
+	endpoint string
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func NewKMSProvider(c conf.MapConf) (Provider, error) {
+	region, _ := c.GetStringOr(KeyKMSRegion, os.Getenv("AWS_REGION"))
+	if region == "" {
+		return nil, errors.New("kms region is empty, please set region or AWS_REGION")
+	}
+	endpoint, _ := c.GetStringOr(KeyKMSEndpoint, "https://kms."+region+".amazonaws.com")
+	accessKey, _ := c.GetStringOr(KeyKMSAccessKey, "")
+	secretKey, _ := c.GetStringOr(KeyKMSSecretKey, "")
+	sessionToken, _ := c.GetStringOr(KeyKMSSessionToken, "")
+	timeoutStr, _ := c.GetStringOr(KeyKMSTimeout, "")
+	timeout := defaultKMSTimeout
+	if timeoutStr != "" {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+			return nil, fmt.Errorf("invalid kms timeout %v: %v", timeoutStr, err)
+		}
+	}
+
+	var creds *credentials.Credentials
+	if accessKey != "" || secretKey != "" {
+		creds = credentials.NewStaticCredentials(accessKey, secretKey, sessionToken)
+	} else {
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+		if err != nil {
+			return nil, fmt.Errorf("create aws session error %v", err)
+		}
+		creds = sess.Config.Credentials
+	}
+	return &KMSProvider{
+		region:   region,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		signer:   v4.NewSigner(creds),
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (k *KMSProvider) Get(path string) (string, error) {
+	blob := strings.TrimSpace(path)
+	if _, err := base64.StdEncoding.DecodeString(blob); err != nil {
+		return "", fmt.Errorf("kms ciphertext should be base64 encoded: %v", err)
+	}
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": blob})
+	if err != nil {
+		return "", err
+	}
+	reader := bytes.NewReader(body)
+	req, err := http.NewRequest(http.MethodPost, k.endpoint+"/", reader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Amz-Target", kmsDecryptTarget)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	if _, err = k.signer.Sign(req, reader, kmsServiceName, k.region, time.Now()); err != nil {
+		return "", fmt.Errorf("sign kms request error %v", err)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("kms returns status %v: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var ret struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err = json.Unmarshal(respBody, &ret); err != nil {
+		return "", fmt.Errorf("unmarshal kms response error %v", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(ret.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("decode kms plaintext error %v", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+// RefPrefix 是密钥引用的前缀, 引用的格式为 secret:<provider>:<path>
+// 如 "pandora_sk":"secret:vault:secret/data/logkit#pandora_sk"
+const RefPrefix = "secret:"
+
+// KeyProviderType 指定 provider 的类型, 不填时与 provider 的名字相同
+const KeyProviderType = "type"
+
+// Provider 从外部的密钥管理服务(如 Vault、KMS)中获取密钥
+type Provider interface {
+	// Get 获取 path 对应的密钥, path 的格式由各个 provider 自行定义
+	Get(path string) (string, error)
+}
+
+var (
+	constructorsMux sync.RWMutex
+	constructors    = map[string]func(conf.MapConf) (Provider, error){}
+)
+
+// RegisterConstructor 注册一种 provider 的构造函数, 各种云厂商的 KMS 可以通过这种方式接入
+func RegisterConstructor(typ string, c func(conf.MapConf) (Provider, error)) {
+	constructorsMux.Lock()
+	defer constructorsMux.Unlock()
+	constructors[typ] = c
+}
+
+func getConstructor(typ string) (func(conf.MapConf) (Provider, error), bool) {
+	constructorsMux.RLock()
+	defer constructorsMux.RUnlock()
+	c, ok := constructors[typ]
+	return c, ok
+}
+
+// Registry 管理所有配置的 provider, 未配置但已注册的 provider 类型会使用默认配置按需创建
+type Registry struct {
+	mux       sync.Mutex
+	providers map[string]Provider
+}
+
+// NewRegistry 根据配置创建 provider, key 为 provider 的名字
+func NewRegistry(cfgs map[string]conf.MapConf) (*Registry, error) {
+	r := &Registry{
+		providers: make(map[string]Provider),
+	}
+	for name, c := range cfgs {
+		typ, _ := c.GetStringOr(KeyProviderType, name)
+		constructor, ok := getConstructor(typ)
+		if !ok {
+			return nil, fmt.Errorf("secrets provider type %v is not supported", typ)
+		}
+		p, err := constructor(c)
+		if err != nil {
+			return nil, fmt.Errorf("create secrets provider %v error %v", name, err)
+		}
+		r.providers[name] = p
+	}
+	return r, nil
+}
+
+func (r *Registry) getProvider(name string) (Provider, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if p, ok := r.providers[name]; ok {
+		return p, nil
+	}
+	constructor, ok := getConstructor(name)
+	if !ok {
+		return nil, fmt.Errorf("secrets provider %v is not configured", name)
+	}
+	p, err := constructor(conf.MapConf{})
+	if err != nil {
+		return nil, fmt.Errorf("create secrets provider %v error %v", name, err)
+	}
+	r.providers[name] = p
+	return p, nil
+}
+
+// IsRef 判断一个配置值是否为密钥引用
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Resolve 解析密钥引用, 不是引用时原样返回
+func (r *Registry) Resolve(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	ref := strings.TrimPrefix(value, RefPrefix)
+	idx := strings.Index(ref, ":")
+	if idx <= 0 || idx == len(ref)-1 {
+		return "", fmt.Errorf("invalid secret reference %q, should be like secret:<provider>:<path>", value)
+	}
+	p, err := r.getProvider(ref[:idx])
+	if err != nil {
+		return "", err
+	}
+	secret, err := p.Get(ref[idx+1:])
+	if err != nil {
+		return "", fmt.Errorf("get secret %v error %v", ref, err)
+	}
+	return secret, nil
+}
+
+// ResolveConf 返回一个解析了所有密钥引用的新 MapConf, 同时返回被解析的 key
+func (r *Registry) ResolveConf(c conf.MapConf) (conf.MapConf, []string, error) {
+	var keys []string
+	for k, v := range c {
+		if IsRef(v) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return c, nil, nil
+	}
+	ret := make(conf.MapConf, len(c))
+	for k, v := range c {
+		ret[k] = v
+	}
+	for _, k := range keys {
+		secret, err := r.Resolve(c[k])
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolve config %v error %v", k, err)
+		}
+		ret[k] = secret
+	}
+	return ret, keys, nil
+}
@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/logkit":
+			w.Write([]byte(`{"data":{"data":{"ak":"myak","sk":"mysk"},"metadata":{"version":1}}}`))
+		case "/v1/kv/logkit":
+			w.Write([]byte(`{"data":{"value":"v1secret","port":3306}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	r, err := NewRegistry(map[string]conf.MapConf{
+		"vault":  {KeyVaultAddress: server.URL, KeyVaultToken: "root"},
+		"noauth": {KeyProviderType: TypeVault, KeyVaultAddress: server.URL},
+	})
+	assert.NoError(t, err)
+
+	value, err := r.Resolve("secret:vault:secret/data/logkit#sk")
+	assert.NoError(t, err)
+	assert.Equal(t, "mysk", value)
+	value, err = r.Resolve("secret:vault:kv/logkit")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1secret", value)
+	value, err = r.Resolve("secret:vault:kv/logkit#port")
+	assert.NoError(t, err)
+	assert.Equal(t, "3306", value)
+	value, err = r.Resolve("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", value)
+
+	_, err = r.Resolve("secret:vault:secret/data/logkit#notexist")
+	assert.Error(t, err)
+	_, err = r.Resolve("secret:noauth:kv/logkit")
+	assert.Error(t, err)
+	_, err = r.Resolve("secret:unknown:kv/logkit")
+	assert.Error(t, err)
+	_, err = r.Resolve("secret:vault")
+	assert.Error(t, err)
+
+	c := conf.MapConf{"ak": "secret:vault:secret/data/logkit#ak", "name": "sender"}
+	resolved, keys, err := r.ResolveConf(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ak"}, keys)
+	assert.Equal(t, conf.MapConf{"ak": "myak", "name": "sender"}, resolved)
+	assert.Equal(t, "secret:vault:secret/data/logkit#ak", c["ak"])
+
+	_, err = NewRegistry(map[string]conf.MapConf{"unknown": {}})
+	assert.Error(t, err)
+}
+
+func TestKMSProvider(t *testing.T) {
+	ciphertext := base64.StdEncoding.EncodeToString([]byte("encrypted pandora sk"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=myak/") || !strings.Contains(auth, "/us-east-1/kms/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"__type":"UnrecognizedClientException"}`))
+			return
+		}
+		assert.Equal(t, "TrentService.Decrypt", r.Header.Get("X-Amz-Target"))
+		var req struct {
+			CiphertextBlob string
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.CiphertextBlob != ciphertext {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"InvalidCiphertextException"}`))
+			return
+		}
+		w.Write([]byte(`{"KeyId":"arn:aws:kms:us-east-1:123:key/abc","Plaintext":"` + base64.StdEncoding.EncodeToString([]byte("mysk")) + `"}`))
+	}))
+	defer server.Close()
+
+	r, err := NewRegistry(map[string]conf.MapConf{
+		"kms":     {KeyKMSRegion: "us-east-1", KeyKMSEndpoint: server.URL, KeyKMSAccessKey: "myak", KeyKMSSecretKey: "mysk"},
+		"wrongak": {KeyProviderType: TypeKMS, KeyKMSRegion: "us-east-1", KeyKMSEndpoint: server.URL, KeyKMSAccessKey: "other", KeyKMSSecretKey: "mysk"},
+	})
+	assert.NoError(t, err)
+
+	value, err := r.Resolve("secret:kms:" + ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "mysk", value)
+
+	_, err = r.Resolve("secret:kms:" + base64.StdEncoding.EncodeToString([]byte("other")))
+	assert.Error(t, err)
+	_, err = r.Resolve("secret:kms:not base64")
+	assert.Error(t, err)
+	_, err = r.Resolve("secret:wrongak:" + ciphertext)
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qiniu/logkit/conf"
+)
+
+const (
+	TypeVault = "vault"
+
+	KeyVaultAddress   = "address"    // Vault 的地址, 默认使用环境变量 VAULT_ADDR
+	KeyVaultToken     = "token"      // 访问 Vault 的 token, 默认使用环境变量 VAULT_TOKEN
+	KeyVaultTokenFile = "token_file" // 从文件中读取 token, 方便配合 Vault agent 使用
+	KeyVaultNamespace = "namespace"  // Vault 企业版的 namespace
+	KeyVaultTimeout   = "timeout"    // 请求超时时间, 如 10s
+
+	defaultVaultField   = "value"
+	defaultVaultTimeout = 10 * time.Second
+)
+
+func init() {
+	RegisterConstructor(TypeVault, NewVaultProvider)
+}
+
+// VaultProvider 通过 HTTP API 从 HashiCorp Vault 中读取密钥, 同时支持 kv v1 和 kv v2
+// path 的格式为 <secret path>#<field>, 如 secret/data/logkit#pandora_sk, field 默认为 value
+type VaultProvider struct {
+	address   string
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+func NewVaultProvider(c conf.MapConf) (Provider, error) {
+	address, _ := c.GetStringOr(KeyVaultAddress, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return nil, errors.New("vault address is empty, please set address or VAULT_ADDR")
+	}
+	token, _ := c.GetStringOr(KeyVaultToken, os.Getenv("VAULT_TOKEN"))
+	tokenFile, _ := c.GetStringOr(KeyVaultTokenFile, "")
+	namespace, _ := c.GetStringOr(KeyVaultNamespace, os.Getenv("VAULT_NAMESPACE"))
+	timeoutStr, _ := c.GetStringOr(KeyVaultTimeout, "")
+	timeout := defaultVaultTimeout
+	if timeoutStr != "" {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+			return nil, fmt.Errorf("invalid vault timeout %v: %v", timeoutStr, err)
+		}
+	}
+	return &VaultProvider{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		tokenFile: tokenFile,
+		namespace: namespace,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (v *VaultProvider) getToken() (string, error) {
+	if v.tokenFile == "" {
+		return v.token, nil
+	}
+	// token 可能会被 Vault agent 轮转, 每次都重新读取
+	data, err := ioutil.ReadFile(v.tokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (v *VaultProvider) Get(path string) (string, error) {
+	field := defaultVaultField
+	if idx := strings.LastIndex(path, "#"); idx >= 0 {
+		path, field = path[:idx], path[idx+1:]
+	}
+	token, err := v.getToken()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, v.address+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returns status %v: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var ret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &ret); err != nil {
+		return "", fmt.Errorf("unmarshal vault response error %v", err)
+	}
+	data := ret.Data
+	// kv v2 的数据在 data.data 中, 同时带有 data.metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok {
+			data = inner
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %v not found in vault secret %v", field, path)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprint(value), nil
+}
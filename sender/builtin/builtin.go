@@ -7,6 +7,7 @@ import (
 	_ "github.com/qiniu/logkit/sender/http"
 	_ "github.com/qiniu/logkit/sender/influxdb"
 	_ "github.com/qiniu/logkit/sender/kafka"
+	_ "github.com/qiniu/logkit/sender/loopback"
 	_ "github.com/qiniu/logkit/sender/mock"
 	_ "github.com/qiniu/logkit/sender/mongodb"
 	_ "github.com/qiniu/logkit/sender/pandora"
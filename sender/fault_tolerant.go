@@ -51,6 +51,7 @@ type FtSender struct {
 type FtOption struct {
 	saveLogPath       string
 	syncEvery         int64
+	syncInterval      time.Duration
 	writeLimit        int
 	strategy          string
 	procs             int
@@ -69,6 +70,10 @@ func NewFtSender(ftSender Sender, conf conf.MapConf, ftSaveLogPath string) (*FtS
 	memoryChannelSize, _ := conf.GetIntOr(KeyFtMemoryChannelSize, 100)
 	logPath, _ := conf.GetStringOr(KeyFtSaveLogPath, ftSaveLogPath)
 	syncEvery, _ := conf.GetIntOr(KeyFtSyncEvery, DefaultFtSyncEvery)
+	syncInterval, _ := conf.GetIntOr(KeyFtSyncInterval, DefaultFtSyncInterval)
+	if syncInterval <= 0 {
+		syncInterval = DefaultFtSyncInterval
+	}
 	writeLimit, _ := conf.GetIntOr(KeyFtWriteLimit, defaultWriteLimit)
 	strategy, _ := conf.GetStringOr(KeyFtStrategy, KeyFtStrategyBackupOnly)
 	longDataDiscard, _ := conf.GetBoolOr(KeyFtLongDataDiscard, false)
@@ -83,6 +88,7 @@ func NewFtSender(ftSender Sender, conf conf.MapConf, ftSaveLogPath string) (*FtS
 	opt := &FtOption{
 		saveLogPath:       logPath,
 		syncEvery:         int64(syncEvery),
+		syncInterval:      time.Duration(syncInterval) * time.Millisecond,
 		writeLimit:        writeLimit,
 		strategy:          strategy,
 		procs:             procs,
@@ -103,11 +109,11 @@ func newFtSender(innerSender Sender, runnerName string, opt *FtOption) (*FtSende
 	if opt.strategy == KeyFtStrategyConcurrent {
 		lq = queue.NewDirectQueue("stream" + directSuffix)
 	} else if !opt.memoryChannel {
-		lq = queue.NewDiskQueue("stream"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, time.Second*2, opt.writeLimit*mb, false, 0)
+		lq = queue.NewDiskQueue("stream"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, opt.syncInterval, opt.writeLimit*mb, false, 0)
 	} else {
-		lq = queue.NewDiskQueue("stream"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, time.Second*2, opt.writeLimit*mb, true, opt.memoryChannelSize)
+		lq = queue.NewDiskQueue("stream"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, opt.syncInterval, opt.writeLimit*mb, true, opt.memoryChannelSize)
 	}
-	bq = queue.NewDiskQueue("backup"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, time.Second*2, opt.writeLimit*mb, false, 0)
+	bq = queue.NewDiskQueue("backup"+qNameSuffix, opt.saveLogPath, maxBytesPerFile, 0, maxBytesPerFile, opt.syncEvery, opt.syncEvery, opt.syncInterval, opt.writeLimit*mb, false, 0)
 	ftSender := FtSender{
 		exitChan:    make(chan struct{}),
 		innerSender: innerSender,
@@ -212,6 +218,33 @@ func (ft *FtSender) Close() error {
 	return ft.innerSender.Close()
 }
 
+// Drain 等待队列中尚未发送的数据发送完毕，不等待磁盘队列时只关心内存队列
+func (ft *FtSender) Drain(timeout time.Duration, drainDisk bool) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := ft.pendingDepth(drainDisk)
+		if pending <= 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("Runner[%v] Sender[%v] drain timeout, %v batches are still in queue", ft.runnerName, ft.Name(), pending)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (ft *FtSender) pendingDepth(drainDisk bool) int64 {
+	if drainDisk {
+		return ft.logQueue.Depth() + ft.BackupQueue.Depth()
+	}
+	if mq, ok := ft.logQueue.(interface {
+		MemoryDepth() int64
+	}); ok {
+		return mq.MemoryDepth()
+	}
+	return 0
+}
+
 func (ft *FtSender) TokenRefresh(mapConf conf.MapConf) (err error) {
 	if tokenSender, ok := ft.innerSender.(TokenRefreshable); ok {
 		err = tokenSender.TokenRefresh(mapConf)
@@ -286,6 +286,40 @@ func TestFtSenderConcurrent(t *testing.T) {
 	assert.Equal(t, len(datas)*100, len(ms.Datas))
 }
 
+func TestFtSenderDrain(t *testing.T) {
+	s, err := mock.NewSender(conf.MapConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("ft-drain-test-%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	mp := conf.MapConf{}
+	mp[sender.KeyFtSaveLogPath] = tmpDir
+	mp[sender.KeyFtStrategy] = sender.KeyFtStrategyAlwaysSave
+	mp[sender.KeyFtMemoryChannel] = "true"
+	fts, err := sender.NewFtSender(s, mp, tmpDir)
+	assert.NoError(t, err)
+	datas := []Data{
+		{"ab": "ababab"},
+	}
+	for i := 0; i < 10; i++ {
+		err = fts.Send(datas)
+		se, ok := err.(*StatsError)
+		if !ok {
+			t.Fatal("ft send return error should .(*SendError)")
+		}
+		assert.NoError(t, se.ErrorDetail)
+	}
+	assert.NoError(t, fts.Drain(10*time.Second, true))
+	assert.Equal(t, int64(0), fts.BackupQueue.Depth())
+	fts.Close()
+	ms := s.(*mock.Sender)
+	assert.Equal(t, 10, ms.SendCount())
+}
+
 func BenchmarkFtSenderConcurrentDirect(b *testing.B) {
 	c := conf.MapConf{}
 	c[sender.KeyFtStrategy] = sender.KeyFtStrategyConcurrent
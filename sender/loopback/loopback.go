@@ -0,0 +1,42 @@
+package loopback
+
+import (
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader/loopback"
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+// Sender 把数据发送给同一个 logkit 中 loopback_name 相同的 loopback reader
+type Sender struct {
+	name         string
+	loopbackName string
+}
+
+func init() {
+	sender.RegisterConstructor(sender.TypeLoopback, NewSender)
+}
+
+func NewSender(c conf.MapConf) (sender.Sender, error) {
+	loopbackName, err := c.GetString(sender.KeyLoopbackName)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := c.GetStringOr(sender.KeyName, "loopbackSender:"+loopbackName)
+	return &Sender{
+		name:         name,
+		loopbackName: loopbackName,
+	}, nil
+}
+
+func (s *Sender) Name() string {
+	return s.name
+}
+
+func (s *Sender) Send(datas []Data) error {
+	return loopback.Publish(s.loopbackName, datas)
+}
+
+func (s *Sender) Close() error {
+	return nil
+}
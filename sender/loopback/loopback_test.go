@@ -0,0 +1,43 @@
+package loopback
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/logkit/conf"
+	"github.com/qiniu/logkit/reader"
+	"github.com/qiniu/logkit/reader/loopback"
+	"github.com/qiniu/logkit/sender"
+	. "github.com/qiniu/logkit/utils/models"
+)
+
+func TestLoopbackSender(t *testing.T) {
+	_, err := NewSender(conf.MapConf{})
+	assert.Error(t, err)
+	s, err := NewSender(conf.MapConf{sender.KeyLoopbackName: "TestLoopbackSender"})
+	assert.NoError(t, err)
+	assert.Equal(t, "loopbackSender:TestLoopbackSender", s.Name())
+	// 下游 runner 还没有启动
+	assert.Error(t, s.Send([]Data{{"a": 1}}))
+
+	meta, err := reader.NewMetaWithConf(conf.MapConf{
+		reader.KeyMetaPath: "./meta",
+		reader.KeyMode:     reader.ModeLoopback,
+		KeyRunnerName:      "TestLoopbackSender",
+	})
+	assert.NoError(t, err)
+	defer os.RemoveAll("./meta")
+	rd, err := loopback.NewReader(meta, conf.MapConf{reader.KeyLoopbackName: "TestLoopbackSender"})
+	assert.NoError(t, err)
+	defer rd.Close()
+	r := rd.(*loopback.Reader)
+	r.Start()
+
+	assert.NoError(t, s.Send([]Data{{"a": 1}}))
+	d, _, err := r.ReadData()
+	assert.NoError(t, err)
+	assert.Equal(t, Data{"a": 1}, d)
+	assert.NoError(t, s.Close())
+}
@@ -14,6 +14,7 @@ var ModeUsages = []KeyValue{
 	{TypeElastic, "发送至 Elasticsearch 服务"},
 	{TypeKafka, "发送至 Kafka 服务"},
 	{TypeHttp, "发送至 HTTP 服务器"},
+	{TypeLoopback, "发送至 同一个 logkit 中的其他 runner(loopback)"},
 }
 
 var (
@@ -843,4 +844,22 @@ var ModeKeyOptions = map[string][]Option{
 		OptionFtMemoryChannelSize,
 		OptionKeyFtLongDataDiscard,
 	},
+	TypeLoopback: {
+		{
+			KeyName:      KeyLoopbackName,
+			ChooseOnly:   false,
+			Default:      "",
+			Required:     true,
+			DefaultNoUse: true,
+			Description:  "loopback 名称(loopback_name)",
+			ToolTip:      "数据会发送给所有 loopback_name 相同的 loopback reader",
+		},
+		OptionSaveLogPath,
+		OptionFtWriteLimit,
+		OptionFtStrategy,
+		OptionFtProcs,
+		OptionFtMemoryChannel,
+		OptionFtMemoryChannelSize,
+		OptionKeyFtLongDataDiscard,
+	},
 }
@@ -3,6 +3,7 @@ package sender
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/qiniu/logkit/conf"
 	. "github.com/qiniu/logkit/utils/models"
@@ -83,6 +84,7 @@ const (
 	TypeElastic           = "elasticsearch" // elastic
 	TypeKafka             = "kafka"         // kafka
 	TypeHttp              = "http"          // http sender
+	TypeLoopback          = "loopback"      // 发送给同一个 logkit 中的 loopback reader
 
 	InnerUserAgent = "_useragent"
 )
@@ -119,6 +121,7 @@ const (
 	// fault_tolerant
 	// 可选参数 fault_tolerant 为true的话，以下必填
 	KeyFtSyncEvery         = "ft_sync_every"    // 该参数设置多少次写入会同步一次offset log
+	KeyFtSyncInterval      = "ft_sync_interval" // 有写入时最多间隔多少毫秒同步一次，与 ft_sync_every 先满足的一个生效
 	KeyFtSaveLogPath       = "ft_save_log_path" // disk queue 数据日志路径
 	KeyFtWriteLimit        = "ft_write_limit"   // 写入速度限制，单位MB
 	KeyFtStrategy          = "ft_strategy"      // ft 的策略
@@ -137,6 +140,8 @@ const (
 
 	// Ft sender默认同步一次meta信息的数据次数
 	DefaultFtSyncEvery = 10
+	// Ft sender默认同步一次meta信息的间隔，单位毫秒
+	DefaultFtSyncInterval = 2000
 
 	// file
 	// 可选参数 当sender_type 为file 的时候
@@ -149,6 +154,9 @@ const (
 	KeyHttpSenderCsvHead  = "http_sender_csv_head"
 	KeyHttpSenderCsvSplit = "http_sender_csv_split"
 
+	// loopback
+	KeyLoopbackName = "loopback_name"
+
 	// Influxdb sender 的可配置字段
 	KeyInfluxdbHost               = "influxdb_host"
 	KeyInfluxdbDB                 = "influxdb_db"
@@ -272,6 +280,12 @@ type TokenRefreshable interface {
 	TokenRefresh(conf.MapConf) error
 }
 
+// Drainable 表示 sender 在关闭之前可以等待缓存的数据发送完毕
+type Drainable interface {
+	// Drain 等待内存队列中的数据发送完毕，drainDisk 为 true 时还会等待磁盘队列，超时返回错误
+	Drain(timeout time.Duration, drainDisk bool) error
+}
+
 func ConvertDatas(ins []map[string]interface{}) []Data {
 	var datas []Data
 	for _, v := range ins {
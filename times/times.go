@@ -3,6 +3,7 @@ package times
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -40,6 +41,15 @@ var layouts = []string{
 	time.StampMilli,
 	time.StampMicro,
 	time.StampNano,
+
+	// Apache CLF 以及 Java 程序(SimpleDateFormat、log4j、Tomcat)中常见的格式，
+	// 秒后面的毫秒、微秒(包括 log4j 的 ",SSS")在解析时会自动识别
+	"02/Jan/2006:15:04:05",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"02-Jan-2006 15:04:05",
+	"Jan 2, 2006 3:04:05 PM",
 }
 
 // AddLayout 可以增加用户自定义的时间类型
@@ -101,15 +111,120 @@ func GetTimeZone() (zoneName, zoneValue string) {
 	return
 }
 
+// LoadLocation 解析时区配置，支持 IANA 时区名称(如 Asia/Shanghai)、UTC、Local，
+// 以及 +8、-0700、+08:00 这样的固定偏移，name 为空时返回 nil
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	if name[0] != '+' && name[0] != '-' {
+		return time.LoadLocation(name)
+	}
+	offset := strings.Replace(name[1:], ":", "", 1)
+	if _, err := strconv.Atoi(offset); err != nil {
+		return nil, fmt.Errorf("invalid timezone offset %v", name)
+	}
+	var hour, minute int
+	switch len(offset) {
+	case 1, 2:
+		hour, _ = strconv.Atoi(offset)
+	case 4:
+		hour, _ = strconv.Atoi(offset[:2])
+		minute, _ = strconv.Atoi(offset[2:])
+	default:
+		return nil, fmt.Errorf("invalid timezone offset %v", name)
+	}
+	if hour > 14 || minute > 59 {
+		return nil, fmt.Errorf("invalid timezone offset %v", name)
+	}
+	seconds := hour*3600 + minute*60
+	if name[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone(name, seconds), nil
+}
+
+// UnixToTime 根据位数判断 unix 时间戳的精度，10 位为秒，13 位为毫秒，16 位为微秒，19 位为纳秒，
+// 其他位数同样按照与 10 位的差值换算，不会丢失纳秒精度
+func UnixToTime(ts int64) time.Time {
+	abs := ts
+	if abs < 0 {
+		abs = -abs
+	}
+	digits := len(strconv.FormatInt(abs, 10))
+	if digits <= 10 {
+		for i := digits; i < 10; i++ {
+			ts *= 10
+		}
+		return time.Unix(ts, 0)
+	}
+	div := int64(1)
+	for i := 10; i < digits; i++ {
+		div *= 10
+	}
+	nsec := ts % div
+	for i := digits; i < 19; i++ {
+		nsec *= 10
+	}
+	return time.Unix(ts/div, nsec)
+}
+
+// parseEpoch 识别字符串形式的 unix 时间戳，只接受 10、13、16、19 位的整数，
+// 以及 "1523878855.123" 这样带小数的秒，避免把 20180416 这样的日期当作时间戳
+func parseEpoch(value string) (time.Time, bool) {
+	sec, frac := value, ""
+	if idx := strings.IndexByte(value, '.'); idx >= 0 {
+		sec, frac = value[:idx], value[idx+1:]
+		if len(sec) != 10 || len(frac) == 0 || len(frac) > 9 {
+			return time.Time{}, false
+		}
+	} else {
+		switch len(value) {
+		case 10, 13, 16, 19:
+		default:
+			return time.Time{}, false
+		}
+	}
+	for _, s := range []string{sec, frac} {
+		for i := 0; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return time.Time{}, false
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if frac == "" {
+		return UnixToTime(ts), true
+	}
+	nsec, _ := strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+	return time.Unix(ts, nsec), true
+}
+
+// StrToTime 解析时间字符串，没有时区信息的时间按照 UTC 处理
 func StrToTime(value string) (time.Time, error) {
+	return StrToTimeInLocation(value, nil)
+}
+
+// StrToTimeInLocation 与 StrToTime 相同，但是没有时区信息的时间按照 loc 处理，loc 为 nil 时使用 UTC
+func StrToTimeInLocation(value string, loc *time.Location) (time.Time, error) {
 	if value == "" {
 		return time.Now(), errors.New("empty time string")
 	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	if t, ok := parseEpoch(value); ok {
+		return t, nil
+	}
 
 	var t time.Time
 	var err error
 	for _, layout := range layouts {
-		t, err = time.Parse(layout, value)
+		t, err = time.ParseInLocation(layout, value, loc)
 		if err == nil {
 			return t, nil
 		}
@@ -119,6 +119,139 @@ func TestAddLayout(t *testing.T) {
 
 }
 
+func TestStrToTimeEpoch(t *testing.T) {
+	tests := []struct {
+		value string
+		exp   time.Time
+	}{
+		{"1523878855", time.Unix(1523878855, 0)},
+		{"1523878855123", time.Unix(1523878855, 123000000)},
+		{"1523878855123456", time.Unix(1523878855, 123456000)},
+		{"1523878855123456789", time.Unix(1523878855, 123456789)},
+		{"1523878855.5", time.Unix(1523878855, 500000000)},
+		{"1523878855.000000001", time.Unix(1523878855, 1)},
+	}
+	for _, ti := range tests {
+		tm, err := StrToTime(ti.value)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !tm.Equal(ti.exp) {
+			t.Errorf("%v: (expected) %v != %v (actual)", ti.value, ti.exp, tm)
+		}
+	}
+	// 不是时间戳的数字不应该被当作时间戳
+	for _, value := range []string{"20180416", "152387885512", "1523878855.", "15238788a5"} {
+		if _, err := StrToTime(value); err == nil {
+			t.Errorf("%v should not be parsed", value)
+		}
+	}
+}
+
+func TestStrToTimeLayouts(t *testing.T) {
+	tests := []struct {
+		value string
+		exp   time.Time
+	}{
+		{"2018-04-16T19:40:55.123456789+08:00", time.Date(2018, 4, 16, 11, 40, 55, 123456789, time.UTC)},
+		{"16/Apr/2018:19:40:55 +0800", time.Date(2018, 4, 16, 11, 40, 55, 0, time.UTC)},
+		{"16/Apr/2018:19:40:55.123 +0800", time.Date(2018, 4, 16, 11, 40, 55, 123000000, time.UTC)},
+		{"16/Apr/2018:19:40:55", time.Date(2018, 4, 16, 19, 40, 55, 0, time.UTC)},
+		{"2018-04-16 19:40:55,123", time.Date(2018, 4, 16, 19, 40, 55, 123000000, time.UTC)},
+		{"2018-04-16T19:40:55.123+0800", time.Date(2018, 4, 16, 11, 40, 55, 123000000, time.UTC)},
+		{"2018-04-16T19:40:55.123", time.Date(2018, 4, 16, 19, 40, 55, 123000000, time.UTC)},
+		{"16-Apr-2018 19:40:55.123", time.Date(2018, 4, 16, 19, 40, 55, 123000000, time.UTC)},
+		{"Apr 16, 2018 7:40:55 PM", time.Date(2018, 4, 16, 19, 40, 55, 0, time.UTC)},
+		{"Mon Apr 16 19:40:55 UTC 2018", time.Date(2018, 4, 16, 19, 40, 55, 0, time.UTC)},
+	}
+	for _, ti := range tests {
+		tm, err := StrToTime(ti.value)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !tm.Equal(ti.exp) {
+			t.Errorf("%v: (expected) %v != %v (actual)", ti.value, ti.exp, tm)
+		}
+	}
+}
+
+func TestStrToTimeInLocation(t *testing.T) {
+	loc, err := LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 夏令时和非夏令时的偏移量不同
+	tm, err := StrToTimeInLocation("2018-07-01 12:00:00.5", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := time.Date(2018, 7, 1, 16, 0, 0, 500000000, time.UTC); !tm.Equal(exp) {
+		t.Errorf("(expected) %v != %v (actual)", exp, tm)
+	}
+	tm, err = StrToTimeInLocation("2018-01-01 12:00:00", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := time.Date(2018, 1, 1, 17, 0, 0, 0, time.UTC); !tm.Equal(exp) {
+		t.Errorf("(expected) %v != %v (actual)", exp, tm)
+	}
+	// 带有时区信息的时间不受影响
+	tm, err = StrToTimeInLocation("2018-01-01T12:00:00Z", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC); !tm.Equal(exp) {
+		t.Errorf("(expected) %v != %v (actual)", exp, tm)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+	}{
+		{"UTC", 0},
+		{"Asia/Shanghai", 8 * 3600},
+		{"+8", 8 * 3600},
+		{"-0700", -7 * 3600},
+		{"+05:30", 5*3600 + 30*60},
+	}
+	for _, ti := range tests {
+		loc, err := LoadLocation(ti.name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, offset := time.Date(2018, 1, 1, 0, 0, 0, 0, loc).Zone()
+		if offset != ti.offset {
+			t.Errorf("%v: (expected) %v != %v (actual)", ti.name, ti.offset, offset)
+		}
+	}
+	loc, err := LoadLocation("")
+	if err != nil || loc != nil {
+		t.Errorf("empty timezone should return nil location, got %v %v", loc, err)
+	}
+	for _, name := range []string{"Mars/Olympus", "+8a", "+123", "+15"} {
+		if _, err := LoadLocation(name); err == nil {
+			t.Errorf("%v should be invalid", name)
+		}
+	}
+}
+
+func TestUnixToTime(t *testing.T) {
+	if tm := UnixToTime(1525422699); !tm.Equal(time.Unix(1525422699, 0)) {
+		t.Errorf("unexpected %v", tm)
+	}
+	if tm := UnixToTime(152542269); !tm.Equal(time.Unix(1525422690, 0)) {
+		t.Errorf("unexpected %v", tm)
+	}
+	if tm := UnixToTime(15254226991234567); !tm.Equal(time.Unix(1525422699, 123456700)) {
+		t.Errorf("unexpected %v", tm)
+	}
+}
+
 func a1() map[string]interface{} {
 	x := map[string]interface{}{
 		"a": 1,
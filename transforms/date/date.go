@@ -3,7 +3,9 @@ package date
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/qiniu/logkit/times"
 	"github.com/qiniu/logkit/transforms"
 	. "github.com/qiniu/logkit/utils/models"
 )
@@ -13,7 +15,14 @@ type DateTrans struct {
 	Offset       int    `json:"offset"`
 	LayoutBefore string `json:"time_layout_before"`
 	LayoutAfter  string `json:"time_layout_after"`
+	Timezone     string `json:"timezone"`
 	stats        StatsInfo
+	location     *time.Location
+}
+
+func (g *DateTrans) Init() (err error) {
+	g.location, err = times.LoadLocation(g.Timezone)
+	return
 }
 
 func (g *DateTrans) RawTransform(datas []string) ([]string, error) {
@@ -31,7 +40,7 @@ func (g *DateTrans) Transform(datas []Data) ([]Data, error) {
 			err = fmt.Errorf("transform key %v not exist in data", g.Key)
 			continue
 		}
-		val, err = ConvertDate(g.LayoutBefore, g.LayoutAfter, g.Offset, val)
+		val, err = ConvertDateInLocation(g.LayoutBefore, g.LayoutAfter, g.Offset, g.location, val)
 		if err != nil {
 			errnums++
 			continue
@@ -62,7 +71,8 @@ func (g *DateTrans) SampleConfig() string {
 		"key":"DateFieldKey",
 		"offset":0,
 		"time_layout_before":"",
-		"time_layout_after":"2006-01-02T15:04:05Z07:00"
+		"time_layout_after":"2006-01-02T15:04:05Z07:00",
+		"timezone":""
 	}`
 }
 
@@ -86,6 +96,16 @@ func (it *DateTrans) ConfigOptions() []Option {
 			Description:  "期望时间样式(不填默认rfc3339)(time_layout_after)",
 			Type:         transforms.TransformTypeString,
 		},
+		{
+			KeyName:      "timezone",
+			ChooseOnly:   false,
+			Default:      "",
+			DefaultNoUse: false,
+			Description:  "时区，如Asia/Shanghai(timezone)",
+			Advance:      true,
+			ToolTip:      "不带时区信息的时间按照该时区解析，输出的时间也转换到该时区，支持 IANA 时区名称以及 +08:00 这样的固定偏移",
+			Type:         transforms.TransformTypeString,
+		},
 	}
 }
 
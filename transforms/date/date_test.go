@@ -97,3 +97,24 @@ func TestDateTransformer(t *testing.T) {
 
 	fmt.Println(time.Now().Format(time.RFC3339), time.Now().Unix())
 }
+
+func TestDateTransformerTimezone(t *testing.T) {
+	tis := &DateTrans{
+		Key:      "k",
+		Timezone: "Asia/Shanghai",
+	}
+	assert.NoError(t, tis.Init())
+	datas := []Data{
+		{"k": "2018-04-16 19:40:55.123456789"},
+		{"k": "2018-04-16T11:40:55Z"},
+		{"k": int64(1523878855123456789)},
+	}
+	datas, err := tis.Transform(datas)
+	assert.NoError(t, err)
+	assert.Equal(t, "2018-04-16T19:40:55.123456789+08:00", datas[0]["k"])
+	assert.Equal(t, "2018-04-16T19:40:55+08:00", datas[1]["k"])
+	assert.Equal(t, "2018-04-16T19:40:55.123456789+08:00", datas[2]["k"])
+
+	tis = &DateTrans{Key: "k", Timezone: "Mars/Olympus"}
+	assert.Error(t, tis.Init())
+}
@@ -0,0 +1,300 @@
+// Package logger 为 qiniu/log 输出的日志提供按模块设置级别和 JSON 格式输出的能力
+//
+// qiniu/log 的全局级别会被设置为所有模块中最低的级别，每条日志输出时再根据其所在的模块过滤，
+// 因此无需修改散落在各处的 log 调用即可单独调整某个模块的日志级别
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/log"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	modulePrefix = "github.com/qiniu/logkit/"
+	rootModule   = "logkit"
+	headerLayout = "2006/01/02 15:04:05"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "panic", "fatal"}
+
+var (
+	// 2018/01/02 15:04:05 [reqid][INFO][github.com/qiniu/logkit/mgr] runner.go:123: message
+	headerPattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) (?:\[([^\]]*)\])?\[(DEBUG|INFO|WARN|ERROR|PANIC|FATAL)\]\[([^\]]*)\] (\S+:\d+): `)
+	runnerPattern = regexp.MustCompile(`Runner\[([^\]]+)\]`)
+)
+
+// Levels 描述日志的默认级别以及各个模块、各个 runner 单独设置的级别, 模块为 logkit 下的包路径, 如 mgr, reader/tailx,
+// runner 的级别对消息中带有 Runner[name] 的日志生效, 优先于模块的级别
+type Levels struct {
+	Default string            `json:"default"`
+	Modules map[string]string `json:"modules,omitempty"`
+	Runners map[string]string `json:"runners,omitempty"`
+}
+
+// Entry 是 JSON 格式输出的一条日志
+type Entry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Module  string `json:"module"`
+	File    string `json:"file"`
+	Runner  string `json:"runner,omitempty"`
+	ReqID   string `json:"reqid,omitempty"`
+	Message string `json:"message"`
+
+	level int
+}
+
+type writer struct {
+	mutex        sync.RWMutex
+	out          io.Writer
+	format       string
+	defaultLevel int
+	modules      map[string]int
+	runners      map[string]int
+	// event 额外接收 eventLevel 及以上级别的日志, 如 Windows 服务模式下的事件日志
+	event      io.Writer
+	eventLevel int
+}
+
+var std = &writer{
+	out:          os.Stderr,
+	format:       FormatText,
+	defaultLevel: log.Linfo,
+	modules:      make(map[string]int),
+}
+
+// Init 接管 qiniu/log 的输出, level 为默认级别, modules 为各模块的级别
+func Init(level int, format string, modules map[string]string) error {
+	if err := SetFormat(format); err != nil {
+		return err
+	}
+	levels := Levels{Default: LevelName(level), Modules: modules}
+	if err := SetLevels(levels); err != nil {
+		return err
+	}
+	log.SetOutput(std)
+	return nil
+}
+
+// SetOutput 设置日志最终写入的位置, 用于替代 log.SetOutput, 没有调用 Init 时同样会接管 qiniu/log 的输出
+func SetOutput(out io.Writer) {
+	std.mutex.Lock()
+	std.out = out
+	w := std
+	std.mutex.Unlock()
+	log.SetOutput(w)
+}
+
+// SetEventOutput 设置额外接收 level 及以上级别日志的输出, 日志始终以文本格式写入, out 为 nil 时关闭
+func SetEventOutput(out io.Writer, level int) {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	std.event = out
+	std.eventLevel = level
+}
+
+// SetFormat 设置日志的输出格式, 支持 text 和 json, 为空时使用 text
+func SetFormat(format string) error {
+	switch format {
+	case "":
+		format = FormatText
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("log format %v is not supported, should be %v or %v", format, FormatText, FormatJSON)
+	}
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	std.format = format
+	return nil
+}
+
+// ParseLevel 将 debug/info/warn/error 或者对应的数字 0-3 转换为 qiniu/log 的级别
+func ParseLevel(level string) (int, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	for i, name := range levelNames {
+		if level == name {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(level); err == nil && i >= log.Ldebug && i <= log.Lfatal {
+		return i, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q, should be one of %v", level, strings.Join(levelNames, ","))
+}
+
+// LevelName 返回级别的名字
+func LevelName(level int) string {
+	if level < 0 || level >= len(levelNames) {
+		return strconv.Itoa(level)
+	}
+	return levelNames[level]
+}
+
+// SetLevels 替换默认级别和所有模块的级别, Default 为空时保持默认级别不变
+func SetLevels(levels Levels) error {
+	std.mutex.RLock()
+	defaultLevel := std.defaultLevel
+	std.mutex.RUnlock()
+	if levels.Default != "" {
+		var err error
+		if defaultLevel, err = ParseLevel(levels.Default); err != nil {
+			return err
+		}
+	}
+	modules := make(map[string]int, len(levels.Modules))
+	for module, level := range levels.Modules {
+		lvl, err := ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("module %v: %v", module, err)
+		}
+		modules[strings.Trim(module, "/")] = lvl
+	}
+	runners := make(map[string]int, len(levels.Runners))
+	for runner, level := range levels.Runners {
+		lvl, err := ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("runner %v: %v", runner, err)
+		}
+		runners[runner] = lvl
+	}
+
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	std.defaultLevel = defaultLevel
+	std.modules = modules
+	std.runners = runners
+	std.applyLevel()
+	return nil
+}
+
+// GetLevels 返回当前的日志级别设置
+func GetLevels() Levels {
+	std.mutex.RLock()
+	defer std.mutex.RUnlock()
+	levels := Levels{
+		Default: LevelName(std.defaultLevel),
+		Modules: make(map[string]string, len(std.modules)),
+	}
+	for module, level := range std.modules {
+		levels.Modules[module] = LevelName(level)
+	}
+	if len(std.runners) > 0 {
+		levels.Runners = make(map[string]string, len(std.runners))
+		for runner, level := range std.runners {
+			levels.Runners[runner] = LevelName(level)
+		}
+	}
+	return levels
+}
+
+// applyLevel 把 qiniu/log 的全局级别设置为所有级别中最低的一个, 调用方需持有锁
+func (w *writer) applyLevel() {
+	min := w.defaultLevel
+	for _, level := range w.modules {
+		if level < min {
+			min = level
+		}
+	}
+	for _, level := range w.runners {
+		if level < min {
+			min = level
+		}
+	}
+	log.SetOutputLevel(min)
+}
+
+// levelOf 返回一条日志的级别阈值, runner 的设置优先, 子模块继承父模块的设置, 调用方需持有锁
+func (w *writer) levelOf(module, runner string) int {
+	if level, ok := w.runners[runner]; ok && runner != "" {
+		return level
+	}
+	level, matched := w.defaultLevel, -1
+	for m, lvl := range w.modules {
+		if (module == m || strings.HasPrefix(module, m+"/")) && len(m) > matched {
+			level, matched = lvl, len(m)
+		}
+	}
+	return level
+}
+
+// plain 在没有模块和 runner 级别、没有事件输出并且是文本格式时返回 true, 这时 qiniu/log 的全局级别已经完成了过滤,
+// 日志可以原样输出, 不需要解析日志头, 调用方需持有锁
+func (w *writer) plain() bool {
+	return len(w.modules) == 0 && len(w.runners) == 0 && w.event == nil && w.format != FormatJSON
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.plain() {
+		return w.out.Write(p)
+	}
+	entry, ok := parseEntry(p)
+	if !ok {
+		return w.out.Write(p)
+	}
+	if entry.level < w.levelOf(entry.Module, entry.Runner) {
+		return len(p), nil
+	}
+	if w.event != nil && entry.level >= w.eventLevel {
+		w.event.Write(p)
+	}
+	if w.format != FormatJSON {
+		return w.out.Write(p)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return w.out.Write(p)
+	}
+	if _, err = w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// parseEntry 解析 qiniu/log 以默认格式输出的一条日志
+func parseEntry(p []byte) (entry Entry, ok bool) {
+	m := headerPattern.FindSubmatchIndex(p)
+	if m == nil {
+		return entry, false
+	}
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return string(p[m[2*i]:m[2*i+1]])
+	}
+	entry.Time = group(1)
+	if t, err := time.ParseInLocation(headerLayout, entry.Time, time.Local); err == nil {
+		entry.Time = t.Format(time.RFC3339)
+	}
+	entry.ReqID = group(2)
+	entry.level, _ = ParseLevel(group(3))
+	entry.Level = LevelName(entry.level)
+	entry.Module = normalizeModule(group(4))
+	entry.File = group(5)
+	entry.Message = strings.TrimRight(string(p[m[1]:]), "\n")
+	if rm := runnerPattern.FindStringSubmatch(entry.Message); rm != nil {
+		entry.Runner = rm[1]
+	}
+	return entry, true
+}
+
+func normalizeModule(module string) string {
+	if module == strings.TrimSuffix(modulePrefix, "/") {
+		return rootModule
+	}
+	return strings.TrimPrefix(module, modulePrefix)
+}
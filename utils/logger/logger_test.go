@@ -0,0 +1,152 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/qiniu/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntry(t *testing.T) {
+	entry, ok := parseEntry([]byte("2018/01/02 15:04:05 [abc][INFO][github.com/qiniu/logkit/mgr] runner.go:123: Runner[r1] send error\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "info", entry.Level)
+	assert.Equal(t, "mgr", entry.Module)
+	assert.Equal(t, "runner.go:123", entry.File)
+	assert.Equal(t, "r1", entry.Runner)
+	assert.Equal(t, "abc", entry.ReqID)
+	assert.Equal(t, "Runner[r1] send error", entry.Message)
+
+	entry, ok = parseEntry([]byte("2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit] logkit.go:1: start\n"))
+	assert.True(t, ok)
+	assert.Equal(t, rootModule, entry.Module)
+	assert.Equal(t, log.Ldebug, entry.level)
+
+	_, ok = parseEntry([]byte("plain text\n"))
+	assert.False(t, ok)
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+	level, err := ParseLevel("2")
+	assert.NoError(t, err)
+	assert.Equal(t, log.Lwarn, level)
+}
+
+func TestWriter(t *testing.T) {
+	defer func() {
+		SetFormat(FormatText)
+		SetLevels(Levels{Default: "info"})
+	}()
+	var buf bytes.Buffer
+	w := &writer{out: &buf, format: FormatText, defaultLevel: log.Linfo}
+	std = w
+
+	assert.NoError(t, SetLevels(Levels{Default: "warn", Modules: map[string]string{"reader": "debug", "reader/tailx": "error"}}))
+	assert.Equal(t, log.Ldebug, log.GetOutputLevel())
+	assert.Equal(t, Levels{Default: "warn", Modules: map[string]string{"reader": "debug", "reader/tailx": "error"}}, GetLevels())
+
+	lines := []string{
+		"2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit/reader] reader.go:1: reader debug\n",
+		"2018/01/02 15:04:05 [WARN][github.com/qiniu/logkit/reader/tailx] tailx.go:1: tailx warn\n",
+		"2018/01/02 15:04:05 [ERROR][github.com/qiniu/logkit/reader/tailx] tailx.go:1: tailx error\n",
+		"2018/01/02 15:04:05 [INFO][github.com/qiniu/logkit/mgr] mgr.go:1: mgr info\n",
+		"2018/01/02 15:04:05 [WARN][github.com/qiniu/logkit/mgr] mgr.go:1: mgr warn\n",
+		"not a log header\n",
+	}
+	for _, line := range lines {
+		n, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.Equal(t, lines[0]+lines[2]+lines[4]+lines[5], buf.String())
+
+	buf.Reset()
+	assert.NoError(t, SetFormat(FormatJSON))
+	w.Write([]byte(lines[4]))
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "mgr", entry["module"])
+	assert.Equal(t, "mgr warn", entry["message"])
+
+	assert.Error(t, SetFormat("xml"))
+	assert.Error(t, SetLevels(Levels{Modules: map[string]string{"mgr": "verbose"}}))
+}
+
+func TestRunnerLevels(t *testing.T) {
+	defer SetLevels(Levels{Default: "info"})
+	var buf bytes.Buffer
+	w := &writer{out: &buf, format: FormatText, defaultLevel: log.Linfo}
+	std = w
+
+	assert.NoError(t, SetLevels(Levels{Default: "info", Modules: map[string]string{"reader": "error"}, Runners: map[string]string{"r1": "debug"}}))
+	assert.Equal(t, log.Ldebug, log.GetOutputLevel())
+	assert.Equal(t, map[string]string{"r1": "debug"}, GetLevels().Runners)
+
+	lines := []string{
+		"2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit/reader] reader.go:1: Runner[r1] reader debug\n",
+		"2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit/mgr] runner.go:1: Runner[r2] runner debug\n",
+		"2018/01/02 15:04:05 [WARN][github.com/qiniu/logkit/reader] reader.go:1: Runner[r2] reader warn\n",
+		"2018/01/02 15:04:05 [INFO][github.com/qiniu/logkit/mgr] runner.go:1: Runner[r2] runner info\n",
+	}
+	for _, line := range lines {
+		w.Write([]byte(line))
+	}
+	assert.Equal(t, lines[0]+lines[3], buf.String())
+
+	assert.Error(t, SetLevels(Levels{Runners: map[string]string{"r1": "verbose"}}))
+	assert.NoError(t, SetLevels(Levels{}))
+	assert.Nil(t, GetLevels().Runners)
+}
+
+func TestEventOutput(t *testing.T) {
+	defer SetLevels(Levels{Default: "info"})
+	var buf, event bytes.Buffer
+	w := &writer{out: &buf, format: FormatJSON, defaultLevel: log.Linfo}
+	std = w
+	SetEventOutput(&event, log.Lwarn)
+	defer SetEventOutput(nil, 0)
+
+	lines := []string{
+		"2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit/mgr] mgr.go:1: mgr debug\n",
+		"2018/01/02 15:04:05 [INFO][github.com/qiniu/logkit/mgr] mgr.go:1: mgr info\n",
+		"2018/01/02 15:04:05 [WARN][github.com/qiniu/logkit/mgr] mgr.go:1: mgr warn\n",
+		"2018/01/02 15:04:05 [ERROR][github.com/qiniu/logkit/mgr] mgr.go:1: mgr error\n",
+		"not a log header\n",
+	}
+	for _, line := range lines {
+		w.Write([]byte(line))
+	}
+	assert.Equal(t, lines[2]+lines[3], event.String())
+	assert.Equal(t, 4, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestSetOutput(t *testing.T) {
+	defer SetOutput(os.Stderr)
+	defer func(old *writer) { std = old }(std)
+	std = &writer{out: os.Stderr, format: FormatText, defaultLevel: log.Linfo}
+
+	// 没有调用 Init 时 SetOutput 也会把 qiniu/log 的输出写到 out 中
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	log.Info("to buf")
+	assert.Contains(t, buf.String(), "to buf")
+
+	// 文本格式并且没有模块级别时原样输出, 不解析日志头
+	std.mutex.RLock()
+	assert.True(t, std.plain())
+	std.mutex.RUnlock()
+	buf.Reset()
+	line := "2018/01/02 15:04:05 [DEBUG][github.com/qiniu/logkit/mgr] mgr.go:1: mgr debug\n"
+	std.Write([]byte(line))
+	assert.Equal(t, line, buf.String())
+
+	assert.NoError(t, SetLevels(Levels{Modules: map[string]string{"reader": "error"}}))
+	defer SetLevels(Levels{Default: "info"})
+	std.mutex.RLock()
+	assert.False(t, std.plain())
+	std.mutex.RUnlock()
+}
@@ -5,13 +5,32 @@ const (
 	ErrNothing = "L200"
 
 	// 单机版 Runner 操作
-	ErrConfigName   = "L1001"
-	ErrRunnerAdd    = "L1002"
-	ErrRunnerDelete = "L1003"
-	ErrRunnerStart  = "L1004"
-	ErrRunnerStop   = "L1005"
-	ErrRunnerReset  = "L1006"
-	ErrRunnerUpdate = "L1007"
+	ErrConfigName     = "L1001"
+	ErrRunnerAdd      = "L1002"
+	ErrRunnerDelete   = "L1003"
+	ErrRunnerStart    = "L1004"
+	ErrRunnerStop     = "L1005"
+	ErrRunnerReset    = "L1006"
+	ErrRunnerUpdate   = "L1007"
+	ErrRunnerErrors   = "L1008"
+	ErrLogLevel       = "L1009"
+	ErrDebug          = "L1010"
+	ErrAudit          = "L1011"
+	ErrConfigsExport  = "L1012"
+	ErrConfigsImport  = "L1013"
+	ErrTemplate       = "L1014"
+	ErrTail           = "L1015"
+	ErrNotReady       = "L1016"
+	ErrRunnerFlush    = "L1017"
+	ErrConfigCheck    = "L1018"
+	ErrStatsHistory   = "L1019"
+	ErrRunnerTrace    = "L1020"
+	ErrUpgrade        = "L1021"
+	ErrRateLimit      = "L1022"
+	ErrCleanerReport  = "L1023"
+	ErrDeliveryReport = "L1024"
+	ErrReaderFiles    = "L1025"
+	ErrCheckpoint     = "L1026"
 
 	// read 相关
 	ErrReadRead = "L1101"
@@ -41,18 +60,39 @@ const (
 	ErrClusterRunnerUpdate = "L2011"
 	ErrClusterSlavesDelete = "L2012"
 	ErrClusterSlavesTag    = "L2013"
+	ErrClusterUpgrade      = "L2015"
+	ErrClusterRollout      = "L2016"
 )
 
 var ErrorCodeHumanize = map[string]string{
 	ErrNothing: "操作成功",
 
-	ErrConfigName:   "获取 Config 出现错误",
-	ErrRunnerAdd:    "添加 Runner 出现错误",
-	ErrRunnerDelete: "删除 Runner 出现错误",
-	ErrRunnerStart:  "开启 Runner 出现错误",
-	ErrRunnerStop:   "关闭 Runner 出现错误",
-	ErrRunnerReset:  "重置 Runner 出现错误",
-	ErrRunnerUpdate: "更新 Runner 出现错误",
+	ErrConfigName:     "获取 Config 出现错误",
+	ErrRunnerAdd:      "添加 Runner 出现错误",
+	ErrRunnerDelete:   "删除 Runner 出现错误",
+	ErrRunnerStart:    "开启 Runner 出现错误",
+	ErrRunnerStop:     "关闭 Runner 出现错误",
+	ErrRunnerReset:    "重置 Runner 出现错误",
+	ErrRunnerUpdate:   "更新 Runner 出现错误",
+	ErrRunnerErrors:   "获取 Runner 错误记录出现错误",
+	ErrLogLevel:       "更改日志级别出现错误",
+	ErrDebug:          "调试接口出现错误",
+	ErrAudit:          "查询审计日志出现错误",
+	ErrConfigsExport:  "导出 Runner 配置出现错误",
+	ErrConfigsImport:  "导入 Runner 配置出现错误",
+	ErrTemplate:       "Runner 模板操作出现错误",
+	ErrTail:           "实时查看 Runner 数据出现错误",
+	ErrNotReady:       "存在没有就绪的 Runner",
+	ErrRunnerFlush:    "Flush Runner 出现错误",
+	ErrConfigCheck:    "Runner 配置校验未通过",
+	ErrStatsHistory:   "获取 Runner 历史统计信息出现错误",
+	ErrRunnerTrace:    "跟踪 Runner 出现错误",
+	ErrUpgrade:        "升级 logkit 出现错误",
+	ErrRateLimit:      "修改带宽限制出现错误",
+	ErrCleanerReport:  "获取 Cleaner 清理结果出现错误",
+	ErrDeliveryReport: "获取投递审计报告出现错误",
+	ErrReaderFiles:    "获取 Reader 文件读取状态出现错误",
+	ErrCheckpoint:     "导出或导入 Reader 读取进度出现错误",
 
 	ErrParseParse: "解析字符串失败",
 
@@ -74,4 +114,6 @@ var ErrorCodeHumanize = map[string]string{
 	ErrClusterRunnerUpdate: "Slaves 更新 Runner 出现错误",
 	ErrClusterSlavesDelete: "Slaves 从列表中移除时出现错误",
 	ErrClusterSlavesTag:    "Slaves 更改 Tag 出现错误",
+	ErrClusterUpgrade:      "Slaves 升级 logkit 出现错误",
+	ErrClusterRollout:      "获取滚动下发记录出现错误",
 }
@@ -26,6 +26,9 @@ const (
 	KeyPandoraStash      = "pandora_stash"       // 当只有一条数据且 sendError 时候，将其转化为 raw 发送到 pandora_stash 这个字段
 	KeyPandoraSeparateId = "pandora_separate_id" // 当一条数据大于2M且 sendError 时候，将其切片，切片记录到 pandora_separate_id 这个字段
 
+	// HeaderLineMarker 在 reader 配置了 mark_first_line 时加在新文件第一行的开头，解析器据此识别文件的表头
+	HeaderLineMarker = "\x00logkit_file_header\x00"
+
 	SchemaFreeTokensPrefix = "schema_free_tokens_"
 	LogDBTokensPrefix      = "logdb_tokens_"
 	TsDBTokensPrefix       = "tsdb_tokens_"
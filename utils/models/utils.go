@@ -658,6 +658,12 @@ func Bool2String(i bool) string {
 }
 
 func ConvertDate(layoutBefore, layoutAfter string, offset int, v interface{}) (interface{}, error) {
+	return ConvertDateInLocation(layoutBefore, layoutAfter, offset, nil, v)
+}
+
+// ConvertDateInLocation 与 ConvertDate 相同，loc 不为空时，不带时区信息的时间按照 loc 解析，
+// 并且输出 loc 时区的时间
+func ConvertDateInLocation(layoutBefore, layoutAfter string, offset int, loc *time.Location, v interface{}) (interface{}, error) {
 	var s int64
 	switch newv := v.(type) {
 	case int64:
@@ -674,17 +680,21 @@ func ConvertDate(layoutBefore, layoutAfter string, offset int, v interface{}) (i
 		s = int64(newv)
 	case string:
 		if layoutBefore != "" {
-			t, err := time.Parse(layoutBefore, newv)
+			parseLoc := loc
+			if parseLoc == nil {
+				parseLoc = time.UTC
+			}
+			t, err := time.ParseInLocation(layoutBefore, newv, parseLoc)
 			if err != nil {
 				return v, fmt.Errorf("can not parse %v with layout %v", newv, layoutAfter)
 			}
-			return FormatWithUserOption(layoutAfter, offset, t), nil
+			return formatInLocation(layoutAfter, offset, loc, t), nil
 		}
-		t, err := times.StrToTime(newv)
+		t, err := times.StrToTimeInLocation(newv, loc)
 		if err != nil {
 			return v, err
 		}
-		return FormatWithUserOption(layoutAfter, offset, t), nil
+		return formatInLocation(layoutAfter, offset, loc, t), nil
 	case json.Number:
 		jsonNumber, err := newv.Int64()
 		if err != nil {
@@ -694,21 +704,15 @@ func ConvertDate(layoutBefore, layoutAfter string, offset int, v interface{}) (i
 	default:
 		return v, fmt.Errorf("can not parse %v type %v as date time", v, reflect.TypeOf(v))
 	}
-	news := s
-	timestamp := strconv.FormatInt(news, 10)
-	timeSecondPrecision := 16
-	//补齐16位
-	for i := len(timestamp); i < timeSecondPrecision; i++ {
-		timestamp += "0"
-	}
-	// 取前16位，截取精度 微妙
-	timestamp = timestamp[0:timeSecondPrecision]
-	t, err := strconv.ParseInt(timestamp, 10, 64)
-	if err != nil {
-		return v, err
+	// 根据位数判断秒、毫秒、微秒、纳秒，保留纳秒精度
+	return formatInLocation(layoutAfter, offset, loc, times.UnixToTime(s)), nil
+}
+
+func formatInLocation(layoutAfter string, offset int, loc *time.Location, t time.Time) interface{} {
+	if loc != nil {
+		t = t.In(loc)
 	}
-	tm := time.Unix(0, t*int64(time.Microsecond))
-	return FormatWithUserOption(layoutAfter, offset, tm), nil
+	return FormatWithUserOption(layoutAfter, offset, t)
 }
 
 func FormatWithUserOption(layoutAfter string, offset int, t time.Time) interface{} {
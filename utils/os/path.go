@@ -0,0 +1,181 @@
+package os
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RecursiveWildcard 作为路径中单独的一级时匹配任意层(包括0层)目录
+const RecursiveWildcard = "**"
+
+// Glob 与 filepath.Glob 相同，但在文件名大小写不敏感的系统(Windows)上匹配时忽略大小写，
+// 盘符和 UNC 路径的卷名部分保持不变。
+// pattern 中单独一级的 ** 匹配任意层目录，如 /logs/**/*.log 可以匹配 /logs/a.log 和 /logs/app/1/a.log，
+// 此时需要遍历 ** 之前的目录，末尾的 ** 匹配目录下所有的文件和子目录
+func Glob(pattern string) ([]string, error) {
+	base, rest, ok := splitRecursive(pattern)
+	if !ok {
+		return glob(pattern)
+	}
+	if base == "" {
+		base = "."
+	}
+	bases, err := glob(filepath.Clean(base))
+	if err != nil {
+		return nil, err
+	}
+	restParts := append([]string{RecursiveWildcard}, splitPath(rest)...)
+	if rest == "" {
+		restParts = restParts[:1]
+	}
+	seen := make(map[string]bool)
+	var matches []string
+	for _, b := range bases {
+		err = filepath.Walk(b, func(path string, info os.FileInfo, err error) error {
+			// 没有权限等无法读取的目录直接跳过
+			if err != nil || path == b {
+				return nil
+			}
+			rel, err := filepath.Rel(b, path)
+			if err != nil {
+				return nil
+			}
+			matched, err := matchParts(restParts, splitPath(rel))
+			if err != nil {
+				return err
+			}
+			if matched && !seen[path] {
+				seen[path] = true
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func glob(pattern string) ([]string, error) {
+	if !caseInsensitive {
+		return filepath.Glob(pattern)
+	}
+	vol := filepath.VolumeName(pattern)
+	return filepath.Glob(vol + foldPattern(pattern[len(vol):]))
+}
+
+// Match 与 filepath.Match 相同，但在文件名大小写不敏感的系统上匹配时忽略大小写，
+// pattern 中单独一级的 ** 与 Glob 中一样匹配任意层目录
+func Match(pattern, name string) (bool, error) {
+	if _, _, ok := splitRecursive(pattern); ok {
+		return matchParts(splitPath(pattern), splitPath(name))
+	}
+	return match(pattern, name)
+}
+
+func match(pattern, name string) (bool, error) {
+	if !caseInsensitive {
+		return filepath.Match(pattern, name)
+	}
+	return filepath.Match(strings.ToLower(pattern), strings.ToLower(name))
+}
+
+// splitRecursive 在第一个单独一级的 ** 处把 pattern 分成前后两部分，没有 ** 时 ok 为 false
+func splitRecursive(pattern string) (base, rest string, ok bool) {
+	start := 0
+	for i := 0; i <= len(pattern); i++ {
+		if i < len(pattern) && !os.IsPathSeparator(pattern[i]) {
+			continue
+		}
+		if pattern[start:i] == RecursiveWildcard {
+			if i < len(pattern) {
+				rest = pattern[i+1:]
+			}
+			return pattern[:start], rest, true
+		}
+		start = i + 1
+	}
+	return "", "", false
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r < 0x80 && os.IsPathSeparator(uint8(r))
+	})
+}
+
+// matchParts 逐级匹配路径，** 可以匹配任意层(包括0层)
+func matchParts(patterns, names []string) (bool, error) {
+	for len(patterns) > 0 {
+		if patterns[0] == RecursiveWildcard {
+			for i := 0; i <= len(names); i++ {
+				matched, err := matchParts(patterns[1:], names[i:])
+				if matched || err != nil {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(names) == 0 {
+			return false, nil
+		}
+		matched, err := match(patterns[0], names[0])
+		if !matched || err != nil {
+			return false, err
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0, nil
+}
+
+// SamePath 判断两个路径是否指向同一个位置，在文件名大小写不敏感的系统上忽略大小写
+func SamePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// SafeFileName 把路径转换成可以作为文件名的字符串，路径分隔符以及 Windows 上盘符中的冒号等不能出现在文件名中的字符会被替换为下划线
+func SafeFileName(path string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalidFileNameChars, r) {
+			return '_'
+		}
+		return r
+	}, path)
+}
+
+// foldPattern 把 pattern 中的字母替换为同时匹配大小写的字符类，如 logs\*.log 变为 [lL][oO][gG][sS]\*.[lL][oO][gG]，
+// 已有的字符类保持不变
+func foldPattern(pattern string) string {
+	var buf bytes.Buffer
+	inClass := false
+	for _, r := range pattern {
+		switch {
+		case inClass:
+			if r == ']' {
+				inClass = false
+			}
+			buf.WriteRune(r)
+		case r == '[':
+			inClass = true
+			buf.WriteRune(r)
+		case unicode.IsLetter(r) && unicode.ToLower(r) != unicode.ToUpper(r):
+			buf.WriteRune('[')
+			buf.WriteRune(unicode.ToLower(r))
+			buf.WriteRune(unicode.ToUpper(r))
+			buf.WriteRune(']')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
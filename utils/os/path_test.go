@@ -0,0 +1,124 @@
+package os
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldPattern(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"*":           "*",
+		"Ab/*.log":    "[aA][bB]/*.[lL][oO][gG]",
+		"a[0-9]?.Txt": "[aA][0-9]?.[tT][xX][tT]",
+		"日志_1":        "日志_1",
+	}
+	for pattern, exp := range tests {
+		got := foldPattern(pattern)
+		assert.Equal(t, exp, got, pattern)
+		if pattern == "" {
+			continue
+		}
+		_, err := filepath.Match(got, "x")
+		assert.NoError(t, err, pattern)
+	}
+}
+
+func TestSafeFileName(t *testing.T) {
+	p := string(os.PathSeparator) + filepath.Join("var", "log", "a.log")
+	assert.Equal(t, "_var_log_a.log", SafeFileName(p))
+	if caseInsensitive {
+		assert.Equal(t, "C__logs_a.log", SafeFileName(`C:\logs\a.log`))
+		assert.Equal(t, "__server_share_a.log", SafeFileName(`\\server\share\a.log`))
+	}
+}
+
+func TestGlobAndMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGlobAndMatch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"App.log", "app.txt"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0644))
+	}
+
+	matches, err := Glob(filepath.Join(dir, "*.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "App.log")}, matches)
+
+	matches, err = Glob(filepath.Join(dir, "app.*"))
+	assert.NoError(t, err)
+	sort.Strings(matches)
+	matched, err := Match("app.*", "App.log")
+	assert.NoError(t, err)
+	if caseInsensitive {
+		assert.Equal(t, []string{filepath.Join(dir, "App.log"), filepath.Join(dir, "app.txt")}, matches)
+		assert.True(t, matched)
+		assert.True(t, SamePath(`C:\Logs\`, `c:\logs`))
+	} else {
+		assert.Equal(t, []string{filepath.Join(dir, "app.txt")}, matches)
+		assert.False(t, matched)
+		assert.False(t, SamePath("/var/Log", "/var/log"))
+	}
+	assert.True(t, SamePath(filepath.Join(dir, "a", ".."), dir))
+}
+
+func TestGlobRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGlobRecursive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.log", "svc1/b.log", "svc1/x/c.log", "svc2/x/y/d.log", "svc2/x/y/d.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte("x"), 0644))
+	}
+	join := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	tests := map[string][]string{
+		"**/*.log":       join("a.log", "svc1/b.log", "svc1/x/c.log", "svc2/x/y/d.log"),
+		"svc*/**/*.log":  join("svc1/b.log", "svc1/x/c.log", "svc2/x/y/d.log"),
+		"**/x/**/d.*":    join("svc2/x/y/d.log", "svc2/x/y/d.txt"),
+		"svc2/**":        join("svc2/x", "svc2/x/y", "svc2/x/y/d.log", "svc2/x/y/d.txt"),
+		"**/none/*.log":  nil,
+		"svc3/**/*.log":  nil,
+		"svc1/x/**/*.**": join("svc1/x/c.log"),
+	}
+	for pattern, exp := range tests {
+		matches, err := Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		assert.NoError(t, err, pattern)
+		assert.Equal(t, exp, matches, pattern)
+	}
+}
+
+func TestMatchRecursive(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		exp           bool
+	}{
+		{"/logs/**/*.log", "/logs/a.log", true},
+		{"/logs/**/*.log", "/logs/a/b/c.log", true},
+		{"/logs/**/*.log", "/logs/a/b/c.txt", false},
+		{"/logs/**", "/logs/a/b", true},
+		{"/logs/**/x", "/logs/x", true},
+		{"/logs/**/x", "/data/x", false},
+		{"/logs/a**/x", "/logs/ab/x", true},
+		{"/logs/a**/x", "/logs/a/b/x", false},
+	}
+	for _, test := range tests {
+		matched, err := Match(filepath.FromSlash(test.pattern), filepath.FromSlash(test.name))
+		assert.NoError(t, err, test.pattern)
+		assert.Equal(t, test.exp, matched, test.pattern+" "+test.name)
+	}
+	_, err := Match("/logs/**/[", "/logs/a/b")
+	assert.Error(t, err)
+}
@@ -0,0 +1,8 @@
+// +build windows
+
+package os
+
+const (
+	caseInsensitive      = true
+	invalidFileNameChars = `\/:*?"<>|`
+)
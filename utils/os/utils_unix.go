@@ -3,7 +3,9 @@
 package os
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"syscall"
 )
 
@@ -38,3 +40,16 @@ func GetIdentifyIDByFile(f *os.File) (uint64, error) {
 	inode := getInode(finfo)
 	return inode, nil
 }
+
+// GetFileID 返回文件所在设备号和 inode 组成的标识，文件改名后不变
+func GetFileID(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("cannot get device and inode of %v", path)
+	}
+	return strconv.FormatUint(uint64(s.Dev), 10) + ":" + strconv.FormatUint(s.Ino, 10), nil
+}
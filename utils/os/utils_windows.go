@@ -36,6 +36,20 @@ func GetIdentifyIDByFile(f *os.File) (uint64, error) {
 	return inode, nil
 }
 
+// GetFileID 返回文件所在卷的序列号和文件索引组成的标识，文件改名后不变
+func GetFileID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+		return "", fmt.Errorf(" syscall.GetFileInformationByHandle error %v", err)
+	}
+	return fmt.Sprintf("%d:%d", d.VolumeSerialNumber, uint64(d.FileIndexHigh)<<32+uint64(d.FileIndexLow)), nil
+}
+
 func GetOSInfo() *OSInfo {
 	// default osInfo
 	osInfo := &OSInfo{Kernel: "windows", Core: "unknown", Platform: runtime.GOARCH, OS: "windows"}
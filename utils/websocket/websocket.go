@@ -0,0 +1,216 @@
+// Package websocket 实现了服务端推送数据所需的最小 RFC 6455 子集:
+// 握手、发送文本帧、响应 ping 和 close, 不支持扩展和分片消息的重组
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseMessageTooBig = 1009
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// 客户端只会发送 ping、close 等控制帧, 限制每帧的大小避免恶意请求占用内存
+	maxFrameSize = 64 * 1024
+)
+
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Conn 是一个服务端的 websocket 连接, 写操作可以并发调用, 读操作只能在一个 goroutine 中调用
+type Conn struct {
+	conn       net.Conn
+	br         *bufio.Reader
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+}
+
+func headerContains(h http.Header, key, value string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(key)] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptKey 计算握手响应中的 Sec-WebSocket-Accept
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Upgrade 将 http 请求升级为 websocket 连接, 失败时已向客户端返回错误
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-Websocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, ErrBadHandshake.Error(), http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: response does not implement http.Hijacker", http.StatusInternalServerError)
+		return nil, ErrBadHandshake
+	}
+	netConn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err = netConn.Write([]byte(resp)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &Conn{conn: netConn, br: rw.Reader}, nil
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | byte(opcode)
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteText 发送一条文本消息
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(OpText, data)
+}
+
+// WriteClose 发送 close 帧, 之后不应再发送数据
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+	return c.writeFrame(OpClose, payload)
+}
+
+// SetDeadline 设置底层连接的读写超时
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxFrameSize {
+		c.WriteClose(CloseMessageTooBig, "")
+		err = fmt.Errorf("websocket: frame size %v exceeds limit %v", length, maxFrameSize)
+		return
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// ReadMessage 读取客户端发来的下一条数据消息, ping 会被自动回复,
+// 收到 close 时回复 close 并返回 io.EOF
+func (c *Conn) ReadMessage() (opcode int, payload []byte, err error) {
+	for {
+		_, opcode, payload, err = c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case OpPing:
+			if err = c.writeFrame(OpPong, payload); err != nil {
+				return
+			}
+		case OpPong:
+		case OpClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.WriteClose(code, "")
+			return opcode, nil, io.EOF
+		default:
+			return
+		}
+	}
+}
+
+// Close 关闭底层连接
+func (c *Conn) Close() (err error) {
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+	})
+	return
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeClientFrame(t *testing.T, conn net.Conn, opcode int, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | byte(opcode), 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	assert.NoError(t, err)
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (int, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(br, header[:])
+	assert.NoError(t, err)
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(br, payload)
+	assert.NoError(t, err)
+	return int(header[0] & 0x0F), payload
+}
+
+func TestWebsocket(t *testing.T) {
+	// RFC 6455 中的例子
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+
+	done := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteText([]byte("hello"))
+		conn.WriteText([]byte(strings.Repeat("a", 200)))
+		_, _, err = conn.ReadMessage()
+		done <- err
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	assert.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	opcode, payload := readServerFrame(t, br)
+	assert.Equal(t, OpText, opcode)
+	assert.Equal(t, "hello", string(payload))
+	_, payload = readServerFrame(t, br)
+	assert.Len(t, payload, 200)
+
+	writeClientFrame(t, conn, OpPing, []byte("ping"))
+	opcode, payload = readServerFrame(t, br)
+	assert.Equal(t, OpPong, opcode)
+	assert.Equal(t, "ping", string(payload))
+
+	writeClientFrame(t, conn, OpClose, []byte{0x03, 0xE8})
+	opcode, payload = readServerFrame(t, br)
+	assert.Equal(t, OpClose, opcode)
+	assert.Equal(t, CloseNormal, int(binary.BigEndian.Uint16(payload)))
+	assert.Equal(t, io.EOF, <-done)
+}